@@ -0,0 +1,449 @@
+// Package abatest sets up clusters of protocol nodes over the in-process
+// network for integration tests, so tests of code built on the services do
+// not have to wire networks, managers and result channels by hand:
+//
+//	c := abatest.NewABACluster(t, func(id int) int { return id % 2 },
+//		abatest.WithNodes(7, 2),
+//		abatest.WithByzantine(7, services.NewABAEquivocator()),
+//		abatest.WithLatency(5*time.Millisecond))
+//	abatest.StartABA(c)
+//	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+//
+// Clusters stop themselves when the test ends.
+package abatest
+
+import (
+	"async-agreement-protocol-3/services"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resultBuffer is the capacity of every result channel, like the outbox of a
+// ServiceManager.
+const resultBuffer = 1000
+
+// Cluster is a running cluster of nodes 1..N, each running a service of type
+// S behind a ServiceManager on one Network.
+type Cluster[S services.Service[TMsg, TRes], TMsg any, TRes any] struct {
+	N       int
+	T       int
+	Network *services.Network[TMsg]
+
+	tb         testing.TB
+	cfg        *config
+	newService func(nc *services.NodeContext) S
+	nodes      []*clusterNode[S, TMsg, TRes] // Indexed by node ID - 1
+	done       chan struct{}
+	stop       sync.Once
+	mu         sync.RWMutex // Guards the nodes while Restart replaces their parts
+}
+
+type clusterNode[S services.Service[TMsg, TRes], TMsg any, TRes any] struct {
+	nc        *services.NodeContext
+	service   S
+	adversary *services.AdversarialNode[TMsg, TRes] // nil for honest nodes
+	manager   *services.ServiceManager[TMsg, TRes]
+	results   chan TRes
+
+	// WithRecovery only, nil otherwise
+	recoverable *services.RecoverableNode[S, TMsg, TRes]
+	gate        *crashGate[TMsg, TRes]
+	halted      *atomic.Bool // Set by a FaultInjector ahead of the crash
+	wal         services.WAL[TMsg]
+	calls       map[string]func(S, services.ServiceContext[TMsg, TRes])
+	crashed     bool
+}
+
+// New starts a cluster running newService on every node. classify describes
+// the messages for the chaos rule WithLatency installs. Prefer the layer
+// constructors (NewACastCluster, NewABACluster, ...), which fill both in.
+func New[S services.Service[TMsg, TRes], TMsg any, TRes any](tb testing.TB, newService func(nc *services.NodeContext) S, classify func(TMsg) services.MessageInfo, opts ...Option) *Cluster[S, TMsg, TRes] {
+	tb.Helper()
+	cfg := newConfig(opts)
+	if cfg.n < 1 || cfg.t < 0 {
+		tb.Fatalf("abatest: invalid cluster size n=%d t=%d", cfg.n, cfg.t)
+	}
+
+	c := &Cluster[S, TMsg, TRes]{
+		N:          cfg.n,
+		T:          cfg.t,
+		Network:    services.NewNetwork[TMsg](),
+		tb:         tb,
+		cfg:        cfg,
+		newService: newService,
+		done:       make(chan struct{}),
+	}
+	c.Network.SetSenderOf(func(msg TMsg) (int, bool) {
+		from := classify(msg).Sender
+		return from, from != 0
+	})
+	c.Network.SetLoopback(!cfg.noLoop)
+	if cfg.latency != nil {
+		chaos := services.NewChaos(classify)
+		chaos.Latency(services.MessageFilter{}, *cfg.latency, cfg.seed)
+		c.Network.SetChaos(chaos)
+	}
+	if cfg.faults != nil {
+		if err := cfg.faults.attach(c); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	for id := 1; id <= cfg.n; id++ {
+		nc := c.newNodeContext(id)
+		node := &clusterNode[S, TMsg, TRes]{
+			nc:      nc,
+			results: make(chan TRes, resultBuffer),
+		}
+		var svc services.Service[TMsg, TRes]
+		_, byzantine := cfg.byzantine[id]
+		if cfg.recovery && !byzantine {
+			node.wal = services.NewMemoryWAL[TMsg]()
+			node.calls = make(map[string]func(S, services.ServiceContext[TMsg, TRes]))
+			node.recoverable = services.NewRecoverableNode(nc, node.wal, newService)
+			node.service = node.recoverable.Service()
+			node.halted = new(atomic.Bool)
+			node.gate = &crashGate[TMsg, TRes]{service: node.recoverable, halted: node.halted}
+			svc = node.gate
+		} else {
+			node.service = newService(nc)
+			svc = node.service
+		}
+		if b, ok := cfg.byzantine[id]; ok {
+			behavior, ok := b.(services.ByzantineBehavior[TMsg, TRes])
+			if !ok {
+				tb.Fatalf("abatest: behavior %T of node %d does not fit the messages of this cluster", b, id)
+			}
+			node.adversary = services.NewAdversarialNode(svc, behavior)
+			svc = node.adversary
+		}
+		node.manager = services.NewServiceManager(svc, c.Network)
+		if node.gate != nil {
+			node.gate.inbox = node.manager.Inbox()
+		}
+		c.Network.Register(id, node.manager.Inbox())
+		c.nodes = append(c.nodes, node)
+	}
+	for _, node := range c.nodes {
+		node.manager.Start()
+		go c.forward(node.manager, node.results)
+	}
+	tb.Cleanup(c.Stop)
+	return c
+}
+
+// newNodeContext creates the context of node id as configured.
+func (c *Cluster[S, TMsg, TRes]) newNodeContext(id int) *services.NodeContext {
+	nc := services.NewNodeContext(id, c.cfg.n, c.cfg.t, c.cfg.logLevel)
+	for _, fn := range c.cfg.configure {
+		fn(nc)
+	}
+	if faults := c.cfg.faults; faults != nil {
+		hook := nc.Transitions
+		nc.Transitions = func(tr services.StateTransition) {
+			if hook != nil {
+				hook(tr)
+			}
+			faults.observe(tr)
+		}
+	}
+	return nc
+}
+
+// forward moves the results of manager onto results until Stop.
+func (c *Cluster[S, TMsg, TRes]) forward(manager *services.ServiceManager[TMsg, TRes], results chan TRes) {
+	for {
+		select {
+		case res := <-manager.Result():
+			select {
+			case results <- res:
+			case <-c.done:
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// node returns node id. Assumes c.mu is read-locked when its parts are read.
+func (c *Cluster[S, TMsg, TRes]) node(id int) *clusterNode[S, TMsg, TRes] {
+	if id < 1 || id > len(c.nodes) {
+		panic(fmt.Sprintf("abatest: no node %d in a cluster of %d", id, len(c.nodes)))
+	}
+	return c.nodes[id-1]
+}
+
+// NodeContext returns the shared state of node id.
+func (c *Cluster[S, TMsg, TRes]) NodeContext(id int) *services.NodeContext {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.node(id).nc
+}
+
+// Service returns the service of node id. For a Byzantine node this is the
+// honest service the behavior wraps.
+func (c *Cluster[S, TMsg, TRes]) Service(id int) S {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.node(id).service
+}
+
+// Manager returns the ServiceManager of node id, e.g. to feed its inbox.
+func (c *Cluster[S, TMsg, TRes]) Manager(id int) *services.ServiceManager[TMsg, TRes] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.node(id).manager
+}
+
+// Context returns the context for calls into the service of node id made
+// outside OnMessage (e.g. Start). Broadcasts of a Byzantine node made
+// through it pass its behavior.
+func (c *Cluster[S, TMsg, TRes]) Context(id int) services.ServiceContext[TMsg, TRes] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	node := c.node(id)
+	if node.adversary != nil {
+		return node.adversary.WrapContext(node.manager)
+	}
+	return node.manager
+}
+
+// Honest returns the IDs of the nodes without a Byzantine behavior.
+func (c *Cluster[S, TMsg, TRes]) Honest() []int {
+	var ids []int
+	for i, node := range c.nodes {
+		if node.adversary == nil {
+			ids = append(ids, i+1)
+		}
+	}
+	return ids
+}
+
+// Results returns the channel receiving the results of node id.
+func (c *Cluster[S, TMsg, TRes]) Results(id int) <-chan TRes {
+	return c.node(id).results
+}
+
+// Await waits until every node in ids has produced a result accepted by
+// match (nil accepts any) and returns them by node ID. Results match
+// rejects are consumed.
+func (c *Cluster[S, TMsg, TRes]) Await(ids []int, timeout time.Duration, match func(TRes) bool) (map[int]TRes, error) {
+	return await(c.Results, ids, timeout, match)
+}
+
+// Stop stops every node. It is registered as a cleanup of the test that
+// created the cluster, so calling it is only needed to stop earlier.
+func (c *Cluster[S, TMsg, TRes]) Stop() {
+	c.stop.Do(func() {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		close(c.done)
+		for _, node := range c.nodes {
+			node.manager.Stop()
+		}
+	})
+}
+
+// Call runs fn on the service of node id, with the context Context(id)
+// returns. Local calls that start protocols (Start, StartSharing, ...) should
+// go through Call: on a cluster WithRecovery it logs the call under name, so
+// a node restarted by Restart replays it. Names must be unique per call.
+func (c *Cluster[S, TMsg, TRes]) Call(id int, name string, fn func(s S, ctx services.ServiceContext[TMsg, TRes])) error {
+	c.mu.RLock()
+	node := c.node(id)
+	if node.recoverable == nil {
+		c.mu.RUnlock()
+		fn(c.Service(id), c.Context(id))
+		return nil
+	}
+	if node.crashed {
+		c.mu.RUnlock()
+		return fmt.Errorf("abatest: node %d is crashed", id)
+	}
+	node.calls[name] = fn
+	recoverable, manager := node.recoverable, node.manager
+	c.mu.RUnlock()
+
+	recoverable.Handle(name, fn)
+	return recoverable.Call(name, manager)
+}
+
+// call is Call for the start helpers, which report failures to the test.
+func (c *Cluster[S, TMsg, TRes]) call(id int, name string, fn func(s S, ctx services.ServiceContext[TMsg, TRes])) {
+	if err := c.Call(id, name, fn); err != nil {
+		c.tb.Errorf("abatest: %s at node %d: %v", name, id, err)
+	}
+}
+
+// WAL returns the write-ahead log of node id, nil unless the cluster was
+// created WithRecovery.
+func (c *Cluster[S, TMsg, TRes]) WAL(id int) services.WAL[TMsg] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.node(id).wal
+}
+
+// Crash stops node id as if its process died: it processes nothing until
+// Restart. Messages sent to it meanwhile wait in the network, like they
+// would in the send queues of its peers. The cluster must have been created
+// WithRecovery.
+func (c *Cluster[S, TMsg, TRes]) Crash(id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.node(id)
+	if node.recoverable == nil {
+		return fmt.Errorf("abatest: node %d is not recoverable, create the cluster WithRecovery and keep the node honest", id)
+	}
+	if node.crashed {
+		return fmt.Errorf("abatest: node %d is already crashed", id)
+	}
+	node.manager.Stop()
+	node.gate.crash()
+	node.crashed = true
+	return nil
+}
+
+// Restart brings a crashed node back as a new process would: it creates a
+// fresh context and service, replays the write-ahead log of the node into
+// them and then delivers the messages that arrived while it was down.
+func (c *Cluster[S, TMsg, TRes]) Restart(id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.node(id)
+	if !node.crashed {
+		return fmt.Errorf("abatest: node %d is not crashed", id)
+	}
+
+	nc := c.newNodeContext(id)
+	recoverable := services.NewRecoverableNode(nc, node.wal, c.newService)
+	for name, fn := range node.calls {
+		recoverable.Handle(name, fn)
+	}
+	node.halted.Store(false)
+	gate := &crashGate[TMsg, TRes]{service: recoverable, halted: node.halted}
+	manager := services.NewServiceManager[TMsg, TRes](gate, c.Network)
+	gate.inbox = manager.Inbox()
+	held := node.manager.Inbox()
+	c.Network.Register(id, manager.Inbox())
+	if err := recoverable.Recover(manager); err != nil {
+		return fmt.Errorf("abatest: recovering node %d: %w", id, err)
+	}
+
+	node.nc = nc
+	node.service = recoverable.Service()
+	node.recoverable = recoverable
+	node.gate = gate
+	node.manager = manager
+	node.crashed = false
+	manager.Start()
+	go c.forward(manager, node.results)
+	go c.redeliver(held, manager.Inbox())
+	return nil
+}
+
+// halt makes node id stop processing messages right away, ahead of a Crash.
+// It does not lock c.mu, so it is safe within a transition hook.
+func (c *Cluster[S, TMsg, TRes]) halt(id int) {
+	if halted := c.node(id).halted; halted != nil {
+		halted.Store(true)
+	}
+}
+
+func (c *Cluster[S, TMsg, TRes]) stopped() <-chan struct{} {
+	return c.done
+}
+
+// redeliver moves the messages held for a crashed node to its new inbox.
+// Broadcasts still in flight to the old inbox keep arriving, so it runs
+// until Stop.
+func (c *Cluster[S, TMsg, TRes]) redeliver(held <-chan TMsg, inbox chan<- TMsg) {
+	for {
+		select {
+		case msg := <-held:
+			select {
+			case inbox <- msg:
+			case <-c.done:
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// crashGate passes messages to a recoverable node until crash, or until a
+// FaultInjector halts it just before. The manager of a crashed node may
+// still take a few messages from its inbox before it notices it was
+// stopped; the gate puts them back into the inbox for the restarted node,
+// so they neither slip into the log behind the replay nor get lost.
+type crashGate[TMsg any, TRes any] struct {
+	service services.Service[TMsg, TRes]
+	inbox   chan TMsg
+	halted  *atomic.Bool
+	crashed bool
+	mu      sync.Mutex
+}
+
+func (g *crashGate[TMsg, TRes]) OnMessage(msg TMsg, ctx services.ServiceContext[TMsg, TRes]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.crashed || g.halted.Load() {
+		go func() { g.inbox <- msg }()
+		return
+	}
+	g.service.OnMessage(msg, ctx)
+}
+
+func (g *crashGate[TMsg, TRes]) crash() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.crashed = true
+}
+
+// await reads the result channels of ids until each yielded a match.
+func await[TRes any](results func(id int) <-chan TRes, ids []int, timeout time.Duration, match func(TRes) bool) (map[int]TRes, error) {
+	expired := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() { close(expired) })
+	defer timer.Stop()
+
+	got := make(map[int]TRes, len(ids))
+	var missing []int
+	for _, id := range ids {
+		if res, ok := awaitMatch(results(id), expired, match); ok {
+			got[id] = res
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return got, fmt.Errorf("nodes %v produced no matching result within %v", missing, timeout)
+	}
+	return got, nil
+}
+
+func awaitMatch[TRes any](ch <-chan TRes, expired <-chan struct{}, match func(TRes) bool) (TRes, bool) {
+	for {
+		// Results already produced count even once the time is up
+		select {
+		case res := <-ch:
+			if match == nil || match(res) {
+				return res, true
+			}
+			continue
+		default:
+		}
+		select {
+		case res := <-ch:
+			if match == nil || match(res) {
+				return res, true
+			}
+		case <-expired:
+			var zero TRes
+			return zero, false
+		}
+	}
+}
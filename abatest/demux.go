@@ -0,0 +1,109 @@
+package abatest
+
+import (
+	"async-agreement-protocol-3/services"
+	"sync"
+	"time"
+)
+
+// Demux splits the results of a cluster by a key, e.g. IVSS results by
+// instance, so tests running concurrent instances can wait on each one
+// separately. Once created it consumes every result of the cluster.
+type Demux[K comparable, TRes any] struct {
+	key   func(TRes) K
+	chans map[K]map[int]chan TRes
+	mu    sync.Mutex
+}
+
+// NewDemux routes every result of c to the channel of its key.
+func NewDemux[K comparable, S services.Service[TMsg, TRes], TMsg any, TRes any](c *Cluster[S, TMsg, TRes], key func(TRes) K) *Demux[K, TRes] {
+	d := &Demux[K, TRes]{
+		key:   key,
+		chans: make(map[K]map[int]chan TRes),
+	}
+	for id := 1; id <= c.N; id++ {
+		go func(id int) {
+			for {
+				select {
+				case res := <-c.Results(id):
+					select {
+					case d.channel(key(res), id) <- res:
+					case <-c.done:
+						return
+					}
+				case <-c.done:
+					return
+				}
+			}
+		}(id)
+	}
+	return d
+}
+
+func (d *Demux[K, TRes]) channel(k K, id int) chan TRes {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.chans[k] == nil {
+		d.chans[k] = make(map[int]chan TRes)
+	}
+	if d.chans[k][id] == nil {
+		d.chans[k][id] = make(chan TRes, resultBuffer)
+	}
+	return d.chans[k][id]
+}
+
+// Results returns the channel receiving the results of node id for key k.
+func (d *Demux[K, TRes]) Results(k K, id int) <-chan TRes {
+	return d.channel(k, id)
+}
+
+// Await is Cluster.Await restricted to the results for key k.
+func (d *Demux[K, TRes]) Await(k K, ids []int, timeout time.Duration, match func(TRes) bool) (map[int]TRes, error) {
+	return await(func(id int) <-chan TRes { return d.channel(k, id) }, ids, timeout, match)
+}
+
+// IVSSInstances demultiplexes the results of an IVSS cluster by instance.
+func IVSSInstances(c *IVSSCluster) *Demux[string, services.IVSSResult] {
+	return NewDemux(c, func(res services.IVSSResult) string { return res.InstanceID })
+}
+
+// SharingComplete matches the IVSS result announcing a completed sharing.
+func SharingComplete(res services.IVSSResult) bool {
+	return res.Type == "SHARING_COMPLETE"
+}
+
+// Reconstructed matches the IVSS result carrying a reconstructed secret.
+func Reconstructed(res services.IVSSResult) bool {
+	return res.Type == "RECONSTRUCTED"
+}
+
+// PrivatelyReconstructed matches the IVSS result carrying a secret
+// reconstructed for this node only, see
+// IVSSService.StartPrivateReconstruction.
+func PrivatelyReconstructed(res services.IVSSResult) bool {
+	return res.Type == "PRIVATELY_RECONSTRUCTED"
+}
+
+// ShareRecovered matches the IVSS result carrying a share recovered from
+// the other nodes, see IVSSService.RecoverShare.
+func ShareRecovered(res services.IVSSResult) bool {
+	return res.Type == "SHARE_RECOVERED"
+}
+
+// Reshared matches the IVSS result carrying a share refreshed by
+// IVSSService.StartResharing.
+func Reshared(res services.IVSSResult) bool {
+	return res.Type == "RESHARED"
+}
+
+// Blamed matches the IVSS result carrying a verified blame of a dealer, see
+// services.IVSSBlame.
+func Blamed(res services.IVSSResult) bool {
+	return res.Type == "BLAME"
+}
+
+// Stalled matches the IVSS result reporting a sharing that made no
+// progress, see services.NodeContext.IVSSWatchdog.
+func Stalled(res services.IVSSResult) bool {
+	return res.Type == "STALLED"
+}
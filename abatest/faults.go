@@ -0,0 +1,163 @@
+package abatest
+
+import (
+	"async-agreement-protocol-3/services"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Step selects the protocol step a fault strikes at, from the state
+// transitions of the node (see services.StateTransition).
+type Step func(tr services.StateTransition) bool
+
+// AtTransition is the step where a service of layer (services.Layer_ABA,
+// ...) takes action, e.g. AtTransition(services.Layer_ABA, "FINISH_ROUND").
+func AtTransition(layer, action string) Step {
+	return func(tr services.StateTransition) bool {
+		return tr.Layer == layer && tr.Action == action
+	}
+}
+
+// FaultInjector crashes nodes of a cluster when they reach chosen protocol
+// steps and optionally restarts them later from their write-ahead log, for
+// systematic crash-stop and crash-recovery experiments:
+//
+//	faults := abatest.NewFaultInjector()
+//	crash := faults.CrashAt(2, abatest.AtTransition(services.Layer_ABA, "FINISH_ROUND")).
+//		RestartAfter(20 * time.Millisecond)
+//	c := abatest.NewABACluster(t, input, abatest.WithFaults(faults))
+//
+// A node finishes processing the message that took it past the step and
+// then processes nothing more until it is restarted.
+type FaultInjector struct {
+	target faultTarget
+	faults []*Fault
+	errs   []error
+	mu     sync.Mutex
+}
+
+// faultTarget is the cluster a FaultInjector is attached to.
+type faultTarget interface {
+	Crash(id int) error
+	Restart(id int) error
+	halt(id int)
+	stopped() <-chan struct{}
+}
+
+// Fault is a crash of one node planned by FaultInjector.CrashAt.
+type Fault struct {
+	node      int
+	step      Step
+	restart   time.Duration
+	restarts  bool
+	fired     bool
+	crashed   chan struct{}
+	restarted chan struct{}
+}
+
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{}
+}
+
+// CrashAt plans a crash of node id the first time it reaches step. Without
+// RestartAfter the node stays down (crash-stop).
+func (fi *FaultInjector) CrashAt(id int, step Step) *Fault {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	f := &Fault{
+		node:      id,
+		step:      step,
+		crashed:   make(chan struct{}),
+		restarted: make(chan struct{}),
+	}
+	fi.faults = append(fi.faults, f)
+	return f
+}
+
+// RestartAfter restarts the node d after the crash, replaying its
+// write-ahead log (crash-recovery). Set it before the cluster starts.
+func (f *Fault) RestartAfter(d time.Duration) *Fault {
+	f.restart = d
+	f.restarts = true
+	return f
+}
+
+// Crashed is closed once the node has crashed.
+func (f *Fault) Crashed() <-chan struct{} {
+	return f.crashed
+}
+
+// Restarted is closed once the node is back, never for a crash-stop.
+func (f *Fault) Restarted() <-chan struct{} {
+	return f.restarted
+}
+
+// Err returns the errors of the crashes and restarts so far, e.g. of a
+// fault planned for a Byzantine node, which cannot crash.
+func (fi *FaultInjector) Err() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return errors.Join(fi.errs...)
+}
+
+// attach binds the injector to the cluster it was passed to.
+func (fi *FaultInjector) attach(target faultTarget) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if fi.target != nil {
+		return errors.New("abatest: a FaultInjector can only drive one cluster")
+	}
+	fi.target = target
+	return nil
+}
+
+// observe is the transition hook of every node. It runs while the service
+// holds its lock, so it only halts the node and leaves the crash to run.
+func (fi *FaultInjector) observe(tr services.StateTransition) {
+	fi.mu.Lock()
+	var fault *Fault
+	for _, f := range fi.faults {
+		if f.node == tr.Node && !f.fired && f.step(tr) {
+			f.fired = true
+			fault = f
+			break
+		}
+	}
+	target := fi.target
+	fi.mu.Unlock()
+	if fault == nil || target == nil {
+		return
+	}
+	target.halt(fault.node)
+	go fi.run(target, fault)
+}
+
+// run crashes the node of f and restarts it when planned.
+func (fi *FaultInjector) run(target faultTarget, f *Fault) {
+	if err := target.Crash(f.node); err != nil {
+		fi.fail(err)
+		return
+	}
+	close(f.crashed)
+	if !f.restarts {
+		return
+	}
+	select {
+	case <-time.After(f.restart):
+	case <-target.stopped():
+		return
+	}
+	if err := target.Restart(f.node); err != nil {
+		fi.fail(err)
+		return
+	}
+	close(f.restarted)
+}
+
+func (fi *FaultInjector) fail(err error) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.errs = append(fi.errs, fmt.Errorf("abatest: fault injection: %w", err))
+}
@@ -0,0 +1,127 @@
+package abatest
+
+import (
+	"async-agreement-protocol-3/services"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// Clusters of the single protocol layers.
+type (
+	ACastCluster = Cluster[*services.AcastService[string], services.ACastMessage[string], string]
+	IVSSCluster  = Cluster[*services.IVSSService, services.IVSSMessage, services.IVSSResult]
+	ICCCluster   = Cluster[*services.ICCService, services.ICCMessage, services.ICCResult]
+	VoteCluster  = Cluster[*services.VoteService, services.VoteMessage, services.VoteResult]
+	ABACluster   = Cluster[*services.ABAService, services.ABAMessage, int]
+	AvidCluster  = Cluster[*services.AvidService, services.AvidMessage, services.AvidResult]
+)
+
+// VoteMVCluster is a cluster of multi-valued Vote nodes.
+type VoteMVCluster[V comparable] = Cluster[*services.VoteServiceMV[V], services.VoteMessage, services.VoteResultMV[V]]
+
+// NewACastCluster starts a cluster of A-Cast nodes broadcasting strings.
+func NewACastCluster(tb testing.TB, opts ...Option) *ACastCluster {
+	tb.Helper()
+	return New(tb, services.NewAcastServiceWithContext[string], services.ClassifyACastMessage[string], opts...)
+}
+
+// NewAvidCluster starts a cluster of erasure-coded broadcast nodes. Start a
+// broadcast with Call and AvidService.Disperse.
+func NewAvidCluster(tb testing.TB, opts ...Option) *AvidCluster {
+	tb.Helper()
+	return New(tb, services.NewAvidServiceWithContext, services.ClassifyAvidMessage, opts...)
+}
+
+// NewIVSSCluster starts a cluster of IVSS nodes. See IVSSInstances to tell
+// the results of concurrent sharings apart.
+func NewIVSSCluster(tb testing.TB, opts ...Option) *IVSSCluster {
+	tb.Helper()
+	return New(tb, services.NewIVSSServiceWithContext, services.ClassifyIVSSMessage, opts...)
+}
+
+// NewICCCluster starts a cluster of ICC nodes for the given round. Start them
+// with StartICC.
+func NewICCCluster(tb testing.TB, round int, opts ...Option) *ICCCluster {
+	tb.Helper()
+	newService := func(nc *services.NodeContext) *services.ICCService {
+		return services.NewICCServiceWithContext(nc, round)
+	}
+	return New(tb, newService, services.ClassifyICCMessage, opts...)
+}
+
+// NewVoteCluster starts a cluster of Vote nodes.
+func NewVoteCluster(tb testing.TB, opts ...Option) *VoteCluster {
+	tb.Helper()
+	return New(tb, services.NewVoteServiceWithContext, services.ClassifyVoteMessage, opts...)
+}
+
+// NewVoteMVCluster starts a cluster of multi-valued Vote nodes.
+func NewVoteMVCluster[V comparable](tb testing.TB, opts ...Option) *VoteMVCluster[V] {
+	tb.Helper()
+	return New(tb, services.NewVoteServiceMV[V], services.ClassifyVoteMessage, opts...)
+}
+
+// NewABACluster starts a cluster of ABA nodes where node id starts with
+// input(id). Start them with StartABA.
+func NewABACluster(tb testing.TB, input func(id int) int, opts ...Option) *ABACluster {
+	tb.Helper()
+	newService := func(nc *services.NodeContext) *services.ABAService {
+		return services.NewABAServiceWithContext(nc, input(nc.ID))
+	}
+	return New(tb, newService, services.ClassifyABAMessage, opts...)
+}
+
+// StartICC starts the coin at every node.
+func StartICC(c *ICCCluster) {
+	for id := 1; id <= c.N; id++ {
+		c.call(id, "start", func(s *services.ICCService, ctx services.ServiceContext[services.ICCMessage, services.ICCResult]) {
+			s.Start(ctx)
+		})
+	}
+}
+
+// PrepareICC runs the sharing phase of the coin at every node, see
+// ICCService.Prepare. StartICC then releases it.
+func PrepareICC(c *ICCCluster) {
+	for id := 1; id <= c.N; id++ {
+		c.call(id, "prepare", func(s *services.ICCService, ctx services.ServiceContext[services.ICCMessage, services.ICCResult]) {
+			s.Prepare(ctx)
+		})
+	}
+}
+
+// StartVote starts round at every node, with node id voting input(id).
+func StartVote(c *VoteCluster, round int, input func(id int) int) {
+	for id := 1; id <= c.N; id++ {
+		vote := input(id)
+		c.call(id, fmt.Sprintf("round-%d", round), func(s *services.VoteService, ctx services.ServiceContext[services.VoteMessage, services.VoteResult]) {
+			s.StartRound(round, vote, ctx)
+		})
+	}
+}
+
+// StartABA starts the agreement at every node.
+func StartABA(c *ABACluster) {
+	for id := 1; id <= c.N; id++ {
+		c.call(id, "start", func(s *services.ABAService, ctx services.ServiceContext[services.ABAMessage, int]) {
+			s.Start(ctx)
+		})
+	}
+}
+
+// StartSharing makes dealer share secret as instance.
+func StartSharing(c *IVSSCluster, dealer int, instanceID string, secret *big.Int) {
+	c.call(dealer, "share-"+instanceID, func(s *services.IVSSService, ctx services.ServiceContext[services.IVSSMessage, services.IVSSResult]) {
+		s.StartSharing(instanceID, secret, ctx)
+	})
+}
+
+// StartReconstruction starts reconstructing instance at every node in ids.
+func StartReconstruction(c *IVSSCluster, ids []int, instanceID string) {
+	for _, id := range ids {
+		c.call(id, "reconstruct-"+instanceID, func(s *services.IVSSService, ctx services.ServiceContext[services.IVSSMessage, services.IVSSResult]) {
+			s.StartReconstruction(instanceID, ctx)
+		})
+	}
+}
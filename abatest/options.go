@@ -0,0 +1,111 @@
+package abatest
+
+import (
+	"async-agreement-protocol-3/services"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Option configures a cluster built by this package.
+type Option func(*config)
+
+type config struct {
+	n         int
+	t         int
+	byzantine map[int]any
+	latency   *services.LatencyProfile
+	seed      int64
+	logLevel  zerolog.Level
+	recovery  bool
+	noLoop    bool
+	faults    *FaultInjector
+	configure []func(*services.NodeContext)
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		n:         4,
+		t:         1,
+		byzantine: make(map[int]any),
+		logLevel:  zerolog.Disabled,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithNodes sets the cluster size n and the number of faults t it tolerates.
+// The default is 4 nodes tolerating 1 fault.
+func WithNodes(n, t int) Option {
+	return func(cfg *config) {
+		cfg.n = n
+		cfg.t = t
+	}
+}
+
+// WithByzantine makes node id run behavior around its service. behavior must
+// be a services.ByzantineBehavior for the message and result types of the
+// cluster, e.g. services.NewABAEquivocator() for an ABA cluster.
+func WithByzantine(id int, behavior any) Option {
+	return func(cfg *config) {
+		cfg.byzantine[id] = behavior
+	}
+}
+
+// WithLatency delays every delivery on the network by d.
+func WithLatency(d time.Duration) Option {
+	return WithLatencyProfile(services.LatencyProfile{Name: "fixed", Base: d}, 0)
+}
+
+// WithLatencyProfile delays every delivery on the network by a sample of
+// profile (e.g. services.LatencyIntercontinental), drawn from seed. Of it
+// and WithLatency, the option given last applies.
+func WithLatencyProfile(profile services.LatencyProfile, seed int64) Option {
+	return func(cfg *config) {
+		cfg.latency = &profile
+		cfg.seed = seed
+	}
+}
+
+// WithLogLevel sets the log level of every node. Logs are disabled by default.
+func WithLogLevel(level zerolog.Level) Option {
+	return func(cfg *config) {
+		cfg.logLevel = level
+	}
+}
+
+// WithoutLoopback sends the messages of every node to itself over the
+// network like any other, so chaos rules and latency apply to them too.
+// By default they go straight into its inbox, see Network.SetLoopback.
+func WithoutLoopback() Option {
+	return func(cfg *config) {
+		cfg.noLoop = true
+	}
+}
+
+// WithRecovery runs every honest node behind a write-ahead log, so tests can
+// stop it with Cluster.Crash and bring it back with Cluster.Restart.
+func WithRecovery() Option {
+	return func(cfg *config) {
+		cfg.recovery = true
+	}
+}
+
+// WithFaults lets faults crash and restart nodes at the steps planned on
+// it. It implies WithRecovery.
+func WithFaults(faults *FaultInjector) Option {
+	return func(cfg *config) {
+		cfg.recovery = true
+		cfg.faults = faults
+	}
+}
+
+// WithNodeContext calls fn on the context of every node before its service
+// is created, e.g. to set a transition hook or a dedup policy.
+func WithNodeContext(fn func(nc *services.NodeContext)) Option {
+	return func(cfg *config) {
+		cfg.configure = append(cfg.configure, fn)
+	}
+}
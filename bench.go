@@ -0,0 +1,160 @@
+package main
+
+import (
+	"async-agreement-protocol-3/services"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// benchReport is the output of `aba bench`, and the baseline it compares to.
+type benchReport struct {
+	GoVersion string
+	Platform  string
+	MaxSteps  int
+	Runs      []services.ScalingRun
+}
+
+var benchLayers = map[string]string{
+	"acast": services.Layer_ACast,
+	"ivss":  services.Layer_IVSS,
+	"aba":   services.Layer_ABA,
+}
+
+// runBench implements `aba bench`.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	sizes := fs.String("n", "4,7,13,25,50,100", "Cluster sizes to run")
+	layers := fs.String("layers", "acast,ivss,aba", "Protocol layers to run")
+	runs := fs.Int("runs", 1, "Runs per layer and size, with seeds 1 to runs")
+	maxSteps := fs.Int("max-steps", 2000000, "Report a run incomplete once this many messages were delivered or are pending")
+	out := fs.String("out", "", "Write the report as JSON to this file")
+	baseline := fs.String("baseline", "", "Compare against this report and fail on regressions")
+	tolerance := fs.Float64("tolerance", 0.25, "Allowed relative growth of messages and allocations over the baseline")
+	timeTolerance := fs.Float64("time-tolerance", 1.0, "Allowed relative growth of run time over the baseline")
+	fs.Parse(args)
+
+	var ns []int
+	for _, s := range strings.Split(*sizes, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 4 {
+			return fmt.Errorf("invalid cluster size %q", s)
+		}
+		ns = append(ns, n)
+	}
+
+	report := benchReport{
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		MaxSteps:  *maxSteps,
+	}
+	// Rows are printed as runs finish, large clusters take minutes
+	const row = "%-6s %4v %3v %5v %7v %10v %14v %11v %9v\n"
+	fmt.Printf(row, "layer", "n", "t", "seed", "rounds", "messages", "time", "allocs", "MB")
+	for _, name := range strings.Split(*layers, ",") {
+		layer, ok := benchLayers[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown layer %q", name)
+		}
+		// Larger clusters only cost more, skip them once one size ran out of budget
+		exhausted := false
+		for _, n := range ns {
+			for seed := int64(1); seed <= int64(*runs) && !exhausted; seed++ {
+				run, err := services.RunScaling(layer, n, seed, *maxSteps)
+				if err != nil {
+					return fmt.Errorf("%s n=%d seed %d: %w", layer, n, seed, err)
+				}
+				report.Runs = append(report.Runs, run)
+
+				messages := strconv.Itoa(run.Messages)
+				if !run.Complete {
+					messages = ">" + messages
+					exhausted = true
+				}
+				fmt.Printf(row, run.Layer, run.N, run.T, run.Seed, run.Rounds, messages, run.Duration.Round(time.Microsecond), run.Allocs, fmt.Sprintf("%.1f", float64(run.Bytes)/(1<<20)))
+			}
+		}
+	}
+
+	if *out != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, append(b, '\n'), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote report to %s\n", *out)
+	}
+
+	if *baseline != "" {
+		b, err := os.ReadFile(*baseline)
+		if err != nil {
+			return err
+		}
+		var base benchReport
+		if err := json.Unmarshal(b, &base); err != nil {
+			return fmt.Errorf("invalid baseline %s: %w", *baseline, err)
+		}
+		regressions := compareBench(base, report, *tolerance, *timeTolerance)
+		for _, r := range regressions {
+			fmt.Println("REGRESSION:", r)
+		}
+		if len(regressions) > 0 {
+			return fmt.Errorf("%d regressions against %s", len(regressions), *baseline)
+		}
+		fmt.Printf("No regressions against %s\n", *baseline)
+	}
+	return nil
+}
+
+// benchMinTimed is the shortest baseline run whose time is compared, shorter
+// ones are dominated by noise.
+const benchMinTimed = 100 * time.Millisecond
+
+type benchKey struct {
+	layer string
+	n     int
+	seed  int64
+}
+
+// compareBench returns the runs of current that cost more than the same run
+// (layer, size and seed) of base, by more than the given relative tolerances.
+// Costs are compared per round, since the number of ABA rounds depends on
+// the coin. Message counts otherwise only depend on the seed, so any growth
+// there is a change in the algorithm; times depend on the machine and get a
+// wider tolerance.
+func compareBench(base, current benchReport, tolerance, timeTolerance float64) []string {
+	baseRuns := make(map[benchKey]services.ScalingRun, len(base.Runs))
+	for _, run := range base.Runs {
+		baseRuns[benchKey{run.Layer, run.N, run.Seed}] = run
+	}
+
+	var regressions []string
+	for _, run := range current.Runs {
+		was, ok := baseRuns[benchKey{run.Layer, run.N, run.Seed}]
+		if !ok || !was.Complete {
+			continue
+		}
+		name := fmt.Sprintf("%s n=%d seed %d", run.Layer, run.N, run.Seed)
+		grew := func(before, after uint64, tol float64) bool {
+			return float64(after)/float64(max(run.Rounds, 1)) > float64(before)/float64(max(was.Rounds, 1))*(1+tol)
+		}
+		switch {
+		case !run.Complete:
+			regressions = append(regressions, fmt.Sprintf("%s no longer completes within %d steps", name, current.MaxSteps))
+		case grew(uint64(was.Messages), uint64(run.Messages), tolerance):
+			regressions = append(regressions, fmt.Sprintf("%s: %d messages in %d rounds, baseline %d in %d", name, run.Messages, run.Rounds, was.Messages, was.Rounds))
+		case grew(was.Allocs, run.Allocs, tolerance):
+			regressions = append(regressions, fmt.Sprintf("%s: %d allocations in %d rounds, baseline %d in %d", name, run.Allocs, run.Rounds, was.Allocs, was.Rounds))
+		case was.Duration >= benchMinTimed && grew(uint64(was.Duration), uint64(run.Duration), timeTolerance):
+			regressions = append(regressions, fmt.Sprintf("%s: took %v in %d rounds, baseline %v in %d", name, run.Duration, run.Rounds, was.Duration, was.Rounds))
+		}
+	}
+	return regressions
+}
@@ -5,14 +5,59 @@ import (
 	"async-agreement-protocol-3/utils"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "vectors" {
+		if err := runVectors(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "node" {
+		if err := runNode(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "stress" {
+		if err := runStress(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	silent := flag.Bool("silent", false, "Disable logs and print only result")
+	loadCert := flag.String("load-cert", "", "Preload certification state of every node from this file")
+	saveCert := flag.String("save-cert", "", "Export certification state of every node to this file after deciding")
+	codecName := flag.String("codec", "", "Serialize messages on the network with this codec (json, proto, cbor)")
+	adversary := flag.String("adversary", "", "Run the t faulty nodes with this behavior (silent, delay, equivocate, bad-dealer, withhold-ready), or several joined by commas")
+	adversaryK := flag.Int("adversary-k", 0, "Messages sent before going silent, or steps each message is delayed")
+	maxFrame := flag.Int("max-frame", 0, "Split encoded messages into frames of at most this many bytes (requires -codec)")
+	compress := flag.String("compress", "none", "Compress encoded messages of at least -compress-threshold bytes (none, snappy, zstd; requires -codec)")
+	compressThreshold := flag.Int("compress-threshold", services.DefaultCompressionThreshold, "Size in bytes from which -compress applies")
+	latency := flag.String("latency", "", "Delay messages like this network does (lan, wan, intercontinental, mobile)")
+	latencySeed := flag.Int64("latency-seed", 1, "Seed of the delays drawn for -latency")
+	topology := flag.String("topology", "", "Connect the nodes like this instead of completely (ring:K, random:P[:SEED])")
+	forward := flag.Bool("forward", false, "Relay messages between nodes without a link over several hops (with -topology)")
+	seed := flag.Int64("seed", 0, "Run deterministically in a simulation with this seed (0 runs the concurrent network)")
 	flag.Parse()
 
 	utils.SetupLogger()
@@ -45,24 +90,125 @@ func main() {
 
 	// Create Network
 	network := services.NewNetwork[services.ABAMessage]()
+	if *codecName != "" {
+		format, err := services.ParseWireFormat(*codecName)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid codec")
+		}
+		compression, err := services.ParseCompression(*compress)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid compression")
+		}
+		codec := services.ABACodec(format)
+		if compression != services.Compression_None {
+			codec = services.NewCompressedCodec(codec, compression, *compressThreshold)
+		}
+		network = services.NewNetworkWithCodec(codec)
+		network.SetMaxFrameSize(*maxFrame)
+	}
+	if *latency != "" {
+		profile, err := services.ParseLatencyProfile(*latency)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid latency profile")
+		}
+		chaos := services.NewChaos(services.ClassifyABAMessage)
+		chaos.Latency(services.MessageFilter{}, profile, *latencySeed)
+		network.SetChaos(chaos)
+		log.Info().Str("layer", "MAIN").Stringer("latency", profile).Msg("Simulating network latency")
+	}
+
+	if *topology != "" {
+		graph, err := services.ParseTopology(*topology, n)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid topology")
+		}
+		graph.Forward = *forward
+		network.SetSenderOf(services.ABASender)
+		network.SetTopology(graph)
+		log.Info().Str("layer", "MAIN").Str("topology", *topology).Bool("forward", *forward).Msg("Simulating a network topology")
+	}
+
+	// Seeded runs draw all randomness from the seed
+	sim := services.SimConfig{Seed: *seed}
+	newContext := func(id int) *services.NodeContext {
+		if *seed != 0 {
+			return sim.NewNodeContext(id, n, t, logLevel)
+		}
+		return services.NewNodeContext(id, n, t, logLevel)
+	}
+	if *seed != 0 && (*codecName != "" || *latency != "" || *topology != "") {
+		log.Warn().Str("layer", "MAIN").Msg("-codec, -latency and -topology have no effect with -seed")
+	}
 
 	// Create Nodes
 	nodes := make([]*Node, honestCount)
 	for i := 0; i < honestCount; i++ {
 		id := i + 1
-		cp := services.NewCertificationProtocol() // Local instance for each node
-		nodes[i] = NewNode(id, n, t, inputs[i], network, cp, logLevel)
+		nodes[i] = NewNodeWithContext(newContext(id), inputs[i], network)
 
 		// Register in Network
 		network.Register(id, nodes[i].Inbox())
 	}
 
+	// Byzantine nodes take the remaining IDs, their decisions are not reported
+	var byzantine []*Node
+	if *adversary != "" {
+		for id := honestCount + 1; id <= n; id++ {
+			behavior, err := newBehavior(*adversary, *adversaryK)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid adversary")
+			}
+			node := NewByzantineNodeWithContext(newContext(id), id%2, network, behavior)
+			network.Register(id, node.Inbox())
+			byzantine = append(byzantine, node)
+		}
+	}
+
+	if *loadCert != "" {
+		if err := loadCertification(*loadCert, nodes); err != nil {
+			log.Fatal().Err(err).Str("path", *loadCert).Msg("Failed to load certification state")
+		}
+	}
+
 	// Start Nodes
-	var wg sync.WaitGroup
-	wg.Add(honestCount)
+	start := time.Now()
+	var res []int
+	if *seed != 0 {
+		var err error
+		if res, err = runSimulation(sim, nodes, byzantine); err != nil {
+			log.Fatal().Err(err).Int64("seed", *seed).Msg("Simulation failed")
+		}
+	} else {
+		res = runNetwork(nodes, byzantine)
+	}
+	if !*silent {
+		log.Info().Dur("elapsed", time.Since(start)).Msg("All honest nodes decided. Simulation finished.")
+	}
+
+	if *saveCert != "" {
+		if err := saveCertification(*saveCert, nodes); err != nil {
+			log.Error().Err(err).Str("path", *saveCert).Msg("Failed to save certification state")
+		}
+	}
 
-	res := make([]int, honestCount)
+	fmt.Print("RESULTS:")
 	for i := 0; i < honestCount; i++ {
+		fmt.Printf(" %d", res[i])
+		if !*silent {
+			log.Info().Int("node_id", nodes[i].ID).Int("result", res[i]).Msg("Node Decided")
+		}
+	}
+	fmt.Println()
+}
+
+// runNetwork starts every node on the network and waits for the decisions
+// of the honest ones.
+func runNetwork(nodes, byzantine []*Node) []int {
+	var wg sync.WaitGroup
+	wg.Add(len(nodes))
+
+	res := make([]int, len(nodes))
+	for i := range nodes {
 		go func(node *Node) {
 			defer wg.Done()
 			node.Start()
@@ -73,18 +219,113 @@ func main() {
 		}(nodes[i])
 	}
 
+	for _, node := range byzantine {
+		node.Start()
+	}
+
 	// Wait for all honest nodes to decide
 	wg.Wait()
-	if !*silent {
-		log.Info().Msg("All honest nodes decided. Simulation finished.")
+	return res
+}
+
+// runSimulation runs every node in a Simulation of cfg, one delivery at a
+// time, until the honest nodes decided. The same seed gives the same run.
+func runSimulation(cfg services.SimConfig, nodes, byzantine []*Node) ([]int, error) {
+	sim := services.NewSimulationWithConfig[services.ABAMessage, int](cfg)
+	all := append(append([]*Node{}, nodes...), byzantine...)
+	for _, node := range all {
+		sim.AddNode(node.ID, node.Service())
+	}
+	for _, node := range all {
+		node.StartIn(sim.Context(node.ID))
 	}
 
-	fmt.Print("RESULTS:")
-	for i := 0; i < honestCount; i++ {
-		fmt.Printf(" %d", res[i])
-		if !*silent {
-			log.Info().Int("node_id", nodes[i].ID).Int("result", res[i]).Msg("Node Decided")
+	decided := func() bool {
+		for _, node := range nodes {
+			if len(sim.Results(node.ID)) == 0 {
+				return false
+			}
 		}
+		return true
+	}
+	if !sim.Run(decided, 0) {
+		return nil, fmt.Errorf("no messages left after %d deliveries, but not every honest node decided", sim.Steps())
+	}
+	res := make([]int, len(nodes))
+	for i, node := range nodes {
+		res[i] = sim.Results(node.ID)[0]
+		log.Info().Int("node_id", node.ID).Int("result", res[i]).Msg("Node Decided")
+	}
+	log.Info().Str("layer", "MAIN").Int("steps", sim.Steps()).Msg("Simulation delivered all messages")
+	return res, nil
+}
+
+// loadCertification merges the exported state of each node into its certification protocol
+func loadCertification(path string, nodes []*Node) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	states, err := services.ImportCertification(f)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if state, ok := states[node.ID]; ok {
+			node.Context.CP.Restore(state)
+		}
+	}
+	log.Info().Str("layer", "MAIN").Int("nodes", len(states)).Msg("Loaded certification state")
+	return nil
+}
+
+// saveCertification exports the certification state of every node
+func saveCertification(path string, nodes []*Node) error {
+	states := make(map[int]services.CertificationState, len(nodes))
+	for _, node := range nodes {
+		states[node.ID] = node.Context.CP.State()
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := services.ExportCertification(f, states); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newBehavior returns the canned Byzantine behavior with the given name, or
+// the combination of a comma-separated list of them
+func newBehavior(name string, k int) (services.ByzantineBehavior[services.ABAMessage, int], error) {
+	if names := strings.Split(name, ","); len(names) > 1 {
+		behaviors := make([]services.ByzantineBehavior[services.ABAMessage, int], len(names))
+		for i, name := range names {
+			behavior, err := newBehavior(strings.TrimSpace(name), k)
+			if err != nil {
+				return nil, err
+			}
+			behaviors[i] = behavior
+		}
+		return services.Combine(behaviors...), nil
+	}
+	switch name {
+	case "silent":
+		return services.NewSilentAfter[services.ABAMessage, int](k), nil
+	case "delay":
+		return services.NewDelayer[services.ABAMessage, int](k), nil
+	case "equivocate":
+		return services.NewABAEquivocator(), nil
+	case "bad-dealer":
+		// Corrupt the shares dealt to the first honest node
+		return services.NewABABadDealer(1), nil
+	case "withhold-ready":
+		return services.NewABAReadyWithholder(), nil
+	default:
+		return nil, fmt.Errorf("unknown adversary %q", name)
 	}
-	fmt.Println()
 }
@@ -9,28 +9,80 @@ import (
 // Node represents a node in the network running the ABA protocol
 type Node struct {
 	ID      int
+	Context *services.NodeContext
 	ABA     *services.ABAService
 	Manager *services.ServiceManager[services.ABAMessage, int]
+
+	adversary *services.AdversarialNode[services.ABAMessage, int] // Set for Byzantine nodes
+}
+
+// NewNode creates a new Node instance.
+// All services of the node share one NodeContext (certification state, metrics).
+func NewNode(id, n, t, initialEstimate int, network services.Transport[services.ABAMessage], logLevel zerolog.Level) *Node {
+	return NewNodeWithContext(services.NewNodeContext(id, n, t, logLevel), initialEstimate, network)
 }
 
-// NewNode creates a new Node instance
-func NewNode(id, n, t, initialEstimate int, network *services.Network[services.ABAMessage], cp *services.CertificationProtocol, logLevel zerolog.Level) *Node {
-	aba := services.NewABAService(id, n, t, initialEstimate, cp, logLevel)
+// NewNodeWithContext creates a node on nc, e.g. one with seeded randomness.
+func NewNodeWithContext(nc *services.NodeContext, initialEstimate int, network services.Transport[services.ABAMessage]) *Node {
+	aba := services.NewABAServiceWithContext(nc, initialEstimate)
 	manager := services.NewServiceManager[services.ABAMessage, int](aba, network)
 
 	return &Node{
-		ID:      id,
+		ID:      nc.ID,
+		Context: nc,
 		ABA:     aba,
 		Manager: manager,
 	}
 }
 
+// NewByzantineNode creates a node that runs ABA with the given behavior.
+func NewByzantineNode(id, n, t, initialEstimate int, network services.Transport[services.ABAMessage], behavior services.ByzantineBehavior[services.ABAMessage, int], logLevel zerolog.Level) *Node {
+	return NewByzantineNodeWithContext(services.NewNodeContext(id, n, t, logLevel), initialEstimate, network, behavior)
+}
+
+// NewByzantineNodeWithContext creates a Byzantine node on nc.
+func NewByzantineNodeWithContext(nc *services.NodeContext, initialEstimate int, network services.Transport[services.ABAMessage], behavior services.ByzantineBehavior[services.ABAMessage, int]) *Node {
+	aba := services.NewABAServiceWithContext(nc, initialEstimate)
+	adversary := services.NewAdversarialNode[services.ABAMessage, int](aba, behavior)
+	manager := services.NewServiceManager[services.ABAMessage, int](adversary, network)
+
+	return &Node{
+		ID:        nc.ID,
+		Context:   nc,
+		ABA:       aba,
+		Manager:   manager,
+		adversary: adversary,
+	}
+}
+
 // Start starts the node's service manager
 func (n *Node) Start() {
 	n.Manager.Start()
+	if n.adversary != nil {
+		n.ABA.Start(n.adversary.WrapContext(n.Manager))
+		return
+	}
 	n.ABA.Start(n.Manager)
 }
 
+// Service returns the service the node runs, behind its Byzantine behavior
+// if it has one.
+func (n *Node) Service() services.Service[services.ABAMessage, int] {
+	if n.adversary != nil {
+		return n.adversary
+	}
+	return n.ABA
+}
+
+// StartIn starts the node's ABA in ctx instead of its service manager, e.g.
+// in a Simulation.
+func (n *Node) StartIn(ctx services.ServiceContext[services.ABAMessage, int]) {
+	if n.adversary != nil {
+		ctx = n.adversary.WrapContext(ctx)
+	}
+	n.ABA.Start(ctx)
+}
+
 // Result returns the channel where the final decision will be sent
 func (n *Node) Result() <-chan int {
 	return n.Manager.Result()
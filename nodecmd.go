@@ -0,0 +1,212 @@
+package main
+
+import (
+	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// runNode runs `aba node`: a single ABA node talking to its peers over TCP,
+// gRPC or, when built with -tags libp2p, libp2p, so a cluster can be spread
+// over processes or machines.
+func runNode(args []string) error {
+	fs := flag.NewFlagSet("node", flag.ExitOnError)
+	id := fs.Int("id", 0, "ID of this node, a key of -peers")
+	peers := fs.String("peers", "", "Comma separated id=host:port of every node, this one included")
+	faults := fs.Int("t", -1, "Number of tolerated faults (default: the most n allows)")
+	input := fs.Int("input", 0, "Input bit of this node")
+	codecName := fs.String("codec", "proto", "Wire format of the messages (json, proto, cbor)")
+	compress := fs.String("compress", "none", "Compress messages of at least -compress-threshold bytes (none, snappy, zstd)")
+	compressThreshold := fs.Int("compress-threshold", services.DefaultCompressionThreshold, "Size in bytes from which -compress applies")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Give up if no decision is reached within this time")
+	linger := fs.Duration("linger", 5*time.Second, "Keep relaying for peers this long after deciding")
+	silent := fs.Bool("silent", false, "Disable logs and print only the result")
+	transport := fs.String("transport", "tcp", "Transport between the nodes (tcp, grpc)")
+	certFile := fs.String("tls-cert", "", "PEM certificate of this node, enables mutual TLS")
+	keyFile := fs.String("tls-key", "", "PEM private key of -tls-cert")
+	caFile := fs.String("tls-ca", "", "PEM CA that signed the certificates of all nodes")
+	tlsPrefix := fs.String("tls-id-prefix", "node-", "Common name of the node certificates before the node ID (tcp only)")
+	rateLimit := fs.Float64("rate-limit", 0, "Read at most this many messages per second from each peer (tcp only, 0 for no limit)")
+	rateBurst := fs.Int("rate-burst", 100, "Messages a peer may send at once under -rate-limit")
+	for _, register := range extraTransportFlags {
+		register(fs)
+	}
+	fs.Parse(args)
+
+	utils.SetupLogger()
+	logLevel := zerolog.InfoLevel
+	if *silent {
+		logLevel = zerolog.Disabled
+		zerolog.SetGlobalLevel(zerolog.Disabled)
+	}
+
+	format, err := services.ParseWireFormat(*codecName)
+	if err != nil {
+		return err
+	}
+	compression, err := services.ParseCompression(*compress)
+	if err != nil {
+		return err
+	}
+	codec := services.ABACodec(format)
+	if compression != services.Compression_None {
+		codec = services.NewCompressedCodec(codec, compression, *compressThreshold)
+	}
+
+	var network nodeTransport
+	var n int
+	addr := ""
+	switch *transport {
+	case "tcp", "grpc":
+		addrs, err := parsePeers(*peers)
+		if err != nil {
+			return err
+		}
+		if _, ok := addrs[*id]; !ok {
+			return fmt.Errorf("node %d is missing from -peers", *id)
+		}
+		n, addr = len(addrs), addrs[*id]
+		if *transport == "grpc" {
+			g := services.NewGRPCNetwork(*id, addrs, codec)
+			if *certFile != "" {
+				cfg, err := loadTLS(*certFile, *keyFile, *caFile)
+				if err != nil {
+					return err
+				}
+				g.SetTLS(cfg)
+			}
+			network = g
+		} else {
+			tcp := services.NewTCPNetwork(*id, addrs, codec)
+			tcp.SetRateLimit(services.RateLimit{Rate: *rateLimit, Burst: *rateBurst})
+			if *certFile != "" {
+				certs, err := services.LoadCertificates(*certFile, *keyFile, *caFile)
+				if err != nil {
+					return err
+				}
+				tcp.SetMutualTLS(certs, services.IdentityFromCommonName(*tlsPrefix))
+				tcp.SetSenderOf(services.ABASender)
+			}
+			network = tcp
+		}
+	default:
+		open, ok := extraTransports[*transport]
+		if !ok {
+			return fmt.Errorf("unknown transport %q (want tcp, grpc%s)", *transport, extraTransportNames())
+		}
+		if network, n, addr, err = open(*id, codec); err != nil {
+			return err
+		}
+	}
+	t := *faults
+	if t < 0 {
+		t = (n - 1) / 3
+	}
+
+	defer network.Close()
+	node := NewNode(*id, n, t, *input, network, logLevel)
+	network.Register(*id, node.Inbox())
+	if err := network.Listen(); err != nil {
+		return err
+	}
+
+	log.Info().Str("layer", "MAIN").Int("node_id", *id).Int("n", n).Int("t", t).Str("addr", addr).Msg("Node listening")
+	start := time.Now()
+	node.Start()
+	defer node.Manager.Stop()
+
+	select {
+	case res := <-node.Result():
+		log.Info().Int("node_id", *id).Int("result", res).Dur("elapsed", time.Since(start)).Msg("Node Decided")
+		fmt.Printf("RESULT: %d\n", res)
+	case <-time.After(*timeout):
+		return fmt.Errorf("no decision within %v", *timeout)
+	}
+	time.Sleep(*linger)
+	return nil
+}
+
+// extraTransports are the transports compiled in with build tags, by name.
+// open returns the transport of node id, the cluster size and the address
+// to log; extraTransportFlags register the flags they read.
+var (
+	extraTransports     = map[string]func(id int, codec services.Codec[services.ABAMessage]) (network nodeTransport, n int, addr string, err error){}
+	extraTransportFlags []func(fs *flag.FlagSet)
+)
+
+func extraTransportNames() string {
+	names := make([]string, 0, len(extraTransports))
+	for name := range extraTransports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out string
+	for _, name := range names {
+		out += ", " + name
+	}
+	return out
+}
+
+// nodeTransport is a Transport a node process listens on and closes.
+type nodeTransport interface {
+	services.Transport[services.ABAMessage]
+	Listen() error
+	Close() error
+}
+
+// loadTLS builds a mutual TLS config from PEM files.
+func loadTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	certs, err := services.LoadCertificates(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certs.Cert},
+		RootCAs:      certs.Pool,
+		ClientCAs:    certs.Pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// parsePeers parses "1=host:port,2=host:port" into a peer table.
+func parsePeers(s string) (map[int]string, error) {
+	addrs := make(map[int]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idStr, addr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid peer %q, expected id=host:port", entry)
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid peer ID %q", idStr)
+		}
+		addrs[id] = addr
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no peers given")
+	}
+	ids := make([]int, 0, len(addrs))
+	for id := range addrs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for i, id := range ids {
+		if id != i+1 {
+			return nil, fmt.Errorf("peer IDs must be 1..%d, missing %d", len(ids), i+1)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,39 @@
+//go:build libp2p
+
+package main
+
+import (
+	"async-agreement-protocol-3/services"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// The libp2p transport of `aba node`, built with -tags libp2p. Nodes need
+// no peer table: they join through -bootstrap and find each other.
+func init() {
+	var size *int
+	var listen, bootstrap, cluster *string
+	extraTransportFlags = append(extraTransportFlags, func(fs *flag.FlagSet) {
+		size = fs.Int("n", 0, "Number of nodes in the cluster (libp2p only)")
+		listen = fs.String("listen", "/ip4/0.0.0.0/tcp/0", "Multiaddr to listen on (libp2p only)")
+		bootstrap = fs.String("bootstrap", "", "Comma separated multiaddrs of nodes already in the cluster (libp2p only)")
+		cluster = fs.String("cluster", "aba", "Name of the cluster, shared by all its nodes (libp2p only)")
+	})
+	extraTransports["libp2p"] = func(id int, codec services.Codec[services.ABAMessage]) (nodeTransport, int, string, error) {
+		if *size < 1 || id < 1 || id > *size {
+			return nil, 0, "", fmt.Errorf("-n must be set and -id within 1..n")
+		}
+		cfg := services.LibP2PConfig{ListenAddrs: []string{*listen}, Cluster: *cluster}
+		for _, addr := range strings.Split(*bootstrap, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				cfg.Bootstrap = append(cfg.Bootstrap, addr)
+			}
+		}
+		network, err := services.NewLibP2PNetwork(id, *size, codec, cfg)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return network, *size, strings.Join(network.Addrs(), ","), nil
+	}
+}
@@ -2,6 +2,9 @@ package services
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/rs/zerolog"
@@ -15,6 +18,7 @@ const (
 	ABA_Vote ABAMsgType = iota
 	ABA_ICC
 	ABA_Complete
+	ABA_Coin // Sent to itself when the NodeContext.Coin of Round landed
 )
 
 // ABAMessage is the wrapper message for ABA
@@ -46,6 +50,17 @@ func ParseCompletePayload(s string) (*CompletePayload, error) {
 	return &p, nil
 }
 
+// Validate checks that the payload is well-formed for a cluster of n nodes.
+func (p *CompletePayload) Validate(n int) error {
+	if !validNodeID(p.Sender, n) {
+		return fmt.Errorf("sender %d out of range", p.Sender)
+	}
+	if !validBit(p.Value) {
+		return fmt.Errorf("value %d is not 0 or 1", p.Value)
+	}
+	return nil
+}
+
 // ABAService implements the Asynchronous Byzantine Agreement protocol
 type ABAService struct {
 	id       int
@@ -54,49 +69,62 @@ type ABAService struct {
 	estimate int
 	round    int
 
+	nc *NodeContext
 	cp *CertificationProtocol
 
 	// Sub-services
 	vote          *VoteService
 	icc           map[int]*ICCService
+	coins         *iccPool // IVSS and A-Cast state of the coins of every round
 	acastComplete *AcastService[string]
 
 	// State for current round
 	voteResult *VoteResult
 	iccResult  *ICCResult
 	// Global State
-	completeCounts       map[int]map[int]bool // value -> set of senders
+	completeCounts       map[int]map[int]bool // value -> A-Cast origins, see checkCompleteOrigin
 	decided              bool
 	decision             int
 	hasBroadcastComplete bool
 
 	// Buffers
 	futureMsgs map[int][]ABAMessage
+	flips      map[int]int // round -> NodeContext.Coin landed, see flipCoin
 
 	mu     sync.Mutex
 	logger zerolog.Logger
 }
 
 func NewABAService(id, n, t, initialEstimate int, cp *CertificationProtocol, logLevel zerolog.Level) *ABAService {
+	return NewABAServiceWithContext(newNodeContextFor(id, n, t, cp, logLevel), initialEstimate)
+}
+
+// NewABAServiceWithContext creates an ABAService whose sub-services (Vote, ICC
+// and the IVSS and A-Cast instances inside them) all share the node's state.
+// The coins of every round run their sharings in one IVSS service, see IVSS.
+func NewABAServiceWithContext(nc *NodeContext, initialEstimate int) *ABAService {
 	logger := log.With().
 		Str("layer", "ABA").
-		Int("node_id", id).
+		Int("node_id", nc.ID).
 		Logger().
-		Level(logLevel)
+		Level(nc.LogLevel)
 
 	s := &ABAService{
-		id:             id,
-		n:              n,
-		t:              t,
+		id:             nc.ID,
+		n:              nc.N,
+		t:              nc.T,
 		estimate:       initialEstimate,
 		round:          0,
-		cp:             cp,
-		vote:           NewVoteService(id, n, t, logLevel),
+		nc:             nc,
+		cp:             nc.CP,
+		vote:           NewVoteServiceWithContext(nc),
 		icc:            make(map[int]*ICCService),
+		coins:          newICCPool(nc),
 		completeCounts: make(map[int]map[int]bool),
 		futureMsgs:     make(map[int][]ABAMessage),
+		flips:          make(map[int]int),
 		logger:         logger,
-		acastComplete:  NewAcastService[string](id, n, t, logLevel),
+		acastComplete:  newValidatingAcast(nc, ParseCompletePayload),
 	}
 
 	return s
@@ -107,7 +135,9 @@ func (s *ABAService) Start(ctx ServiceContext[ABAMessage, int]) {
 	defer s.mu.Unlock()
 
 	s.logger.Info().Int("estimate", s.estimate).Msg("Starting ABA")
+	s.nc.Events.Publish(ProtocolEvent{Node: s.nc.ID, Type: Event_ABAStarted, Value: strconv.Itoa(s.estimate)})
 	s.startRound(1, ctx)
+	s.deliverCoinResults(ctx)
 }
 
 func (s *ABAService) startRound(r int, ctx ServiceContext[ABAMessage, int]) {
@@ -119,15 +149,25 @@ func (s *ABAService) startRound(r int, ctx ServiceContext[ABAMessage, int]) {
 
 	// Initialize sub-services for this round
 	// s.vote is already initialized
-	s.icc[r] = NewICCService(s.id, s.n, s.t, r, s.cp, s.logger.GetLevel())
+	if s.icc[r] == nil && s.nc.Coin == nil {
+		s.icc[r] = s.newCoin(r)
+	}
+	s.nc.Metrics.Inc("aba.rounds_started")
+	s.transition("START_ROUND", s.phase(), map[string]int{"round": r, "estimate": s.estimate})
 
 	// Start Vote
 	voteAdapter := &abaVoteAdapter{aba: s, ctx: ctx, round: r}
 	s.vote.StartRound(r, s.estimate, voteAdapter)
 
-	// Start ICC
-	iccAdapter := &abaICCAdapter{aba: s, ctx: ctx, round: r}
-	s.icc[r].Start(iccAdapter)
+	if s.nc.Coin != nil {
+		s.flipCoin(r, ctx)
+	} else {
+		// Start ICC
+		iccAdapter := &abaICCAdapter{aba: s, ctx: ctx, round: r}
+		s.icc[r].Start(iccAdapter)
+		s.prepareCoins(r, ctx)
+		s.closeCoins(r)
+	}
 
 	// Process buffered messages for this round
 	if msgs, ok := s.futureMsgs[r]; ok {
@@ -142,6 +182,7 @@ func (s *ABAService) startRound(r int, ctx ServiceContext[ABAMessage, int]) {
 func (s *ABAService) OnMessage(msg ABAMessage, ctx ServiceContext[ABAMessage, int]) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	defer s.deliverCoinResults(ctx)
 
 	if msg.Type == ABA_Complete {
 		s.dispatchMessage(msg, ctx)
@@ -161,8 +202,8 @@ func (s *ABAService) OnMessage(msg ABAMessage, ctx ServiceContext[ABAMessage, in
 		return
 	}
 
-	if msg.Round > s.round {
-		// Future message, buffer
+	if msg.Round > s.round && !(msg.Type == ABA_ICC && s.icc[msg.Round] != nil) {
+		// Future message, buffer. Prepared coins take theirs right away
 		s.futureMsgs[msg.Round] = append(s.futureMsgs[msg.Round], msg)
 		return
 	}
@@ -171,6 +212,85 @@ func (s *ABAService) OnMessage(msg ABAMessage, ctx ServiceContext[ABAMessage, in
 	s.dispatchMessage(msg, ctx)
 }
 
+// newCoin creates the coin of round r, which is binary whatever
+// NodeContext.ICC.CoinRange asks for.
+func (s *ABAService) newCoin(r int) *ICCService {
+	config := s.nc.ICC
+	config.CoinRange = 0
+	return newICCService(s.nc, r, config, s.coins)
+}
+
+// IVSS returns the IVSS service the coins of every round share, to inspect
+// their instances.
+func (s *ABAService) IVSS() *IVSSService {
+	return s.coins.ivss
+}
+
+// deliverCoinResults hands the coins the IVSS results the pool kept for
+// them, see iccPool. It runs once the coins are unlocked; results of coins
+// not created yet wait for them.
+func (s *ABAService) deliverCoinResults(ctx ServiceContext[ABAMessage, int]) {
+	// Assumes lock is held
+	for {
+		round, res, ok := s.coins.next(func(r int) bool { return s.icc[r] != nil })
+		if !ok {
+			return
+		}
+		s.icc[round].onIVSSResult(res, &abaICCAdapter{aba: s, ctx: ctx, round: round})
+	}
+}
+
+// closeCoins closes the coins of the rounds before r that are past
+// NodeContext.ABACoinRetention, oldest first, as iccPool.release expects.
+func (s *ABAService) closeCoins(r int) {
+	// Assumes lock is held
+	keep := s.nc.ABACoinRetention
+	if keep <= 0 {
+		return
+	}
+	var old []int
+	for round := range s.icc {
+		if round < r-keep {
+			old = append(old, round)
+		}
+	}
+	sort.Ints(old)
+	for _, round := range old {
+		s.icc[round].Close()
+		delete(s.icc, round)
+		s.nc.Metrics.Inc("aba.coins_closed")
+	}
+}
+
+// prepareCoins prepares the coins of the NodeContext.ABAPipelineDepth
+// rounds after r, so their sharing overlaps the rounds before them, and
+// hands them their buffered messages.
+func (s *ABAService) prepareCoins(r int, ctx ServiceContext[ABAMessage, int]) {
+	// Assumes lock is held
+	for next := r + 1; next <= r+s.nc.ABAPipelineDepth; next++ {
+		if s.icc[next] != nil {
+			continue
+		}
+		s.icc[next] = s.newCoin(next)
+		s.nc.Metrics.Inc("aba.coins_prepared")
+		s.icc[next].Prepare(&abaICCAdapter{aba: s, ctx: ctx, round: next})
+
+		var rest []ABAMessage
+		for _, msg := range s.futureMsgs[next] {
+			if msg.Type == ABA_ICC {
+				s.dispatchMessage(msg, ctx)
+			} else {
+				rest = append(rest, msg)
+			}
+		}
+		if rest != nil {
+			s.futureMsgs[next] = rest
+		} else {
+			delete(s.futureMsgs, next)
+		}
+	}
+}
+
 func (s *ABAService) dispatchMessage(msg ABAMessage, ctx ServiceContext[ABAMessage, int]) {
 	// Assumes lock is held
 	switch msg.Type {
@@ -186,9 +306,16 @@ func (s *ABAService) dispatchMessage(msg ABAMessage, ctx ServiceContext[ABAMessa
 		}
 	case ABA_Complete:
 		if msg.CompleteMsg != nil {
+			if err := checkCompleteOrigin(msg.CompleteMsg); err != nil {
+				s.logger.Warn().Int("from", msg.CompleteMsg.From).Err(err).Msg("Invalid COMPLETE, ignoring")
+				s.nc.Metrics.Inc("aba.foreign_completes")
+				return
+			}
 			adapter := &abaCompleteAdapter{aba: s, ctx: ctx}
 			s.acastComplete.OnMessage(*msg.CompleteMsg, adapter)
 		}
+	case ABA_Coin:
+		s.onCoin(msg.Round, ctx)
 	}
 }
 
@@ -228,18 +355,33 @@ func (s *ABAService) checkRoundProgress(ctx ServiceContext[ABAMessage, int]) {
 			}
 		}
 
+		s.transition("FINISH_ROUND", s.phase(), map[string]int{"round": s.round, "vote": voteVal, "conf": voteConf, "coin": coinVal, "estimate": s.estimate})
+
 		// Move to next round
 		s.startRound(s.round+1, ctx)
 	}
 }
 
+// phase names the abstract state of the node for conformance checking.
+func (s *ABAService) phase() string {
+	if s.decided {
+		return "DECIDED"
+	}
+	return "UNDECIDED"
+}
+
+func (s *ABAService) transition(action, from string, counts map[string]int) {
+	s.nc.Transitions.emit(StateTransition{Node: s.nc.ID, Layer: Layer_ABA, Action: action, From: from, To: s.phase(), Counts: counts})
+}
+
 func (s *ABAService) broadcastComplete(val int, ctx ServiceContext[ABAMessage, int]) {
+	s.transition("SEND_COMPLETE", s.phase(), map[string]int{"value": val})
 	payload := CompletePayload{
 		Sender: s.id,
 		Value:  val,
 	}
 	strVal := payload.String()
-	msg := NewACastMessage(strVal, s.id)
+	msg := newACastMessage(strVal, s.id, s.nc.nonce())
 
 	// Broadcast
 	ctx.Broadcast(ABAMessage{
@@ -252,6 +394,21 @@ func (s *ABAService) broadcastComplete(val int, ctx ServiceContext[ABAMessage, i
 	s.acastComplete.OnMessage(msg, adapter)
 }
 
+// checkCompleteOrigin returns an error if the MSG of a COMPLETE A-Cast
+// carries the payload of a node other than its sender, as checkVoteOrigin
+// does for Vote. The Sender of a delivered COMPLETE is then the node that
+// started its A-Cast, so the t+1 that decide come from t+1 nodes.
+func checkCompleteOrigin(msg *ACastMessage[string]) error {
+	if msg.Type != MSG && msg.Type != SIGNED_MSG {
+		return nil
+	}
+	p, err := ParseCompletePayload(msg.Val)
+	if err != nil || p.Sender == msg.From {
+		return nil
+	}
+	return fmt.Errorf("A-Cast of the COMPLETE of node %d", p.Sender)
+}
+
 func (s *ABAService) handleCompleteDelivery(valStr string, ctx ServiceContext[ABAMessage, int]) {
 	// Assumes lock is held
 	payload, err := ParseCompletePayload(valStr)
@@ -269,9 +426,13 @@ func (s *ABAService) handleCompleteDelivery(valStr string, ctx ServiceContext[AB
 	s.logger.Info().Int("value", payload.Value).Int("count", count).Msg("Received COMPLETE")
 
 	if count >= s.t+1 && !s.decided {
+		from := s.phase()
 		s.decided = true
 		s.decision = payload.Value
+		s.transition("DECIDE", from, map[string]int{"value": s.decision, "complete": count})
 		s.logger.Info().Int("decision", s.decision).Msg("DECIDED")
+		s.nc.Metrics.Inc("aba.decided")
+		s.nc.Events.Publish(ProtocolEvent{Node: s.nc.ID, Type: Event_ABADecided, Value: strconv.Itoa(s.decision)})
 		ctx.SendResult(s.decision)
 
 		// Even if we decide based on receiving enough COMPLETE messages, we must ensure
@@ -291,12 +452,20 @@ type abaVoteAdapter struct {
 	round int
 }
 
-func (a *abaVoteAdapter) Broadcast(msg VoteMessage) {
-	a.ctx.Broadcast(ABAMessage{
+func (a *abaVoteAdapter) wrap(msg VoteMessage) ABAMessage {
+	return ABAMessage{
 		Type:    ABA_Vote,
 		Round:   a.round,
 		VoteMsg: &msg,
-	})
+	}
+}
+
+func (a *abaVoteAdapter) Broadcast(msg VoteMessage) {
+	a.ctx.Broadcast(a.wrap(msg))
+}
+
+func (a *abaVoteAdapter) SendTo(to int, msg VoteMessage) {
+	a.ctx.SendTo(to, a.wrap(msg))
 }
 
 func (a *abaVoteAdapter) SendResult(res VoteResult) {
@@ -313,12 +482,20 @@ type abaICCAdapter struct {
 	round int
 }
 
-func (a *abaICCAdapter) Broadcast(msg ICCMessage) {
-	a.ctx.Broadcast(ABAMessage{
+func (a *abaICCAdapter) wrap(msg ICCMessage) ABAMessage {
+	return ABAMessage{
 		Type:   ABA_ICC,
 		Round:  a.round,
 		ICCMsg: &msg,
-	})
+	}
+}
+
+func (a *abaICCAdapter) Broadcast(msg ICCMessage) {
+	a.ctx.Broadcast(a.wrap(msg))
+}
+
+func (a *abaICCAdapter) SendTo(to int, msg ICCMessage) {
+	a.ctx.SendTo(to, a.wrap(msg))
 }
 
 func (a *abaICCAdapter) SendResult(res ICCResult) {
@@ -334,11 +511,19 @@ type abaCompleteAdapter struct {
 	ctx ServiceContext[ABAMessage, int]
 }
 
-func (a *abaCompleteAdapter) Broadcast(msg ACastMessage[string]) {
-	a.ctx.Broadcast(ABAMessage{
+func (a *abaCompleteAdapter) wrap(msg ACastMessage[string]) ABAMessage {
+	return ABAMessage{
 		Type:        ABA_Complete,
 		CompleteMsg: &msg,
-	})
+	}
+}
+
+func (a *abaCompleteAdapter) Broadcast(msg ACastMessage[string]) {
+	a.ctx.Broadcast(a.wrap(msg))
+}
+
+func (a *abaCompleteAdapter) SendTo(to int, msg ACastMessage[string]) {
+	a.ctx.SendTo(to, a.wrap(msg))
 }
 
 func (a *abaCompleteAdapter) SendResult(res string) {
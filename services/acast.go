@@ -1,9 +1,13 @@
 package services
 
 import (
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -16,6 +20,11 @@ const (
 	MSG MessageType = iota
 	ECHO
 	READY
+	FETCH       // Digest mode: asks for the value of a digest
+	VALUE       // Digest mode: answers a FETCH with the value
+	SIGNED_MSG  // Signed instances: MSG, see NewSignedACastMessage
+	SIGNED_ECHO // Signed instances: ECHO carrying the digest and its signature
+	CERT        // Signed instances: n-t ECHO signatures on a digest
 )
 
 func (m MessageType) String() string {
@@ -26,25 +35,40 @@ func (m MessageType) String() string {
 		return "ECHO"
 	case READY:
 		return "READY"
+	case FETCH:
+		return "FETCH"
+	case VALUE:
+		return "VALUE"
+	case SIGNED_MSG:
+		return "SIGNED_MSG"
+	case SIGNED_ECHO:
+		return "SIGNED_ECHO"
+	case CERT:
+		return "CERT"
 	default:
 		return "UNKNOWN"
 	}
 }
 
 type ACastMessage[T any] struct {
-	Type MessageType
-	UUID string // Unique identifier for the message instance
-	Val  T
-	From int // Immediate sender
+	Type   MessageType
+	UUID   string // Unique identifier for the message instance
+	Val    T
+	From   int              // Immediate sender
+	Digest string           `json:",omitempty"` // Digest mode: ACastDigest of the value, sent instead of it in ECHO, READY and FETCH
+	Tag    string           `json:",omitempty"` // Tagged broadcasts: the instance tag the sender chose, set on the MSG only
+	Sig    []byte           `json:",omitempty"` // Signed instances: signature of a SIGNED_ECHO
+	Cert   ACastCertificate `json:",omitempty"` // Signed instances: the signatures a CERT carries
 }
 
 func NewACastMessage[T any](val T, from int) ACastMessage[T] {
-	// Generate a unique ID based on content, sender and timestamp
-	// This is a simple way to generate a unique ID for the broadcast instance
-	// In a real system, you might want something more robust or provided by the user
-	hashInput := fmt.Sprintf("%v-%d-%d", val, from, time.Now().UnixNano())
-	hash := sha256.Sum256([]byte(hashInput))
-	uuid := hex.EncodeToString(hash[:])
+	// The timestamp nonce keeps repeated broadcasts of the same value apart
+	return newACastMessage(val, from, time.Now().UnixNano())
+}
+
+// newACastMessage creates the MSG of a broadcast with the given nonce.
+func newACastMessage[T any](val T, from int, nonce int64) ACastMessage[T] {
+	uuid := ACastUUID(val, from, nonce)
 
 	return ACastMessage[T]{
 		Type: MSG,
@@ -54,69 +78,604 @@ func NewACastMessage[T any](val T, from int) ACastMessage[T] {
 	}
 }
 
-type ACastInstance[T comparable] struct {
-	receivedEcho  map[T]map[int]bool
-	receivedReady map[T]map[int]bool
+// NewTaggedACastMessage creates the MSG of the broadcast that from
+// identifies as tag. Its UUID depends only on (from, tag), so repeating the
+// call yields the same instance and receivers accept one value per tag.
+func NewTaggedACastMessage[T any](val T, from int, tag string) ACastMessage[T] {
+	return ACastMessage[T]{
+		Type: MSG,
+		UUID: ACastTagUUID(from, tag),
+		Val:  val,
+		From: from,
+		Tag:  tag,
+	}
+}
+
+// acastTagPrefix starts the UUIDs of tagged broadcasts and no others, see
+// ACastTagUUID.
+const acastTagPrefix = "tag-"
+
+// ACastTagUUID derives the identifier of a tagged broadcast as the SHA-256
+// of the canonical encoding of (sender, tag), prefixed with "tag-" so it
+// never names an untagged broadcast.
+func ACastTagUUID(from int, tag string) string {
+	hash, err := CanonicalHash([]any{from, tag})
+	if err != nil {
+		hash = sha256.Sum256([]byte(fmt.Sprintf("%d-%s", from, tag)))
+	}
+	return acastTagPrefix + hex.EncodeToString(hash[:])
+}
+
+// ACastUUID derives the instance identifier as the SHA-256 of the canonical
+// encoding of (value, sender, nonce), so other implementations can derive
+// and verify it byte-for-byte.
+func ACastUUID[T any](val T, from int, nonce int64) string {
+	hash, err := CanonicalHash([]any{val, from, nonce})
+	if err != nil {
+		// Values CBOR cannot represent (e.g. funcs) still get a unique ID
+		hash = sha256.Sum256([]byte(fmt.Sprintf("%v-%d-%d", val, from, nonce)))
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+// ACastDigest is the hex SHA-256 of the canonical encoding of val, which
+// ECHO and READY carry instead of the value in digest mode.
+func ACastDigest[T any](val T) string {
+	hash, err := CanonicalHash(val)
+	if err != nil {
+		hash = sha256.Sum256([]byte(fmt.Sprintf("%v", val)))
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+// DedupPolicy configures how A-Cast counts ECHO and READY messages that carry
+// the same sender ID, e.g. from twins sharing one identity.
+type DedupPolicy int
+
+const (
+	Dedup_PerValue   DedupPolicy = iota // Count each sender once per value (default)
+	Dedup_FirstValue                    // Count each sender only for its first value
+	Dedup_Off                           // Count every copy, only to show in tests why deduplication is needed
+)
+
+// ACastEquivocation is a sender that sent two values in one step of an
+// A-Cast instance. In digest mode First and Second are the digests of the
+// values for ECHO and READY.
+type ACastEquivocation struct {
+	Node     int // Node that observed it
+	Instance string
+	Sender   int
+	Step     MessageType
+	First    any
+	Second   any
+}
+
+func (e ACastEquivocation) String() string {
+	return fmt.Sprintf("node %d saw %d send %v %v and %v in A-Cast %s", e.Node, e.Sender, e.Step, e.First, e.Second, e.Instance)
+}
+
+// EquivocationHook receives every equivocation an A-Cast service detects,
+// synchronously and while the service holds its lock, so it must not call
+// back into the services. Set NodeContext.Equivocations before creating them.
+type EquivocationHook func(ACastEquivocation)
+
+func (h EquivocationHook) emit(e ACastEquivocation) {
+	if h != nil {
+		h(e)
+	}
+}
+
+// ACastRetention bounds the instances an AcastService keeps. The zero value
+// keeps every instance forever. A dropped instance leaves only its UUID
+// behind, so late messages for it are ignored instead of starting it over.
+// Only delivered instances are dropped: an undelivered one may still be the
+// broadcast of a correct node, so MaxPendingPerSender bounds those instead.
+type ACastRetention struct {
+	// Delivered instances are dropped this long after delivery, 0 keeps them
+	TTL time.Duration
+	// Beyond this many instances the oldest delivered one is dropped; 0 for
+	// no limit
+	MaxInstances int
+	// How many undelivered instances the messages of one node may start. An
+	// instance counts against the node that started it until it delivers or
+	// t+1 nodes sent messages for it, one of them correct. Messages that
+	// would start more are ignored; 0 for no limit
+	MaxPendingPerSender int
+	// How many UUIDs of dropped instances are kept, the oldest forgotten
+	// first; 0 keeps MaxInstances of them, or all without MaxInstances
+	MaxPruned int
+}
+
+// ACastInstance is the state of one broadcast. ECHOs and READYs are counted
+// per value, or per digest in digest mode.
+type ACastInstance[T any] struct {
+	receivedEcho  map[any]map[int]bool
+	receivedReady map[any]map[int]bool
+	firstValue    map[MessageType]map[int]any // step -> sender -> first value
+	copies        map[MessageType]map[any]int // Dedup_Off: step -> value -> copies
 	sentEcho      bool
 	sentReady     bool
 	delivered     bool
+	deliveredAt   time.Time
+	createdAt     time.Time
+	lastMessage   time.Time
+	sentCount     map[MessageType]int // Messages we sent, by type
+	receivedCount map[MessageType]int // Messages we received, by type
+
+	// MaxPendingPerSender only, see AcastService.open
+	opener  int          // Node the instance counts against, 0 for none
+	senders map[int]bool // Nodes that sent messages for it while it counts
+
+	// Digest mode only
+	value   T              // Value of the first MSG, or the delivered one
+	digest  string         // ACastDigest of value, empty while there is none
+	pending string         // Digest with 2t+1 READYs but no value yet
+	wanted  map[int]string // Digests nodes FETCHed before we had them
+	served  map[int]bool   // Nodes we sent a VALUE already
+
+	// Signed instances only, value and digest are kept as above
+	signatures map[string]ACastCertificate // Digest -> valid ECHO signatures
+	sentCert   bool                        // Relayed a CERT without the value
+
+	// Retransmission only
+	sent           []ACastMessage[T] // Messages to repeat while undelivered
+	final          *ACastMessage[T]  // Our READY or CERT, the answer to late senders
+	answered       map[int]time.Time // When each late sender was last answered
+	heard          map[int]bool      // Other nodes that sent messages for the instance
+	retransmitting bool              // A re-broadcast is scheduled
 }
 
-func NewACastInstance[T comparable]() *ACastInstance[T] {
+func NewACastInstance[T any]() *ACastInstance[T] {
 	return &ACastInstance[T]{
-		receivedEcho:  make(map[T]map[int]bool),
-		receivedReady: make(map[T]map[int]bool),
+		receivedEcho:  make(map[any]map[int]bool),
+		receivedReady: make(map[any]map[int]bool),
+		createdAt:     time.Now(),
+		sentCount:     make(map[MessageType]int),
+		receivedCount: make(map[MessageType]int),
 	}
 }
 
-type AcastService[T comparable] struct {
-	id        int
-	n         int
-	t         int
-	instances map[string]*ACastInstance[T]
-	logger    zerolog.Logger
+// phase names the abstract state of the instance for conformance checking.
+func (inst *ACastInstance[T]) phase() string {
+	switch {
+	case inst.delivered:
+		return "DELIVERED"
+	case inst.sentReady:
+		return "READY_SENT"
+	case inst.sentEcho:
+		return "ECHOED"
+	default:
+		return "INIT"
+	}
+}
+
+type AcastService[T any] struct {
+	id            int
+	n             int
+	t             int
+	cp            *CertificationProtocol // Optional, used to ignore certified-faulty senders
+	metrics       *Metrics               // Optional
+	events        *EventBus              // Optional
+	hook          TransitionHook         // Optional
+	equivocations EquivocationHook       // Optional
+	dedup         DedupPolicy
+	thresholds    ACastThresholds    // See NodeContext.ACastThresholds
+	digests       bool               // ECHO and READY carry digests, see NodeContext.ACastDigests
+	digestFn      func(T) [32]byte   // Optional, see NewAcastServiceWithDigest
+	validate      func(val T) bool   // Optional, see SetValidator
+	signingKey    ed25519.PrivateKey // Optional, signs the ECHOs of signed instances
+	keyring       *Keyring           // Optional, verifies the ECHOs of signed instances
+	instances     map[string]*ACastInstance[T]
+	logger        zerolog.Logger
+	stats         ACastMetrics
+
+	retention  ACastRetention
+	retransmit ACastRetransmit
+	deliveries []string        // UUIDs in the order their instances delivered
+	pruned     map[string]bool // UUIDs of dropped instances
+	pruneOrder []string        // UUIDs of pruned in the order they were dropped
+	pending    map[int]int     // Node -> undelivered instances counting against it
+
+	// Guards the instances, so adapters may call OnMessage from several
+	// goroutines
+	mu sync.Mutex
 }
 
 func NewAcastService[T comparable](id, n, t int, logLevel zerolog.Level) *AcastService[T] {
+	return NewAcastServiceWithCertification[T](id, n, t, nil, logLevel)
+}
+
+// NewAcastServiceWithCertification creates an AcastService that ignores messages
+// from processes the CertificationProtocol has certified as faulty.
+func NewAcastServiceWithCertification[T comparable](id, n, t int, cp *CertificationProtocol, logLevel zerolog.Level) *AcastService[T] {
+	return NewAcastServiceWithContext[T](newNodeContextFor(id, n, t, cp, logLevel))
+}
+
+// NewAcastServiceWithContext creates an AcastService using the shared state of a node.
+func NewAcastServiceWithContext[T comparable](nc *NodeContext) *AcastService[T] {
+	return newAcastService[T](nc)
+}
+
+// NewAcastServiceWithDigest creates an AcastService for values that are not
+// comparable, e.g. structured payloads such as IVSSPayload. Values are
+// told apart by digest instead of ==, both when counting ECHOs and READYs
+// and in digest mode, so digest must be collision resistant and agree
+// across nodes.
+func NewAcastServiceWithDigest[T any](nc *NodeContext, digest func(T) [32]byte) *AcastService[T] {
+	a := newAcastService[T](nc)
+	a.digestFn = digest
+	return a
+}
+
+func newAcastService[T any](nc *NodeContext) *AcastService[T] {
 	logger := log.With().
 		Str("layer", "ACAST").
-		Int("node_id", id).
+		Int("node_id", nc.ID).
 		Logger().
-		Level(logLevel)
+		Level(nc.LogLevel)
+
+	thresholds := nc.ACastThresholds
+	if thresholds == nil {
+		thresholds = ByzantineThresholds{}
+	}
+	if err := thresholds.Validate(nc.N, nc.T); err != nil {
+		logger.Error().Err(err).Int("n", nc.N).Int("t", nc.T).Msg("Unsafe A-Cast thresholds")
+	}
 
 	return &AcastService[T]{
-		id:        id,
-		n:         n,
-		t:         t,
-		instances: make(map[string]*ACastInstance[T]),
-		logger:    logger,
+		id:            nc.ID,
+		n:             nc.N,
+		t:             nc.T,
+		cp:            nc.CP,
+		metrics:       nc.Metrics,
+		events:        nc.Events,
+		hook:          nc.Transitions,
+		equivocations: nc.Equivocations,
+		signingKey:    nc.SigningKey,
+		keyring:       nc.Keyring,
+		dedup:         nc.Dedup,
+		digests:       nc.ACastDigests,
+		thresholds:    thresholds,
+		instances:     make(map[string]*ACastInstance[T]),
+		logger:        logger,
+		retention:     nc.ACastRetention,
+		retransmit:    nc.ACastRetransmit,
+		pruned:        make(map[string]bool),
+		pending:       make(map[int]int),
+		stats:         newACastMetrics(),
 	}
 }
 
-func (a *AcastService[T]) getInstance(uuid string) *ACastInstance[T] {
-	if _, ok := a.instances[uuid]; !ok {
-		a.instances[uuid] = NewACastInstance[T]()
+// readyAmplifies reports whether the READYs for key make us join with our
+// own READY. The usual t+1 guarantees one correct sender; since messages
+// from certified-faulty processes are never counted, only t-f of the
+// remaining senders can be faulty and t-f+1 READYs give the same
+// guarantee, so the threshold drops by f. Only READYs of senders not
+// certified faulty count towards the lower threshold, as some may have
+// arrived before their sender was certified. The ECHO and delivery
+// thresholds must hold across nodes with different certification knowledge
+// and therefore stay unchanged.
+func (a *AcastService[T]) readyAmplifies(inst *ACastInstance[T], key any, count int) bool {
+	threshold := a.thresholds.Ready(a.n, a.t)
+	if count >= threshold {
+		return true
+	}
+	faulty := a.cp.CertifiedFaulty(a.id)
+	if len(faulty) == 0 || a.dedup == Dedup_Off {
+		return false
+	}
+	live := 0
+	for from := range inst.receivedReady[key] {
+		if !slices.Contains(faulty, from) {
+			live++
+		}
 	}
-	return a.instances[uuid]
+	return live >= max(threshold-min(len(faulty), a.t), 1)
 }
 
-func (a *AcastService[T]) OnMessage(msg ACastMessage[T], ctx ServiceContext[ACastMessage[T], T]) {
-	inst := a.getInstance(msg.UUID)
+// open returns the instance msg belongs to, starting it unless its sender
+// already started ACastRetention.MaxPendingPerSender undelivered ones.
+func (a *AcastService[T]) open(msg ACastMessage[T]) (*ACastInstance[T], bool) {
+	if inst, ok := a.instances[msg.UUID]; ok {
+		a.join(inst, msg.From)
+		return inst, true
+	}
+	max := a.retention.MaxPendingPerSender
+	charge := max > 0 && msg.From != a.id
+	if charge && a.pending[msg.From] >= max {
+		a.logger.Debug().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Sender has too many pending instances, ignoring")
+		return nil, false
+	}
+	inst := NewACastInstance[T]()
+	a.instances[msg.UUID] = inst
+	a.countStarted()
+	if charge {
+		inst.opener, inst.senders = msg.From, map[int]bool{msg.From: true}
+		a.pending[msg.From]++
+	}
+	return inst, true
+}
 
-	// inst.mu.Lock()
-	// defer inst.mu.Unlock()
+// join records that from sent a message for inst, which stops counting
+// against the node that started it once t+1 nodes did.
+func (a *AcastService[T]) join(inst *ACastInstance[T], from int) {
+	if inst.opener == 0 {
+		return
+	}
+	if inst.senders[from] = true; len(inst.senders) > a.t {
+		a.settle(inst)
+	}
+}
 
-	if inst.delivered {
+// settle stops counting inst against the node that started it.
+func (a *AcastService[T]) settle(inst *ACastInstance[T]) {
+	if inst.opener == 0 {
+		return
+	}
+	if a.pending[inst.opener]--; a.pending[inst.opener] <= 0 {
+		delete(a.pending, inst.opener)
+	}
+	inst.opener, inst.senders = 0, nil
+}
+
+// SetValidator makes the service refuse to ECHO values validate rejects, so
+// a malformed value never gathers the n-t ECHOs it needs to be delivered.
+// validate must give the same answer on every correct node.
+func (a *AcastService[T]) SetValidator(validate func(val T) bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.validate = validate
+}
+
+// Instances returns how many instances the service keeps.
+func (a *AcastService[T]) Instances() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.instances)
+}
+
+// Prune drops the instance uuid. Later messages for it are ignored.
+func (a *AcastService[T]) Prune(uuid string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(uuid)
+}
+
+func (a *AcastService[T]) prune(uuid string) {
+	if inst, ok := a.instances[uuid]; ok {
+		a.settle(inst)
+		delete(a.instances, uuid)
+	}
+	limit := a.retention.MaxPruned
+	if limit == 0 {
+		limit = a.retention.MaxInstances
+	}
+	if a.pruned[uuid] {
+		return
+	}
+	a.pruned[uuid] = true
+	if limit == 0 {
+		return
+	}
+	a.pruneOrder = append(a.pruneOrder, uuid)
+	for len(a.pruned) > limit && len(a.pruneOrder) > 0 {
+		delete(a.pruned, a.pruneOrder[0])
+		a.pruneOrder = a.pruneOrder[1:]
+	}
+}
+
+// release drops every instance without remembering it, for a service that
+// is done for good. Pending retransmissions stop with the instances.
+func (a *AcastService[T]) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.instances = make(map[string]*ACastInstance[T])
+	a.pruned = make(map[string]bool)
+	a.pending = make(map[int]int)
+	a.deliveries, a.pruneOrder = nil, nil
+}
+
+// releaseWhere drops the instances whose UUID drop reports without
+// remembering them, for a service whose owners are done at different
+// times. The retention queues skip them once they are gone.
+func (a *AcastService[T]) releaseWhere(drop func(uuid string) bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for uuid, inst := range a.instances {
+		if drop(uuid) {
+			a.settle(inst)
+			delete(a.instances, uuid)
+		}
+	}
+	for uuid := range a.pruned {
+		if drop(uuid) {
+			delete(a.pruned, uuid)
+		}
+	}
+	a.pruneOrder = slices.DeleteFunc(a.pruneOrder, drop)
+}
+
+// collect drops the instances that are past the retention limits.
+func (a *AcastService[T]) collect() {
+	if ttl := a.retention.TTL; ttl > 0 {
+		now := time.Now()
+		for len(a.deliveries) > 0 {
+			inst, ok := a.instances[a.deliveries[0]]
+			ok = ok && inst.delivered
+			if ok && now.Sub(inst.deliveredAt) < ttl {
+				break
+			}
+			if ok {
+				a.prune(a.deliveries[0])
+			}
+			a.deliveries = a.deliveries[1:]
+		}
+	}
+	// Delivered instances only absorb late messages, undelivered ones stay
+	for max := a.retention.MaxInstances; max > 0 && len(a.instances) > max; {
+		uuid, ok := a.oldestDelivered()
+		if !ok {
+			break
+		}
+		a.prune(uuid)
+	}
+}
+
+// oldestDelivered pops the first UUID of the deliveries that still has a
+// delivered instance.
+func (a *AcastService[T]) oldestDelivered() (string, bool) {
+	for len(a.deliveries) > 0 {
+		uuid := a.deliveries[0]
+		a.deliveries = a.deliveries[1:]
+		if inst, ok := a.instances[uuid]; ok && inst.delivered {
+			return uuid, true
+		}
+	}
+	return "", false
+}
+
+// count records that from sent val (a value, or a digest in digest mode)
+// in step (ECHO or READY) and returns how many senders support val so far,
+// as defined by the dedup policy. It returns false if the message is
+// ignored.
+func (a *AcastService[T]) count(uuid string, inst *ACastInstance[T], step MessageType, val any, from int) (int, bool) {
+	received := inst.receivedEcho
+	if step == READY {
+		received = inst.receivedReady
+	}
+
+	if a.equivocates(uuid, inst, step, val, from) && a.dedup == Dedup_FirstValue {
+		return 0, false
+	}
+
+	switch a.dedup {
+	case Dedup_Off:
+		if inst.copies == nil {
+			inst.copies = make(map[MessageType]map[any]int)
+		}
+		if inst.copies[step] == nil {
+			inst.copies[step] = make(map[any]int)
+		}
+		inst.copies[step][val]++
+		return inst.copies[step][val], true
+	}
+
+	if _, ok := received[val]; !ok {
+		received[val] = make(map[int]bool)
+	}
+	received[val][from] = true
+	return len(received[val]), true
+}
+
+// equivocates records the first val from sends in step and reports whether
+// val conflicts with it. A conflict is passed to the EquivocationHook and
+// makes from a suspect.
+func (a *AcastService[T]) equivocates(uuid string, inst *ACastInstance[T], step MessageType, val any, from int) bool {
+	if inst.firstValue == nil {
+		inst.firstValue = make(map[MessageType]map[int]any)
+	}
+	if inst.firstValue[step] == nil {
+		inst.firstValue[step] = make(map[int]any)
+	}
+	first, ok := inst.firstValue[step][from]
+	if !ok {
+		inst.firstValue[step][from] = val
+		return false
+	}
+	if first == val {
+		return false
+	}
+
+	a.logger.Warn().Str("uuid", uuid).Int("from", from).Msgf("Conflicting %v values from one sender", step)
+	a.metrics.Inc("acast.equivocations")
+	if a.cp != nil {
+		a.cp.AddSuspect(from, fmt.Sprintf("conflicting %v in A-Cast %s", step, uuid))
+	}
+	a.equivocations.emit(ACastEquivocation{Node: a.id, Instance: uuid, Sender: from, Step: step, First: first, Second: val})
+	return true
+}
+
+func (a *AcastService[T]) transition(uuid string, inst *ACastInstance[T], action, from string, counts map[string]int) {
+	a.hook.emit(StateTransition{Node: a.id, Layer: Layer_ACast, Instance: uuid, Action: action, From: from, To: inst.phase(), Counts: counts})
+}
+
+// support builds our ECHO or READY for val, carrying only its digest in
+// digest mode.
+func (a *AcastService[T]) support(step MessageType, uuid string, val T, digest string) ACastMessage[T] {
+	if a.digests {
+		return ACastMessage[T]{Type: step, UUID: uuid, Digest: digest, From: a.id}
+	}
+	return ACastMessage[T]{Type: step, UUID: uuid, Val: val, From: a.id}
+}
+
+// key is what ECHOs and READYs are counted by.
+func (a *AcastService[T]) key(msg ACastMessage[T]) any {
+	if a.digests {
+		return msg.Digest
+	}
+	return a.valueKey(msg.Val)
+}
+
+// valueKey is what values are compared by: their digest when the service
+// has a digest function, as they may not be comparable.
+func (a *AcastService[T]) valueKey(val T) any {
+	if a.digestFn != nil {
+		return a.digestOf(val)
+	}
+	return val
+}
+
+// digestOf is the hex digest of val, by the digest function of the
+// service if it has one.
+func (a *AcastService[T]) digestOf(val T) string {
+	if a.digestFn != nil {
+		hash := a.digestFn(val)
+		return hex.EncodeToString(hash[:])
+	}
+	return ACastDigest(val)
+}
+
+func (a *AcastService[T]) OnMessage(msg ACastMessage[T], ctx ServiceContext[ACastMessage[T], T]) {
+	// The parent may react to a delivery by starting a broadcast on this
+	// service, so deliveries are passed on after the lock is released
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cp.IsCertifiedFaulty(a.id, msg.From) {
+		a.logger.Debug().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Ignoring message from certified-faulty process")
 		return
 	}
 
-	// Helper to add to set
-	addToSet := func(m map[T]map[int]bool, val T, from int) int {
-		if _, ok := m[val]; !ok {
-			m[val] = make(map[int]bool)
+	if a.pruned[msg.UUID] {
+		return
+	}
+	inst, ok := a.open(msg)
+	if !ok {
+		return
+	}
+	inst.lastMessage = time.Now()
+	a.countReceived(msg, inst)
+	ctx = &acastCounter[T]{ServiceContext: ctx, a: a, inst: inst}
+	a.collect()
+	if a.retransmit.enabled() {
+		ctx = a.track(msg, inst, ctx)
+		defer a.scheduleRetransmit(msg.UUID, inst, results)
+	}
+
+	// Nodes that delivered still hand out the value
+	if msg.Type == FETCH {
+		if a.digests && msg.From != a.id {
+			a.onFetch(msg, inst, ctx)
 		}
-		m[val][from] = true
-		return len(m[val])
+		return
+	}
+
+	if inst.delivered {
+		a.answerLate(msg, inst, ctx)
+		return
 	}
 
 	switch msg.Type {
@@ -129,21 +688,42 @@ func (a *AcastService[T]) OnMessage(msg ACastMessage[T], ctx ServiceContext[ACas
 		// For MSG type, we assume it's the initial broadcast.
 		// The UUID uniquely identifies this broadcast instance.
 
-		if !inst.sentEcho {
-			inst.sentEcho = true
-			// Unlock before broadcast to avoid holding lock during network op
-			// But we need to be careful. Here we use defer Unlock, so we hold it.
-			// Since Broadcast is async (goroutine in Network), it's fine.
+		if !a.admit(msg, inst) {
+			return
+		}
+
+		var digest string
+		if a.digests {
+			digest = a.digestOf(msg.Val)
+			a.keepValue(msg.UUID, inst, msg.Val, digest, ctx)
+		}
 
-			a.logger.Debug().Msgf("Received MSG from %d, broadcasting ECHO", msg.From)
-			ctx.Broadcast(ACastMessage[T]{
-				Type: ECHO,
-				UUID: msg.UUID,
-				Val:  msg.Val,
-				From: a.id,
-			})
+		from := inst.phase()
+		inst.sentEcho = true
+		a.transition(msg.UUID, inst, "SEND_ECHO", from, nil)
+		// Unlock before broadcast to avoid holding lock during network op
+		// But we need to be careful. Here we use defer Unlock, so we hold it.
+		// Since Broadcast is async (goroutine in Network), it's fine.
+
+		a.logger.Debug().Msgf("Received MSG from %d, broadcasting ECHO", msg.From)
+		ctx.Broadcast(a.support(ECHO, msg.UUID, msg.Val, digest))
+
+		// Enough READYs may have arrived before the value
+		if a.digests && inst.pending == digest {
+			a.deliver(msg.UUID, inst, msg.Val, len(inst.receivedReady[digest]), ctx)
 		}
 
+	case SIGNED_MSG:
+		if a.admit(msg, inst) {
+			a.onSignedMsg(msg, inst, ctx)
+		}
+
+	case SIGNED_ECHO:
+		a.onSignedEcho(msg, inst, ctx)
+
+	case CERT:
+		a.onCert(msg, inst, ctx)
+
 	case ECHO:
 		// On Receive ECHO(val) from process 'j':
 		// Add 'j' to received_echo[val]
@@ -151,19 +731,20 @@ func (a *AcastService[T]) OnMessage(msg ACastMessage[T], ctx ServiceContext[ACas
 		//     Send READY(val) to all processes
 		//     sent_ready = True
 
-		count := addToSet(inst.receivedEcho, msg.Val, msg.From)
-		threshold := a.n - a.t
+		count, ok := a.count(msg.UUID, inst, ECHO, a.key(msg), msg.From)
+		if !ok {
+			return
+		}
+		threshold := a.thresholds.Echo(a.n, a.t)
+		a.transition(msg.UUID, inst, "RECV_ECHO", inst.phase(), map[string]int{"echo": count})
 
 		if count >= threshold && !inst.sentReady {
+			from := inst.phase()
 			inst.sentReady = true
+			a.transition(msg.UUID, inst, "SEND_READY", from, map[string]int{"echo": count})
 
 			a.logger.Debug().Str("uuid", msg.UUID).Msgf("Threshold ECHO reached (%d), broadcasting READY", count)
-			ctx.Broadcast(ACastMessage[T]{
-				Type: READY,
-				UUID: msg.UUID,
-				Val:  msg.Val,
-				From: a.id,
-			})
+			ctx.Broadcast(a.support(READY, msg.UUID, msg.Val, msg.Digest))
 		}
 
 	case READY:
@@ -177,31 +758,137 @@ func (a *AcastService[T]) OnMessage(msg ACastMessage[T], ctx ServiceContext[ACas
 		//     delivered = True
 		//     Trigger event "A-Cast Complete" returns val
 
-		count := addToSet(inst.receivedReady, msg.Val, msg.From)
+		count, ok := a.count(msg.UUID, inst, READY, a.key(msg), msg.From)
+		if !ok {
+			return
+		}
 		a.logger.Debug().Str("uuid", msg.UUID).Int("count", count).Int("from", msg.From).Msg("Received READY vote")
+		a.transition(msg.UUID, inst, "RECV_READY", inst.phase(), map[string]int{"ready": count})
 
 		// Early trigger
-		if count >= a.t+1 && !inst.sentReady {
+		if !inst.sentReady && a.readyAmplifies(inst, a.key(msg), count) {
+			from := inst.phase()
 			inst.sentReady = true
+			a.transition(msg.UUID, inst, "SEND_READY", from, map[string]int{"ready": count})
 			a.logger.Debug().Str("uuid", msg.UUID).Msgf("Threshold READY (early) reached (%d), broadcasting READY", count)
 
-			ctx.Broadcast(ACastMessage[T]{
-				Type: READY,
-				UUID: msg.UUID,
-				Val:  msg.Val,
-				From: a.id,
-			})
+			ctx.Broadcast(a.support(READY, msg.UUID, msg.Val, msg.Digest))
 		}
 
 		// Delivery condition
-		if count >= 2*a.t+1 && !inst.delivered {
-			inst.delivered = true
-			// Optimization: Clear maps to save memory
-			inst.receivedEcho = nil
-			inst.receivedReady = nil
+		if count >= a.thresholds.Deliver(a.n, a.t) {
+			switch {
+			case !a.digests:
+				a.deliver(msg.UUID, inst, msg.Val, count, ctx)
+			case inst.digest != "" && inst.digest == msg.Digest:
+				a.deliver(msg.UUID, inst, inst.value, count, ctx)
+			case inst.pending == "":
+				// At least t+1 correct nodes echoed the digest and hold
+				// the value, ask everyone for it
+				inst.pending = msg.Digest
+				a.logger.Debug().Str("uuid", msg.UUID).Msg("Delivery threshold reached without the value, sending FETCH")
+				ctx.Broadcast(ACastMessage[T]{Type: FETCH, UUID: msg.UUID, Digest: msg.Digest, From: a.id})
+			}
+		}
 
-			a.logger.Info().Msgf("A-Cast Complete: Delivered value %v", msg.Val)
-			ctx.SendResult(msg.Val)
+	case VALUE:
+		if !a.digests || inst.pending == "" || a.digestOf(msg.Val) != inst.pending {
+			return
 		}
+		a.logger.Debug().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Received the value of the delivered digest")
+		a.deliver(msg.UUID, inst, msg.Val, len(inst.receivedReady[inst.pending]), ctx)
+	}
+}
+
+// admit reports whether a MSG or SIGNED_MSG is to be echoed: it is the
+// first the sender sent for the instance and its value is valid.
+func (a *AcastService[T]) admit(msg ACastMessage[T], inst *ACastInstance[T]) bool {
+	// A MSG without a tag could otherwise open the tagged instance of
+	// another sender and keep its real MSG from being echoed
+	if (msg.Tag != "" || strings.HasPrefix(msg.UUID, acastTagPrefix)) && !a.validTag(msg) {
+		return false
+	}
+	// Only the first MSG of a sender is echoed, later ones can only be
+	// equivocation
+	if a.equivocates(msg.UUID, inst, MSG, a.valueKey(msg.Val), msg.From) || inst.sentEcho {
+		return false
+	}
+	if a.validate != nil && !a.validate(msg.Val) {
+		a.logger.Warn().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Invalid value, not echoing")
+		return false
+	}
+	return true
+}
+
+// validTag checks that a MSG of a tagged instance comes from the sender
+// its UUID names.
+func (a *AcastService[T]) validTag(msg ACastMessage[T]) bool {
+	if msg.UUID != ACastTagUUID(msg.From, msg.Tag) {
+		a.logger.Warn().Str("uuid", msg.UUID).Int("from", msg.From).Str("tag", msg.Tag).Msg("Tagged MSG does not match its UUID, ignoring")
+		return false
+	}
+	return true
+}
+
+// deliver outputs val, supported by count READYs.
+func (a *AcastService[T]) deliver(uuid string, inst *ACastInstance[T], val T, count int, ctx ServiceContext[ACastMessage[T], T]) {
+	from := inst.phase()
+	inst.delivered = true
+	inst.deliveredAt = time.Now()
+	a.countDelivered(inst)
+	a.settle(inst)
+	if a.retention.TTL > 0 || a.retention.MaxInstances > 0 {
+		a.deliveries = append(a.deliveries, uuid)
+	}
+	a.transition(uuid, inst, "DELIVER", from, map[string]int{"ready": count})
+	// Optimization: Clear maps to save memory
+	inst.receivedEcho = nil
+	inst.receivedReady = nil
+	inst.firstValue = nil
+	inst.copies = nil
+	if a.digests {
+		a.keepValue(uuid, inst, val, a.digestOf(val), ctx)
+		inst.pending = ""
+	}
+
+	a.logger.Info().Msgf("A-Cast Complete: Delivered value %v", val)
+	a.events.Publish(ProtocolEvent{Node: a.id, Type: Event_ACastDelivered, Instance: uuid, Value: fmt.Sprint(val)})
+	ctx.SendResult(val)
+}
+
+// keepValue stores the value of the instance in digest mode and sends it to
+// the nodes that already asked for it.
+func (a *AcastService[T]) keepValue(uuid string, inst *ACastInstance[T], val T, digest string, ctx ServiceContext[ACastMessage[T], T]) {
+	inst.value = val
+	inst.digest = digest
+	for to, wanted := range inst.wanted {
+		if wanted == digest {
+			delete(inst.wanted, to)
+			a.sendValue(uuid, inst, to, ctx)
+		}
+	}
+}
+
+// onFetch answers a FETCH with the value, or remembers it until the value
+// arrives. Every node gets at most one VALUE per instance.
+func (a *AcastService[T]) onFetch(msg ACastMessage[T], inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) {
+	if inst.served[msg.From] {
+		return
+	}
+	if inst.digest != "" && inst.digest == msg.Digest {
+		a.sendValue(msg.UUID, inst, msg.From, ctx)
+		return
+	}
+	if inst.wanted == nil {
+		inst.wanted = make(map[int]string)
+	}
+	inst.wanted[msg.From] = msg.Digest
+}
+
+func (a *AcastService[T]) sendValue(uuid string, inst *ACastInstance[T], to int, ctx ServiceContext[ACastMessage[T], T]) {
+	if inst.served == nil {
+		inst.served = make(map[int]bool)
 	}
+	inst.served[to] = true
+	ctx.SendTo(to, ACastMessage[T]{Type: VALUE, UUID: uuid, Val: inst.value, Digest: inst.digest, From: a.id})
 }
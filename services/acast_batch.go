@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ACastBatch is the value of an A-Cast instance that carries several
+// payloads of a layer at once. They are delivered together and handed to
+// the layer one by one.
+type ACastBatch struct {
+	Batch []string
+}
+
+func (b ACastBatch) String() string {
+	data, _ := json.Marshal(b)
+	return string(data)
+}
+
+// ParseACastBatch parses a batch. It returns false for values that are not
+// batches, e.g. single payloads.
+func ParseACastBatch(s string) (*ACastBatch, bool) {
+	var b ACastBatch
+	if err := json.Unmarshal([]byte(s), &b); err != nil || len(b.Batch) == 0 {
+		return nil, false
+	}
+	return &b, true
+}
+
+// batchValidator extends an A-Cast validator of single payloads to batches
+// of the payloads batchable accepts. Batches do not nest.
+func batchValidator(valid, batchable func(string) bool) func(string) bool {
+	return func(val string) bool {
+		b, ok := ParseACastBatch(val)
+		if !ok {
+			return valid(val)
+		}
+		for _, item := range b.Batch {
+			if _, nested := ParseACastBatch(item); nested || !valid(item) || !batchable(item) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// acastBatcher combines the A-Casts a node starts within a window into one
+// instance. The first message of a window arms a timer; when it fires, the
+// messages collected so far are sent as one batch, or as they are if there
+// is only one.
+type acastBatcher struct {
+	id      int
+	window  time.Duration
+	nonce   func() int64
+	metrics *Metrics // Optional
+
+	mu      sync.Mutex
+	pending []ACastMessage[string]
+}
+
+func newACastBatcher(nc *NodeContext) *acastBatcher {
+	if nc.ACastBatchWindow <= 0 {
+		return nil
+	}
+	return &acastBatcher{id: nc.ID, window: nc.ACastBatchWindow, nonce: nc.nonce, metrics: nc.Metrics}
+}
+
+// add queues the MSG msg. send starts the A-Cast of the batch it ends up
+// in, from the timer goroutine.
+func (b *acastBatcher) add(msg ACastMessage[string], send func(ACastMessage[string])) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) == 0 {
+		time.AfterFunc(b.window, func() { b.flush(send) })
+	}
+	b.pending = append(b.pending, msg)
+}
+
+func (b *acastBatcher) flush(send func(ACastMessage[string])) {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(pending) == 1 {
+		send(pending[0])
+		return
+	}
+	batch := ACastBatch{Batch: make([]string, len(pending))}
+	for i, msg := range pending {
+		batch.Batch[i] = msg.Val
+	}
+	b.metrics.Inc("acast.batches")
+	b.metrics.Add("acast.batched_payloads", int64(len(pending)))
+	send(newACastMessage(batch.String(), b.id, b.nonce()))
+}
@@ -0,0 +1,76 @@
+package services
+
+import "maps"
+
+// ACastMetrics is a snapshot of what one AcastService did: the messages it
+// sent and received per type, the instances it created and delivered, and
+// how long delivery took from the first message of an instance. The same
+// numbers are added to the node's Metrics as acast.sent.<TYPE>,
+// acast.received.<TYPE>, acast.instances.started, acast.instances.delivered
+// and the acast.delivery_latency histogram, which add up all A-Cast services
+// of the node.
+type ACastMetrics struct {
+	Sent      map[MessageType]int64
+	Received  map[MessageType]int64
+	Started   int64
+	Delivered int64
+	Latency   Histogram
+}
+
+func newACastMetrics() ACastMetrics {
+	return ACastMetrics{Sent: make(map[MessageType]int64), Received: make(map[MessageType]int64)}
+}
+
+// Metrics returns a snapshot of the metrics of the service. Messages are
+// counted once per Broadcast or SendTo, not per recipient.
+func (a *AcastService[T]) Metrics() ACastMetrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.stats
+	s.Sent = maps.Clone(s.Sent)
+	s.Received = maps.Clone(s.Received)
+	s.Latency = s.Latency.clone()
+	return s
+}
+
+func (a *AcastService[T]) countReceived(msg ACastMessage[T], inst *ACastInstance[T]) {
+	a.stats.Received[msg.Type]++
+	inst.receivedCount[msg.Type]++
+	a.metrics.Inc("acast.received." + msg.Type.String())
+}
+
+func (a *AcastService[T]) countSent(msg ACastMessage[T], inst *ACastInstance[T]) {
+	a.stats.Sent[msg.Type]++
+	inst.sentCount[msg.Type]++
+	a.metrics.Inc("acast.sent." + msg.Type.String())
+}
+
+func (a *AcastService[T]) countStarted() {
+	a.stats.Started++
+	a.metrics.Inc("acast.instances.started")
+}
+
+func (a *AcastService[T]) countDelivered(inst *ACastInstance[T]) {
+	latency := inst.deliveredAt.Sub(inst.createdAt)
+	a.stats.Delivered++
+	a.stats.Latency.Observe(latency)
+	a.metrics.Inc("acast.instances.delivered")
+	a.metrics.Observe("acast.delivery_latency", latency)
+}
+
+// acastCounter counts the messages the service sends for an instance.
+type acastCounter[T any] struct {
+	ServiceContext[ACastMessage[T], T]
+	a    *AcastService[T]
+	inst *ACastInstance[T]
+}
+
+func (c *acastCounter[T]) Broadcast(msg ACastMessage[T]) {
+	c.a.countSent(msg, c.inst)
+	c.ServiceContext.Broadcast(msg)
+}
+
+func (c *acastCounter[T]) SendTo(to int, msg ACastMessage[T]) {
+	c.a.countSent(msg, c.inst)
+	c.ServiceContext.SendTo(to, msg)
+}
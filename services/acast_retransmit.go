@@ -0,0 +1,132 @@
+package services
+
+import (
+	"slices"
+	"time"
+)
+
+// ACastRetransmit configures the re-broadcast of A-Cast messages over
+// transports that may drop them. The zero value disables it, as Bracha's
+// broadcast assumes reliable links.
+//
+// While an instance is undelivered, the node repeats every message it
+// broadcast for it: the MSG if it is the origin, its ECHO and its READY
+// (SIGNED_ECHO and CERT in signed instances). The first repetition follows
+// Initial after the first message, and the delay doubles up to Max. Once
+// delivered, the node answers every message for the instance with its
+// READY or CERT, sent to the sender alone at most once per Initial, and
+// keeps repeating it until it heard from all other nodes: a node that lost
+// everything has nothing to repeat itself. A crashed node is never heard
+// from, so instances should also be bounded by ACastRetention. Timers run
+// on the wall clock, so leave it disabled in simulations.
+type ACastRetransmit struct {
+	Initial time.Duration // Delay of the first re-broadcast, 0 disables retransmission
+	Max     time.Duration // Bound of the delay, 0 for no bound
+}
+
+func (r ACastRetransmit) enabled() bool {
+	return r.Initial > 0
+}
+
+// next returns the delay following delay.
+func (r ACastRetransmit) next(delay time.Duration) time.Duration {
+	delay *= 2
+	if r.Max > 0 && delay > r.Max {
+		return r.Max
+	}
+	return delay
+}
+
+// acastRecorder keeps the messages the service broadcasts for an instance,
+// so they can be repeated.
+type acastRecorder[T any] struct {
+	ServiceContext[ACastMessage[T], T]
+	inst *ACastInstance[T]
+}
+
+func (r *acastRecorder[T]) Broadcast(msg ACastMessage[T]) {
+	r.inst.sent = append(r.inst.sent, msg)
+	if msg.Type == READY || msg.Type == CERT {
+		r.inst.final = &msg
+	}
+	r.ServiceContext.Broadcast(msg)
+}
+
+// track returns ctx wrapped to record the broadcasts for inst. It also
+// records msg itself if it is our own first MSG, and its sender.
+func (a *AcastService[T]) track(msg ACastMessage[T], inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) ServiceContext[ACastMessage[T], T] {
+	if msg.From == a.id {
+		if (msg.Type == MSG || msg.Type == SIGNED_MSG) && !inst.sentEcho {
+			inst.sent = append(inst.sent, msg)
+		}
+	} else {
+		if inst.heard == nil {
+			inst.heard = make(map[int]bool)
+		}
+		inst.heard[msg.From] = true
+	}
+	return &acastRecorder[T]{ServiceContext: ctx, inst: inst}
+}
+
+// settled reports whether inst needs no more repetitions: it is delivered
+// and every other node sent messages for it, so those that have not
+// delivered keep repeating theirs and get our READY or CERT in reply.
+func (a *AcastService[T]) settled(inst *ACastInstance[T]) bool {
+	return inst.delivered && len(inst.heard) >= a.n-1
+}
+
+// scheduleRetransmit starts repeating the messages of inst once it has any.
+func (a *AcastService[T]) scheduleRetransmit(uuid string, inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) {
+	if inst.retransmitting || len(inst.sent) == 0 || a.settled(inst) {
+		return
+	}
+	inst.retransmitting = true
+	delay := a.retransmit.Initial
+	time.AfterFunc(delay, func() { a.retransmitAfter(uuid, delay, ctx) })
+}
+
+// retransmitAfter repeats the messages of instance uuid, delay after the
+// previous time, and schedules the next repetition. Once the instance is
+// delivered, only the READY or CERT is repeated.
+func (a *AcastService[T]) retransmitAfter(uuid string, delay time.Duration, ctx ServiceContext[ACastMessage[T], T]) {
+	a.mu.Lock()
+	inst, ok := a.instances[uuid]
+	if !ok || a.settled(inst) {
+		if ok {
+			inst.retransmitting = false
+		}
+		a.mu.Unlock()
+		return
+	}
+	sent := slices.Clone(inst.sent)
+	if inst.delivered && inst.final != nil {
+		sent = []ACastMessage[T]{*inst.final}
+	}
+	next := a.retransmit.next(delay)
+	time.AfterFunc(next, func() { a.retransmitAfter(uuid, next, ctx) })
+	a.mu.Unlock()
+
+	a.logger.Debug().Str("uuid", uuid).Int("messages", len(sent)).Dur("next", next).Msg("Instance not settled, retransmitting")
+	a.metrics.Add("acast.retransmissions", int64(len(sent)))
+	for _, msg := range sent {
+		ctx.Broadcast(msg)
+	}
+}
+
+// answerLate sends our READY or CERT to a node still sending messages for
+// an instance we delivered, in case it lost the messages that would let it
+// deliver too.
+func (a *AcastService[T]) answerLate(msg ACastMessage[T], inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) {
+	if !a.retransmit.enabled() || inst.final == nil || msg.From == a.id {
+		return
+	}
+	now := time.Now()
+	if last, ok := inst.answered[msg.From]; ok && now.Sub(last) < a.retransmit.Initial {
+		return
+	}
+	if inst.answered == nil {
+		inst.answered = make(map[int]time.Time)
+	}
+	inst.answered[msg.From] = now
+	ctx.SendTo(msg.From, *inst.final)
+}
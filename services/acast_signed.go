@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"maps"
+)
+
+// Signed A-Cast instances follow the signed echo broadcast for deployments
+// with a PKI (NodeContext.SigningKey and Keyring). Every node signs the
+// digest of the first value it receives and broadcasts the signature in its
+// SIGNED_ECHO. n-t signatures on one digest (the ECHO threshold of
+// ACastThresholds) form a certificate: two certificates share at least
+// n-2t > t signers, one of them correct, so there is at most one certified
+// digest and a node can deliver as soon as it holds a certificate and the
+// value. That takes two message delays
+// instead of the three of MSG, ECHO and READY. A node that delivers
+// broadcasts the certificate with the value in a CERT, so every correct
+// node delivers even if the sender only reached some of them.
+
+// signedEchoDomain separates ECHO signatures from anything else the node
+// keys might sign.
+const signedEchoDomain = "aba-acast-echo-v1"
+
+// ACastCertificate maps signers to their signatures on the ECHO of one
+// digest.
+type ACastCertificate map[int][]byte
+
+// NewSignedACastMessage creates the MSG of a signed broadcast. Any MSG
+// becomes one by setting its Type to SIGNED_MSG, e.g. a tagged one.
+func NewSignedACastMessage[T any](val T, from int) ACastMessage[T] {
+	msg := NewACastMessage(val, from)
+	msg.Type = SIGNED_MSG
+	return msg
+}
+
+// ACastEchoBytes returns the bytes a node signs to ECHO digest in instance
+// uuid: the canonical encoding of (domain, uuid, digest).
+func ACastEchoBytes(uuid, digest string) []byte {
+	b, _ := CanonicalBytes([]any{signedEchoDomain, uuid, digest})
+	return b
+}
+
+// SignACastEcho returns the signature of key on the ECHO of digest in
+// instance uuid.
+func SignACastEcho(key ed25519.PrivateKey, uuid, digest string) []byte {
+	return ed25519.Sign(key, ACastEchoBytes(uuid, digest))
+}
+
+// verifyEcho checks that sig is the signature of node from on the ECHO of
+// digest in instance uuid.
+func (a *AcastService[T]) verifyEcho(uuid, digest string, from int, sig []byte) bool {
+	if a.keyring == nil {
+		return false
+	}
+	key := a.keyring.PublicKey(from)
+	return key != nil && ed25519.Verify(key, ACastEchoBytes(uuid, digest), sig)
+}
+
+func (a *AcastService[T]) onSignedMsg(msg ACastMessage[T], inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) {
+	if a.signingKey == nil {
+		a.logger.Warn().Str("uuid", msg.UUID).Msg("Signed instance without a signing key, ignoring")
+		return
+	}
+	inst.value = msg.Val
+	inst.digest = a.digestOf(msg.Val)
+
+	from := inst.phase()
+	inst.sentEcho = true
+	a.transition(msg.UUID, inst, "SEND_ECHO", from, nil)
+	ctx.Broadcast(ACastMessage[T]{Type: SIGNED_ECHO, UUID: msg.UUID, Digest: inst.digest, From: a.id, Sig: SignACastEcho(a.signingKey, msg.UUID, inst.digest)})
+
+	// Enough signatures may have arrived before the value
+	a.certified(msg.UUID, inst, ctx)
+}
+
+func (a *AcastService[T]) onSignedEcho(msg ACastMessage[T], inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) {
+	if !a.verifyEcho(msg.UUID, msg.Digest, msg.From, msg.Sig) {
+		a.logger.Warn().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Invalid ECHO signature, ignoring")
+		return
+	}
+	if a.equivocates(msg.UUID, inst, SIGNED_ECHO, msg.Digest, msg.From) {
+		return
+	}
+	sigs := a.signatures(inst, msg.Digest)
+	sigs[msg.From] = msg.Sig
+	a.transition(msg.UUID, inst, "RECV_ECHO", inst.phase(), map[string]int{"signatures": len(sigs)})
+	a.certified(msg.UUID, inst, ctx)
+}
+
+func (a *AcastService[T]) onCert(msg ACastMessage[T], inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) {
+	verified := a.verifiedSignatures(msg.UUID, msg.Digest, msg.Cert)
+	if len(verified) < a.thresholds.Echo(a.n, a.t) {
+		a.logger.Warn().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Invalid certificate, ignoring")
+		return
+	}
+	// A forged signature next to n-t valid ones must not replace a valid
+	// one we hold, nor count or be relayed in our certificate
+	sigs := a.signatures(inst, msg.Digest)
+	maps.Copy(sigs, verified)
+	a.transition(msg.UUID, inst, "RECV_CERT", inst.phase(), map[string]int{"signatures": len(sigs)})
+
+	// The value is bound to the certificate by its digest, whoever sends it
+	if inst.digest != msg.Digest && a.digestOf(msg.Val) == msg.Digest {
+		inst.value = msg.Val
+		inst.digest = msg.Digest
+	}
+	a.certified(msg.UUID, inst, ctx)
+}
+
+// signatures returns the ECHO signatures collected for digest.
+func (a *AcastService[T]) signatures(inst *ACastInstance[T], digest string) ACastCertificate {
+	if inst.signatures == nil {
+		inst.signatures = make(map[string]ACastCertificate)
+	}
+	if inst.signatures[digest] == nil {
+		inst.signatures[digest] = make(ACastCertificate)
+	}
+	return inst.signatures[digest]
+}
+
+// verifiedSignatures returns the signatures of cert on the ECHO of digest
+// that check out.
+func (a *AcastService[T]) verifiedSignatures(uuid, digest string, cert ACastCertificate) ACastCertificate {
+	verified := make(ACastCertificate, len(cert))
+	for signer, sig := range cert {
+		if a.verifyEcho(uuid, digest, signer, sig) {
+			verified[signer] = sig
+		}
+	}
+	return verified
+}
+
+// certified delivers the instance once it holds a certificate and its
+// value. With a certificate but no value, it relays the certificate once,
+// so the nodes that have the value deliver and send it back.
+func (a *AcastService[T]) certified(uuid string, inst *ACastInstance[T], ctx ServiceContext[ACastMessage[T], T]) {
+	for digest, sigs := range inst.signatures {
+		if len(sigs) < a.thresholds.Echo(a.n, a.t) {
+			continue
+		}
+		if inst.digest != digest {
+			if !inst.sentCert {
+				inst.sentCert = true
+				a.logger.Debug().Str("uuid", uuid).Msg("Certificate without the value, relaying it")
+				ctx.Broadcast(ACastMessage[T]{Type: CERT, UUID: uuid, Digest: digest, From: a.id, Cert: maps.Clone(sigs)})
+			}
+			return
+		}
+
+		cert := ACastMessage[T]{Type: CERT, UUID: uuid, Val: inst.value, Digest: digest, From: a.id, Cert: sigs}
+		inst.signatures = nil
+		a.deliver(uuid, inst, inst.value, len(sigs), ctx)
+		ctx.Broadcast(cert)
+		return
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ACastInstanceState is a snapshot of one A-Cast instance, for debugging and
+// for watchdogs that look for stuck instances. Counts are keyed by the
+// value (its digest in digest mode and signed instances) and count distinct
+// senders. A delivered instance no longer keeps them, so its counts are
+// empty.
+type ACastInstanceState struct {
+	UUID       string
+	Phase      string // INIT, ECHOED, READY_SENT or DELIVERED
+	SentEcho   bool
+	SentReady  bool
+	Delivered  bool
+	Echoes     map[string]int `json:",omitempty"`
+	Readies    map[string]int `json:",omitempty"`
+	Signatures map[string]int `json:",omitempty"` // Signed instances only
+	Sent       map[string]int `json:",omitempty"` // Messages sent, by type
+	Received   map[string]int `json:",omitempty"` // Messages received, by type
+
+	Created     time.Time
+	LastMessage time.Time // When the instance last received a message
+	DeliveredAt time.Time `json:",omitempty"`
+}
+
+// state takes a snapshot of inst.
+func (inst *ACastInstance[T]) state(uuid string) ACastInstanceState {
+	st := ACastInstanceState{
+		UUID:        uuid,
+		Phase:       inst.phase(),
+		SentEcho:    inst.sentEcho,
+		SentReady:   inst.sentReady,
+		Delivered:   inst.delivered,
+		Echoes:      senderCounts(inst.receivedEcho),
+		Readies:     senderCounts(inst.receivedReady),
+		Created:     inst.createdAt,
+		LastMessage: inst.lastMessage,
+		DeliveredAt: inst.deliveredAt,
+		Sent:        typeCounts(inst.sentCount),
+		Received:    typeCounts(inst.receivedCount),
+	}
+	if len(inst.signatures) > 0 {
+		st.Signatures = make(map[string]int, len(inst.signatures))
+		for digest, sigs := range inst.signatures {
+			st.Signatures[digest] = len(sigs)
+		}
+	}
+	return st
+}
+
+// Latency returns how long the instance took to deliver since its first
+// message, 0 while it is undelivered.
+func (st ACastInstanceState) Latency() time.Duration {
+	if !st.Delivered {
+		return 0
+	}
+	return st.DeliveredAt.Sub(st.Created)
+}
+
+func senderCounts(received map[any]map[int]bool) map[string]int {
+	if len(received) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(received))
+	for val, senders := range received {
+		counts[fmt.Sprint(val)] = len(senders)
+	}
+	return counts
+}
+
+func typeCounts(counts map[MessageType]int) map[string]int {
+	if len(counts) == 0 {
+		return nil
+	}
+	byName := make(map[string]int, len(counts))
+	for typ, n := range counts {
+		byName[typ.String()] = n
+	}
+	return byName
+}
+
+// InstanceState returns a snapshot of instance uuid, or false if the
+// service keeps no such instance.
+func (a *AcastService[T]) InstanceState(uuid string) (ACastInstanceState, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	inst, ok := a.instances[uuid]
+	if !ok {
+		return ACastInstanceState{}, false
+	}
+	return inst.state(uuid), true
+}
+
+// InstanceStates returns a snapshot of every instance, sorted by UUID.
+func (a *AcastService[T]) InstanceStates() []ACastInstanceState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	states := make([]ACastInstanceState, 0, len(a.instances))
+	for uuid, inst := range a.instances {
+		states = append(states, inst.state(uuid))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].UUID < states[j].UUID })
+	return states
+}
+
+// Stuck returns the undelivered instances that received no message for at
+// least idle, sorted by UUID. A correct broadcast keeps the instance busy
+// until it delivers, so these are the ones a watchdog should report.
+func (a *AcastService[T]) Stuck(idle time.Duration) []ACastInstanceState {
+	now := time.Now()
+	var stuck []ACastInstanceState
+	for _, st := range a.InstanceStates() {
+		if !st.Delivered && now.Sub(st.LastMessage) >= idle {
+			stuck = append(stuck, st)
+		}
+	}
+	return stuck
+}
@@ -0,0 +1,90 @@
+package services
+
+import "fmt"
+
+// ACastThresholds decides how many ECHOs and READYs an A-Cast instance
+// waits for among n nodes of which t may fail. Set it with
+// NodeContext.ACastThresholds; the default is ByzantineThresholds.
+type ACastThresholds interface {
+	// Echo is the number of ECHOs for a value after which a node sends its
+	// READY, and the size of a certificate in signed instances
+	Echo(n, t int) int
+	// Ready is the number of READYs for a value after which a node joins
+	// with its own READY
+	Ready(n, t int) int
+	// Deliver is the number of READYs for a value after which a node
+	// delivers it
+	Deliver(n, t int) int
+	// Validate reports why the thresholds are not safe or not live with n
+	// nodes of which t may fail, or nil
+	Validate(n, t int) error
+}
+
+// ByzantineThresholds are Bracha's thresholds: n-t ECHOs, t+1 READYs to
+// join and 2t+1 to deliver. They tolerate t Byzantine nodes when n > 3t.
+type ByzantineThresholds struct{}
+
+func (ByzantineThresholds) Echo(n, t int) int    { return n - t }
+func (ByzantineThresholds) Ready(n, t int) int   { return t + 1 }
+func (ByzantineThresholds) Deliver(n, t int) int { return 2*t + 1 }
+
+func (th ByzantineThresholds) Validate(n, t int) error {
+	return checkACastThresholds(th, n, t, true)
+}
+
+// CrashThresholds are enough when nodes can only crash: a node that sends
+// anything sends the same value to everyone, so a single ECHO or READY can
+// be trusted. A node sends its READY on the first ECHO or READY and
+// delivers on t+1 READYs, one of them from a node that does not crash and
+// whose READY therefore reaches everyone. They need n > 2t.
+type CrashThresholds struct{}
+
+func (CrashThresholds) Echo(n, t int) int    { return 1 }
+func (CrashThresholds) Ready(n, t int) int   { return 1 }
+func (CrashThresholds) Deliver(n, t int) int { return t + 1 }
+
+func (th CrashThresholds) Validate(n, t int) error {
+	return checkACastThresholds(th, n, t, false)
+}
+
+// FixedThresholds are explicit thresholds, e.g. stricter ones than the
+// adversary model needs. They are validated against Byzantine nodes unless
+// CrashOnly is set.
+type FixedThresholds struct {
+	EchoAt    int
+	ReadyAt   int
+	DeliverAt int
+	CrashOnly bool
+}
+
+func (th FixedThresholds) Echo(n, t int) int    { return th.EchoAt }
+func (th FixedThresholds) Ready(n, t int) int   { return th.ReadyAt }
+func (th FixedThresholds) Deliver(n, t int) int { return th.DeliverAt }
+
+func (th FixedThresholds) Validate(n, t int) error {
+	return checkACastThresholds(th, n, t, !th.CrashOnly)
+}
+
+// checkACastThresholds checks thresholds against t faulty nodes among n,
+// Byzantine or crashing ones.
+func checkACastThresholds(th ACastThresholds, n, t int, byzantine bool) error {
+	echo, ready, deliver := th.Echo(n, t), th.Ready(n, t), th.Deliver(n, t)
+	switch {
+	case echo < 1 || ready < 1 || deliver < 1:
+		return fmt.Errorf("thresholds must be positive, got echo %d, ready %d, deliver %d", echo, ready, deliver)
+	case echo > n-t || deliver > n-t:
+		// The t faulty nodes may stay silent
+		return fmt.Errorf("echo %d and deliver %d must not exceed the %d correct nodes", echo, deliver, n-t)
+	case deliver < ready+t:
+		// READYs of a delivering node must make every correct node join
+		return fmt.Errorf("deliver %d must be at least ready %d plus t = %d", deliver, ready, t)
+	case byzantine && 2*echo-n <= t:
+		// Two ECHO quorums must share a correct node, or two values can
+		// both gather READYs
+		return fmt.Errorf("echo %d lets two ECHO quorums of %d nodes share only faulty ones (t = %d)", echo, n, t)
+	case byzantine && ready <= t:
+		// Faulty nodes alone must not make a correct node send READY
+		return fmt.Errorf("ready %d must exceed t = %d", ready, t)
+	}
+	return nil
+}
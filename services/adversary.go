@@ -0,0 +1,121 @@
+package services
+
+// ByzantineBehavior describes how an AdversarialNode deviates from the
+// protocol run by the service it wraps.
+type ByzantineBehavior[TMsg any, TRes any] interface {
+	// Mutate is called before the wrapped service handles in. It may tamper
+	// with the service or the message; returning false drops the message.
+	Mutate(svc Service[TMsg, TRes], in *TMsg) bool
+	// Outgoing is called for every message the service broadcasts or sends
+	// and returns what is actually sent: nothing, the message, or several
+	// messages.
+	Outgoing(msg TMsg) []TMsg
+	// Forge returns extra messages to send after the service handled in.
+	Forge(in TMsg) []TMsg
+}
+
+// HonestBehavior does not deviate. Embed it to override single hooks.
+type HonestBehavior[TMsg any, TRes any] struct{}
+
+func (HonestBehavior[TMsg, TRes]) Mutate(Service[TMsg, TRes], *TMsg) bool { return true }
+func (HonestBehavior[TMsg, TRes]) Outgoing(msg TMsg) []TMsg               { return []TMsg{msg} }
+func (HonestBehavior[TMsg, TRes]) Forge(TMsg) []TMsg                      { return nil }
+
+// Combined runs several behaviors as one node, e.g. an equivocator that
+// also withholds its READYs.
+type Combined[TMsg any, TRes any] struct {
+	behaviors []ByzantineBehavior[TMsg, TRes]
+}
+
+// Combine returns a behavior that lets a message in only if every behavior
+// does, passes outgoing messages through the behaviors in order and sends
+// what all of them forge.
+func Combine[TMsg any, TRes any](behaviors ...ByzantineBehavior[TMsg, TRes]) *Combined[TMsg, TRes] {
+	return &Combined[TMsg, TRes]{behaviors: behaviors}
+}
+
+func (c *Combined[TMsg, TRes]) Mutate(svc Service[TMsg, TRes], in *TMsg) bool {
+	for _, b := range c.behaviors {
+		if !b.Mutate(svc, in) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Combined[TMsg, TRes]) Outgoing(msg TMsg) []TMsg {
+	out := []TMsg{msg}
+	for _, b := range c.behaviors {
+		var next []TMsg
+		for _, m := range out {
+			next = append(next, b.Outgoing(m)...)
+		}
+		out = next
+	}
+	return out
+}
+
+func (c *Combined[TMsg, TRes]) Forge(in TMsg) []TMsg {
+	var forged []TMsg
+	for _, b := range c.behaviors {
+		forged = append(forged, b.Forge(in)...)
+	}
+	return forged
+}
+
+// AdversarialNode wraps any service with a Byzantine behavior. It is itself a
+// Service, so it runs in a ServiceManager like an honest node.
+type AdversarialNode[TMsg any, TRes any] struct {
+	inner    Service[TMsg, TRes]
+	behavior ByzantineBehavior[TMsg, TRes]
+}
+
+func NewAdversarialNode[TMsg any, TRes any](inner Service[TMsg, TRes], behavior ByzantineBehavior[TMsg, TRes]) *AdversarialNode[TMsg, TRes] {
+	return &AdversarialNode[TMsg, TRes]{
+		inner:    inner,
+		behavior: behavior,
+	}
+}
+
+// Inner returns the wrapped service.
+func (a *AdversarialNode[TMsg, TRes]) Inner() Service[TMsg, TRes] {
+	return a.inner
+}
+
+// WrapContext returns ctx with broadcasts routed through the behavior. Use it
+// for calls into the wrapped service made outside OnMessage (e.g. Start).
+func (a *AdversarialNode[TMsg, TRes]) WrapContext(ctx ServiceContext[TMsg, TRes]) ServiceContext[TMsg, TRes] {
+	return &adversaryContext[TMsg, TRes]{behavior: a.behavior, ctx: ctx}
+}
+
+func (a *AdversarialNode[TMsg, TRes]) OnMessage(msg TMsg, ctx ServiceContext[TMsg, TRes]) {
+	if !a.behavior.Mutate(a.inner, &msg) {
+		return
+	}
+	a.inner.OnMessage(msg, a.WrapContext(ctx))
+	for _, forged := range a.behavior.Forge(msg) {
+		ctx.Broadcast(forged)
+	}
+}
+
+// adversaryContext routes the wrapped service's broadcasts through the behavior
+type adversaryContext[TMsg any, TRes any] struct {
+	behavior ByzantineBehavior[TMsg, TRes]
+	ctx      ServiceContext[TMsg, TRes]
+}
+
+func (c *adversaryContext[TMsg, TRes]) Broadcast(msg TMsg) {
+	for _, out := range c.behavior.Outgoing(msg) {
+		c.ctx.Broadcast(out)
+	}
+}
+
+func (c *adversaryContext[TMsg, TRes]) SendTo(to int, msg TMsg) {
+	for _, out := range c.behavior.Outgoing(msg) {
+		c.ctx.SendTo(to, out)
+	}
+}
+
+func (c *adversaryContext[TMsg, TRes]) SendResult(res TRes) {
+	c.ctx.SendResult(res)
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"math/big"
+	"sync"
+)
+
+// SilentAfter forwards the first k outgoing messages and then goes silent.
+// It keeps receiving, so it models a crash that the others cannot observe.
+type SilentAfter[TMsg any, TRes any] struct {
+	HonestBehavior[TMsg, TRes]
+	k    int
+	sent int
+	mu   sync.Mutex
+}
+
+func NewSilentAfter[TMsg any, TRes any](k int) *SilentAfter[TMsg, TRes] {
+	return &SilentAfter[TMsg, TRes]{k: k}
+}
+
+func (b *SilentAfter[TMsg, TRes]) Outgoing(msg TMsg) []TMsg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sent >= b.k {
+		return nil
+	}
+	b.sent++
+	return []TMsg{msg}
+}
+
+// Delayer holds every outgoing message until the node has handled hold more
+// incoming messages. Delays are counted in steps, not time, so runs stay
+// reproducible under a deterministic scheduler.
+type Delayer[TMsg any, TRes any] struct {
+	HonestBehavior[TMsg, TRes]
+	hold  int
+	step  int
+	queue []delayedMsg[TMsg]
+	mu    sync.Mutex
+}
+
+type delayedMsg[TMsg any] struct {
+	msg       TMsg
+	releaseAt int
+}
+
+func NewDelayer[TMsg any, TRes any](hold int) *Delayer[TMsg, TRes] {
+	return &Delayer[TMsg, TRes]{hold: hold}
+}
+
+func (b *Delayer[TMsg, TRes]) Outgoing(msg TMsg) []TMsg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue = append(b.queue, delayedMsg[TMsg]{msg: msg, releaseAt: b.step + b.hold})
+	return nil
+}
+
+func (b *Delayer[TMsg, TRes]) Forge(TMsg) []TMsg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.step++
+	var released []TMsg
+	kept := b.queue[:0]
+	for _, d := range b.queue {
+		if d.releaseAt <= b.step {
+			released = append(released, d.msg)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	b.queue = kept
+	return released
+}
+
+// Equivocator sends, next to every outgoing message, the conflicting version
+// returned by conflict (if any).
+type Equivocator[TMsg any, TRes any] struct {
+	HonestBehavior[TMsg, TRes]
+	conflict func(TMsg) (TMsg, bool)
+}
+
+func NewEquivocator[TMsg any, TRes any](conflict func(TMsg) (TMsg, bool)) *Equivocator[TMsg, TRes] {
+	return &Equivocator[TMsg, TRes]{conflict: conflict}
+}
+
+func (b *Equivocator[TMsg, TRes]) Outgoing(msg TMsg) []TMsg {
+	if alt, ok := b.conflict(msg); ok {
+		return []TMsg{msg, alt}
+	}
+	return []TMsg{msg}
+}
+
+// NewACastEquivocator sends every A-Cast message of the node twice: with
+// the real value and with alt, under the same UUID.
+func NewACastEquivocator(alt string) *Equivocator[ACastMessage[string], string] {
+	return NewEquivocator[ACastMessage[string], string](func(msg ACastMessage[string]) (ACastMessage[string], bool) {
+		if msg.Val == alt {
+			return msg, false
+		}
+		msg.Val = alt
+		return msg, true
+	})
+}
+
+// NewVoteEquivocator flips the bit of every Vote payload the node A-Casts
+// and sends both versions under the same UUID, voting both bits.
+func NewVoteEquivocator() *Equivocator[VoteMessage, VoteResult] {
+	return NewEquivocator[VoteMessage, VoteResult](flipVote)
+}
+
+// NewABAEquivocator flips the bit of every Vote and COMPLETE payload the
+// node A-Casts and sends both versions under the same UUID.
+func NewABAEquivocator() *Equivocator[ABAMessage, int] {
+	return NewEquivocator[ABAMessage, int](func(msg ABAMessage) (ABAMessage, bool) {
+		switch {
+		case msg.VoteMsg != nil:
+			vote, ok := flipVote(*msg.VoteMsg)
+			msg.VoteMsg = &vote
+			return msg, ok
+		case msg.CompleteMsg != nil:
+			p, err := ParseCompletePayload(msg.CompleteMsg.Val)
+			if err != nil {
+				return msg, false
+			}
+			p.Value = 1 - p.Value
+			acast := *msg.CompleteMsg
+			acast.Val = p.String()
+			msg.CompleteMsg = &acast
+			return msg, true
+		}
+		return msg, false
+	})
+}
+
+// flipVote returns msg with the bit of its payload flipped.
+func flipVote(msg VoteMessage) (VoteMessage, bool) {
+	if msg.ACastMsg == nil {
+		return msg, false
+	}
+	p, err := ParseVotePayload(msg.ACastMsg.Val)
+	if err != nil {
+		return msg, false
+	}
+	p.Bit = 1 - p.Bit
+	acast := *msg.ACastMsg
+	acast.Val = p.String()
+	msg.ACastMsg = &acast
+	return msg, true
+}
+
+// Withholder drops the outgoing messages filter matches and sends the rest,
+// e.g. never sends READY so its A-Casts rely on the other nodes alone.
+type Withholder[TMsg any, TRes any] struct {
+	HonestBehavior[TMsg, TRes]
+	classify func(TMsg) MessageInfo
+	filter   MessageFilter
+}
+
+func NewWithholder[TMsg any, TRes any](classify func(TMsg) MessageInfo, filter MessageFilter) *Withholder[TMsg, TRes] {
+	return &Withholder[TMsg, TRes]{classify: classify, filter: filter}
+}
+
+func (b *Withholder[TMsg, TRes]) Outgoing(msg TMsg) []TMsg {
+	if b.filter.matches(b.classify(msg)) {
+		return nil
+	}
+	return []TMsg{msg}
+}
+
+// NewACastReadyWithholder withholds every READY of the node.
+func NewACastReadyWithholder() *Withholder[ACastMessage[string], string] {
+	return NewWithholder[ACastMessage[string], string](ClassifyACastMessage[string], MessageFilter{Type: "READY"})
+}
+
+// NewABAReadyWithholder withholds the READYs of every A-Cast the node takes
+// part in, in all layers.
+func NewABAReadyWithholder() *Withholder[ABAMessage, int] {
+	return NewWithholder[ABAMessage, int](ClassifyABAMessage, MessageFilter{Type: "READY"})
+}
+
+// BadDealer corrupts the shares the node deals to the victims, so their
+// polynomials are inconsistent with everyone else's.
+type BadDealer[TMsg any, TRes any] struct {
+	HonestBehavior[TMsg, TRes]
+	victims map[int]bool
+	corrupt func(TMsg, map[int]bool) TMsg
+}
+
+func (b *BadDealer[TMsg, TRes]) Outgoing(msg TMsg) []TMsg {
+	return []TMsg{b.corrupt(msg, b.victims)}
+}
+
+func NewIVSSBadDealer(victims ...int) *BadDealer[IVSSMessage, IVSSResult] {
+	return &BadDealer[IVSSMessage, IVSSResult]{victims: toSet(victims), corrupt: corruptShare}
+}
+
+func NewABABadDealer(victims ...int) *BadDealer[ABAMessage, int] {
+	return &BadDealer[ABAMessage, int]{
+		victims: toSet(victims),
+		corrupt: func(msg ABAMessage, victims map[int]bool) ABAMessage {
+			return withIVSS(msg, func(ivss IVSSMessage) IVSSMessage { return corruptShare(ivss, victims) })
+		},
+	}
+}
+
+// BadRevealer reveals a polynomial other than the one it was dealt when
+// reconstructing, inconsistent with the points the other nodes hold. The
+// interpolation set is built greedily, so reconstruction only tolerates it
+// when the bad reveal arrives after t+1 good ones.
+type BadRevealer[TMsg any, TRes any] struct {
+	HonestBehavior[TMsg, TRes]
+	corrupt func(TMsg) TMsg
+}
+
+func (b *BadRevealer[TMsg, TRes]) Outgoing(msg TMsg) []TMsg {
+	return []TMsg{b.corrupt(msg)}
+}
+
+func NewIVSSBadRevealer() *BadRevealer[IVSSMessage, IVSSResult] {
+	return &BadRevealer[IVSSMessage, IVSSResult]{corrupt: corruptReveal}
+}
+
+// withIVSS applies fn to the IVSS message an ABA message carries, if any.
+func withIVSS(msg ABAMessage, fn func(IVSSMessage) IVSSMessage) ABAMessage {
+	if msg.ICCMsg == nil || msg.ICCMsg.IVSSMsg == nil {
+		return msg
+	}
+	ivss := fn(*msg.ICCMsg.IVSSMsg)
+	icc := *msg.ICCMsg
+	icc.IVSSMsg = &ivss
+	msg.ICCMsg = &icc
+	return msg
+}
+
+// corruptReveal shifts the constant term of a revealed polynomial.
+func corruptReveal(msg IVSSMessage) IVSSMessage {
+	if msg.Type != IVSS_ACast || msg.ACastMsg == nil || msg.ACastMsg.Type != MSG {
+		return msg
+	}
+	payload, err := ParseIVSSPayload(msg.ACastMsg.Val)
+	if err != nil || payload.Type != Payload_Reveal || payload.RevealPoly == nil || len(payload.RevealPoly.Coeffs) == 0 {
+		return msg
+	}
+	payload.RevealPoly = shiftConstant(payload.RevealPoly)
+	acast := *msg.ACastMsg
+	acast.Val = payload.String()
+	msg.ACastMsg = &acast
+	return msg
+}
+
+// corruptShare shifts the constant term of a share sent to a victim.
+func corruptShare(msg IVSSMessage, victims map[int]bool) IVSSMessage {
+	if msg.Type != IVSS_Direct || msg.DirectType != Direct_Share || !victims[msg.To] || msg.Poly == nil || len(msg.Poly.Coeffs) == 0 {
+		return msg
+	}
+	msg.Poly = shiftConstant(msg.Poly)
+	return msg
+}
+
+// shiftConstant returns a copy of poly with its constant term plus one.
+func shiftConstant(poly *utils.Polynomial) *utils.Polynomial {
+	coeffs := make([]*big.Int, len(poly.Coeffs))
+	copy(coeffs, poly.Coeffs)
+	coeffs[0] = new(big.Int).Add(coeffs[0], big.NewInt(1))
+	coeffs[0].Mod(coeffs[0], utils.Prime)
+	return &utils.Polynomial{Coeffs: coeffs}
+}
+
+func toSet(ids []int) map[int]bool {
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
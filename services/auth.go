@@ -0,0 +1,390 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnknownSender  = errors.New("no public key for sender")
+	ErrBadSignature   = errors.New("invalid signature")
+	ErrReplayed       = errors.New("envelope already received")
+	ErrStale          = errors.New("envelope older than the replay window")
+	ErrSenderMismatch = errors.New("message claims another sender than its envelope")
+)
+
+// signedEnvelopeDomain separates these signatures from anything else the
+// node keys might sign.
+const signedEnvelopeDomain = "aba-signed-envelope-v1"
+
+// SignedEnvelope is what an AuthenticatedTransport puts on the wire: the
+// encoded message with its sender and a sequence number, signed by the
+// sender. The sequence number makes every envelope unique, so a recorded
+// envelope cannot be replayed. Senders number their envelopes from 1.
+type SignedEnvelope struct {
+	Sender int
+	Seq    uint64
+	Body   []byte
+	Sig    []byte
+}
+
+// signedBytes returns the bytes the signature covers.
+func (e SignedEnvelope) signedBytes() []byte {
+	b := make([]byte, 0, len(signedEnvelopeDomain)+16+len(e.Body))
+	b = append(b, signedEnvelopeDomain...)
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Sender))
+	b = binary.BigEndian.AppendUint64(b, e.Seq)
+	return append(b, e.Body...)
+}
+
+// Keyring maps node IDs to their Ed25519 public keys.
+type Keyring struct {
+	keys map[int]ed25519.PublicKey
+}
+
+func NewKeyring(keys map[int]ed25519.PublicKey) *Keyring {
+	k := &Keyring{keys: make(map[int]ed25519.PublicKey, len(keys))}
+	for id, key := range keys {
+		k.keys[id] = key
+	}
+	return k
+}
+
+// GenerateKeys creates key pairs for nodes 1..n from rand (crypto/rand when
+// nil) and returns the private keys with the keyring of their public keys.
+func GenerateKeys(n int, rand io.Reader) (map[int]ed25519.PrivateKey, *Keyring, error) {
+	private := make(map[int]ed25519.PrivateKey, n)
+	public := make(map[int]ed25519.PublicKey, n)
+	for id := 1; id <= n; id++ {
+		pub, priv, err := ed25519.GenerateKey(rand)
+		if err != nil {
+			return nil, nil, err
+		}
+		private[id], public[id] = priv, pub
+	}
+	return private, NewKeyring(public), nil
+}
+
+// PublicKey returns the key of node id, or nil if it is unknown.
+func (k *Keyring) PublicKey(id int) ed25519.PublicKey {
+	return k.keys[id]
+}
+
+// Verify checks that env was signed by the node it names as sender.
+func (k *Keyring) Verify(env SignedEnvelope) error {
+	key, ok := k.keys[env.Sender]
+	if !ok {
+		return fmt.Errorf("%w %d", ErrUnknownSender, env.Sender)
+	}
+	if !ed25519.Verify(key, env.signedBytes(), env.Sig) {
+		return fmt.Errorf("%w from %d", ErrBadSignature, env.Sender)
+	}
+	return nil
+}
+
+// AuthenticatedTransport signs the messages of one node and authenticates
+// the messages it receives, over any transport carrying SignedEnvelopes.
+// Envelopes from unknown senders, with invalid signatures or received
+// before are dropped before they reach the inbox, and so are messages whose
+// own sender fields name another node than the envelope (see ABASender).
+// Without it, a Byzantine node can put any ID in the From fields of A-Cast
+// and IVSS messages and speak for honest nodes.
+type AuthenticatedTransport[TMsg any] struct {
+	inner   Transport[SignedEnvelope]
+	self    int
+	key     ed25519.PrivateKey
+	keyring *Keyring
+	codec   Codec[TMsg]
+
+	// Optional, returns the sender a message claims to come from
+	senderOf func(TMsg) (int, bool)
+
+	seq       atomic.Uint64
+	seen      map[int]*replayWindow             // Sequence numbers received per sender
+	envelopes map[chan TMsg]chan SignedEnvelope // Inbox -> the envelope inbox registered on inner
+	stop      chan struct{}
+	mu        sync.Mutex
+}
+
+// NewAuthenticatedTransport creates the transport of node self, signing
+// with key and checking senders against keyring. Messages are encoded with
+// codec into the envelope body.
+func NewAuthenticatedTransport[TMsg any](inner Transport[SignedEnvelope], self int, key ed25519.PrivateKey, keyring *Keyring, codec Codec[TMsg]) *AuthenticatedTransport[TMsg] {
+	return &AuthenticatedTransport[TMsg]{
+		inner:     inner,
+		self:      self,
+		key:       key,
+		keyring:   keyring,
+		codec:     codec,
+		seen:      make(map[int]*replayWindow),
+		envelopes: make(map[chan TMsg]chan SignedEnvelope),
+		stop:      make(chan struct{}),
+	}
+}
+
+// SetSenderCheck makes the transport drop messages for which senderOf
+// returns another node than the authenticated sender. Messages for which it
+// returns false carry no sender and are accepted.
+func (a *AuthenticatedTransport[TMsg]) SetSenderCheck(senderOf func(TMsg) (int, bool)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.senderOf = senderOf
+}
+
+// Register registers an inbox for node id on the inner transport and
+// passes on the messages that pass authentication to ch.
+func (a *AuthenticatedTransport[TMsg]) Register(id int, ch chan TMsg) {
+	envelopes := make(chan SignedEnvelope, cap(ch))
+	a.mu.Lock()
+	a.envelopes[ch] = envelopes
+	a.mu.Unlock()
+	a.inner.Register(id, envelopes)
+	go func() {
+		for {
+			select {
+			case env := <-envelopes:
+				msg, err := a.Open(env)
+				if err != nil {
+					log.Warn().Str("layer", "NETWORK").Int("node", a.self).Int("sender", env.Sender).Err(err).Msg("Rejected message")
+					continue
+				}
+				select {
+				case ch <- msg:
+				case <-a.stop:
+					return
+				}
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (a *AuthenticatedTransport[TMsg]) Broadcast(msg TMsg) {
+	if env, ok := a.seal(msg); ok {
+		a.inner.Broadcast(env)
+	}
+}
+
+func (a *AuthenticatedTransport[TMsg]) Send(to int, msg TMsg) {
+	if env, ok := a.seal(msg); ok {
+		a.inner.Send(to, env)
+	}
+}
+
+// BroadcastFrom is Broadcast, sent on a SourcedTransport as the inbox
+// registered for inbox.
+func (a *AuthenticatedTransport[TMsg]) BroadcastFrom(inbox chan TMsg, msg TMsg) {
+	sourced, envelopes, ok := a.sourced(inbox)
+	if !ok {
+		a.Broadcast(msg)
+		return
+	}
+	if env, ok := a.seal(msg); ok {
+		sourced.BroadcastFrom(envelopes, env)
+	}
+}
+
+// SendFrom is Send, sent on a SourcedTransport as the inbox registered for
+// inbox.
+func (a *AuthenticatedTransport[TMsg]) SendFrom(inbox chan TMsg, to int, msg TMsg) {
+	sourced, envelopes, ok := a.sourced(inbox)
+	if !ok {
+		a.Send(to, msg)
+		return
+	}
+	if env, ok := a.seal(msg); ok {
+		sourced.SendFrom(envelopes, to, env)
+	}
+}
+
+// sourced returns the inner transport if it is a SourcedTransport, and the
+// inbox registered on it for inbox.
+func (a *AuthenticatedTransport[TMsg]) sourced(inbox chan TMsg) (SourcedTransport[SignedEnvelope], chan SignedEnvelope, bool) {
+	sourced, ok := a.inner.(SourcedTransport[SignedEnvelope])
+	if !ok {
+		return nil, nil, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	envelopes, ok := a.envelopes[inbox]
+	return sourced, envelopes, ok
+}
+
+// Close stops passing on messages. It does not close the inner transport.
+func (a *AuthenticatedTransport[TMsg]) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.stop:
+	default:
+		close(a.stop)
+	}
+}
+
+// Seal encodes and signs msg as the next envelope of this node.
+func (a *AuthenticatedTransport[TMsg]) Seal(msg TMsg) (SignedEnvelope, error) {
+	body, err := a.codec.Marshal(msg)
+	if err != nil {
+		return SignedEnvelope{}, err
+	}
+	env := SignedEnvelope{Sender: a.self, Seq: a.seq.Add(1), Body: body}
+	env.Sig = ed25519.Sign(a.key, env.signedBytes())
+	return env, nil
+}
+
+func (a *AuthenticatedTransport[TMsg]) seal(msg TMsg) (SignedEnvelope, bool) {
+	env, err := a.Seal(msg)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", a.codec.Name()).Err(err).Msg("Failed to encode message, dropping")
+		return SignedEnvelope{}, false
+	}
+	return env, true
+}
+
+// Open authenticates env and decodes its message. Each envelope is accepted
+// once.
+func (a *AuthenticatedTransport[TMsg]) Open(env SignedEnvelope) (TMsg, error) {
+	var zero TMsg
+	if err := a.keyring.Verify(env); err != nil {
+		return zero, err
+	}
+	msg, err := a.codec.Unmarshal(env.Body)
+	if err != nil {
+		return zero, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.senderOf != nil {
+		if claimed, ok := a.senderOf(msg); ok && claimed != env.Sender {
+			return zero, fmt.Errorf("%w: claims %d, signed by %d", ErrSenderMismatch, claimed, env.Sender)
+		}
+	}
+	seen, ok := a.seen[env.Sender]
+	if !ok {
+		seen = newReplayWindow()
+		a.seen[env.Sender] = seen
+	}
+	if err := seen.accept(env.Seq); err != nil {
+		return zero, fmt.Errorf("%w: %d from %d", err, env.Seq, env.Sender)
+	}
+	return msg, nil
+}
+
+// ReplayWindowSize is how far behind the highest sequence number of a
+// sender an envelope may arrive and still be accepted.
+const ReplayWindowSize = 4096
+
+// replayWindow remembers the sequence numbers received from one sender in
+// bounded memory: the highest one, and which of the ReplayWindowSize before
+// it arrived. Anything older is refused, like a replay.
+type replayWindow struct {
+	top  uint64
+	bits [ReplayWindowSize / 64]uint64 // Bit i is set if top-i was received
+}
+
+func newReplayWindow() *replayWindow {
+	w := &replayWindow{}
+	w.bits[0] = 1 // Sequence number 0 is never sealed
+	return w
+}
+
+// accept records seq, or returns ErrReplayed or ErrStale if it must be
+// refused.
+func (w *replayWindow) accept(seq uint64) error {
+	if seq > w.top {
+		w.shift(seq - w.top)
+		w.top = seq
+		w.bits[0] |= 1
+		return nil
+	}
+	back := w.top - seq
+	if back >= ReplayWindowSize {
+		return ErrStale
+	}
+	word, bit := back/64, uint64(1)<<(back%64)
+	if w.bits[word]&bit != 0 {
+		return ErrReplayed
+	}
+	w.bits[word] |= bit
+	return nil
+}
+
+// shift moves the window d sequence numbers ahead.
+func (w *replayWindow) shift(d uint64) {
+	if d >= ReplayWindowSize {
+		w.bits = [ReplayWindowSize / 64]uint64{}
+		return
+	}
+	words, bits := int(d/64), d%64
+	for i := len(w.bits) - 1; i >= 0; i-- {
+		var v uint64
+		if j := i - words; j >= 0 {
+			v = w.bits[j] << bits
+			if bits > 0 && j > 0 {
+				v |= w.bits[j-1] >> (64 - bits)
+			}
+		}
+		w.bits[i] = v
+	}
+}
+
+// ABASender returns the node an ABA message claims to come from: the
+// immediate sender of the A-Cast or IVSS message its Type routes it to.
+// Services route on Type alone, so a message also carrying sub-messages of
+// another type could pass a sender check on one of them and be handled as
+// another node's. Such a message, and one missing the sub-message of its
+// Type, claims sender 0, which no node has, and fails every sender check.
+func ABASender(msg ABAMessage) (int, bool) {
+	vote, icc, complete := msg.VoteMsg != nil, msg.ICCMsg != nil, msg.CompleteMsg != nil
+	switch {
+	case msg.Type == ABA_Vote && vote && !icc && !complete:
+		if msg.VoteMsg.Type != Vote_ACast || msg.VoteMsg.ACastMsg == nil {
+			return 0, true
+		}
+		return msg.VoteMsg.ACastMsg.From, true
+	case msg.Type == ABA_ICC && icc && !vote && !complete:
+		return ICCSender(*msg.ICCMsg)
+	case msg.Type == ABA_Complete && complete && !vote && !icc:
+		return msg.CompleteMsg.From, true
+	case msg.Type == ABA_Coin && !vote && !icc && !complete:
+		return 0, false
+	}
+	return 0, true
+}
+
+// ICCSender returns the node an ICC message claims to come from, like
+// ABASender.
+func ICCSender(msg ICCMessage) (int, bool) {
+	switch {
+	case msg.Type == ICC_IVSS && msg.IVSSMsg != nil && msg.ACastMsg == nil:
+		return IVSSSender(*msg.IVSSMsg)
+	case msg.Type == ICC_ACast && msg.ACastMsg != nil && msg.IVSSMsg == nil:
+		return msg.ACastMsg.From, true
+	}
+	return 0, true
+}
+
+// IVSSSender returns the node an IVSS message claims to come from, like
+// ABASender.
+func IVSSSender(msg IVSSMessage) (int, bool) {
+	switch msg.Type {
+	case IVSS_ACast:
+		if msg.ACastMsg != nil {
+			return msg.ACastMsg.From, true
+		}
+	case IVSS_Direct:
+		if msg.ACastMsg == nil {
+			return msg.From, true
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type AvidMsgType int
+
+const (
+	Avid_Send  AvidMsgType = iota // Dealer -> node i: fragment i
+	Avid_Echo                     // Node i -> all: fragment i
+	Avid_Ready                    // Node -> all: root of the cross-checksum
+)
+
+func (m AvidMsgType) String() string {
+	switch m {
+	case Avid_Send:
+		return "SEND"
+	case Avid_Echo:
+		return "ECHO"
+	case Avid_Ready:
+		return "READY"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// AvidMessage is a message of an erasure-coded broadcast. Send and Echo
+// carry one fragment with the cross-checksum to verify it against, Ready
+// only the root of the cross-checksum.
+type AvidMessage struct {
+	Type     AvidMsgType
+	UUID     string
+	From     int
+	Fragment []byte   `json:",omitempty"`
+	Checksum []string `json:",omitempty"` // Hex SHA-256 of every fragment, in node order
+	Root     string   `json:",omitempty"` // AvidRoot of Checksum
+}
+
+// AvidResult is a value delivered by AvidService.
+type AvidResult struct {
+	UUID  string
+	Value []byte
+	// The dealer sent fragments that are not one codeword. Every correct
+	// node then delivers a corrupt result with no value.
+	Corrupt bool
+}
+
+// AvidRoot commits to a cross-checksum: the hex SHA-256 of its hashes.
+func AvidRoot(checksum []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(checksum, ",")))
+	return hex.EncodeToString(hash[:])
+}
+
+func fragmentHash(fragment []byte) string {
+	hash := sha256.Sum256(fragment)
+	return hex.EncodeToString(hash[:])
+}
+
+type avidInstance struct {
+	sentEcho  bool
+	sentReady bool
+	delivered bool
+	echoes    map[string]map[int]bool   // Root -> senders
+	readies   map[string]map[int]bool   // Root -> senders
+	fragments map[string]map[int][]byte // Root -> node -> verified fragment
+	checksums map[string][]string       // Root -> cross-checksum
+}
+
+func newAvidInstance() *avidInstance {
+	return &avidInstance{
+		echoes:    make(map[string]map[int]bool),
+		readies:   make(map[string]map[int]bool),
+		fragments: make(map[string]map[int][]byte),
+		checksums: make(map[string][]string),
+	}
+}
+
+// AvidService is an erasure-coded reliable broadcast in the style of AVID
+// (Cachin and Tessaro, "Asynchronous Verifiable Information Dispersal").
+// The dealer splits the value into n Reed–Solomon fragments, any n-2t of
+// which recover it, and sends node i fragment i with the SHA-256 of every
+// fragment (the cross-checksum). Each node relays only its own fragment in
+// ECHO, so a broadcast costs O(n·|v| + n³·λ) instead of the O(n²·|v|) of
+// A-Cast. READY and delivery follow Bracha on the root of the
+// cross-checksum; a node delivers once it has 2t+1 READYs and n-2t verified
+// fragments, and re-encodes the value to check the dealer was consistent.
+type AvidService struct {
+	id        int
+	n         int
+	t         int
+	nc        *NodeContext
+	cp        *CertificationProtocol // Optional, used to ignore certified-faulty senders
+	instances map[string]*avidInstance
+	logger    zerolog.Logger
+}
+
+// NewAvidServiceWithContext creates an AvidService using the shared state of a node.
+func NewAvidServiceWithContext(nc *NodeContext) *AvidService {
+	logger := log.With().
+		Str("layer", "AVID").
+		Int("node_id", nc.ID).
+		Logger().
+		Level(nc.LogLevel)
+
+	return &AvidService{
+		id:        nc.ID,
+		n:         nc.N,
+		t:         nc.T,
+		nc:        nc,
+		cp:        nc.CP,
+		instances: make(map[string]*avidInstance),
+		logger:    logger,
+	}
+}
+
+// dataFragments is the number of fragments that recover a value.
+func (a *AvidService) dataFragments() int {
+	return a.n - 2*a.t
+}
+
+func (a *AvidService) getInstance(uuid string) *avidInstance {
+	if _, ok := a.instances[uuid]; !ok {
+		a.instances[uuid] = newAvidInstance()
+	}
+	return a.instances[uuid]
+}
+
+// Disperse broadcasts val with this node as the dealer and returns the ID
+// of the broadcast.
+func (a *AvidService) Disperse(val []byte, ctx ServiceContext[AvidMessage, AvidResult]) (string, error) {
+	fragments, err := utils.EncodeFragments(val, a.dataFragments(), a.n)
+	if err != nil {
+		return "", err
+	}
+	checksum := make([]string, a.n)
+	for i, fragment := range fragments {
+		checksum[i] = fragmentHash(fragment)
+	}
+	uuid := ACastUUID(val, a.id, a.nc.nonce())
+
+	a.logger.Info().Str("uuid", uuid).Int("bytes", len(val)).Msg("Dispersing value")
+	for i, fragment := range fragments {
+		ctx.SendTo(i+1, AvidMessage{Type: Avid_Send, UUID: uuid, From: a.id, Fragment: fragment, Checksum: checksum})
+	}
+	return uuid, nil
+}
+
+// verify checks that fragment is the one of node from in checksum.
+func (a *AvidService) verify(from int, fragment []byte, checksum []string) bool {
+	return len(checksum) == a.n && from >= 1 && from <= a.n && fragmentHash(fragment) == checksum[from-1]
+}
+
+func (a *AvidService) OnMessage(msg AvidMessage, ctx ServiceContext[AvidMessage, AvidResult]) {
+	if a.cp.IsCertifiedFaulty(a.id, msg.From) {
+		a.logger.Debug().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Ignoring message from certified-faulty process")
+		return
+	}
+
+	inst := a.getInstance(msg.UUID)
+	if inst.delivered {
+		return
+	}
+
+	switch msg.Type {
+	case Avid_Send:
+		// Relay our own fragment once, if it matches the cross-checksum
+		if inst.sentEcho || !a.verify(a.id, msg.Fragment, msg.Checksum) {
+			return
+		}
+		inst.sentEcho = true
+		a.logger.Debug().Str("uuid", msg.UUID).Msgf("Received fragment from dealer %d, broadcasting ECHO", msg.From)
+		ctx.Broadcast(AvidMessage{Type: Avid_Echo, UUID: msg.UUID, From: a.id, Fragment: msg.Fragment, Checksum: msg.Checksum})
+
+	case Avid_Echo:
+		if !a.verify(msg.From, msg.Fragment, msg.Checksum) {
+			a.logger.Warn().Str("uuid", msg.UUID).Int("from", msg.From).Msg("Fragment does not match its cross-checksum, ignoring")
+			return
+		}
+		root := AvidRoot(msg.Checksum)
+		if inst.echoes[root] == nil {
+			inst.echoes[root] = make(map[int]bool)
+			inst.fragments[root] = make(map[int][]byte)
+			inst.checksums[root] = slices.Clone(msg.Checksum)
+		}
+		inst.echoes[root][msg.From] = true
+		inst.fragments[root][msg.From] = msg.Fragment
+
+		if count := len(inst.echoes[root]); count >= a.n-a.t && !inst.sentReady {
+			inst.sentReady = true
+			a.logger.Debug().Str("uuid", msg.UUID).Msgf("Threshold ECHO reached (%d), broadcasting READY", count)
+			ctx.Broadcast(AvidMessage{Type: Avid_Ready, UUID: msg.UUID, From: a.id, Root: root})
+		}
+		a.tryDeliver(msg.UUID, inst, root, ctx)
+
+	case Avid_Ready:
+		if inst.readies[msg.Root] == nil {
+			inst.readies[msg.Root] = make(map[int]bool)
+		}
+		inst.readies[msg.Root][msg.From] = true
+
+		if count := len(inst.readies[msg.Root]); count >= a.t+1 && !inst.sentReady {
+			inst.sentReady = true
+			a.logger.Debug().Str("uuid", msg.UUID).Msgf("Threshold READY (early) reached (%d), broadcasting READY", count)
+			ctx.Broadcast(AvidMessage{Type: Avid_Ready, UUID: msg.UUID, From: a.id, Root: msg.Root})
+		}
+		a.tryDeliver(msg.UUID, inst, msg.Root, ctx)
+	}
+}
+
+// tryDeliver decodes the value of root once 2t+1 nodes are ready for it and
+// enough of its fragments arrived.
+func (a *AvidService) tryDeliver(uuid string, inst *avidInstance, root string, ctx ServiceContext[AvidMessage, AvidResult]) {
+	if len(inst.readies[root]) < 2*a.t+1 || len(inst.fragments[root]) < a.dataFragments() {
+		return
+	}
+	fragments := make(map[int][]byte, len(inst.fragments[root]))
+	for id, fragment := range inst.fragments[root] {
+		fragments[id-1] = fragment
+	}
+	res := AvidResult{UUID: uuid}
+	val, err := utils.DecodeFragments(fragments, a.dataFragments(), a.n)
+	if err == nil && a.consistent(val, inst.checksums[root]) {
+		res.Value = val
+	} else {
+		res.Corrupt = true
+		a.logger.Warn().Str("uuid", uuid).Msg("Dealer fragments are not a valid encoding, delivering corrupt result")
+	}
+
+	inst.delivered = true
+	inst.echoes = nil
+	inst.readies = nil
+	inst.fragments = nil
+	inst.checksums = nil
+	a.logger.Info().Str("uuid", uuid).Msgf("AVID Complete: Delivered %d bytes", len(res.Value))
+	ctx.SendResult(res)
+}
+
+// consistent re-encodes val and compares the fragments to checksum, so
+// every correct node delivers the same value whichever fragments it used.
+func (a *AvidService) consistent(val []byte, checksum []string) bool {
+	fragments, err := utils.EncodeFragments(val, a.dataFragments(), a.n)
+	if err != nil {
+		return false
+	}
+	for i, fragment := range fragments {
+		if fragmentHash(fragment) != checksum[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrQueueFull is returned by Network.TryBroadcast and TrySend when the send
+// queue of a peer is full under Backpressure_Error.
+var ErrQueueFull = errors.New("send queue full")
+
+// BackpressurePolicy decides what a Network does with a message for a peer
+// whose send queue is full, see Network.SetBackpressure.
+type BackpressurePolicy int
+
+const (
+	Backpressure_Block      BackpressurePolicy = iota // Wait for room; may deadlock nodes sending to each other
+	Backpressure_DropOldest                           // Drop the oldest queued message to make room
+	Backpressure_DropNewest                           // Drop the new message
+	Backpressure_Error                                // Drop the new message and report ErrQueueFull
+)
+
+var backpressurePolicies = map[string]BackpressurePolicy{
+	"block":       Backpressure_Block,
+	"drop-oldest": Backpressure_DropOldest,
+	"drop-newest": Backpressure_DropNewest,
+	"error":       Backpressure_Error,
+}
+
+// ParseBackpressurePolicy returns the policy with the given name: block,
+// drop-oldest, drop-newest or error.
+func ParseBackpressurePolicy(name string) (BackpressurePolicy, error) {
+	if p, ok := backpressurePolicies[strings.ToLower(name)]; ok {
+		return p, nil
+	}
+	return 0, fmt.Errorf("unknown backpressure policy %q, expected block, drop-oldest, drop-newest or error", name)
+}
+
+func (p BackpressurePolicy) String() string {
+	for name, policy := range backpressurePolicies {
+		if policy == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("BackpressurePolicy(%d)", int(p))
+}
+
+// sendQueue is the bounded queue of messages to one inbox. One goroutine,
+// running while the queue is not empty, moves them to the inbox, so a slow
+// peer costs at most limit messages instead of a goroutine per message.
+type sendQueue[TMsg any] struct {
+	items   []TMsg
+	limit   int
+	policy  BackpressurePolicy
+	dropped uint64
+	running bool
+	room    *sync.Cond // Signaled when an item leaves the queue
+	mu      sync.Mutex
+}
+
+func newSendQueue[TMsg any](limit int, policy BackpressurePolicy) *sendQueue[TMsg] {
+	q := &sendQueue[TMsg]{limit: limit, policy: policy}
+	q.room = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues msg for ch according to the policy.
+func (q *sendQueue[TMsg]) push(msg TMsg, ch chan TMsg) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) >= q.limit {
+		switch q.policy {
+		case Backpressure_Block:
+			q.room.Wait()
+			continue
+		case Backpressure_DropOldest:
+			var zero TMsg
+			q.items[0] = zero
+			q.items = q.items[1:]
+		case Backpressure_DropNewest:
+			q.dropped++
+			return nil
+		case Backpressure_Error:
+			q.dropped++
+			return ErrQueueFull
+		}
+		q.dropped++
+	}
+	q.items = append(q.items, msg)
+	if !q.running {
+		q.running = true
+		go q.run(ch)
+	}
+	return nil
+}
+
+func (q *sendQueue[TMsg]) run(ch chan TMsg) {
+	for {
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		msg := q.items[0]
+		var zero TMsg
+		q.items[0] = zero
+		q.items = q.items[1:]
+		q.room.Broadcast()
+		q.mu.Unlock()
+		ch <- msg
+	}
+}
+
+// drops returns how many messages the policy dropped.
+func (q *sendQueue[TMsg]) drops() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
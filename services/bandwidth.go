@@ -0,0 +1,135 @@
+package services
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// TrafficCount is an amount of traffic.
+type TrafficCount struct {
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// Bits returns the traffic in bits, the unit of communication complexity.
+func (c TrafficCount) Bits() uint64 {
+	return 8 * c.Bytes
+}
+
+func (c *TrafficCount) add(size int) {
+	c.Messages++
+	c.Bytes += uint64(size)
+}
+
+// TrafficReport is the traffic a TrafficMeter counted. Every delivery to one
+// node counts once, so a broadcast to n nodes counts n times.
+type TrafficReport struct {
+	Total    TrafficCount            `json:"total"`
+	Sent     map[int]TrafficCount    `json:"sent"`     // By sender, 0 if unknown
+	Received map[int]TrafficCount    `json:"received"` // By recipient
+	ByType   map[string]TrafficCount `json:"by_type"`  // By "layer/type", see TrafficKey
+}
+
+// TrafficKey is the key of a message in TrafficReport.ByType, e.g.
+// "ACAST/ECHO" or "IVSS/SHARE".
+func TrafficKey(info MessageInfo) string {
+	return info.Layer + "/" + info.Type
+}
+
+// TrafficMeter counts the messages and bytes a Network delivers, per node
+// and per message type, and can cap the bandwidth each node sends with.
+// Sizes are those of codec, independent of the codec of the network, and
+// senders and types come from classify.
+type TrafficMeter[TMsg any] struct {
+	codec    Codec[TMsg]
+	classify func(TMsg) MessageInfo
+
+	uplink float64           // Bytes per second each node sends, 0 for unlimited
+	free   map[int]time.Time // When the uplink of each sender is idle again
+	report TrafficReport
+	mu     sync.Mutex
+}
+
+// NewTrafficMeter creates a meter sizing messages with codec and
+// classifying them with classify, e.g. ClassifyABAMessage.
+func NewTrafficMeter[TMsg any](codec Codec[TMsg], classify func(TMsg) MessageInfo) *TrafficMeter[TMsg] {
+	return &TrafficMeter[TMsg]{
+		codec:    codec,
+		classify: classify,
+		free:     make(map[int]time.Time),
+		report: TrafficReport{
+			Sent:     make(map[int]TrafficCount),
+			Received: make(map[int]TrafficCount),
+			ByType:   make(map[string]TrafficCount),
+		},
+	}
+}
+
+// SetUplinkCap limits every node to sending bytesPerSecond: the copies of
+// its messages queue up on its uplink and each one is delayed until the
+// ones before it went out. Senders are known from the classify function; 0
+// removes the cap.
+func (m *TrafficMeter[TMsg]) SetUplinkCap(bytesPerSecond float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uplink = bytesPerSecond
+}
+
+// Report returns a copy of the traffic counted so far.
+func (m *TrafficMeter[TMsg]) Report() TrafficReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return TrafficReport{
+		Total:    m.report.Total,
+		Sent:     maps.Clone(m.report.Sent),
+		Received: maps.Clone(m.report.Received),
+		ByType:   maps.Clone(m.report.ByType),
+	}
+}
+
+// record counts the delivery of msg to each node in to and returns how long
+// the uplink cap holds back each copy, nil without a cap.
+func (m *TrafficMeter[TMsg]) record(to []int, msg TMsg) []time.Duration {
+	size := 0
+	if data, err := m.codec.Marshal(msg); err == nil {
+		size = len(data)
+	}
+	var info MessageInfo
+	if m.classify != nil {
+		info = m.classify(msg)
+	}
+	key := TrafficKey(info)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range to {
+		m.report.Total.add(size)
+		c := m.report.Sent[info.Sender]
+		c.add(size)
+		m.report.Sent[info.Sender] = c
+		c = m.report.Received[id]
+		c.add(size)
+		m.report.Received[id] = c
+		c = m.report.ByType[key]
+		c.add(size)
+		m.report.ByType[key] = c
+	}
+
+	if m.uplink <= 0 {
+		return nil
+	}
+	now := time.Now()
+	free := m.free[info.Sender]
+	if free.Before(now) {
+		free = now
+	}
+	transmit := time.Duration(float64(size) / m.uplink * float64(time.Second))
+	delays := make([]time.Duration, len(to))
+	for i := range to {
+		free = free.Add(transmit)
+		delays[i] = free.Sub(now)
+	}
+	m.free[info.Sender] = free
+	return delays
+}
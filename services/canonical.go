@@ -0,0 +1,27 @@
+package services
+
+import (
+	"crypto/sha256"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// canonicalMode encodes with the RFC 8949 core deterministic rules: shortest
+// integer forms, definite lengths and map keys sorted bytewise. Any
+// implementation following the RFC produces the same bytes for the same value.
+var canonicalMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+// CanonicalBytes returns the canonical serialization of v. It must be used
+// for every value that is hashed or signed, never JSON or fmt output.
+func CanonicalBytes(v any) ([]byte, error) {
+	return canonicalMode.Marshal(v)
+}
+
+// CanonicalHash returns the SHA-256 of the canonical serialization of v.
+func CanonicalHash(v any) ([32]byte, error) {
+	b, err := CanonicalBytes(v)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
@@ -1,20 +1,48 @@
 package services
 
 import (
+	"sort"
 	"sync"
+	"time"
 )
 
+// FaultEvidence records why a pair {i, j} was marked as faulty.
+type FaultEvidence struct {
+	Pair       [2]int
+	InstanceID string // IVSS instance in which the inconsistency was observed
+	Reason     string
+}
+
+// MaxCoreInvocations bounds the history of core invocations. The oldest are
+// forgotten first, with their consumed and spare marks.
+const MaxCoreInvocations = 4096
+
 // CertificationProtocol maintains the set of Faulty Pairs (FP) and CoreInvocations.
 type CertificationProtocol struct {
-	fp              map[[2]int]bool // Set of faulty pairs {i, j}
-	coreInvocations []string        // List of successful IVSS instance IDs
+	fp              map[[2]int]time.Time // Set of faulty pairs {i, j} -> time recorded
+	coreInvocations []string             // List of successful IVSS instance IDs, oldest first
+	inHistory       map[string]bool      // The IDs of coreInvocations
+	consumed        map[string]bool      // Core invocations whose secret was used (reconstructed or handed out)
+	spare           map[string]bool      // Core invocations no node reconstructs, see MarkInvocationSpare
+	strays          []string             // Marked IDs not in the history yet, oldest first, see mark
+	evidence        []FaultEvidence      // Why each faulty pair was recorded
+	suspects        map[int]string       // Processes suspected of misbehavior -> reason
+	subscribers     map[int]chan CertificationEvent
+	nextSubscriber  int
+	metrics         *Metrics // Optional, receives cert.* gauges
 	mu              sync.RWMutex
 }
 
 func NewCertificationProtocol() *CertificationProtocol {
 	return &CertificationProtocol{
-		fp:              make(map[[2]int]bool),
+		fp:              make(map[[2]int]time.Time),
 		coreInvocations: make([]string, 0),
+		inHistory:       make(map[string]bool),
+		consumed:        make(map[string]bool),
+		spare:           make(map[string]bool),
+		evidence:        make([]FaultEvidence, 0),
+		suspects:        make(map[int]string),
+		subscribers:     make(map[int]chan CertificationEvent),
 	}
 }
 
@@ -27,7 +55,36 @@ func (cp *CertificationProtocol) AddFaultyPair(i, j int) {
 	if i > j {
 		i, j = j, i
 	}
-	cp.fp[[2]int{i, j}] = true
+	cp.addPair([2]int{i, j}, nil)
+}
+
+// AddFaultyPairWithEvidence adds {i, j} to the set of faulty pairs and keeps
+// a record of the instance and reason that led to it.
+func (cp *CertificationProtocol) AddFaultyPairWithEvidence(i, j int, instanceID, reason string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if i > j {
+		i, j = j, i
+	}
+	pair := [2]int{i, j}
+	ev := FaultEvidence{
+		Pair:       pair,
+		InstanceID: instanceID,
+		Reason:     reason,
+	}
+	cp.evidence = append(cp.evidence, ev)
+	cp.addPair(pair, &ev)
+}
+
+// addPair records a new ordered pair. Assumes cp.mu is locked.
+func (cp *CertificationProtocol) addPair(pair [2]int, ev *FaultEvidence) {
+	if _, ok := cp.fp[pair]; ok {
+		return
+	}
+	cp.fp[pair] = time.Now()
+	cp.publish(CertificationEvent{Type: CertEvent_FaultyPair, Pair: pair, Evidence: ev})
+	cp.updateMetrics()
 }
 
 // IsFaultyPair checks if {i, j} is in the set of faulty pairs.
@@ -38,14 +95,108 @@ func (cp *CertificationProtocol) IsFaultyPair(i, j int) bool {
 	if i > j {
 		i, j = j, i
 	}
-	return cp.fp[[2]int{i, j}]
+	_, ok := cp.fp[[2]int{i, j}]
+	return ok
+}
+
+// IsCertifiedFaulty reports whether process j is known to be faulty from the
+// point of view of process self: since self knows it is correct, any faulty
+// pair {self, j} certifies that j is Byzantine.
+func (cp *CertificationProtocol) IsCertifiedFaulty(self, j int) bool {
+	if cp == nil || self == j {
+		return false
+	}
+	return cp.IsFaultyPair(self, j)
+}
+
+// CertifiedFaulty returns the sorted list of processes certified faulty by self.
+func (cp *CertificationProtocol) CertifiedFaulty(self int) []int {
+	if cp == nil {
+		return nil
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	result := make([]int, 0)
+	for pair := range cp.fp {
+		if pair[0] == self && pair[1] != self {
+			result = append(result, pair[1])
+		} else if pair[1] == self && pair[0] != self {
+			result = append(result, pair[0])
+		}
+	}
+	sort.Ints(result)
+	return result
 }
 
-// AddCoreInvocation adds an instance ID to the history.
+// AddSuspect records that process j misbehaved in a way that does not yet
+// certify it as faulty (e.g. an invalid payload). Only the first reason is kept.
+func (cp *CertificationProtocol) AddSuspect(j int, reason string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if _, ok := cp.suspects[j]; ok {
+		return
+	}
+	cp.suspects[j] = reason
+	cp.publish(CertificationEvent{Type: CertEvent_Suspect, Node: j, Reason: reason})
+	cp.updateMetrics()
+}
+
+// IsSuspect checks if process j has been recorded as suspect.
+func (cp *CertificationProtocol) IsSuspect(j int) bool {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	_, ok := cp.suspects[j]
+	return ok
+}
+
+// AddCoreInvocation adds an instance ID to the history, forgetting the
+// oldest beyond MaxCoreInvocations.
 func (cp *CertificationProtocol) AddCoreInvocation(instanceID string) {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
+	cp.addInvocation(instanceID)
+	cp.updateMetrics()
+}
+
+// addInvocation appends instanceID to the history unless it is there.
+// Assumes cp.mu is locked.
+func (cp *CertificationProtocol) addInvocation(instanceID string) {
+	if cp.inHistory[instanceID] {
+		return
+	}
 	cp.coreInvocations = append(cp.coreInvocations, instanceID)
+	cp.inHistory[instanceID] = true
+	for len(cp.coreInvocations) > MaxCoreInvocations {
+		oldest := cp.coreInvocations[0]
+		cp.coreInvocations = cp.coreInvocations[1:]
+		delete(cp.inHistory, oldest)
+		delete(cp.consumed, oldest)
+		delete(cp.spare, oldest)
+	}
+}
+
+// mark sets instanceID in marks. IDs outside the history, e.g. of a
+// sharing that completes here later, are kept as strays, the oldest
+// MaxCoreInvocations of them. Assumes cp.mu is locked.
+func (cp *CertificationProtocol) mark(marks map[string]bool, instanceID string) {
+	if marks[instanceID] {
+		return
+	}
+	marks[instanceID] = true
+	if cp.inHistory[instanceID] {
+		return
+	}
+	cp.strays = append(cp.strays, instanceID)
+	for len(cp.strays) > MaxCoreInvocations {
+		oldest := cp.strays[0]
+		cp.strays = cp.strays[1:]
+		if !cp.inHistory[oldest] {
+			delete(cp.consumed, oldest)
+			delete(cp.spare, oldest)
+		}
+	}
 }
 
 // GetCoreInvocations returns a copy of the history.
@@ -58,3 +209,173 @@ func (cp *CertificationProtocol) GetCoreInvocations() []string {
 	copy(result, cp.coreInvocations)
 	return result
 }
+
+// MarkInvocationConsumed records that the secret of a core invocation has been
+// used, e.g. because its reconstruction started. A consumed secret is public
+// (or about to be) and must never be handed out for reuse.
+func (cp *CertificationProtocol) MarkInvocationConsumed(instanceID string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.mark(cp.consumed, instanceID)
+	cp.updateMetrics()
+}
+
+// MarkInvocationSpare records that no correct node will ever reconstruct
+// the secret of a core invocation, e.g. ICC's secret j of a dealer left out
+// of T_j, so the dealer may hand it out again, see NextReusableInvocation.
+func (cp *CertificationProtocol) MarkInvocationSpare(instanceID string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.mark(cp.spare, instanceID)
+}
+
+// NextReusableInvocation returns the oldest spare core invocation of
+// dealer, from round minRound on (see IVSSID), whose secret has not been
+// consumed yet, and marks it as consumed. This lets ICC amortize completed
+// sharings across rounds instead of dealing fresh secrets. Only the
+// dealer's own sharings are handed out: a node knows nothing of the secrets
+// of the others.
+func (cp *CertificationProtocol) NextReusableInvocation(dealer, minRound int) (string, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	for _, id := range cp.coreInvocations {
+		if !cp.spare[id] || cp.consumed[id] {
+			continue
+		}
+		if parsed, err := ParseIVSSID(id); err != nil || parsed.Dealer != dealer || parsed.Round < minRound {
+			continue
+		}
+		cp.consumed[id] = true
+		cp.updateMetrics()
+		return id, true
+	}
+	return "", false
+}
+
+// GetEvidence returns a copy of the recorded fault evidence.
+func (cp *CertificationProtocol) GetEvidence() []FaultEvidence {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	result := make([]FaultEvidence, len(cp.evidence))
+	copy(result, cp.evidence)
+	return result
+}
+
+// State returns a snapshot of the protocol state.
+// Faulty pairs are sorted so that snapshots are comparable.
+func (cp *CertificationProtocol) State() CertificationState {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	pairs := make([][2]int, 0, len(cp.fp))
+	for pair := range cp.fp {
+		pairs = append(pairs, pair)
+	}
+	sortPairs(pairs)
+	addedAt := make([]time.Time, len(pairs))
+	for k, pair := range pairs {
+		addedAt[k] = cp.fp[pair]
+	}
+
+	invocations := make([]string, len(cp.coreInvocations))
+	copy(invocations, cp.coreInvocations)
+
+	consumed := make([]string, 0, len(cp.consumed))
+	for id := range cp.consumed {
+		consumed = append(consumed, id)
+	}
+	sort.Strings(consumed)
+	spare := make([]string, 0, len(cp.spare))
+	for id := range cp.spare {
+		spare = append(spare, id)
+	}
+	sort.Strings(spare)
+
+	evidence := make([]FaultEvidence, len(cp.evidence))
+	copy(evidence, cp.evidence)
+
+	suspects := make(map[int]string, len(cp.suspects))
+	for j, reason := range cp.suspects {
+		suspects[j] = reason
+	}
+
+	return CertificationState{
+		FaultyPairs:         pairs,
+		PairsAddedAt:        addedAt,
+		CoreInvocations:     invocations,
+		ConsumedInvocations: consumed,
+		SpareInvocations:    spare,
+		Evidence:            evidence,
+		Suspects:            suspects,
+	}
+}
+
+// Restore merges a previously saved state into the protocol.
+// FP is monotonic, so pairs already known are kept.
+// Restored entries are not published to subscribers.
+func (cp *CertificationProtocol) Restore(state CertificationState) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	now := time.Now()
+	for k, pair := range state.FaultyPairs {
+		i, j := pair[0], pair[1]
+		if i > j {
+			i, j = j, i
+		}
+		if _, ok := cp.fp[[2]int{i, j}]; ok {
+			continue
+		}
+		addedAt := now
+		if k < len(state.PairsAddedAt) && !state.PairsAddedAt[k].IsZero() {
+			addedAt = state.PairsAddedAt[k]
+		}
+		cp.fp[[2]int{i, j}] = addedAt
+	}
+
+	for _, id := range state.CoreInvocations {
+		cp.addInvocation(id)
+	}
+	for _, id := range state.ConsumedInvocations {
+		cp.mark(cp.consumed, id)
+	}
+	for _, id := range state.SpareInvocations {
+		cp.mark(cp.spare, id)
+	}
+
+	for j, reason := range state.Suspects {
+		if _, ok := cp.suspects[j]; !ok {
+			cp.suspects[j] = reason
+		}
+	}
+
+	seen := make(map[FaultEvidence]bool, len(cp.evidence))
+	for _, ev := range cp.evidence {
+		seen[ev] = true
+	}
+	for _, ev := range state.Evidence {
+		if !seen[ev] {
+			seen[ev] = true
+			cp.evidence = append(cp.evidence, ev)
+		}
+	}
+
+	cp.updateMetrics()
+}
+
+// Save writes the current state to the given store.
+func (cp *CertificationProtocol) Save(store CertificationStore) error {
+	return store.SaveCertification(cp.State())
+}
+
+// Load reads a state from the given store and merges it into the protocol.
+func (cp *CertificationProtocol) Load(store CertificationStore) error {
+	state, err := store.LoadCertification()
+	if err != nil {
+		return err
+	}
+	cp.Restore(state)
+	return nil
+}
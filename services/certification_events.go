@@ -0,0 +1,67 @@
+package services
+
+// CertificationEventType distinguishes the kinds of certification events
+type CertificationEventType int
+
+const (
+	CertEvent_FaultyPair CertificationEventType = iota
+	CertEvent_Suspect
+)
+
+func (t CertificationEventType) String() string {
+	switch t {
+	case CertEvent_FaultyPair:
+		return "FAULTY_PAIR"
+	case CertEvent_Suspect:
+		return "SUSPECT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// CertificationEvent is published whenever new certification knowledge is recorded.
+type CertificationEvent struct {
+	Type     CertificationEventType
+	Pair     [2]int         // For FaultyPair
+	Evidence *FaultEvidence `json:",omitempty"` // For FaultyPair, if recorded with evidence
+	Node     int            // For Suspect
+	Reason   string         // For Suspect
+}
+
+// subscriberBuffer is the capacity of every subscription channel.
+const subscriberBuffer = 256
+
+// Subscribe returns a channel receiving every new faulty pair and suspect,
+// and a function that cancels the subscription and closes the channel.
+// Events are delivered without blocking the protocol: if a subscriber falls
+// more than subscriberBuffer events behind, further events are dropped for it.
+func (cp *CertificationProtocol) Subscribe() (<-chan CertificationEvent, func()) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	id := cp.nextSubscriber
+	cp.nextSubscriber++
+	ch := make(chan CertificationEvent, subscriberBuffer)
+	cp.subscribers[id] = ch
+
+	cancel := func() {
+		cp.mu.Lock()
+		defer cp.mu.Unlock()
+		if c, ok := cp.subscribers[id]; ok {
+			delete(cp.subscribers, id)
+			close(c)
+		}
+	}
+	return ch, cancel
+}
+
+// publish sends an event to all subscribers. Assumes cp.mu is locked.
+func (cp *CertificationProtocol) publish(ev CertificationEvent) {
+	for _, ch := range cp.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Slow subscriber, drop the event rather than block the protocol
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CertificationExportVersion is the current version of the export format.
+const CertificationExportVersion = 1
+
+// CertificationExport is the portable representation of the certification
+// state of several nodes, keyed by node ID. It allows repeated experiments
+// against the same adversary set to start with accumulated knowledge.
+type CertificationExport struct {
+	Version int
+	Nodes   map[int]CertificationState
+}
+
+// ExportCertification writes the states of the given nodes as indented JSON.
+func ExportCertification(w io.Writer, states map[int]CertificationState) error {
+	export := CertificationExport{
+		Version: CertificationExportVersion,
+		Nodes:   states,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+// ImportCertification reads states previously written by ExportCertification.
+func ImportCertification(r io.Reader) (map[int]CertificationState, error) {
+	var export CertificationExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	if export.Version != CertificationExportVersion {
+		return nil, fmt.Errorf("unsupported certification export version %d (expected %d)", export.Version, CertificationExportVersion)
+	}
+	if export.Nodes == nil {
+		export.Nodes = make(map[int]CertificationState)
+	}
+	return export.Nodes, nil
+}
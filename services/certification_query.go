@@ -0,0 +1,120 @@
+package services
+
+import (
+	"sort"
+	"time"
+)
+
+// Metric names exported by CertificationProtocol
+const (
+	MetricCertFaultyPairs         = "cert.faulty_pairs"
+	MetricCertSuspects            = "cert.suspects"
+	MetricCertCoreInvocations     = "cert.core_invocations"
+	MetricCertConsumedInvocations = "cert.consumed_invocations"
+)
+
+// CertificationCounts summarizes the size of the certification state.
+type CertificationCounts struct {
+	FaultyPairs         int
+	Suspects            int
+	CoreInvocations     int
+	ConsumedInvocations int
+}
+
+// FaultyPairRecord is a faulty pair together with the time it was recorded.
+type FaultyPairRecord struct {
+	Pair    [2]int
+	AddedAt time.Time
+}
+
+// AttachMetrics makes the protocol keep the cert.* gauges of m up to date.
+func (cp *CertificationProtocol) AttachMetrics(m *Metrics) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.metrics = m
+	cp.updateMetrics()
+}
+
+// updateMetrics refreshes the attached gauges. Assumes cp.mu is locked.
+func (cp *CertificationProtocol) updateMetrics() {
+	if cp.metrics == nil {
+		return
+	}
+	cp.metrics.Set(MetricCertFaultyPairs, int64(len(cp.fp)))
+	cp.metrics.Set(MetricCertSuspects, int64(len(cp.suspects)))
+	cp.metrics.Set(MetricCertCoreInvocations, int64(len(cp.coreInvocations)))
+	cp.metrics.Set(MetricCertConsumedInvocations, int64(len(cp.consumed)))
+}
+
+// Counts returns the current size of each part of the state.
+func (cp *CertificationProtocol) Counts() CertificationCounts {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	return CertificationCounts{
+		FaultyPairs:         len(cp.fp),
+		Suspects:            len(cp.suspects),
+		CoreInvocations:     len(cp.coreInvocations),
+		ConsumedInvocations: len(cp.consumed),
+	}
+}
+
+// PairsInvolving returns the sorted faulty pairs that contain process i.
+func (cp *CertificationProtocol) PairsInvolving(i int) [][2]int {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	result := make([][2]int, 0)
+	for pair := range cp.fp {
+		if pair[0] == i || pair[1] == i {
+			result = append(result, pair)
+		}
+	}
+	sortPairs(result)
+	return result
+}
+
+// PairsSince returns the faulty pairs recorded at or after since, oldest first.
+func (cp *CertificationProtocol) PairsSince(since time.Time) []FaultyPairRecord {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	result := make([]FaultyPairRecord, 0)
+	for pair, addedAt := range cp.fp {
+		if !addedAt.Before(since) {
+			result = append(result, FaultyPairRecord{Pair: pair, AddedAt: addedAt})
+		}
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if !result[a].AddedAt.Equal(result[b].AddedAt) {
+			return result[a].AddedAt.Before(result[b].AddedAt)
+		}
+		return pairLess(result[a].Pair, result[b].Pair)
+	})
+	return result
+}
+
+// Suspects returns the suspected processes and the reason each was recorded.
+func (cp *CertificationProtocol) Suspects() map[int]string {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	result := make(map[int]string, len(cp.suspects))
+	for j, reason := range cp.suspects {
+		result[j] = reason
+	}
+	return result
+}
+
+func pairLess(a, b [2]int) bool {
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+	return a[1] < b[1]
+}
+
+func sortPairs(pairs [][2]int) {
+	sort.Slice(pairs, func(a, b int) bool {
+		return pairLess(pairs[a], pairs[b])
+	})
+}
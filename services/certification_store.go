@@ -0,0 +1,95 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificationState is the persistable part of a CertificationProtocol.
+type CertificationState struct {
+	FaultyPairs         [][2]int
+	PairsAddedAt        []time.Time `json:",omitempty"` // PairsAddedAt[k] is when FaultyPairs[k] was recorded
+	CoreInvocations     []string
+	ConsumedInvocations []string
+	SpareInvocations    []string `json:",omitempty"`
+	Evidence            []FaultEvidence
+	Suspects            map[int]string `json:",omitempty"`
+}
+
+// CertificationStore persists CertificationProtocol state so a recovering
+// node does not forget faulty pairs it already detected.
+type CertificationStore interface {
+	SaveCertification(state CertificationState) error
+	LoadCertification() (CertificationState, error)
+}
+
+// MemoryCertificationStore keeps the state in memory.
+// Useful for tests and for restarting services inside one process.
+type MemoryCertificationStore struct {
+	state CertificationState
+	mu    sync.Mutex
+}
+
+func NewMemoryCertificationStore() *MemoryCertificationStore {
+	return &MemoryCertificationStore{}
+}
+
+func (m *MemoryCertificationStore) SaveCertification(state CertificationState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = state
+	return nil
+}
+
+func (m *MemoryCertificationStore) LoadCertification() (CertificationState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, nil
+}
+
+// FileCertificationStore keeps the state as JSON in a file.
+type FileCertificationStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileCertificationStore(path string) *FileCertificationStore {
+	return &FileCertificationStore{path: path}
+}
+
+func (f *FileCertificationStore) SaveCertification(state CertificationState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated state
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// LoadCertification returns an empty state if the file does not exist yet.
+func (f *FileCertificationStore) LoadCertification() (CertificationState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var state CertificationState
+	b, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(b, &state)
+	return state, err
+}
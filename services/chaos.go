@@ -0,0 +1,321 @@
+package services
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Protocol layers a message can belong to, as reported in MessageInfo.
+const (
+	Layer_ACast = "ACAST"
+	Layer_Vote  = "VOTE"
+	Layer_ICC   = "ICC"
+	Layer_IVSS  = "IVSS"
+	Layer_ABA   = "ABA"
+	Layer_AVID  = "AVID"
+)
+
+// MessageInfo summarizes a message for chaos rules.
+type MessageInfo struct {
+	Layer  string // Innermost protocol the message belongs to
+	Type   string // A-Cast step (MSG, ECHO, READY) or IVSS direct type (SHARE, POINT)
+	Sender int
+	Round  int // ABA round, 0 outside ABA
+}
+
+// MessageFilter selects messages by their MessageInfo. Zero fields match
+// anything, so the zero filter matches every message.
+type MessageFilter struct {
+	Layer  string
+	Type   string
+	Sender int
+	Round  int
+}
+
+func (f MessageFilter) matches(info MessageInfo) bool {
+	return (f.Layer == "" || f.Layer == info.Layer) &&
+		(f.Type == "" || f.Type == info.Type) &&
+		(f.Sender == 0 || f.Sender == info.Sender) &&
+		(f.Round == 0 || f.Round == info.Round)
+}
+
+// ClassifyACastMessage describes a plain A-Cast message.
+func ClassifyACastMessage[T any](msg ACastMessage[T]) MessageInfo {
+	return MessageInfo{Layer: Layer_ACast, Type: msg.Type.String(), Sender: msg.From}
+}
+
+// ClassifyAvidMessage describes an erasure-coded broadcast message.
+func ClassifyAvidMessage(msg AvidMessage) MessageInfo {
+	return MessageInfo{Layer: Layer_AVID, Type: msg.Type.String(), Sender: msg.From}
+}
+
+// ClassifyIVSSMessage describes an IVSS message, direct or A-Cast.
+func ClassifyIVSSMessage(msg IVSSMessage) MessageInfo {
+	if msg.Type == IVSS_ACast {
+		return classifyWrapped(Layer_IVSS, msg.ACastMsg)
+	}
+	info := MessageInfo{Layer: Layer_IVSS, Sender: msg.From}
+	switch msg.DirectType {
+	case Direct_Share:
+		info.Type = "SHARE"
+	case Direct_Point:
+		info.Type = "POINT"
+	case Direct_BatchShare:
+		info.Type = "BATCH_SHARE"
+	case Direct_BatchPoint:
+		info.Type = "BATCH_POINT"
+	case Direct_ShareRequest:
+		info.Type = "SHARE_REQUEST"
+	case Direct_ShareResponse:
+		info.Type = "SHARE_RESPONSE"
+	case Direct_PrivateReveal:
+		info.Type = "PRIVATE_REVEAL"
+	case Direct_Watchdog:
+		info.Type = "WATCHDOG"
+	case Direct_DualShare:
+		info.Type = "DUAL_SHARE"
+	case Direct_DualPoint:
+		info.Type = "DUAL_POINT"
+	default:
+		info.Type = "UNKNOWN"
+	}
+	return info
+}
+
+// ClassifyVoteMessage describes a Vote message.
+func ClassifyVoteMessage(msg VoteMessage) MessageInfo {
+	return classifyWrapped(Layer_Vote, msg.ACastMsg)
+}
+
+// ClassifyICCMessage describes an ICC message, reporting messages of the
+// IVSS instances it runs as IVSS.
+func ClassifyICCMessage(msg ICCMessage) MessageInfo {
+	if msg.Type == ICC_IVSS && msg.IVSSMsg != nil {
+		return ClassifyIVSSMessage(*msg.IVSSMsg)
+	}
+	return classifyWrapped(Layer_ICC, msg.ACastMsg)
+}
+
+// ClassifyABAMessage describes an ABA message by the layer it is routed to.
+// COMPLETE messages belong to the ABA layer itself.
+func ClassifyABAMessage(msg ABAMessage) MessageInfo {
+	var info MessageInfo
+	switch {
+	case msg.Type == ABA_Vote && msg.VoteMsg != nil:
+		info = ClassifyVoteMessage(*msg.VoteMsg)
+	case msg.Type == ABA_ICC && msg.ICCMsg != nil:
+		info = ClassifyICCMessage(*msg.ICCMsg)
+	case msg.Type == ABA_Coin:
+		info = MessageInfo{Layer: Layer_ABA, Type: "COIN"}
+	default:
+		info = classifyWrapped(Layer_ABA, msg.CompleteMsg)
+	}
+	info.Round = msg.Round
+	return info
+}
+
+func classifyWrapped(layer string, msg *ACastMessage[string]) MessageInfo {
+	if msg == nil {
+		return MessageInfo{Layer: layer, Type: "UNKNOWN"}
+	}
+	return MessageInfo{Layer: layer, Type: msg.Type.String(), Sender: msg.From}
+}
+
+type chaosAction int
+
+const (
+	chaosDrop chaosAction = iota
+	chaosDuplicate
+	chaosDelay
+	chaosReorder
+	chaosRewrite
+	chaosLatency
+)
+
+// ChaosRule is one fault injected by a Chaos. The setters return the rule so
+// they can be chained onto the call that created it.
+type ChaosRule[TMsg any] struct {
+	chaos    *Chaos[TMsg]
+	action   chaosAction
+	filter   MessageFilter
+	to       map[int]bool // Receivers the rule applies to, all if empty
+	limit    int          // 0 means unlimited
+	hits     int
+	copies   int
+	delay    time.Duration
+	overtake int
+	rewrite  func(TMsg) TMsg
+	profile  LatencyProfile
+	rng      *rand.Rand // Draws the delays of a latency rule, guarded by chaos.mu
+}
+
+// To restricts the rule to messages delivered to the given nodes.
+func (r *ChaosRule[TMsg]) To(ids ...int) *ChaosRule[TMsg] {
+	r.chaos.mu.Lock()
+	defer r.chaos.mu.Unlock()
+	r.to = make(map[int]bool, len(ids))
+	for _, id := range ids {
+		r.to[id] = true
+	}
+	return r
+}
+
+// Times disables the rule after it has been applied k times.
+func (r *ChaosRule[TMsg]) Times(k int) *ChaosRule[TMsg] {
+	r.chaos.mu.Lock()
+	defer r.chaos.mu.Unlock()
+	r.limit = k
+	return r
+}
+
+// Hits returns how many deliveries the rule has been applied to.
+func (r *ChaosRule[TMsg]) Hits() int {
+	r.chaos.mu.Lock()
+	defer r.chaos.mu.Unlock()
+	return r.hits
+}
+
+func (r *ChaosRule[TMsg]) applies(info MessageInfo, to int) bool {
+	if r.limit > 0 && r.hits >= r.limit {
+		return false
+	}
+	if len(r.to) > 0 && !r.to[to] {
+		return false
+	}
+	return r.filter.matches(info)
+}
+
+// Chaos injects faults into the deliveries of a Network. Every message is
+// checked once per receiver against the rules in the order they were added.
+// Rewrites apply and pass the message on to the following rules; the first
+// applicable drop, duplicate, delay, latency or reorder rule decides its fate.
+type Chaos[TMsg any] struct {
+	classify func(TMsg) MessageInfo
+	rules    []*ChaosRule[TMsg]
+	held     map[int][]heldMsg[TMsg] // Reordered messages per receiver
+	mu       sync.Mutex
+}
+
+type heldMsg[TMsg any] struct {
+	msg       TMsg
+	remaining int
+}
+
+// chaosDelivery is one copy of a message to hand to a receiver.
+type chaosDelivery[TMsg any] struct {
+	msg   TMsg
+	delay time.Duration
+}
+
+// NewChaos creates an empty rule set for messages described by classify,
+// e.g. ClassifyABAMessage. Attach it with Network.SetChaos.
+func NewChaos[TMsg any](classify func(TMsg) MessageInfo) *Chaos[TMsg] {
+	return &Chaos[TMsg]{
+		classify: classify,
+		held:     make(map[int][]heldMsg[TMsg]),
+	}
+}
+
+func (c *Chaos[TMsg]) add(r *ChaosRule[TMsg]) *ChaosRule[TMsg] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r.chaos = c
+	c.rules = append(c.rules, r)
+	return r
+}
+
+// Drop discards matching messages.
+func (c *Chaos[TMsg]) Drop(f MessageFilter) *ChaosRule[TMsg] {
+	return c.add(&ChaosRule[TMsg]{action: chaosDrop, filter: f})
+}
+
+// Duplicate delivers copies extra copies of matching messages.
+func (c *Chaos[TMsg]) Duplicate(f MessageFilter, copies int) *ChaosRule[TMsg] {
+	return c.add(&ChaosRule[TMsg]{action: chaosDuplicate, filter: f, copies: copies})
+}
+
+// Delay holds matching messages back for d.
+func (c *Chaos[TMsg]) Delay(f MessageFilter, d time.Duration) *ChaosRule[TMsg] {
+	return c.add(&ChaosRule[TMsg]{action: chaosDelay, filter: f, delay: d})
+}
+
+// Reorder holds a matching message back until the next overtake messages to
+// the same receiver have been delivered. Messages still held when traffic
+// stops are delivered by Network.FlushChaos.
+func (c *Chaos[TMsg]) Reorder(f MessageFilter, overtake int) *ChaosRule[TMsg] {
+	return c.add(&ChaosRule[TMsg]{action: chaosReorder, filter: f, overtake: overtake})
+}
+
+// Rewrite replaces matching messages with fn(msg), which later rules still
+// see. fn is called once per receiver and must return a new message rather
+// than modify msg, which is shared by all receivers.
+func (c *Chaos[TMsg]) Rewrite(f MessageFilter, fn func(TMsg) TMsg) *ChaosRule[TMsg] {
+	return c.add(&ChaosRule[TMsg]{action: chaosRewrite, filter: f, rewrite: fn})
+}
+
+// Latency delays each matching delivery by a sample of profile, drawn from a
+// PRNG seeded with seed.
+func (c *Chaos[TMsg]) Latency(f MessageFilter, profile LatencyProfile, seed int64) *ChaosRule[TMsg] {
+	return c.add(&ChaosRule[TMsg]{action: chaosLatency, filter: f, profile: profile, rng: rand.New(rand.NewSource(seed))})
+}
+
+// plan returns what is actually delivered to node to in place of msg.
+func (c *Chaos[TMsg]) plan(msg TMsg, to int) []chaosDelivery[TMsg] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Messages held for this receiver are overtaken by this one
+	var released []chaosDelivery[TMsg]
+	kept := c.held[to][:0]
+	for _, h := range c.held[to] {
+		h.remaining--
+		if h.remaining <= 0 {
+			released = append(released, chaosDelivery[TMsg]{msg: h.msg})
+		} else {
+			kept = append(kept, h)
+		}
+	}
+	c.held[to] = kept
+
+	info := c.classify(msg)
+	for _, r := range c.rules {
+		if !r.applies(info, to) {
+			continue
+		}
+		r.hits++
+		var out []chaosDelivery[TMsg]
+		switch r.action {
+		case chaosRewrite:
+			msg = r.rewrite(msg)
+			continue
+		case chaosDrop:
+		case chaosDuplicate:
+			for i := 0; i <= r.copies; i++ {
+				out = append(out, chaosDelivery[TMsg]{msg: msg})
+			}
+		case chaosDelay:
+			out = append(out, chaosDelivery[TMsg]{msg: msg, delay: r.delay})
+		case chaosLatency:
+			out = append(out, chaosDelivery[TMsg]{msg: msg, delay: r.profile.Sample(r.rng)})
+		case chaosReorder:
+			c.held[to] = append(c.held[to], heldMsg[TMsg]{msg: msg, remaining: r.overtake})
+		}
+		return append(out, released...)
+	}
+	return append([]chaosDelivery[TMsg]{{msg: msg}}, released...)
+}
+
+// flush removes and returns all held messages per receiver.
+func (c *Chaos[TMsg]) flush() map[int][]TMsg {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[int][]TMsg)
+	for to, held := range c.held {
+		for _, h := range held {
+			out[to] = append(out[to], h.msg)
+		}
+	}
+	c.held = make(map[int][]heldMsg[TMsg])
+	return out
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+)
+
+// Chunk frame layout (big-endian):
+//
+//	magic(1) | message ID(8) | index(4) | total(4) | crc32(4) | data
+//
+// Each chunk carries the CRC-32 (IEEE) of its own data, so a corrupted chunk
+// is rejected on its own instead of producing a corrupted message.
+const (
+	chunkMagic      byte = 0xAC
+	chunkHeaderSize      = 1 + 8 + 4 + 4 + 4
+
+	// DefaultMaxPendingMessages bounds how many messages (partial or recently
+	// completed) a reassembler tracks before evicting the oldest.
+	DefaultMaxPendingMessages = 1024
+	// MaxChunksPerMessage bounds the chunk count a frame may announce.
+	MaxChunksPerMessage = 1 << 16
+)
+
+var ErrChunkChecksum = errors.New("chunk checksum mismatch")
+
+// SplitFrames splits data into chunk frames of at most maxFrame bytes each,
+// headers included. Data that already fits is still wrapped in one chunk so
+// the receiver can treat every frame the same way.
+func SplitFrames(data []byte, maxFrame int) ([][]byte, error) {
+	payload := maxFrame - chunkHeaderSize
+	if payload <= 0 {
+		return nil, fmt.Errorf("frame size %d is smaller than the chunk header", maxFrame)
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	total := (len(data) + payload - 1) / payload
+	if total == 0 {
+		total = 1
+	}
+	if total > MaxChunksPerMessage {
+		return nil, fmt.Errorf("message of %d bytes needs %d chunks (max %d)", len(data), total, MaxChunksPerMessage)
+	}
+	frames := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*payload, len(data))
+		part := data[i*payload : end]
+
+		frame := make([]byte, chunkHeaderSize+len(part))
+		frame[0] = chunkMagic
+		copy(frame[1:9], id[:])
+		binary.BigEndian.PutUint32(frame[9:13], uint32(i))
+		binary.BigEndian.PutUint32(frame[13:17], uint32(total))
+		binary.BigEndian.PutUint32(frame[17:21], crc32.ChecksumIEEE(part))
+		copy(frame[chunkHeaderSize:], part)
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+type partialMessage struct {
+	parts    [][]byte
+	received int
+	done     bool // Kept as a tombstone so late duplicates are ignored
+}
+
+// ChunkReassembler collects chunk frames and returns the original data once
+// every chunk of a message has arrived, in any order. Safe for concurrent use.
+type ChunkReassembler struct {
+	pending    map[[8]byte]*partialMessage
+	order      [][8]byte // Arrival order of tracked messages, for eviction
+	maxPending int
+	mu         sync.Mutex
+}
+
+func NewChunkReassembler(maxPending int) *ChunkReassembler {
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPendingMessages
+	}
+	return &ChunkReassembler{
+		pending:    make(map[[8]byte]*partialMessage),
+		maxPending: maxPending,
+	}
+}
+
+// Add consumes one frame. It returns the reassembled data and true when the
+// frame completed its message.
+func (r *ChunkReassembler) Add(frame []byte) ([]byte, bool, error) {
+	if len(frame) < chunkHeaderSize || frame[0] != chunkMagic {
+		return nil, false, ErrEnvelopeMalformed
+	}
+	var id [8]byte
+	copy(id[:], frame[1:9])
+	index := binary.BigEndian.Uint32(frame[9:13])
+	total := binary.BigEndian.Uint32(frame[13:17])
+	sum := binary.BigEndian.Uint32(frame[17:21])
+	data := frame[chunkHeaderSize:]
+
+	if total == 0 || total > MaxChunksPerMessage || index >= total {
+		return nil, false, fmt.Errorf("%w: chunk %d of %d", ErrEnvelopeMalformed, index, total)
+	}
+	if crc32.ChecksumIEEE(data) != sum {
+		return nil, false, fmt.Errorf("%w: chunk %d of %d", ErrChunkChecksum, index, total)
+	}
+	if total == 1 {
+		return data, true, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.pending[id]
+	if !ok {
+		msg = &partialMessage{parts: make([][]byte, total)}
+		r.pending[id] = msg
+		r.order = append(r.order, id)
+		r.evict()
+	}
+	if msg.done {
+		return nil, false, nil
+	}
+	if int(total) != len(msg.parts) {
+		return nil, false, fmt.Errorf("%w: inconsistent chunk count", ErrEnvelopeMalformed)
+	}
+	if msg.parts[index] == nil {
+		msg.parts[index] = append([]byte{}, data...)
+		msg.received++
+	}
+	if msg.received < len(msg.parts) {
+		return nil, false, nil
+	}
+
+	size := 0
+	for _, p := range msg.parts {
+		size += len(p)
+	}
+	out := make([]byte, 0, size)
+	for _, p := range msg.parts {
+		out = append(out, p...)
+	}
+	msg.parts = nil
+	msg.done = true
+	return out, true, nil
+}
+
+// Pending returns the number of partially received messages.
+func (r *ChunkReassembler) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, msg := range r.pending {
+		if !msg.done {
+			count++
+		}
+	}
+	return count
+}
+
+// evict drops the oldest tracked messages above the limit. Assumes r.mu is locked.
+func (r *ChunkReassembler) evict() {
+	for len(r.order) > r.maxPending {
+		delete(r.pending, r.order[0])
+		r.order = r.order[1:]
+	}
+}
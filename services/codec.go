@@ -0,0 +1,178 @@
+package services
+
+import (
+	"async-agreement-protocol-3/wire"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Codec serializes messages at the transport boundary. Services never see
+// encoded bytes, so any codec can be swapped in without touching them.
+type Codec[TMsg any] interface {
+	Name() string
+	Marshal(msg TMsg) ([]byte, error)
+	Unmarshal(data []byte) (TMsg, error)
+}
+
+// JSONCodec encodes any message with encoding/json.
+type JSONCodec[TMsg any] struct{}
+
+func (JSONCodec[TMsg]) Name() string { return "json" }
+
+func (JSONCodec[TMsg]) Marshal(msg TMsg) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (JSONCodec[TMsg]) Unmarshal(data []byte) (TMsg, error) {
+	var msg TMsg
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// CBORCodec encodes any message with the generic CBOR struct mapping.
+// For ABA messages ABACBORCodec is more compact.
+type CBORCodec[TMsg any] struct{}
+
+func (CBORCodec[TMsg]) Name() string { return "cbor" }
+
+func (CBORCodec[TMsg]) Marshal(msg TMsg) ([]byte, error) {
+	return cbor.Marshal(msg)
+}
+
+func (CBORCodec[TMsg]) Unmarshal(data []byte) (TMsg, error) {
+	var msg TMsg
+	err := cbor.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// ABAProtoCodec encodes ABA messages with the protobuf wire schema.
+type ABAProtoCodec struct{}
+
+func (ABAProtoCodec) Name() string { return "proto" }
+
+func (ABAProtoCodec) Marshal(msg ABAMessage) ([]byte, error) {
+	return MarshalABAMessageProto(msg)
+}
+
+func (ABAProtoCodec) Unmarshal(data []byte) (ABAMessage, error) {
+	return UnmarshalABAMessageProto(data)
+}
+
+// ACastProtoCodec encodes standalone A-Cast messages with the protobuf wire
+// schema. Their values are sent raw, as no enclosing layer gives them a type.
+type ACastProtoCodec struct{}
+
+func (ACastProtoCodec) Name() string { return "proto" }
+
+func (ACastProtoCodec) Marshal(msg ACastMessage[string]) ([]byte, error) {
+	return marshalProto(msg, func(m *ACastMessage[string]) (*wire.ACastMessage, error) {
+		return acastToProto(m, layer_Raw), nil
+	})
+}
+
+func (ACastProtoCodec) Unmarshal(data []byte) (ACastMessage[string], error) {
+	return unmarshalProto(data, &wire.ACastMessage{}, func(pb *wire.ACastMessage) (*ACastMessage[string], error) {
+		return acastFromProto(pb), nil
+	})
+}
+
+// VoteProtoCodec encodes Vote messages with the protobuf wire schema.
+type VoteProtoCodec struct{}
+
+func (VoteProtoCodec) Name() string { return "proto" }
+
+func (VoteProtoCodec) Marshal(msg VoteMessage) ([]byte, error) {
+	return marshalProto(msg, func(m *VoteMessage) (*wire.VoteMessage, error) {
+		return voteMessageToProto(m), nil
+	})
+}
+
+func (VoteProtoCodec) Unmarshal(data []byte) (VoteMessage, error) {
+	return unmarshalProto(data, &wire.VoteMessage{}, func(pb *wire.VoteMessage) (*VoteMessage, error) {
+		return voteMessageFromProto(pb), nil
+	})
+}
+
+// IVSSProtoCodec encodes IVSS messages with the protobuf wire schema.
+type IVSSProtoCodec struct{}
+
+func (IVSSProtoCodec) Name() string { return "proto" }
+
+func (IVSSProtoCodec) Marshal(msg IVSSMessage) ([]byte, error) {
+	return marshalProto(msg, ivssMessageToProto)
+}
+
+func (IVSSProtoCodec) Unmarshal(data []byte) (IVSSMessage, error) {
+	return unmarshalProto(data, &wire.IVSSMessage{}, ivssMessageFromProto)
+}
+
+// ICCProtoCodec encodes ICC messages with the protobuf wire schema.
+type ICCProtoCodec struct{}
+
+func (ICCProtoCodec) Name() string { return "proto" }
+
+func (ICCProtoCodec) Marshal(msg ICCMessage) ([]byte, error) {
+	return marshalProto(msg, iccMessageToProto)
+}
+
+func (ICCProtoCodec) Unmarshal(data []byte) (ICCMessage, error) {
+	return unmarshalProto(data, &wire.ICCMessage{}, iccMessageFromProto)
+}
+
+// ABACBORCodec encodes ABA messages with structured CBOR payloads.
+type ABACBORCodec struct{}
+
+func (ABACBORCodec) Name() string { return "cbor" }
+
+func (ABACBORCodec) Marshal(msg ABAMessage) ([]byte, error) {
+	return MarshalABAMessageCBOR(msg)
+}
+
+func (ABACBORCodec) Unmarshal(data []byte) (ABAMessage, error) {
+	return UnmarshalABAMessageCBOR(data)
+}
+
+// ABACodec returns the ABA message codec for a wire format.
+func ABACodec(format WireFormat) Codec[ABAMessage] {
+	switch format {
+	case Wire_Proto:
+		return ABAProtoCodec{}
+	case Wire_CBOR:
+		return ABACBORCodec{}
+	default:
+		return JSONCodec[ABAMessage]{}
+	}
+}
+
+// layerCodec returns proto for Wire_Proto and the generic codecs otherwise.
+func layerCodec[TMsg any](format WireFormat, proto Codec[TMsg]) Codec[TMsg] {
+	switch format {
+	case Wire_Proto:
+		return proto
+	case Wire_CBOR:
+		return CBORCodec[TMsg]{}
+	default:
+		return JSONCodec[TMsg]{}
+	}
+}
+
+// ACastCodec returns the A-Cast message codec for a wire format.
+func ACastCodec(format WireFormat) Codec[ACastMessage[string]] {
+	return layerCodec[ACastMessage[string]](format, ACastProtoCodec{})
+}
+
+// VoteCodec returns the Vote message codec for a wire format.
+func VoteCodec(format WireFormat) Codec[VoteMessage] {
+	return layerCodec[VoteMessage](format, VoteProtoCodec{})
+}
+
+// IVSSCodec returns the IVSS message codec for a wire format.
+func IVSSCodec(format WireFormat) Codec[IVSSMessage] {
+	return layerCodec[IVSSMessage](format, IVSSProtoCodec{})
+}
+
+// ICCCodec returns the ICC message codec for a wire format.
+func ICCCodec(format WireFormat) Codec[ICCMessage] {
+	return layerCodec[ICCMessage](format, ICCProtoCodec{})
+}
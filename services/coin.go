@@ -0,0 +1,122 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/big"
+)
+
+// CommonCoin is a source of the coin ABA takes its estimate from in rounds
+// whose vote gives no majority. Flip starts the coin of round and returns a
+// channel that yields it, 0 or 1, once; the channel is closed without a
+// value if the coin fails. ABA decides with probability 1 as long as the
+// coins of correct nodes agree with constant probability and the adversary
+// cannot learn a coin before its round's vote is fixed.
+//
+// ICC is the coin ABA flips when NodeContext.Coin is nil. It runs over
+// ABA's own messages, so it is wired in by ABAService rather than being a
+// CommonCoin value; LocalCoin and DealerCoin stand in for it, e.g. to
+// benchmark the rest of ABA.
+type CommonCoin interface {
+	Flip(round int) <-chan int
+}
+
+// LocalCoin flips an independent coin at every node, as in Ben-Or's
+// protocol. Nodes agree only with probability 2^-(n-1) per round, so ABA
+// takes exponentially many rounds in n to decide on split inputs.
+type LocalCoin struct {
+	rand io.Reader
+}
+
+// NewLocalCoin returns a local coin drawing from r, or from crypto/rand if
+// r is nil.
+func NewLocalCoin(r io.Reader) *LocalCoin {
+	if r == nil {
+		r = rand.Reader
+	}
+	return &LocalCoin{rand: r}
+}
+
+func (c *LocalCoin) Flip(round int) <-chan int {
+	ch := make(chan int, 1)
+	bit, err := rand.Int(c.rand, big.NewInt(2))
+	if err == nil {
+		ch <- int(bit.Int64())
+	}
+	close(ch)
+	return ch
+}
+
+// DealerCoin is the coin of a trusted dealer who handed every node the same
+// seed: the coin of round r is a bit of HMAC-SHA256(seed, r). Nodes always
+// agree, but the coin is only unpredictable to an adversary without the
+// seed, so it suits tests and benchmarks, not deployments.
+type DealerCoin struct {
+	seed []byte
+}
+
+// NewDealerCoin returns the coin of seed, which all nodes must share.
+func NewDealerCoin(seed []byte) *DealerCoin {
+	return &DealerCoin{seed: append([]byte(nil), seed...)}
+}
+
+func (c *DealerCoin) Flip(round int) <-chan int {
+	mac := hmac.New(sha256.New, c.seed)
+	binary.Write(mac, binary.BigEndian, int64(round))
+	ch := make(chan int, 1)
+	ch <- int(mac.Sum(nil)[0] & 1)
+	close(ch)
+	return ch
+}
+
+// flipCoin flips the NodeContext.Coin of round r. A coin that already
+// landed is taken at once. Otherwise the node sends itself an ABA_Coin once
+// it lands: results may only be sent while handling a message, so the coin
+// wakes the service through its inbox, like the IVSS watchdog, and the
+// value waits in flips where a forged ABA_Coin cannot set it.
+func (s *ABAService) flipCoin(r int, ctx ServiceContext[ABAMessage, int]) {
+	// Assumes lock is held
+	ch := s.nc.Coin.Flip(r)
+	select {
+	case coin, ok := <-ch:
+		if s.landed(r, coin, ok) {
+			s.onCoin(r, ctx)
+		}
+	default:
+		go func() {
+			coin, ok := <-ch
+			s.mu.Lock()
+			landed := s.landed(r, coin, ok)
+			s.mu.Unlock()
+			if landed {
+				ctx.SendTo(s.id, ABAMessage{Type: ABA_Coin, Round: r})
+			}
+		}()
+	}
+}
+
+// landed records the coin of round r, and reports whether there is one.
+func (s *ABAService) landed(r, coin int, ok bool) bool {
+	// Assumes lock is held
+	if !ok || !validBit(coin) {
+		s.logger.Error().Int("round", r).Int("coin", coin).Msg("Coin failed")
+		return false
+	}
+	s.flips[r] = coin
+	return true
+}
+
+// onCoin takes the coin of the current round once it landed.
+func (s *ABAService) onCoin(r int, ctx ServiceContext[ABAMessage, int]) {
+	// Assumes lock is held
+	coin, ok := s.flips[r]
+	if !ok || r != s.round || s.iccResult != nil {
+		return
+	}
+	delete(s.flips, r)
+	s.iccResult = &ICCResult{Coin: coin}
+	s.checkRoundProgress(ctx)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"sync"
+)
+
+// CoinAudit records how a node computed the ICC coin of a round, with every
+// input, so the coin can be recomputed offline: the (H, S) pair it took, the
+// secrets y_{k,j} it reconstructed for the nodes j of H and the values v_j
+// they gave. Comparing the audits of all nodes of a round shows why they
+// disagreed, and the audits of many rounds the realized coin distribution.
+type CoinAudit struct {
+	Node  int `json:"node"`
+	Round int `json:"round"`
+
+	// The parameters of the coin, see ICCConfig
+	U         int `json:"u"`
+	CoinRange int `json:"coin_range"`
+
+	// The node whose (H, S) pair the coin was computed on
+	From int   `json:"from"`
+	H    []int `json:"h"`
+	S    []int `json:"s"`
+
+	Secrets []CoinSecret `json:"secrets"` // Sorted by dealer, then secret
+	Values  []CoinValue  `json:"values"`  // v_j of the nodes j of H, in order
+	Coin    int          `json:"coin"`
+	Faulty  []int        `json:"faulty,omitempty"` // See ICCResult.Faulty
+}
+
+// CoinSecret is the secret y_{k,j} dealer k shared for node j.
+type CoinSecret struct {
+	Dealer int      `json:"dealer"`
+	Index  int      `json:"index"`
+	Value  *big.Int `json:"value"`
+}
+
+// CoinValue is the value v_j = sum of y_{k,j} for k in T_j, mod U.
+type CoinValue struct {
+	Node  int      `json:"node"`
+	T     []int    `json:"t"`
+	Sum   *big.Int `json:"sum"`
+	Value *big.Int `json:"value"`
+}
+
+// ExpectedZero returns the probability that a binary coin computed on a
+// set H of this size is 0, 1-(1-1/U)^|H|, assuming v_j is uniform.
+func (a CoinAudit) ExpectedZero() float64 {
+	return 1 - math.Pow(1-1/float64(a.U), float64(len(a.H)))
+}
+
+// CoinAuditHook receives the audit of every ICC coin a node outputs,
+// synchronously and while the coin holds its lock, so it must not call back
+// into the services. Set NodeContext.CoinAudits before creating them.
+type CoinAuditHook func(CoinAudit)
+
+func (h CoinAuditHook) emit(a CoinAudit) {
+	if h != nil {
+		h(a)
+	}
+}
+
+// CoinAuditLog collects coin audits, e.g. to export them for offline
+// analysis.
+type CoinAuditLog struct {
+	audits []CoinAudit
+	mu     sync.Mutex
+}
+
+func NewCoinAuditLog() *CoinAuditLog {
+	return &CoinAuditLog{}
+}
+
+// Record stores a. It can be used as a CoinAuditHook.
+func (l *CoinAuditLog) Record(a CoinAudit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.audits = append(l.audits, a)
+}
+
+// Audits returns a copy of the recorded audits in arrival order.
+func (l *CoinAuditLog) Audits() []CoinAudit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]CoinAudit(nil), l.audits...)
+}
+
+// Frequencies returns how often each coin value was output.
+func (l *CoinAuditLog) Frequencies() map[int]int {
+	freq := make(map[int]int)
+	for _, a := range l.Audits() {
+		freq[a.Coin]++
+	}
+	return freq
+}
+
+// WriteJSON writes the recorded audits as JSON lines.
+func (l *CoinAuditLog) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, a := range l.Audits() {
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// audit returns the audit of the coin computed on the (H, S) pair of from,
+// whose values v_j are all known.
+func (s *ICCService) audit(from int, H, S []int, values map[int]*big.Int, coin int, faulty []int) CoinAudit {
+	a := CoinAudit{
+		Node:      s.id,
+		Round:     s.round,
+		U:         s.u,
+		CoinRange: s.k,
+		From:      from,
+		H:         append([]int(nil), H...),
+		S:         append([]int(nil), S...),
+		Coin:      coin,
+		Faulty:    faulty,
+	}
+	dealt := make(map[int]map[int]bool)
+	for _, j := range H {
+		value := CoinValue{Node: j, T: append([]int(nil), s.receivedT[j]...), Sum: new(big.Int), Value: values[j]}
+		for _, k := range value.T {
+			value.Sum.Add(value.Sum, s.reconstructedValues[k][j])
+			if dealt[k] == nil {
+				dealt[k] = make(map[int]bool)
+			}
+			dealt[k][j] = true
+		}
+		a.Values = append(a.Values, value)
+	}
+	for k := 1; k <= s.n; k++ {
+		for j := 1; j <= s.n; j++ {
+			if dealt[k][j] {
+				a.Secrets = append(a.Secrets, CoinSecret{Dealer: k, Index: j, Value: new(big.Int).Set(s.reconstructedValues[k][j])})
+			}
+		}
+	}
+	return a
+}
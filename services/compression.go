@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how CompressedCodec compresses large payloads.
+type Compression int
+
+const (
+	Compression_None   Compression = iota // Payloads are sent as encoded
+	Compression_Snappy                    // Fast, moderate ratio
+	Compression_Zstd                      // Slower, better ratio
+)
+
+const (
+	// DefaultCompressionThreshold is the encoded size from which payloads
+	// are compressed; smaller ones rarely shrink enough to pay off.
+	DefaultCompressionThreshold = 1024
+	// MaxDecompressedSize bounds what one payload may decompress to.
+	MaxDecompressedSize = 64 << 20
+)
+
+var ErrDecompressedTooLarge = errors.New("decompressed payload too large")
+
+func (c Compression) String() string {
+	switch c {
+	case Compression_None:
+		return "none"
+	case Compression_Snappy:
+		return "snappy"
+	case Compression_Zstd:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseCompression returns the compression with the given name.
+func ParseCompression(name string) (Compression, error) {
+	for _, c := range []Compression{Compression_None, Compression_Snappy, Compression_Zstd} {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown compression %q", name)
+}
+
+// CompressedCodec wraps a Codec and compresses every payload of at least
+// Threshold bytes. Each payload starts with a byte naming its compression,
+// so the receiver needs no configuration and small messages stay as they
+// are. Large A-Cast values are echoed by every node, which is where this
+// saves most.
+type CompressedCodec[TMsg any] struct {
+	Codec       Codec[TMsg]
+	Compression Compression
+	Threshold   int
+}
+
+// NewCompressedCodec compresses the payloads of codec from threshold bytes
+// on, or from DefaultCompressionThreshold if threshold is not positive.
+func NewCompressedCodec[TMsg any](codec Codec[TMsg], compression Compression, threshold int) CompressedCodec[TMsg] {
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	return CompressedCodec[TMsg]{Codec: codec, Compression: compression, Threshold: threshold}
+}
+
+func (c CompressedCodec[TMsg]) Name() string {
+	return c.Codec.Name() + "+" + c.Compression.String()
+}
+
+func (c CompressedCodec[TMsg]) Marshal(msg TMsg) ([]byte, error) {
+	data, err := c.Codec.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < c.Threshold {
+		return compressPayload(Compression_None, data), nil
+	}
+	return compressPayload(c.Compression, data), nil
+}
+
+func (c CompressedCodec[TMsg]) Unmarshal(data []byte) (TMsg, error) {
+	raw, err := decompressPayload(data)
+	if err != nil {
+		var zero TMsg
+		return zero, err
+	}
+	return c.Codec.Unmarshal(raw)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// zstdCoders returns the shared zstd encoder and decoder, which are safe
+// for concurrent EncodeAll and DecodeAll calls.
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+// compressPayload prefixes data, compressed with c, with the byte naming c.
+func compressPayload(c Compression, data []byte) []byte {
+	out := []byte{byte(c)}
+	switch c {
+	case Compression_Snappy:
+		return append(out, snappy.Encode(nil, data)...)
+	case Compression_Zstd:
+		enc, _ := zstdCoders()
+		return enc.EncodeAll(data, out)
+	default:
+		return append(out, data...)
+	}
+}
+
+// decompressPayload reverses compressPayload.
+func decompressPayload(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty compressed payload")
+	}
+	body := data[1:]
+	switch Compression(data[0]) {
+	case Compression_None:
+		return body, nil
+	case Compression_Snappy:
+		size, err := snappy.DecodedLen(body)
+		if err != nil {
+			return nil, err
+		}
+		if size > MaxDecompressedSize {
+			return nil, ErrDecompressedTooLarge
+		}
+		return snappy.Decode(nil, body)
+	case Compression_Zstd:
+		_, dec := zstdCoders()
+		raw, err := dec.DecodeAll(body, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, ErrDecompressedTooLarge
+		}
+		return raw, err
+	default:
+		return nil, fmt.Errorf("unknown compression %d", data[0])
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// StateTransition is one step of a protocol instance at one node, reduced to
+// the abstract state a formal model (TLA+, P) reasons about: the phase before
+// and after the step and the quorum counts it was taken on.
+type StateTransition struct {
+	Node     int            `json:"node"`
+	Layer    string         `json:"layer"`    // Layer_ACast, Layer_Vote, ...
+	Instance string         `json:"instance"` // A-Cast UUID, IVSS instance or "round-<r>"
+	Action   string         `json:"action"`   // e.g. RECV_ECHO, SEND_READY, FINISH
+	From     string         `json:"from"`
+	To       string         `json:"to"` // Equal to From when only a count changed
+	Counts   map[string]int `json:"counts,omitempty"`
+}
+
+func (tr StateTransition) String() string {
+	return fmt.Sprintf("node %d %s %s: %s --%s--> %s %v", tr.Node, tr.Layer, tr.Instance, tr.From, tr.Action, tr.To, tr.Counts)
+}
+
+// TransitionHook receives the state transitions of every service of a node,
+// synchronously and while the service holds its lock, so it must not call
+// back into the services. Set NodeContext.Transitions before creating them.
+type TransitionHook func(StateTransition)
+
+func (h TransitionHook) emit(tr StateTransition) {
+	if h != nil {
+		h(tr)
+	}
+}
+
+func roundInstance(round int) string {
+	return fmt.Sprintf("round-%d", round)
+}
+
+// TransitionRecorder collects transitions, e.g. to export them for offline
+// trace validation against a model.
+type TransitionRecorder struct {
+	transitions []StateTransition
+	mu          sync.Mutex
+}
+
+func NewTransitionRecorder() *TransitionRecorder {
+	return &TransitionRecorder{}
+}
+
+// Record stores tr. It can be used as a TransitionHook.
+func (r *TransitionRecorder) Record(tr StateTransition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitions = append(r.transitions, tr)
+}
+
+// Transitions returns a copy of the recorded transitions in arrival order.
+func (r *TransitionRecorder) Transitions() []StateTransition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StateTransition(nil), r.transitions...)
+}
+
+// WriteJSON writes the recorded transitions as JSON lines.
+func (r *TransitionRecorder) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, tr := range r.Transitions() {
+		if err := enc.Encode(tr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransitionRule allows Action to move an instance from From to To. Guard,
+// if set, checks the quorum counts of the step for a cluster of n nodes
+// tolerating t faults.
+type TransitionRule struct {
+	Action string
+	From   string
+	To     string
+	Guard  func(n, t int, counts map[string]int) error
+}
+
+// TransitionModel is the set of transitions a model allows for one layer.
+// Instances start in Initial.
+type TransitionModel struct {
+	Layer   string
+	Initial string
+	Rules   []TransitionRule
+}
+
+// check returns an error unless some rule allows tr.
+func (m *TransitionModel) check(n, t int, tr StateTransition) error {
+	var guardErr error
+	for _, rule := range m.Rules {
+		if rule.Action != tr.Action || rule.From != tr.From || rule.To != tr.To {
+			continue
+		}
+		if rule.Guard == nil {
+			return nil
+		}
+		if guardErr = rule.Guard(n, t, tr.Counts); guardErr == nil {
+			return nil
+		}
+	}
+	if guardErr != nil {
+		return guardErr
+	}
+	return fmt.Errorf("%s from %s to %s is not allowed", tr.Action, tr.From, tr.To)
+}
+
+// ConformanceViolation is a transition the model does not allow. Trace holds
+// the transitions of the same instance at the same node, ending with it.
+type ConformanceViolation struct {
+	Transition StateTransition
+	Reason     string
+	Trace      []StateTransition
+}
+
+func (v *ConformanceViolation) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s does not conform: %s", v.Transition, v.Reason)
+	for _, tr := range v.Trace {
+		fmt.Fprintf(&sb, "\n  %v", tr)
+	}
+	return sb.String()
+}
+
+type conformanceKey struct {
+	node     int
+	instance string
+}
+
+// ConformanceChecker checks the transitions of one layer against a model:
+// each step must be allowed by a rule and start in the phase the previous
+// step of the same instance ended in. Transitions of other layers are
+// ignored. It is safe for concurrent use.
+type ConformanceChecker struct {
+	model     *TransitionModel
+	n, t      int
+	phases    map[conformanceKey]string
+	history   map[conformanceKey][]StateTransition
+	violation *ConformanceViolation
+	mu        sync.Mutex
+}
+
+func NewConformanceChecker(model *TransitionModel, n, t int) *ConformanceChecker {
+	return &ConformanceChecker{
+		model:   model,
+		n:       n,
+		t:       t,
+		phases:  make(map[conformanceKey]string),
+		history: make(map[conformanceKey][]StateTransition),
+	}
+}
+
+// Record checks tr and keeps the first violation. It can be used as a
+// TransitionHook.
+func (c *ConformanceChecker) Record(tr StateTransition) {
+	if tr.Layer != c.model.Layer {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.violation != nil {
+		return
+	}
+
+	key := conformanceKey{node: tr.Node, instance: tr.Instance}
+	c.history[key] = append(c.history[key], tr)
+	phase, ok := c.phases[key]
+	if !ok {
+		phase = c.model.Initial
+	}
+
+	var reason string
+	if tr.From != phase {
+		reason = fmt.Sprintf("instance is in %s", phase)
+	} else if err := c.model.check(c.n, c.t, tr); err != nil {
+		reason = err.Error()
+	}
+	if reason != "" {
+		c.violation = &ConformanceViolation{
+			Transition: tr,
+			Reason:     reason,
+			Trace:      append([]StateTransition(nil), c.history[key]...),
+		}
+		return
+	}
+	c.phases[key] = tr.To
+}
+
+// Err returns the first violation, or nil.
+func (c *ConformanceChecker) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.violation == nil {
+		return nil
+	}
+	return c.violation
+}
+
+// Hooks combines several hooks into one.
+func Hooks(hooks ...TransitionHook) TransitionHook {
+	return func(tr StateTransition) {
+		for _, h := range hooks {
+			h(tr)
+		}
+	}
+}
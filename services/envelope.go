@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Envelope layout: magic, protocol version, codec ID, layer tag, body.
+// The header is fixed so that any node can read it before knowing the codec.
+const (
+	envelopeMagic      byte = 0xAB
+	envelopeHeaderSize      = 4
+
+	// WireVersion is the protocol version written by this node.
+	WireVersion = 1
+	// MinWireVersion is the oldest version this node still accepts.
+	MinWireVersion = 1
+)
+
+var (
+	ErrEnvelopeMalformed = errors.New("malformed envelope")
+	ErrWireVersion       = errors.New("unsupported wire version")
+	ErrWireFormat        = errors.New("unsupported wire format")
+	ErrWireLayer         = errors.New("envelope layer does not match message")
+)
+
+// EnvelopeHeader describes how an enveloped message was encoded.
+type EnvelopeHeader struct {
+	Version int
+	Format  WireFormat
+	Layer   ABAMsgType
+}
+
+// SealABAMessage encodes msg in the given format and wraps it in an envelope.
+func SealABAMessage(format WireFormat, msg ABAMessage) ([]byte, error) {
+	body, err := EncodeABAMessage(format, msg)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(body))
+	data[0] = envelopeMagic
+	data[1] = WireVersion
+	data[2] = byte(format)
+	data[3] = byte(msg.Type)
+	return append(data, body...), nil
+}
+
+// ReadEnvelopeHeader parses the envelope header without decoding the body.
+func ReadEnvelopeHeader(data []byte) (EnvelopeHeader, error) {
+	if len(data) < envelopeHeaderSize || data[0] != envelopeMagic {
+		return EnvelopeHeader{}, ErrEnvelopeMalformed
+	}
+	return EnvelopeHeader{
+		Version: int(data[1]),
+		Format:  WireFormat(data[2]),
+		Layer:   ABAMsgType(data[3]),
+	}, nil
+}
+
+// OpenABAMessage checks the envelope header and decodes the body.
+// accept lists the formats this node is willing to decode; nil accepts all
+// known formats. Messages from newer or too old versions are rejected so the
+// caller can drop them instead of misinterpreting the body.
+func OpenABAMessage(data []byte, accept []WireFormat) (ABAMessage, EnvelopeHeader, error) {
+	header, err := ReadEnvelopeHeader(data)
+	if err != nil {
+		return ABAMessage{}, header, err
+	}
+	if header.Version < MinWireVersion || header.Version > WireVersion {
+		return ABAMessage{}, header, fmt.Errorf("%w: %d (accepting %d..%d)", ErrWireVersion, header.Version, MinWireVersion, WireVersion)
+	}
+	if !acceptsFormat(accept, header.Format) {
+		return ABAMessage{}, header, fmt.Errorf("%w: %s", ErrWireFormat, header.Format)
+	}
+
+	msg, err := DecodeABAMessage(header.Format, data[envelopeHeaderSize:])
+	if err != nil {
+		return ABAMessage{}, header, err
+	}
+	if msg.Type != header.Layer {
+		return ABAMessage{}, header, fmt.Errorf("%w: header %d, body %d", ErrWireLayer, header.Layer, msg.Type)
+	}
+	return msg, header, nil
+}
+
+// NegotiateWireFormat picks the first format in local (ordered by preference)
+// that remote also supports. Every node understands JSON, so it is the
+// fallback when there is no better common format.
+func NegotiateWireFormat(local, remote []WireFormat) WireFormat {
+	for _, f := range local {
+		if acceptsFormat(remote, f) {
+			return f
+		}
+	}
+	return Wire_JSON
+}
+
+func acceptsFormat(accept []WireFormat, format WireFormat) bool {
+	if accept == nil {
+		return format >= Wire_JSON && format <= Wire_CBOR
+	}
+	for _, f := range accept {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package services
+
+import "sync"
+
+// ProtocolEventType distinguishes the protocol milestones a node publishes
+type ProtocolEventType int
+
+const (
+	Event_ACastDelivered ProtocolEventType = iota
+	Event_IVSSDealt
+	Event_IVSSShared
+	Event_IVSSReconstructed
+	Event_ABAStarted
+	Event_ABADecided
+)
+
+func (t ProtocolEventType) String() string {
+	switch t {
+	case Event_ACastDelivered:
+		return "ACAST_DELIVERED"
+	case Event_IVSSDealt:
+		return "IVSS_DEALT"
+	case Event_IVSSShared:
+		return "IVSS_SHARED"
+	case Event_IVSSReconstructed:
+		return "IVSS_RECONSTRUCTED"
+	case Event_ABAStarted:
+		return "ABA_STARTED"
+	case Event_ABADecided:
+		return "ABA_DECIDED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ProtocolEvent is published by a node whenever it passes a milestone.
+type ProtocolEvent struct {
+	Node     int
+	Type     ProtocolEventType
+	Instance string // A-Cast UUID or IVSS instance, empty for ABA
+	Value    string // Delivered value, secret, input or decision
+}
+
+// eventBuffer is the capacity of every event subscription channel.
+const eventBuffer = 4096
+
+// EventBus fans the protocol events of one node out to subscribers. All
+// methods are safe on a nil receiver, like Metrics.
+type EventBus struct {
+	subscribers    map[int]chan ProtocolEvent
+	nextSubscriber int
+	mu             sync.Mutex
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]chan ProtocolEvent),
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// and a function that cancels the subscription and closes the channel.
+// Like CertificationProtocol.Subscribe it never blocks the protocol: events
+// are dropped for a subscriber that falls eventBuffer events behind.
+func (b *EventBus) Subscribe() (<-chan ProtocolEvent, func()) {
+	if b == nil {
+		ch := make(chan ProtocolEvent)
+		close(ch)
+		return ch, func() {}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextSubscriber
+	b.nextSubscriber++
+	ch := make(chan ProtocolEvent, eventBuffer)
+	b.subscribers[id] = ch
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if c, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(c)
+		}
+	}
+	return ch, cancel
+}
+
+// Publish sends ev to all subscribers.
+func (b *EventBus) Publish(ev ProtocolEvent) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Slow subscriber, drop the event rather than block the protocol
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// LinkFaults are the faults of one link: each delivery is lost with
+// probability Drop and, if not, delivered twice with probability Duplicate.
+type LinkFaults struct {
+	Drop      float64
+	Duplicate float64
+}
+
+// FaultModel assigns faults to every link of a Network, looked up like the
+// distributions of a LatencyModel: Links for {from, to}, {0, to} and
+// {from, 0}, then Default. Faults are drawn from one PRNG seeded with Seed.
+//
+// The protocols assume reliable channels, so they are only guaranteed to
+// survive loss on the links of up to t nodes, or with retransmission layered
+// on top; duplicates they must always tolerate.
+type FaultModel struct {
+	Default LinkFaults
+	Links   map[Link]LinkFaults
+	Seed    int64
+}
+
+// linkFaults draws the faults of a FaultModel for a Network.
+type linkFaults struct {
+	model      FaultModel
+	rng        *rand.Rand
+	dropped    atomic.Uint64
+	duplicated atomic.Uint64
+	mu         sync.Mutex
+}
+
+func newLinkFaults(model FaultModel) *linkFaults {
+	return &linkFaults{model: model, rng: rand.New(rand.NewSource(model.Seed))}
+}
+
+// copies returns how many times to deliver a message from -> to.
+func (l *linkFaults) copies(from, to int) int {
+	faults, ok := lookupLink(l.model.Links, from, to)
+	if !ok {
+		faults = l.model.Default
+	}
+	if faults.Drop <= 0 && faults.Duplicate <= 0 {
+		return 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rng.Float64() < faults.Drop {
+		l.dropped.Add(1)
+		return 0
+	}
+	if l.rng.Float64() < faults.Duplicate {
+		l.duplicated.Add(1)
+		return 2
+	}
+	return 1
+}
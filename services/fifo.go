@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// FifoValue is the Seq-th value Origin broadcast through a
+// FifoACastService. It is both the A-Cast value and the delivered result.
+type FifoValue[T comparable] struct {
+	Origin int
+	Seq    int // Starts at 0
+	Val    T
+}
+
+// fifoTag is the instance tag of the seq-th broadcast of an origin.
+func fifoTag(seq int) string {
+	return fmt.Sprintf("fifo-%d", seq)
+}
+
+// FifoACastService is a FIFO reliable broadcast on top of A-Cast: values of
+// one origin are delivered in the order the origin broadcast them. Every
+// broadcast is a tagged A-Cast instance identified by (origin, seq), so an
+// origin gets one value per sequence number, and a value that arrives
+// before its predecessors is held back until they are delivered. A gap
+// left by a faulty origin therefore blocks its later values, but never
+// those of other origins.
+type FifoACastService[T comparable] struct {
+	id     int
+	acast  *AcastService[FifoValue[T]]
+	logger zerolog.Logger
+
+	next     int                          // Seq of our next broadcast
+	expected map[int]int                  // Origin -> Seq to deliver next
+	held     map[int]map[int]FifoValue[T] // Origin -> Seq -> delivered out of order
+	mu       sync.Mutex
+}
+
+// NewFifoACastServiceWithContext creates a FifoACastService using the shared state of a node.
+func NewFifoACastServiceWithContext[T comparable](nc *NodeContext) *FifoACastService[T] {
+	logger := log.With().
+		Str("layer", "FIFO").
+		Int("node_id", nc.ID).
+		Logger().
+		Level(nc.LogLevel)
+
+	return &FifoACastService[T]{
+		id:       nc.ID,
+		acast:    NewAcastServiceWithContext[FifoValue[T]](nc),
+		logger:   logger,
+		expected: make(map[int]int),
+		held:     make(map[int]map[int]FifoValue[T]),
+	}
+}
+
+// Broadcast starts the next broadcast of this node with value val.
+func (f *FifoACastService[T]) Broadcast(val T, ctx ServiceContext[ACastMessage[FifoValue[T]], FifoValue[T]]) {
+	f.mu.Lock()
+	seq := f.next
+	f.next++
+	f.mu.Unlock()
+
+	f.logger.Debug().Int("seq", seq).Msg("Starting FIFO broadcast")
+	ctx.Broadcast(NewTaggedACastMessage(FifoValue[T]{Origin: f.id, Seq: seq, Val: val}, f.id, fifoTag(seq)))
+}
+
+func (f *FifoACastService[T]) OnMessage(msg ACastMessage[FifoValue[T]], ctx ServiceContext[ACastMessage[FifoValue[T]], FifoValue[T]]) {
+	// The value must name the instance it travels in, or a faulty origin
+	// could fill another sequence number than the one it was echoed for
+	if (msg.Type == MSG || msg.Type == SIGNED_MSG) && (msg.Val.Origin != msg.From || msg.Tag != fifoTag(msg.Val.Seq)) {
+		f.logger.Warn().Str("uuid", msg.UUID).Int("from", msg.From).Msg("FIFO value does not match its instance, ignoring")
+		return
+	}
+
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	f.acast.OnMessage(msg, &fifoAcastAdapter[T]{ServiceContext: results, fifo: f})
+}
+
+// fifoAcastAdapter passes A-Cast deliveries through the FIFO ordering.
+type fifoAcastAdapter[T comparable] struct {
+	ServiceContext[ACastMessage[FifoValue[T]], FifoValue[T]]
+	fifo *FifoACastService[T]
+}
+
+func (a *fifoAcastAdapter[T]) SendResult(res FifoValue[T]) {
+	a.fifo.deliver(res, a.ServiceContext)
+}
+
+// deliver passes on res and every held value of its origin that follows it.
+func (f *FifoACastService[T]) deliver(res FifoValue[T], ctx ServiceContext[ACastMessage[FifoValue[T]], FifoValue[T]]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if res.Seq < f.expected[res.Origin] {
+		return
+	}
+	if f.held[res.Origin] == nil {
+		f.held[res.Origin] = make(map[int]FifoValue[T])
+	}
+	f.held[res.Origin][res.Seq] = res
+
+	for {
+		next, ok := f.held[res.Origin][f.expected[res.Origin]]
+		if !ok {
+			break
+		}
+		delete(f.held[res.Origin], next.Seq)
+		f.expected[res.Origin]++
+		ctx.SendResult(next)
+	}
+	if held := len(f.held[res.Origin]); held > 0 {
+		f.logger.Debug().Int("origin", res.Origin).Int("held", held).Int("expected", f.expected[res.Origin]).Msg("Holding back values until their predecessors are delivered")
+	}
+}
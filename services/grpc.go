@@ -0,0 +1,383 @@
+package services
+
+import (
+	"async-agreement-protocol-3/wire"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	grpcMinBackoff = 50 * time.Millisecond
+	grpcMaxBackoff = 2 * time.Second
+)
+
+// GRPCNetwork is a Transport over gRPC, for nodes embedded in services that
+// already speak gRPC. Every node serves the Peer service of the wire package
+// on its address in the peer table and opens one Deliver stream to each peer
+// it sends to. Messages are encoded with a Codec and sent as Frames.
+//
+// Like TCPNetwork, the receiver acknowledges frames once they are in the
+// inbox and the sender keeps them queued until then, reopening the stream
+// with backoff whenever it fails. Frames whose acknowledgement was lost are
+// sent again, so a peer may receive a message twice.
+type GRPCNetwork[TMsg any] struct {
+	wire.UnimplementedPeerServer
+
+	self     int
+	addrs    map[int]string
+	codec    Codec[TMsg]
+	maxFrame int
+	tls      *tls.Config
+
+	inbox   chan TMsg
+	server  *grpc.Server
+	peers   map[int]*outbox
+	clients []*grpc.ClientConn
+
+	ctx    context.Context // Canceled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// NewGRPCNetwork creates the transport of node self. addrs maps every node
+// ID, self included, to its host:port. Connections are plaintext unless
+// SetTLS is called.
+func NewGRPCNetwork[TMsg any](self int, addrs map[int]string, codec Codec[TMsg]) *GRPCNetwork[TMsg] {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &GRPCNetwork[TMsg]{
+		self:     self,
+		addrs:    make(map[int]string, len(addrs)),
+		codec:    codec,
+		maxFrame: DefaultTCPMaxFrame,
+		peers:    make(map[int]*outbox),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for id, addr := range addrs {
+		n.addrs[id] = addr
+	}
+	return n
+}
+
+// SetTLS secures the connections with cfg, used both to serve and to dial
+// peers. For mutual TLS it needs the certificate of this node, the CA of the
+// peers in RootCAs and ClientCAs, and ClientAuth set. Call it before Listen
+// and before sending.
+func (n *GRPCNetwork[TMsg]) SetTLS(cfg *tls.Config) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.tls = cfg
+}
+
+// SetMaxFrameSize limits the frames accepted from peers to size bytes. Call
+// it before Listen.
+func (n *GRPCNetwork[TMsg]) SetMaxFrameSize(size int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.maxFrame = size
+}
+
+// Listen serves peers on the address of this node.
+func (n *GRPCNetwork[TMsg]) Listen() error {
+	l, err := net.Listen("tcp", n.addrs[n.self])
+	if err != nil {
+		return err
+	}
+	n.Serve(l)
+	return nil
+}
+
+// Serve serves peers on l, e.g. a listener on port 0 whose address was put
+// in the peer tables of the other nodes.
+func (n *GRPCNetwork[TMsg]) Serve(l net.Listener) {
+	n.mu.Lock()
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(n.maxFrame)}
+	if n.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(n.tls)))
+	}
+	server := grpc.NewServer(opts...)
+	wire.RegisterPeerServer(server, n)
+	n.server = server
+	n.mu.Unlock()
+
+	if !n.spawn(func() { server.Serve(l) }) {
+		l.Close()
+	}
+}
+
+// Register sets the inbox of this node; call it before Listen, as messages
+// arriving earlier are dropped. A GRPCNetwork carries the messages of one
+// node, so id must be the ID it was created for.
+func (n *GRPCNetwork[TMsg]) Register(id int, ch chan TMsg) {
+	if id != n.self {
+		log.Error().Str("layer", "NETWORK").Int("node", n.self).Int("id", id).Msg("gRPC network cannot register another node, ignoring")
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.inbox = ch
+}
+
+func (n *GRPCNetwork[TMsg]) Broadcast(msg TMsg) {
+	frame, ok := n.encode(msg)
+	if !ok {
+		return
+	}
+	for id := range n.addrs {
+		n.sendFrame(id, frame)
+	}
+}
+
+// Send delivers msg only to node to. Messages to IDs missing from the peer
+// table are dropped.
+func (n *GRPCNetwork[TMsg]) Send(to int, msg TMsg) {
+	if _, ok := n.addrs[to]; !ok {
+		return
+	}
+	if frame, ok := n.encode(msg); ok {
+		n.sendFrame(to, frame)
+	}
+}
+
+// Close stops the server, drops the queued messages and closes every
+// connection.
+func (n *GRPCNetwork[TMsg]) Close() error {
+	n.cancel()
+	n.mu.Lock()
+	server := n.server
+	clients := n.clients
+	n.mu.Unlock()
+	if server != nil {
+		server.Stop()
+	}
+	var err error
+	for _, cc := range clients {
+		err = errors.Join(err, cc.Close())
+	}
+	n.wg.Wait()
+	return err
+}
+
+// Deliver implements wire.PeerServer: it puts the frames of a peer into the
+// inbox and acknowledges each one.
+func (n *GRPCNetwork[TMsg]) Deliver(stream wire.Peer_DeliverServer) error {
+	var received uint64
+	for {
+		frame, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if !n.deliver(frame.GetPayload()) {
+			return status.Error(codes.Unavailable, "node is shutting down")
+		}
+		received++
+		if err := stream.Send(&wire.Ack{Received: received}); err != nil {
+			return err
+		}
+	}
+}
+
+func (n *GRPCNetwork[TMsg]) encode(msg TMsg) ([]byte, bool) {
+	data, err := n.codec.Marshal(msg)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to encode message, dropping")
+		return nil, false
+	}
+	return data, true
+}
+
+// sendFrame queues frame for node id. Frames to this node skip gRPC, but are
+// still decoded so the inbox gets its own copy, as from any peer.
+func (n *GRPCNetwork[TMsg]) sendFrame(id int, frame []byte) {
+	if id == n.self {
+		n.spawn(func() { n.deliver(frame) })
+		return
+	}
+	if p := n.peer(id); p != nil {
+		p.push(frame)
+	}
+}
+
+// peer returns the link to node id, starting its sender on first use. It
+// returns nil once the network is closed.
+func (n *GRPCNetwork[TMsg]) peer(id int) *outbox {
+	n.mu.Lock()
+	p, ok := n.peers[id]
+	n.mu.Unlock()
+	if ok {
+		return p
+	}
+	p = newOutbox(id, n.addrs[id])
+	n.mu.Lock()
+	if existing, ok := n.peers[id]; ok {
+		n.mu.Unlock()
+		return existing
+	}
+	n.peers[id] = p
+	n.mu.Unlock()
+	if !n.spawn(func() { n.run(p) }) {
+		return nil
+	}
+	return p
+}
+
+// spawn runs fn in a goroutine Close waits for. It returns false, without
+// running fn, once the network is closed.
+func (n *GRPCNetwork[TMsg]) spawn(fn func()) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return false
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// dial creates the client connection to p. gRPC connects lazily and
+// reconnects on its own; run only has to reopen failed streams.
+func (n *GRPCNetwork[TMsg]) dial(p *outbox) (*grpc.ClientConn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return nil, net.ErrClosed
+	}
+	creds := insecure.NewCredentials()
+	if n.tls != nil {
+		creds = credentials.NewTLS(n.tls)
+	}
+	cc, err := grpc.NewClient(p.addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	n.clients = append(n.clients, cc)
+	return cc, nil
+}
+
+// run keeps a Deliver stream to p open while frames are queued for it.
+func (n *GRPCNetwork[TMsg]) run(p *outbox) {
+	cc, err := n.dial(p)
+	if errors.Is(err, net.ErrClosed) {
+		return
+	}
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Err(err).Msg("Invalid peer address, dropping its messages")
+		return
+	}
+	client := wire.NewPeerClient(cc)
+
+	backoff := grpcMinBackoff
+	for {
+		if !p.wait(n.ctx) {
+			return
+		}
+		if n.stream(p, client) {
+			backoff = grpcMinBackoff
+		}
+		p.rewind()
+		if n.ctx.Err() != nil {
+			return
+		}
+		log.Debug().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Dur("retry_in", backoff).Msg("Stream failed, reopening")
+		select {
+		case <-time.After(backoff):
+		case <-n.ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, grpcMaxBackoff)
+	}
+}
+
+// stream sends the queued frames of p over one Deliver stream until it
+// fails. It reports whether the peer acknowledged anything, which resets the
+// backoff.
+func (n *GRPCNetwork[TMsg]) stream(p *outbox, client wire.PeerClient) bool {
+	ctx, cancel := context.WithCancel(n.ctx)
+	defer cancel()
+	stream, err := client.Deliver(ctx)
+	if err != nil {
+		return false
+	}
+
+	var progress bool
+	broken := make(chan struct{})
+	go func() {
+		defer close(broken)
+		defer cancel()
+		var acked uint64
+		for {
+			ack, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if !p.ack(int(ack.GetReceived() - acked)) {
+				log.Warn().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Uint64("ack", ack.GetReceived()).Msg("Invalid acknowledgement, reopening stream")
+				return
+			}
+			acked = ack.GetReceived()
+			progress = true
+		}
+	}()
+
+send:
+	for {
+		if frame, ok := p.next(); ok {
+			if err := stream.Send(&wire.Frame{Payload: frame}); err != nil {
+				break
+			}
+			continue
+		}
+		select {
+		case <-p.wake:
+		case <-broken:
+			break send
+		case <-ctx.Done():
+			break send
+		}
+	}
+	cancel()
+	<-broken
+	return progress
+}
+
+// deliver decodes frame into the inbox. Frames that fail to decode are
+// dropped. It returns false once the network is closed.
+func (n *GRPCNetwork[TMsg]) deliver(frame []byte) bool {
+	msg, err := n.codec.Unmarshal(frame)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to decode message, dropping")
+		return true
+	}
+	n.mu.Lock()
+	inbox := n.inbox
+	n.mu.Unlock()
+	if inbox == nil {
+		log.Warn().Str("layer", "NETWORK").Int("node", n.self).Msg("No inbox registered, dropping message")
+		return true
+	}
+	select {
+	case inbox <- msg:
+		return true
+	case <-n.ctx.Done():
+		return false
+	}
+}
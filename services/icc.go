@@ -1,18 +1,25 @@
 package services
 
 import (
+	"async-agreement-protocol-3/utils"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"math"
+	"io"
 	"math/big"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// iccTag prefixes the tags of the IVSS instances of ICC, see getInstanceID.
+const iccTag = "ICC"
+
 // ICCPayloadType defines the type of data carried in an A-Cast for ICC
 type ICCPayloadType int
 
@@ -21,17 +28,19 @@ const (
 	ICC_Accept
 	ICC_ReconstructEnabled
 	ICC_FinalSets
+	ICC_Deal // The sharing of each slot of a dealer, see NodeContext.ICCReuseDealings
 )
 
 // ICCPayload is the data structure serialized into the A-Cast value string
 type ICCPayload struct {
 	Type ICCPayloadType
 	// Data fields
-	SetT   []int `json:",omitempty"` // For Attach
-	SetA   []int `json:",omitempty"` // For Accept
-	SetH   []int `json:",omitempty"` // For FinalSets
-	SetS   []int `json:",omitempty"` // For FinalSets
-	Sender int   `json:",omitempty"` // Added Sender field
+	SetT   utils.NodeSet `json:",omitempty"` // For Attach
+	SetA   utils.NodeSet `json:",omitempty"` // For Accept
+	SetH   utils.NodeSet `json:",omitempty"` // For FinalSets
+	SetS   utils.NodeSet `json:",omitempty"` // For FinalSets
+	Dealt  []string      `json:",omitempty"` // For Deal, the IVSS instance of secret j at j-1
+	Sender int           `json:",omitempty"` // Added Sender field
 }
 
 func (p ICCPayload) String() string {
@@ -39,6 +48,16 @@ func (p ICCPayload) String() string {
 	return string(b)
 }
 
+// Digest identifies the payload in an A-Cast of payloads, see
+// NewAcastServiceWithDigest.
+func (p ICCPayload) Digest() [32]byte {
+	hash, err := CanonicalHash(p)
+	if err != nil {
+		return sha256.Sum256([]byte(p.String()))
+	}
+	return hash
+}
+
 func ParseICCPayload(s string) (*ICCPayload, error) {
 	var p ICCPayload
 	err := json.Unmarshal([]byte(s), &p)
@@ -48,6 +67,72 @@ func ParseICCPayload(s string) (*ICCPayload, error) {
 	return &p, nil
 }
 
+// Validate checks that the payload is well-formed for a cluster of n nodes:
+// it carries the sets of its type and no others, each of distinct nodes in
+// increasing order, as correct nodes send them.
+func (p *ICCPayload) Validate(n int) error {
+	var carried string
+	switch p.Type {
+	case ICC_Attach:
+		carried = "T"
+	case ICC_Accept:
+		carried = "A"
+	case ICC_FinalSets:
+		carried = "HS"
+	case ICC_Deal:
+	default:
+		return fmt.Errorf("unknown ICC payload type %d", p.Type)
+	}
+	if !validNodeID(p.Sender, n) {
+		return fmt.Errorf("sender %d out of range", p.Sender)
+	}
+	if err := p.validateDealt(n); err != nil {
+		return err
+	}
+	for _, set := range []struct {
+		name string
+		set  utils.NodeSet
+	}{{"T", p.SetT}, {"A", p.SetA}, {"H", p.SetH}, {"S", p.SetS}} {
+		if !strings.Contains(carried, set.name) {
+			if len(set.set) != 0 {
+				return fmt.Errorf("%s set in a payload of type %d", set.name, p.Type)
+			}
+			continue
+		}
+		if len(set.set) == 0 {
+			return fmt.Errorf("missing %s set", set.name)
+		}
+		if err := validateSortedNodeSet(set.set, n); err != nil {
+			return fmt.Errorf("invalid %s set: %w", set.name, err)
+		}
+	}
+	return nil
+}
+
+// validateDealt checks that a Deal names one instance of its sender for
+// each of the n secrets, and that other payloads name none.
+func (p *ICCPayload) validateDealt(n int) error {
+	if p.Type != ICC_Deal {
+		if len(p.Dealt) != 0 {
+			return fmt.Errorf("dealt instances in a payload of type %d", p.Type)
+		}
+		return nil
+	}
+	if len(p.Dealt) != n {
+		return fmt.Errorf("deal of %d secrets in a cluster of %d", len(p.Dealt), n)
+	}
+	for _, instanceID := range p.Dealt {
+		id, err := ParseIVSSID(instanceID)
+		if err != nil {
+			return fmt.Errorf("dealt instance: %w", err)
+		}
+		if _, ok := iccSecretIndex(id); !ok || id.Dealer != p.Sender {
+			return fmt.Errorf("dealt instance %s is no ICC secret of node %d", instanceID, p.Sender)
+		}
+	}
+	return nil
+}
+
 // ICCMsgType distinguishes between direct messages and A-Cast wrapper messages
 type ICCMsgType int
 
@@ -69,20 +154,39 @@ type ICCMessage struct {
 
 // ICCResult is the output of the ICC service
 type ICCResult struct {
-	Coin int // 0 or 1
+	Coin   int   // 0 or 1, or 0..CoinRange-1, see ICCConfig
+	Faulty []int // Nodes inferred faulty in the round so far, see inferFaulty
 }
 
 // ICCService implements the Inferable Common Coin protocol
 type ICCService struct {
-	id     int
-	n      int
-	t      int
-	round  int
-	u      int // Modulo for coin calculation
-	logger zerolog.Logger
+	id      int
+	n       int
+	t       int
+	round   int
+	u       int // Modulo for coin calculation
+	secrets int // Secrets are drawn from 0..secrets-1
+	k       int // The coin takes values 0..k-1, see ICCConfig.CoinRange
+	cp      *CertificationProtocol
+	metrics *Metrics
+	hook    TransitionHook
+	audits  CoinAuditHook
+	rand    io.Reader
+	nonce   func() int64
+	logger  zerolog.Logger
+
+	// Whether the n secrets of a dealer share one IVSS batch, see
+	// NodeContext.ICCBatchSharing
+	batchSharing bool
+
+	// Whether slots are dealt with spare sharings of earlier rounds, see
+	// NodeContext.ICCReuseDealings, and how many rounds back
+	reuse bool
+	keep  int
 
 	ivss  *IVSSService
 	acast *AcastService[string]
+	pool  *iccPool // Shares ivss and acast with the coins of other rounds, or nil
 
 	// State
 	mu sync.Mutex
@@ -93,6 +197,14 @@ type ICCService struct {
 	// dealer -> secretIdx -> bool
 	completedSecrets map[int]map[int]bool
 
+	// With reused dealings, the instances of the secrets this node and
+	// each dealer dealt, and the instances completed and reconstructed,
+	// see icc_reuse.go
+	dealt    []string
+	deals    map[int][]string
+	shared   map[string]bool
+	revealed map[string]*big.Int
+
 	myT        []int
 	sentAttach bool
 	receivedT  map[int][]int // from -> T set
@@ -109,6 +221,9 @@ type ICCService struct {
 
 	myH []int // The H set I broadcasted
 
+	// Step 5: IVSS instances we already started reconstructing
+	startedReconstructions map[string]bool
+
 	// Step 5: Reconstruction
 	// dealer -> secretIdx -> value
 	reconstructedValues map[int]map[int]*big.Int
@@ -122,32 +237,77 @@ type ICCService struct {
 	}
 
 	finished bool
+
+	// Nodes inferred faulty with the reason, see inferFaulty
+	faulty map[int]string
+	// Nodes whose payloads were discarded with the reason, see suspect
+	suspects map[int]string
+
+	closed bool // See Close
+
+	// Prepare dealt the secrets; held keeps the coin from being
+	// reconstructed until Start
+	prepared bool
+	held     bool
 }
 
 func NewICCService(id, n, t, round int, cp *CertificationProtocol, logLevel zerolog.Level) *ICCService {
+	return NewICCServiceWithContext(newNodeContextFor(id, n, t, cp, logLevel), round)
+}
+
+// NewICCServiceWithContext creates an ICCService for one round using the shared state of a node.
+func NewICCServiceWithContext(nc *NodeContext, round int) *ICCService {
+	return newICCService(nc, round, nc.ICC, nil)
+}
+
+// newICCService creates an ICCService with the coin parameters config. It
+// runs its sharings and A-Casts in pool, or in services of its own if pool
+// is nil.
+func newICCService(nc *NodeContext, round int, config ICCConfig, pool *iccPool) *ICCService {
+	n := nc.N
 	logger := log.With().
 		Str("layer", "ICC").
-		Int("node_id", id).
+		Int("node_id", nc.ID).
 		Int("round", round).
 		Logger().
-		Level(logLevel)
+		Level(nc.LogLevel)
 
-	// u = ceil(0.87 * n)
-	u := int(math.Ceil(0.87 * float64(n)))
+	if err := config.Validate(n, nc.T); err != nil {
+		logger.Error().Err(err).Int("u", config.U).Int("secret_range", config.SecretRange).Int("coin_range", config.CoinRange).Msg("Invalid ICC parameters, using the defaults")
+		config = ICCConfig{}
+	}
+	config = config.withDefaults(n)
 
 	icc := &ICCService{
-		id:                    id,
-		n:                     n,
-		t:                     t,
-		round:                 round,
-		u:                     u,
-		logger:                logger,
-		completedSecretsCount: make(map[int]int),
-		completedSecrets:      make(map[int]map[int]bool),
-		receivedT:             make(map[int][]int),
-		receivedA:             make(map[int][]int),
-		receivedS:             make(map[int][]int),
-		reconstructedValues:   make(map[int]map[int]*big.Int),
+		id:                     nc.ID,
+		n:                      n,
+		t:                      nc.T,
+		round:                  round,
+		u:                      config.U,
+		secrets:                config.SecretRange,
+		k:                      config.CoinRange,
+		cp:                     nc.CP,
+		metrics:                nc.Metrics,
+		hook:                   nc.Transitions,
+		audits:                 nc.CoinAudits,
+		rand:                   nc.random(),
+		nonce:                  nc.nonce,
+		logger:                 logger,
+		batchSharing:           nc.ICCBatchSharing,
+		reuse:                  pool != nil && nc.ICCReuseDealings && !nc.ICCBatchSharing,
+		keep:                   nc.ABACoinRetention,
+		completedSecretsCount:  make(map[int]int),
+		completedSecrets:       make(map[int]map[int]bool),
+		deals:                  make(map[int][]string),
+		shared:                 make(map[string]bool),
+		revealed:               make(map[string]*big.Int),
+		receivedT:              make(map[int][]int),
+		receivedA:              make(map[int][]int),
+		receivedS:              make(map[int][]int),
+		reconstructedValues:    make(map[int]map[int]*big.Int),
+		startedReconstructions: make(map[string]bool),
+		faulty:                 make(map[int]string),
+		suspects:               make(map[int]string),
 		receivedFinalSets: make([]struct {
 			From int
 			H    []int
@@ -155,22 +315,82 @@ func NewICCService(id, n, t, round int, cp *CertificationProtocol, logLevel zero
 		}, 0),
 	}
 
+	if pool != nil {
+		icc.pool, icc.ivss, icc.acast = pool, pool.ivss, pool.acast
+		return icc
+	}
+
 	// Initialize IVSS service
-	icc.ivss = NewIVSSService(id, n, t, cp, logLevel)
+	icc.ivss = NewIVSSServiceWithContext(nc)
 
 	// Initialize A-Cast service
-	icc.acast = NewAcastService[string](id, n, t, logLevel)
+	icc.acast = newValidatingAcast(nc, ParseICCPayload)
 
 	return icc
 }
 
-// Start initiates the ICC protocol
+// Prepare runs the sharing phase of the coin ahead of its round: it deals
+// the secrets and takes part in the sharings, T, A and S sets included, but
+// does not enable reconstruction until Start, so the coin stays hidden
+// until then.
+func (s *ICCService) Prepare(ctx ServiceContext[ICCMessage, ICCResult]) {
+	s.mu.Lock()
+	if s.prepared || s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.prepared, s.held = true, true
+	s.mu.Unlock()
+
+	s.logger.Info().Msg("Preparing ICC Protocol")
+	s.deal(ctx)
+}
+
+// Start initiates the ICC protocol, or releases the reconstruction of a
+// coin Prepare dealt.
 func (s *ICCService) Start(ctx ServiceContext[ICCMessage, ICCResult]) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if s.prepared {
+		s.held = false
+		s.logger.Info().Msg("Releasing prepared ICC Protocol")
+		s.checkProgress(ctx)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
 	s.logger.Info().Msg("Starting ICC Protocol")
+	s.deal(ctx)
+}
 
-	// 1. Choose n random secrets and share them
+// deal chooses n random secrets and shares them.
+func (s *ICCService) deal(ctx ServiceContext[ICCMessage, ICCResult]) {
+
+	if s.batchSharing {
+		secrets := make([]*big.Int, s.n)
+		for j := range secrets {
+			secrets[j], _ = rand.Int(s.rand, big.NewInt(int64(s.secrets)))
+		}
+		// Secret j of the batch is the instance getInstanceID(s.id, j)
+		adapter := &ivssContextAdapter{
+			icc: s,
+			ctx: ctx,
+		}
+		if err := s.ivss.StartBatchSharing(s.getBatchID(s.id), secrets, adapter); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to start sharing")
+		}
+		return
+	}
+	if s.reuse {
+		s.dealReusing(ctx)
+		return
+	}
 	for j := 1; j <= s.n; j++ {
-		secret, _ := rand.Int(rand.Reader, big.NewInt(1000)) // Random secret
+		secret, _ := rand.Int(s.rand, big.NewInt(int64(s.secrets))) // Random secret
 		instanceID := s.getInstanceID(s.id, j)
 
 		// Create adapter for IVSS context
@@ -189,13 +409,14 @@ func (s *ICCService) Start(ctx ServiceContext[ICCMessage, ICCResult]) {
 func (s *ICCService) OnMessage(msg ICCMessage, ctx ServiceContext[ICCMessage, ICCResult]) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-
-	if s.finished {
+	if s.closed {
 		return
 	}
 
+	// Keep relaying after finishing: peers may still depend on our
+	// ECHO/READY/REVEAL messages to complete their own instances.
 	if msg.Type == ICC_IVSS {
-		if msg.IVSSMsg != nil {
+		if msg.IVSSMsg != nil && (s.pool == nil || s.pool.admits(*msg.IVSSMsg)) {
 			adapter := &ivssContextAdapter{
 				icc: s,
 				ctx: ctx,
@@ -203,7 +424,7 @@ func (s *ICCService) OnMessage(msg ICCMessage, ctx ServiceContext[ICCMessage, IC
 			s.ivss.OnMessage(*msg.IVSSMsg, adapter)
 		}
 	} else if msg.Type == ICC_ACast {
-		if msg.ACastMsg != nil {
+		if msg.ACastMsg != nil && s.checkMSG(msg.ACastMsg) && s.claim(msg.ACastMsg.UUID) {
 			adapter := &iccAcastAdapter{
 				icc: s,
 				ctx: ctx,
@@ -216,17 +437,49 @@ func (s *ICCService) OnMessage(msg ICCMessage, ctx ServiceContext[ICCMessage, IC
 	s.checkProgress(ctx)
 }
 
+// Close releases the state of the coin: its IVSS and A-Cast instances, the
+// sets it collected and the secrets it reconstructed. The service ignores
+// every message after, so peers that have not output the coin yet get no
+// more help from this node; see NodeContext.ABACoinRetention.
+func (s *ICCService) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.pool != nil {
+		s.pool.release(s.round)
+	} else {
+		s.ivss.release()
+		s.acast.release()
+	}
+	s.completedSecretsCount, s.completedSecrets = nil, nil
+	s.deals, s.shared, s.revealed = nil, nil, nil
+	s.receivedT, s.receivedA, s.receivedS = nil, nil, nil
+	s.startedReconstructions, s.reconstructedValues = nil, nil
+	s.receivedFinalSets = nil
+}
+
 // iccAcastAdapter adapts ServiceContext[ICCMessage, ICCResult] to ServiceContext[ACastMessage[string], string]
 type iccAcastAdapter struct {
 	icc *ICCService
 	ctx ServiceContext[ICCMessage, ICCResult]
 }
 
-func (a *iccAcastAdapter) Broadcast(msg ACastMessage[string]) {
-	a.ctx.Broadcast(ICCMessage{
+func (a *iccAcastAdapter) wrap(msg ACastMessage[string]) ICCMessage {
+	return ICCMessage{
 		Type:     ICC_ACast,
 		ACastMsg: &msg,
-	})
+	}
+}
+
+func (a *iccAcastAdapter) Broadcast(msg ACastMessage[string]) {
+	a.ctx.Broadcast(a.wrap(msg))
+}
+
+func (a *iccAcastAdapter) SendTo(to int, msg ACastMessage[string]) {
+	a.ctx.SendTo(to, a.wrap(msg))
 }
 
 func (a *iccAcastAdapter) SendResult(res string) {
@@ -245,28 +498,68 @@ type ivssContextAdapter struct {
 	ctx ServiceContext[ICCMessage, ICCResult]
 }
 
-func (a *ivssContextAdapter) Broadcast(msg IVSSMessage) {
-	a.ctx.Broadcast(ICCMessage{
+func (a *ivssContextAdapter) wrap(msg IVSSMessage) ICCMessage {
+	return ICCMessage{
 		Type:    ICC_IVSS,
 		IVSSMsg: &msg,
-	})
+	}
+}
+
+func (a *ivssContextAdapter) Broadcast(msg IVSSMessage) {
+	a.ctx.Broadcast(a.wrap(msg))
+}
+
+func (a *ivssContextAdapter) SendTo(to int, msg IVSSMessage) {
+	a.ctx.SendTo(to, a.wrap(msg))
 }
 
 func (a *ivssContextAdapter) SendResult(res IVSSResult) {
-	a.icc.handleIVSSResult(res, a.ctx)
+	if a.icc.pool == nil {
+		a.icc.handleIVSSResult(res, a.ctx)
+		return
+	}
+	rounds, ok := a.icc.pool.roundsOf(res.InstanceID)
+	if !ok {
+		a.icc.handleIVSSResult(res, a.ctx)
+		return
+	}
+	for _, round := range rounds {
+		if round == a.icc.round {
+			a.icc.handleIVSSResult(res, a.ctx)
+		} else {
+			// A result for the coin of another round, see iccPool
+			a.icc.pool.hold(round, res)
+		}
+	}
+}
+
+// onIVSSResult hands the coin a result of the pool that surfaced while the
+// coin of another round held it.
+func (s *ICCService) onIVSSResult(res IVSSResult, ctx ServiceContext[ICCMessage, ICCResult]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handleIVSSResult(res, ctx)
+}
+
+// claim reports whether an ICC A-Cast belongs to this coin rather than to
+// the coin of another round sharing its pool.
+func (s *ICCService) claim(uuid string) bool {
+	return s.pool == nil || s.pool.claim(uuid, s.round)
 }
 
 func (s *ICCService) handleIVSSResult(res IVSSResult, ctx ServiceContext[ICCMessage, ICCResult]) {
-	// Parse InstanceID to get dealer and secretIdx
-	// Format: "ICC-{round}-{dealer}-{secretIdx}"
-	var round, dealer, secretIdx int
-	_, err := fmt.Sscanf(res.InstanceID, "ICC-%d-%d-%d", &round, &dealer, &secretIdx)
-	if err != nil {
-		// Not an ICC instance or bad format
+	if s.closed {
 		return
 	}
-
-	if round != s.round {
+	if s.reuse {
+		s.onDealtResult(res)
+		s.checkProgress(ctx)
+		return
+	}
+	// Parse InstanceID to get dealer and secretIdx, see getInstanceID
+	dealer, secretIdx, ok := s.parseInstanceID(res.InstanceID)
+	if !ok {
+		// Not an ICC instance of this round
 		return
 	}
 
@@ -291,7 +584,13 @@ func (s *ICCService) handleIVSSResult(res IVSSResult, ctx ServiceContext[ICCMess
 		if s.reconstructedValues[dealer] == nil {
 			s.reconstructedValues[dealer] = make(map[int]*big.Int)
 		}
+		if s.reconstructedValues[dealer][secretIdx] == nil {
+			s.metrics.Inc("icc.reconstructions_complete")
+		}
 		s.reconstructedValues[dealer][secretIdx] = res.Secret
+		if res.Secret.Sign() < 0 || res.Secret.Cmp(big.NewInt(int64(s.secrets))) >= 0 {
+			s.inferFaulty(dealer, fmt.Sprintf("secret %d of %s is out of range", secretIdx, res.InstanceID))
+		}
 	}
 
 	s.checkProgress(ctx)
@@ -309,8 +608,11 @@ func (s *ICCService) checkProgress(ctx ServiceContext[ICCMessage, ICCResult]) {
 		}
 
 		if len(T) >= s.n-s.t {
+			from := s.phase()
 			s.myT = T
 			s.sentAttach = true
+			s.transition("SEND_ATTACH", from, map[string]int{"T": len(T)})
+			s.metrics.Inc("icc.t_formed")
 			sort.Ints(s.myT)
 
 			// A-Cast "attach T_i to i"
@@ -327,21 +629,16 @@ func (s *ICCService) checkProgress(ctx ServiceContext[ICCMessage, ICCResult]) {
 	// Step 3: Check if we can form A_i and A-Cast it
 	if !s.sentAccept {
 		// A_i = set of j such that we received "attach T_j" and T_j is subset of T_i
-		// Note: We need T_i to be fixed (which happens when sentAttach is true)
+		// Note: T_i keeps growing after it was attached, see acceptedSet
 		if s.sentAttach {
-			var A []int
-			for j, Tj := range s.receivedT {
-				isSub := isSubset(Tj, s.myT)
-				if isSub {
-					A = append(A, j)
-				} else {
-					s.logger.Debug().Int("from", j).Ints("T_j", Tj).Ints("myT", s.myT).Msg("Rejecting T_j (not subset)")
-				}
-			}
+			A := s.acceptedSet()
 
 			if len(A) >= s.n-s.t {
+				from := s.phase()
 				s.myA = A
 				s.sentAccept = true
+				s.transition("SEND_ACCEPT", from, map[string]int{"A": len(A)})
+				s.metrics.Inc("icc.a_formed")
 				sort.Ints(s.myA)
 
 				// A-Cast "i accepts A_i"
@@ -356,19 +653,16 @@ func (s *ICCService) checkProgress(ctx ServiceContext[ICCMessage, ICCResult]) {
 	}
 
 	// Step 4: Check if we can form S_i and A-Cast Reconstruct Enabled
-	if !s.sentReconstruct {
+	if !s.sentReconstruct && !s.held {
 		if s.sentAccept {
-			var S []int
-			for j, Aj := range s.receivedA {
-				if isSubset(Aj, s.myA) {
-					S = append(S, j)
-				}
-			}
+			S := s.supportSet(s.acceptedSet())
 
 			if len(S) >= s.n-s.t {
+				from := s.phase()
 				s.myS = S
 				s.sentReconstruct = true
-				sort.Ints(s.myS)
+				s.transition("SEND_FINAL_SETS", from, map[string]int{"S": len(S)})
+				s.metrics.Inc("icc.s_formed")
 
 				// A-Cast "Reconstruct Enabled" and (H_i, S_i)
 				// H_i is current A_i
@@ -381,20 +675,85 @@ func (s *ICCService) checkProgress(ctx ServiceContext[ICCMessage, ICCResult]) {
 					Sender: s.id,
 				}
 				s.startACast(payload, ctx)
-
-				// Also start reconstruction for required secrets
-				s.startReconstruction(ctx)
 			}
 		}
 	}
 
+	// Step 5: Participate in reconstructions, including those of processes
+	// accepted after the (H_i, S_i) broadcast
+	if s.sentReconstruct {
+		s.startReconstruction(ctx)
+	}
+
 	// Step 6: Check for decision
 	s.checkDecision(ctx)
 }
 
+// phase names the abstract state of the round for conformance checking.
+func (s *ICCService) phase() string {
+	switch {
+	case s.finished:
+		return "FINISHED"
+	case s.sentReconstruct:
+		return "FINAL_SETS_SENT"
+	case s.sentAccept:
+		return "ACCEPT_SENT"
+	case s.sentAttach:
+		return "ATTACH_SENT"
+	default:
+		return "INIT"
+	}
+}
+
+func (s *ICCService) transition(action, from string, counts map[string]int) {
+	s.hook.emit(StateTransition{Node: s.id, Layer: Layer_ICC, Instance: roundInstance(s.round), Action: action, From: from, To: s.phase(), Counts: counts})
+}
+
+// acceptedSet returns every j whose delivered T_j is a subset of the dealers
+// completed so far. Unlike the A_i snapshot that was A-Cast, this set keeps
+// growing, so sets formed by peers that saw attachments in a different order
+// are eventually accepted as well.
+func (s *ICCService) acceptedSet() []int {
+	if !s.sentAttach {
+		return nil
+	}
+
+	var T []int
+	for dealer, count := range s.completedSecretsCount {
+		if count == s.n {
+			T = append(T, dealer)
+		}
+	}
+
+	var A []int
+	for j, Tj := range s.receivedT {
+		if isSubset(Tj, T) {
+			A = append(A, j)
+		}
+	}
+	sort.Ints(A)
+	return A
+}
+
+// supportSet returns every j whose delivered A_j is a subset of accepted.
+func (s *ICCService) supportSet(accepted []int) []int {
+	var S []int
+	for j, Aj := range s.receivedA {
+		if isSubset(Aj, accepted) {
+			S = append(S, j)
+		}
+	}
+	sort.Ints(S)
+	return S
+}
+
 func (s *ICCService) startACast(payload ICCPayload, ctx ServiceContext[ICCMessage, ICCResult]) {
 	val := payload.String()
-	msg := NewACastMessage(val, s.id)
+	msg := newACastMessage(val, s.id, s.nonce())
+	if tag := s.payloadTag(payload.Type); tag != "" {
+		msg = NewTaggedACastMessage(val, s.id, tag)
+	}
+	s.claim(msg.UUID)
 
 	// Send MSG to all (via Broadcast)
 	// The A-Cast logic starts by broadcasting MSG
@@ -415,27 +774,38 @@ func (s *ICCService) startReconstruction(ctx ServiceContext[ICCMessage, ICCResul
 	// Participate in IVSS-R(x_{k,j}) for every k in T_j and j in A_i.
 	// We actively start the reconstruction process for these secrets.
 
-	// For each j in A_i (my A_i):
+	// For each j in A_i (the growing accepted set):
 	//   For each k in T_j (the T set of j):
 	//     Start Reconstruction for secret x_{k,j} (Dealer k, secret index j)
 
-	for _, j := range s.myA {
+	var ids []string
+	for _, j := range s.acceptedSet() {
 		Tj, ok := s.receivedT[j]
 		if !ok {
 			continue // Should not happen if j is in A_i
 		}
 		for _, k := range Tj {
-			instanceID := s.getInstanceID(k, j)
-
-			adapter := &ivssContextAdapter{
-				icc: s,
-				ctx: ctx,
+			instanceID := s.secretInstance(k, j)
+			if instanceID != "" && !s.startedReconstructions[instanceID] {
+				ids = append(ids, instanceID)
 			}
-			// We call StartReconstruction.
-			// In IVSS, StartReconstruction can be called by anyone.
-			s.ivss.StartReconstruction(instanceID, adapter)
 		}
 	}
+	if len(ids) == 0 {
+		return
+	}
+
+	// IVSS starts each reconstruction once and A-Casts the REVEALs in one
+	// batch. Those whose sharing is incomplete here are retried on a later
+	// progress check
+	adapter := &ivssContextAdapter{
+		icc: s,
+		ctx: ctx,
+	}
+	for _, instanceID := range s.ivss.StartReconstructions(ids, adapter) {
+		s.startedReconstructions[instanceID] = true
+		s.metrics.Inc("icc.reconstructions_started")
+	}
 }
 
 func (s *ICCService) checkDecision(ctx ServiceContext[ICCMessage, ICCResult]) {
@@ -443,17 +813,20 @@ func (s *ICCService) checkDecision(ctx ServiceContext[ICCMessage, ICCResult]) {
 		return
 	}
 
+	accepted := s.acceptedSet()
+	support := s.supportSet(accepted)
+
 	// Check if we have a valid (H, S) pair from someone
 	for _, finalSet := range s.receivedFinalSets {
 		H := finalSet.H
 		S := finalSet.S
 
-		// Conditions: H <= A_i, S <= S_i
+		// Conditions: H <= A_i, S <= S_i (both taken as the growing sets)
 		if s.sentAccept && s.sentReconstruct { // Ensure we have A_i and S_i
-			if isSubset(H, s.myA) && isSubset(S, s.myS) {
+			if isSubset(H, accepted) && isSubset(S, support) {
 				// Check if all values for processes in H are computed
 				allComputed := true
-				hasZero := false
+				values := make(map[int]*big.Int, len(H))
 
 				for _, j := range H {
 					// Compute v_j
@@ -482,23 +855,25 @@ func (s *ICCService) checkDecision(ctx ServiceContext[ICCMessage, ICCResult]) {
 
 					// v_j = sum mod u
 					uBig := big.NewInt(int64(s.u))
-					vj := new(big.Int).Mod(sum, uBig)
-
-					if vj.Cmp(big.NewInt(0)) == 0 {
-						hasZero = true
-					}
+					values[j] = new(big.Int).Mod(sum, uBig)
 				}
 
 				if allComputed {
 					// Output
-					coin := 1
-					if hasZero {
-						coin = 0
-					}
+					coin := s.coin(H, values)
 
+					from := s.phase()
 					s.finished = true
+					s.transition("FINISH", from, map[string]int{"H": len(H), "coin": coin})
 					s.logger.Info().Int("coin", coin).Msg("ICC Finished")
-					ctx.SendResult(ICCResult{Coin: coin})
+					faulty := s.inferredFaulty()
+					for _, j := range faulty {
+						s.certifyFaulty(j)
+					}
+					if s.audits != nil {
+						s.audits.emit(s.audit(finalSet.From, H, S, values, coin, faulty))
+					}
+					ctx.SendResult(ICCResult{Coin: coin, Faulty: faulty})
 					return
 				}
 			}
@@ -506,12 +881,49 @@ func (s *ICCService) checkDecision(ctx ServiceContext[ICCMessage, ICCResult]) {
 	}
 }
 
+// coin returns the coin the values v_j of the nodes j in H give, see
+// ICCConfig.
+func (s *ICCService) coin(H []int, values map[int]*big.Int) int {
+	if s.k == 2 {
+		for _, j := range H {
+			if values[j].Sign() == 0 {
+				return 0
+			}
+		}
+		return 1
+	}
+	var min *big.Int
+	for _, j := range H {
+		if v := values[j]; min == nil || v.Cmp(min) < 0 {
+			min = v
+		}
+	}
+	return int(new(big.Int).Mod(min, big.NewInt(int64(s.k))).Int64())
+}
+
 func (s *ICCService) processDeliveredPayload(p *ICCPayload, ctx ServiceContext[ICCMessage, ICCResult]) {
 	sender := p.Sender
 
+	if err := p.Validate(s.n); err != nil {
+		s.suspect(sender, err.Error())
+		return
+	}
+	if s.cp.IsCertifiedFaulty(s.id, sender) {
+		s.logger.Debug().Int("from", sender).Msg("Ignoring payload from certified-faulty process")
+		return
+	}
+
+	if !s.checkPayload(p) {
+		return
+	}
+
 	switch p.Type {
 	case ICC_Attach:
 		s.receivedT[sender] = p.SetT
+		s.spareUnattached(sender, p.SetT)
+
+	case ICC_Deal:
+		s.onDeal(sender, p.Dealt)
 
 	case ICC_Accept:
 		s.receivedA[sender] = p.SetA
@@ -532,7 +944,35 @@ func (s *ICCService) processDeliveredPayload(p *ICCPayload, ctx ServiceContext[I
 }
 
 func (s *ICCService) getInstanceID(dealer, secretIdx int) string {
-	return fmt.Sprintf("ICC-%d-%d-%d", s.round, dealer, secretIdx)
+	return IVSSID{Dealer: dealer, Round: s.round, Tag: iccTag + "-" + strconv.Itoa(secretIdx)}.String()
+}
+
+// getBatchID names the batch of dealer, whose secret j is
+// getInstanceID(dealer, j).
+func (s *ICCService) getBatchID(dealer int) string {
+	return IVSSID{Dealer: dealer, Round: s.round, Tag: iccTag}.String()
+}
+
+// parseInstanceID returns the dealer and secret of an instance ID of
+// getInstanceID, and false for other IDs or rounds.
+func (s *ICCService) parseInstanceID(instanceID string) (int, int, bool) {
+	id, err := ParseIVSSID(instanceID)
+	if err != nil || id.Round != s.round {
+		return 0, 0, false
+	}
+	secretIdx, ok := iccSecretIndex(id)
+	return id.Dealer, secretIdx, ok
+}
+
+// iccSecretIndex returns j for the instance of an ICC secret j, see
+// getInstanceID, and false for other instances.
+func iccSecretIndex(id IVSSID) (int, bool) {
+	idx, ok := strings.CutPrefix(id.Tag, iccTag+"-")
+	if !ok {
+		return 0, false
+	}
+	secretIdx, ok := parseCanonicalInt(idx)
+	return secretIdx, ok && secretIdx > 0
 }
 
 // Utils
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultICCSecretRange is the number of secret values ICC dealers draw
+// from when ICCConfig.SecretRange is 0.
+const DefaultICCSecretRange = 1000
+
+// DefaultICCMultiModulus is U when ICCConfig.U is 0 for a coin of more than
+// two values. It makes ties between the v_j unlikely and v_j mod CoinRange
+// close to uniform.
+const DefaultICCMultiModulus = 1 << 30
+
+// ICCConfig holds the parameters of the common coin. Node j's value is
+// v_j = sum of the secrets y_{k,j} of the dealers k in T_j, mod U, and the
+// coin is 0 iff v_j = 0 for some j in H. Since T_j holds a correct dealer,
+// whose secret is uniform, v_j is (close to) uniform mod U, so the coin is
+// 1 with probability about (1-1/U)^|H| for n-t <= |H| <= n, see Bias. The
+// paper takes U = ceil(0.87n), which keeps both outcomes above about 0.3
+// from n = 4 on. All nodes of a cluster must use the same parameters.
+//
+// A coin of CoinRange k > 2 values, e.g. to elect a leader, instead
+// outputs the smallest v_j of H mod k. Nodes agree when the smallest v_j of
+// all their H sets is in every H, which, as for the binary coin, happens
+// with constant probability. ABA always uses the binary coin.
+type ICCConfig struct {
+	// The modulus of the coin values, 0 for ceil(0.87n), or
+	// DefaultICCMultiModulus for a coin of more than two values
+	U int
+	// Dealers draw their secrets from 0..SecretRange-1, 0 for
+	// DefaultICCSecretRange, or U for a coin of more than two values. It
+	// must be at least U; v_j is exactly uniform when it is a multiple of U
+	SecretRange int
+	// The coin takes values 0..CoinRange-1, 0 for the binary coin
+	CoinRange int
+}
+
+// withDefaults returns c with the defaults for n nodes filled in.
+func (c ICCConfig) withDefaults(n int) ICCConfig {
+	if c.CoinRange == 0 {
+		c.CoinRange = 2
+	}
+	if c.U == 0 && c.multiValued() {
+		c.U = DefaultICCMultiModulus
+	} else if c.U == 0 {
+		c.U = int(math.Ceil(0.87 * float64(n)))
+	}
+	if c.SecretRange == 0 && c.multiValued() {
+		c.SecretRange = c.U
+	} else if c.SecretRange == 0 {
+		c.SecretRange = DefaultICCSecretRange
+	}
+	return c
+}
+
+// multiValued reports whether c is a coin of more than two values.
+func (c ICCConfig) multiValued() bool {
+	return c.CoinRange > 2
+}
+
+// Bias returns, for n nodes of which t may fail, the probability that the
+// binary coin is 0 and that it is 1 when every v_j is uniform, at the worst
+// size of H for each outcome.
+func (c ICCConfig) Bias(n, t int) (zero, one float64) {
+	c = c.withDefaults(n)
+	miss := 1 - 1/float64(c.U)
+	return 1 - math.Pow(miss, float64(n-t)), math.Pow(miss, float64(n))
+}
+
+// Validate reports why the parameters do not give a coin for n nodes of
+// which t may fail, or nil.
+func (c ICCConfig) Validate(n, t int) error {
+	if c.U < 0 || c.SecretRange < 0 || c.CoinRange < 0 {
+		return fmt.Errorf("U %d, secret range %d and coin range %d must not be negative", c.U, c.SecretRange, c.CoinRange)
+	}
+	d := c.withDefaults(n)
+	switch {
+	case d.CoinRange < 2:
+		return fmt.Errorf("coin range %d has a single value", d.CoinRange)
+	case d.multiValued() && d.U < d.CoinRange:
+		// Some coin values could never come up
+		return fmt.Errorf("U %d is smaller than the coin range %d", d.U, d.CoinRange)
+	case d.U < 2:
+		// Every v_j would be 0
+		return fmt.Errorf("U %d leaves the coin always 0", d.U)
+	case d.SecretRange < d.U:
+		// Some values mod U could never be dealt
+		return fmt.Errorf("secret range %d is smaller than U %d", d.SecretRange, d.U)
+	case n-t < 1:
+		return fmt.Errorf("H of %d nodes leaves the coin always 1", n-t)
+	}
+	return nil
+}
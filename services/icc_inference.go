@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ICC is inferable: misbehavior that every node sees the same way proves a
+// node faulty, and the coin reports it in ICCResult.Faulty. A node is
+// inferred faulty when it A-Casts a T, A or S set of fewer than n-t nodes,
+// an H set other than its A set or two different sets of one kind, or a
+// Deal of sharings another round may not reuse (see icc_reuse.go), which
+// no correct node does, or when it deals a secret outside the range of
+// ICCConfig.SecretRange. Once it outputs the coin, every node records
+// {self, j} as a faulty pair for the faulty nodes j it infers, so Vote and
+// ICC ignore them in later rounds. Recording them earlier would invalidate
+// the M-Sets that still name them in sharings of this round. The payloads of a node are bound to it by checking that it sent
+// their MSG itself, which needs authenticated transports to hold against
+// impersonation.
+//
+// Payloads that are malformed, e.g. with unsorted or out-of-range sets, or
+// that a node A-Casts for another are dropped before they are echoed, and
+// their sender is recorded as suspicious, see suspect.
+
+// inferFaulty certifies node j faulty for reason, unless it is this node.
+func (s *ICCService) inferFaulty(j int, reason string) {
+	if j == s.id || s.faulty[j] != "" {
+		return
+	}
+	s.faulty[j] = reason
+	s.logger.Warn().Int("node", j).Str("reason", reason).Msg("Inferred faulty node")
+	s.metrics.Inc("icc.inferred_faulty")
+	if s.finished {
+		s.certifyFaulty(j)
+	}
+}
+
+// certifyFaulty records {self, j} as a faulty pair for a node j inferred
+// faulty.
+func (s *ICCService) certifyFaulty(j int) {
+	s.cp.AddFaultyPairWithEvidence(s.id, j, roundInstance(s.round), s.faulty[j])
+}
+
+// inferredFaulty returns the nodes inferred faulty so far, sorted.
+func (s *ICCService) inferredFaulty() []int {
+	var faulty []int
+	for j := range s.faulty {
+		faulty = append(faulty, j)
+	}
+	sort.Ints(faulty)
+	return faulty
+}
+
+// checkPayload infers the sender of a delivered payload faulty if the
+// payload proves it, and reports whether to use the payload.
+func (s *ICCService) checkPayload(p *ICCPayload) bool {
+	sender := p.Sender
+	switch p.Type {
+	case ICC_Attach:
+		if T, ok := s.receivedT[sender]; ok {
+			if !sameSet(T, p.SetT) {
+				s.inferFaulty(sender, "attached two T sets")
+			}
+			return false
+		}
+		if len(p.SetT) < s.n-s.t {
+			s.inferFaulty(sender, fmt.Sprintf("T set of %d nodes", len(p.SetT)))
+			return false
+		}
+	case ICC_Accept:
+		if A, ok := s.receivedA[sender]; ok {
+			if !sameSet(A, p.SetA) {
+				s.inferFaulty(sender, "accepted two A sets")
+			}
+			return false
+		}
+		if len(p.SetA) < s.n-s.t {
+			s.inferFaulty(sender, fmt.Sprintf("A set of %d nodes", len(p.SetA)))
+			return false
+		}
+		for _, final := range s.receivedFinalSets {
+			if final.From == sender && !sameSet(final.H, p.SetA) {
+				s.inferFaulty(sender, "H set differs from its A set")
+			}
+		}
+	case ICC_Deal:
+		if dealt, ok := s.deals[sender]; ok {
+			if !slices.Equal(dealt, p.Dealt) {
+				s.inferFaulty(sender, "dealt twice")
+			}
+			return false
+		}
+		if err := s.checkDealt(p.Dealt); err != nil {
+			s.inferFaulty(sender, err.Error())
+			return false
+		}
+	case ICC_FinalSets:
+		for _, final := range s.receivedFinalSets {
+			if final.From == sender {
+				if !sameSet(final.H, p.SetH) || !sameSet(final.S, p.SetS) {
+					s.inferFaulty(sender, "sent two final sets")
+				}
+				return false
+			}
+		}
+		if len(p.SetS) < s.n-s.t {
+			s.inferFaulty(sender, fmt.Sprintf("S set of %d nodes", len(p.SetS)))
+			return false
+		}
+		if A, ok := s.receivedA[sender]; ok && !sameSet(p.SetH, A) {
+			s.inferFaulty(sender, "H set differs from its A set")
+			return false
+		}
+	}
+	return true
+}
+
+// suspect records node j as suspicious for reason when a payload of it is
+// discarded. Unlike an inferred fault, only this node may have seen it, e.g.
+// an A-Cast MSG that no correct node would echo, so it proves nothing to
+// the others and is never certified.
+func (s *ICCService) suspect(j int, reason string) {
+	if j == s.id || !validNodeID(j, s.n) {
+		return
+	}
+	s.metrics.Inc("icc.suspicious_payloads")
+	if _, ok := s.suspects[j]; ok {
+		return
+	}
+	s.suspects[j] = reason
+	s.logger.Warn().Int("node", j).Str("reason", reason).Msg("Suspicious node")
+}
+
+// checkMSG reports whether the MSG of an ICC A-Cast carries a valid payload
+// of its sender, and drops it otherwise, suspecting the sender. Correct
+// nodes echo only the MSGs that pass, so a delivered payload is bound to
+// the node that started its A-Cast.
+func (s *ICCService) checkMSG(msg *ACastMessage[string]) bool {
+	if msg.Type != MSG && msg.Type != SIGNED_MSG {
+		return true
+	}
+	p, err := ParseICCPayload(msg.Val)
+	if err == nil {
+		err = p.Validate(s.n)
+	}
+	if err == nil && p.Sender != msg.From {
+		err = fmt.Errorf("A-Cast of the payload of node %d", p.Sender)
+	}
+	if err == nil && p.Type == ICC_Deal && !s.reuse {
+		err = fmt.Errorf("deal without reused dealings")
+	}
+	if err == nil && msg.Tag != s.payloadTag(p.Type) {
+		err = fmt.Errorf("payload of type %d tagged %q", p.Type, msg.Tag)
+	}
+	if err != nil {
+		s.logger.Warn().Int("from", msg.From).Err(err).Msg("Invalid ICC payload, ignoring")
+		s.suspect(msg.From, err.Error())
+		return false
+	}
+	return true
+}
+
+func sameSet(a, b []int) bool {
+	return len(a) == len(b) && isSubset(a, b)
+}
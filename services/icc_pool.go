@@ -0,0 +1,188 @@
+package services
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// iccPool holds the IVSS and A-Cast state the coins of every round of an
+// ABAService share, instead of one IVSSService and AcastService per coin.
+// IVSS instances are keyed by their ID, which carries the round (see
+// IVSSID), so a coin finds its own; the A-Casts of ICC payloads are tagged
+// with the round of the first message that names them.
+//
+// An IVSS result may surface while the coin of another round holds the
+// pool, e.g. for a batched A-Cast that carries payloads of two rounds. The
+// pool keeps it until ABAService hands it to its coin, see
+// ABAService.deliverCoinResults.
+//
+// A coin that reuses the sharing of an earlier round pins it (see
+// NodeContext.ICCReuseDealings): the sharing outlives the release of its
+// round and its results go to the reusing coin as well.
+type iccPool struct {
+	ivss  *IVSSService
+	acast *AcastService[string]
+
+	mu      sync.Mutex
+	rounds  map[string]int       // A-Cast UUID -> round of its coin
+	pending map[int][]IVSSResult // round -> results for its coin
+	pins    map[string][]int     // Reused IVSS instance -> rounds of the coins reusing it
+	floor   int                  // Rounds below are released
+}
+
+func newICCPool(nc *NodeContext) *iccPool {
+	return &iccPool{
+		ivss:    NewIVSSServiceWithContext(nc),
+		acast:   newValidatingAcast(nc, ParseICCPayload),
+		rounds:  make(map[string]int),
+		pending: make(map[int][]IVSSResult),
+		pins:    make(map[string][]int),
+	}
+}
+
+// claim reports whether the ICC A-Cast uuid belongs to the coin of round,
+// tagging it with round the first time it is seen.
+func (p *iccPool) claim(uuid string, round int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if round < p.floor {
+		return false
+	}
+	if r, ok := p.rounds[uuid]; ok {
+		return r == round
+	}
+	p.rounds[uuid] = round
+	return true
+}
+
+// admits reports whether msg may reach the IVSS service: messages of
+// released rounds would bring their instances back.
+func (p *iccPool) admits(msg IVSSMessage) bool {
+	id := msg.InstanceID
+	if msg.ACastMsg != nil {
+		id = msg.ACastMsg.UUID
+	}
+	round, ok := ivssRound(id)
+	if !ok {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return round >= p.floor || len(p.pins[ivssInstance(id)]) > 0
+}
+
+// pin keeps the IVSS instance id of an earlier round, which the coin of
+// round reuses, until that coin is released.
+func (p *iccPool) pin(id string, round int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if round >= p.floor && !slices.Contains(p.pins[id], round) {
+		p.pins[id] = append(p.pins[id], round)
+	}
+}
+
+// roundsOf returns the rounds of the coins an IVSS result of instance id
+// is for: the round its ID names and those of the coins reusing it. It
+// returns false for IDs without a round.
+func (p *iccPool) roundsOf(id string) ([]int, bool) {
+	round, ok := ivssRound(id)
+	if !ok {
+		return nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]int{round}, p.pins[id]...), true
+}
+
+// hold keeps res for the coin of round.
+func (p *iccPool) hold(round int, res IVSSResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if round >= p.floor {
+		p.pending[round] = append(p.pending[round], res)
+	}
+}
+
+// next pops the first result kept for a round ready accepts, lowest round
+// first.
+func (p *iccPool) next(ready func(round int) bool) (int, IVSSResult, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rounds := make([]int, 0, len(p.pending))
+	for r := range p.pending {
+		rounds = append(rounds, r)
+	}
+	sort.Ints(rounds)
+	for _, r := range rounds {
+		if !ready(r) {
+			continue
+		}
+		res := p.pending[r][0]
+		if p.pending[r] = p.pending[r][1:]; len(p.pending[r]) == 0 {
+			delete(p.pending, r)
+		}
+		return r, res, true
+	}
+	return 0, IVSSResult{}, false
+}
+
+// release drops the state of the coin of round, and the instances it
+// reused that no later coin pins. Later messages and results for rounds up
+// to it are ignored once every coin before it is released too, as
+// ABAService.closeCoins does, oldest first.
+func (p *iccPool) release(round int) {
+	p.mu.Lock()
+	var uuids []string
+	for uuid, r := range p.rounds {
+		if r == round {
+			uuids = append(uuids, uuid)
+			delete(p.rounds, uuid)
+		}
+	}
+	delete(p.pending, round)
+	p.floor = max(p.floor, round+1)
+
+	pinned := make(map[string]bool, len(p.pins))
+	var unpinned []string
+	for id, rounds := range p.pins {
+		rounds = slices.DeleteFunc(rounds, func(r int) bool { return r < p.floor })
+		if len(rounds) > 0 {
+			p.pins[id] = rounds
+			pinned[id] = true
+			continue
+		}
+		delete(p.pins, id)
+		if r, _ := ivssRound(id); r < p.floor {
+			unpinned = append(unpinned, id)
+		}
+	}
+	p.mu.Unlock()
+
+	dropped := make(map[string]bool, len(uuids))
+	for _, uuid := range uuids {
+		dropped[uuid] = true
+	}
+	p.acast.releaseWhere(func(uuid string) bool { return dropped[uuid] })
+	p.ivss.releaseRound(round, func(id string) bool { return pinned[id] })
+	p.ivss.releaseInstances(unpinned)
+}
+
+// ivssRound returns the round of an IVSS instance ID, or of the instance
+// an IVSS A-Cast UUID names.
+func ivssRound(id string) (int, bool) {
+	parsed, err := ParseIVSSID(ivssInstance(id))
+	return parsed.Round, err == nil
+}
+
+// ivssInstance returns the instance an IVSS A-Cast UUID names, see
+// IVSSService.startACast, or id itself for an instance ID.
+func ivssInstance(id string) string {
+	if at := strings.IndexByte(id, '@'); at >= 0 {
+		if dash := strings.IndexByte(id[at:], '-'); dash >= 0 {
+			return id[:at+dash]
+		}
+	}
+	return id
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// With NodeContext.ICCReuseDealings the coins of ABA reuse dealings across
+// rounds. Secret j of dealer k is only reconstructed if k is in T_j, so
+// when the delivered T_j leaves k out, k's sharing of secret j stays
+// hidden and k may deal it again in a later round instead of a fresh one.
+// A node may A-Cast any number of payloads, so the Attach payloads are
+// tagged A-Casts then: every node delivers the same T_j, if any, and no
+// correct node reconstructs a sharing its dealer took for spare.
+//
+// Each dealer A-Casts a Deal naming the instance of each of its secrets,
+// also tagged, so every node sums the same sharings into v_j. A dealer
+// counts towards T once its Deal is delivered and every instance it names
+// completed. The pool keeps the instances a coin reuses until that coin is
+// released, see iccPool.pin.
+
+// dealReusing deals the secrets of the round, taking a spare sharing of
+// this node for each secret it can, and A-Casts the Deal.
+func (s *ICCService) dealReusing(ctx ServiceContext[ICCMessage, ICCResult]) {
+	adapter := &ivssContextAdapter{
+		icc: s,
+		ctx: ctx,
+	}
+	dealt := make([]string, s.n)
+	for j := 1; j <= s.n; j++ {
+		if instanceID, ok := s.cp.NextReusableInvocation(s.id, s.reuseFloor()); ok {
+			dealt[j-1] = instanceID
+			s.metrics.Inc("icc.dealings_reused")
+			continue
+		}
+		dealt[j-1] = s.getInstanceID(s.id, j)
+		secret, _ := rand.Int(s.rand, big.NewInt(int64(s.secrets)))
+		if err := s.ivss.StartSharing(dealt[j-1], secret, adapter); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to start sharing")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dealt = dealt
+	s.logger.Info().Strs("dealt", dealt).Msg("Broadcasting Deal")
+	s.startACast(ICCPayload{Type: ICC_Deal, Dealt: dealt, Sender: s.id}, ctx)
+}
+
+// reuseFloor returns the first round whose sharings a Deal may reuse.
+// Peers close the coins of older rounds and drop their sharings, see
+// NodeContext.ABACoinRetention.
+func (s *ICCService) reuseFloor() int {
+	if s.keep <= 0 {
+		return 0
+	}
+	return s.round - s.keep
+}
+
+// payloadTag returns the tag of the A-Cast of a payload of type t, or ""
+// if it is not tagged.
+func (s *ICCService) payloadTag(t ICCPayloadType) string {
+	if !s.reuse || (t != ICC_Attach && t != ICC_Deal) {
+		return ""
+	}
+	return fmt.Sprintf("%s#%d/%d", iccTag, s.round, t)
+}
+
+// checkDealt reports why a Deal does not fit the round, or nil: secret j
+// is either the instance getInstanceID gives for it or a sharing of an
+// earlier round from reuseFloor on.
+func (s *ICCService) checkDealt(dealt []string) error {
+	for j, instanceID := range dealt {
+		id, _ := ParseIVSSID(instanceID) // See ICCPayload.Validate
+		secretIdx, _ := iccSecretIndex(id)
+		switch {
+		case id.Round == s.round && secretIdx != j+1:
+			return fmt.Errorf("secret %d dealt as %s", j+1, instanceID)
+		case id.Round > s.round || id.Round < s.reuseFloor():
+			return fmt.Errorf("secret %d dealt as %s of round %d", j+1, instanceID, id.Round)
+		}
+	}
+	return nil
+}
+
+// onDeal records the instances dealer deals its secrets as, pins those of
+// earlier rounds and takes in what they completed before.
+func (s *ICCService) onDeal(dealer int, dealt []string) {
+	s.deals[dealer] = dealt
+	for _, instanceID := range dealt {
+		if round, _ := ivssRound(instanceID); round == s.round {
+			continue
+		}
+		s.pool.pin(instanceID, s.round)
+		shared, secret := s.ivss.outcome(instanceID)
+		if shared {
+			s.shared[instanceID] = true
+		}
+		if secret != nil {
+			s.onDealtSecret(instanceID, dealer, secret)
+		}
+	}
+	s.fillSecrets(dealer)
+}
+
+// onDealtResult takes in the result of an instance a Deal may name.
+func (s *ICCService) onDealtResult(res IVSSResult) {
+	id, err := ParseIVSSID(res.InstanceID)
+	if err != nil {
+		return
+	}
+	if _, ok := iccSecretIndex(id); !ok {
+		return
+	}
+	switch res.Type {
+	case "SHARING_COMPLETE":
+		s.shared[res.InstanceID] = true
+	case "RECONSTRUCTED":
+		s.onDealtSecret(res.InstanceID, id.Dealer, res.Secret)
+	}
+	s.fillSecrets(id.Dealer)
+}
+
+// onDealtSecret records the secret instanceID of dealer reconstructed to.
+func (s *ICCService) onDealtSecret(instanceID string, dealer int, secret *big.Int) {
+	if s.revealed[instanceID] != nil {
+		return
+	}
+	s.revealed[instanceID] = secret
+	if secret.Sign() < 0 || secret.Cmp(big.NewInt(int64(s.secrets))) >= 0 {
+		s.inferFaulty(dealer, fmt.Sprintf("secret of %s is out of range", instanceID))
+	}
+}
+
+// fillSecrets marks the secrets of dealer complete and reconstructed as
+// the instances its Deal names are.
+func (s *ICCService) fillSecrets(dealer int) {
+	dealt, ok := s.deals[dealer]
+	if !ok {
+		return
+	}
+	if s.completedSecrets[dealer] == nil {
+		s.completedSecrets[dealer] = make(map[int]bool)
+	}
+	if s.reconstructedValues[dealer] == nil {
+		s.reconstructedValues[dealer] = make(map[int]*big.Int)
+	}
+	for j, instanceID := range dealt {
+		secretIdx := j + 1
+		if s.shared[instanceID] && !s.completedSecrets[dealer][secretIdx] {
+			s.completedSecrets[dealer][secretIdx] = true
+			s.completedSecretsCount[dealer]++
+		}
+		if secret := s.revealed[instanceID]; secret != nil && s.reconstructedValues[dealer][secretIdx] == nil {
+			s.reconstructedValues[dealer][secretIdx] = secret
+			s.metrics.Inc("icc.reconstructions_complete")
+		}
+	}
+}
+
+// secretInstance returns the IVSS instance of secret j of dealer, or ""
+// while the Deal that names it is not delivered.
+func (s *ICCService) secretInstance(dealer, j int) string {
+	if !s.reuse {
+		return s.getInstanceID(dealer, j)
+	}
+	if dealt, ok := s.deals[dealer]; ok {
+		return dealt[j-1]
+	}
+	return ""
+}
+
+// reconstructedInstance reports whether the coin holds the secret of
+// instanceID.
+func (s *ICCService) reconstructedInstance(instanceID string) bool {
+	if s.reuse {
+		return s.revealed[instanceID] != nil
+	}
+	dealer, j, ok := s.parseInstanceID(instanceID)
+	return ok && s.reconstructedValues[dealer][j] != nil
+}
+
+// spareUnattached marks the sharing of secret j of this node spare when
+// T_j leaves the node out, so no correct node reconstructs it.
+func (s *ICCService) spareUnattached(j int, T []int) {
+	if !s.reuse || s.dealt == nil || slices.Contains(T, s.id) {
+		return
+	}
+	s.cp.MarkInvocationSpare(s.dealt[j-1])
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"slices"
+	"sort"
+)
+
+// ICCState is a snapshot of how far a coin got through the steps of ICC,
+// for finding the step a stalled round waits on without Debug logs. The
+// sets are those this node A-Cast, nil until it formed them.
+type ICCState struct {
+	Round  int
+	Phase  string // INIT, ATTACH_SENT, ACCEPT_SENT, FINAL_SETS_SENT or FINISHED
+	Held   bool   // Prepared and waiting for Start, see Prepare
+	Closed bool
+
+	// Step 1 & 2: sharings completed and the dealers all of whose n
+	// secrets were, which T grows with
+	Sharings int
+	Dealers  int
+	T        []int `json:",omitempty"`
+
+	// Step 3 & 4: payloads delivered from peers and the sets they gave
+	Attached  int   // T_j delivered
+	Accepted  int   // A_j delivered
+	FinalSets int   // (H_j, S_j) delivered
+	A         []int `json:",omitempty"`
+	S         []int `json:",omitempty"`
+	H         []int `json:",omitempty"`
+
+	// Step 5: reconstructions started and those that output a secret
+	Reconstructing int
+	Reconstructed  int
+
+	// Nodes whose payloads were discarded as malformed, see
+	// ICCService.suspect
+	Suspects []int `json:",omitempty"`
+}
+
+// Pending returns how many started reconstructions have no secret yet.
+func (st ICCState) Pending() int {
+	return st.Reconstructing - st.Reconstructed
+}
+
+// State returns a snapshot of the progress of the coin.
+func (s *ICCService) State() ICCState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := ICCState{
+		Round:     s.round,
+		Phase:     s.phase(),
+		Held:      s.held,
+		Closed:    s.closed,
+		T:         slices.Clone(s.myT),
+		Attached:  len(s.receivedT),
+		Accepted:  len(s.receivedA),
+		FinalSets: len(s.receivedFinalSets),
+		A:         slices.Clone(s.myA),
+		S:         slices.Clone(s.myS),
+		H:         slices.Clone(s.myH),
+	}
+	for _, count := range s.completedSecretsCount {
+		st.Sharings += count
+		if count == s.n {
+			st.Dealers++
+		}
+	}
+	for id := range s.startedReconstructions {
+		st.Reconstructing++
+		if s.reconstructedInstance(id) {
+			st.Reconstructed++
+		}
+	}
+	for j := range s.suspects {
+		st.Suspects = append(st.Suspects, j)
+	}
+	sort.Ints(st.Suspects)
+	return st
+}
+
+// CoinStates returns a snapshot of the coin of every round the node keeps,
+// by round.
+func (s *ABAService) CoinStates() []ICCState {
+	s.mu.Lock()
+	coins := make([]*ICCService, 0, len(s.icc))
+	for _, coin := range s.icc {
+		coins = append(coins, coin)
+	}
+	s.mu.Unlock()
+
+	states := make([]ICCState, 0, len(coins))
+	for _, coin := range coins {
+		states = append(states, coin.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Round < states[j].Round })
+	return states
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Invariant is a safety property checked against the merged event streams of
+// a cluster. Observe sees every event once, in arrival order, and reports a
+// violation as soon as one is visible; Finish reports what can only be judged
+// once the run is over.
+type Invariant interface {
+	Name() string
+	Observe(ev ProtocolEvent) *InvariantViolation
+	Finish() *InvariantViolation
+}
+
+// InvariantViolation describes a broken invariant. Trace holds the observed
+// events of the violating instance, up to the one that exposed it.
+type InvariantViolation struct {
+	Invariant string
+	Instance  string
+	Detail    string
+	Trace     []ProtocolEvent
+}
+
+func (v *InvariantViolation) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s violated", v.Invariant)
+	if v.Instance != "" {
+		fmt.Fprintf(&sb, " in %s", v.Instance)
+	}
+	fmt.Fprintf(&sb, ": %s", v.Detail)
+	for _, ev := range v.Trace {
+		fmt.Fprintf(&sb, "\n  %v", ev)
+	}
+	return sb.String()
+}
+
+func (ev ProtocolEvent) String() string {
+	if ev.Instance == "" {
+		return fmt.Sprintf("node %d %v %s", ev.Node, ev.Type, ev.Value)
+	}
+	return fmt.Sprintf("node %d %v %s %s", ev.Node, ev.Type, ev.Instance, ev.Value)
+}
+
+// nodeFilter reports whether events of a node are subject to an invariant.
+// An empty honest set means every node is honest.
+type nodeFilter map[int]bool
+
+func newNodeFilter(honest []int) nodeFilter {
+	f := make(nodeFilter, len(honest))
+	for _, id := range honest {
+		f[id] = true
+	}
+	return f
+}
+
+func (f nodeFilter) honest(id int) bool {
+	return len(f) == 0 || f[id]
+}
+
+// SafetyInvariants returns the invariants that hold at every point of any
+// run in which at most t nodes outside honest are faulty: A-Cast agreement,
+// IVSS correctness, and ABA agreement and validity.
+func SafetyInvariants(honest []int) []Invariant {
+	return []Invariant{
+		NewACastAgreement(honest),
+		NewIVSSCorrectness(honest),
+		NewABAAgreement(honest),
+		NewABAValidity(honest),
+	}
+}
+
+// ACastAgreement: no two honest nodes deliver different values for the same
+// A-Cast instance, and no honest node delivers an instance twice.
+type ACastAgreement struct {
+	nodes     nodeFilter
+	delivered map[string]map[int]string
+	first     map[string]string
+}
+
+func NewACastAgreement(honest []int) *ACastAgreement {
+	return &ACastAgreement{
+		nodes:     newNodeFilter(honest),
+		delivered: make(map[string]map[int]string),
+		first:     make(map[string]string),
+	}
+}
+
+func (a *ACastAgreement) Name() string { return "A-Cast agreement" }
+
+func (a *ACastAgreement) Observe(ev ProtocolEvent) *InvariantViolation {
+	if ev.Type != Event_ACastDelivered || !a.nodes.honest(ev.Node) {
+		return nil
+	}
+	if a.delivered[ev.Instance] == nil {
+		a.delivered[ev.Instance] = make(map[int]string)
+		a.first[ev.Instance] = ev.Value
+	}
+	if prev, ok := a.delivered[ev.Instance][ev.Node]; ok {
+		return &InvariantViolation{Instance: ev.Instance, Detail: fmt.Sprintf("node %d delivered twice (%q, then %q)", ev.Node, prev, ev.Value)}
+	}
+	a.delivered[ev.Instance][ev.Node] = ev.Value
+	if ev.Value != a.first[ev.Instance] {
+		return &InvariantViolation{Instance: ev.Instance, Detail: fmt.Sprintf("node %d delivered %q, others delivered %q", ev.Node, ev.Value, a.first[ev.Instance])}
+	}
+	return nil
+}
+
+func (a *ACastAgreement) Finish() *InvariantViolation { return nil }
+
+// ACastTotality: once an honest node delivers an A-Cast instance, every
+// honest node delivers it. Only checked by Finish, so it is only meaningful
+// for runs that were allowed to drain, e.g. a quiescent Simulation.
+type ACastTotality struct {
+	nodes     []int
+	delivered map[string]map[int]bool
+	order     []string
+}
+
+// NewACastTotality checks totality over honest, which must list every honest
+// node of the cluster.
+func NewACastTotality(honest []int) *ACastTotality {
+	return &ACastTotality{
+		nodes:     honest,
+		delivered: make(map[string]map[int]bool),
+	}
+}
+
+func (a *ACastTotality) Name() string { return "A-Cast totality" }
+
+func (a *ACastTotality) Observe(ev ProtocolEvent) *InvariantViolation {
+	if ev.Type != Event_ACastDelivered {
+		return nil
+	}
+	if a.delivered[ev.Instance] == nil {
+		a.delivered[ev.Instance] = make(map[int]bool)
+		a.order = append(a.order, ev.Instance)
+	}
+	a.delivered[ev.Instance][ev.Node] = true
+	return nil
+}
+
+func (a *ACastTotality) Finish() *InvariantViolation {
+	for _, instance := range a.order {
+		delivered := a.delivered[instance]
+		byHonest := false
+		var missing []int
+		for _, id := range a.nodes {
+			if delivered[id] {
+				byHonest = true
+			} else {
+				missing = append(missing, id)
+			}
+		}
+		if byHonest && len(missing) > 0 {
+			return &InvariantViolation{Instance: instance, Detail: fmt.Sprintf("nodes %v never delivered", missing)}
+		}
+	}
+	return nil
+}
+
+// IVSSCorrectness: honest nodes reconstruct the same secret for an instance,
+// and if the dealer is honest that secret is the one it dealt. Secrecy is not
+// observable from events and is not checked.
+type IVSSCorrectness struct {
+	nodes         nodeFilter
+	dealt         map[string]string
+	reconstructed map[string]string
+}
+
+func NewIVSSCorrectness(honest []int) *IVSSCorrectness {
+	return &IVSSCorrectness{
+		nodes:         newNodeFilter(honest),
+		dealt:         make(map[string]string),
+		reconstructed: make(map[string]string),
+	}
+}
+
+func (c *IVSSCorrectness) Name() string { return "IVSS correctness" }
+
+func (c *IVSSCorrectness) Observe(ev ProtocolEvent) *InvariantViolation {
+	if !c.nodes.honest(ev.Node) {
+		return nil
+	}
+	switch ev.Type {
+	case Event_IVSSDealt:
+		c.dealt[ev.Instance] = ev.Value
+		if rec, ok := c.reconstructed[ev.Instance]; ok && rec != ev.Value {
+			return &InvariantViolation{Instance: ev.Instance, Detail: fmt.Sprintf("honest dealer %d dealt %s, %s was reconstructed", ev.Node, ev.Value, rec)}
+		}
+	case Event_IVSSReconstructed:
+		if rec, ok := c.reconstructed[ev.Instance]; ok && rec != ev.Value {
+			return &InvariantViolation{Instance: ev.Instance, Detail: fmt.Sprintf("node %d reconstructed %s, others reconstructed %s", ev.Node, ev.Value, rec)}
+		}
+		c.reconstructed[ev.Instance] = ev.Value
+		if secret, ok := c.dealt[ev.Instance]; ok && secret != ev.Value {
+			return &InvariantViolation{Instance: ev.Instance, Detail: fmt.Sprintf("node %d reconstructed %s, honest dealer dealt %s", ev.Node, ev.Value, secret)}
+		}
+	}
+	return nil
+}
+
+func (c *IVSSCorrectness) Finish() *InvariantViolation { return nil }
+
+// ABAAgreement: all honest nodes decide the same value, each at most once.
+type ABAAgreement struct {
+	nodes    nodeFilter
+	decided  map[int]string
+	decision string
+}
+
+func NewABAAgreement(honest []int) *ABAAgreement {
+	return &ABAAgreement{
+		nodes:   newNodeFilter(honest),
+		decided: make(map[int]string),
+	}
+}
+
+func (a *ABAAgreement) Name() string { return "ABA agreement" }
+
+func (a *ABAAgreement) Observe(ev ProtocolEvent) *InvariantViolation {
+	if ev.Type != Event_ABADecided || !a.nodes.honest(ev.Node) {
+		return nil
+	}
+	if prev, ok := a.decided[ev.Node]; ok {
+		return &InvariantViolation{Detail: fmt.Sprintf("node %d decided twice (%s, then %s)", ev.Node, prev, ev.Value)}
+	}
+	if len(a.decided) == 0 {
+		a.decision = ev.Value
+	}
+	a.decided[ev.Node] = ev.Value
+	if ev.Value != a.decision {
+		return &InvariantViolation{Detail: fmt.Sprintf("node %d decided %s, others decided %s", ev.Node, ev.Value, a.decision)}
+	}
+	return nil
+}
+
+func (a *ABAAgreement) Finish() *InvariantViolation { return nil }
+
+// ABAValidity: an honest decision is the input of some honest node, so if all
+// honest nodes start with v they decide v. Decisions are judged once the
+// inputs of all honest nodes have been observed.
+type ABAValidity struct {
+	nodes   []int
+	inputs  map[int]string
+	decided map[int]string
+}
+
+// NewABAValidity checks validity over honest, which must list every honest
+// node of the cluster.
+func NewABAValidity(honest []int) *ABAValidity {
+	return &ABAValidity{
+		nodes:   honest,
+		inputs:  make(map[int]string),
+		decided: make(map[int]string),
+	}
+}
+
+func (a *ABAValidity) Name() string { return "ABA validity" }
+
+func (a *ABAValidity) isHonest(id int) bool {
+	for _, h := range a.nodes {
+		if h == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ABAValidity) Observe(ev ProtocolEvent) *InvariantViolation {
+	if !a.isHonest(ev.Node) {
+		return nil
+	}
+	switch ev.Type {
+	case Event_ABAStarted:
+		a.inputs[ev.Node] = ev.Value
+	case Event_ABADecided:
+		a.decided[ev.Node] = ev.Value
+	default:
+		return nil
+	}
+	return a.check()
+}
+
+func (a *ABAValidity) check() *InvariantViolation {
+	if len(a.inputs) < len(a.nodes) {
+		return nil
+	}
+	for _, id := range a.nodes {
+		d, ok := a.decided[id]
+		if !ok {
+			continue
+		}
+		valid := false
+		for _, in := range a.inputs {
+			if in == d {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return &InvariantViolation{Detail: fmt.Sprintf("node %d decided %s, no honest node started with it", id, d)}
+		}
+	}
+	return nil
+}
+
+func (a *ABAValidity) Finish() *InvariantViolation { return nil }
+
+// InvariantChecker feeds the event streams of a cluster to a set of
+// invariants and keeps the first violation. It is safe for concurrent use.
+//
+//	checker := services.NewInvariantChecker(services.SafetyInvariants(honest)...)
+//	checker.OnViolation(func(err error) { t.Error(err) })
+//	cancel := checker.Subscribe(buses...)
+//	// run the cluster
+//	cancel()
+//	if err := checker.Finish(); err != nil { t.Fatal(err) }
+type InvariantChecker struct {
+	invariants  []Invariant
+	trace       []ProtocolEvent
+	violation   *InvariantViolation
+	onViolation func(error)
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+}
+
+func NewInvariantChecker(invariants ...Invariant) *InvariantChecker {
+	return &InvariantChecker{invariants: invariants}
+}
+
+// OnViolation registers fn to be called once, with the first violation, as
+// soon as it is detected.
+func (c *InvariantChecker) OnViolation(fn func(error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onViolation = fn
+}
+
+// Observe checks one event and returns the first violation seen so far.
+// Events after the first violation are still recorded but not checked.
+func (c *InvariantChecker) Observe(ev ProtocolEvent) error {
+	c.mu.Lock()
+	c.trace = append(c.trace, ev)
+	if c.violation != nil {
+		c.mu.Unlock()
+		return c.violation
+	}
+	for _, inv := range c.invariants {
+		if v := inv.Observe(ev); v != nil {
+			c.fail(inv, v)
+			break
+		}
+	}
+	return c.report()
+}
+
+// Watch observes every event of streams until they are closed.
+func (c *InvariantChecker) Watch(streams ...<-chan ProtocolEvent) {
+	for _, stream := range streams {
+		c.wg.Add(1)
+		go func(stream <-chan ProtocolEvent) {
+			defer c.wg.Done()
+			for ev := range stream {
+				c.Observe(ev)
+			}
+		}(stream)
+	}
+}
+
+// Subscribe watches the event buses of a cluster. The returned function
+// cancels the subscriptions, after which Finish can be called.
+func (c *InvariantChecker) Subscribe(buses ...*EventBus) func() {
+	cancels := make([]func(), 0, len(buses))
+	for _, bus := range buses {
+		stream, cancel := bus.Subscribe()
+		c.Watch(stream)
+		cancels = append(cancels, cancel)
+	}
+	return func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
+
+// Err returns the first violation seen so far, or nil.
+func (c *InvariantChecker) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.violation == nil {
+		return nil
+	}
+	return c.violation
+}
+
+// Finish waits until all watched streams are closed, runs the end-of-run
+// checks and returns the first violation, or nil.
+func (c *InvariantChecker) Finish() error {
+	c.wg.Wait()
+	c.mu.Lock()
+	if c.violation == nil {
+		for _, inv := range c.invariants {
+			if v := inv.Finish(); v != nil {
+				c.fail(inv, v)
+				break
+			}
+		}
+	}
+	return c.report()
+}
+
+// Trace returns a copy of every event observed so far.
+func (c *InvariantChecker) Trace() []ProtocolEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ProtocolEvent(nil), c.trace...)
+}
+
+// fail records v, raised by inv, with the trace slice of the violating
+// instance. ABA events carry no instance, so an ABA violation gets all of
+// them. Assumes c.mu is locked.
+func (c *InvariantChecker) fail(inv Invariant, v *InvariantViolation) {
+	v.Invariant = inv.Name()
+	for _, e := range c.trace {
+		if e.Instance == v.Instance {
+			v.Trace = append(v.Trace, e)
+		}
+	}
+	c.violation = v
+}
+
+// report unlocks c.mu, calling the violation callback first if a violation
+// was just recorded, and returns the current violation.
+func (c *InvariantChecker) report() error {
+	v, fn := c.violation, c.onViolation
+	if v != nil {
+		c.onViolation = nil
+	}
+	c.mu.Unlock()
+	if v == nil {
+		return nil
+	}
+	if fn != nil {
+		fn(v)
+	}
+	return v
+}
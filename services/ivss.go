@@ -2,11 +2,17 @@ package services
 
 import (
 	"async-agreement-protocol-3/utils"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
+	"runtime"
 	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -20,6 +26,8 @@ const (
 	Payload_MSet
 	Payload_Reveal
 	Payload_Ready
+	Payload_Commit
+	Payload_Blame // Proof that the dealer misbehaved, see IVSSBlame
 )
 
 // IVSSPayload is the data structure serialized into the A-Cast value string
@@ -28,9 +36,12 @@ type IVSSPayload struct {
 	Type       IVSSPayloadType
 	// Data fields
 	EqualPair    [2]int            `json:",omitempty"`
-	MSet         []int             `json:",omitempty"`
+	MSet         utils.NodeSet     `json:",omitempty"`
 	RevealPoly   *utils.Polynomial `json:",omitempty"`
-	RevealSender int               `json:",omitempty"`
+	RevealSender int               `json:",omitempty"` // Sender of a REVEAL or READY, proposer of an assisted M-Set
+	Commitment   []*big.Int        `json:",omitempty"` // Feldman commitment of the dealer, see utils.Commit
+	Secrets      int               `json:",omitempty"` // M-Set of a batch: how many secrets it shares
+	Blame        *IVSSBlame        `json:",omitempty"`
 }
 
 func (p IVSSPayload) String() string {
@@ -38,6 +49,16 @@ func (p IVSSPayload) String() string {
 	return string(b)
 }
 
+// Digest identifies the payload in an A-Cast of payloads, see
+// NewAcastServiceWithDigest.
+func (p IVSSPayload) Digest() [32]byte {
+	hash, err := CanonicalHash(p)
+	if err != nil {
+		return sha256.Sum256([]byte(p.String()))
+	}
+	return hash
+}
+
 func ParseIVSSPayload(s string) (*IVSSPayload, error) {
 	var p IVSSPayload
 	err := json.Unmarshal([]byte(s), &p)
@@ -47,6 +68,65 @@ func ParseIVSSPayload(s string) (*IVSSPayload, error) {
 	return &p, nil
 }
 
+// Validate checks that the payload is well-formed for a cluster of n nodes.
+func (p *IVSSPayload) Validate(n int) error {
+	if err := validateIVSSID(p.InstanceID, n); err != nil {
+		return err
+	}
+	switch p.Type {
+	case Payload_Equal:
+		if !validNodeID(p.EqualPair[0], n) || !validNodeID(p.EqualPair[1], n) {
+			return fmt.Errorf("EQUAL pair %v out of range", p.EqualPair)
+		}
+	case Payload_MSet:
+		if err := validateNodeSet(p.MSet, n); err != nil {
+			return fmt.Errorf("invalid M-Set: %w", err)
+		}
+		if p.RevealSender != 0 && !validNodeID(p.RevealSender, n) {
+			return fmt.Errorf("M-Set proposer %d out of range", p.RevealSender)
+		}
+		if p.Secrets < 0 || p.Secrets > MaxIVSSBatch {
+			return fmt.Errorf("batch of %d secrets", p.Secrets)
+		}
+	case Payload_Reveal:
+		if !validNodeID(p.RevealSender, n) {
+			return fmt.Errorf("reveal sender %d out of range", p.RevealSender)
+		}
+		if err := validatePolynomial(p.RevealPoly, n); err != nil {
+			return fmt.Errorf("invalid revealed polynomial: %w", err)
+		}
+	case Payload_Ready:
+		if !validNodeID(p.RevealSender, n) {
+			return fmt.Errorf("ready sender %d out of range", p.RevealSender)
+		}
+	case Payload_Commit:
+		if _, err := utils.NewCommitment(p.Commitment); err != nil {
+			return fmt.Errorf("invalid commitment: %w", err)
+		}
+	case Payload_Blame:
+		if p.Blame == nil {
+			return fmt.Errorf("blame without a proof")
+		}
+		if p.Blame.InstanceID != p.InstanceID {
+			return fmt.Errorf("blame of %s in instance %s", p.Blame.InstanceID, p.InstanceID)
+		}
+		if err := p.Blame.validate(n); err != nil {
+			return fmt.Errorf("invalid blame: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown IVSS payload type %d", p.Type)
+	}
+	return nil
+}
+
+// batchable reports whether the payload may share an A-Cast instance with
+// others. EQUALs and READYs are small and idempotent, and only the first
+// REVEAL of a sender counts; the M-Set keeps its own instance, whose UUID
+// makes sure each dealer gets only one.
+func (p *IVSSPayload) batchable() bool {
+	return p.Type == Payload_Equal || p.Type == Payload_Ready || p.Type == Payload_Reveal
+}
+
 // IVSSMsgType distinguishes between direct messages and A-Cast wrapper messages
 type IVSSMsgType int
 
@@ -61,6 +141,14 @@ type DirectMsgType int
 const (
 	Direct_Share DirectMsgType = iota
 	Direct_Point
+	Direct_BatchShare // Shares of every secret of a batch, see StartBatchSharing
+	Direct_BatchPoint
+	Direct_ShareRequest  // Asks for the point of a share this node lacks, see RecoverShare
+	Direct_ShareResponse // Point answering a Direct_ShareRequest
+	Direct_PrivateReveal // Share sent to the receiver of a private reconstruction
+	Direct_Watchdog      // Sent by a node to itself to check an instance, see NodeContext.IVSSWatchdog
+	Direct_DualShare     // Row and column of a dual-threshold sharing, see NodeContext.IVSSDualThreshold
+	Direct_DualPoint     // Points of a row and a column, for Direct_DualShare
 )
 
 // IVSSMessage is the main message type exchanged by IVSS services
@@ -68,25 +156,137 @@ type IVSSMessage struct {
 	Type IVSSMsgType
 
 	// For Direct Messages
-	DirectType DirectMsgType     `json:",omitempty"`
-	To         int               `json:",omitempty"` // Intended recipient
-	From       int               `json:",omitempty"`
-	InstanceID string            `json:",omitempty"`
-	Poly       *utils.Polynomial `json:",omitempty"` // For Share
-	Point      *big.Int          `json:",omitempty"` // For Point
-	PointIdx   int               `json:",omitempty"` // j for f_k(j)
+	DirectType DirectMsgType       `json:",omitempty"`
+	To         int                 `json:",omitempty"` // Intended recipient
+	From       int                 `json:",omitempty"`
+	InstanceID string              `json:",omitempty"`
+	Poly       *utils.Polynomial   `json:",omitempty"` // For Share
+	Point      *big.Int            `json:",omitempty"` // For Point
+	PointIdx   int                 `json:",omitempty"` // j for f_k(j)
+	Polys      []*utils.Polynomial `json:",omitempty"` // For BatchShare, one per secret; row and column for DualShare
+	Points     []*big.Int          `json:",omitempty"` // For BatchPoint, one per secret; F(k, j) and F(j, k) for DualPoint
+	Sealed     []byte              `json:",omitempty"` // Poly or Point encrypted for To, see ShareKeyring
+	Signature  []byte              `json:",omitempty"` // Of a Share or Point by its sender, see IVSSBlame
 
 	// For A-Cast Messages
 	ACastMsg *ACastMessage[string] `json:",omitempty"`
 }
 
+// MaxIVSSBatch bounds the number of secrets one batch may share.
+const MaxIVSSBatch = 1024
+
+// IVSSInstanceID names the sharing called name that dealer deals. Nodes
+// take the dealer of an instance from its ID and accept shares from the
+// dealer only, so no other node can deal in its place.
+func IVSSInstanceID(name string, dealer int) string {
+	return IVSSID{Dealer: dealer, Tag: name}.String()
+}
+
+// IVSSDealer returns the dealer an instance ID names, or false if it is
+// malformed, see ParseIVSSID.
+func IVSSDealer(id string) (int, bool) {
+	parsed, err := ParseIVSSID(id)
+	if err != nil {
+		return 0, false
+	}
+	return parsed.Dealer, true
+}
+
+// IVSSBatchSecretID names secret i (from 1) of the batch instance id, which
+// is reconstructed as an instance of its own: "name@dealer" becomes
+// "name-i@dealer".
+func IVSSBatchSecretID(id string, i int) string {
+	return withTagSuffix(id, "-"+strconv.Itoa(i))
+}
+
+// validateDirect checks the fields of a direct message for a cluster of n nodes.
+func (m *IVSSMessage) validateDirect(n int) error {
+	if !validNodeID(m.From, n) {
+		return fmt.Errorf("sender %d out of range", m.From)
+	}
+	if err := validateIVSSID(m.InstanceID, n); err != nil {
+		return err
+	}
+	switch m.DirectType {
+	case Direct_Share:
+		if dealer, ok := IVSSDealer(m.InstanceID); !ok || dealer != m.From {
+			return fmt.Errorf("share from %d, who is not the dealer of %s", m.From, m.InstanceID)
+		}
+		if err := validatePolynomial(m.Poly, n); err != nil {
+			return fmt.Errorf("invalid share: %w", err)
+		}
+	case Direct_Point:
+		if m.Point == nil || m.Point.Sign() < 0 || m.Point.Cmp(utils.Prime) >= 0 {
+			return fmt.Errorf("point is not a field element")
+		}
+	case Direct_PrivateReveal:
+		if err := validatePolynomial(m.Poly, n); err != nil {
+			return fmt.Errorf("invalid revealed share: %w", err)
+		}
+	case Direct_ShareRequest, Direct_Watchdog:
+	case Direct_ShareResponse:
+		if m.Point == nil || m.Point.Sign() < 0 || m.Point.Cmp(utils.Prime) >= 0 {
+			return fmt.Errorf("point is not a field element")
+		}
+	case Direct_BatchShare:
+		if dealer, ok := IVSSDealer(m.InstanceID); !ok || dealer != m.From {
+			return fmt.Errorf("share from %d, who is not the dealer of %s", m.From, m.InstanceID)
+		}
+		if len(m.Polys) == 0 || len(m.Polys) > MaxIVSSBatch {
+			return fmt.Errorf("batch of %d shares", len(m.Polys))
+		}
+		for i, p := range m.Polys {
+			if err := validatePolynomial(p, n); err != nil {
+				return fmt.Errorf("invalid share %d: %w", i+1, err)
+			}
+		}
+	case Direct_DualShare:
+		if dealer, ok := IVSSDealer(m.InstanceID); !ok || dealer != m.From {
+			return fmt.Errorf("share from %d, who is not the dealer of %s", m.From, m.InstanceID)
+		}
+		if len(m.Polys) != 2 {
+			return fmt.Errorf("dual share of %d polynomials", len(m.Polys))
+		}
+		for i, p := range m.Polys {
+			if err := validatePolynomial(p, n); err != nil {
+				return fmt.Errorf("invalid share %d: %w", i+1, err)
+			}
+		}
+	case Direct_DualPoint:
+		if len(m.Points) != 2 {
+			return fmt.Errorf("dual point of %d values", len(m.Points))
+		}
+		for i, p := range m.Points {
+			if p == nil || p.Sign() < 0 || p.Cmp(utils.Prime) >= 0 {
+				return fmt.Errorf("point %d is not a field element", i+1)
+			}
+		}
+	case Direct_BatchPoint:
+		if len(m.Points) == 0 || len(m.Points) > MaxIVSSBatch {
+			return fmt.Errorf("batch of %d points", len(m.Points))
+		}
+		for i, p := range m.Points {
+			if p == nil || p.Sign() < 0 || p.Cmp(utils.Prime) >= 0 {
+				return fmt.Errorf("point %d is not a field element", i+1)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown direct message type %d", m.DirectType)
+	}
+	return nil
+}
+
 // IVSSResult is the output of the IVSS service
 type IVSSResult struct {
-	InstanceID string
-	Type       string // "SHARING_COMPLETE" or "RECONSTRUCTED"
-	Secret     *big.Int
-	MSet       []int
-	Poly       *utils.Polynomial
+	InstanceID  string
+	Type        string // "SHARING_COMPLETE", "RECONSTRUCTED", "PRIVATELY_RECONSTRUCTED", "SHARE_RECOVERED", "RESHARED", "BLAME" or "STALLED"
+	Secret      *big.Int
+	MSet        []int
+	Poly        *utils.Polynomial
+	Blame       *IVSSBlame         // Of a BLAME
+	State       *IVSSInstanceState // Of a STALLED
+	Column      *utils.Polynomial  // Dual threshold: F(x, k), whose F(0, k) is our share of degree 2t
+	Certificate *IVSSCertificate   // Of a SHARING_COMPLETE
 }
 
 // IVSSInstance holds the state for one IVSS protocol instance
@@ -98,18 +298,73 @@ type IVSSInstance struct {
 	// Sharing Phase
 	receivedPoly     *utils.Polynomial
 	receivedPoints   map[int]*big.Int
-	earlyPoints      map[int]*big.Int // Points received before the share
+	earlyPoints      map[int][]*big.Int // Points received before the share
 	consistentPeers  map[int]bool
 	completedEquals  map[[2]int]bool // Tracks "EQUAL:(i,j)" completions
 	mSet             []int
-	pendingMSet      []int // Store M-Set if received before all EQUALs
+	pendingMSet      []int         // Store M-Set if received before all EQUALs
+	sentMSet         bool          // M-Set already A-Cast, by the dealer or as a proposal
+	proposedMSets    map[int][]int // Assisted M-Sets by proposer, see NodeContext.IVSSAssistMSet
+	mSetProposer     int           // Proposer of the assisted M-Set the sharing completed with
 	sharingCompleted bool
+	certificate      *IVSSCertificate // Of a batch secret, made by completeBatch
+
+	// Commitment mode: the dealer's commitment, and a share that arrived
+	// before it
+	commitment   *utils.Commitment
+	pendingShare *utils.Polynomial
+
+	// Blames: the share the dealer signed for this node with its signature,
+	// the signatures of the points received, the faulty pairs blames
+	// proved, and blames waiting for the commitment to be checked
+	signedShare     *utils.Polynomial
+	shareSignature  []byte
+	pointSignatures map[int][]byte
+	blames          map[[2]int]bool
+	pendingBlames   []IVSSBlame
+
+	// Batch sharing: this node's share of each secret, and how many secrets
+	// the batch has, as the dealer's M-Set says
+	batch   []*utils.Polynomial
+	secrets int
+
+	// Dual-threshold sharing: F(x, k), with receivedPoly holding F(k, y)
+	column *utils.Polynomial
+
+	// Field of the secret, see NodeContext.IVSSField
+	field *utils.Field
+
+	// Share recovery: whether this node asked for its share, the points it
+	// got back, and the requests to answer once the sharing completes
+	recovering     bool
+	recoveryPoints map[int]*big.Int
+	shareRequests  map[int]bool
+
+	// Resharing: how many refreshes were applied, how many the dealer
+	// started, and completed refreshes waiting for their turn
+	epoch     int
+	reshares  int
+	refreshes map[int]ivssRefresh
+
+	// Private reconstruction toward this node: the shares sent to it, and
+	// the secret once decoded
+	privatePolys  map[int]*utils.Polynomial
+	privateSecret *big.Int
 
 	// Reconstruction Phase
+	revealed           bool // This node started the reconstruction, see StartReconstruction
 	reconstructedPolys map[int]*utils.Polynomial
 	readyToComplete    map[int]bool
 	reconstructed      bool
 	secret             *big.Int
+
+	completedAt time.Time // Last completed sharing or reconstruction, see IVSSRetention
+
+	// Watchdog, see NodeContext.IVSSWatchdog
+	createdAt  time.Time
+	progressAt time.Time // Last share, EQUAL or M-Set
+	watching   bool
+	stalled    bool // Reported since the last progress
 }
 
 func NewIVSSInstance(id string, dealer int) *IVSSInstance {
@@ -117,11 +372,44 @@ func NewIVSSInstance(id string, dealer int) *IVSSInstance {
 		id:                 id,
 		dealer:             dealer,
 		receivedPoints:     make(map[int]*big.Int),
-		earlyPoints:        make(map[int]*big.Int),
+		earlyPoints:        make(map[int][]*big.Int),
 		consistentPeers:    make(map[int]bool),
 		completedEquals:    make(map[[2]int]bool),
 		reconstructedPolys: make(map[int]*utils.Polynomial),
 		readyToComplete:    make(map[int]bool),
+		recoveryPoints:     make(map[int]*big.Int),
+		shareRequests:      make(map[int]bool),
+		proposedMSets:      make(map[int][]int),
+		refreshes:          make(map[int]ivssRefresh),
+		privatePolys:       make(map[int]*utils.Polynomial),
+		pointSignatures:    make(map[int][]byte),
+		blames:             make(map[[2]int]bool),
+		createdAt:          time.Now(),
+		progressAt:         time.Now(),
+	}
+}
+
+// shares returns this node's share of each secret of the instance, or nil
+// while it has none.
+func (inst *IVSSInstance) shares() []*utils.Polynomial {
+	if inst.batch != nil {
+		return inst.batch
+	}
+	if inst.receivedPoly != nil {
+		return []*utils.Polynomial{inst.receivedPoly}
+	}
+	return nil
+}
+
+// phase names the abstract state of the instance for conformance checking.
+func (inst *IVSSInstance) phase() string {
+	switch {
+	case inst.reconstructed:
+		return "RECONSTRUCTED"
+	case inst.sharingCompleted:
+		return "SHARED"
+	default:
+		return "INIT"
 	}
 }
 
@@ -132,58 +420,143 @@ type IVSSService struct {
 	t      int
 	acast  *AcastService[string]
 	cp     *CertificationProtocol
+	events *EventBus
+	hook   TransitionHook
+	rand   io.Reader
+	nonce  func() int64 // Of the REVEAL batches, see StartReconstructions
 	logger zerolog.Logger
 
+	metrics *Metrics
+
+	// Whether dealers commit to their polynomial, see
+	// NodeContext.IVSSCommitments
+	commitments bool
+
+	// Whether this node deals dual-threshold sharings, see
+	// NodeContext.IVSSDualThreshold
+	dual bool
+
+	// Goroutines computing the shares this node deals, see
+	// NodeContext.IVSSDealerWorkers
+	dealerWorkers int
+
+	// Field of each instance, see NodeContext.IVSSField
+	fieldOf func(instanceID string) *utils.Field
+
+	// Whether any node may propose the M-Set, see NodeContext.IVSSAssistMSet
+	assistMSet bool
+
+	// Optional, encrypts shares and points, see NodeContext.ShareKeys
+	sealer *shareSealer
+
+	// Optional PKI, signs shares and points for blames, see IVSSBlame
+	signingKey ed25519.PrivateKey
+	keyring    *Keyring
+
+	// Reports stalled sharings when positive, see NodeContext.IVSSWatchdog
+	watchdog time.Duration
+
+	retention IVSSRetention
+	archive   IVSSArchive     // Optional, keeps evicted instances
+	evicted   map[string]bool // IDs of evicted instances
+
+	// Optional, combines EQUAL and READY A-Casts, see
+	// NodeContext.ACastBatchWindow
+	batcher *acastBatcher
+
 	instances map[string]*IVSSInstance
 	mu        sync.Mutex
 }
 
 func NewIVSSService(id, n, t int, cp *CertificationProtocol, logLevel zerolog.Level) *IVSSService {
+	return NewIVSSServiceWithContext(newNodeContextFor(id, n, t, cp, logLevel))
+}
+
+// NewIVSSServiceWithContext creates an IVSSService using the shared state of a node.
+func NewIVSSServiceWithContext(nc *NodeContext) *IVSSService {
 	logger := log.With().
 		Str("layer", "IVSS").
-		Int("node_id", id).
+		Int("node_id", nc.ID).
 		Logger().
-		Level(logLevel)
+		Level(nc.LogLevel)
 
 	// Create internal A-Cast service
 	// Note: The A-Cast service needs a context to broadcast.
 	// We will provide an adapter context when calling OnMessage.
-	acastSvc := NewAcastService[string](id, n, t, logLevel)
-
-	return &IVSSService{
-		id:        id,
-		n:         n,
-		t:         t,
-		acast:     acastSvc,
-		cp:        cp,
-		logger:    logger,
-		instances: make(map[string]*IVSSInstance),
+	acastSvc := NewAcastServiceWithContext[string](nc)
+	acastSvc.SetValidator(batchValidator(payloadValidator(ParseIVSSPayload, nc.N), func(val string) bool {
+		p, err := ParseIVSSPayload(val)
+		return err == nil && p.batchable()
+	}))
+
+	svc := &IVSSService{
+		id:            nc.ID,
+		n:             nc.N,
+		t:             nc.T,
+		acast:         acastSvc,
+		cp:            nc.CP,
+		events:        nc.Events,
+		hook:          nc.Transitions,
+		rand:          nc.random(),
+		nonce:         nc.nonce,
+		logger:        logger,
+		metrics:       nc.Metrics,
+		commitments:   nc.IVSSCommitments,
+		dual:          nc.IVSSDualThreshold,
+		dealerWorkers: nc.IVSSDealerWorkers,
+		fieldOf:       nc.IVSSField,
+		assistMSet:    nc.IVSSAssistMSet,
+		sealer:        newShareSealer(nc),
+		retention:     nc.IVSSRetention,
+		archive:       nc.IVSSArchive,
+		evicted:       make(map[string]bool),
+		batcher:       newACastBatcher(nc),
+		watchdog:      nc.IVSSWatchdog,
+		instances:     make(map[string]*IVSSInstance),
 	}
-}
-
-func (s *IVSSService) getInstance(id string, dealer int) *IVSSInstance {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.instances[id]; !ok {
-		s.instances[id] = NewIVSSInstance(id, dealer)
+	if svc.dealerWorkers == 0 {
+		svc.dealerWorkers = runtime.GOMAXPROCS(0)
+	}
+	if nc.SigningKey != nil && nc.Keyring != nil {
+		svc.signingKey, svc.keyring = nc.SigningKey, nc.Keyring
 	}
-	return s.instances[id]
+	return svc
 }
 
-// StartSharing initiates the sharing phase (Dealer only)
+// StartSharing initiates the sharing phase (Dealer only). instanceID must
+// name this node as the dealer, see IVSSInstanceID.
 func (s *IVSSService) StartSharing(instanceID string, secret *big.Int, ctx ServiceContext[IVSSMessage, IVSSResult]) error {
+	if dealer, ok := IVSSDealer(instanceID); !ok || dealer != s.id {
+		return fmt.Errorf("instance %s is not dealt by node %d", instanceID, s.id)
+	}
+	if err := s.checkSecret(instanceID, secret); err != nil {
+		return err
+	}
+	if s.dual {
+		return s.startDualSharing(instanceID, secret, ctx)
+	}
+
 	// 1. Select random symmetric polynomial F(x,y)
-	poly, err := utils.NewRandomSymmetricPolynomial(s.t, secret)
+	poly, err := s.field(instanceID).NewRandomSymmetricPolynomial(s.rand, s.t, secret)
 	if err != nil {
 		return err
 	}
 
 	s.logger.Info().Str("instance", instanceID).Msg("Starting Sharing as Dealer")
+	s.events.Publish(ProtocolEvent{Node: s.id, Type: Event_IVSSDealt, Instance: instanceID, Value: secret.String()})
+
+	if s.committed(instanceID) {
+		s.startACast(IVSSPayload{
+			InstanceID: instanceID,
+			Type:       Payload_Commit,
+			Commitment: utils.Commit(poly).Values,
+		}, ctx)
+	}
 
 	// 2. Send f_k(y) = F(k, y) to each process k
+	rows := poly.Rows(s.n, s.dealerWorkers)
 	for k := 1; k <= s.n; k++ {
-		kBig := big.NewInt(int64(k))
-		fk := poly.GetUnivariatePolynomial(kBig)
+		fk := rows[k-1]
 
 		// Send directly
 		msg := IVSSMessage{
@@ -195,46 +568,163 @@ func (s *IVSSService) StartSharing(instanceID string, secret *big.Int, ctx Servi
 			Poly:       fk,
 		}
 
-		// If sending to self, we can optimize or just let it loopback if network supports it.
-		// Assuming network supports loopback or we handle it.
-		// For now, just broadcast with "To" field.
-		ctx.Broadcast(msg)
+		// Only k may see its share; our own copy loops back through the network
+		s.sendDirect(msg, ctx)
 	}
 	return nil
 }
 
+// StartBatchSharing shares secrets under one instance (Dealer only): one
+// bivariate polynomial per secret, with one share per node, one point per
+// pair of nodes, one EQUAL per pair and one M-Set for all of them. Secret i
+// (from 1) completes and is reconstructed as the instance
+// IVSSBatchSecretID(instanceID, i). Commitments do not cover batches.
+func (s *IVSSService) StartBatchSharing(instanceID string, secrets []*big.Int, ctx ServiceContext[IVSSMessage, IVSSResult]) error {
+	if dealer, ok := IVSSDealer(instanceID); !ok || dealer != s.id {
+		return fmt.Errorf("instance %s is not dealt by node %d", instanceID, s.id)
+	}
+	if len(secrets) == 0 || len(secrets) > MaxIVSSBatch {
+		return fmt.Errorf("cannot share a batch of %d secrets", len(secrets))
+	}
+	if s.committed(instanceID) {
+		return fmt.Errorf("commitments do not cover batches")
+	}
+	if s.dual {
+		return fmt.Errorf("dual-threshold sharing does not cover batches")
+	}
+
+	polys := make([]*utils.SymmetricPolynomial, len(secrets))
+	for i, secret := range secrets {
+		if err := s.checkSecret(instanceID, secret); err != nil {
+			return err
+		}
+		poly, err := s.field(instanceID).NewRandomSymmetricPolynomial(s.rand, s.t, secret)
+		if err != nil {
+			return err
+		}
+		polys[i] = poly
+	}
+	inst := s.lookup(instanceID, false)
+	if inst == nil {
+		return fmt.Errorf("instance %s was evicted", instanceID)
+	}
+	inst.mu.Lock()
+	inst.secrets = len(secrets)
+	inst.mu.Unlock()
+
+	s.logger.Info().Str("instance", instanceID).Int("secrets", len(secrets)).Msg("Starting Batch Sharing as Dealer")
+	for i, secret := range secrets {
+		s.events.Publish(ProtocolEvent{Node: s.id, Type: Event_IVSSDealt, Instance: IVSSBatchSecretID(instanceID, i+1), Value: secret.String()})
+	}
+
+	rows := make([][]*utils.Polynomial, len(polys))
+	for i, poly := range polys {
+		rows[i] = poly.Rows(s.n, s.dealerWorkers)
+	}
+	for k := 1; k <= s.n; k++ {
+		fks := make([]*utils.Polynomial, len(polys))
+		for i := range polys {
+			fks[i] = rows[i][k-1]
+		}
+		s.sendDirect(IVSSMessage{
+			Type:       IVSS_Direct,
+			DirectType: Direct_BatchShare,
+			To:         k,
+			From:       s.id,
+			InstanceID: instanceID,
+			Polys:      fks,
+		}, ctx)
+	}
+	return nil
+}
+
+func (s *IVSSService) transition(inst *IVSSInstance, action, from string, counts map[string]int) {
+	s.hook.emit(StateTransition{Node: s.id, Layer: Layer_IVSS, Instance: inst.id, Action: action, From: from, To: inst.phase(), Counts: counts})
+}
+
 // StartReconstruction initiates the reconstruction phase
 func (s *IVSSService) StartReconstruction(instanceID string, ctx ServiceContext[IVSSMessage, IVSSResult]) error {
-	inst := s.getInstance(instanceID, 0)
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	payload, err := s.reveal(instanceID, results)
+	if err == nil && payload != nil {
+		s.startACast(*payload, results)
+	}
+	return err
+}
+
+// StartReconstructions starts the reconstruction of every instance of ids
+// like StartReconstruction, but A-Casts the REVEALs in one batch. It
+// returns the instances it started or had started before, and skips the
+// others, e.g. those whose sharing is not complete yet.
+func (s *IVSSService) StartReconstructions(ids []string, ctx ServiceContext[IVSSMessage, IVSSResult]) []string {
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	var started []string
+	var batch ACastBatch
+	for _, id := range ids {
+		payload, err := s.reveal(id, results)
+		if err != nil {
+			continue
+		}
+		started = append(started, id)
+		if payload != nil {
+			batch.Batch = append(batch.Batch, payload.String())
+		}
+	}
+	switch len(batch.Batch) {
+	case 0:
+	case 1:
+		p, _ := ParseIVSSPayload(batch.Batch[0])
+		s.startACast(*p, results)
+	default:
+		s.metrics.Inc("ivss.reveal_batches")
+		s.metrics.Add("ivss.batched_reveals", int64(len(batch.Batch)))
+		msg := newACastMessage(batch.String(), s.id, s.nonce())
+		results.Broadcast(IVSSMessage{Type: IVSS_ACast, ACastMsg: &msg})
+	}
+	return started
+}
+
+// reveal starts the reconstruction of instance id and returns the REVEAL
+// of this node's share to A-Cast, nil if it has no share or revealed it
+// before: each node starts a reconstruction at most once.
+func (s *IVSSService) reveal(instanceID string, ctx ServiceContext[IVSSMessage, IVSSResult]) (*IVSSPayload, error) {
+	inst := s.lookup(instanceID, true)
+	if inst == nil {
+		return nil, fmt.Errorf("instance %s was evicted and cannot be restored", instanceID)
+	}
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
 
 	if !inst.sharingCompleted {
-		return fmt.Errorf("sharing not completed for instance %s", instanceID)
+		return nil, fmt.Errorf("sharing not completed for instance %s", instanceID)
 	}
-
-	// Check if I am in M
-	inM := false
-	for _, id := range inst.mSet {
-		if id == s.id {
-			inM = true
-			break
-		}
+	if inst.secrets > 0 {
+		return nil, fmt.Errorf("instance %s is a batch, its secrets are reconstructed one by one", instanceID)
 	}
+	if inst.revealed {
+		s.metrics.Inc("ivss.reconstructions.repeated")
+		return nil, nil
+	}
+	inst.revealed = true
 
-	if inM {
-		// A-Cast my stored polynomial f_k
-		payload := IVSSPayload{
-			InstanceID:   inst.id,
-			Type:         Payload_Reveal,
-			RevealPoly:   inst.receivedPoly,
-			RevealSender: s.id,
-		}
-		s.startACast(payload, ctx)
-	} else {
-		s.logger.Info().Msg("Not in M set, skipping reconstruction initiation")
+	// The secret becomes public, so it can no longer be reused
+	s.cp.MarkInvocationConsumed(instanceID)
+	s.transition(inst, "START_RECONSTRUCTION", inst.phase(), nil)
+
+	// Everyone with a share reveals it; nodes outside M only count if M
+	// vouches for their share (see checkInterpolationSet)
+	if inst.receivedPoly == nil {
+		s.logger.Info().Str("instance", inst.id).Msg("No share, skipping reconstruction initiation")
+		return nil, nil
 	}
-	return nil
+	return &IVSSPayload{
+		InstanceID:   inst.id,
+		Type:         Payload_Reveal,
+		RevealPoly:   inst.receivedPoly,
+		RevealSender: s.id,
+	}, nil
 }
 
 // OnMessage handles incoming IVSS messages
@@ -247,64 +737,293 @@ func (s *IVSSService) OnMessage(msg IVSSMessage, ctx ServiceContext[IVSSMessage,
 			service:   s,
 		}
 		if msg.ACastMsg != nil {
+			if !s.fromDealer(msg.ACastMsg) {
+				s.logger.Warn().Str("uuid", msg.ACastMsg.UUID).Int("from", msg.ACastMsg.From).Msg("Commitment or M-Set not sent by the dealer, ignoring")
+				return
+			}
+			if !s.fromRevealSender(msg.ACastMsg) {
+				s.logger.Warn().Str("uuid", msg.ACastMsg.UUID).Int("from", msg.ACastMsg.From).Msg("REVEAL or READY of another node, ignoring")
+				s.metrics.Inc("ivss.foreign_reveals")
+				return
+			}
 			s.acast.OnMessage(*msg.ACastMsg, adapter)
 		}
 		return
 	}
 
-	// Handle Direct Messages
-	if msg.To != s.id {
-		return // Not for me
+	s.onDirect(msg, ctx)
+}
+
+// onDirect handles a share, point or request sent to this node alone.
+// Direct messages are routed by SendTo, never broadcast, so whatever To
+// one claims it was delivered to us. Its seal and signature bind the
+// recipient, so one meant for another node fails to open or verify here.
+func (s *IVSSService) onDirect(msg IVSSMessage, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	msg.To = s.id
+	if msg.DirectType == Direct_Watchdog {
+		s.onWatchdog(msg, ctx)
+		return
+	}
+	if s.sealer != nil {
+		opened, err := s.sealer.open(msg)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("instance", msg.InstanceID).Msg("Dropping direct message")
+			s.metrics.Inc("ivss.unsealable")
+			return
+		}
+		msg = opened
+	}
+	if err := msg.validateDirect(s.n); err != nil {
+		s.logger.Warn().Err(err).Str("instance", msg.InstanceID).Msg("Dropping invalid direct message")
+		return
+	}
+	if s.keyring != nil && (msg.DirectType == Direct_Share || msg.DirectType == Direct_Point) && !msg.verifySignature(s.keyring, msg.Signature) {
+		s.logger.Warn().Str("instance", msg.InstanceID).Int("from", msg.From).Msg("Dropping unsigned direct message")
+		s.metrics.Inc("ivss.bad_signatures")
+		return
 	}
 
-	// TODO: Robust Dealer ID inference from InstanceID
-	inst := s.getInstance(msg.InstanceID, msg.From)
+	// Evicted instances can still hand out points of their share and be
+	// reconstructed privately
+	inst := s.lookup(msg.InstanceID, msg.DirectType == Direct_ShareRequest || msg.DirectType == Direct_PrivateReveal)
+	if inst == nil {
+		return // Evicted, sharing is over
+	}
+	if err := msg.validateField(inst.field); err != nil {
+		s.logger.Warn().Err(err).Str("instance", msg.InstanceID).Stringer("field", inst.field).Msg("Dropping direct message")
+		return
+	}
 
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
+	s.watch(inst, ctx)
 
 	switch msg.DirectType {
 	case Direct_Share:
 		// On Receive f_k from Dealer
-		inst.receivedPoly = msg.Poly
-		inst.dealer = msg.From // The sender of Share IS the dealer
-
-		// Send point = f_k(j) to process j
-		for j := 1; j <= s.n; j++ {
-			jBig := big.NewInt(int64(j))
-			val := msg.Poly.Evaluate(jBig)
-
-			outMsg := IVSSMessage{
-				Type:       IVSS_Direct,
-				DirectType: Direct_Point,
-				To:         j,
-				From:       s.id,
-				InstanceID: msg.InstanceID,
-				Point:      val,
-				PointIdx:   j,
+		if inst.column != nil {
+			return
+		}
+		if msg.Signature != nil {
+			inst.signedShare, inst.shareSignature = msg.Poly, msg.Signature
+		}
+		if s.committed(inst.id) {
+			if inst.commitment == nil {
+				// Checked once the commitment is delivered
+				inst.pendingShare = msg.Poly
+				return
+			}
+			if !s.checkShare(inst, msg.Poly, ctx) {
+				return
 			}
-			ctx.Broadcast(outMsg)
 		}
+		s.acceptShare(inst, []*utils.Polynomial{msg.Poly}, false, ctx)
 
-		// Process any early points
-		for from, point := range inst.earlyPoints {
-			s.processPoint(inst, from, point, ctx)
+	case Direct_BatchShare:
+		if inst.shares() != nil {
+			return
+		}
+		if s.committed(inst.id) {
+			s.logger.Warn().Str("instance", inst.id).Msg("Commitments do not cover batches, ignoring share")
+			return
 		}
-		// Clear early points
-		inst.earlyPoints = make(map[int]*big.Int)
+		s.acceptShare(inst, msg.Polys, true, ctx)
 
-	case Direct_Point:
+	case Direct_DualShare:
+		s.acceptDualShare(inst, msg.Polys[0], msg.Polys[1], ctx)
+
+	case Direct_Point, Direct_BatchPoint, Direct_DualPoint:
 		// On Receive point p_j from process j
 		// Check consistency: received_poly(j) == p_j
-		if inst.receivedPoly == nil {
+		points := msg.Points
+		if msg.DirectType == Direct_Point {
+			points = []*big.Int{msg.Point}
+		}
+		signed := msg.DirectType == Direct_Point && msg.Signature != nil
+		if inst.shares() == nil {
 			// We haven't received the poly from dealer yet.
 			// Buffer the point
-			inst.earlyPoints[msg.From] = msg.Point
+			if s.bufferPoint(inst, msg.From, msg.DirectType, points) && signed {
+				inst.pointSignatures[msg.From] = msg.Signature
+			}
 			return
 		}
+		if signed {
+			inst.pointSignatures[msg.From] = msg.Signature
+		}
+		s.processPoint(inst, msg.From, points, ctx)
+
+	case Direct_ShareRequest:
+		inst.shareRequests[msg.From] = true
+		s.answerShareRequests(inst, ctx)
+
+	case Direct_ShareResponse:
+		s.acceptRecoveryPoint(inst, msg.From, msg.Point, ctx)
+
+	case Direct_PrivateReveal:
+		if inst.privatePolys[msg.From] == nil {
+			inst.privatePolys[msg.From] = msg.Poly
+			s.checkPrivateReconstruction(inst, ctx)
+		}
+	}
+}
+
+// fromDealer reports whether an A-Cast message may be relayed: a commitment
+// or M-Set must be A-Cast by the dealer of its instance, or any node could
+// commit in its place and have correct shares rejected, or announce a batch
+// of another size.
+func (s *IVSSService) fromDealer(msg *ACastMessage[string]) bool {
+	if msg.Type != MSG && msg.Type != SIGNED_MSG {
+		return true
+	}
+	p, err := ParseIVSSPayload(msg.Val)
+	if err != nil || (p.Type != Payload_Commit && p.Type != Payload_MSet) {
+		return true
+	}
+	if p.Type == Payload_MSet && p.RevealSender != 0 {
+		// An assisted M-Set is A-Cast by its proposer
+		return s.assistMSet && p.RevealSender == msg.From
+	}
+	dealer, ok := IVSSDealer(p.InstanceID)
+	return ok && dealer == msg.From
+}
+
+// fromRevealSender reports whether an A-Cast message may be relayed: the
+// REVEALs and READYs it carries must be A-Cast by their RevealSender. Only
+// the first of each sender counts, so a node sending them in the name of
+// another could pre-empt its share and steer the reconstruction. A batch
+// is A-Cast by the node whose payloads it carries, so each of them is
+// bound to the origin of the batch.
+func (s *IVSSService) fromRevealSender(msg *ACastMessage[string]) bool {
+	if msg.Type != MSG && msg.Type != SIGNED_MSG {
+		return true
+	}
+	vals := []string{msg.Val}
+	if batch, ok := ParseACastBatch(msg.Val); ok {
+		vals = batch.Batch
+	}
+	for _, val := range vals {
+		p, err := ParseIVSSPayload(val)
+		if err == nil && (p.Type == Payload_Reveal || p.Type == Payload_Ready) && p.RevealSender != msg.From {
+			return false
+		}
+	}
+	return true
+}
+
+// checkShare verifies a share against the commitment of its dealer. A share
+// that does not match is dropped and its dealer suspected right away, and
+// blamed if it signed the share.
+func (s *IVSSService) checkShare(inst *IVSSInstance, poly *utils.Polynomial, ctx ServiceContext[IVSSMessage, IVSSResult]) bool {
+	if inst.commitment.VerifyShare(s.id, poly) {
+		return true
+	}
+	s.logger.Warn().Str("instance", inst.id).Int("dealer", inst.dealer).Msg("Share does not match the dealer's commitment, ignoring")
+	s.metrics.Inc("ivss.bad_shares")
+	s.cp.AddSuspect(inst.dealer, fmt.Sprintf("share of %s does not match its commitment", inst.id))
+	if s.keyring != nil && inst.signedShare == poly {
+		s.blame(inst, IVSSBlame{Kind: Blame_BadShare, Share: poly, ShareSignature: inst.shareSignature}, ctx)
+	}
+	return false
+}
+
+// acceptShare stores f_k, or the share of every secret of a batch, and
+// sends its points to the other nodes.
+func (s *IVSSService) acceptShare(inst *IVSSInstance, polys []*utils.Polynomial, batch bool, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if batch {
+		inst.batch = polys
+	} else {
+		inst.receivedPoly = polys[0]
+	}
+	inst.progress()
+
+	// Send point = f_k(j) to process j
+	for j := 1; j <= s.n; j++ {
+		jBig := big.NewInt(int64(j))
+
+		outMsg := IVSSMessage{
+			Type:       IVSS_Direct,
+			DirectType: Direct_Point,
+			To:         j,
+			From:       s.id,
+			InstanceID: inst.id,
+			PointIdx:   j,
+		}
+		if batch {
+			outMsg.DirectType = Direct_BatchPoint
+			outMsg.Points = make([]*big.Int, len(polys))
+			for i, poly := range polys {
+				outMsg.Points[i] = inst.field.Evaluate(poly, jBig)
+			}
+		} else if inst.column != nil {
+			outMsg.DirectType = Direct_DualPoint
+			outMsg.Points = []*big.Int{inst.field.Evaluate(polys[0], jBig), inst.field.Evaluate(inst.column, jBig)}
+		} else {
+			outMsg.Point = inst.field.Evaluate(polys[0], jBig)
+		}
+		s.sendDirect(outMsg, ctx)
+	}
+
+	// Process any early points, in sender order so runs are reproducible
+	early := make([]int, 0, len(inst.earlyPoints))
+	for from := range inst.earlyPoints {
+		early = append(early, from)
+	}
+	sort.Ints(early)
+	for _, from := range early {
+		s.processPoint(inst, from, inst.earlyPoints[from], ctx)
+	}
+	// Clear early points
+	inst.earlyPoints = make(map[int][]*big.Int)
+}
+
+// bufferPoint keeps the points from sender until the share of inst
+// arrives, and reports whether it did. Only the first point of each node is
+// kept, so the buffer holds at most n entries whatever Byzantine nodes
+// send; validateDirect has checked that the points are field elements.
+// Once the M-Set says how many secrets the instance has, points that
+// cannot match its share are dropped as well.
+func (s *IVSSService) bufferPoint(inst *IVSSInstance, from int, kind DirectMsgType, points []*big.Int) bool {
+	var reason string
+	switch {
+	case !validNodeID(from, s.n):
+		reason = "sender out of range"
+	case inst.earlyPoints[from] != nil:
+		reason = "sender already has a buffered point"
+	case len(inst.earlyPoints) >= s.n:
+		reason = "buffer full"
+	case inst.secrets > 0 && (kind != Direct_BatchPoint || len(points) != inst.secrets):
+		reason = fmt.Sprintf("%d points for a batch of %d secrets", len(points), inst.secrets)
+	case inst.mSet != nil && inst.secrets == 0 && kind == Direct_BatchPoint:
+		reason = "batch point for a single secret"
+	}
+	if reason != "" {
+		s.logger.Debug().Str("instance", inst.id).Int("from", from).Str("reason", reason).Msg("Dropping early point")
+		s.metrics.Inc("ivss.early_points_dropped")
+		return false
+	}
+	inst.earlyPoints[from] = points
+	return true
+}
 
-		s.processPoint(inst, msg.From, msg.Point, ctx)
+// sendDirect sends a share or point to its recipient, signed when the node
+// has a PKI and encrypted for it when the node has share keys.
+func (s *IVSSService) sendDirect(msg IVSSMessage, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if s.signingKey != nil {
+		msg.Signature = SignIVSSDirect(s.signingKey, msg)
+	}
+	if s.sealer != nil {
+		sealed, err := s.sealer.seal(msg)
+		if err != nil {
+			s.logger.Error().Err(err).Str("instance", msg.InstanceID).Int("to", msg.To).Msg("Cannot encrypt direct message, dropping")
+			return
+		}
+		msg = sealed
 	}
+	ctx.SendTo(msg.To, msg)
 }
 
 func (s *IVSSService) startACast(payload IVSSPayload, ctx ServiceContext[IVSSMessage, IVSSResult]) {
@@ -312,95 +1031,165 @@ func (s *IVSSService) startACast(payload IVSSPayload, ctx ServiceContext[IVSSMes
 	// We need a unique UUID for this A-Cast instance.
 	// UUID = InstanceID + PayloadType + Data
 	uuid := fmt.Sprintf("%s-%d-%v", payload.InstanceID, payload.Type, payload.EqualPair)
-	if payload.Type == Payload_MSet {
+	if payload.Type == Payload_MSet && payload.RevealSender != 0 {
+		uuid = fmt.Sprintf("%s-MSET-%d", payload.InstanceID, payload.RevealSender)
+	} else if payload.Type == Payload_MSet {
 		uuid = fmt.Sprintf("%s-MSET", payload.InstanceID)
 	} else if payload.Type == Payload_Reveal {
 		uuid = fmt.Sprintf("%s-REVEAL-%d", payload.InstanceID, s.id)
 	} else if payload.Type == Payload_Ready {
 		uuid = fmt.Sprintf("%s-READY-%d", payload.InstanceID, s.id)
+	} else if payload.Type == Payload_Commit {
+		uuid = fmt.Sprintf("%s-COMMIT", payload.InstanceID)
+	} else if payload.Type == Payload_Blame {
+		uuid = fmt.Sprintf("%s-BLAME-%d-%d-%d", payload.InstanceID, s.id, payload.Blame.Kind, payload.Blame.PointFrom)
 	}
 
 	acastMsg := NewACastMessage(payload.String(), s.id)
 	acastMsg.UUID = uuid
 
 	// We need to feed this into our internal AcastService to start the process (if we are the sender)
-	wrapper := IVSSMessage{
-		Type:     IVSS_ACast,
-		ACastMsg: &acastMsg,
+	send := func(msg ACastMessage[string]) {
+		ctx.Broadcast(IVSSMessage{
+			Type:     IVSS_ACast,
+			ACastMsg: &msg,
+		})
 	}
-	ctx.Broadcast(wrapper)
+	if s.batcher != nil && payload.batchable() {
+		s.batcher.add(acastMsg, send)
+		return
+	}
+	send(acastMsg)
 }
 
 // OnACastDelivered is called when the internal A-Cast service delivers a value
 func (s *IVSSService) OnACastDelivered(valStr string, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if batch, ok := ParseACastBatch(valStr); ok {
+		for _, val := range batch.Batch {
+			s.OnACastDelivered(val, ctx)
+		}
+		return
+	}
 	payload, err := ParseIVSSPayload(valStr)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to parse IVSS payload")
 		return
 	}
+	if err := payload.Validate(s.n); err != nil {
+		s.logger.Warn().Err(err).Str("instance", payload.InstanceID).Msg("Dropping invalid IVSS payload")
+		return
+	}
 
-	inst := s.getInstance(payload.InstanceID, 0) // Dealer ID might not be needed here if instance exists
+	// Only reconstruction needs an evicted instance back
+	inst := s.lookup(payload.InstanceID, payload.Type == Payload_Reveal || payload.Type == Payload_Ready)
+	if inst == nil {
+		return
+	}
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
+	defer s.collect()
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
+	s.watch(inst, ctx)
 
 	switch payload.Type {
+	case Payload_Commit:
+		if inst.commitment != nil || !s.committed(inst.id) {
+			return
+		}
+		c, _ := utils.NewCommitment(payload.Commitment)
+		if c.Degree != s.t {
+			s.logger.Warn().Str("instance", inst.id).Int("degree", c.Degree).Msg("Commitment to a polynomial of the wrong degree")
+			s.cp.AddSuspect(inst.dealer, fmt.Sprintf("commitment of %s has degree %d", inst.id, c.Degree))
+			return
+		}
+		// A refresh must share zero, or the shares would never complete
+		if _, _, ok := ivssRefreshTarget(inst.id); ok && !c.CommitsToZero() {
+			s.logger.Warn().Str("instance", inst.id).Msg("Refresh does not share zero")
+			s.cp.AddSuspect(inst.dealer, fmt.Sprintf("refresh %s does not share zero", inst.id))
+			return
+		}
+		inst.commitment = c
+		if poly := inst.pendingShare; poly != nil {
+			inst.pendingShare = nil
+			if s.checkShare(inst, poly, ctx) {
+				s.acceptShare(inst, []*utils.Polynomial{poly}, false, ctx)
+			}
+		}
+		blames := inst.pendingBlames
+		inst.pendingBlames = nil
+		for _, b := range blames {
+			s.onBlame(inst, b, ctx)
+		}
+
 	case Payload_Equal:
 		// Add to set of completed EQUALs
+		if !inst.completedEquals[payload.EqualPair] {
+			inst.progress()
+		}
 		inst.completedEquals[payload.EqualPair] = true
 		s.checkCandidateSet(inst, ctx)
-
-		// Check if pending M-Set is now valid
-		if inst.pendingMSet != nil && !inst.sharingCompleted {
-			if s.verifyMSet(inst, inst.pendingMSet) {
-				inst.mSet = inst.pendingMSet
-				inst.sharingCompleted = true
-				inst.pendingMSet = nil // Clear pending
-
-				s.logger.Info().Str("instance", inst.id).Msg("Sharing Complete (Delayed)")
-
-				ctx.SendResult(IVSSResult{
-					InstanceID: inst.id,
-					Type:       "SHARING_COMPLETE",
-					MSet:       inst.mSet,
-					Poly:       inst.receivedPoly,
-				})
-			}
+		// A late EQUAL may make a reveal count
+		if len(inst.reconstructedPolys) > 0 {
+			s.checkInterpolationSet(inst, ctx)
 		}
 
+		// Check if a pending M-Set is now valid
+		s.checkPendingMSets(inst, ctx)
+
 	case Payload_MSet:
+		if payload.RevealSender != 0 {
+			s.onProposedMSet(inst, payload, ctx)
+			return
+		}
 		// Dealer sent M Set. Store it as pending first.
+		if len(payload.MSet) < s.n-s.t {
+			// Every node got the same M-Set, so each blames the dealer itself
+			s.onBlame(inst, IVSSBlame{Kind: Blame_BadMSet, InstanceID: inst.id, Dealer: inst.dealer, Accuser: s.id, MSet: payload.MSet}, ctx)
+			return
+		}
+		if inst.sharingCompleted {
+			return // Completed with an assisted M-Set
+		}
 		inst.pendingMSet = payload.MSet
+		inst.secrets = payload.Secrets
+		inst.progress()
 
 		// Verify it immediately
 		if s.verifyMSet(inst, payload.MSet) {
+			from := inst.phase()
 			inst.mSet = payload.MSet
-			inst.sharingCompleted = true
-			inst.pendingMSet = nil
-
 			s.logger.Info().Str("instance", inst.id).Msg("Sharing Complete")
-
-			ctx.SendResult(IVSSResult{
-				InstanceID: inst.id,
-				Type:       "SHARING_COMPLETE",
-				MSet:       inst.mSet,
-				Poly:       inst.receivedPoly,
-			})
+			s.completeSharing(inst, from, ctx)
 		} else {
 			s.logger.Debug().Str("instance", inst.id).Msg("Received M-Set but not yet valid (waiting for EQUALs)")
 		}
 
 	case Payload_Reveal:
-		// Reconstruction phase: received a polynomial
+		// Reconstruction phase: received a polynomial. A batch may carry a
+		// second REVEAL of a sender, which does not count
+		s.cp.MarkInvocationConsumed(inst.id)
+		if _, ok := inst.reconstructedPolys[payload.RevealSender]; ok {
+			return
+		}
 		inst.reconstructedPolys[payload.RevealSender] = payload.RevealPoly
 		s.checkInterpolationSet(inst, ctx)
 
+	case Payload_Blame:
+		s.onBlame(inst, *payload.Blame, ctx)
+
 	case Payload_Ready:
 		inst.readyToComplete[payload.RevealSender] = true
 		if len(inst.readyToComplete) >= s.n-s.t && !inst.reconstructed {
 			// Output Reconstructed Secret
 			if inst.secret != nil {
+				from := inst.phase()
 				inst.reconstructed = true
+				inst.completedAt = time.Now()
+				s.transition(inst, "RECONSTRUCT", from, map[string]int{"ready": len(inst.readyToComplete), "revealed": len(inst.reconstructedPolys)})
 				s.logger.Info().Str("instance", inst.id).Msgf("Reconstruction Complete. Secret: %v", inst.secret)
+				s.events.Publish(ProtocolEvent{Node: s.id, Type: Event_IVSSReconstructed, Instance: inst.id, Value: inst.secret.String()})
 
 				ctx.SendResult(IVSSResult{
 					InstanceID: inst.id,
@@ -414,6 +1203,65 @@ func (s *IVSSService) OnACastDelivered(valStr string, ctx ServiceContext[IVSSMes
 	}
 }
 
+// completeSharing ends the sharing phase of inst, whose M-Set is set. A
+// batch completes the instance of each of its secrets instead of reporting
+// itself.
+func (s *IVSSService) completeSharing(inst *IVSSInstance, from string, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	inst.sharingCompleted = true
+	inst.completedAt = time.Now()
+	s.transition(inst, "SHARE_COMPLETE", from, map[string]int{"mset": len(inst.mSet), "equals": len(inst.completedEquals)})
+	inst.pendingMSet = nil
+	if inst.secrets > 0 {
+		s.completeBatch(inst, ctx)
+		return
+	}
+	if _, _, ok := ivssRefreshTarget(inst.id); ok {
+		s.completeRefresh(inst, ctx)
+		return
+	}
+
+	s.cp.AddCoreInvocation(inst.id)
+	s.events.Publish(ProtocolEvent{Node: s.id, Type: Event_IVSSShared, Instance: inst.id})
+	s.answerShareRequests(inst, ctx)
+
+	ctx.SendResult(IVSSResult{
+		InstanceID:  inst.id,
+		Type:        "SHARING_COMPLETE",
+		MSet:        inst.mSet,
+		Poly:        inst.receivedPoly,
+		Column:      inst.column,
+		Certificate: s.certificate(inst),
+	})
+	s.checkPrivateReconstruction(inst, ctx)
+}
+
+// completeBatch completes the instance of every secret of batch with the
+// M-Set of the batch and our share of the secret. Nodes outside the M-Set
+// may have no share, like in a single sharing.
+func (s *IVSSService) completeBatch(batch *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	shares := batch.batch
+	if len(shares) != batch.secrets {
+		shares = nil
+	}
+	for i := 1; i <= batch.secrets; i++ {
+		inst := s.lookup(IVSSBatchSecretID(batch.id, i), false)
+		if inst == nil {
+			continue
+		}
+		inst.mu.Lock()
+		if !inst.sharingCompleted {
+			from := inst.phase()
+			if shares != nil {
+				inst.receivedPoly = shares[i-1]
+			}
+			inst.mSet = batch.mSet
+			inst.certificate = newIVSSCertificate(inst.id, batch.id, batch.secrets, batch.dealer, 0, batch.mSet, s.id)
+			s.completeSharing(inst, from, ctx)
+		}
+		inst.mu.Unlock()
+	}
+}
+
 func (s *IVSSService) checkCandidateSet(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
 	// CRITICAL: This function builds the candidate set M using O(n²) incremental construction,
 	// NOT exponential clique-finding (which would be O(2^n) or O(n!)).
@@ -436,11 +1284,12 @@ func (s *IVSSService) checkCandidateSet(inst *IVSSInstance, ctx ServiceContext[I
 	// COMPLEXITY: O(n²) because we check each of n candidates against at most n nodes in M
 	// This scales to networks with 100+ nodes, unlike exponential clique-finding.
 
-	if s.id != inst.dealer {
+	// Other nodes only propose M when assisting, see NodeContext.IVSSAssistMSet
+	if s.id != inst.dealer && !s.canPropose(inst) {
 		return
 	}
 
-	if inst.sharingCompleted {
+	if inst.sharingCompleted || inst.sentMSet {
 		return
 	}
 
@@ -485,12 +1334,17 @@ func (s *IVSSService) checkCandidateSet(inst *IVSSInstance, ctx ServiceContext[I
 	if len(mSet) >= target {
 		// Found a valid M-Set!
 		sort.Ints(mSet)
+		inst.sentMSet = true
 		s.logger.Info().Str("instance", inst.id).Ints("MSet", mSet).Msg("Found valid M-Set, broadcasting")
 
 		payload := IVSSPayload{
 			InstanceID: inst.id,
 			Type:       Payload_MSet,
 			MSet:       mSet,
+			Secrets:    inst.secrets,
+		}
+		if s.id != inst.dealer {
+			payload.RevealSender = s.id
 		}
 		s.startACast(payload, ctx)
 	}
@@ -527,125 +1381,105 @@ func (s *IVSSService) verifyMSet(inst *IVSSInstance, mSet []int) bool {
 	return true
 }
 
+// checkInterpolationSet decodes the secret from the reveals once there are
+// enough of them. Each revealed f_k(y) = F(k, y) gives the point
+// (k, f_k(0)) of g(x) = F(x, 0), whose constant term is the secret. Only
+// reveals of M and of nodes M vouches for count, so at most t of the points
+// are wrong: those of the faulty nodes. With r points the reveals are
+// decoded with Berlekamp–Welch allowing e = min(r-2t-1, (r-t-1)/2) errors,
+// so the decoded polynomial passes through at least r-e >= 2t+1 points. At
+// least t+1 of those are honest and determine g, so the secret is correct
+// no matter which t reveals are corrupted. If the decoding fails we wait
+// for more reveals (online error correction); it succeeds once 2t+1 honest
+// nodes that count have revealed.
 func (s *IVSSService) checkInterpolationSet(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
-	// Check if we have n-2t polynomials that are consistent
-	// We need to find a subset of received polynomials that are pairwise consistent.
-	// Consistency check: poly_i(j) == poly_j(i)
-
-	// Filter polynomials that are in M (if we enforce IS subset of M)
-	// We need to know M.
-	if inst.mSet == nil {
+	// The reveals are only meaningful relative to M
+	if inst.mSet == nil || inst.secret != nil {
 		return
 	}
-
-	// Extract nodes in M
-	nodesInM := make(map[int]bool)
-	for _, node := range inst.mSet {
-		nodesInM[node] = true
-	}
-
-	// Candidates: nodes in M from whom we received a polynomial
-	candidates := make([]int, 0)
-	for k := range inst.reconstructedPolys {
-		if nodesInM[k] {
-			candidates = append(candidates, k)
-		}
-	}
-
-	if len(candidates) < s.n-2*s.t {
+	secret, ok := s.decodeSecret(inst, inst.reconstructedPolys)
+	if !ok {
 		return
 	}
+	inst.secret = secret
 
-	// RECONSTRUCTION PHASE: Build interpolation set IS using same O(n²) incremental approach.
-	//
-	// GOAL: Find n-2t polynomials that are pairwise consistent for Lagrange interpolation.
-	// CONSISTENCY: Two polynomials P_u, P_v are consistent if P_u(v) == P_v(u)
-	// (symmetric property of the bivariate polynomial F(x,y) = F(y,x))
-	//
-	// WHY NOT EXPONENTIAL:
-	// - Same reasoning as in sharing phase
-	// - We build IS incrementally, checking each new polynomial against existing set
-	// - Correct polynomials from honest nodes are guaranteed to be mutually consistent
-	// - Byzantine polynomials are detected and excluded via inconsistency checks
-	//
-	// COMPLEXITY: O(n²) polynomial evaluations, practical for large n
-
-	isConsistent := func(u, v int) bool {
-		polyU := inst.reconstructedPolys[u]
-		polyV := inst.reconstructedPolys[v]
-
-		valUV := polyU.Evaluate(big.NewInt(int64(v)))
-		valVU := polyV.Evaluate(big.NewInt(int64(u)))
-
-		return valUV.Cmp(valVU) == 0
+	payload := IVSSPayload{
+		InstanceID:   inst.id,
+		Type:         Payload_Ready,
+		RevealSender: s.id,
 	}
+	s.startACast(payload, ctx)
+}
 
-	// INCREMENTAL CONSTRUCTION: Build IS the same way we built M
-	// O(n) candidates × O(n) consistency checks = O(n²) total
-	validSet := make([]int, 0)
-
-	for _, candidate := range candidates {
-		// For each polynomial from candidate node,
-		// verify it's consistent with ALL polynomials already in validSet
-		canAdd := true
+// decodeSecret decodes the secret from the polynomials revealed by the
+// nodes, as described at checkInterpolationSet. It returns false while
+// they do not suffice.
+func (s *IVSSService) decodeSecret(inst *IVSSInstance, revealed map[int]*utils.Polynomial) (*big.Int, bool) {
+	inM := make(map[int]bool, len(inst.mSet))
+	for _, k := range inst.mSet {
+		inM[k] = true
+	}
 
-		// O(n) inner loop - polynomial evaluations
-		for _, inSet := range validSet {
-			if !isConsistent(candidate, inSet) {
-				// BYZANTINE DETECTION:
-				// If P_candidate(inSet) != P_inSet(candidate),
-				// then at least one of {candidate, inSet} sent an incorrect polynomial.
-				// Mark as faulty pair for future reference.
-				s.cp.AddFaultyPair(candidate, inSet)
-				canAdd = false
-				break
-			}
+	// Points of g from the nodes that revealed and count
+	var senders []int
+	for k := 1; k <= s.n; k++ {
+		poly := revealed[k]
+		if poly == nil || len(poly.Coeffs) == 0 {
+			continue
 		}
-
-		// Greedy inclusion: honest polynomials are consistent by construction
-		if canAdd {
-			validSet = append(validSet, candidate)
+		if inM[k] || s.vouched(inst, k) {
+			senders = append(senders, k)
 		}
 	}
-
-	// Check if we have enough polynomials
-	target := s.n - 2*s.t
-	if target <= 0 {
-		target = 1
+	r := len(senders)
+	errs, ok := s.correctable(r)
+	if !ok {
+		return nil, false
 	}
 
-	if len(validSet) >= target {
-		// Interpolate F(0,0)
-		// We have polynomials f_i(y) = F(i, y).
-		// We want F(0,0).
-		// F(0,0) is the constant term of f_0(y) = F(0, y).
-		// We can interpolate F(0, y) from values F(i, y) for i in validSet.
-		// Actually, we can interpolate F(x, 0) from values F(i, 0).
-		// F(i, 0) is the constant term of f_i(y).
-		// Let s_i = f_i(0).
-		// We have pairs (i, s_i). We want to interpolate S(x) such that S(i) = s_i.
-		// Then secret = S(0).
-
-		points := make([]*big.Int, len(validSet))
-		values := make([]*big.Int, len(validSet))
+	xs := make([]*big.Int, r)
+	ys := make([]*big.Int, r)
+	for i, k := range senders {
+		xs[i] = big.NewInt(int64(k))
+		ys[i] = inst.field.Evaluate(revealed[k], big.NewInt(0))
+	}
+	g, wrong, err := inst.field.CorrectErrors(xs, ys, s.t, errs)
+	if err != nil {
+		s.logger.Debug().Str("instance", inst.id).Int("reveals", r).Int("errors", errs).Msg("Reveals not decodable yet, waiting for more")
+		return nil, false
+	}
 
-		for idx, nodeID := range validSet {
-			points[idx] = big.NewInt(int64(nodeID))
-			// Constant term of f_nodeID(y) is f_nodeID(0)
-			values[idx] = inst.reconstructedPolys[nodeID].Evaluate(big.NewInt(0))
-		}
+	// Honest reveals lie on g, so the ones off it are corrupted
+	for _, i := range wrong {
+		s.logger.Warn().Str("instance", inst.id).Int("from", senders[i]).Msg("Revealed polynomial does not match the decoded secret")
+		s.cp.AddSuspect(senders[i], fmt.Sprintf("reveal of %s does not match the decoded secret", inst.id))
+	}
+	return inst.field.Evaluate(g, big.NewInt(0)), true
+}
 
-		secret := utils.InterpolateAtZero(points, values)
-		inst.secret = secret
+// correctable returns how many errors to correct among r points of a
+// polynomial of degree t, at most t of which are wrong, so that the decoded
+// polynomial is right whichever they are: min(r-2t-1, (r-t-1)/2). It
+// returns false while r < 2t+1.
+func (s *IVSSService) correctable(r int) (int, bool) {
+	if r < 2*s.t+1 {
+		return 0, false
+	}
+	return min(r-2*s.t-1, (r-s.t-1)/2), true
+}
 
-		// If successful:
-		payload := IVSSPayload{
-			InstanceID:   inst.id,
-			Type:         Payload_Ready,
-			RevealSender: s.id,
+// vouched reports whether M vouches for the share of node k: k exchanged
+// EQUALs both ways with at least 2t+1 members of M. At least t+1 of them
+// are honest and sent k their true points of F, so if k is honest its
+// share is F(k, y) even if it is outside M.
+func (s *IVSSService) vouched(inst *IVSSInstance, k int) bool {
+	count := 0
+	for _, j := range inst.mSet {
+		if inst.completedEquals[[2]int{k, j}] && inst.completedEquals[[2]int{j, k}] {
+			count++
 		}
-		s.startACast(payload, ctx)
 	}
+	return count >= 2*s.t+1
 }
 
 // Adapter for AcastService
@@ -654,23 +1488,43 @@ type acastContextAdapter struct {
 	service   *IVSSService
 }
 
-func (a *acastContextAdapter) Broadcast(msg ACastMessage[string]) {
-	wrapper := IVSSMessage{
+func (a *acastContextAdapter) wrap(msg ACastMessage[string]) IVSSMessage {
+	return IVSSMessage{
 		Type:     IVSS_ACast,
 		ACastMsg: &msg,
 	}
-	a.parentCtx.Broadcast(wrapper)
+}
+
+func (a *acastContextAdapter) Broadcast(msg ACastMessage[string]) {
+	a.parentCtx.Broadcast(a.wrap(msg))
+}
+
+func (a *acastContextAdapter) SendTo(to int, msg ACastMessage[string]) {
+	a.parentCtx.SendTo(to, a.wrap(msg))
 }
 
 func (a *acastContextAdapter) SendResult(res string) {
 	a.service.OnACastDelivered(res, a.parentCtx)
 }
 
-func (s *IVSSService) processPoint(inst *IVSSInstance, from int, point *big.Int, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+// processPoint checks the points from carries, one per secret, against our
+// share.
+func (s *IVSSService) processPoint(inst *IVSSInstance, from int, points []*big.Int, ctx ServiceContext[IVSSMessage, IVSSResult]) {
 	jBig := big.NewInt(int64(from))
-	myEval := inst.receivedPoly.Evaluate(jBig)
+	mine := inst.shares()
+	consistent := len(points) == len(mine)
+	for i := 0; consistent && i < len(mine); i++ {
+		consistent = inst.field.Evaluate(mine[i], jBig).Cmp(points[i]) == 0
+	}
+	if inst.column != nil {
+		// j sends F(j, k) and F(k, j), which lie on our column and row
+		consistent = len(points) == 2 &&
+			inst.field.Evaluate(inst.column, jBig).Cmp(points[0]) == 0 &&
+			inst.field.Evaluate(inst.receivedPoly, jBig).Cmp(points[1]) == 0
+	}
 
-	if myEval.Cmp(point) == 0 {
+	if consistent {
+		inst.consistentPeers[from] = true
 		// Consistent!
 		// A-Cast "EQUAL:(k, j)" -> k is me (s.id), j is msg.From
 		payload := IVSSPayload{
@@ -683,6 +1537,9 @@ func (s *IVSSService) processPoint(inst *IVSSInstance, from int, point *big.Int,
 		s.startACast(payload, ctx)
 	} else {
 		s.logger.Warn().Msgf("Inconsistent point from %d", from)
+		if len(points) == 1 && inst.batch == nil {
+			s.blamePoint(inst, from, points[0], ctx)
+		}
 	}
 }
 
@@ -711,18 +1568,18 @@ func (s *IVSSService) processPoint(inst *IVSSInstance, from int, point *big.Int,
 //      * If yes, add k to M
 //    - Total: O(n) candidates × O(n) checks = O(n²)
 //
-// 2. checkInterpolationSet (building IS):
-//    - Same incremental approach
-//    - For each polynomial, verify consistency with all polynomials in IS
-//    - Total: O(n) polynomials × O(n) checks = O(n²)
+// 2. checkInterpolationSet (decoding the secret):
+//    - Not a set search at all: the revealed points are decoded with
+//      Berlekamp–Welch, a linear system of O(n) unknowns
+//    - Total: O(n³) field operations per attempt
 //
 // WHY THIS GREEDY APPROACH WORKS:
 // - Correct (honest) processes NATURALLY satisfy consistency conditions
 //   because they all share the same bivariate polynomial F(x,y)
 // - Byzantine processes are FILTERED OUT by consistency checks
-// - We don't need the MAXIMUM set, just one that's LARGE ENOUGH (n-t or n-2t)
+// - We don't need the MAXIMUM set, just one that's LARGE ENOUGH (n-t)
 // - The protocol guarantees that if there are at most t Byzantine nodes,
-//   we can always find a set of size n-t (or n-2t) of honest nodes
+//   we can always find a set of size n-t
 //
 // COMPLEXITY COMPARISON:
 // ┌─────────────────────┬──────────────┬─────────────────────┐
@@ -0,0 +1,67 @@
+package services
+
+import "fmt"
+
+// With NodeContext.IVSSAssistMSet every node with a share runs
+// checkCandidateSet, not only the dealer, and A-Casts the M-Set it finds as
+// a proposal (an M-Set payload whose RevealSender is the proposer). A node
+// completes the sharing with the dealer's M-Set if it is valid, and with
+// the first valid proposal otherwise, in proposer order.
+//
+// Any valid M-Set pins down the same secret when the dealer is honest, so
+// this keeps the sharing live when the dealer crashes after dealing. A
+// Byzantine dealer, however, can deal so that two valid M-Sets define
+// different secrets, and nodes that complete with different ones then
+// reconstruct different secrets. The mode is for clusters where dealers
+// may crash but are otherwise trusted. Batches are not assisted, since a
+// proposer cannot vouch for the number of secrets.
+
+// canPropose reports whether this node may propose the M-Set of inst,
+// which it does not deal.
+func (s *IVSSService) canPropose(inst *IVSSInstance) bool {
+	return s.assistMSet && inst.receivedPoly != nil && inst.batch == nil && inst.secrets == 0
+}
+
+// onProposedMSet records an assisted M-Set and completes the sharing with
+// it if it is valid already.
+func (s *IVSSService) onProposedMSet(inst *IVSSInstance, p *IVSSPayload, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if !s.assistMSet || inst.sharingCompleted || p.Secrets != 0 || inst.proposedMSets[p.RevealSender] != nil {
+		return
+	}
+	if len(p.MSet) < s.n-s.t {
+		s.logger.Warn().Str("instance", inst.id).Int("proposer", p.RevealSender).Ints("MSet", p.MSet).Msg("Proposed M-Set too small")
+		s.cp.AddSuspect(p.RevealSender, fmt.Sprintf("proposed M-Set of %d nodes for %s", len(p.MSet), inst.id))
+		return
+	}
+	inst.proposedMSets[p.RevealSender] = p.MSet
+	inst.progress()
+	s.checkPendingMSets(inst, ctx)
+}
+
+// checkPendingMSets completes the sharing of inst with the dealer's M-Set,
+// or else with the first assisted M-Set, once its EQUALs are delivered.
+func (s *IVSSService) checkPendingMSets(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if inst.sharingCompleted {
+		return
+	}
+	if inst.pendingMSet != nil && s.verifyMSet(inst, inst.pendingMSet) {
+		from := inst.phase()
+		inst.mSet = inst.pendingMSet
+		s.logger.Info().Str("instance", inst.id).Msg("Sharing Complete (Delayed)")
+		s.completeSharing(inst, from, ctx)
+		return
+	}
+	for proposer := 1; proposer <= s.n; proposer++ {
+		mSet := inst.proposedMSets[proposer]
+		if mSet == nil || !s.verifyMSet(inst, mSet) {
+			continue
+		}
+		from := inst.phase()
+		inst.mSet = mSet
+		inst.mSetProposer = proposer
+		s.metrics.Inc("ivss.assisted_msets")
+		s.logger.Info().Str("instance", inst.id).Int("proposer", proposer).Msg("Sharing Complete (Assisted)")
+		s.completeSharing(inst, from, ctx)
+		return
+	}
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"crypto/ed25519"
+	"fmt"
+	"math/big"
+)
+
+// With a PKI (NodeContext.SigningKey and Keyring) every node signs the
+// shares and points it sends, so a dealer that deals inconsistent shares
+// leaves evidence behind: the share it signed for one node and a signed
+// point of another node that contradicts it. The node holding both A-Casts
+// them as an IVSSBlame, which every node checks on its own before
+// recording the faulty pair it proves, so the dealer ends up excluded by
+// the nodes it dealt to. Batches are not signed and leave no evidence.
+
+// ivssDirectDomain separates the signatures of shares and points from
+// anything else the node keys might sign.
+const ivssDirectDomain = "aba-ivss-direct-v1"
+
+// IVSSBlameKind is the misbehavior an IVSSBlame proves.
+type IVSSBlameKind int
+
+const (
+	// The share the dealer signed for the accuser and the point PointFrom
+	// signed for it disagree, so the dealer or PointFrom is faulty
+	Blame_InconsistentPoint IVSSBlameKind = iota
+	// The share the dealer signed for the accuser does not match the
+	// dealer's commitment, so the dealer is faulty
+	Blame_BadShare
+	// The dealer A-Cast an M-Set of fewer than n-t nodes, so it is faulty
+	Blame_BadMSet
+)
+
+func (k IVSSBlameKind) String() string {
+	switch k {
+	case Blame_InconsistentPoint:
+		return "INCONSISTENT_POINT"
+	case Blame_BadShare:
+		return "BAD_SHARE"
+	case Blame_BadMSet:
+		return "BAD_MSET"
+	default:
+		return fmt.Sprintf("IVSSBlameKind(%d)", int(k))
+	}
+}
+
+// IVSSBlame is a machine-checkable record that the dealer of an instance
+// misbehaved, see Verify.
+type IVSSBlame struct {
+	Kind       IVSSBlameKind
+	InstanceID string
+	Dealer     int
+	Accuser    int // The node the share was dealt to
+
+	Share          *utils.Polynomial `json:",omitempty"` // Share of the accuser, signed by the dealer
+	ShareSignature []byte            `json:",omitempty"`
+	Point          *big.Int          `json:",omitempty"` // Point PointFrom sent the accuser
+	PointFrom      int               `json:",omitempty"`
+	PointSignature []byte            `json:",omitempty"`
+	MSet           utils.NodeSet     `json:",omitempty"` // For Blame_BadMSet
+}
+
+// validate checks the fields of the blame for a cluster of n nodes.
+func (b *IVSSBlame) validate(n int) error {
+	if dealer, ok := IVSSDealer(b.InstanceID); !ok || dealer != b.Dealer {
+		return fmt.Errorf("blame of %d, who is not the dealer of %s", b.Dealer, b.InstanceID)
+	}
+	if !validNodeID(b.Accuser, n) {
+		return fmt.Errorf("accuser %d out of range", b.Accuser)
+	}
+	switch b.Kind {
+	case Blame_InconsistentPoint:
+		if !validNodeID(b.PointFrom, n) {
+			return fmt.Errorf("point sender %d out of range", b.PointFrom)
+		}
+		if b.Point == nil || b.Point.Sign() < 0 || b.Point.Cmp(utils.Prime) >= 0 {
+			return fmt.Errorf("point is not a field element")
+		}
+		fallthrough
+	case Blame_BadShare:
+		if err := validatePolynomial(b.Share, n); err != nil {
+			return fmt.Errorf("invalid share: %w", err)
+		}
+	case Blame_BadMSet:
+		if err := validateNodeSet(b.MSet, n); err != nil {
+			return fmt.Errorf("invalid M-Set: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown blame kind %d", b.Kind)
+	}
+	return nil
+}
+
+// Verify checks that the blame proves its dealer misbehaved in a cluster
+// of n nodes tolerating t faults. The signatures are checked against
+// keyring; a Blame_BadShare needs the dealer's commitment, and a
+// Blame_BadMSet holds only for an M-Set delivered by the dealer's A-Cast.
+// The instance is taken to be of utils.DefaultField, see VerifyInField.
+func (b *IVSSBlame) Verify(n, t int, keyring *Keyring, commitment *utils.Commitment) error {
+	return b.VerifyInField(nil, n, t, keyring, commitment)
+}
+
+// VerifyInField is Verify for an instance of field f.
+func (b *IVSSBlame) VerifyInField(f *utils.Field, n, t int, keyring *Keyring, commitment *utils.Commitment) error {
+	if err := b.validate(n); err != nil {
+		return err
+	}
+	if b.Kind == Blame_BadMSet {
+		if len(b.MSet) >= n-t {
+			return fmt.Errorf("M-Set of %d nodes is large enough", len(b.MSet))
+		}
+		return nil
+	}
+
+	share := IVSSMessage{DirectType: Direct_Share, From: b.Dealer, To: b.Accuser, InstanceID: b.InstanceID, Poly: b.Share}
+	if !share.verifySignature(keyring, b.ShareSignature) {
+		return fmt.Errorf("share is not signed by dealer %d", b.Dealer)
+	}
+	if b.Kind == Blame_BadShare {
+		if commitment == nil {
+			return fmt.Errorf("no commitment to check the share against")
+		}
+		if commitment.VerifyShare(b.Accuser, b.Share) {
+			return fmt.Errorf("share matches the commitment")
+		}
+		return nil
+	}
+
+	point := IVSSMessage{DirectType: Direct_Point, From: b.PointFrom, To: b.Accuser, InstanceID: b.InstanceID, Point: b.Point}
+	if !point.verifySignature(keyring, b.PointSignature) {
+		return fmt.Errorf("point is not signed by node %d", b.PointFrom)
+	}
+	if !f.ContainsPolynomial(b.Share) || !f.Contains(b.Point) {
+		return fmt.Errorf("share or point outside field %s", f)
+	}
+	if f.Evaluate(b.Share, big.NewInt(int64(b.PointFrom))).Cmp(b.Point) == 0 {
+		return fmt.Errorf("share and point agree")
+	}
+	return nil
+}
+
+// faultyPair returns the pair of nodes the blame proves one of is faulty,
+// as seen by node self. A blame against the dealer alone names the pair
+// {self, dealer}, which certifies the dealer for self.
+func (b *IVSSBlame) faultyPair(self int) [2]int {
+	if b.Kind == Blame_InconsistentPoint && b.PointFrom != b.Dealer {
+		return [2]int{b.Dealer, b.PointFrom}
+	}
+	return [2]int{self, b.Dealer}
+}
+
+// signedBytes returns the bytes the sender of a share or point signs: the
+// canonical encoding of (domain, instance, type, from, to, content).
+func (m *IVSSMessage) signedBytes() ([]byte, bool) {
+	var content []byte
+	switch m.DirectType {
+	case Direct_Share:
+		if m.Poly == nil {
+			return nil, false
+		}
+		b, err := m.Poly.MarshalBinary()
+		if err != nil {
+			return nil, false
+		}
+		content = b
+	case Direct_Point:
+		b, ok := utils.EncodeFieldElement(m.Point)
+		if !ok {
+			return nil, false
+		}
+		content = b
+	default:
+		return nil, false
+	}
+	b, err := CanonicalBytes([]any{ivssDirectDomain, m.InstanceID, int(m.DirectType), m.From, m.To, content})
+	return b, err == nil
+}
+
+// SignIVSSDirect returns the signature of key on a share or point, or nil
+// for other messages.
+func SignIVSSDirect(key ed25519.PrivateKey, msg IVSSMessage) []byte {
+	b, ok := msg.signedBytes()
+	if !ok {
+		return nil
+	}
+	return ed25519.Sign(key, b)
+}
+
+// verifySignature checks that sig is the signature of the sender of a
+// share or point.
+func (m *IVSSMessage) verifySignature(keyring *Keyring, sig []byte) bool {
+	if keyring == nil {
+		return false
+	}
+	key := keyring.PublicKey(m.From)
+	b, ok := m.signedBytes()
+	return key != nil && ok && ed25519.Verify(key, b, sig)
+}
+
+// blame A-Casts the proof against the dealer of inst.
+func (s *IVSSService) blame(inst *IVSSInstance, b IVSSBlame, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	b.InstanceID, b.Dealer, b.Accuser = inst.id, inst.dealer, s.id
+	s.logger.Warn().Str("instance", inst.id).Stringer("kind", b.Kind).Int("dealer", inst.dealer).Msg("Blaming dealer")
+	s.startACast(IVSSPayload{
+		InstanceID: inst.id,
+		Type:       Payload_Blame,
+		Blame:      &b,
+	}, ctx)
+}
+
+// blamePoint blames the dealer if the signed point from contradicts the
+// signed share of this node.
+func (s *IVSSService) blamePoint(inst *IVSSInstance, from int, point *big.Int, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	sig := inst.pointSignatures[from]
+	if s.keyring == nil || inst.signedShare == nil || inst.signedShare != inst.receivedPoly || sig == nil {
+		return
+	}
+	s.blame(inst, IVSSBlame{
+		Kind:           Blame_InconsistentPoint,
+		Share:          inst.signedShare,
+		ShareSignature: inst.shareSignature,
+		Point:          point,
+		PointFrom:      from,
+		PointSignature: sig,
+	}, ctx)
+}
+
+// onBlame checks a blame and records the faulty pair it proves. A blame
+// against the dealer alone excludes it from the later rounds of this node;
+// the blame is reported as a BLAME result either way.
+func (s *IVSSService) onBlame(inst *IVSSInstance, b IVSSBlame, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if b.Kind == Blame_BadShare && inst.commitment == nil {
+		// Checked once the commitment is delivered
+		inst.pendingBlames = append(inst.pendingBlames, b)
+		return
+	}
+	pair := b.faultyPair(s.id)
+	if inst.blames[pair] {
+		return
+	}
+	if err := b.VerifyInField(inst.field, s.n, s.t, s.keyring, inst.commitment); err != nil {
+		s.logger.Warn().Err(err).Str("instance", inst.id).Int("accuser", b.Accuser).Msg("Ignoring invalid blame")
+		s.metrics.Inc("ivss.invalid_blames")
+		return
+	}
+	inst.blames[pair] = true
+	s.metrics.Inc("ivss.blames")
+	s.logger.Warn().Str("instance", inst.id).Stringer("kind", b.Kind).Int("dealer", b.Dealer).Ints("pair", pair[:]).Msg("Dealer blamed")
+	if pair[0] != pair[1] {
+		s.cp.AddFaultyPairWithEvidence(pair[0], pair[1], inst.id, fmt.Sprintf("blame %s by node %d", b.Kind, b.Accuser))
+	}
+
+	ctx.SendResult(IVSSResult{
+		InstanceID: inst.id,
+		Type:       "BLAME",
+		Blame:      &b,
+	})
+}
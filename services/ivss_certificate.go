@@ -0,0 +1,209 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// A node that completes a sharing reports an IVSSCertificate with it: the
+// M-Set and the A-Casts whose delivery completed it, the M-Set of its
+// proposer and the EQUAL(u, v) of u for every pair of the M-Set, signed
+// with the node key if there is a PKI. Every A-Cast is named by its
+// sender, instance UUID and payload digest, which follow from the M-Set,
+// so Verify recomputes them instead of trusting them.
+//
+// A-Cast delivery is not transferable, so one certificate only shows what
+// its signer claims. t+1 signed certificates that agree, which
+// VerifyIVSSCertificates checks, show that an honest node completed the
+// sharing, and then every honest node does.
+
+// ivssCertificateDomain separates the signatures of certificates from
+// anything else the node keys might sign.
+const ivssCertificateDomain = "aba-ivss-cert-v1"
+
+// IVSSDelivery names a delivered A-Cast of an IVSS payload.
+type IVSSDelivery struct {
+	Sender int
+	UUID   string
+	Digest string // Hex SHA-256 of the payload, see IVSSPayload.Digest
+}
+
+// IVSSCertificate records that Signer completed the sharing of InstanceID,
+// see Verify.
+type IVSSCertificate struct {
+	InstanceID string
+	Dealer     int
+	MSet       utils.NodeSet
+	Proposer   int    `json:",omitempty"` // Of an assisted M-Set, 0 for the dealer's
+	Batch      string `json:",omitempty"` // Instance of the batch the sharing is a secret of
+	Secrets    int    `json:",omitempty"` // Secrets of Batch
+	Deliveries []IVSSDelivery
+	Signer     int
+	Signature  []byte `json:",omitempty"`
+}
+
+// newIVSSCertificate returns the unsigned certificate of signer for the
+// sharing of instanceID, completed with mSet by the A-Casts of instance
+// sharing, which is instanceID or its batch of secrets secrets.
+func newIVSSCertificate(instanceID, sharing string, secrets, dealer, proposer int, mSet []int, signer int) *IVSSCertificate {
+	c := &IVSSCertificate{
+		InstanceID: instanceID,
+		Dealer:     dealer,
+		MSet:       append(utils.NodeSet(nil), mSet...),
+		Proposer:   proposer,
+		Signer:     signer,
+	}
+	if sharing != instanceID {
+		c.Batch, c.Secrets = sharing, secrets
+	}
+	c.Deliveries = c.deliveries()
+	return c
+}
+
+// sharing returns the instance whose A-Casts completed the sharing.
+func (c *IVSSCertificate) sharing() string {
+	if c.Batch != "" {
+		return c.Batch
+	}
+	return c.InstanceID
+}
+
+// deliveries returns the A-Casts that complete the sharing with the M-Set
+// of c: the M-Set, then the EQUALs in pair order.
+func (c *IVSSCertificate) deliveries() []IVSSDelivery {
+	id := c.sharing()
+	mSet := IVSSPayload{InstanceID: id, Type: Payload_MSet, MSet: c.MSet, RevealSender: c.Proposer, Secrets: c.Secrets}
+	sender, uuid := c.Dealer, fmt.Sprintf("%s-MSET", id)
+	if c.Proposer != 0 {
+		sender, uuid = c.Proposer, fmt.Sprintf("%s-MSET-%d", id, c.Proposer)
+	}
+	out := []IVSSDelivery{{Sender: sender, UUID: uuid, Digest: payloadDigest(mSet)}}
+
+	members := append([]int(nil), c.MSet...)
+	sort.Ints(members)
+	for _, u := range members {
+		for _, v := range members {
+			if u == v {
+				continue
+			}
+			equal := IVSSPayload{InstanceID: id, Type: Payload_Equal, EqualPair: [2]int{u, v}}
+			out = append(out, IVSSDelivery{
+				Sender: u,
+				UUID:   fmt.Sprintf("%s-%d-%v", id, Payload_Equal, equal.EqualPair),
+				Digest: payloadDigest(equal),
+			})
+		}
+	}
+	return out
+}
+
+func payloadDigest(p IVSSPayload) string {
+	hash := p.Digest()
+	return hex.EncodeToString(hash[:])
+}
+
+// signedBytes returns the bytes the signer of a certificate signs: the
+// canonical encoding of (domain, instance, dealer, M-Set, proposer, batch,
+// secrets, signer). The deliveries follow from them.
+func (c *IVSSCertificate) signedBytes() []byte {
+	b, _ := CanonicalBytes([]any{ivssCertificateDomain, c.InstanceID, c.Dealer, []int(c.MSet), c.Proposer, c.Batch, c.Secrets, c.Signer})
+	return b
+}
+
+// Sign sets the signature of key on c.
+func (c *IVSSCertificate) Sign(key ed25519.PrivateKey) {
+	c.Signature = ed25519.Sign(key, c.signedBytes())
+}
+
+// Verify checks that c is a well-formed certificate of a cluster of n
+// nodes tolerating t faults: its M-Set is large enough and its deliveries
+// are the A-Casts that complete the sharing with it. With a keyring, c
+// must also be signed by its signer.
+func (c *IVSSCertificate) Verify(n, t int, keyring *Keyring) error {
+	if err := validateIVSSID(c.InstanceID, n); err != nil {
+		return err
+	}
+	if dealer, _ := IVSSDealer(c.InstanceID); dealer != c.Dealer {
+		return fmt.Errorf("certificate names %d, who is not the dealer of %s", c.Dealer, c.InstanceID)
+	}
+	if c.Batch != "" {
+		if dealer, ok := IVSSDealer(c.Batch); !ok || dealer != c.Dealer || c.Secrets <= 0 {
+			return fmt.Errorf("batch %s of %d secrets is not of dealer %d", c.Batch, c.Secrets, c.Dealer)
+		}
+	} else if c.Secrets != 0 {
+		return fmt.Errorf("%d secrets without a batch", c.Secrets)
+	}
+	if c.Proposer != 0 && !validNodeID(c.Proposer, n) {
+		return fmt.Errorf("proposer %d out of range", c.Proposer)
+	}
+	if !validNodeID(c.Signer, n) {
+		return fmt.Errorf("signer %d out of range", c.Signer)
+	}
+	if err := validateNodeSet(c.MSet, n); err != nil {
+		return fmt.Errorf("invalid M-Set: %w", err)
+	}
+	if len(c.MSet) < n-t {
+		return fmt.Errorf("M-Set of %d nodes is too small", len(c.MSet))
+	}
+
+	want := c.deliveries()
+	if len(c.Deliveries) != len(want) {
+		return fmt.Errorf("%d deliveries, want %d", len(c.Deliveries), len(want))
+	}
+	for i := range want {
+		if c.Deliveries[i] != want[i] {
+			return fmt.Errorf("delivery %d is %v, want %v", i, c.Deliveries[i], want[i])
+		}
+	}
+
+	if keyring == nil {
+		return nil
+	}
+	key := keyring.PublicKey(c.Signer)
+	if key == nil || !ed25519.Verify(key, c.signedBytes(), c.Signature) {
+		return fmt.Errorf("certificate is not signed by node %d", c.Signer)
+	}
+	return nil
+}
+
+// VerifyIVSSCertificates checks that certs prove the sharing of instanceID
+// completed in a cluster of n nodes tolerating t faults: t+1 of them by
+// distinct signers verify against keyring and agree on the M-Set.
+func VerifyIVSSCertificates(instanceID string, certs []*IVSSCertificate, n, t int, keyring *Keyring) error {
+	if keyring == nil {
+		return fmt.Errorf("no keyring to check the signatures against")
+	}
+	signers := make(map[string]map[int]bool)
+	for _, c := range certs {
+		if c == nil || c.InstanceID != instanceID || c.Verify(n, t, keyring) != nil {
+			continue
+		}
+		// The digest of the M-Set payload covers the M-Set and its proposer
+		key := c.Deliveries[0].Digest
+		if signers[key] == nil {
+			signers[key] = make(map[int]bool)
+		}
+		signers[key][c.Signer] = true
+		if len(signers[key]) > t {
+			return nil
+		}
+	}
+	return fmt.Errorf("fewer than %d distinct signers agree on the sharing of %s", t+1, instanceID)
+}
+
+// certificate returns the certificate of this node for the sharing of
+// inst, signed if it has a key. A batch secret gets the one completeBatch
+// made.
+func (s *IVSSService) certificate(inst *IVSSInstance) *IVSSCertificate {
+	c := inst.certificate
+	if c == nil {
+		c = newIVSSCertificate(inst.id, inst.id, 0, inst.dealer, inst.mSetProposer, inst.mSet, s.id)
+	}
+	if s.signingKey != nil && c.Signature == nil {
+		c.Sign(s.signingKey)
+	}
+	return c
+}
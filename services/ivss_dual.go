@@ -0,0 +1,67 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"fmt"
+	"math/big"
+)
+
+// A dual-threshold sharing (NodeContext.IVSSDualThreshold) deals a
+// bivariate polynomial F of degree t in x and 2t in y. Node k gets its row
+// F(k, y) and its column F(x, k), and sends node j the points F(k, j) and
+// F(j, k), which j checks against its column and row. The sharing then
+// completes as usual, and reconstruction decodes F(x, 0) from the rows as
+// for a symmetric polynomial. On top of it, F(0, k) is a share of the
+// secret on a polynomial of degree 2t, which t+1 nodes learn nothing from
+// and which takes 2t+1 nodes to reconstruct, as used by high-threshold DKG.
+// Lost shares cannot be recovered, since the rows have degree 2t.
+
+// startDualSharing deals a dual-threshold sharing of secret.
+func (s *IVSSService) startDualSharing(instanceID string, secret *big.Int, ctx ServiceContext[IVSSMessage, IVSSResult]) error {
+	if s.committed(instanceID) {
+		return fmt.Errorf("commitments do not cover dual-threshold sharings")
+	}
+	poly, err := s.field(instanceID).NewRandomBivariatePolynomial(s.rand, s.t, 2*s.t, secret)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info().Str("instance", instanceID).Msg("Starting dual-threshold Sharing as Dealer")
+	s.events.Publish(ProtocolEvent{Node: s.id, Type: Event_IVSSDealt, Instance: instanceID, Value: secret.String()})
+
+	for k := 1; k <= s.n; k++ {
+		kBig := big.NewInt(int64(k))
+		s.sendDirect(IVSSMessage{
+			Type:       IVSS_Direct,
+			DirectType: Direct_DualShare,
+			To:         k,
+			From:       s.id,
+			InstanceID: instanceID,
+			Polys:      []*utils.Polynomial{poly.Row(kBig), poly.Column(kBig)},
+		}, ctx)
+	}
+	return nil
+}
+
+// acceptDualShare checks the row F(k, y) and column F(x, k) dealt to this
+// node and accepts them as its share. Shares of the wrong degree, or whose
+// row and column disagree on F(k, k), are dropped and their dealer
+// suspected.
+func (s *IVSSService) acceptDualShare(inst *IVSSInstance, row, column *utils.Polynomial, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if inst.shares() != nil {
+		return
+	}
+	if s.committed(inst.id) {
+		s.logger.Warn().Str("instance", inst.id).Msg("Commitments do not cover dual-threshold sharings, ignoring share")
+		return
+	}
+	k := big.NewInt(int64(s.id))
+	if len(row.Coeffs) > 2*s.t+1 || len(column.Coeffs) > s.t+1 || inst.field.Evaluate(row, k).Cmp(inst.field.Evaluate(column, k)) != 0 {
+		s.logger.Warn().Str("instance", inst.id).Int("dealer", inst.dealer).Msg("Inconsistent dual-threshold share, ignoring")
+		s.metrics.Inc("ivss.bad_shares")
+		s.cp.AddSuspect(inst.dealer, fmt.Sprintf("dual-threshold share of %s is inconsistent", inst.id))
+		return
+	}
+	inst.column = column
+	s.acceptShare(inst, []*utils.Polynomial{row}, false, ctx)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"fmt"
+	"math/big"
+)
+
+// field returns the field of the secret of an instance, see
+// NodeContext.IVSSField. nil is utils.DefaultField.
+func (s *IVSSService) field(instanceID string) *utils.Field {
+	if s.fieldOf == nil {
+		return nil
+	}
+	return s.fieldOf(instanceID)
+}
+
+// committed reports whether the dealer of an instance commits to its
+// polynomial. Commitments live in a group of order utils.Prime, so they
+// only cover instances of the default field.
+func (s *IVSSService) committed(instanceID string) bool {
+	return s.commitments && s.field(instanceID).Equal(utils.DefaultField)
+}
+
+// checkSecret checks that secret is an element of the field of an
+// instance, rather than letting the sharing reduce it.
+func (s *IVSSService) checkSecret(instanceID string, secret *big.Int) error {
+	if f := s.field(instanceID); !f.Contains(secret) {
+		return fmt.Errorf("secret is not an element of field %s", f)
+	}
+	return nil
+}
+
+// validateField checks that the shares and points of a direct message are
+// elements of field f. validateDirect only checks them against the largest
+// field the encoding admits.
+func (m *IVSSMessage) validateField(f *utils.Field) error {
+	if m.Poly != nil && !f.ContainsPolynomial(m.Poly) {
+		return fmt.Errorf("share outside field %s", f)
+	}
+	for i, p := range m.Polys {
+		if !f.ContainsPolynomial(p) {
+			return fmt.Errorf("share %d outside field %s", i+1, f)
+		}
+	}
+	if m.Point != nil && !f.Contains(m.Point) {
+		return fmt.Errorf("point outside field %s", f)
+	}
+	for i, p := range m.Points {
+		if !f.Contains(p) {
+			return fmt.Errorf("point %d outside field %s", i+1, f)
+		}
+	}
+	return nil
+}
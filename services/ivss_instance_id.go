@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxIVSSTag bounds the length of the tag of an instance ID.
+const MaxIVSSTag = 256
+
+// IVSSID is the structured form of an IVSS instance ID: the sharing Tag
+// that Dealer deals in Round. Its canonical encoding is "tag@dealer", or
+// "tag#round@dealer" for rounds after 0; ParseIVSSID accepts exactly one
+// spelling per ID, so no two strings open the same instance.
+type IVSSID struct {
+	Dealer int
+	Round  int
+	Tag    string
+}
+
+// String returns the canonical encoding of id.
+func (id IVSSID) String() string {
+	if id.Round == 0 {
+		return fmt.Sprintf("%s@%d", id.Tag, id.Dealer)
+	}
+	return fmt.Sprintf("%s#%d@%d", id.Tag, id.Round, id.Dealer)
+}
+
+// Validate checks that id has a dealer and a tag that encode unambiguously.
+func (id IVSSID) Validate() error {
+	if id.Dealer <= 0 {
+		return fmt.Errorf("dealer %d out of range", id.Dealer)
+	}
+	if id.Round < 0 {
+		return fmt.Errorf("round %d out of range", id.Round)
+	}
+	if id.Tag == "" || len(id.Tag) > MaxIVSSTag {
+		return fmt.Errorf("tag of %d bytes", len(id.Tag))
+	}
+	if strings.ContainsAny(id.Tag, "@#") {
+		return fmt.Errorf("tag %q contains @ or #", id.Tag)
+	}
+	for _, r := range id.Tag {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("tag %q contains a control character", id.Tag)
+		}
+	}
+	return nil
+}
+
+// ParseIVSSID parses the canonical encoding of an instance ID.
+func ParseIVSSID(s string) (IVSSID, error) {
+	var id IVSSID
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return id, fmt.Errorf("instance %q names no dealer", s)
+	}
+	dealer, ok := parseCanonicalInt(s[at+1:])
+	if !ok {
+		return id, fmt.Errorf("instance %q has a malformed dealer", s)
+	}
+	id.Dealer, id.Tag = dealer, s[:at]
+	if hash := strings.LastIndexByte(id.Tag, '#'); hash >= 0 {
+		round, ok := parseCanonicalInt(id.Tag[hash+1:])
+		if !ok || round == 0 {
+			return id, fmt.Errorf("instance %q has a malformed round", s)
+		}
+		id.Round, id.Tag = round, id.Tag[:hash]
+	}
+	if err := id.Validate(); err != nil {
+		return id, fmt.Errorf("instance %q: %w", s, err)
+	}
+	return id, nil
+}
+
+// validateIVSSID checks that instanceID is well-formed and names a dealer
+// of a cluster of n nodes.
+func validateIVSSID(instanceID string, n int) error {
+	id, err := ParseIVSSID(instanceID)
+	if err != nil {
+		return err
+	}
+	if !validNodeID(id.Dealer, n) {
+		return fmt.Errorf("instance %q: dealer %d out of range", instanceID, id.Dealer)
+	}
+	return nil
+}
+
+// parseCanonicalInt parses a non-negative decimal without sign or leading
+// zeros.
+func parseCanonicalInt(s string) (int, bool) {
+	v, err := strconv.Atoi(s)
+	return v, err == nil && v >= 0 && s == strconv.Itoa(v)
+}
+
+// withTagSuffix returns the ID of the instance of the same dealer and
+// round as id whose tag has suffix appended. A malformed id just gets
+// suffix appended.
+func withTagSuffix(id, suffix string) string {
+	parsed, err := ParseIVSSID(id)
+	if err != nil {
+		return id + suffix
+	}
+	parsed.Tag += suffix
+	return parsed.String()
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"fmt"
+)
+
+// StartPrivateReconstruction reconstructs the secret of a shared instance
+// for the receiver only, as threshold decryption and other uses of VSS
+// need. Instead of A-Casting its share, every node with one sends it to the
+// receiver directly (encrypted if the nodes have share keys, see
+// ShareKeyring). The receiver decodes the secret from the shares of M and
+// of the nodes M vouches for like in a public reconstruction, and reports
+// it as a PRIVATELY_RECONSTRUCTED result; the other nodes learn nothing.
+// Every node must call it with the same receiver. The secret is no longer
+// secret from the receiver, so the instance is not reused.
+func (s *IVSSService) StartPrivateReconstruction(instanceID string, receiver int, ctx ServiceContext[IVSSMessage, IVSSResult]) error {
+	if !validNodeID(receiver, s.n) {
+		return fmt.Errorf("receiver %d out of range", receiver)
+	}
+	inst := s.lookup(instanceID, true)
+	if inst == nil {
+		return fmt.Errorf("instance %s was evicted and cannot be restored", instanceID)
+	}
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if !inst.sharingCompleted {
+		return fmt.Errorf("sharing not completed for instance %s", instanceID)
+	}
+	if inst.secrets > 0 {
+		return fmt.Errorf("instance %s is a batch, its secrets are reconstructed one by one", instanceID)
+	}
+
+	s.cp.MarkInvocationConsumed(instanceID)
+	s.transition(inst, "START_PRIVATE_RECONSTRUCTION", inst.phase(), map[string]int{"receiver": receiver})
+	if inst.receivedPoly == nil {
+		s.logger.Info().Str("instance", inst.id).Msg("No share, skipping private reconstruction")
+		return nil
+	}
+	s.sendDirect(IVSSMessage{
+		Type:       IVSS_Direct,
+		DirectType: Direct_PrivateReveal,
+		To:         receiver,
+		From:       s.id,
+		InstanceID: inst.id,
+		Poly:       inst.receivedPoly,
+	}, ctx)
+	return nil
+}
+
+// checkPrivateReconstruction decodes the secret from the shares sent to
+// this node once there are enough of them and M is known.
+func (s *IVSSService) checkPrivateReconstruction(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if inst.mSet == nil || inst.privateSecret != nil || len(inst.privatePolys) == 0 {
+		return
+	}
+	secret, ok := s.decodeSecret(inst, inst.privatePolys)
+	if !ok {
+		return
+	}
+	inst.privateSecret = secret
+	s.metrics.Inc("ivss.private_reconstructions")
+	s.transition(inst, "PRIVATE_RECONSTRUCT", inst.phase(), map[string]int{"revealed": len(inst.privatePolys)})
+	s.logger.Info().Str("instance", inst.id).Msg("Private Reconstruction Complete")
+
+	ctx.SendResult(IVSSResult{
+		InstanceID: inst.id,
+		Type:       "PRIVATELY_RECONSTRUCTED",
+		Secret:     secret,
+	})
+}
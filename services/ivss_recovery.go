@@ -0,0 +1,142 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+)
+
+// RecoverShare asks the other nodes for the share f_k of this node, for
+// when the dealer's share never arrived or was lost in a restart. Every node
+// whose share is sound (it is in M or M vouches for it) answers with its
+// point f_j(k) = F(j, k) = f_k(j) once its sharing completes. With the
+// dealer's commitment each point is checked on its own and t+1 of them
+// give f_k; without one the points are decoded like reveals, which takes
+// 2t+1 correct ones. The recovered share is reported as a SHARE_RECOVERED
+// result and its points are sent out, so the node can still be vouched
+// for. Calling it again repeats the requests.
+func (s *IVSSService) RecoverShare(instanceID string, ctx ServiceContext[IVSSMessage, IVSSResult]) error {
+	inst := s.lookup(instanceID, true)
+	if inst == nil {
+		return fmt.Errorf("instance %s was evicted and cannot be restored", instanceID)
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if inst.shares() != nil {
+		return fmt.Errorf("node %d already has its share of %s", s.id, instanceID)
+	}
+	if inst.secrets > 0 {
+		return fmt.Errorf("instance %s is a batch, its shares are recovered one by one", instanceID)
+	}
+	inst.recovering = true
+	s.logger.Info().Str("instance", inst.id).Msg("Requesting share recovery")
+	for j := 1; j <= s.n; j++ {
+		if j == s.id {
+			continue
+		}
+		s.sendDirect(IVSSMessage{
+			Type:       IVSS_Direct,
+			DirectType: Direct_ShareRequest,
+			To:         j,
+			From:       s.id,
+			InstanceID: inst.id,
+		}, ctx)
+	}
+	return nil
+}
+
+// answerShareRequests sends the pending requesters their point of our
+// share, once it is known to be sound.
+func (s *IVSSService) answerShareRequests(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	// Rows of a dual-threshold sharing have degree 2t, see startDualSharing
+	if len(inst.shareRequests) == 0 || !inst.sharingCompleted || inst.receivedPoly == nil || inst.column != nil {
+		return
+	}
+	if !slices.Contains(inst.mSet, s.id) && !s.vouched(inst, s.id) {
+		return
+	}
+	requesters := make([]int, 0, len(inst.shareRequests))
+	for k := range inst.shareRequests {
+		requesters = append(requesters, k)
+	}
+	sort.Ints(requesters)
+	for _, k := range requesters {
+		s.sendDirect(IVSSMessage{
+			Type:       IVSS_Direct,
+			DirectType: Direct_ShareResponse,
+			To:         k,
+			From:       s.id,
+			InstanceID: inst.id,
+			Point:      inst.field.Evaluate(inst.receivedPoly, big.NewInt(int64(k))),
+			PointIdx:   k,
+		}, ctx)
+	}
+	inst.shareRequests = make(map[int]bool)
+}
+
+// acceptRecoveryPoint stores the point from sent for our share and tries
+// to recover it.
+func (s *IVSSService) acceptRecoveryPoint(inst *IVSSInstance, from int, point *big.Int, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if !inst.recovering || inst.shares() != nil || inst.recoveryPoints[from] != nil {
+		return
+	}
+	if inst.commitment != nil && !inst.commitment.VerifyPoint(from, s.id, point) {
+		s.logger.Warn().Str("instance", inst.id).Int("from", from).Msg("Recovery point does not match the dealer's commitment, ignoring")
+		s.cp.AddSuspect(from, fmt.Sprintf("recovery point of %s does not match its commitment", inst.id))
+		return
+	}
+	inst.recoveryPoints[from] = point
+
+	senders := make([]int, 0, len(inst.recoveryPoints))
+	for j := range inst.recoveryPoints {
+		senders = append(senders, j)
+	}
+	sort.Ints(senders)
+	errs := 0
+	if inst.commitment != nil {
+		// Every point is verified, so any t+1 of them do
+		if len(senders) < s.t+1 {
+			return
+		}
+		senders = senders[:s.t+1]
+	} else {
+		var ok bool
+		if errs, ok = s.correctable(len(senders)); !ok {
+			return
+		}
+	}
+
+	xs := make([]*big.Int, len(senders))
+	ys := make([]*big.Int, len(senders))
+	for i, j := range senders {
+		xs[i] = big.NewInt(int64(j))
+		ys[i] = inst.recoveryPoints[j]
+	}
+	share, wrong, err := inst.field.CorrectErrors(xs, ys, s.t, errs)
+	if err != nil {
+		s.logger.Debug().Str("instance", inst.id).Int("points", len(senders)).Msg("Recovery points not decodable yet, waiting for more")
+		return
+	}
+	for _, i := range wrong {
+		s.logger.Warn().Str("instance", inst.id).Int("from", senders[i]).Msg("Recovery point does not match the recovered share")
+		s.cp.AddSuspect(senders[i], fmt.Sprintf("recovery point of %s does not match the recovered share", inst.id))
+	}
+
+	inst.recovering = false
+	inst.recoveryPoints = make(map[int]*big.Int)
+	s.metrics.Inc("ivss.shares.recovered")
+	s.transition(inst, "RECOVER_SHARE", inst.phase(), map[string]int{"points": len(senders)})
+	s.logger.Info().Str("instance", inst.id).Msg("Share recovered")
+	s.acceptShare(inst, []*utils.Polynomial{share}, false, ctx)
+	s.answerShareRequests(inst, ctx)
+
+	ctx.SendResult(IVSSResult{
+		InstanceID: inst.id,
+		Type:       "SHARE_RECOVERED",
+		MSet:       inst.mSet,
+		Poly:       share,
+	})
+}
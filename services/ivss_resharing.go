@@ -0,0 +1,139 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ivssRefreshMarker separates the name of an instance from the epoch of
+// one of its refreshes, see IVSSRefreshID.
+const ivssRefreshMarker = "/refresh-"
+
+// IVSSRefreshID names the sharing of zero that refreshes the shares of
+// instanceID for the given epoch (from 1): "name@dealer" becomes
+// "name/refresh-epoch@dealer", dealt by the same dealer.
+func IVSSRefreshID(instanceID string, epoch int) string {
+	return withTagSuffix(instanceID, ivssRefreshMarker+strconv.Itoa(epoch))
+}
+
+// ivssRefreshTarget returns the instance and epoch a refresh ID of
+// IVSSRefreshID names, and false for other IDs.
+func ivssRefreshTarget(id string) (string, int, bool) {
+	parsed, err := ParseIVSSID(id)
+	if err != nil {
+		return "", 0, false
+	}
+	i := strings.LastIndex(parsed.Tag, ivssRefreshMarker)
+	if i <= 0 {
+		return "", 0, false
+	}
+	epoch, ok := parseCanonicalInt(parsed.Tag[i+len(ivssRefreshMarker):])
+	if !ok || epoch == 0 {
+		return "", 0, false
+	}
+	parsed.Tag = parsed.Tag[:i]
+	return parsed.String(), epoch, true
+}
+
+// StartResharing refreshes the shares of a completed sharing (Dealer only)
+// without changing its secret: the dealer shares zero under
+// IVSSRefreshID(instanceID, epoch), and once that sharing completes every
+// node adds its share of zero to its share of the secret. Shares taken
+// before and after a refresh do not combine, so a long-lived secret whose
+// shares leak over time stays safe as long as fewer than t+1 leak within
+// one epoch. Refreshes apply in epoch order; a node that misses its share
+// of zero loses its share and can get the new one with RecoverShare. With
+// commitments nodes check that the dealer shares zero, and their
+// commitment follows the refreshed polynomial. Do not reshare an instance
+// while it is being reconstructed.
+func (s *IVSSService) StartResharing(instanceID string, ctx ServiceContext[IVSSMessage, IVSSResult]) error {
+	if dealer, ok := IVSSDealer(instanceID); !ok || dealer != s.id {
+		return fmt.Errorf("instance %s is not dealt by node %d", instanceID, s.id)
+	}
+	inst := s.lookup(instanceID, true)
+	if inst == nil {
+		return fmt.Errorf("instance %s was evicted and cannot be restored", instanceID)
+	}
+	inst.mu.Lock()
+	switch {
+	case !inst.sharingCompleted:
+		inst.mu.Unlock()
+		return fmt.Errorf("sharing not completed for instance %s", instanceID)
+	case inst.secrets > 0:
+		inst.mu.Unlock()
+		return fmt.Errorf("instance %s is a batch, its secrets are reshared one by one", instanceID)
+	case inst.reconstructed:
+		inst.mu.Unlock()
+		return fmt.Errorf("instance %s is reconstructed, its secret is public", instanceID)
+	}
+	inst.reshares = max(inst.reshares, inst.epoch) + 1
+	epoch := inst.reshares
+	inst.mu.Unlock()
+
+	s.logger.Info().Str("instance", instanceID).Int("epoch", epoch).Msg("Starting Resharing as Dealer")
+	return s.StartSharing(IVSSRefreshID(instanceID, epoch), new(big.Int), ctx)
+}
+
+// ivssRefresh is what a completed refresh contributes to its instance.
+type ivssRefresh struct {
+	share      *utils.Polynomial
+	column     *utils.Polynomial
+	commitment *utils.Commitment
+}
+
+// completeRefresh hands the share of zero of a completed refresh to the
+// instance it refreshes.
+func (s *IVSSService) completeRefresh(refresh *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	baseID, epoch, _ := ivssRefreshTarget(refresh.id)
+	inst := s.lookup(baseID, true)
+	if inst == nil {
+		return
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if epoch <= inst.epoch {
+		return
+	}
+	inst.refreshes[epoch] = ivssRefresh{share: refresh.receivedPoly, column: refresh.column, commitment: refresh.commitment}
+	s.applyRefreshes(inst, ctx)
+}
+
+// applyRefreshes applies the completed refreshes of inst that are next in
+// epoch order.
+func (s *IVSSService) applyRefreshes(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	for {
+		refresh, ok := inst.refreshes[inst.epoch+1]
+		if !ok {
+			return
+		}
+		delete(inst.refreshes, inst.epoch+1)
+		from := inst.phase()
+		inst.epoch++
+
+		if inst.receivedPoly != nil && refresh.share != nil {
+			inst.receivedPoly = inst.field.Add(inst.receivedPoly, refresh.share)
+			if inst.column != nil && refresh.column != nil {
+				inst.column = inst.field.Add(inst.column, refresh.column)
+			}
+		} else if inst.receivedPoly != nil {
+			s.logger.Warn().Str("instance", inst.id).Int("epoch", inst.epoch).Msg("Missed the share of a refresh, dropping the stale share")
+			inst.receivedPoly, inst.column = nil, nil
+		}
+		if inst.commitment != nil && refresh.commitment != nil {
+			inst.commitment = inst.commitment.Add(refresh.commitment)
+		}
+		s.metrics.Inc("ivss.reshares")
+		s.transition(inst, "RESHARE", from, map[string]int{"epoch": inst.epoch})
+		s.logger.Info().Str("instance", inst.id).Int("epoch", inst.epoch).Msg("Shares refreshed")
+
+		ctx.SendResult(IVSSResult{
+			InstanceID: inst.id,
+			Type:       "RESHARED",
+			MSet:       inst.mSet,
+			Poly:       inst.receivedPoly,
+		})
+	}
+}
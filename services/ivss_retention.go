@@ -0,0 +1,306 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// IVSSRetention bounds the instances an IVSSService keeps. The zero value
+// keeps every instance forever. Only completed instances are evicted: those
+// that are shared and either reconstructed or not being reconstructed.
+// Evicted instances go to the IVSSArchive if there is one, so their
+// reconstruction can still be served; without one, late messages for them
+// are ignored.
+type IVSSRetention struct {
+	// Completed instances are evicted this long after completion, 0 keeps
+	// them
+	TTL time.Duration
+	// Beyond this many instances the oldest completed ones are evicted; 0
+	// for no limit
+	MaxInstances int
+}
+
+// IVSSRecord is what an IVSSArchive keeps of a shared instance: enough for
+// the node to take part in its reconstruction.
+type IVSSRecord struct {
+	InstanceID string
+	Dealer     int
+	Share      *utils.Polynomial // f_k of this node
+	MSet       []int
+	Secret     *big.Int `json:",omitempty"` // Set once reconstructed
+	Epoch      int      `json:",omitempty"` // Refreshes applied to Share, see StartResharing
+
+	Column *utils.Polynomial `json:",omitempty"` // F(x, k) of a dual-threshold sharing
+}
+
+// IVSSArchive persists the instances an IVSSService evicts. Restore returns
+// false if it has no record of the instance.
+type IVSSArchive interface {
+	Archive(rec IVSSRecord) error
+	Restore(instanceID string) (IVSSRecord, bool, error)
+}
+
+// MemoryIVSSArchive keeps the records in memory. Useful for tests.
+type MemoryIVSSArchive struct {
+	records map[string]IVSSRecord
+	mu      sync.Mutex
+}
+
+func NewMemoryIVSSArchive() *MemoryIVSSArchive {
+	return &MemoryIVSSArchive{records: make(map[string]IVSSRecord)}
+}
+
+func (m *MemoryIVSSArchive) Archive(rec IVSSRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[rec.InstanceID] = rec
+	return nil
+}
+
+func (m *MemoryIVSSArchive) Restore(instanceID string) (IVSSRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[instanceID]
+	return rec, ok, nil
+}
+
+// Len returns how many records the archive holds.
+func (m *MemoryIVSSArchive) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.records)
+}
+
+// FileIVSSArchive keeps each record as JSON in its own file in a directory.
+type FileIVSSArchive struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileIVSSArchive(dir string) *FileIVSSArchive {
+	return &FileIVSSArchive{dir: dir}
+}
+
+func (f *FileIVSSArchive) path(instanceID string) string {
+	return filepath.Join(f.dir, url.PathEscape(instanceID)+".json")
+}
+
+func (f *FileIVSSArchive) Archive(rec IVSSRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a truncated record
+	path := f.path(rec.InstanceID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *FileIVSSArchive) Restore(instanceID string) (IVSSRecord, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rec IVSSRecord
+	b, err := os.ReadFile(f.path(instanceID))
+	if errors.Is(err, os.ErrNotExist) {
+		return rec, false, nil
+	}
+	if err != nil {
+		return rec, false, err
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return rec, false, err
+	}
+	return rec, rec.InstanceID == instanceID, nil
+}
+
+// completed reports whether the instance may be evicted.
+func (inst *IVSSInstance) completed() bool {
+	return inst.sharingCompleted && len(inst.refreshes) == 0 &&
+		(inst.reconstructed || len(inst.reconstructedPolys) == 0 && len(inst.readyToComplete) == 0) &&
+		(inst.privateSecret != nil || len(inst.privatePolys) == 0)
+}
+
+func (inst *IVSSInstance) record() IVSSRecord {
+	rec := IVSSRecord{InstanceID: inst.id, Dealer: inst.dealer, Share: inst.receivedPoly, MSet: inst.mSet, Epoch: inst.epoch, Column: inst.column}
+	if inst.reconstructed {
+		rec.Secret = inst.secret
+	}
+	return rec
+}
+
+// restoreIVSSInstance rebuilds a shared instance from its record.
+func restoreIVSSInstance(rec IVSSRecord) *IVSSInstance {
+	inst := NewIVSSInstance(rec.InstanceID, rec.Dealer)
+	inst.receivedPoly = rec.Share
+	inst.column = rec.Column
+	inst.mSet = rec.MSet
+	inst.sharingCompleted = true
+	inst.epoch = rec.Epoch
+	inst.secret = rec.Secret
+	inst.reconstructed = rec.Secret != nil
+	inst.completedAt = time.Now()
+	return inst
+}
+
+// Instances returns how many instances the service keeps in memory.
+func (s *IVSSService) Instances() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.instances)
+}
+
+// lookup returns the instance id, creating it if it is new. Evicted
+// instances are restored from the archive if restore is set, and nil is
+// returned if they are not.
+func (s *IVSSService) lookup(id string, restore bool) *IVSSInstance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if inst, ok := s.instances[id]; ok {
+		return inst
+	}
+	if !s.evicted[id] {
+		dealer, _ := IVSSDealer(id)
+		s.instances[id] = NewIVSSInstance(id, dealer)
+		s.instances[id].field = s.field(id)
+		return s.instances[id]
+	}
+	if !restore || s.archive == nil {
+		return nil
+	}
+	rec, ok, err := s.archive.Restore(id)
+	if err != nil || !ok {
+		s.logger.Warn().Err(err).Str("instance", id).Msg("Cannot restore evicted instance")
+		return nil
+	}
+	delete(s.evicted, id)
+	s.instances[id] = restoreIVSSInstance(rec)
+	s.instances[id].field = s.field(id)
+	s.metrics.Inc("ivss.instances.restored")
+	return s.instances[id]
+}
+
+// collect evicts the completed instances that are past the retention
+// limits, oldest first. It must be called without any instance lock held.
+func (s *IVSSService) collect() {
+	if s.retention == (IVSSRetention{}) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Instances in use are skipped, they are collected next time
+	var done []*IVSSInstance
+	for _, inst := range s.instances {
+		if !inst.mu.TryLock() {
+			continue
+		}
+		if inst.completed() {
+			done = append(done, inst)
+		} else {
+			inst.mu.Unlock()
+		}
+	}
+	sort.Slice(done, func(i, j int) bool {
+		if !done[i].completedAt.Equal(done[j].completedAt) {
+			return done[i].completedAt.Before(done[j].completedAt)
+		}
+		return done[i].id < done[j].id
+	})
+
+	now := time.Now()
+	excess := 0
+	if max := s.retention.MaxInstances; max > 0 {
+		excess = len(s.instances) - max
+	}
+	for _, inst := range done {
+		expired := s.retention.TTL > 0 && now.Sub(inst.completedAt) >= s.retention.TTL
+		if (expired || excess > 0) && s.evict(inst) {
+			excess--
+		}
+		inst.mu.Unlock()
+	}
+}
+
+// release drops every instance, without archiving it, and the A-Cast
+// instances with them, for a service that is done for good.
+func (s *IVSSService) release() {
+	s.mu.Lock()
+	s.instances = make(map[string]*IVSSInstance)
+	s.evicted = make(map[string]bool)
+	s.mu.Unlock()
+	s.acast.release()
+}
+
+// releaseRound drops the instances of round and their A-Casts like
+// release, for a service the coins of every round share, except those keep
+// holds, which the coin of a later round reuses. A-Casts of batched
+// payloads name no instance and are left to NodeContext.ACastRetention.
+func (s *IVSSService) releaseRound(round int, keep func(instanceID string) bool) {
+	inRound := func(id string) bool {
+		r, ok := ivssRound(id)
+		return ok && r == round && !keep(ivssInstance(id))
+	}
+	s.mu.Lock()
+	for id := range s.instances {
+		if inRound(id) {
+			delete(s.instances, id)
+		}
+	}
+	for id := range s.evicted {
+		if inRound(id) {
+			delete(s.evicted, id)
+		}
+	}
+	s.mu.Unlock()
+	s.acast.releaseWhere(inRound)
+}
+
+// releaseInstances drops the instances of ids and their A-Casts like
+// releaseRound, once no coin reuses them.
+func (s *IVSSService) releaseInstances(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	drop := make(map[string]bool, len(ids))
+	s.mu.Lock()
+	for _, id := range ids {
+		drop[id] = true
+		delete(s.instances, id)
+		delete(s.evicted, id)
+	}
+	s.mu.Unlock()
+	s.acast.releaseWhere(func(uuid string) bool { return drop[ivssInstance(uuid)] })
+}
+
+// evict archives the instance and drops it. Instances the archive fails to
+// keep stay in memory.
+func (s *IVSSService) evict(inst *IVSSInstance) bool {
+	if s.archive != nil {
+		if err := s.archive.Archive(inst.record()); err != nil {
+			s.logger.Error().Err(err).Str("instance", inst.id).Msg("Failed to archive instance, keeping it")
+			return false
+		}
+	}
+	delete(s.instances, inst.id)
+	s.evicted[inst.id] = true
+	s.metrics.Inc("ivss.instances.evicted")
+	return true
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	ErrUnsealed   = errors.New("direct message is not encrypted")
+	ErrUnsealable = errors.New("cannot decrypt direct message")
+)
+
+// shareSealingDomain separates the keys IVSS derives from anything else
+// the X25519 keys might be used for.
+const shareSealingDomain = "aba-ivss-sealed-share-v1"
+
+// ShareKeyring maps node IDs to the X25519 public keys IVSS encrypts shares
+// and points for.
+type ShareKeyring struct {
+	keys map[int]*ecdh.PublicKey
+}
+
+func NewShareKeyring(keys map[int]*ecdh.PublicKey) *ShareKeyring {
+	k := &ShareKeyring{keys: make(map[int]*ecdh.PublicKey, len(keys))}
+	for id, key := range keys {
+		k.keys[id] = key
+	}
+	return k
+}
+
+// GenerateShareKeys creates X25519 key pairs for nodes 1..n from rand
+// (crypto/rand when nil) and returns the private keys with the keyring of
+// their public keys.
+func GenerateShareKeys(n int, rand io.Reader) (map[int]*ecdh.PrivateKey, *ShareKeyring, error) {
+	if rand == nil {
+		rand = crand.Reader
+	}
+	private := make(map[int]*ecdh.PrivateKey, n)
+	public := make(map[int]*ecdh.PublicKey, n)
+	for id := 1; id <= n; id++ {
+		priv, err := ecdh.X25519().GenerateKey(rand)
+		if err != nil {
+			return nil, nil, err
+		}
+		private[id], public[id] = priv, priv.PublicKey()
+	}
+	return private, NewShareKeyring(public), nil
+}
+
+// PublicKey returns the key of node id, or nil if it is unknown.
+func (k *ShareKeyring) PublicKey(id int) *ecdh.PublicKey {
+	return k.keys[id]
+}
+
+// shareSealer encrypts the shares and points of one node for their
+// recipients. Each pair of nodes shares an AES-256-GCM key derived from
+// X25519 between their static keys, so a message that opens also comes
+// from the node it names as sender. The nonce is random and travels in
+// front of the ciphertext.
+type shareSealer struct {
+	self    int
+	key     *ecdh.PrivateKey
+	keyring *ShareKeyring
+	rand    io.Reader
+
+	aeads map[int]cipher.AEAD // Per peer
+	mu    sync.Mutex
+}
+
+// newShareSealer returns the sealer of nc, or nil if it has no share keys.
+func newShareSealer(nc *NodeContext) *shareSealer {
+	if nc.ShareKey == nil || nc.ShareKeys == nil {
+		return nil
+	}
+	return &shareSealer{
+		self:    nc.ID,
+		key:     nc.ShareKey,
+		keyring: nc.ShareKeys,
+		rand:    nc.random(),
+		aeads:   make(map[int]cipher.AEAD),
+	}
+}
+
+// aead returns the cipher this node shares with peer.
+func (s *shareSealer) aead(peer int) (cipher.AEAD, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if aead, ok := s.aeads[peer]; ok {
+		return aead, nil
+	}
+	pub := s.keyring.PublicKey(peer)
+	if pub == nil {
+		return nil, fmt.Errorf("no share key for node %d", peer)
+	}
+	secret, err := s.key.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	// Both directions use the same key, named by the pair in order
+	lo, hi := min(s.self, peer), max(s.self, peer)
+	info := binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64([]byte(shareSealingDomain), uint64(lo)), uint64(hi))
+	key, err := hkdf.Key(sha256.New, secret, nil, string(info), 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s.aeads[peer] = aead
+	return aead, nil
+}
+
+// additionalData binds a ciphertext to the fields of its message, so it
+// cannot be replayed into another instance, direction or point index.
+func (m *IVSSMessage) additionalData() []byte {
+	b := make([]byte, 0, 40+len(m.InstanceID))
+	b = binary.BigEndian.AppendUint64(b, uint64(m.DirectType))
+	b = binary.BigEndian.AppendUint64(b, uint64(m.From))
+	b = binary.BigEndian.AppendUint64(b, uint64(m.To))
+	b = binary.BigEndian.AppendUint64(b, uint64(m.PointIdx))
+	b = binary.BigEndian.AppendUint64(b, uint64(len(m.InstanceID)))
+	return append(b, m.InstanceID...)
+}
+
+// seal moves the polynomial or point of msg into Sealed, encrypted for its
+// recipient. Share requests carry nothing but are sealed all the same, so
+// they are authenticated.
+func (s *shareSealer) seal(msg IVSSMessage) (IVSSMessage, error) {
+	aead, err := s.aead(msg.To)
+	if err != nil {
+		return msg, err
+	}
+	var plain []byte
+	switch msg.DirectType {
+	case Direct_Share, Direct_PrivateReveal:
+		if msg.Poly == nil {
+			return msg, fmt.Errorf("share without a polynomial")
+		}
+		if plain, err = msg.Poly.MarshalBinary(); err != nil {
+			return msg, err
+		}
+	case Direct_ShareRequest:
+		plain = []byte{}
+	case Direct_Point, Direct_ShareResponse:
+		var ok bool
+		if plain, ok = utils.EncodeFieldElement(msg.Point); !ok {
+			return msg, fmt.Errorf("point is not a field element")
+		}
+	case Direct_BatchShare, Direct_DualShare:
+		// Each share prefixed with its length
+		for _, poly := range msg.Polys {
+			if poly == nil {
+				return msg, fmt.Errorf("share without a polynomial")
+			}
+			b, err := poly.MarshalBinary()
+			if err != nil {
+				return msg, err
+			}
+			plain = binary.BigEndian.AppendUint32(plain, uint32(len(b)))
+			plain = append(plain, b...)
+		}
+	case Direct_BatchPoint, Direct_DualPoint:
+		for _, point := range msg.Points {
+			b, ok := utils.EncodeFieldElement(point)
+			if !ok {
+				return msg, fmt.Errorf("point is not a field element")
+			}
+			plain = append(plain, b...)
+		}
+	default:
+		return msg, fmt.Errorf("unknown direct message type %d", msg.DirectType)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(s.rand, nonce); err != nil {
+		return msg, err
+	}
+	msg.Sealed = aead.Seal(nonce, nonce, plain, msg.additionalData())
+	msg.Poly, msg.Point, msg.Polys, msg.Points = nil, nil, nil, nil
+	return msg, nil
+}
+
+// open restores the polynomial or point of a sealed msg. Messages that are
+// not sealed are rejected, so a sender cannot fall back to plaintext.
+func (s *shareSealer) open(msg IVSSMessage) (IVSSMessage, error) {
+	if msg.Sealed == nil {
+		return msg, fmt.Errorf("%w from %d", ErrUnsealed, msg.From)
+	}
+	aead, err := s.aead(msg.From)
+	if err != nil {
+		return msg, fmt.Errorf("%w from %d: %v", ErrUnsealable, msg.From, err)
+	}
+	if len(msg.Sealed) < aead.NonceSize() {
+		return msg, fmt.Errorf("%w from %d: too short", ErrUnsealable, msg.From)
+	}
+	nonce, ciphertext := msg.Sealed[:aead.NonceSize()], msg.Sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, msg.additionalData())
+	if err != nil {
+		return msg, fmt.Errorf("%w from %d: %v", ErrUnsealable, msg.From, err)
+	}
+	msg.Poly, msg.Point, msg.Polys, msg.Points, msg.Sealed = nil, nil, nil, nil, nil
+	switch msg.DirectType {
+	case Direct_Share, Direct_PrivateReveal:
+		msg.Poly = new(utils.Polynomial)
+		if err := msg.Poly.UnmarshalBinary(plain); err != nil {
+			return msg, fmt.Errorf("%w from %d: %v", ErrUnsealable, msg.From, err)
+		}
+	case Direct_Point, Direct_ShareResponse:
+		if msg.Point, err = utils.DecodeFieldElement(plain); err != nil {
+			return msg, fmt.Errorf("%w from %d: %v", ErrUnsealable, msg.From, err)
+		}
+	case Direct_BatchShare, Direct_DualShare:
+		for len(plain) > 0 {
+			if len(plain) < 4 || uint32(len(plain)-4) < binary.BigEndian.Uint32(plain) {
+				return msg, fmt.Errorf("%w from %d: truncated share", ErrUnsealable, msg.From)
+			}
+			size := binary.BigEndian.Uint32(plain)
+			poly := new(utils.Polynomial)
+			if err := poly.UnmarshalBinary(plain[4 : 4+size]); err != nil {
+				return msg, fmt.Errorf("%w from %d: %v", ErrUnsealable, msg.From, err)
+			}
+			msg.Polys = append(msg.Polys, poly)
+			plain = plain[4+size:]
+		}
+	case Direct_BatchPoint, Direct_DualPoint:
+		if len(plain)%utils.FieldElementSize != 0 {
+			return msg, fmt.Errorf("%w from %d: truncated points", ErrUnsealable, msg.From)
+		}
+		for ; len(plain) > 0; plain = plain[utils.FieldElementSize:] {
+			point, _ := utils.DecodeFieldElement(plain[:utils.FieldElementSize])
+			msg.Points = append(msg.Points, point)
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ErrUnknownIVSSInstance is returned for instances the service never saw.
+var ErrUnknownIVSSInstance = errors.New("unknown IVSS instance")
+
+// IVSSInstanceState is a snapshot of the sharing phase of one IVSS
+// instance, for debugging liveness: which inputs it is still waiting for.
+type IVSSInstanceState struct {
+	InstanceID  string
+	Dealer      int
+	Phase       string // INIT, SHARED or RECONSTRUCTED
+	HasShare    bool
+	EarlyPoints int   // Points waiting for the share
+	Equals      int   // EQUALs delivered, each pair counted per direction
+	Consistent  []int `json:",omitempty"` // Nodes whose point matched our share
+	Commitment  bool  // Whether the dealer's commitment was delivered
+	PendingMSet []int `json:",omitempty"` // M-Set of the dealer not verified yet
+	MSet        []int `json:",omitempty"`
+
+	Created      time.Time
+	LastProgress time.Time // Last share, EQUAL or M-Set
+}
+
+// state takes a snapshot of inst.
+func (inst *IVSSInstance) state() IVSSInstanceState {
+	return IVSSInstanceState{
+		InstanceID:   inst.id,
+		Dealer:       inst.dealer,
+		Phase:        inst.phase(),
+		HasShare:     inst.shares() != nil,
+		EarlyPoints:  len(inst.earlyPoints),
+		Equals:       len(inst.completedEquals),
+		Consistent:   inst.consistent(),
+		Commitment:   inst.commitment != nil,
+		PendingMSet:  slices.Clone(inst.pendingMSet),
+		MSet:         slices.Clone(inst.mSet),
+		Created:      inst.createdAt,
+		LastProgress: inst.progressAt,
+	}
+}
+
+// InstanceState returns a snapshot of instance id, or false if the service
+// keeps no such instance.
+func (s *IVSSService) InstanceState(id string) (IVSSInstanceState, bool) {
+	s.mu.Lock()
+	inst, ok := s.instances[id]
+	s.mu.Unlock()
+	if !ok {
+		return IVSSInstanceState{}, false
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	return inst.state(), true
+}
+
+// outcome reports whether this node completed the sharing of instance id
+// and the secret it reconstructed, if any, e.g. for a coin that reuses a
+// sharing whose results went to the coin of an earlier round.
+func (s *IVSSService) outcome(id string) (bool, *big.Int) {
+	s.mu.Lock()
+	inst, ok := s.instances[id]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if !inst.reconstructed {
+		return inst.sharingCompleted, nil
+	}
+	return inst.sharingCompleted, inst.secret
+}
+
+// consistent returns the nodes whose point matched our share, sorted.
+func (inst *IVSSInstance) consistent() []int {
+	if len(inst.consistentPeers) == 0 {
+		return nil
+	}
+	peers := make([]int, 0, len(inst.consistentPeers))
+	for j := range inst.consistentPeers {
+		peers = append(peers, j)
+	}
+	sort.Ints(peers)
+	return peers
+}
+
+// GetInstanceStatus returns the phase of instance id (INIT, SHARED or
+// RECONSTRUCTED), its M-Set once the sharing completed, and the nodes whose
+// point matched this node's share, for introspection without waiting on
+// results. It fails with ErrUnknownIVSSInstance for instances the service
+// never saw, and for evicted ones.
+func (s *IVSSService) GetInstanceStatus(id string) (string, []int, []int, error) {
+	s.mu.Lock()
+	inst, ok := s.instances[id]
+	evicted := s.evicted[id]
+	s.mu.Unlock()
+	if evicted {
+		return "", nil, nil, fmt.Errorf("%w: %s was evicted", ErrUnknownIVSSInstance, id)
+	}
+	if !ok {
+		return "", nil, nil, fmt.Errorf("%w: %s", ErrUnknownIVSSInstance, id)
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	return inst.phase(), slices.Clone(inst.mSet), inst.consistent(), nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"time"
+)
+
+// progress records that the sharing of inst moved forward.
+func (inst *IVSSInstance) progress() {
+	inst.progressAt = time.Now()
+	inst.stalled = false
+}
+
+// watch starts the watchdog of inst, see NodeContext.IVSSWatchdog.
+func (s *IVSSService) watch(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if s.watchdog <= 0 || inst.watching || inst.sharingCompleted {
+		return
+	}
+	inst.watching = true
+	s.armWatchdog(inst.id, s.watchdog, ctx)
+}
+
+// armWatchdog has the node send itself a Direct_Watchdog for instance id
+// after d. Results may only be sent while handling a message, so the timer
+// wakes the service through its inbox instead of checking the instance
+// itself.
+func (s *IVSSService) armWatchdog(id string, d time.Duration, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	time.AfterFunc(d, func() {
+		ctx.SendTo(s.id, IVSSMessage{Type: IVSS_Direct, DirectType: Direct_Watchdog, To: s.id, From: s.id, InstanceID: id})
+	})
+}
+
+// checkStalled reports inst as STALLED if its sharing made no progress
+// within the budget, once per stall, and checks again until it completes.
+// It is safe against forged Direct_Watchdogs, since it only reports what
+// the instance shows.
+func (s *IVSSService) checkStalled(inst *IVSSInstance, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if !inst.watching {
+		return
+	}
+	if inst.sharingCompleted {
+		inst.watching = false
+		return
+	}
+	idle := time.Since(inst.progressAt)
+	next := s.watchdog - idle
+	if next <= 0 {
+		next = s.watchdog
+	}
+	s.armWatchdog(inst.id, next, ctx)
+	if idle < s.watchdog || inst.stalled {
+		return
+	}
+
+	inst.stalled = true
+	st := inst.state()
+	s.logger.Warn().Str("instance", inst.id).Dur("idle", idle).Bool("share", st.HasShare).Int("equals", st.Equals).Msg("Sharing stalled")
+	s.metrics.Inc("ivss.stalled")
+	ctx.SendResult(IVSSResult{
+		InstanceID: inst.id,
+		Type:       "STALLED",
+		State:      &st,
+	})
+}
+
+// onWatchdog handles a Direct_Watchdog. It is not sealed, since it never
+// leaves the node.
+func (s *IVSSService) onWatchdog(msg IVSSMessage, ctx ServiceContext[IVSSMessage, IVSSResult]) {
+	if msg.From != s.id {
+		return
+	}
+	s.mu.Lock()
+	inst, ok := s.instances[msg.InstanceID]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	s.checkStalled(inst, results)
+}
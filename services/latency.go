@@ -0,0 +1,187 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyProfile models the links of a deployment: every message takes Base
+// plus a uniform share of Jitter, and each transmission is lost with
+// probability Loss. The protocols assume reliable channels, so a lost
+// transmission is not dropped but resent after RetransmitAfter, like TCP
+// would, which is what loss costs on a real network.
+type LatencyProfile struct {
+	Name            string
+	Base            time.Duration
+	Jitter          time.Duration
+	Loss            float64
+	RetransmitAfter time.Duration
+}
+
+// Predefined profiles, from measurements commonly quoted for each setting.
+var (
+	LatencyLAN = LatencyProfile{
+		Name:            "lan",
+		Base:            200 * time.Microsecond,
+		Jitter:          300 * time.Microsecond,
+		RetransmitAfter: 10 * time.Millisecond,
+	}
+	LatencyRegionalWAN = LatencyProfile{
+		Name:            "wan",
+		Base:            2 * time.Millisecond,
+		Jitter:          3 * time.Millisecond,
+		Loss:            0.001,
+		RetransmitAfter: 200 * time.Millisecond,
+	}
+	LatencyIntercontinental = LatencyProfile{
+		Name:            "intercontinental",
+		Base:            75 * time.Millisecond,
+		Jitter:          25 * time.Millisecond,
+		Loss:            0.01,
+		RetransmitAfter: 300 * time.Millisecond,
+	}
+	LatencyMobile = LatencyProfile{
+		Name:            "mobile",
+		Base:            40 * time.Millisecond,
+		Jitter:          80 * time.Millisecond,
+		Loss:            0.03,
+		RetransmitAfter: 500 * time.Millisecond,
+	}
+)
+
+var latencyProfiles = map[string]LatencyProfile{
+	LatencyLAN.Name:              LatencyLAN,
+	LatencyRegionalWAN.Name:      LatencyRegionalWAN,
+	LatencyIntercontinental.Name: LatencyIntercontinental,
+	LatencyMobile.Name:           LatencyMobile,
+}
+
+// ParseLatencyProfile returns the predefined profile with the given name.
+func ParseLatencyProfile(name string) (LatencyProfile, error) {
+	if p, ok := latencyProfiles[strings.ToLower(name)]; ok {
+		return p, nil
+	}
+	names := make([]string, 0, len(latencyProfiles))
+	for name := range latencyProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return LatencyProfile{}, fmt.Errorf("unknown latency profile %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Sample draws the delay of one delivery from rng.
+func (p LatencyProfile) Sample(rng *rand.Rand) time.Duration {
+	d := p.Base
+	if p.Jitter > 0 {
+		d += time.Duration(rng.Int63n(int64(p.Jitter)))
+	}
+	for p.Loss > 0 && rng.Float64() < p.Loss {
+		d += p.RetransmitAfter
+	}
+	return d
+}
+
+func (p LatencyProfile) String() string {
+	return fmt.Sprintf("%s (%v + up to %v jitter, %.1f%% loss)", p.Name, p.Base, p.Jitter, p.Loss*100)
+}
+
+// LatencyDistribution draws the delay of one delivery. LatencyProfile is
+// one; FixedLatency, UniformLatency and LogNormalLatency are the others.
+type LatencyDistribution interface {
+	Sample(rng *rand.Rand) time.Duration
+}
+
+// FixedLatency delays every delivery by the same duration.
+type FixedLatency time.Duration
+
+func (l FixedLatency) Sample(*rand.Rand) time.Duration {
+	return time.Duration(l)
+}
+
+// UniformLatency delays deliveries uniformly between Min and Max.
+type UniformLatency struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (l UniformLatency) Sample(rng *rand.Rand) time.Duration {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + time.Duration(rng.Int63n(int64(l.Max-l.Min)))
+}
+
+// LogNormalLatency delays deliveries by Median·e^(Sigma·Z) with Z standard
+// normal. Its long right tail is what latencies measured on real networks
+// look like: most messages close to the median, a few much slower.
+type LogNormalLatency struct {
+	Median time.Duration
+	Sigma  float64
+}
+
+func (l LogNormalLatency) Sample(rng *rand.Rand) time.Duration {
+	return time.Duration(float64(l.Median) * math.Exp(l.Sigma*rng.NormFloat64()))
+}
+
+// Link is the direction from one node to another. ID 0 stands for any node.
+type Link struct {
+	From int
+	To   int
+}
+
+// LatencyModel assigns a delay distribution to every link of a Network.
+// A delivery uses the first distribution found in Links for {from, to},
+// {0, to} and {from, 0}, and Default otherwise; links without any are
+// instant. Samples are drawn from one PRNG seeded with Seed.
+type LatencyModel struct {
+	Default LatencyDistribution
+	Links   map[Link]LatencyDistribution
+	Seed    int64
+}
+
+// distribution returns the distribution for the link from -> to, or nil.
+func (m LatencyModel) distribution(from, to int) LatencyDistribution {
+	if d, ok := lookupLink(m.Links, from, to); ok {
+		return d
+	}
+	return m.Default
+}
+
+// lookupLink returns the entry of links for {from, to}, {0, to} or
+// {from, 0}, in that order.
+func lookupLink[V any](links map[Link]V, from, to int) (V, bool) {
+	for _, link := range []Link{{from, to}, {0, to}, {from, 0}} {
+		if v, ok := links[link]; ok {
+			return v, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// linkLatency samples a LatencyModel for a Network.
+type linkLatency struct {
+	model LatencyModel
+	rng   *rand.Rand
+	mu    sync.Mutex
+}
+
+func newLinkLatency(model LatencyModel) *linkLatency {
+	return &linkLatency{model: model, rng: rand.New(rand.NewSource(model.Seed))}
+}
+
+// sample draws the delay of one delivery from -> to.
+func (l *linkLatency) sample(from, to int) time.Duration {
+	d := l.model.distribution(from, to)
+	if d == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return max(d.Sample(l.rng), 0)
+}
@@ -0,0 +1,589 @@
+//go:build libp2p
+
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	libp2pHelloProtocol  = protocol.ID("/aba/hello/1.0.0")
+	libp2pDirectProtocol = protocol.ID("/aba/direct/1.0.0")
+	libp2pDHTPrefix      = protocol.ID("/aba")
+
+	libp2pPollInterval = 50 * time.Millisecond
+	libp2pFindInterval = time.Second
+	libp2pMinBackoff   = 50 * time.Millisecond
+	libp2pMaxBackoff   = 2 * time.Second
+	libp2pWriteTimeout = 5 * time.Second
+	libp2pQueueSize    = 1 << 14
+)
+
+// LibP2PConfig configures the host of a LibP2PNetwork.
+type LibP2PConfig struct {
+	// ListenAddrs are the multiaddrs to listen on,
+	// /ip4/0.0.0.0/tcp/0 when empty.
+	ListenAddrs []string
+	// Bootstrap are full multiaddrs (ending in /p2p/<peer ID>) of nodes
+	// already in the cluster. The first node starts with none.
+	Bootstrap []string
+	// Cluster names the pubsub topic and the DHT rendezvous, so several
+	// clusters can share peers.
+	Cluster string
+	// Identity is the libp2p key of the node, random when nil.
+	Identity crypto.PrivKey
+}
+
+// LibP2PNetwork is a Transport over libp2p, for clusters whose nodes do not
+// know each other's addresses up front. Nodes find each other through a
+// Kademlia DHT seeded with the bootstrap peers, then exchange their node IDs
+// over a hello protocol. Broadcast publishes on a GossipSub topic and Send
+// opens a stream to the peer, with frames acknowledged and resent like on
+// TCPNetwork.
+//
+// GossipSub drops messages published before the peers joined the topic, so
+// broadcasts are held back until all n nodes are subscribed. Node IDs are
+// claimed, not proven: the first peer claiming an ID gets it.
+type LibP2PNetwork[TMsg any] struct {
+	self   int
+	n      int
+	codec  Codec[TMsg]
+	config LibP2PConfig
+
+	host  host.Host
+	dht   *dht.IpfsDHT
+	topic *pubsub.Topic
+	inbox chan TMsg
+
+	ids       map[int]peer.ID // Node ID of every peer that said hello
+	nodes     map[peer.ID]int
+	peers     map[int]*outbox
+	broadcast *outbox
+	known     chan struct{} // Signals newly learned node IDs
+
+	ctx    context.Context // Canceled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// NewLibP2PNetwork creates the transport of node self in a cluster of n
+// nodes and starts its libp2p host, whose addresses can then be handed to
+// other nodes as bootstrap peers.
+func NewLibP2PNetwork[TMsg any](self, n int, codec Codec[TMsg], config LibP2PConfig) (*LibP2PNetwork[TMsg], error) {
+	opts := []libp2p.Option{}
+	if len(config.ListenAddrs) > 0 {
+		opts = append(opts, libp2p.ListenAddrStrings(config.ListenAddrs...))
+	} else {
+		opts = append(opts, libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"))
+	}
+	if config.Identity != nil {
+		opts = append(opts, libp2p.Identity(config.Identity))
+	}
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LibP2PNetwork[TMsg]{
+		self:      self,
+		n:         n,
+		codec:     codec,
+		config:    config,
+		host:      h,
+		ids:       map[int]peer.ID{self: h.ID()},
+		nodes:     map[peer.ID]int{h.ID(): self},
+		peers:     make(map[int]*outbox),
+		broadcast: newOutbox(0, ""),
+		known:     make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+// Addrs returns the full multiaddrs of this node, to be used as Bootstrap
+// by other nodes.
+func (n *LibP2PNetwork[TMsg]) Addrs() []string {
+	info := peer.AddrInfo{ID: n.host.ID(), Addrs: n.host.Addrs()}
+	addrs, err := peer.AddrInfoToP2pAddrs(&info)
+	if err != nil {
+		return nil
+	}
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		out[i] = a.String()
+	}
+	return out
+}
+
+// Register sets the inbox of this node; call it before Listen, as messages
+// arriving earlier are dropped. A LibP2PNetwork carries the messages of one
+// node, so id must be the ID it was created for.
+func (n *LibP2PNetwork[TMsg]) Register(id int, ch chan TMsg) {
+	if id != n.self {
+		log.Error().Str("layer", "NETWORK").Int("node", n.self).Int("id", id).Msg("libp2p network cannot register another node, ignoring")
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.inbox = ch
+}
+
+// Listen joins the cluster: it starts the DHT, subscribes to the cluster
+// topic and starts looking for the other nodes.
+func (n *LibP2PNetwork[TMsg]) Listen() error {
+	var bootstrap []peer.AddrInfo
+	for _, s := range n.config.Bootstrap {
+		info, err := peer.AddrInfoFromString(s)
+		if err != nil {
+			return fmt.Errorf("bootstrap peer %q: %w", s, err)
+		}
+		bootstrap = append(bootstrap, *info)
+	}
+
+	n.host.SetStreamHandler(libp2pHelloProtocol, n.handleHello)
+	n.host.SetStreamHandler(libp2pDirectProtocol, n.handleDirect)
+	n.host.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			n.spawn(func() { n.hello(c.RemotePeer()) })
+		},
+	})
+
+	kdht, err := dht.New(n.ctx, n.host,
+		dht.Mode(dht.ModeServer),
+		dht.ProtocolPrefix(libp2pDHTPrefix),
+		dht.BootstrapPeers(bootstrap...))
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.dht = kdht
+	n.mu.Unlock()
+	for _, info := range bootstrap {
+		if err := n.host.Connect(n.ctx, info); err != nil {
+			log.Warn().Str("layer", "NETWORK").Int("node", n.self).Str("peer", info.ID.String()).Err(err).Msg("Failed to reach bootstrap peer")
+		}
+	}
+	if err := kdht.Bootstrap(n.ctx); err != nil {
+		return err
+	}
+
+	// Flood publishing sends every broadcast of this node straight to all
+	// subscribed peers instead of waiting for the gossip mesh to form. The
+	// queues are sized for the bursts of a protocol round, as pubsub drops
+	// messages when they overflow.
+	ps, err := pubsub.NewGossipSub(n.ctx, n.host,
+		pubsub.WithFloodPublish(true),
+		pubsub.WithMaxMessageSize(DefaultTCPMaxFrame),
+		pubsub.WithPeerOutboundQueueSize(libp2pQueueSize),
+		pubsub.WithValidateQueueSize(libp2pQueueSize))
+	if err != nil {
+		return err
+	}
+	topic, err := ps.Join("aba/" + n.config.Cluster)
+	if err != nil {
+		return err
+	}
+	sub, err := topic.Subscribe(pubsub.WithBufferSize(libp2pQueueSize))
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.topic = topic
+	n.mu.Unlock()
+
+	n.spawn(func() { n.receiveBroadcasts(sub) })
+	n.spawn(n.publish)
+	n.spawn(func() { n.discover(drouting.NewRoutingDiscovery(kdht)) })
+	return nil
+}
+
+func (n *LibP2PNetwork[TMsg]) Broadcast(msg TMsg) {
+	if frame, ok := n.encode(msg); ok {
+		n.broadcast.push(frame)
+	}
+}
+
+// Send delivers msg only to node to, once its peer is known.
+func (n *LibP2PNetwork[TMsg]) Send(to int, msg TMsg) {
+	if to < 1 || to > n.n {
+		return
+	}
+	frame, ok := n.encode(msg)
+	if !ok {
+		return
+	}
+	if to == n.self {
+		n.spawn(func() { n.deliver(frame) })
+		return
+	}
+	if p := n.peer(to); p != nil {
+		p.push(frame)
+	}
+}
+
+// Close leaves the cluster, drops the queued messages and stops the host.
+func (n *LibP2PNetwork[TMsg]) Close() error {
+	// Canceling the context also stops the pubsub router
+	n.cancel()
+	n.mu.Lock()
+	kdht := n.dht
+	n.mu.Unlock()
+	n.wg.Wait()
+
+	var err error
+	if kdht != nil {
+		err = kdht.Close()
+	}
+	return errors.Join(err, n.host.Close())
+}
+
+func (n *LibP2PNetwork[TMsg]) encode(msg TMsg) ([]byte, bool) {
+	data, err := n.codec.Marshal(msg)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to encode message, dropping")
+		return nil, false
+	}
+	return data, true
+}
+
+// spawn runs fn in a goroutine Close waits for. It returns false, without
+// running fn, once the network is closed.
+func (n *LibP2PNetwork[TMsg]) spawn(fn func()) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return false
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// discover advertises this node under the cluster rendezvous and connects
+// to the nodes found there until all n are known.
+func (n *LibP2PNetwork[TMsg]) discover(rd *drouting.RoutingDiscovery) {
+	ns := "aba/" + n.config.Cluster
+	dutil.Advertise(n.ctx, rd, ns)
+	for !n.allKnown() {
+		found, err := rd.FindPeers(n.ctx, ns)
+		if err == nil {
+			for info := range found {
+				if info.ID == n.host.ID() || len(info.Addrs) == 0 {
+					continue
+				}
+				n.host.Connect(n.ctx, info)
+			}
+		}
+		// A hello may have failed if the peer was not listening yet
+		for _, p := range n.host.Network().Peers() {
+			n.hello(p)
+		}
+		select {
+		case <-time.After(libp2pFindInterval):
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *LibP2PNetwork[TMsg]) allKnown() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.ids) == n.n
+}
+
+// hello asks the peer for its node ID, telling it ours.
+func (n *LibP2PNetwork[TMsg]) hello(p peer.ID) {
+	n.mu.Lock()
+	_, known := n.nodes[p]
+	n.mu.Unlock()
+	if known {
+		return
+	}
+	s, err := n.host.NewStream(n.ctx, p, libp2pHelloProtocol)
+	if err != nil {
+		return // Not an ABA node, e.g. a DHT-only peer
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(libp2pWriteTimeout))
+	if err := writeNodeID(s, n.self); err != nil {
+		return
+	}
+	if id, err := readNodeID(s); err == nil {
+		n.learn(p, id)
+	}
+}
+
+func (n *LibP2PNetwork[TMsg]) handleHello(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(libp2pWriteTimeout))
+	id, err := readNodeID(s)
+	if err != nil {
+		return
+	}
+	if writeNodeID(s, n.self) == nil {
+		n.learn(s.Conn().RemotePeer(), id)
+	}
+}
+
+// learn records that peer p is node id and wakes the senders waiting for it.
+func (n *LibP2PNetwork[TMsg]) learn(p peer.ID, id int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if id < 1 || id > n.n {
+		log.Warn().Str("layer", "NETWORK").Int("node", n.self).Str("peer", p.String()).Int("id", id).Msg("Peer claims an invalid node ID, ignoring")
+		return
+	}
+	if existing, ok := n.ids[id]; ok {
+		if existing != p {
+			log.Warn().Str("layer", "NETWORK").Int("node", n.self).Str("peer", p.String()).Int("id", id).Msg("Node ID already taken by another peer, ignoring")
+		}
+		return
+	}
+	n.ids[id] = p
+	n.nodes[p] = id
+	log.Debug().Str("layer", "NETWORK").Int("node", n.self).Int("peer", id).Msg("Peer discovered")
+	close(n.known)
+	n.known = make(chan struct{})
+}
+
+// peerID waits until the peer of node id is known. It returns false once
+// the network is closed.
+func (n *LibP2PNetwork[TMsg]) peerID(id int) (peer.ID, bool) {
+	for {
+		n.mu.Lock()
+		p, ok := n.ids[id]
+		known := n.known
+		n.mu.Unlock()
+		if ok {
+			return p, true
+		}
+		select {
+		case <-known:
+		case <-n.ctx.Done():
+			return "", false
+		}
+	}
+}
+
+// publish drains the broadcast queue onto the topic, starting once all
+// nodes subscribed to it.
+func (n *LibP2PNetwork[TMsg]) publish() {
+	for len(n.topic.ListPeers()) < n.n-1 {
+		select {
+		case <-time.After(libp2pPollInterval):
+		case <-n.ctx.Done():
+			return
+		}
+	}
+	for n.broadcast.wait(n.ctx) {
+		for {
+			frame, ok := n.broadcast.next()
+			if !ok {
+				break
+			}
+			if err := n.topic.Publish(n.ctx, frame); err != nil {
+				return // Closed
+			}
+			n.broadcast.ack(1)
+		}
+	}
+}
+
+// receiveBroadcasts delivers the messages published on the topic, this
+// node's own included.
+func (n *LibP2PNetwork[TMsg]) receiveBroadcasts(sub *pubsub.Subscription) {
+	defer sub.Cancel()
+	for {
+		msg, err := sub.Next(n.ctx)
+		if err != nil {
+			return
+		}
+		if !n.deliver(msg.Data) {
+			return
+		}
+	}
+}
+
+// peer returns the link to node id, starting its sender on first use. It
+// returns nil once the network is closed.
+func (n *LibP2PNetwork[TMsg]) peer(id int) *outbox {
+	n.mu.Lock()
+	p, ok := n.peers[id]
+	n.mu.Unlock()
+	if ok {
+		return p
+	}
+	p = newOutbox(id, "")
+	n.mu.Lock()
+	if existing, ok := n.peers[id]; ok {
+		n.mu.Unlock()
+		return existing
+	}
+	n.peers[id] = p
+	n.mu.Unlock()
+	if !n.spawn(func() { n.run(p) }) {
+		return nil
+	}
+	return p
+}
+
+// run keeps a direct stream to p open while frames are queued for it.
+func (n *LibP2PNetwork[TMsg]) run(p *outbox) {
+	pid, ok := n.peerID(p.id)
+	if !ok {
+		return
+	}
+	backoff := libp2pMinBackoff
+	for {
+		if !p.wait(n.ctx) {
+			return
+		}
+		s, err := n.host.NewStream(n.ctx, pid, libp2pDirectProtocol)
+		if err != nil {
+			if n.ctx.Err() != nil {
+				return
+			}
+			log.Debug().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Err(err).Dur("retry_in", backoff).Msg("Failed to open stream")
+			select {
+			case <-time.After(backoff):
+			case <-n.ctx.Done():
+				return
+			}
+			backoff = min(2*backoff, libp2pMaxBackoff)
+			continue
+		}
+		backoff = libp2pMinBackoff
+
+		broken := make(chan struct{})
+		go func() {
+			defer close(broken)
+			n.readAcks(p, s)
+		}()
+		n.write(p, s, broken)
+		s.Reset()
+		<-broken
+		p.rewind()
+	}
+}
+
+// write sends the queued frames of p over s until it breaks.
+func (n *LibP2PNetwork[TMsg]) write(p *outbox, s network.Stream, broken <-chan struct{}) {
+	for {
+		if frame, ok := p.next(); ok {
+			s.SetWriteDeadline(time.Now().Add(libp2pWriteTimeout))
+			if err := writeFrame(s, frame); err != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-p.wake:
+		case <-broken:
+			return
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+// readAcks drops the frames the peer acknowledged from the queue of p.
+func (n *LibP2PNetwork[TMsg]) readAcks(p *outbox, s network.Stream) {
+	var acked uint32
+	var b [4]byte
+	for {
+		if _, err := io.ReadFull(s, b[:]); err != nil {
+			return
+		}
+		total := binary.BigEndian.Uint32(b[:])
+		if !p.ack(int(total - acked)) {
+			log.Warn().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Uint32("ack", total).Msg("Invalid acknowledgement, reopening stream")
+			s.Reset()
+			return
+		}
+		acked = total
+	}
+}
+
+// handleDirect delivers the frames arriving on s and acknowledges each one.
+func (n *LibP2PNetwork[TMsg]) handleDirect(s network.Stream) {
+	defer s.Close()
+	var received uint32
+	var ack [4]byte
+	for {
+		frame, err := readFrame(s, DefaultTCPMaxFrame)
+		if err != nil {
+			return
+		}
+		if !n.deliver(frame) {
+			return
+		}
+		received++
+		binary.BigEndian.PutUint32(ack[:], received)
+		s.SetWriteDeadline(time.Now().Add(libp2pWriteTimeout))
+		if _, err := s.Write(ack[:]); err != nil {
+			return
+		}
+	}
+}
+
+// deliver decodes frame into the inbox. Frames that fail to decode are
+// dropped. It returns false once the network is closed.
+func (n *LibP2PNetwork[TMsg]) deliver(frame []byte) bool {
+	msg, err := n.codec.Unmarshal(frame)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to decode message, dropping")
+		return true
+	}
+	n.mu.Lock()
+	inbox := n.inbox
+	n.mu.Unlock()
+	if inbox == nil {
+		log.Warn().Str("layer", "NETWORK").Int("node", n.self).Msg("No inbox registered, dropping message")
+		return true
+	}
+	select {
+	case inbox <- msg:
+		return true
+	case <-n.ctx.Done():
+		return false
+	}
+}
+
+func writeNodeID(w io.Writer, id int) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(id))
+	_, err := w.Write(b[:])
+	return err
+}
+
+func readNodeID(r io.Reader) (int, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint32(b[:])), nil
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics is a set of named counters and latency histograms shared by all
+// services of one node. All methods are safe on a nil receiver, so services
+// can record metrics without checking whether a collector was configured.
+type Metrics struct {
+	counters   map[string]int64
+	histograms map[string]*Histogram
+	mu         sync.Mutex
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   make(map[string]int64),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+// Inc increments the named counter by one.
+func (m *Metrics) Inc(name string) {
+	m.Add(name, 1)
+}
+
+// Add increments the named counter by delta.
+func (m *Metrics) Add(name string, delta int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+// Set overwrites the named counter, for gauges such as set sizes.
+func (m *Metrics) Set(name string, value int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] = value
+}
+
+// Get returns the current value of the named counter.
+func (m *Metrics) Get(name string) int64 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+// Snapshot returns a copy of all counters.
+func (m *Metrics) Snapshot() map[string]int64 {
+	result := make(map[string]int64)
+	if m == nil {
+		return result
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, v := range m.counters {
+		result[name] = v
+	}
+	return result
+}
+
+// Names returns the sorted names of all counters.
+func (m *Metrics) Names() []string {
+	snapshot := m.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Observe records d in the named histogram.
+func (m *Metrics) Observe(name string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.histograms[name]
+	if !ok {
+		h = &Histogram{}
+		m.histograms[name] = h
+	}
+	h.Observe(d)
+}
+
+// Histogram returns a copy of the named histogram.
+func (m *Metrics) Histogram(name string) Histogram {
+	if m == nil {
+		return Histogram{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h, ok := m.histograms[name]; ok {
+		return h.clone()
+	}
+	return Histogram{}
+}
+
+// Histograms returns a copy of all histograms.
+func (m *Metrics) Histograms() map[string]Histogram {
+	result := make(map[string]Histogram)
+	if m == nil {
+		return result
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, h := range m.histograms {
+		result[name] = h.clone()
+	}
+	return result
+}
+
+// HistogramBounds are the upper bounds of the histogram buckets. Durations
+// above the last one fall in an extra overflow bucket.
+var HistogramBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+}
+
+// Histogram is a distribution of durations, e.g. delivery latencies.
+// Buckets[i] counts the durations up to HistogramBounds[i] that exceed the
+// previous bound, and the last bucket those above all bounds. The zero
+// value is empty and ready to use.
+type Histogram struct {
+	Count   int64
+	Sum     time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Buckets []int64 `json:",omitempty"`
+}
+
+// Observe records d.
+func (h *Histogram) Observe(d time.Duration) {
+	if h.Buckets == nil {
+		h.Buckets = make([]int64, len(HistogramBounds)+1)
+	}
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+	h.Buckets[sort.Search(len(HistogramBounds), func(i int) bool { return d <= HistogramBounds[i] })]++
+}
+
+// Mean returns the average duration, 0 for an empty histogram.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket holding the q-th quantile,
+// 0 <= q <= 1, or Max when it lies above all bounds.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int64(q * float64(h.Count))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.Buckets {
+		seen += n
+		if seen >= rank {
+			if i < len(HistogramBounds) {
+				return min(HistogramBounds[i], h.Max)
+			}
+			break
+		}
+	}
+	return h.Max
+}
+
+func (h *Histogram) clone() Histogram {
+	c := *h
+	c.Buckets = append([]int64(nil), h.Buckets...)
+	return c
+}
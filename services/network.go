@@ -1,30 +1,813 @@
 package services
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Transport carries the messages of ServiceManagers between nodes. Network
+// connects the nodes of one process, TCPNetwork nodes on different machines.
+type Transport[TMsg any] interface {
+	// Register sets the inbox receiving the messages for node id
+	Register(id int, ch chan TMsg)
+	Broadcast(msg TMsg)
+	Send(to int, msg TMsg)
+}
+
+// SourcedTransport is a Transport that tells who sends a message by the
+// inbox its node registered rather than by what the message claims, e.g. to
+// rate limit each node. ServiceManager sends through it when its transport
+// has it.
+type SourcedTransport[TMsg any] interface {
+	Transport[TMsg]
+	BroadcastFrom(inbox chan TMsg, msg TMsg)
+	SendFrom(inbox chan TMsg, to int, msg TMsg)
+}
 
 type Network[TMsg any] struct {
-	peers map[int]chan TMsg
-	mu    sync.RWMutex
+	peers   map[int][]*endpoint[TMsg] // Usually one per ID, more for twins
+	inboxes map[chan TMsg]int         // Registered inbox -> its node ID, see BroadcastFrom
+	codec   Codec[TMsg]               // Optional, messages cross an encode/decode boundary when set
+
+	// Optional frame limit of the transport; encoded messages above it are
+	// split into chunks and reassembled per endpoint
+	maxFrame int
+
+	chaos *Chaos[TMsg] // Optional fault injection for tests
+
+	latency  *linkLatency           // Optional per-link delays
+	faults   *linkFaults            // Optional per-link loss and duplication
+	topology *linkTopology          // Optional connectivity graph, complete if nil
+	senderOf func(TMsg) (int, bool) // Optional, tells the link a message takes
+	loopback bool                   // Own messages skip the network, see SetLoopback
+
+	limiter   *rateLimiter        // Optional per-sender rate limit, see SetRateLimit
+	meter     *TrafficMeter[TMsg] // Optional traffic accounting and uplink caps
+	scheduler Scheduler[TMsg]     // Optional, orders the deliveries to each endpoint
+	seq       atomic.Uint64       // Deliveries handed to the scheduler
+
+	// Optional bounded send queue per endpoint, see SetBackpressure
+	queueSize int
+	policy    BackpressurePolicy
+
+	// Optional catch-up for nodes joining late or coming back, see SetCatchUp
+	catchUp   int
+	history   []sentMsg[TMsg] // The last catchUp messages, oldest first
+	sent      uint64          // Messages recorded in history so far
+	left      map[int]uint64  // Messages sent before each node unregistered
+	historyMu sync.Mutex
+
+	mu sync.RWMutex
+}
+
+// sentMsg is a message kept for catch-up, sent to node to or broadcast if 0.
+type sentMsg[TMsg any] struct {
+	seq uint64
+	to  int
+	msg TMsg
+}
+
+// endpoint is one inbox registered under a node ID.
+type endpoint[TMsg any] struct {
+	id          int
+	ch          chan TMsg
+	reassembler *ChunkReassembler
+	queue       *scheduleQueue[TMsg] // Deliveries waiting for the scheduler
+	out         *sendQueue[TMsg]     // Optional bounded queue in front of ch
+}
+
+func newEndpoint[TMsg any](id int, ch chan TMsg) *endpoint[TMsg] {
+	return &endpoint[TMsg]{
+		id:          id,
+		ch:          ch,
+		reassembler: NewChunkReassembler(DefaultMaxPendingMessages),
+		queue:       newScheduleQueue[TMsg](),
+	}
 }
 
 func NewNetwork[TMsg any]() *Network[TMsg] {
 	return &Network[TMsg]{
-		peers: make(map[int]chan TMsg),
+		peers:    make(map[int][]*endpoint[TMsg]),
+		inboxes:  make(map[chan TMsg]int),
+		left:     make(map[int]uint64),
+		loopback: true,
+	}
+}
+
+// NewNetworkWithCodec creates a network that serializes every broadcast with
+// codec and hands each peer its own decoded copy, like a real transport would.
+func NewNetworkWithCodec[TMsg any](codec Codec[TMsg]) *Network[TMsg] {
+	n := NewNetwork[TMsg]()
+	n.codec = codec
+	return n
+}
+
+// NewNetworkWithLatency creates a network that delays every delivery by a
+// sample of model for its link, so messages arrive late and out of order as
+// on a real network. Set the sender function with SetSenderOf for models
+// with per-sender links.
+func NewNetworkWithLatency[TMsg any](model LatencyModel) *Network[TMsg] {
+	n := NewNetwork[TMsg]()
+	n.SetLatency(model)
+	return n
+}
+
+// SetBackpressure gives every node registered afterwards a send queue of
+// size messages in front of its inbox, drained by one goroutine, instead of
+// a goroutine per undelivered message. When a queue is full, policy decides
+// between waiting, dropping a message and reporting ErrQueueFull. Services
+// broadcast from OnMessage, so under Backpressure_Block nodes whose queues
+// are all full wait for each other forever: size the queues and inboxes for
+// the bursts of the protocol.
+func (n *Network[TMsg]) SetBackpressure(size int, policy BackpressurePolicy) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.queueSize = size
+	n.policy = policy
+}
+
+// QueueDrops returns how many messages the backpressure policy dropped.
+func (n *Network[TMsg]) QueueDrops() uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	var drops uint64
+	for _, ep := range n.endpoints() {
+		if ep.out != nil {
+			drops += ep.out.drops()
+		}
+	}
+	return drops
+}
+
+// SetMaxFrameSize limits encoded frames to size bytes. Only takes effect on
+// networks with a codec; 0 disables chunking.
+func (n *Network[TMsg]) SetMaxFrameSize(size int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.maxFrame = size
+}
+
+// SetChaos routes every delivery through the rules of c; nil removes them.
+func (n *Network[TMsg]) SetChaos(c *Chaos[TMsg]) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.chaos = c
+}
+
+// SetLatency delays deliveries according to model, see NewNetworkWithLatency.
+func (n *Network[TMsg]) SetLatency(model LatencyModel) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.latency = newLinkLatency(model)
+}
+
+// SetFaults drops and duplicates deliveries according to model.
+func (n *Network[TMsg]) SetFaults(model FaultModel) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.faults = newLinkFaults(model)
+}
+
+// SetLoopback chooses how a node receives its own messages. By default they
+// skip the network (chaos rules, latency, faults, the topology, the
+// scheduler and the traffic meter) and go straight into its inbox, so a
+// node hears itself without waiting for the goroutine scheduler, as over
+// TCPNetwork. Adversarial tests disable it to delay, drop or reorder them
+// too. Only messages sent with BroadcastFrom or SendFrom loop back, to the
+// node that registered the inbox, whatever sender they claim; the others
+// always take the network.
+func (n *Network[TMsg]) SetLoopback(enabled bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.loopback = enabled
+}
+
+// SetTopology lets messages only take the links of t, forwarded over
+// several hops if t says so, instead of connecting every pair of nodes.
+// Senders are found with SetSenderOf; messages of unknown senders reach
+// everyone.
+func (n *Network[TMsg]) SetTopology(t Topology) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.topology = newLinkTopology(t)
+}
+
+// Unreachable returns how many deliveries the topology lost because no
+// path led to their recipient.
+func (n *Network[TMsg]) Unreachable() uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.topology == nil {
+		return 0
+	}
+	return n.topology.unreachable.Load()
+}
+
+// SetTrafficMeter counts every delivery on m and delays them by its uplink
+// cap, if it has one; nil removes it.
+func (n *Network[TMsg]) SetTrafficMeter(m *TrafficMeter[TMsg]) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.meter = m
+}
+
+// FaultCounts returns how many deliveries the fault model dropped and
+// duplicated so far.
+func (n *Network[TMsg]) FaultCounts() (dropped, duplicated uint64) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.faults == nil {
+		return 0, 0
+	}
+	return n.faults.dropped.Load(), n.faults.duplicated.Load()
+}
+
+// SetScheduler makes s decide when each delivery reaches its inbox, on top
+// of the delays of the chaos rules and the latency model; nil restores
+// unordered delivery.
+func (n *Network[TMsg]) SetScheduler(s Scheduler[TMsg]) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.scheduler = s
+}
+
+// SetRateLimit limits how fast each node may send, so a Byzantine node
+// flooding the network cannot starve the others or pile up undelivered
+// messages. Broadcast and Send drop the messages over the limit and
+// TryBroadcast and TrySend report ErrRateLimited for them. Like TCPNetwork
+// limits each connection, a message counts against the node whose inbox
+// BroadcastFrom or SendFrom name, whatever sender it claims. Messages sent
+// without an inbox, or with one not registered, share one limit. A zero
+// limit removes it.
+func (n *Network[TMsg]) SetRateLimit(limit RateLimit) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.limiter = nil
+	if limit.Rate > 0 {
+		n.limiter = newRateLimiter(limit)
+	}
+}
+
+// RateLimited returns how many messages the rate limit rejected.
+func (n *Network[TMsg]) RateLimited() uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.limiter == nil {
+		return 0
 	}
+	return n.limiter.limited.Load()
 }
 
+// SetSenderOf sets how the network finds the sender of a message, e.g.
+// ABASender, to pick its link in the latency and fault models. Without it,
+// or when it returns false, the sender is 0 and only links from any node
+// apply.
+func (n *Network[TMsg]) SetSenderOf(senderOf func(TMsg) (int, bool)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.senderOf = senderOf
+}
+
+// FlushChaos delivers the messages the chaos rules are still holding back.
+func (n *Network[TMsg]) FlushChaos() {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.chaos == nil {
+		return
+	}
+	for id, msgs := range n.chaos.flush() {
+		for _, ep := range n.peers[id] {
+			for _, msg := range msgs {
+				go n.send(ep, msg)
+			}
+		}
+	}
+}
+
+// SetCatchUp keeps the last limit messages sent on the network, so that a
+// node registering late or again after Unregister first receives the
+// broadcasts and messages to it it missed. 0 disables catch-up.
+func (n *Network[TMsg]) SetCatchUp(limit int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.historyMu.Lock()
+	defer n.historyMu.Unlock()
+	n.catchUp = limit
+	if len(n.history) > limit {
+		n.history = append([]sentMsg[TMsg](nil), n.history[len(n.history)-limit:]...)
+	}
+}
+
+// Register sets the inbox of node id, replacing any registered before. A
+// node that was not registered catches up on the messages it missed if
+// SetCatchUp is enabled.
 func (n *Network[TMsg]) Register(id int, ch chan TMsg) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	n.peers[id] = ch
+	old, present := n.peers[id]
+	for _, ep := range old {
+		delete(n.inboxes, ep.ch)
+	}
+	ep := n.newEndpoint(id, ch)
+	n.peers[id] = []*endpoint[TMsg]{ep}
+	n.inboxes[ch] = id
+	if !present && n.catchUp > 0 {
+		n.replay(ep)
+	}
+}
+
+// Unregister removes node id and its twins, e.g. when it crashes or leaves.
+// Messages to it are dropped, or kept for its catch-up with SetCatchUp.
+func (n *Network[TMsg]) Unregister(id int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	eps, ok := n.peers[id]
+	if !ok {
+		return
+	}
+	for _, ep := range eps {
+		delete(n.inboxes, ep.ch)
+	}
+	delete(n.peers, id)
+	n.historyMu.Lock()
+	defer n.historyMu.Unlock()
+	n.left[id] = n.sent
+}
+
+// record keeps msg for catch-up. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) record(to int, msg TMsg) {
+	if n.catchUp <= 0 {
+		return
+	}
+	n.historyMu.Lock()
+	defer n.historyMu.Unlock()
+	n.sent++
+	n.history = append(n.history, sentMsg[TMsg]{seq: n.sent, to: to, msg: msg})
+	if len(n.history) > n.catchUp {
+		n.history[0] = sentMsg[TMsg]{}
+		n.history = n.history[1:]
+	}
+}
+
+// replay sends ep the messages for it recorded since its node unregistered,
+// or all of them if it never was registered. Assumes n.mu is locked.
+func (n *Network[TMsg]) replay(ep *endpoint[TMsg]) {
+	n.historyMu.Lock()
+	defer n.historyMu.Unlock()
+	since := n.left[ep.id]
+	delete(n.left, ep.id)
+	var missed []TMsg
+	for i, m := range n.history {
+		if i == 0 && m.seq > since+1 {
+			log.Warn().Str("layer", "NETWORK").Int("node", ep.id).Uint64("evicted", m.seq-since-1).Msg("Catch-up history too short, node may have missed messages")
+		}
+		if m.seq > since && (m.to == 0 || m.to == ep.id) {
+			missed = append(missed, m.msg)
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+	go func() {
+		for _, msg := range missed {
+			n.send(ep, msg)
+		}
+	}()
+}
+
+// RegisterTwin adds a second inbox under an already used ID. Both twins
+// receive every broadcast and nothing distinguishes their messages, which
+// simulates a Byzantine node equivocating at the identity level.
+func (n *Network[TMsg]) RegisterTwin(id int, ch chan TMsg) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.peers[id] = append(n.peers[id], n.newEndpoint(id, ch))
+	n.inboxes[ch] = id
+}
+
+// newEndpoint creates an endpoint with a send queue if backpressure is set.
+// Assumes n.mu is locked.
+func (n *Network[TMsg]) newEndpoint(id int, ch chan TMsg) *endpoint[TMsg] {
+	ep := newEndpoint(id, ch)
+	if n.queueSize > 0 {
+		ep.out = newSendQueue[TMsg](n.queueSize, n.policy)
+	}
+	return ep
+}
+
+// endpoints returns every registered inbox. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) endpoints() []*endpoint[TMsg] {
+	var all []*endpoint[TMsg]
+	for _, eps := range n.peers {
+		all = append(all, eps...)
+	}
+	return all
 }
 
 func (n *Network[TMsg]) Broadcast(msg TMsg) {
+	n.BroadcastFrom(nil, msg)
+}
+
+// BroadcastFrom is Broadcast by the node that registered inbox, see
+// SetRateLimit.
+func (n *Network[TMsg]) BroadcastFrom(inbox chan TMsg, msg TMsg) {
+	if err := n.TryBroadcastFrom(inbox, msg); errors.Is(err, ErrRateLimited) {
+		log.Debug().Str("layer", "NETWORK").Err(err).Msg("Broadcast dropped")
+	} else if err != nil {
+		log.Warn().Str("layer", "NETWORK").Err(err).Msg("Broadcast not delivered to every node")
+	}
+}
+
+// Send delivers msg only to node to (and its twins, if any), for messages
+// other peers must not see. Messages to unregistered IDs are dropped, unless
+// they are kept for catch-up.
+func (n *Network[TMsg]) Send(to int, msg TMsg) {
+	n.SendFrom(nil, to, msg)
+}
+
+// SendFrom is Send by the node that registered inbox, see SetRateLimit.
+func (n *Network[TMsg]) SendFrom(inbox chan TMsg, to int, msg TMsg) {
+	if err := n.TrySendFrom(inbox, to, msg); errors.Is(err, ErrRateLimited) {
+		log.Debug().Str("layer", "NETWORK").Int("to", to).Err(err).Msg("Message dropped")
+	} else if err != nil {
+		log.Warn().Str("layer", "NETWORK").Int("to", to).Err(err).Msg("Message not delivered")
+	}
+}
+
+// TryBroadcast is Broadcast, but returns ErrRateLimited if the sender is
+// over its rate limit and ErrQueueFull for the nodes whose send queue
+// rejected msg under Backpressure_Error. Delayed deliveries (chaos rules,
+// latency, schedulers) are queued later and only logged.
+func (n *Network[TMsg]) TryBroadcast(msg TMsg) error {
+	return n.TryBroadcastFrom(nil, msg)
+}
+
+// TryBroadcastFrom is TryBroadcast by the node that registered inbox.
+func (n *Network[TMsg]) TryBroadcastFrom(inbox chan TMsg, msg TMsg) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if err := n.limit(inbox); err != nil {
+		return err
+	}
+	n.record(0, msg)
+	return n.deliver(n.inboxes[inbox], n.endpoints(), msg)
+}
+
+// TrySend is Send, reporting the rate limit and a full send queue like
+// TryBroadcast.
+func (n *Network[TMsg]) TrySend(to int, msg TMsg) error {
+	return n.TrySendFrom(nil, to, msg)
+}
+
+// TrySendFrom is TrySend by the node that registered inbox.
+func (n *Network[TMsg]) TrySendFrom(inbox chan TMsg, to int, msg TMsg) error {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
-	for _, ch := range n.peers {
+	if err := n.limit(inbox); err != nil {
+		return err
+	}
+	n.record(to, msg)
+	return n.deliver(n.inboxes[inbox], n.peers[to], msg)
+}
+
+// limit returns ErrRateLimited if the node that registered inbox is over
+// its rate limit. Senders without a registered inbox share the limit of
+// node 0. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) limit(inbox chan TMsg) error {
+	if n.limiter == nil {
+		return nil
+	}
+	from := n.inboxes[inbox]
+	if n.limiter.allow(from) {
+		return nil
+	}
+	if from == 0 {
+		return fmt.Errorf("unregistered sender: %w", ErrRateLimited)
+	}
+	return fmt.Errorf("node %d: %w", from, ErrRateLimited)
+}
+
+// deliver hands msg of node from, 0 if unregistered, to every endpoint in
+// eps. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) deliver(from int, eps []*endpoint[TMsg], msg TMsg) error {
+	var errs []error
+	if n.loopback {
+		eps, errs = n.deliverLocal(from, eps, msg)
+	}
+	if n.topology != nil {
+		eps = n.reachable(eps, msg)
+	}
+	if n.faults != nil {
+		eps = n.applyFaults(eps, msg)
+	}
+
+	var held []time.Duration // By the uplink cap, nil without one
+	if n.meter != nil {
+		to := make([]int, len(eps))
+		for i, ep := range eps {
+			to[i] = ep.id
+		}
+		held = n.meter.record(to, msg)
+	}
+
+	if n.scheduler != nil {
+		n.deliverScheduled(eps, msg, held)
+		return errors.Join(errs...)
+	}
+
+	if n.chaos != nil {
+		n.deliverChaos(eps, msg, held)
+		return errors.Join(errs...)
+	}
+
+	if n.latency != nil || held != nil {
+		n.deliverDelayed(eps, msg, held)
+		return errors.Join(errs...)
+	}
+
+	if n.codec != nil {
+		return errors.Join(append(errs, n.deliverEncoded(eps, msg))...)
+	}
+
+	for _, ep := range eps {
+		if ep.out != nil {
+			errs = append(errs, n.put(ep, msg))
+			continue
+		}
 		go func(c chan TMsg) {
 			c <- msg
-		}(ch)
+		}(ep.ch)
+	}
+	return errors.Join(errs...)
+}
+
+// deliverLocal hands msg to the endpoints of node from and returns the
+// others. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) deliverLocal(from int, eps []*endpoint[TMsg], msg TMsg) ([]*endpoint[TMsg], []error) {
+	if from == 0 {
+		return eps, nil
+	}
+	var errs []error
+	others := make([]*endpoint[TMsg], 0, len(eps))
+	for _, ep := range eps {
+		if ep.id != from {
+			others = append(others, ep)
+			continue
+		}
+		if err := n.putLocal(ep, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return others, errs
+}
+
+// putLocal hands a node its own msg, right away if its inbox has room. With
+// a codec the node gets a decoded copy, like its peers.
+func (n *Network[TMsg]) putLocal(ep *endpoint[TMsg], msg TMsg) error {
+	if n.codec != nil {
+		data, err := n.codec.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("node %d: encoding own message: %w", ep.id, err)
+		}
+		if msg, err = n.codec.Unmarshal(data); err != nil {
+			return fmt.Errorf("node %d: decoding own message: %w", ep.id, err)
+		}
+	}
+	if ep.out != nil {
+		return n.put(ep, msg)
+	}
+	select {
+	case ep.ch <- msg:
+	default:
+		go func() { ep.ch <- msg }()
+	}
+	return nil
+}
+
+// put hands msg to the inbox of ep, through its send queue if it has one.
+func (n *Network[TMsg]) put(ep *endpoint[TMsg], msg TMsg) error {
+	if ep.out == nil {
+		ep.ch <- msg
+		return nil
+	}
+	if err := ep.out.push(msg, ep.ch); err != nil {
+		return fmt.Errorf("node %d: %w", ep.id, err)
+	}
+	return nil
+}
+
+// reachable returns the endpoints of eps the topology has a path to from
+// the sender of msg. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) reachable(eps []*endpoint[TMsg], msg TMsg) []*endpoint[TMsg] {
+	from := n.sender(msg)
+	out := make([]*endpoint[TMsg], 0, len(eps))
+	for _, ep := range eps {
+		if n.topology.path(from, ep.id) == nil {
+			n.topology.unreachable.Add(1)
+			continue
+		}
+		out = append(out, ep)
+	}
+	return out
+}
+
+// applyFaults returns eps without the endpoints the fault model drops msg
+// for, and twice those it duplicates msg for. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) applyFaults(eps []*endpoint[TMsg], msg TMsg) []*endpoint[TMsg] {
+	from := n.sender(msg)
+	out := make([]*endpoint[TMsg], 0, len(eps))
+	for _, ep := range eps {
+		for i := n.faults.copies(from, ep.id); i > 0; i-- {
+			out = append(out, ep)
+		}
+	}
+	return out
+}
+
+// deliverScheduled queues msg for each endpoint, as planned by the chaos
+// rules if there are any, to be handed over when the scheduler, the link
+// latency and the uplink cap allow. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) deliverScheduled(eps []*endpoint[TMsg], msg TMsg, held []time.Duration) {
+	from := n.sender(msg)
+	now := time.Now()
+	for i, ep := range eps {
+		planned := []chaosDelivery[TMsg]{{msg: msg}}
+		if n.chaos != nil {
+			planned = n.chaos.plan(msg, ep.id)
+		}
+		for _, d := range planned {
+			seq := n.seq.Add(1)
+			delay := d.delay + heldFor(held, i) + n.linkDelay(from, ep.id) + n.scheduler.Schedule(Delivery[TMsg]{Msg: d.msg, From: from, To: ep.id, Seq: seq})
+			ep.queue.push(scheduled[TMsg]{msg: d.msg, ready: now.Add(delay), seq: seq}, func(m TMsg) {
+				n.send(ep, m)
+			})
+		}
+	}
+}
+
+// deliverDelayed delivers msg to each endpoint after the latency of its
+// link and the time held by the uplink cap. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) deliverDelayed(eps []*endpoint[TMsg], msg TMsg, held []time.Duration) {
+	from := n.sender(msg)
+	for i, ep := range eps {
+		go func(ep *endpoint[TMsg], delay time.Duration) {
+			time.Sleep(delay)
+			n.send(ep, msg)
+		}(ep, heldFor(held, i)+n.linkDelay(from, ep.id))
+	}
+}
+
+// heldFor returns how long the uplink cap holds back delivery i.
+func heldFor(held []time.Duration, i int) time.Duration {
+	if held == nil {
+		return 0
+	}
+	return held[i]
+}
+
+// sender returns the sender of msg, or 0 if unknown. Assumes n.mu is
+// read-locked.
+func (n *Network[TMsg]) sender(msg TMsg) int {
+	if n.senderOf == nil {
+		return 0
+	}
+	if from, ok := n.senderOf(msg); ok {
+		return from
+	}
+	return 0
+}
+
+// linkDelay samples the latency from -> to, 0 without a latency model. On
+// a forwarding topology it adds up the latencies of every hop. Assumes n.mu
+// is read-locked.
+func (n *Network[TMsg]) linkDelay(from, to int) time.Duration {
+	if n.latency == nil {
+		return 0
+	}
+	if n.topology == nil {
+		return n.latency.sample(from, to)
+	}
+	var delay time.Duration
+	for _, hop := range n.topology.path(from, to) {
+		delay += n.latency.sample(from, hop)
+		from = hop
+	}
+	return delay
+}
+
+// deliverChaos delivers msg as planned by the chaos rules for each endpoint,
+// adding the link latency and the uplink cap if there are any. Undelayed
+// deliveries to a peer are sent in order by one goroutine, so held messages
+// really arrive after the ones that overtook them. Assumes n.mu is
+// read-locked.
+func (n *Network[TMsg]) deliverChaos(eps []*endpoint[TMsg], msg TMsg, held []time.Duration) {
+	from := n.sender(msg)
+	for i, ep := range eps {
+		var inOrder []TMsg
+		for _, d := range n.chaos.plan(msg, ep.id) {
+			if delay := d.delay + heldFor(held, i) + n.linkDelay(from, ep.id); delay > 0 {
+				go func(ep *endpoint[TMsg], m TMsg, delay time.Duration) {
+					time.Sleep(delay)
+					n.send(ep, m)
+				}(ep, d.msg, delay)
+				continue
+			}
+			inOrder = append(inOrder, d.msg)
+		}
+		if len(inOrder) == 0 {
+			continue
+		}
+		go func(ep *endpoint[TMsg], msgs []TMsg) {
+			for _, m := range msgs {
+				n.send(ep, m)
+			}
+		}(ep, inOrder)
+	}
+}
+
+// send delivers msg to one endpoint, through the codec if there is one. Does
+// not need n.mu, so it may run after the delivery returned.
+func (n *Network[TMsg]) send(ep *endpoint[TMsg], msg TMsg) {
+	var err error
+	if n.codec == nil {
+		err = n.put(ep, msg)
+	} else if frames, ok := n.encodeFrames(msg); ok {
+		err = n.deliverFrames(ep, frames)
+	}
+	if err != nil {
+		log.Warn().Str("layer", "NETWORK").Err(err).Msg("Message not delivered")
+	}
+}
+
+// deliverEncoded sends msg through the codec. Endpoints with a send queue
+// decode their copy right away. Assumes n.mu is read-locked.
+func (n *Network[TMsg]) deliverEncoded(eps []*endpoint[TMsg], msg TMsg) error {
+	if len(eps) == 0 {
+		return nil
+	}
+	frames, ok := n.encodeFrames(msg)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, ep := range eps {
+		if ep.out != nil {
+			errs = append(errs, n.deliverFrames(ep, frames))
+			continue
+		}
+		go n.deliverFrames(ep, frames)
+	}
+	return errors.Join(errs...)
+}
+
+// encodeFrames encodes msg and splits it into frames if a frame limit is set.
+func (n *Network[TMsg]) encodeFrames(msg TMsg) ([][]byte, bool) {
+	data, err := n.codec.Marshal(msg)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to encode message, dropping")
+		return nil, false
+	}
+
+	frames := [][]byte{data}
+	if n.maxFrame > 0 {
+		frames, err = SplitFrames(data, n.maxFrame)
+		if err != nil {
+			log.Error().Str("layer", "NETWORK").Err(err).Msg("Failed to split message, dropping")
+			return nil, false
+		}
+	}
+	return frames, true
+}
+
+// deliverFrames reassembles and decodes frames on the receiving side and
+// hands the message to ep.
+func (n *Network[TMsg]) deliverFrames(ep *endpoint[TMsg], frames [][]byte) error {
+	for _, frame := range frames {
+		data := frame
+		if n.maxFrame > 0 {
+			complete, done, err := ep.reassembler.Add(frame)
+			if err != nil {
+				log.Error().Str("layer", "NETWORK").Err(err).Msg("Dropping invalid chunk")
+				return nil
+			}
+			if !done {
+				continue
+			}
+			data = complete
+		}
+		decoded, err := n.codec.Unmarshal(data)
+		if err != nil {
+			log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to decode message, dropping")
+			return nil
+		}
+		if err := n.put(ep, decoded); err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// NodeContext holds the per-node state shared by every service running on
+// that node. Services built from the same NodeContext share one
+// CertificationProtocol, so faulty pairs detected by IVSS inside ICC are
+// visible to Vote, A-Cast and later rounds of the same node.
+type NodeContext struct {
+	ID       int
+	N        int
+	T        int
+	CP       *CertificationProtocol
+	Metrics  *Metrics
+	Events   *EventBus
+	LogLevel zerolog.Level
+
+	// Optional, receives the abstract state transitions of every service
+	// created from this context afterwards
+	Transitions TransitionHook
+
+	// Optional, receives the equivocations detected by every A-Cast
+	// service created from this context afterwards
+	Equivocations EquivocationHook
+
+	// How A-Cast counts repeated messages from one sender ID
+	Dedup DedupPolicy
+
+	// Whether A-Cast ECHO and READY carry a SHA-256 digest of the value
+	// instead of the value, see AcastService
+	ACastDigests bool
+
+	// How many ECHOs and READYs A-Cast waits for, ByzantineThresholds when
+	// nil
+	ACastThresholds ACastThresholds
+
+	// Bounds the A-Cast instances each service keeps, see ACastRetention
+	ACastRetention ACastRetention
+
+	// Repeats A-Cast messages until delivery over transports that may drop
+	// them, see ACastRetransmit
+	ACastRetransmit ACastRetransmit
+
+	// When positive, IVSS collects the EQUAL and READY payloads it A-Casts
+	// within this window and starts one A-Cast instance for all of them.
+	// Batches are flushed by a timer, so leave it 0 in simulations.
+	ACastBatchWindow time.Duration
+
+	// Whether IVSS dealers A-Cast a Feldman commitment to their polynomial
+	// and nodes check their share against it before using it. All nodes of
+	// a cluster must agree on it.
+	IVSSCommitments bool
+
+	// Whether this node deals dual-threshold sharings: a bivariate
+	// polynomial of degree t in x and 2t in y, so that the shares F(0, k)
+	// of the secret have degree 2t, see IVSSService.StartSharing. Nodes
+	// take part in the sharings of both kinds either way. Commitments and
+	// batches do not cover them.
+	IVSSDualThreshold bool
+
+	// Whether ICC shares the n secrets of each dealer in one IVSS batch
+	// instead of n sharings, see IVSSService.StartBatchSharing. All nodes
+	// of a cluster must agree on it.
+	ICCBatchSharing bool
+
+	// Whether the ICC coins of ABA fill each slot j of this node's dealing
+	// with a spare sharing of an earlier round when there is one, instead of
+	// a fresh secret: a sharing of this node that a delivered T_j left out,
+	// so no correct node reconstructs it. Dealers A-Cast the sharings of
+	// their slots, and T sets and these deals are tagged A-Casts, so every
+	// node agrees on both. Sharings are reused from ABACoinRetention rounds
+	// back at most. It does not apply with ICCBatchSharing. All nodes of a
+	// cluster must agree on it.
+	ICCReuseDealings bool
+
+	// Parameters of the common coin, the paper's when zero, see ICCConfig.
+	// Invalid parameters are reported and replaced by the defaults. All
+	// nodes of a cluster must agree on them.
+	ICC ICCConfig
+
+	// Optional, receives the audit of every ICC coin of the services
+	// created from this context afterwards, see CoinAudit
+	CoinAudits CoinAuditHook
+
+	// The coin ABA flips, nil for ICC. The pipelining and retention of
+	// coins only apply to ICC
+	Coin CommonCoin
+
+	// How many rounds ahead ABA prepares its coins: the ICC instances of
+	// the next ABAPipelineDepth rounds deal and complete their sharings
+	// while the current round votes, but reconstruct only once their round
+	// starts, see ICCService.Prepare. 0 starts each coin with its round
+	ABAPipelineDepth int
+
+	// How many finished rounds ABA keeps the coins of, so peers lagging
+	// behind can still complete them with this node's help. Older coins are
+	// closed and dropped, see ICCService.Close. 0 keeps every coin
+	ABACoinRetention int
+
+	// Bounds the IVSS instances each service keeps, see IVSSRetention
+	IVSSRetention IVSSRetention
+
+	// Optional, keeps the IVSS instances the retention evicts so their
+	// reconstruction can still be served
+	IVSSArchive IVSSArchive
+
+	// Optional PKI: the key of this node and the public keys of all nodes.
+	// A-Cast needs both to take part in signed instances, see
+	// NewSignedACastMessage
+	SigningKey ed25519.PrivateKey
+	Keyring    *Keyring
+
+	// Optional: the X25519 key of this node and the share keys of all
+	// nodes. With both, IVSS encrypts every share and point for its
+	// recipient and rejects those that are not, see ShareKeyring. All nodes
+	// of a cluster must agree on it.
+	ShareKey  *ecdh.PrivateKey
+	ShareKeys *ShareKeyring
+
+	// When positive, IVSS reports sharings that made no progress (no share,
+	// new EQUAL or M-Set) for this long as STALLED results carrying the
+	// state of the instance, see IVSSInstanceState. Timers run on the wall
+	// clock, so leave it 0 in simulations.
+	IVSSWatchdog time.Duration
+
+	// How many goroutines a dealer computes the shares of a sharing with,
+	// see utils.SymmetricPolynomial.Rows. 0 uses GOMAXPROCS, 1 computes
+	// them in the goroutine that starts the sharing.
+	IVSSDealerWorkers int
+
+	// Field of the secret of each IVSS instance, e.g. utils.BLS12381Scalar
+	// for sharing BLS keys; nil, or a nil result, is utils.DefaultField.
+	// Every node of a cluster must map an instance to the same field.
+	// Commitments only cover instances of the default field.
+	IVSSField func(instanceID string) *utils.Field
+
+	// Whether nodes other than the dealer propose the M-Set of a sharing
+	// once they see n-t nodes with pairwise EQUALs, so the sharing
+	// completes even if the dealer crashes after dealing. Proposals are
+	// verified like the dealer's M-Set. Every node of a cluster must use
+	// the same setting, see IVSSService.onProposedMSet for the caveats.
+	IVSSAssistMSet bool
+
+	// Optional source of the secrets, polynomial coefficients and A-Cast
+	// nonces the node draws. When nil they come from crypto/rand and the
+	// clock; a seeded reader makes runs reproducible.
+	Rand io.Reader
+}
+
+// NewNodeContext creates a NodeContext with a fresh CertificationProtocol, Metrics and EventBus.
+func NewNodeContext(id, n, t int, logLevel zerolog.Level) *NodeContext {
+	cp := NewCertificationProtocol()
+	metrics := NewMetrics()
+	cp.AttachMetrics(metrics)
+
+	return &NodeContext{
+		ID:       id,
+		N:        n,
+		T:        t,
+		CP:       cp,
+		Metrics:  metrics,
+		Events:   NewEventBus(),
+		LogLevel: logLevel,
+	}
+}
+
+// newNodeContextFor wraps the arguments of the legacy constructors.
+func newNodeContextFor(id, n, t int, cp *CertificationProtocol, logLevel zerolog.Level) *NodeContext {
+	return &NodeContext{
+		ID:       id,
+		N:        n,
+		T:        t,
+		CP:       cp,
+		LogLevel: logLevel,
+	}
+}
+
+// random returns the randomness source of the node.
+func (nc *NodeContext) random() io.Reader {
+	if nc.Rand != nil {
+		return nc.Rand
+	}
+	return rand.Reader
+}
+
+// nonce returns a nonce for a new A-Cast instance started by the node.
+func (nc *NodeContext) nonce() int64 {
+	if nc.Rand == nil {
+		return time.Now().UnixNano()
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(nc.Rand, b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.BigEndian.Uint64(b[:]) >> 1)
+}
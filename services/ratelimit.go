@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRateLimited is returned by Network.TryBroadcast and TrySend when the
+// sender of a message exceeded its rate limit.
+var ErrRateLimited = errors.New("sender rate limited")
+
+// RateLimit is a token bucket: a sender may send Burst messages at once and
+// Rate messages per second on average. A Rate of 0 disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int // At least 1
+}
+
+func (l RateLimit) burst() float64 {
+	return float64(max(l.Burst, 1))
+}
+
+// tokenBucket is the rate limit state of one sender.
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: limit.burst(), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.limit.burst(), b.tokens+b.limit.Rate*now.Sub(b.last).Seconds())
+	b.last = now
+}
+
+// allow takes a token if there is one.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// take takes a token, going into debt if there is none, and returns how
+// long the caller has to wait for it.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// rateLimiter keeps a token bucket per sender.
+type rateLimiter struct {
+	limit   RateLimit
+	buckets map[int]*tokenBucket
+	limited atomic.Uint64 // Messages rejected so far
+	mu      sync.Mutex
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{limit: limit, buckets: make(map[int]*tokenBucket)}
+}
+
+// allow reports whether sender from may send one more message, counting it
+// as rejected otherwise.
+func (r *rateLimiter) allow(from int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	b, ok := r.buckets[from]
+	if !ok {
+		b = newTokenBucket(r.limit, now)
+		r.buckets[from] = b
+	}
+	if b.allow(now) {
+		return true
+	}
+	r.limited.Add(1)
+	return false
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WALEntry is one input of a node, in the order the node processed it: a
+// message from the network, a named local call (e.g. starting ABA), or bytes
+// the node drew from its randomness source.
+type WALEntry[TMsg any] struct {
+	Msg  *TMsg  `json:",omitempty"`
+	Call string `json:",omitempty"`
+	Rand []byte `json:",omitempty"`
+}
+
+// WAL is the write-ahead log of a RecoverableNode. Every service is a
+// deterministic function of its inputs, so replaying the log into a fresh
+// service rebuilds the state the node had when it crashed.
+type WAL[TMsg any] interface {
+	Append(entry WALEntry[TMsg]) error
+	Entries() ([]WALEntry[TMsg], error)
+}
+
+// MemoryWAL keeps the log in memory.
+// Useful for tests and for restarting services inside one process.
+type MemoryWAL[TMsg any] struct {
+	entries []WALEntry[TMsg]
+	mu      sync.Mutex
+}
+
+func NewMemoryWAL[TMsg any]() *MemoryWAL[TMsg] {
+	return &MemoryWAL[TMsg]{}
+}
+
+func (m *MemoryWAL[TMsg]) Append(entry WALEntry[TMsg]) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *MemoryWAL[TMsg]) Entries() ([]WALEntry[TMsg], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]WALEntry[TMsg](nil), m.entries...), nil
+}
+
+// FileWAL appends the log to a file, one JSON entry per line with messages
+// encoded by codec.
+type FileWAL[TMsg any] struct {
+	path  string
+	codec Codec[TMsg]
+	mu    sync.Mutex
+}
+
+type fileWALEntry struct {
+	Msg  []byte `json:",omitempty"`
+	Call string `json:",omitempty"`
+	Rand []byte `json:",omitempty"`
+}
+
+func NewFileWAL[TMsg any](path string, codec Codec[TMsg]) *FileWAL[TMsg] {
+	return &FileWAL[TMsg]{path: path, codec: codec}
+}
+
+func (f *FileWAL[TMsg]) Append(entry WALEntry[TMsg]) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line := fileWALEntry{Call: entry.Call, Rand: entry.Rand}
+	if entry.Msg != nil {
+		b, err := f.codec.Marshal(*entry.Msg)
+		if err != nil {
+			return err
+		}
+		line.Msg = b
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	// The entry must be on disk before the node acts on it
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Entries returns an empty log if the file does not exist yet. A truncated
+// last line, left by a crash during Append, is ignored: the node never acted
+// on that entry.
+func (f *FileWAL[TMsg]) Entries() ([]WALEntry[TMsg], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []WALEntry[TMsg]
+	r := bufio.NewReader(file)
+	for {
+		b, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var line fileWALEntry
+		if err := json.Unmarshal(b, &line); err != nil {
+			return nil, fmt.Errorf("wal entry %d: %w", len(entries), err)
+		}
+		entry := WALEntry[TMsg]{Call: line.Call, Rand: line.Rand}
+		if line.Msg != nil {
+			msg, err := f.codec.Unmarshal(line.Msg)
+			if err != nil {
+				return nil, fmt.Errorf("wal entry %d: %w", len(entries), err)
+			}
+			entry.Msg = &msg
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// RecoverableNode runs a service behind a WAL so the node survives a crash.
+// Messages and local calls are logged before they are processed, and the
+// randomness the service draws is logged as it is drawn. Recover replays the
+// log of a crashed node into a fresh service: the replayed service draws the
+// logged randomness again, so it deals the same secrets, picks the same
+// A-Cast nonces and sends the same messages as before the crash, which the
+// other nodes treat as harmless duplicates.
+//
+// Local calls are replayed by name, so every call made through Call must be
+// registered with Handle before Recover.
+type RecoverableNode[S Service[TMsg, TRes], TMsg any, TRes any] struct {
+	service  S
+	wal      WAL[TMsg]
+	rand     *walRandom[TMsg]
+	handlers map[string]func(S, ServiceContext[TMsg, TRes])
+	mu       sync.Mutex
+}
+
+// NewRecoverableNode creates the service with newService(nc), logging to
+// wal. It sets nc.Rand to a source that logs every draw from the previous
+// nc.Rand (crypto/rand when nil).
+func NewRecoverableNode[S Service[TMsg, TRes], TMsg any, TRes any](nc *NodeContext, wal WAL[TMsg], newService func(nc *NodeContext) S) *RecoverableNode[S, TMsg, TRes] {
+	r := &walRandom[TMsg]{source: nc.random(), wal: wal}
+	nc.Rand = r
+	return &RecoverableNode[S, TMsg, TRes]{
+		service:  newService(nc),
+		wal:      wal,
+		rand:     r,
+		handlers: make(map[string]func(S, ServiceContext[TMsg, TRes])),
+	}
+}
+
+// Service returns the wrapped service.
+func (r *RecoverableNode[S, TMsg, TRes]) Service() S {
+	return r.service
+}
+
+// Handle registers fn as the local call name.
+func (r *RecoverableNode[S, TMsg, TRes]) Handle(name string, fn func(S, ServiceContext[TMsg, TRes])) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[name] = fn
+}
+
+// Call logs and runs the local call name, which must have been registered.
+func (r *RecoverableNode[S, TMsg, TRes]) Call(name string, ctx ServiceContext[TMsg, TRes]) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn, ok := r.handlers[name]
+	if !ok {
+		return fmt.Errorf("no handler for call %q", name)
+	}
+	if err := r.wal.Append(WALEntry[TMsg]{Call: name}); err != nil {
+		return err
+	}
+	fn(r.service, ctx)
+	return nil
+}
+
+// OnMessage logs msg before processing it. A message that cannot be logged
+// is not processed, as if it never arrived.
+func (r *RecoverableNode[S, TMsg, TRes]) OnMessage(msg TMsg, ctx ServiceContext[TMsg, TRes]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.wal.Append(WALEntry[TMsg]{Msg: &msg}); err != nil {
+		return
+	}
+	r.service.OnMessage(msg, ctx)
+}
+
+// Recover replays the log into the service. It must run before the node
+// processes anything else. Messages sent during the replay go out through
+// ctx again and results are passed to it again.
+func (r *RecoverableNode[S, TMsg, TRes]) Recover(ctx ServiceContext[TMsg, TRes]) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := r.wal.Entries()
+	if err != nil {
+		return err
+	}
+	var inputs []WALEntry[TMsg]
+	for _, e := range entries {
+		if e.Rand != nil {
+			r.rand.logged = append(r.rand.logged, e.Rand...)
+			continue
+		}
+		inputs = append(inputs, e)
+	}
+	for i, e := range inputs {
+		if e.Msg != nil {
+			r.service.OnMessage(*e.Msg, ctx)
+			continue
+		}
+		fn, ok := r.handlers[e.Call]
+		if !ok {
+			return fmt.Errorf("wal input %d: no handler for call %q", i, e.Call)
+		}
+		fn(r.service, ctx)
+	}
+	if len(r.rand.logged) > 0 {
+		return fmt.Errorf("replay drew %d bytes of logged randomness too few, the service is not deterministic", len(r.rand.logged))
+	}
+	return nil
+}
+
+// walRandom serves logged randomness during a replay and logs fresh
+// randomness afterwards.
+type walRandom[TMsg any] struct {
+	source io.Reader
+	wal    WAL[TMsg]
+	logged []byte
+	mu     sync.Mutex
+}
+
+func (w *walRandom[TMsg]) Read(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.logged) > 0 {
+		n := copy(p, w.logged)
+		w.logged = w.logged[n:]
+		return n, nil
+	}
+	n, err := w.source.Read(p)
+	if n > 0 {
+		if werr := w.wal.Append(WALEntry[TMsg]{Rand: append([]byte(nil), p[:n]...)}); werr != nil {
+			return 0, werr
+		}
+	}
+	return n, err
+}
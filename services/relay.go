@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Relay link frame layout (big-endian), each sent as a length-prefixed frame
+// like those of TCPNetwork:
+//
+//	hello: kind(1) | node ID(4)       first frame of a node, naming itself
+//	data:  kind(1) | peer(4) | body   peer is the recipient towards the relay,
+//	                                  the sender from the relay
+//	ack:   kind(1) | count(4)         data frames received on the link so far
+const (
+	relayHello byte = 1
+	relayData  byte = 2
+	relayAck   byte = 3
+)
+
+// Relay forwards messages between nodes that cannot reach each other
+// directly, e.g. because they are behind NAT: every node keeps one outgoing
+// connection to the relay, see RelayClient. Frames are queued per recipient
+// until it acknowledges them, so messages to a node that is not connected
+// wait for it.
+//
+// The relay is not trusted. It learns who talks to whom and may drop or
+// delay messages, and it cannot verify the IDs nodes connect with, so nodes
+// must sign their messages with an AuthenticatedTransport on top of the
+// RelayClient; a forged or altered message then fails verification.
+type Relay struct {
+	maxFrame int
+
+	listener net.Listener
+	nodes    map[int]*relayNode
+	conns    map[net.Conn]struct{}
+
+	ctx    context.Context // Canceled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// relayNode is the queue of one node and its current connection.
+type relayNode struct {
+	out  *outbox
+	conn net.Conn
+	done chan struct{} // Closed when conn is no longer served
+}
+
+// NewRelay creates a relay for nodes 1..n.
+func NewRelay(n int) *Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Relay{
+		maxFrame: DefaultTCPMaxFrame,
+		nodes:    make(map[int]*relayNode, n),
+		conns:    make(map[net.Conn]struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for id := 1; id <= n; id++ {
+		r.nodes[id] = &relayNode{out: newOutbox(id, "")}
+	}
+	return r
+}
+
+// Listen accepts nodes on addr.
+func (r *Relay) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	r.Serve(l)
+	return nil
+}
+
+// Serve accepts nodes on l.
+func (r *Relay) Serve(l net.Listener) {
+	r.mu.Lock()
+	r.listener = l
+	r.mu.Unlock()
+
+	r.spawn(func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return // Closed
+			}
+			if !r.track(conn) {
+				conn.Close()
+				return
+			}
+			r.spawn(func() { r.handle(conn) })
+		}
+	})
+}
+
+// Close stops the relay and drops the queued messages.
+func (r *Relay) Close() error {
+	r.cancel()
+	r.mu.Lock()
+	var err error
+	if r.listener != nil {
+		err = r.listener.Close()
+	}
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+// handle serves the connection of one node. A new connection of a node
+// replaces the old one, as after the NAT mapping of the node changed.
+func (r *Relay) handle(conn net.Conn) {
+	defer r.untrack(conn)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(tcpDialTimeout))
+	frame, err := readFrame(conn, relayHeaderSize)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || len(frame) != relayHeaderSize || frame[0] != relayHello {
+		log.Debug().Str("layer", "RELAY").Str("remote", conn.RemoteAddr().String()).Err(err).Msg("Invalid hello, closing connection")
+		return
+	}
+	id := int(binary.BigEndian.Uint32(frame[1:]))
+
+	r.mu.Lock()
+	node, ok := r.nodes[id]
+	if !ok {
+		r.mu.Unlock()
+		log.Warn().Str("layer", "RELAY").Int("node", id).Msg("Unknown node, closing connection")
+		return
+	}
+	prev, prevDone := node.conn, node.done
+	done := make(chan struct{})
+	node.conn, node.done = conn, done
+	r.mu.Unlock()
+	defer close(done)
+	if prev != nil {
+		prev.Close()
+		<-prevDone
+	}
+
+	log.Debug().Str("layer", "RELAY").Int("node", id).Msg("Node connected")
+	serveRelayLink(r.ctx, conn, node.out, r.maxFrame, func(to int, body []byte) bool {
+		r.mu.Lock()
+		dest, ok := r.nodes[to]
+		r.mu.Unlock()
+		if !ok {
+			log.Debug().Str("layer", "RELAY").Int("from", id).Int("to", to).Msg("Unknown recipient, dropping")
+			return true
+		}
+		dest.out.push(relayDataFrame(id, body))
+		return true
+	})
+}
+
+// spawn runs fn in a goroutine Close waits for. It returns false, without
+// running fn, once the relay is closed.
+func (r *Relay) spawn(fn func()) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return false
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+func (r *Relay) track(conn net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return false
+	}
+	r.conns[conn] = struct{}{}
+	return true
+}
+
+func (r *Relay) untrack(conn net.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, conn)
+}
+
+// RelayClient is a Transport over a Relay, for a node that can open
+// connections but not accept them. It keeps one connection to the relay,
+// redialed with backoff whenever it breaks, and sends a copy of each
+// broadcast to every peer through it. Frames stay queued until the relay
+// acknowledges them, and the node acknowledges the frames it receives once
+// they are in the inbox, so a message may arrive twice but is not lost
+// while the relay runs. Wrap it in an AuthenticatedTransport, as the relay
+// is not trusted.
+type RelayClient[TMsg any] struct {
+	self  int
+	peers []int
+	addr  string
+	codec Codec[TMsg]
+
+	inbox chan TMsg
+	out   *outbox
+	conn  net.Conn
+
+	ctx    context.Context // Canceled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// NewRelayClient creates the transport of node self, reaching the given
+// peers through the relay at addr.
+func NewRelayClient[TMsg any](self int, peers []int, addr string, codec Codec[TMsg]) *RelayClient[TMsg] {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RelayClient[TMsg]{
+		self:   self,
+		peers:  append([]int(nil), peers...),
+		addr:   addr,
+		codec:  codec,
+		out:    newOutbox(0, addr),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Register sets the inbox of this node. A RelayClient carries the messages
+// of one node, so id must be the ID it was created for.
+func (c *RelayClient[TMsg]) Register(id int, ch chan TMsg) {
+	if id != c.self {
+		log.Error().Str("layer", "RELAY").Int("node", c.self).Int("id", id).Msg("Relay client cannot register another node, ignoring")
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inbox = ch
+}
+
+// Listen connects to the relay, over which the messages for this node
+// arrive. Dial errors are retried, so it never fails.
+func (c *RelayClient[TMsg]) Listen() error {
+	c.spawn(c.run)
+	return nil
+}
+
+func (c *RelayClient[TMsg]) Broadcast(msg TMsg) {
+	body, ok := c.encode(msg)
+	if !ok {
+		return
+	}
+	c.deliverLocal(body)
+	for _, id := range c.peers {
+		if id != c.self {
+			c.out.push(relayDataFrame(id, body))
+		}
+	}
+}
+
+func (c *RelayClient[TMsg]) Send(to int, msg TMsg) {
+	body, ok := c.encode(msg)
+	if !ok {
+		return
+	}
+	if to == c.self {
+		c.deliverLocal(body)
+		return
+	}
+	c.out.push(relayDataFrame(to, body))
+}
+
+// Close disconnects from the relay and drops the queued messages.
+func (c *RelayClient[TMsg]) Close() error {
+	c.cancel()
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+	return nil
+}
+
+// run keeps the connection to the relay open until Close.
+func (c *RelayClient[TMsg]) run() {
+	backoff := tcpMinBackoff
+	for c.ctx.Err() == nil {
+		conn, err := c.dial()
+		if err != nil {
+			log.Debug().Str("layer", "RELAY").Int("node", c.self).Err(err).Dur("retry_in", backoff).Msg("Failed to connect to relay")
+			select {
+			case <-time.After(backoff):
+			case <-c.ctx.Done():
+				return
+			}
+			backoff = min(2*backoff, tcpMaxBackoff)
+			continue
+		}
+		backoff = tcpMinBackoff
+		serveRelayLink(c.ctx, conn, c.out, DefaultTCPMaxFrame, func(from int, body []byte) bool {
+			return c.deliver(body)
+		})
+	}
+}
+
+// dial connects to the relay and introduces this node.
+func (c *RelayClient[TMsg]) dial() (net.Conn, error) {
+	d := net.Dialer{Timeout: tcpDialTimeout}
+	conn, err := d.DialContext(c.ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	hello := make([]byte, relayHeaderSize)
+	hello[0] = relayHello
+	binary.BigEndian.PutUint32(hello[1:], uint32(c.self))
+	conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+	if err := writeFrame(conn, hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+func (c *RelayClient[TMsg]) encode(msg TMsg) ([]byte, bool) {
+	body, err := c.codec.Marshal(msg)
+	if err != nil {
+		log.Error().Str("layer", "RELAY").Str("codec", c.codec.Name()).Err(err).Msg("Failed to encode message, dropping")
+		return nil, false
+	}
+	return body, true
+}
+
+// deliverLocal hands this node its own copy of a message.
+func (c *RelayClient[TMsg]) deliverLocal(body []byte) {
+	c.spawn(func() { c.deliver(body) })
+}
+
+// spawn runs fn in a goroutine Close waits for, unless the client is
+// closed.
+func (c *RelayClient[TMsg]) spawn(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn()
+	}()
+}
+
+// deliver decodes body into the inbox. Bodies that fail to decode are
+// dropped. It returns false once the client is closed.
+func (c *RelayClient[TMsg]) deliver(body []byte) bool {
+	msg, err := c.codec.Unmarshal(body)
+	if err != nil {
+		log.Error().Str("layer", "RELAY").Str("codec", c.codec.Name()).Err(err).Msg("Failed to decode message, dropping")
+		return true
+	}
+	c.mu.Lock()
+	inbox := c.inbox
+	c.mu.Unlock()
+	if inbox == nil {
+		log.Warn().Str("layer", "RELAY").Int("node", c.self).Msg("No inbox registered, dropping message")
+		return true
+	}
+	select {
+	case inbox <- msg:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+const relayHeaderSize = 1 + 4
+
+func relayDataFrame(peer int, body []byte) []byte {
+	frame := make([]byte, relayHeaderSize+len(body))
+	frame[0] = relayData
+	binary.BigEndian.PutUint32(frame[1:], uint32(peer))
+	copy(frame[relayHeaderSize:], body)
+	return frame
+}
+
+// serveRelayLink runs one relay connection until it breaks: it writes the
+// frames of out, drops those the other end acknowledged, and acknowledges
+// the data frames it reads once onData accepted them. onData returns false
+// to stop.
+func serveRelayLink(ctx context.Context, conn net.Conn, out *outbox, maxFrame int, onData func(peer int, body []byte) bool) {
+	out.rewind()
+	var writeMu sync.Mutex
+	write := func(frame []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+		return writeFrame(conn, frame)
+	}
+
+	done := make(chan struct{})
+	var writer sync.WaitGroup
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		for {
+			if frame, ok := out.next(); ok {
+				if err := write(frame); err != nil {
+					conn.Close()
+					return
+				}
+				continue
+			}
+			select {
+			case <-out.wake:
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			}
+		}
+	}()
+	defer writer.Wait()
+	defer close(done)
+	defer conn.Close()
+
+	var received, acked uint32
+	ack := make([]byte, relayHeaderSize)
+	ack[0] = relayAck
+	for {
+		frame, err := readFrame(conn, maxFrame)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debug().Str("layer", "RELAY").Err(err).Msg("Relay connection broken")
+			}
+			return
+		}
+		if len(frame) < relayHeaderSize {
+			return
+		}
+		value := binary.BigEndian.Uint32(frame[1:relayHeaderSize])
+		switch frame[0] {
+		case relayAck:
+			if !out.ack(int(value - acked)) {
+				log.Warn().Str("layer", "RELAY").Uint32("ack", value).Msg("Invalid acknowledgement, reconnecting")
+				return
+			}
+			acked = value
+		case relayData:
+			if !onData(int(value), frame[relayHeaderSize:]) {
+				return
+			}
+			received++
+			binary.BigEndian.PutUint32(ack[1:], received)
+			if err := write(ack); err != nil {
+				return
+			}
+		default:
+			log.Warn().Str("layer", "RELAY").Int("kind", int(frame[0])).Msg("Unknown frame kind, reconnecting")
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ScalingRun is the cost of one simulated run of a protocol layer, used to
+// compare cluster sizes and to catch algorithmic regressions between
+// versions. Messages counts deliveries, so it does not depend on timing.
+type ScalingRun struct {
+	Layer    string        `json:"layer"`
+	N        int           `json:"n"`
+	T        int           `json:"t"`
+	Seed     int64         `json:"seed"`
+	Complete bool          `json:"complete"` // False if the step budget ran out first
+	Messages int           `json:"messages"`
+	Rounds   int           `json:"rounds"` // ABA rounds, fixed by the seed like the rest of the run
+	Duration time.Duration `json:"duration_ns"`
+	Allocs   uint64        `json:"allocs"`
+	Bytes    uint64        `json:"bytes"`
+}
+
+// RunScaling runs one instance of layer (Layer_ACast, Layer_IVSS or
+// Layer_ABA) in a simulated cluster of n honest nodes tolerating (n-1)/3
+// faults, with the delivery order drawn from seed:
+//
+//   - A-Cast: node 1 broadcasts a value until every node delivered it.
+//   - IVSS: node 1 shares a secret, then every node reconstructs it.
+//   - ABA: nodes start with alternating inputs until every node decided.
+//
+// The run stops once maxSteps deliveries were made or are pending (0 means
+// no limit) and is then reported incomplete. An error means the nodes
+// disagreed.
+func RunScaling(layer string, n int, seed int64, maxSteps int) (ScalingRun, error) {
+	run := ScalingRun{Layer: layer, N: n, T: (n - 1) / 3, Seed: seed}
+	run.Rounds = 1
+	var scenario func() (int, bool, error)
+	switch layer {
+	case Layer_ACast:
+		scenario = func() (int, bool, error) { return scaleACast(run.N, run.T, seed, maxSteps) }
+	case Layer_IVSS:
+		scenario = func() (int, bool, error) { return scaleIVSS(run.N, run.T, seed, maxSteps) }
+	case Layer_ABA:
+		scenario = func() (int, bool, error) { return scaleABA(run.N, run.T, seed, maxSteps, &run.Rounds) }
+	default:
+		return run, fmt.Errorf("no scaling scenario for layer %q", layer)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	messages, complete, err := scenario()
+	run.Duration = time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	run.Messages, run.Complete = messages, complete
+	run.Allocs = after.Mallocs - before.Mallocs
+	run.Bytes = after.TotalAlloc - before.TotalAlloc
+	return run, err
+}
+
+func scalingContext(id, n, t int) *NodeContext {
+	nc := NewNodeContext(id, n, t, zerolog.Disabled)
+	// Only deliveries are measured, events would pile up unread
+	nc.Events = nil
+	return nc
+}
+
+// allProduced returns a done function for Simulation.Run that reports true
+// once every node produced at least want results.
+func allProduced[TMsg any, TRes any](sim *Simulation[TMsg, TRes], n, want int) func() bool {
+	return func() bool {
+		for id := 1; id <= n; id++ {
+			if len(sim.Results(id)) < want {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// runBudget is Simulation.Run with the budget of RunScaling. Bounding the
+// pending deliveries too keeps large clusters from running out of memory
+// long before they reach maxSteps.
+func runBudget[TMsg any, TRes any](sim *Simulation[TMsg, TRes], done func() bool, maxSteps int) bool {
+	if maxSteps == 0 {
+		return sim.Run(done, 0)
+	}
+	for !done() {
+		if sim.Steps() >= maxSteps || sim.Pending() > maxSteps || !sim.Step() {
+			return done()
+		}
+	}
+	return true
+}
+
+func scaleACast(n, t int, seed int64, maxSteps int) (int, bool, error) {
+	sim := NewSimulation[ACastMessage[string], string](seed)
+	for id := 1; id <= n; id++ {
+		sim.AddNode(id, NewAcastServiceWithContext[string](scalingContext(id, n, t)))
+	}
+	val := "scaling"
+	sim.Context(1).Broadcast(NewACastMessage(val, 1))
+	if !runBudget(sim, allProduced(sim, n, 1), maxSteps) {
+		return sim.Steps(), false, nil
+	}
+	for id := 1; id <= n; id++ {
+		if got := sim.Results(id)[0]; got != val {
+			return sim.Steps(), true, fmt.Errorf("node %d delivered %q, expected %q", id, got, val)
+		}
+	}
+	return sim.Steps(), true, nil
+}
+
+func scaleIVSS(n, t int, seed int64, maxSteps int) (int, bool, error) {
+	sim := NewSimulation[IVSSMessage, IVSSResult](seed)
+	nodes := make([]*IVSSService, n)
+	for i := range nodes {
+		nodes[i] = NewIVSSServiceWithContext(scalingContext(i+1, n, t))
+		sim.AddNode(i+1, nodes[i])
+	}
+	secret := big.NewInt(42)
+	id := IVSSInstanceID("scaling", 1)
+	if err := nodes[0].StartSharing(id, secret, sim.Context(1)); err != nil {
+		return 0, false, err
+	}
+	if !runBudget(sim, allProduced(sim, n, 1), maxSteps) {
+		return sim.Steps(), false, nil
+	}
+	for i, node := range nodes {
+		if err := node.StartReconstruction(id, sim.Context(i+1)); err != nil {
+			return sim.Steps(), false, err
+		}
+	}
+	if !runBudget(sim, allProduced(sim, n, 2), maxSteps) {
+		return sim.Steps(), false, nil
+	}
+	for id := 1; id <= n; id++ {
+		for _, res := range sim.Results(id) {
+			if res.Type == "RECONSTRUCTED" && (res.Secret == nil || res.Secret.Cmp(secret) != 0) {
+				return sim.Steps(), true, fmt.Errorf("node %d reconstructed %v, expected %v", id, res.Secret, secret)
+			}
+		}
+	}
+	return sim.Steps(), true, nil
+}
+
+func scaleABA(n, t int, seed int64, maxSteps int, rounds *int) (int, bool, error) {
+	sim := NewSimulation[ABAMessage, int](seed)
+	nodes := make([]*ABAService, n)
+	for i := range nodes {
+		nc := scalingContext(i+1, n, t)
+		nc.Transitions = func(tr StateTransition) {
+			if tr.Layer == Layer_ABA && tr.Action == "START_ROUND" && tr.Counts["round"] > *rounds {
+				*rounds = tr.Counts["round"]
+			}
+		}
+		nodes[i] = NewABAServiceWithContext(nc, (i+1)%2)
+		sim.AddNode(i+1, nodes[i])
+	}
+	for i, node := range nodes {
+		node.Start(sim.Context(i + 1))
+	}
+	if !runBudget(sim, allProduced(sim, n, 1), maxSteps) {
+		return sim.Steps(), false, nil
+	}
+	decision := sim.Results(1)[0]
+	for id := 2; id <= n; id++ {
+		if got := sim.Results(id)[0]; got != decision {
+			return sim.Steps(), true, fmt.Errorf("node %d decided %d, node 1 decided %d", id, got, decision)
+		}
+	}
+	return sim.Steps(), true, nil
+}
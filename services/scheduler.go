@@ -0,0 +1,160 @@
+package services
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Delivery is one message on its way to one node, as seen by a Scheduler.
+type Delivery[TMsg any] struct {
+	Msg  TMsg
+	From int // 0 unless the network has a sender function, see SetSenderOf
+	To   int
+	Seq  uint64 // Order in which the network accepted the deliveries
+}
+
+// Scheduler controls the order in which a Network hands messages to the
+// inboxes. Schedule returns how long to hold d back; each inbox receives its
+// deliveries in the order they become ready, ties in the order they were
+// sent. Schedule is called with the network locked and must not use it.
+type Scheduler[TMsg any] interface {
+	Schedule(d Delivery[TMsg]) time.Duration
+}
+
+// SchedulerFunc holds back each delivery for the duration it returns.
+type SchedulerFunc[TMsg any] func(d Delivery[TMsg]) time.Duration
+
+func (f SchedulerFunc[TMsg]) Schedule(d Delivery[TMsg]) time.Duration {
+	return f(d)
+}
+
+// NewFIFOScheduler delivers the messages to each node exactly in the order
+// they were sent, which goroutine scheduling does not guarantee otherwise.
+func NewFIFOScheduler[TMsg any]() Scheduler[TMsg] {
+	return SchedulerFunc[TMsg](func(Delivery[TMsg]) time.Duration { return 0 })
+}
+
+// randomScheduler holds back each delivery for a uniform share of window.
+type randomScheduler[TMsg any] struct {
+	window time.Duration
+	rng    *rand.Rand
+	mu     sync.Mutex
+}
+
+// NewRandomScheduler holds back every delivery for a random duration below
+// window, drawn from a PRNG seeded with seed, so messages overtake each
+// other anywhere within window.
+func NewRandomScheduler[TMsg any](window time.Duration, seed int64) Scheduler[TMsg] {
+	return &randomScheduler[TMsg]{window: window, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (s *randomScheduler[TMsg]) Schedule(Delivery[TMsg]) time.Duration {
+	if s.window <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.rng.Int63n(int64(s.window)))
+}
+
+// NewAdversarialScheduler plays the asynchronous adversary against the
+// victims, at most t nodes for the guarantees to hold: every message from or
+// to a victim is held back for hold, the rest is delivered in order. The
+// other nodes have to make progress on their own and the victims learn
+// everything last, which is the slowest schedule the model allows.
+func NewAdversarialScheduler[TMsg any](victims []int, hold time.Duration) Scheduler[TMsg] {
+	slow := make(map[int]bool, len(victims))
+	for _, id := range victims {
+		slow[id] = true
+	}
+	return SchedulerFunc[TMsg](func(d Delivery[TMsg]) time.Duration {
+		if slow[d.From] || slow[d.To] {
+			return hold
+		}
+		return 0
+	})
+}
+
+// scheduled is a delivery waiting in a scheduleQueue.
+type scheduled[TMsg any] struct {
+	msg   TMsg
+	ready time.Time
+	seq   uint64
+}
+
+// scheduleQueue holds the scheduled deliveries to one endpoint and hands
+// them over in order from a goroutine that runs while the queue is not
+// empty.
+type scheduleQueue[TMsg any] struct {
+	items   scheduledHeap[TMsg]
+	wake    chan struct{}
+	running bool
+	mu      sync.Mutex
+}
+
+func newScheduleQueue[TMsg any]() *scheduleQueue[TMsg] {
+	return &scheduleQueue[TMsg]{wake: make(chan struct{}, 1)}
+}
+
+// push adds a delivery and starts the goroutine passing them to send if it
+// is not running.
+func (q *scheduleQueue[TMsg]) push(s scheduled[TMsg], send func(TMsg)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	heap.Push(&q.items, s)
+	if !q.running {
+		q.running = true
+		go q.run(send)
+		return
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *scheduleQueue[TMsg]) run(send func(TMsg)) {
+	for {
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		next := q.items[0]
+		if wait := time.Until(next.ready); wait > 0 {
+			q.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-q.wake: // An earlier delivery may have been pushed
+				timer.Stop()
+			}
+			continue
+		}
+		heap.Pop(&q.items)
+		q.mu.Unlock()
+		send(next.msg)
+	}
+}
+
+// scheduledHeap orders deliveries by ready time, then sequence number.
+type scheduledHeap[TMsg any] []scheduled[TMsg]
+
+func (h scheduledHeap[TMsg]) Len() int { return len(h) }
+func (h scheduledHeap[TMsg]) Less(i, j int) bool {
+	if !h[i].ready.Equal(h[j].ready) {
+		return h[i].ready.Before(h[j].ready)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h scheduledHeap[TMsg]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *scheduledHeap[TMsg]) Push(x any)   { *h = append(*h, x.(scheduled[TMsg])) }
+func (h *scheduledHeap[TMsg]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -6,6 +6,8 @@ type Service[TMsg any, TRes any] interface {
 
 type ServiceContext[TMsg any, TRes any] interface {
 	Broadcast(msg TMsg)
+	// SendTo delivers msg only to node to, e.g. a secret share meant for it
+	SendTo(to int, msg TMsg)
 	// IMPORTANT: this is crucial thing that it is always used in OnMessage of a service
 	// and should not be used in any goroutine becasuse here we do not synchronize access to awaitingMsgs
 	SendResult(res TRes)
@@ -16,14 +18,24 @@ type ServiceManager[TMsg any, TRes any] struct {
 	inbox        chan TMsg // For incoming messages that need to be processed
 	outbox       chan TRes // For outgoing messages/results
 	awaitingMsgs []TRes
-	network      *Network[TMsg]
+	network      Transport[TMsg]
 	stop         chan struct{}
 }
 
-func NewServiceManager[TMsg any, TRes any](service Service[TMsg, TRes], network *Network[TMsg]) *ServiceManager[TMsg, TRes] {
+// DefaultInboxSize is the inbox capacity of NewServiceManager.
+const DefaultInboxSize = 1000
+
+func NewServiceManager[TMsg any, TRes any](service Service[TMsg, TRes], network Transport[TMsg]) *ServiceManager[TMsg, TRes] {
+	return NewServiceManagerWithInbox(service, network, DefaultInboxSize)
+}
+
+// NewServiceManagerWithInbox creates a ServiceManager whose inbox holds up to
+// inboxSize messages. When it is full, the transport decides what happens to
+// further messages, see Network.SetBackpressure.
+func NewServiceManagerWithInbox[TMsg any, TRes any](service Service[TMsg, TRes], network Transport[TMsg], inboxSize int) *ServiceManager[TMsg, TRes] {
 	return &ServiceManager[TMsg, TRes]{
 		service:      service,
-		inbox:        make(chan TMsg, 1000),
+		inbox:        make(chan TMsg, inboxSize),
 		outbox:       make(chan TRes, 1000),
 		awaitingMsgs: make([]TRes, 0),
 		network:      network,
@@ -77,13 +89,50 @@ func (sm *ServiceManager[TMsg, TRes]) loop() {
 	}
 }
 
-// Implement ServiceContext
+// Implement ServiceContext. A SourcedTransport learns the sender from the
+// inbox, which the node registered
 func (sm *ServiceManager[TMsg, TRes]) Broadcast(msg TMsg) {
+	if sourced, ok := sm.network.(SourcedTransport[TMsg]); ok {
+		sourced.BroadcastFrom(sm.inbox, msg)
+		return
+	}
 	sm.network.Broadcast(msg)
 }
 
+func (sm *ServiceManager[TMsg, TRes]) SendTo(to int, msg TMsg) {
+	if sourced, ok := sm.network.(SourcedTransport[TMsg]); ok {
+		sourced.SendFrom(sm.inbox, to, msg)
+		return
+	}
+	sm.network.Send(to, msg)
+}
+
 func (sm *ServiceManager[TMsg, TRes]) SendResult(res TRes) {
 	// IMPORTANT: this is crucial thing that it is always used in OnMessage of a service
 	// and should not be used in any goroutine becasuse here we do not synchronize access to awaitingMsgs
 	sm.awaitingMsgs = append(sm.awaitingMsgs, res)
 }
+
+// deferredResults holds back results a service produces while holding its
+// lock. The parent may react to a result by calling back into the same
+// service (ICC starts a reconstruction as soon as a sharing completes, ABA
+// starts the next Vote round as soon as one finishes), so results are only
+// passed on by flush, which must run after the lock is released.
+type deferredResults[TMsg any, TRes any] struct {
+	ServiceContext[TMsg, TRes]
+	results []TRes
+}
+
+func newDeferredResults[TMsg any, TRes any](ctx ServiceContext[TMsg, TRes]) *deferredResults[TMsg, TRes] {
+	return &deferredResults[TMsg, TRes]{ServiceContext: ctx}
+}
+
+func (d *deferredResults[TMsg, TRes]) SendResult(res TRes) {
+	d.results = append(d.results, res)
+}
+
+func (d *deferredResults[TMsg, TRes]) flush() {
+	for _, res := range d.results {
+		d.ServiceContext.SendResult(res)
+	}
+}
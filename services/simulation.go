@@ -0,0 +1,254 @@
+package services
+
+import (
+	"io"
+	"math/rand"
+	"sort"
+
+	"github.com/rs/zerolog"
+)
+
+// Simulation runs a whole cluster in the calling goroutine. Broadcasts are
+// queued instead of sent, and a scheduler picks which pending delivery
+// happens next, so the interleaving of a run is fixed by the scheduler alone
+// and no test has to sleep or wait on timeouts.
+type Simulation[TMsg any, TRes any] struct {
+	nodes   map[int]Service[TMsg, TRes]
+	twins   map[int]Service[TMsg, TRes] // Second nodes sharing an ID, see AddTwin
+	ids     []int                       // Sorted, so broadcasts are queued in a stable order
+	pending []simDelivery[TMsg]
+	results map[int][]TRes
+	twinRes map[int][]TRes
+	choose  func(pending int) int
+	steps   int
+	// unordered lets Step swap the last pending delivery into the slot of
+	// the one it takes, which keeps large clusters linear. Only valid when
+	// the chooser ignores queue order.
+	unordered bool
+}
+
+type simDelivery[TMsg any] struct {
+	to   int
+	twin bool
+	msg  TMsg
+}
+
+// NewSimulation creates a simulation whose delivery order is drawn from a
+// PRNG seeded with seed. Runs with the same seed deliver the same messages
+// in the same order, as long as the services themselves are deterministic.
+func NewSimulation[TMsg any, TRes any](seed int64) *Simulation[TMsg, TRes] {
+	rng := rand.New(rand.NewSource(seed))
+	sim := NewSimulationWithChooser[TMsg, TRes](rng.Intn)
+	sim.unordered = true
+	return sim
+}
+
+// SimConfig makes a simulated run reproducible from one seed: the delivery
+// order of the Simulation and the coin secrets, polynomial coefficients and
+// A-Cast nonces of every node are all drawn from PRNGs derived from Seed, so
+// a failing run is replayed exactly by running it again with its seed.
+type SimConfig struct {
+	Seed int64
+}
+
+// NewSimulationWithConfig creates a simulation whose delivery order is drawn
+// from cfg.Seed. Create the nodes with cfg.NewNodeContext.
+func NewSimulationWithConfig[TMsg any, TRes any](cfg SimConfig) *Simulation[TMsg, TRes] {
+	return NewSimulation[TMsg, TRes](cfg.Seed)
+}
+
+// NodeRand returns the randomness of node id, a PRNG seeded from Seed and id
+// so no two nodes draw the same values.
+func (c SimConfig) NodeRand(id int) io.Reader {
+	// splitmix64 finalizer, so nearby seeds and IDs give unrelated streams
+	z := uint64(c.Seed) + uint64(id)*0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return rand.New(rand.NewSource(int64(z ^ z>>31)))
+}
+
+// NewNodeContext creates the context of node id with NodeRand(id) as its
+// randomness.
+func (c SimConfig) NewNodeContext(id, n, t int, logLevel zerolog.Level) *NodeContext {
+	nc := NewNodeContext(id, n, t, logLevel)
+	nc.Rand = c.NodeRand(id)
+	return nc
+}
+
+// NewSimulationWithChooser creates a simulation that asks choose which of the
+// pending deliveries (an index below pending, oldest first) to perform next.
+func NewSimulationWithChooser[TMsg any, TRes any](choose func(pending int) int) *Simulation[TMsg, TRes] {
+	return &Simulation[TMsg, TRes]{
+		nodes:   make(map[int]Service[TMsg, TRes]),
+		twins:   make(map[int]Service[TMsg, TRes]),
+		results: make(map[int][]TRes),
+		twinRes: make(map[int][]TRes),
+		choose:  choose,
+	}
+}
+
+// AddNode adds a node to the cluster. Messages already queued do not reach it.
+func (s *Simulation[TMsg, TRes]) AddNode(id int, svc Service[TMsg, TRes]) {
+	if _, ok := s.nodes[id]; !ok {
+		s.ids = append(s.ids, id)
+		sort.Ints(s.ids)
+	}
+	s.nodes[id] = svc
+}
+
+// AddTwin adds a second node under the ID of node id. Both receive every
+// broadcast and their messages are indistinguishable, which simulates a
+// Byzantine node equivocating at the identity level.
+func (s *Simulation[TMsg, TRes]) AddTwin(id int, svc Service[TMsg, TRes]) {
+	s.twins[id] = svc
+}
+
+// Context returns the context of node id, for calls made outside OnMessage
+// (e.g. Start or StartSharing).
+func (s *Simulation[TMsg, TRes]) Context(id int) ServiceContext[TMsg, TRes] {
+	return &simContext[TMsg, TRes]{sim: s, id: id}
+}
+
+// TwinContext returns the context of the twin of node id.
+func (s *Simulation[TMsg, TRes]) TwinContext(id int) ServiceContext[TMsg, TRes] {
+	return &simContext[TMsg, TRes]{sim: s, id: id, twin: true}
+}
+
+// Step performs one pending delivery. Returns false if nothing was pending.
+func (s *Simulation[TMsg, TRes]) Step() bool {
+	if len(s.pending) == 0 {
+		return false
+	}
+	i := s.choose(len(s.pending))
+	d := s.pending[i]
+	if last := len(s.pending) - 1; s.unordered {
+		s.pending[i] = s.pending[last]
+		s.pending[last] = simDelivery[TMsg]{}
+		s.pending = s.pending[:last]
+	} else {
+		s.pending = append(s.pending[:i], s.pending[i+1:]...)
+	}
+	s.steps++
+	if d.twin {
+		s.twins[d.to].OnMessage(d.msg, s.TwinContext(d.to))
+	} else {
+		s.nodes[d.to].OnMessage(d.msg, s.Context(d.to))
+	}
+	return true
+}
+
+// Run delivers messages until done reports true, nothing is pending or
+// maxSteps deliveries were made (0 means no limit). A nil done runs until
+// the cluster is quiescent. Returns whether the run ended because of done
+// (or quiescence, if done is nil).
+func (s *Simulation[TMsg, TRes]) Run(done func() bool, maxSteps int) bool {
+	for maxSteps == 0 || s.steps < maxSteps {
+		if done != nil && done() {
+			return true
+		}
+		if !s.Step() {
+			return done == nil
+		}
+	}
+	return done != nil && done()
+}
+
+// Results returns every result node id produced so far, in order.
+func (s *Simulation[TMsg, TRes]) Results(id int) []TRes {
+	return s.results[id]
+}
+
+// TwinResults returns every result the twin of node id produced so far.
+func (s *Simulation[TMsg, TRes]) TwinResults(id int) []TRes {
+	return s.twinRes[id]
+}
+
+// Pending returns the number of queued deliveries.
+func (s *Simulation[TMsg, TRes]) Pending() int {
+	return len(s.pending)
+}
+
+// Steps returns the number of deliveries made so far.
+func (s *Simulation[TMsg, TRes]) Steps() int {
+	return s.steps
+}
+
+type simContext[TMsg any, TRes any] struct {
+	sim  *Simulation[TMsg, TRes]
+	id   int
+	twin bool
+}
+
+func (c *simContext[TMsg, TRes]) Broadcast(msg TMsg) {
+	for _, id := range c.sim.ids {
+		c.sim.pending = append(c.sim.pending, simDelivery[TMsg]{to: id, msg: msg})
+		if _, ok := c.sim.twins[id]; ok {
+			c.sim.pending = append(c.sim.pending, simDelivery[TMsg]{to: id, twin: true, msg: msg})
+		}
+	}
+}
+
+func (c *simContext[TMsg, TRes]) SendTo(to int, msg TMsg) {
+	if _, ok := c.sim.nodes[to]; !ok {
+		return
+	}
+	c.sim.pending = append(c.sim.pending, simDelivery[TMsg]{to: to, msg: msg})
+	if _, ok := c.sim.twins[to]; ok {
+		c.sim.pending = append(c.sim.pending, simDelivery[TMsg]{to: to, twin: true, msg: msg})
+	}
+}
+
+func (c *simContext[TMsg, TRes]) SendResult(res TRes) {
+	if c.twin {
+		c.sim.twinRes[c.id] = append(c.sim.twinRes[c.id], res)
+		return
+	}
+	c.sim.results[c.id] = append(c.sim.results[c.id], res)
+}
+
+// ExploreSchedules runs every delivery order that differs within the first
+// depth steps; later steps always take the oldest pending delivery. setup
+// builds and starts a fresh cluster on the given simulation, and check is
+// called once the run is over (done or quiescent, see Simulation.Run).
+// Exploration stops at the first error, which is returned together with the
+// number of schedules run and the choices that led to it.
+func ExploreSchedules[TMsg any, TRes any](depth, maxSteps int, setup func(*Simulation[TMsg, TRes]), done func(*Simulation[TMsg, TRes]) bool, check func(*Simulation[TMsg, TRes]) error) (int, []int, error) {
+	runs := 0
+	var explore func(prefix []int) ([]int, error)
+	explore = func(prefix []int) ([]int, error) {
+		var choices, widths []int
+		sim := NewSimulationWithChooser[TMsg, TRes](func(pending int) int {
+			c := 0
+			if k := len(choices); k < len(prefix) {
+				c = prefix[k]
+			}
+			choices = append(choices, c)
+			widths = append(widths, pending)
+			return c
+		})
+		setup(sim)
+		var simDone func() bool
+		if done != nil {
+			simDone = func() bool { return done(sim) }
+		}
+		sim.Run(simDone, maxSteps)
+		runs++
+		if err := check(sim); err != nil {
+			return choices, err
+		}
+
+		// Branch at every step past the prefix; the runs taking choice 0
+		// there are the one that just finished
+		for k := len(prefix); k < depth && k < len(widths); k++ {
+			for c := 1; c < widths[k]; c++ {
+				next := append(append(make([]int, 0, k+1), choices[:k]...), c)
+				if trace, err := explore(next); err != nil {
+					return trace, err
+				}
+			}
+		}
+		return nil, nil
+	}
+	trace, err := explore(nil)
+	return runs, trace, err
+}
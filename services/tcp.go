@@ -0,0 +1,583 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTCPMaxFrame bounds the frames a TCPNetwork accepts, so a faulty peer
+// cannot make it allocate arbitrary amounts of memory.
+const DefaultTCPMaxFrame = 16 << 20
+
+const (
+	tcpDialTimeout  = 2 * time.Second
+	tcpWriteTimeout = 5 * time.Second
+	tcpMinBackoff   = 50 * time.Millisecond
+	tcpMaxBackoff   = 2 * time.Second
+)
+
+// TCPNetwork is a Transport over TCP for nodes running in separate processes
+// or on separate machines. Every node runs its own TCPNetwork, listening on
+// its address in the peer table. Messages are encoded with a Codec and sent
+// as frames prefixed with their 4-byte big-endian length.
+//
+// Each peer has an outgoing queue drained over one connection, which is
+// redialed with backoff whenever it breaks. The receiver acknowledges every
+// frame once it is in the inbox and frames stay queued until acknowledged, so
+// messages to a peer that is down wait until it is back, as the reliable
+// channels the protocols assume require. Frames whose acknowledgement was
+// lost are sent again, so a peer may receive a message twice.
+//
+// Connections are plaintext unless SetMutualTLS is called, which binds every
+// connection to the node ID of the certificate on its other end.
+type TCPNetwork[TMsg any] struct {
+	self     int
+	addrs    map[int]string
+	codec    Codec[TMsg]
+	maxFrame int
+	limit    RateLimit              // Optional, per incoming connection
+	tls      *mutualTLS             // Optional, authenticates the peers
+	senderOf func(TMsg) (int, bool) // Optional, checked against the peer of a TLS connection
+
+	inbox    chan TMsg
+	listener net.Listener
+	peers    map[int]*outbox
+	conns    map[net.Conn]struct{} // Open connections, closed by Close
+
+	ctx    context.Context // Canceled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+// outbox is the outgoing side of the link to one peer, shared by the
+// transports that acknowledge frames.
+type outbox struct {
+	id    int
+	addr  string
+	queue [][]byte      // Frames not acknowledged yet, oldest first
+	sent  int           // Frames at the head of queue written on the current connection
+	wake  chan struct{} // Signals new frames to the sender goroutine
+	mu    sync.Mutex
+}
+
+func newOutbox(id int, addr string) *outbox {
+	return &outbox{id: id, addr: addr, wake: make(chan struct{}, 1)}
+}
+
+// push queues frame and wakes the sender.
+func (p *outbox) push(frame []byte) {
+	p.mu.Lock()
+	p.queue = append(p.queue, frame)
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the first frame not written on the current connection yet.
+func (p *outbox) next() ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sent == len(p.queue) {
+		return nil, false
+	}
+	p.sent++
+	return p.queue[p.sent-1], true
+}
+
+// ack drops k frames written on the current connection from the queue. It
+// returns false if fewer than k were written.
+func (p *outbox) ack(k int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k < 0 || k > p.sent {
+		return false
+	}
+	p.queue = p.queue[k:]
+	p.sent -= k
+	return true
+}
+
+// rewind makes everything not acknowledged go out again on the next
+// connection.
+func (p *outbox) rewind() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = 0
+}
+
+// wait blocks until frames are queued. It returns false once ctx is done.
+func (p *outbox) wait(ctx context.Context) bool {
+	for {
+		p.mu.Lock()
+		pending := len(p.queue) > 0
+		p.mu.Unlock()
+		if pending {
+			return true
+		}
+		select {
+		case <-p.wake:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// NewTCPNetwork creates the transport of node self. addrs maps every node
+// ID, self included, to its host:port.
+func NewTCPNetwork[TMsg any](self int, addrs map[int]string, codec Codec[TMsg]) *TCPNetwork[TMsg] {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &TCPNetwork[TMsg]{
+		self:     self,
+		addrs:    make(map[int]string, len(addrs)),
+		codec:    codec,
+		maxFrame: DefaultTCPMaxFrame,
+		peers:    make(map[int]*outbox),
+		conns:    make(map[net.Conn]struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for id, addr := range addrs {
+		n.addrs[id] = addr
+	}
+	return n
+}
+
+// SetMaxFrameSize limits the frames accepted from peers to size bytes.
+func (n *TCPNetwork[TMsg]) SetMaxFrameSize(size int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.maxFrame = size
+}
+
+// SetRateLimit limits how fast the frames of each incoming connection are
+// read, so a peer flooding this node only slows down its own connection:
+// TCP flow control pushes back on it while the frames of other peers keep
+// flowing. Nothing is dropped. A zero limit removes it; it applies to
+// connections accepted afterwards.
+func (n *TCPNetwork[TMsg]) SetRateLimit(limit RateLimit) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.limit = limit
+}
+
+// SetMutualTLS authenticates every connection with the certificates of
+// provider: both ends must present a certificate of its CAs, identity maps
+// it to a node ID, and a dialed peer must be the node it was dialed as.
+// Call it before Listen and before sending.
+func (n *TCPNetwork[TMsg]) SetMutualTLS(provider CertificateProvider, identity PeerIdentity) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.tls = &mutualTLS{provider: provider, identity: identity}
+}
+
+// SetSenderOf sets how the network finds the node a message claims to come
+// from, e.g. ABASender. With mutual TLS, messages claiming another sender
+// than the authenticated peer are dropped.
+func (n *TCPNetwork[TMsg]) SetSenderOf(senderOf func(TMsg) (int, bool)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.senderOf = senderOf
+}
+
+// Listen accepts connections from peers on the address of this node.
+func (n *TCPNetwork[TMsg]) Listen() error {
+	l, err := net.Listen("tcp", n.addrs[n.self])
+	if err != nil {
+		return err
+	}
+	n.Serve(l)
+	return nil
+}
+
+// Serve accepts connections from peers on l, e.g. a listener on port 0
+// whose address was put in the peer tables of the other nodes.
+func (n *TCPNetwork[TMsg]) Serve(l net.Listener) {
+	n.mu.Lock()
+	n.listener = l
+	n.mu.Unlock()
+
+	n.spawn(func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return // Closed
+			}
+			if !n.track(conn) {
+				conn.Close()
+				return
+			}
+			n.spawn(func() { n.receive(conn) })
+		}
+	})
+}
+
+// Register sets the inbox of this node; call it before Listen, as messages
+// arriving earlier are dropped. A TCPNetwork carries the messages of one
+// node, so id must be the ID it was created for.
+func (n *TCPNetwork[TMsg]) Register(id int, ch chan TMsg) {
+	if id != n.self {
+		log.Error().Str("layer", "NETWORK").Int("node", n.self).Int("id", id).Msg("TCP network cannot register another node, ignoring")
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.inbox = ch
+}
+
+func (n *TCPNetwork[TMsg]) Broadcast(msg TMsg) {
+	frame, ok := n.encode(msg)
+	if !ok {
+		return
+	}
+	for id := range n.addrs {
+		n.sendFrame(id, frame)
+	}
+}
+
+// Send delivers msg only to node to. Messages to IDs missing from the peer
+// table are dropped.
+func (n *TCPNetwork[TMsg]) Send(to int, msg TMsg) {
+	if _, ok := n.addrs[to]; !ok {
+		return
+	}
+	if frame, ok := n.encode(msg); ok {
+		n.sendFrame(to, frame)
+	}
+}
+
+// Close stops listening, drops the queued messages and closes every
+// connection.
+func (n *TCPNetwork[TMsg]) Close() error {
+	n.cancel()
+	n.mu.Lock()
+	var err error
+	if n.listener != nil {
+		err = n.listener.Close()
+	}
+	for conn := range n.conns {
+		conn.Close()
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+	return err
+}
+
+func (n *TCPNetwork[TMsg]) encode(msg TMsg) ([]byte, bool) {
+	data, err := n.codec.Marshal(msg)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to encode message, dropping")
+		return nil, false
+	}
+	return data, true
+}
+
+// sendFrame queues frame for node id. Frames to this node skip TCP, but are
+// still decoded so the inbox gets its own copy, as from any peer.
+func (n *TCPNetwork[TMsg]) sendFrame(id int, frame []byte) {
+	if id == n.self {
+		n.spawn(func() { n.deliver(frame, n.self) })
+		return
+	}
+
+	if p := n.peer(id); p != nil {
+		p.push(frame)
+	}
+}
+
+// peer returns the link to node id, starting its sender on first use. It
+// returns nil once the network is closed.
+func (n *TCPNetwork[TMsg]) peer(id int) *outbox {
+	n.mu.Lock()
+	p, ok := n.peers[id]
+	n.mu.Unlock()
+	if ok {
+		return p
+	}
+	p = newOutbox(id, n.addrs[id])
+	n.mu.Lock()
+	if existing, ok := n.peers[id]; ok {
+		n.mu.Unlock()
+		return existing
+	}
+	n.peers[id] = p
+	n.mu.Unlock()
+	if !n.spawn(func() { n.run(p) }) {
+		return nil
+	}
+	return p
+}
+
+// spawn runs fn in a goroutine Close waits for. It returns false, without
+// running fn, once the network is closed.
+func (n *TCPNetwork[TMsg]) spawn(fn func()) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return false
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// run keeps a connection to p open while frames are queued for it.
+func (n *TCPNetwork[TMsg]) run(p *outbox) {
+	backoff := tcpMinBackoff
+	for {
+		if !p.wait(n.ctx) {
+			return
+		}
+		conn, err := n.dial(p)
+		if err != nil {
+			if n.ctx.Err() != nil {
+				return
+			}
+			log.Debug().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Err(err).Dur("retry_in", backoff).Msg("Failed to connect")
+			select {
+			case <-time.After(backoff):
+			case <-n.ctx.Done():
+				return
+			}
+			backoff = min(2*backoff, tcpMaxBackoff)
+			continue
+		}
+		backoff = tcpMinBackoff
+
+		broken := make(chan struct{})
+		go func() {
+			defer close(broken)
+			n.readAcks(p, conn)
+		}()
+		n.write(p, conn, broken)
+		conn.Close()
+		<-broken
+		n.untrack(conn)
+		p.rewind()
+	}
+}
+
+// dial connects to p, over mutual TLS if it is set.
+func (n *TCPNetwork[TMsg]) dial(p *outbox) (net.Conn, error) {
+	d := net.Dialer{Timeout: tcpDialTimeout}
+	conn, err := d.DialContext(n.ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	mtls := n.tls
+	n.mu.Unlock()
+	if mtls != nil {
+		tlsConn := tls.Client(conn, mtls.clientConfig(p.id))
+		ctx, cancel := context.WithTimeout(n.ctx, tcpDialTimeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if !n.track(conn) {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+// write sends the queued frames of p over conn until it breaks.
+func (n *TCPNetwork[TMsg]) write(p *outbox, conn net.Conn, broken <-chan struct{}) {
+	for {
+		if frame, ok := p.next(); ok {
+			conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+			if err := writeFrame(conn, frame); err != nil {
+				log.Debug().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Err(err).Msg("Connection broken, reconnecting")
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-p.wake:
+		case <-broken:
+			return
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+// readAcks drops the frames the peer acknowledged from the queue of p. The
+// peer sends the number of frames it received on conn so far.
+func (n *TCPNetwork[TMsg]) readAcks(p *outbox, conn net.Conn) {
+	var acked uint32
+	var b [4]byte
+	for {
+		if _, err := io.ReadFull(conn, b[:]); err != nil {
+			return
+		}
+		total := binary.BigEndian.Uint32(b[:])
+		if !p.ack(int(total - acked)) {
+			log.Warn().Str("layer", "NETWORK").Int("node", n.self).Int("peer", p.id).Uint32("ack", total).Msg("Invalid acknowledgement, reconnecting")
+			conn.Close()
+			return
+		}
+		acked = total
+	}
+}
+
+// receive delivers the frames arriving on conn and acknowledges each one.
+func (n *TCPNetwork[TMsg]) receive(conn net.Conn) {
+	defer n.untrack(conn)
+	defer conn.Close()
+
+	n.mu.Lock()
+	maxFrame, limit, mtls := n.maxFrame, n.limit, n.tls
+	n.mu.Unlock()
+
+	// Without TLS the peer is unknown and sender checks are skipped
+	peer := 0
+	if mtls != nil {
+		tlsConn := tls.Server(conn, mtls.serverConfig())
+		ctx, cancel := context.WithTimeout(n.ctx, tcpDialTimeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			log.Warn().Str("layer", "NETWORK").Int("node", n.self).Str("remote", conn.RemoteAddr().String()).Err(err).Msg("Rejected peer")
+			return
+		}
+		if peer, err = mtls.identity(tlsConn.ConnectionState().PeerCertificates[0]); err != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	var bucket *tokenBucket
+	if limit.Rate > 0 {
+		bucket = newTokenBucket(limit, time.Now())
+	}
+
+	var received uint32
+	var ack [4]byte
+	for {
+		frame, err := readFrame(conn, maxFrame)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debug().Str("layer", "NETWORK").Int("node", n.self).Err(err).Msg("Closing incoming connection")
+			}
+			return
+		}
+		if bucket != nil && !n.sleep(bucket.take(time.Now())) {
+			return
+		}
+		if !n.deliver(frame, peer) {
+			return
+		}
+		received++
+		binary.BigEndian.PutUint32(ack[:], received)
+		conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+		if _, err := conn.Write(ack[:]); err != nil {
+			return
+		}
+	}
+}
+
+// deliver decodes frame, received from node peer or 0 if unknown, into the
+// inbox. Frames that fail to decode or claim another sender than peer are
+// dropped. It returns false once the network is closed.
+func (n *TCPNetwork[TMsg]) deliver(frame []byte, peer int) bool {
+	msg, err := n.codec.Unmarshal(frame)
+	if err != nil {
+		log.Error().Str("layer", "NETWORK").Str("codec", n.codec.Name()).Err(err).Msg("Failed to decode message, dropping")
+		return true
+	}
+	n.mu.Lock()
+	inbox, senderOf := n.inbox, n.senderOf
+	n.mu.Unlock()
+	if peer != 0 && senderOf != nil {
+		if from, ok := senderOf(msg); ok && from != peer {
+			log.Warn().Str("layer", "NETWORK").Int("node", n.self).Int("peer", peer).Int("claimed", from).Msg("Message claims another sender than its peer, dropping")
+			return true
+		}
+	}
+	if inbox == nil {
+		log.Warn().Str("layer", "NETWORK").Int("node", n.self).Msg("No inbox registered, dropping message")
+		return true
+	}
+	select {
+	case inbox <- msg:
+		return true
+	case <-n.ctx.Done():
+		return false
+	}
+}
+
+// sleep waits for d. It returns false if the network was closed meanwhile.
+func (n *TCPNetwork[TMsg]) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-n.ctx.Done():
+		return false
+	}
+}
+
+// track records conn so Close can close it. It returns false once the
+// network is closed.
+func (n *TCPNetwork[TMsg]) track(conn net.Conn) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return false
+	}
+	n.conns[conn] = struct{}{}
+	return true
+}
+
+func (n *TCPNetwork[TMsg]) untrack(conn net.Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.conns, conn)
+}
+
+func writeFrame(w io.Writer, frame []byte) error {
+	buf := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader, maxFrame int) ([]byte, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(b[:])
+	if maxFrame > 0 && int64(size) > int64(maxFrame) {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit of %d", size, maxFrame)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
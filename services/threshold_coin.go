@@ -0,0 +1,363 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+)
+
+// ThresholdCoin is the coin of Cachin, Kursawe and Shoup: the coin of
+// round r is a bit of the unique threshold signature H(r)^x on r, where a
+// trusted dealer shared the key x among the nodes with a polynomial of
+// degree t, see DealThresholdCoinKeys. Each node sends its signature share
+// H(r)^x_i with a Chaum-Pedersen proof that it used its key share, and any
+// t+1 valid shares give the same signature. Up to t faulty nodes cannot
+// compute the coin before a correct node flips it, nor make correct nodes
+// disagree, so the coin always agrees, at the cost of one message per node
+// and round instead of the n^2 sharings of ICC.
+//
+// Signatures are in the order-q subgroup of the 2048-bit MODP group of RFC
+// 3526, where they are secure under the DDH assumption. BLS threshold
+// signatures would make the shares shorter and verifiable without proofs,
+// but need a pairing library the module does not depend on.
+//
+// The coin exchanges its shares itself, through the broadcast function it
+// was created with, and takes those of its peers through Deliver.
+type ThresholdCoin struct {
+	key       *ThresholdCoinKey
+	broadcast func(ThresholdCoinShare)
+	rand      io.Reader
+
+	mu     sync.Mutex
+	rounds map[int]*thresholdRound
+	top    int // Highest round flipped
+}
+
+// ThresholdCoinWindow is how many rounds past the highest round it flipped
+// a coin takes shares for. A faulty node holds a key share and can sign any
+// round, so without the window it could fill the memory of its peers with
+// rounds they never reach. Decided rounds as far behind it are dropped.
+const ThresholdCoinWindow = 64
+
+// ThresholdCoinKey is what the dealer hands node ID: its share of the key
+// and the verification keys of every node.
+type ThresholdCoinKey struct {
+	ID           int
+	N            int
+	T            int
+	Share        *big.Int   // x_ID
+	Verification []*big.Int // g^x_j of node j at j-1
+}
+
+// ThresholdCoinShare is the signature share of Sender for Round, with the
+// Chaum-Pedersen proof (C, Z) that log_g Verification[Sender-1] =
+// log_H(Round) Value.
+type ThresholdCoinShare struct {
+	Round  int
+	Sender int
+	Value  *big.Int
+	C      *big.Int
+	Z      *big.Int
+}
+
+// thresholdRound holds the valid shares of a round until the coin is known.
+type thresholdRound struct {
+	shares  map[int]*big.Int // Nil once the coin is known
+	flipped bool
+	out     chan int // Yields the coin and is closed once it is known
+}
+
+// thresholdP is the safe prime of the 2048-bit MODP group of RFC 3526, and
+// thresholdQ = (p-1)/2 the prime order of its subgroup of squares, which
+// thresholdG generates.
+var (
+	thresholdP, _ = new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+			"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+			"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510"+
+			"15728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+	thresholdQ = new(big.Int).Rsh(thresholdP, 1)
+	thresholdG = big.NewInt(4)
+)
+
+// thresholdCoinDomain separates the hashes of the coin from anything else.
+const thresholdCoinDomain = "aba-threshold-coin-v1"
+
+// DealThresholdCoinKeys is the trusted setup of the coin for n nodes of
+// which t may fail: it draws the key x and hands node j the share f(j) of a
+// random polynomial f of degree t with f(0) = x. The dealer must forget x
+// and the shares, and hand each key to its node only.
+func DealThresholdCoinKeys(n, t int, r io.Reader) ([]*ThresholdCoinKey, error) {
+	if t < 0 || n < t+1 {
+		return nil, fmt.Errorf("%d nodes cannot hold a key of threshold %d", n, t+1)
+	}
+	if r == nil {
+		r = rand.Reader
+	}
+	coeffs := make([]*big.Int, t+1)
+	for i := range coeffs {
+		c, err := rand.Int(r, thresholdQ)
+		if err != nil {
+			return nil, err
+		}
+		coeffs[i] = c
+	}
+
+	shares := make([]*big.Int, n)
+	verification := make([]*big.Int, n)
+	for j := 1; j <= n; j++ {
+		// Horner's method
+		x, share := big.NewInt(int64(j)), big.NewInt(0)
+		for i := t; i >= 0; i-- {
+			share.Mul(share, x).Add(share, coeffs[i]).Mod(share, thresholdQ)
+		}
+		shares[j-1] = share
+		verification[j-1] = new(big.Int).Exp(thresholdG, share, thresholdP)
+	}
+
+	keys := make([]*ThresholdCoinKey, n)
+	for j := range keys {
+		keys[j] = &ThresholdCoinKey{ID: j + 1, N: n, T: t, Share: shares[j], Verification: verification}
+	}
+	return keys, nil
+}
+
+// NewThresholdCoin returns the coin of key, which sends the shares of this
+// node to every other node through broadcast. broadcast is called without
+// any lock held, so it may deliver synchronously.
+func NewThresholdCoin(key *ThresholdCoinKey, broadcast func(ThresholdCoinShare)) *ThresholdCoin {
+	return &ThresholdCoin{
+		key:       key,
+		broadcast: broadcast,
+		rand:      rand.Reader,
+		rounds:    make(map[int]*thresholdRound),
+	}
+}
+
+// Flip signs round with the key share, sends the signature share and
+// returns the channel of the coin, which yields it once t+1 valid shares
+// arrived.
+func (c *ThresholdCoin) Flip(round int) <-chan int {
+	c.mu.Lock()
+	rs := c.round(round)
+	out, flipped := rs.out, rs.flipped
+	rs.flipped = true
+	if round > c.top {
+		c.top = round
+		c.prune()
+	}
+	c.mu.Unlock()
+	if flipped {
+		return out
+	}
+
+	// Peers that are behind still need the share once the coin is known
+	share, err := c.sign(round)
+	if err != nil {
+		return out
+	}
+	c.add(share)
+	c.broadcast(share)
+	return out
+}
+
+// Deliver takes the signature share of a peer, and fails if it is not
+// valid or its round is outside the window, see ThresholdCoinWindow.
+func (c *ThresholdCoin) Deliver(share ThresholdCoinShare) error {
+	// Checked before the proof, which is far more expensive
+	c.mu.Lock()
+	err := c.inWindow(share.Round)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := c.verify(share); err != nil {
+		return err
+	}
+	c.add(share)
+	return nil
+}
+
+// inWindow returns an error if shares of round r are not taken: it is more
+// than ThresholdCoinWindow rounds past the highest round flipped, or it was
+// dropped or is as far behind it.
+func (c *ThresholdCoin) inWindow(r int) error {
+	// Assumes lock is held
+	if r > c.top+ThresholdCoinWindow {
+		return fmt.Errorf("round %d is more than %d rounds ahead of round %d", r, ThresholdCoinWindow, c.top)
+	}
+	if _, ok := c.rounds[r]; !ok && r <= c.top-ThresholdCoinWindow {
+		return fmt.Errorf("round %d is %d or more rounds behind round %d", r, ThresholdCoinWindow, c.top)
+	}
+	return nil
+}
+
+// prune drops the decided rounds ThresholdCoinWindow or more rounds behind
+// the highest round flipped. Their coin went out, and this node sent its
+// share for peers that are behind when it flipped them.
+func (c *ThresholdCoin) prune() {
+	// Assumes lock is held
+	for r, rs := range c.rounds {
+		if rs.shares == nil && r <= c.top-ThresholdCoinWindow {
+			delete(c.rounds, r)
+		}
+	}
+}
+
+// round returns the state of round r, creating it if it is new.
+func (c *ThresholdCoin) round(r int) *thresholdRound {
+	// Assumes lock is held
+	rs, ok := c.rounds[r]
+	if !ok {
+		rs = &thresholdRound{shares: make(map[int]*big.Int), out: make(chan int, 1)}
+		c.rounds[r] = rs
+	}
+	return rs
+}
+
+// add records a valid share and sends the coin once there are t+1.
+func (c *ThresholdCoin) add(share ThresholdCoinShare) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inWindow(share.Round) != nil {
+		return // Pruned while the proof was checked
+	}
+	rs := c.round(share.Round)
+	if rs.shares == nil {
+		return
+	}
+	rs.shares[share.Sender] = share.Value
+	if len(rs.shares) <= c.key.T {
+		return
+	}
+	rs.out <- thresholdCoinBit(share.Round, combineSignature(rs.shares))
+	close(rs.out)
+	rs.shares = nil
+}
+
+// sign returns the signature share of this node for round.
+func (c *ThresholdCoin) sign(round int) (ThresholdCoinShare, error) {
+	h := hashToGroup(round)
+	value := new(big.Int).Exp(h, c.key.Share, thresholdP)
+
+	// Chaum-Pedersen: commit to w, answer the challenge with w + c*x
+	w, err := rand.Int(c.rand, thresholdQ)
+	if err != nil {
+		return ThresholdCoinShare{}, err
+	}
+	a := new(big.Int).Exp(thresholdG, w, thresholdP)
+	b := new(big.Int).Exp(h, w, thresholdP)
+	ch := thresholdChallenge(round, c.key.ID, c.key.Verification[c.key.ID-1], h, value, a, b)
+	z := new(big.Int).Mul(ch, c.key.Share)
+	z.Add(z, w).Mod(z, thresholdQ)
+	return ThresholdCoinShare{Round: round, Sender: c.key.ID, Value: value, C: ch, Z: z}, nil
+}
+
+// verify checks that share is a signature share of its sender, made with
+// the key share of its verification key.
+func (c *ThresholdCoin) verify(share ThresholdCoinShare) error {
+	if !validNodeID(share.Sender, c.key.N) {
+		return fmt.Errorf("sender %d out of range", share.Sender)
+	}
+	if !inThresholdGroup(share.Value) {
+		return fmt.Errorf("share of %d is not in the group", share.Sender)
+	}
+	if share.C == nil || share.Z == nil || share.C.Sign() < 0 || share.C.Cmp(thresholdQ) >= 0 ||
+		share.Z.Sign() < 0 || share.Z.Cmp(thresholdQ) >= 0 {
+		return fmt.Errorf("malformed proof of %d", share.Sender)
+	}
+
+	// a = g^z / vk^c and b = h^z / value^c must hash to c
+	h := hashToGroup(share.Round)
+	vk := c.key.Verification[share.Sender-1]
+	a := divExp(thresholdG, share.Z, vk, share.C)
+	b := divExp(h, share.Z, share.Value, share.C)
+	if thresholdChallenge(share.Round, share.Sender, vk, h, share.Value, a, b).Cmp(share.C) != 0 {
+		return fmt.Errorf("invalid proof of %d for round %d", share.Sender, share.Round)
+	}
+	return nil
+}
+
+// divExp returns x^e / y^f mod p.
+func divExp(x, e, y, f *big.Int) *big.Int {
+	num := new(big.Int).Exp(x, e, thresholdP)
+	den := new(big.Int).Exp(y, f, thresholdP)
+	den.ModInverse(den, thresholdP)
+	return num.Mul(num, den).Mod(num, thresholdP)
+}
+
+// inThresholdGroup reports whether v is an element of the subgroup of
+// squares other than 1.
+func inThresholdGroup(v *big.Int) bool {
+	return v != nil && v.Cmp(big.NewInt(1)) > 0 && v.Cmp(thresholdP) < 0 && big.Jacobi(v, thresholdP) == 1
+}
+
+// combineSignature interpolates the signature H(r)^x in the exponent from
+// t+1 signature shares.
+func combineSignature(shares map[int]*big.Int) *big.Int {
+	sig := big.NewInt(1)
+	for j, value := range shares {
+		// Lagrange coefficient of j at 0: prod over m != j of m / (m - j)
+		num, den := big.NewInt(1), big.NewInt(1)
+		for m := range shares {
+			if m == j {
+				continue
+			}
+			num.Mul(num, big.NewInt(int64(m)))
+			den.Mul(den, big.NewInt(int64(m-j)))
+		}
+		den.Mod(den, thresholdQ)
+		lambda := num.Mul(num, den.ModInverse(den, thresholdQ))
+		lambda.Mod(lambda, thresholdQ)
+		sig.Mul(sig, new(big.Int).Exp(value, lambda, thresholdP)).Mod(sig, thresholdP)
+	}
+	return sig
+}
+
+// hashToGroup maps a round to an element of the subgroup of squares whose
+// discrete logarithm nobody knows.
+func hashToGroup(round int) *big.Int {
+	// Expand the hash well past the size of p so the result is close to
+	// uniform
+	var expanded []byte
+	for i := 0; len(expanded) < thresholdP.BitLen()/8+16; i++ {
+		block := sha256.Sum256(thresholdInput("hash-to-group", int64(round), int64(i)))
+		expanded = append(expanded, block[:]...)
+	}
+	h := new(big.Int).SetBytes(expanded)
+	h.Mod(h, thresholdP)
+	return h.Exp(h, big.NewInt(2), thresholdP)
+}
+
+// thresholdChallenge is the Fiat-Shamir challenge of a Chaum-Pedersen proof.
+func thresholdChallenge(round, sender int, vk, h, value, a, b *big.Int) *big.Int {
+	data := thresholdInput("challenge", int64(round), int64(sender))
+	for _, v := range []*big.Int{thresholdG, vk, h, value, a, b} {
+		data = append(data, v.FillBytes(make([]byte, (thresholdP.BitLen()+7)/8))...)
+	}
+	hash := sha256.Sum256(data)
+	return new(big.Int).Mod(new(big.Int).SetBytes(hash[:]), thresholdQ)
+}
+
+// thresholdCoinBit returns the coin of round given its signature.
+func thresholdCoinBit(round int, sig *big.Int) int {
+	data := thresholdInput("coin", int64(round))
+	data = append(data, sig.FillBytes(make([]byte, (thresholdP.BitLen()+7)/8))...)
+	hash := sha256.Sum256(data)
+	return int(hash[0] & 1)
+}
+
+// thresholdInput encodes the domain, a purpose and integers unambiguously.
+func thresholdInput(purpose string, ints ...int64) []byte {
+	data := append([]byte(thresholdCoinDomain+"/"+purpose), 0)
+	for _, v := range ints {
+		data = binary.BigEndian.AppendUint64(data, uint64(v))
+	}
+	return data
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrPeerIdentity is returned by a TLS handshake whose peer certificate
+// belongs to another node than the one dialed.
+var ErrPeerIdentity = errors.New("peer certificate belongs to another node")
+
+// CertificateProvider supplies the TLS certificate of a node and the CAs the
+// certificates of its peers must chain to. Both are asked for on every
+// handshake, so a provider may rotate them.
+type CertificateProvider interface {
+	Certificate() (*tls.Certificate, error)
+	CAs() (*x509.CertPool, error)
+}
+
+// StaticCertificates is a CertificateProvider with a fixed certificate and
+// CA pool.
+type StaticCertificates struct {
+	Cert tls.Certificate
+	Pool *x509.CertPool
+}
+
+func (s *StaticCertificates) Certificate() (*tls.Certificate, error) {
+	return &s.Cert, nil
+}
+
+func (s *StaticCertificates) CAs() (*x509.CertPool, error) {
+	return s.Pool, nil
+}
+
+// LoadCertificates reads a PEM certificate, its private key and the PEM CAs
+// that signed the certificates of all nodes.
+func LoadCertificates(certFile, keyFile, caFile string) (*StaticCertificates, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return &StaticCertificates{Cert: cert, Pool: pool}, nil
+}
+
+// PeerIdentity returns the node ID a verified peer certificate was issued
+// to.
+type PeerIdentity func(cert *x509.Certificate) (int, error)
+
+// IdentityFromCommonName reads the node ID from the common name of the
+// certificate, which must be prefix followed by the ID, e.g. "node-3" for
+// prefix "node-".
+func IdentityFromCommonName(prefix string) PeerIdentity {
+	return func(cert *x509.Certificate) (int, error) {
+		cn := cert.Subject.CommonName
+		id, err := strconv.Atoi(strings.TrimPrefix(cn, prefix))
+		if !strings.HasPrefix(cn, prefix) || err != nil || id < 1 {
+			return 0, fmt.Errorf("common name %q is not %q followed by a node ID", cn, prefix)
+		}
+		return id, nil
+	}
+}
+
+// mutualTLS authenticates both ends of a connection with certificates of the
+// provider's CAs and binds each peer to the node ID of its certificate.
+// Peers are verified by node ID instead of host name, so addresses in the
+// peer table need not appear in the certificates.
+type mutualTLS struct {
+	provider CertificateProvider
+	identity PeerIdentity
+}
+
+// serverConfig accepts peers with a valid client certificate.
+func (m *mutualTLS) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return m.provider.Certificate()
+		},
+		ClientAuth: tls.RequireAnyClientCert,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, err := m.verify(cs, x509.ExtKeyUsageClientAuth)
+			return err
+		},
+	}
+}
+
+// clientConfig accepts only the certificate of node expected.
+func (m *mutualTLS) clientConfig(expected int) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return m.provider.Certificate()
+		},
+		InsecureSkipVerify: true, // Checked by VerifyConnection against the node ID instead of the host name
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			id, err := m.verify(cs, x509.ExtKeyUsageServerAuth)
+			if err == nil && id != expected {
+				err = fmt.Errorf("%w: dialed node %d, got node %d", ErrPeerIdentity, expected, id)
+			}
+			return err
+		},
+	}
+}
+
+// verify checks the peer certificate chain of cs against the CAs and
+// returns the node ID of the peer.
+func (m *mutualTLS) verify(cs tls.ConnectionState, usage x509.ExtKeyUsage) (int, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return 0, errors.New("peer sent no certificate")
+	}
+	roots, err := m.provider.CAs()
+	if err != nil {
+		return 0, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := cs.PeerCertificates[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}); err != nil {
+		return 0, err
+	}
+	return m.identity(leaf)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Topology is the connectivity graph of a Network when it is not complete:
+// a node reaches another directly only over one of Links, and itself
+// always. Without Forward, messages to nodes it has no link to are lost;
+// with Forward, the nodes in between relay them over the fewest links,
+// each hop taking the latency of its own link. Node IDs are never 0 here.
+//
+// The protocols assume every pair of honest nodes is connected, so they
+// only keep their guarantees on a topology that is complete or forwards
+// over honest nodes.
+type Topology struct {
+	Links   map[Link]bool
+	Forward bool
+}
+
+// Connect adds the links between a and b in both directions.
+func (t *Topology) Connect(a, b int) {
+	if t.Links == nil {
+		t.Links = make(map[Link]bool)
+	}
+	t.Links[Link{From: a, To: b}] = true
+	t.Links[Link{From: b, To: a}] = true
+}
+
+// RingTopology connects each of nodes 1..n to the k nodes on either side of
+// it on a ring.
+func RingTopology(n, k int) Topology {
+	var t Topology
+	for id := 1; id <= n; id++ {
+		for d := 1; d <= k; d++ {
+			if other := (id-1+d)%n + 1; other != id {
+				t.Connect(id, other)
+			}
+		}
+	}
+	return t
+}
+
+// RandomTopology connects each pair of nodes 1..n with probability p, drawn
+// from seed.
+func RandomTopology(n int, p float64, seed int64) Topology {
+	t := Topology{Links: make(map[Link]bool)}
+	rng := rand.New(rand.NewSource(seed))
+	for a := 1; a <= n; a++ {
+		for b := a + 1; b <= n; b++ {
+			if rng.Float64() < p {
+				t.Connect(a, b)
+			}
+		}
+	}
+	return t
+}
+
+// ParseTopology returns the topology of n nodes described by spec:
+// "complete", "ring:K" or "random:P[:SEED]".
+func ParseTopology(spec string, n int) (Topology, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "complete":
+		return RandomTopology(n, 1, 0), nil
+	case "ring":
+		k, err := strconv.Atoi(arg)
+		if err != nil || k < 1 {
+			return Topology{}, fmt.Errorf("invalid ring degree %q in topology %q", arg, spec)
+		}
+		return RingTopology(n, k), nil
+	case "random":
+		prob, seedArg, hasSeed := strings.Cut(arg, ":")
+		p, err := strconv.ParseFloat(prob, 64)
+		if err != nil || p < 0 || p > 1 {
+			return Topology{}, fmt.Errorf("invalid link probability %q in topology %q", prob, spec)
+		}
+		seed := int64(1)
+		if hasSeed {
+			if seed, err = strconv.ParseInt(seedArg, 10, 64); err != nil {
+				return Topology{}, fmt.Errorf("invalid seed %q in topology %q", seedArg, spec)
+			}
+		}
+		return RandomTopology(n, p, seed), nil
+	default:
+		return Topology{}, fmt.Errorf("unknown topology %q (want complete, ring:K or random:P[:SEED])", spec)
+	}
+}
+
+// linkTopology routes the deliveries of a Network over a Topology.
+type linkTopology struct {
+	model       Topology
+	neighbors   map[int][]int
+	routes      map[int]map[int][]int // Shortest path from -> to, excluding from
+	unreachable atomic.Uint64
+	mu          sync.Mutex
+}
+
+func newLinkTopology(model Topology) *linkTopology {
+	neighbors := make(map[int][]int)
+	for link, ok := range model.Links {
+		if ok {
+			neighbors[link.From] = append(neighbors[link.From], link.To)
+		}
+	}
+	// Break ties between shortest paths the same way every run
+	for _, ids := range neighbors {
+		slices.Sort(ids)
+	}
+	return &linkTopology{
+		model:     model,
+		neighbors: neighbors,
+		routes:    make(map[int]map[int][]int),
+	}
+}
+
+// path returns the nodes a message from -> to passes after leaving from,
+// ending with to, or nil if it cannot get there. Messages of unknown
+// senders (0) go directly.
+func (l *linkTopology) path(from, to int) []int {
+	if from == 0 || from == to || l.model.Links[Link{From: from, To: to}] {
+		return []int{to}
+	}
+	if !l.model.Forward {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	routes, ok := l.routes[from]
+	if !ok {
+		routes = l.shortestPaths(from)
+		l.routes[from] = routes
+	}
+	return routes[to]
+}
+
+// shortestPaths searches the graph breadth first from from.
+func (l *linkTopology) shortestPaths(from int) map[int][]int {
+	routes := map[int][]int{from: nil}
+	queue := []int{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range l.neighbors[id] {
+			if _, seen := routes[next]; seen {
+				continue
+			}
+			routes[next] = append(slices.Clone(routes[id]), next)
+			queue = append(queue, next)
+		}
+	}
+	return routes
+}
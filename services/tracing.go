@@ -0,0 +1,191 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TracedMessage carries a message with its causal IDs. Nodes run behind a
+// TracingNode exchange TracedMessages instead of plain messages.
+type TracedMessage[TMsg any] struct {
+	ID     string `json:"id"`               // "<node>-<seq>", unique within a run
+	Parent string `json:"parent,omitempty"` // Message the sender was handling, empty for local calls
+	Trace  string `json:"trace"`            // ID of the first message of the causal chain
+	Msg    TMsg   `json:"msg"`
+}
+
+// TracedSender reads the sender of a traced message with senderOf, e.g.
+// for Network.SetSenderOf.
+func TracedSender[TMsg any](senderOf func(TMsg) (int, bool)) func(TracedMessage[TMsg]) (int, bool) {
+	return func(tm TracedMessage[TMsg]) (int, bool) {
+		return senderOf(tm.Msg)
+	}
+}
+
+// TracingNode wraps a service so that every message it sends gets an ID,
+// the ID of the message that caused it and the trace it belongs to, and
+// records every send and delivery in a TraceRecorder. Like AdversarialNode
+// it is itself a Service; run it in a ServiceManager on a network of
+// TracedMessages.
+type TracingNode[TMsg any, TRes any] struct {
+	id       int
+	inner    Service[TMsg, TRes]
+	recorder *TraceRecorder
+	classify func(TMsg) MessageInfo
+	seq      atomic.Uint64
+}
+
+// NewTracingNode traces the messages of inner running as node id, described
+// with classify (e.g. ClassifyABAMessage) in recorder, which all nodes of a
+// run share.
+func NewTracingNode[TMsg any, TRes any](id int, inner Service[TMsg, TRes], recorder *TraceRecorder, classify func(TMsg) MessageInfo) *TracingNode[TMsg, TRes] {
+	return &TracingNode[TMsg, TRes]{
+		id:       id,
+		inner:    inner,
+		recorder: recorder,
+		classify: classify,
+	}
+}
+
+// Inner returns the wrapped service.
+func (t *TracingNode[TMsg, TRes]) Inner() Service[TMsg, TRes] {
+	return t.inner
+}
+
+// WrapContext returns a context for calls into the wrapped service made
+// outside OnMessage (e.g. Start). Messages sent through it start new traces.
+func (t *TracingNode[TMsg, TRes]) WrapContext(ctx ServiceContext[TracedMessage[TMsg], TRes]) ServiceContext[TMsg, TRes] {
+	return &tracingContext[TMsg, TRes]{node: t, ctx: ctx}
+}
+
+func (t *TracingNode[TMsg, TRes]) OnMessage(tm TracedMessage[TMsg], ctx ServiceContext[TracedMessage[TMsg], TRes]) {
+	t.recorder.delivered(tm.ID, t.id)
+	t.inner.OnMessage(tm.Msg, &tracingContext[TMsg, TRes]{node: t, ctx: ctx, parent: tm.ID, trace: tm.Trace})
+}
+
+// trace wraps msg sent to to (0 for everyone) as a child of parent.
+func (t *TracingNode[TMsg, TRes]) trace(msg TMsg, to int, parent, trace string) TracedMessage[TMsg] {
+	id := fmt.Sprintf("%d-%d", t.id, t.seq.Add(1))
+	if trace == "" {
+		trace = id
+	}
+	var info MessageInfo
+	if t.classify != nil {
+		info = t.classify(msg)
+	}
+	t.recorder.sent(TraceMessage{
+		ID:     id,
+		Parent: parent,
+		Trace:  trace,
+		From:   t.id,
+		To:     to,
+		Layer:  info.Layer,
+		Type:   info.Type,
+		Round:  info.Round,
+		SentAt: time.Now(),
+	})
+	return TracedMessage[TMsg]{ID: id, Parent: parent, Trace: trace, Msg: msg}
+}
+
+// tracingContext traces what the wrapped service sends while handling the
+// message parent, or outside OnMessage if parent is empty.
+type tracingContext[TMsg any, TRes any] struct {
+	node   *TracingNode[TMsg, TRes]
+	ctx    ServiceContext[TracedMessage[TMsg], TRes]
+	parent string
+	trace  string
+}
+
+func (c *tracingContext[TMsg, TRes]) Broadcast(msg TMsg) {
+	c.ctx.Broadcast(c.node.trace(msg, 0, c.parent, c.trace))
+}
+
+func (c *tracingContext[TMsg, TRes]) SendTo(to int, msg TMsg) {
+	c.ctx.SendTo(to, c.node.trace(msg, to, c.parent, c.trace))
+}
+
+func (c *tracingContext[TMsg, TRes]) SendResult(res TRes) {
+	c.ctx.SendResult(res)
+}
+
+// TraceMessage is one message in the causal graph of a run.
+type TraceMessage struct {
+	ID          string    `json:"id"`
+	Parent      string    `json:"parent,omitempty"`
+	Trace       string    `json:"trace"`
+	From        int       `json:"from"`
+	To          int       `json:"to,omitempty"` // 0 for a broadcast
+	Layer       string    `json:"layer"`
+	Type        string    `json:"type"`
+	Round       int       `json:"round,omitempty"`
+	SentAt      time.Time `json:"sent_at"`
+	DeliveredTo []int     `json:"delivered_to"` // Nodes that handled it, in order
+}
+
+// TraceRecorder collects the messages of the TracingNodes of a run into a
+// causal graph: each message points to its parent, and lists the nodes it
+// was delivered to. Messages sent but never delivered to a node point to
+// where a stalled run got stuck.
+type TraceRecorder struct {
+	messages []*TraceMessage
+	byID     map[string]*TraceMessage
+	mu       sync.Mutex
+}
+
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{byID: make(map[string]*TraceMessage)}
+}
+
+func (r *TraceRecorder) sent(m TraceMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m.DeliveredTo = []int{}
+	r.messages = append(r.messages, &m)
+	r.byID[m.ID] = &m
+}
+
+func (r *TraceRecorder) delivered(id string, node int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.byID[id]; ok {
+		m.DeliveredTo = append(m.DeliveredTo, node)
+	}
+}
+
+// Messages returns a copy of the recorded messages in the order they were
+// sent.
+func (r *TraceRecorder) Messages() []TraceMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := make([]TraceMessage, len(r.messages))
+	for i, m := range r.messages {
+		messages[i] = *m
+		messages[i].DeliveredTo = slices.Clone(m.DeliveredTo)
+	}
+	return messages
+}
+
+// Children returns the messages sent while handling message id.
+func (r *TraceRecorder) Children(id string) []TraceMessage {
+	var children []TraceMessage
+	for _, m := range r.Messages() {
+		if m.Parent == id {
+			children = append(children, m)
+		}
+	}
+	return children
+}
+
+// WriteJSON writes the causal graph as indented JSON.
+func (r *TraceRecorder) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Messages []TraceMessage `json:"messages"`
+	}{r.Messages()})
+}
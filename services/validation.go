@@ -0,0 +1,84 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"fmt"
+	"sort"
+)
+
+// Validation of fields received from the network. Payloads are parsed from
+// values any process can A-Cast, so everything the protocol later indexes,
+// iterates or evaluates is checked against the cluster size first.
+
+// payloadValidator returns an A-Cast validator accepting the values that
+// parse reads and whose Validate accepts for a cluster of n nodes, so
+// malformed payloads are never echoed.
+func payloadValidator[P interface{ Validate(n int) error }](parse func(string) (P, error), n int) func(string) bool {
+	return func(val string) bool {
+		p, err := parse(val)
+		return err == nil && p.Validate(n) == nil
+	}
+}
+
+// newValidatingAcast creates the A-Cast service of a layer whose payloads
+// parse reads.
+func newValidatingAcast[P interface{ Validate(n int) error }](nc *NodeContext, parse func(string) (P, error)) *AcastService[string] {
+	acast := NewAcastServiceWithContext[string](nc)
+	acast.SetValidator(payloadValidator(parse, nc.N))
+	return acast
+}
+
+func validBit(bit int) bool {
+	return bit == 0 || bit == 1
+}
+
+func validNodeID(id, n int) bool {
+	return id >= 1 && id <= n
+}
+
+// validateNodeSet checks that set holds at most n distinct node IDs.
+func validateNodeSet(set []int, n int) error {
+	if len(set) > n {
+		return fmt.Errorf("set of %d nodes in a cluster of %d", len(set), n)
+	}
+	seen := make(map[int]bool, len(set))
+	for _, id := range set {
+		if !validNodeID(id, n) {
+			return fmt.Errorf("node %d out of range", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate node %d", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// validateSortedNodeSet checks that set holds at most n distinct node IDs
+// in increasing order.
+func validateSortedNodeSet(set []int, n int) error {
+	if err := validateNodeSet(set, n); err != nil {
+		return err
+	}
+	if !sort.IntsAreSorted(set) {
+		return fmt.Errorf("set %v is not sorted", set)
+	}
+	return nil
+}
+
+// validatePolynomial checks that p has between 1 and n coefficients, all of
+// them field elements. Honest shares have degree t < n.
+func validatePolynomial(p *utils.Polynomial, n int) error {
+	if p == nil {
+		return fmt.Errorf("missing polynomial")
+	}
+	if len(p.Coeffs) == 0 || len(p.Coeffs) > n {
+		return fmt.Errorf("polynomial with %d coefficients", len(p.Coeffs))
+	}
+	for i, c := range p.Coeffs {
+		if c == nil || c.Sign() < 0 || c.Cmp(utils.Prime) >= 0 {
+			return fmt.Errorf("coefficient %d is not a field element", i)
+		}
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"async-agreement-protocol-3/utils"
 	"encoding/json"
+	"fmt"
 	"sort"
 	"sync"
 
@@ -22,9 +24,9 @@ const (
 type VotePayload struct {
 	Type   VotePayloadType
 	Sender int
-	Bit    int   // 0 or 1
-	Set    []int // A_i or B_i
-	Round  int   // Added Round to payload
+	Bit    int           // 0 or 1
+	Set    utils.NodeSet // A_i or B_i
+	Round  int           // Added Round to payload
 }
 
 func (p VotePayload) String() string {
@@ -41,6 +43,26 @@ func ParseVotePayload(s string) (*VotePayload, error) {
 	return &p, nil
 }
 
+// Validate checks that the payload is well-formed for a cluster of n nodes.
+func (p *VotePayload) Validate(n int) error {
+	if p.Type < Vote_Input || p.Type > Vote_Revote {
+		return fmt.Errorf("unknown Vote payload type %d", p.Type)
+	}
+	if !validNodeID(p.Sender, n) {
+		return fmt.Errorf("sender %d out of range", p.Sender)
+	}
+	if !validBit(p.Bit) {
+		return fmt.Errorf("bit %d is not 0 or 1", p.Bit)
+	}
+	if p.Round < 0 {
+		return fmt.Errorf("negative round %d", p.Round)
+	}
+	if err := validateNodeSet(p.Set, n); err != nil {
+		return fmt.Errorf("invalid set: %w", err)
+	}
+	return nil
+}
+
 // VoteMsgType distinguishes between direct messages and A-Cast wrapper messages
 type VoteMsgType int
 
@@ -65,6 +87,7 @@ type voteRoundState struct {
 	round int
 
 	// Phase 1
+	sentInput      bool
 	receivedInputs map[int]int // sender -> bit
 	myA            []int
 	sentVote1      bool
@@ -102,12 +125,32 @@ func newVoteRoundState(round int) *voteRoundState {
 	}
 }
 
+// phase names the abstract state of the round for conformance checking.
+func (state *voteRoundState) phase() string {
+	switch {
+	case state.finished:
+		return "FINISHED"
+	case state.sentRevote:
+		return "REVOTE_SENT"
+	case state.sentVote1:
+		return "VOTE1_SENT"
+	case state.sentInput:
+		return "INPUT_SENT"
+	default:
+		return "INIT"
+	}
+}
+
 // VoteService implements the Vote protocol
 type VoteService struct {
-	id     int
-	n      int
-	t      int
-	logger zerolog.Logger
+	id      int
+	n       int
+	t       int
+	logger  zerolog.Logger
+	cp      *CertificationProtocol
+	metrics *Metrics
+	hook    TransitionHook
+	nonce   func() int64
 
 	acast *AcastService[string]
 
@@ -117,23 +160,41 @@ type VoteService struct {
 }
 
 func NewVoteService(id, n, t int, logLevel zerolog.Level) *VoteService {
+	return NewVoteServiceWithCertification(id, n, t, nil, logLevel)
+}
+
+// NewVoteServiceWithCertification creates a VoteService that leaves processes
+// the CertificationProtocol has certified as faulty out of its own sets.
+func NewVoteServiceWithCertification(id, n, t int, cp *CertificationProtocol, logLevel zerolog.Level) *VoteService {
+	return NewVoteServiceWithContext(newNodeContextFor(id, n, t, cp, logLevel))
+}
+
+// NewVoteServiceWithContext creates a VoteService using the shared state of a node.
+func NewVoteServiceWithContext(nc *NodeContext) *VoteService {
 	logger := log.With().
 		Str("layer", "Vote").
-		Int("node_id", id).
+		Int("node_id", nc.ID).
 		Logger().
-		Level(logLevel)
+		Level(nc.LogLevel)
 
 	return &VoteService{
-		id:     id,
-		n:      n,
-		t:      t,
-		logger: logger,
-		rounds: make(map[int]*voteRoundState),
-		acast:  NewAcastService[string](id, n, t, logLevel),
+		id:      nc.ID,
+		n:       nc.N,
+		t:       nc.T,
+		logger:  logger,
+		cp:      nc.CP,
+		metrics: nc.Metrics,
+		hook:    nc.Transitions,
+		nonce:   nc.nonce,
+		rounds:  make(map[int]*voteRoundState),
+		acast:   newValidatingAcast(nc, ParseVotePayload),
 	}
 }
 
 func (s *VoteService) StartRound(round int, inputBit int, ctx ServiceContext[VoteMessage, VoteResult]) {
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -145,6 +206,9 @@ func (s *VoteService) StartRound(round int, inputBit int, ctx ServiceContext[Vot
 	}
 
 	// Faza 1: A-Cast "INPUT: (i, x_i)"
+	from := state.phase()
+	state.sentInput = true
+	s.transition(state, "SEND_INPUT", from, map[string]int{"bit": inputBit})
 	payload := VotePayload{
 		Type:   Vote_Input,
 		Sender: s.id,
@@ -165,10 +229,18 @@ func (s *VoteService) getRoundState(round int) *voteRoundState {
 }
 
 func (s *VoteService) OnMessage(msg VoteMessage, ctx ServiceContext[VoteMessage, VoteResult]) {
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if msg.Type == Vote_ACast && msg.ACastMsg != nil {
+		if err := checkVoteOrigin(msg.ACastMsg); err != nil {
+			s.logger.Warn().Int("from", msg.ACastMsg.From).Err(err).Msg("Invalid Vote payload, ignoring")
+			s.metrics.Inc("vote.foreign_payloads")
+			return
+		}
 		adapter := &voteAcastAdapter{
 			vote: s,
 			ctx:  ctx,
@@ -183,11 +255,19 @@ type voteAcastAdapter struct {
 	ctx  ServiceContext[VoteMessage, VoteResult]
 }
 
-func (a *voteAcastAdapter) Broadcast(msg ACastMessage[string]) {
-	a.ctx.Broadcast(VoteMessage{
+func (a *voteAcastAdapter) wrap(msg ACastMessage[string]) VoteMessage {
+	return VoteMessage{
 		Type:     Vote_ACast,
 		ACastMsg: &msg,
-	})
+	}
+}
+
+func (a *voteAcastAdapter) Broadcast(msg ACastMessage[string]) {
+	a.ctx.Broadcast(a.wrap(msg))
+}
+
+func (a *voteAcastAdapter) SendTo(to int, msg ACastMessage[string]) {
+	a.ctx.SendTo(to, a.wrap(msg))
 }
 
 func (a *voteAcastAdapter) SendResult(res string) {
@@ -211,24 +291,81 @@ func (s *VoteService) processDeliveredPayload(p *VotePayload, ctx ServiceContext
 
 	sender := p.Sender
 
+	// Record payloads of certified-faulty senders as well: other nodes may
+	// have counted them before certifying, and their sets must still check
+	// out here. checkProgress leaves them out of this node's own counts.
+	if s.delivered(state, p) {
+		s.logger.Warn().Int("from", sender).Int("round", p.Round).Int("type", int(p.Type)).Msg("Duplicate Vote payload, ignoring")
+		s.metrics.Inc("vote.duplicate_payloads")
+		return
+	}
+
 	switch p.Type {
 	case Vote_Input:
 		state.receivedInputs[sender] = p.Bit
+		s.transition(state, "RECV_INPUT", state.phase(), map[string]int{"inputs": len(state.receivedInputs)})
 	case Vote_Vote1:
 		state.receivedVote1[sender] = struct {
 			Set []int
 			Bit int
 		}{Set: p.Set, Bit: p.Bit}
+		s.transition(state, "RECV_VOTE1", state.phase(), map[string]int{"vote1": len(state.receivedVote1)})
 	case Vote_Revote:
 		state.receivedRevote[sender] = struct {
 			Set []int
 			Bit int
 		}{Set: p.Set, Bit: p.Bit}
+		s.transition(state, "RECV_REVOTE", state.phase(), map[string]int{"revote": len(state.receivedRevote)})
 	}
 
 	s.checkProgress(state, ctx)
 }
 
+// delivered reports whether a payload of the type of p was delivered from
+// its sender in its round before. Only the first counts: a faulty node may
+// A-Cast several, and correct nodes may deliver them in different orders,
+// but each of them then sticks to the payload it took.
+func (s *VoteService) delivered(state *voteRoundState, p *VotePayload) bool {
+	var ok bool
+	switch p.Type {
+	case Vote_Input:
+		_, ok = state.receivedInputs[p.Sender]
+	case Vote_Vote1:
+		_, ok = state.receivedVote1[p.Sender]
+	case Vote_Revote:
+		_, ok = state.receivedRevote[p.Sender]
+	}
+	return ok
+}
+
+// checkVoteOrigin returns an error if the MSG of a Vote A-Cast carries the
+// payload of a node other than its sender. Correct nodes echo only the MSGs
+// that pass, so a delivered payload is bound to the node that started its
+// A-Cast. Unparsable values are left to the validator.
+func checkVoteOrigin(msg *ACastMessage[string]) error {
+	if msg.Type != MSG && msg.Type != SIGNED_MSG {
+		return nil
+	}
+	var p struct{ Sender int }
+	if err := json.Unmarshal([]byte(msg.Val), &p); err != nil || p.Sender == msg.From {
+		return nil
+	}
+	return fmt.Errorf("A-Cast of the payload of node %d", p.Sender)
+}
+
+// countable returns the senders, in order, that self counts towards the
+// sets it forms: all but those it certified faulty.
+func countable(cp *CertificationProtocol, self int, senders []int) []int {
+	var live []int
+	for _, j := range senders {
+		if !cp.IsCertifiedFaulty(self, j) {
+			live = append(live, j)
+		}
+	}
+	sort.Ints(live)
+	return live
+}
+
 func (s *VoteService) checkProgress(state *voteRoundState, ctx ServiceContext[VoteMessage, VoteResult]) {
 	// Helper to get keys from receivedInputs
 	allInputs := make([]int, 0, len(state.receivedInputs))
@@ -238,14 +375,15 @@ func (s *VoteService) checkProgress(state *voteRoundState, ctx ServiceContext[Vo
 
 	// Phase 1 Check
 	if !state.sentVote1 {
-		if len(state.receivedInputs) >= s.n-s.t {
+		inputs := countable(s.cp, s.id, allInputs)
+		if len(inputs) >= s.n-s.t {
 			// Form A_i
 			var A []int
 			zeros := 0
 			ones := 0
-			for sender, bit := range state.receivedInputs {
+			for _, sender := range inputs {
 				A = append(A, sender)
-				if bit == 0 {
+				if state.receivedInputs[sender] == 0 {
 					zeros++
 				} else {
 					ones++
@@ -260,7 +398,9 @@ func (s *VoteService) checkProgress(state *voteRoundState, ctx ServiceContext[Vo
 				myVote1 = 1
 			}
 
+			from := state.phase()
 			state.sentVote1 = true
+			s.transition(state, "SEND_VOTE1", from, map[string]int{"inputs": len(inputs), "zeros": zeros, "ones": ones, "bit": myVote1})
 			s.logger.Info().Int("round", state.round).Ints("A_set", state.myA).Int("vote1", myVote1).Msg("Broadcasting VOTE1")
 
 			payload := VotePayload{
@@ -284,13 +424,14 @@ func (s *VoteService) checkProgress(state *voteRoundState, ctx ServiceContext[Vo
 	}
 
 	if state.sentVote1 && !state.sentRevote {
-		if len(validVote1s) >= s.n-s.t {
+		vote1s := countable(s.cp, s.id, validVote1s)
+		if len(vote1s) >= s.n-s.t {
 			// Form B_i
 			var B []int
 			zeros := 0
 			ones := 0
 
-			for _, sender := range validVote1s {
+			for _, sender := range vote1s {
 				B = append(B, sender)
 				data := state.receivedVote1[sender]
 				if data.Bit == 0 {
@@ -308,7 +449,9 @@ func (s *VoteService) checkProgress(state *voteRoundState, ctx ServiceContext[Vo
 				myVote2 = 1
 			}
 
+			from := state.phase()
 			state.sentRevote = true
+			s.transition(state, "SEND_REVOTE", from, map[string]int{"vote1": len(vote1s), "zeros": zeros, "ones": ones, "bit": myVote2})
 			s.logger.Info().Int("round", state.round).Ints("B_set", state.myB).Int("vote2", myVote2).Msg("Broadcasting REVOTE")
 
 			payload := VotePayload{
@@ -332,9 +475,8 @@ func (s *VoteService) checkProgress(state *voteRoundState, ctx ServiceContext[Vo
 	}
 
 	if state.sentRevote {
-		if len(validRevotes) >= s.n-s.t {
-			sort.Ints(validRevotes)
-			state.myC = validRevotes
+		if revotes := countable(s.cp, s.id, validRevotes); len(revotes) >= s.n-s.t {
+			state.myC = revotes
 
 			// Decision Logic
 
@@ -381,14 +523,29 @@ func (s *VoteService) checkProgress(state *voteRoundState, ctx ServiceContext[Vo
 }
 
 func (s *VoteService) finish(state *voteRoundState, val, conf int, ctx ServiceContext[VoteMessage, VoteResult]) {
+	from := state.phase()
 	state.finished = true
+	if s.hook != nil {
+		counts := map[string]int{"revote": len(state.myC), "value": val, "conf": conf}
+		for _, j := range state.myB {
+			counts[fmt.Sprintf("b_%d", state.receivedVote1[j].Bit)]++
+		}
+		for _, j := range state.myC {
+			counts[fmt.Sprintf("c_%d", state.receivedRevote[j].Bit)]++
+		}
+		s.transition(state, "FINISH", from, counts)
+	}
 	s.logger.Info().Int("round", state.round).Int("value", val).Int("conf", conf).Msg("Vote Finished")
 	ctx.SendResult(VoteResult{Value: val, Conf: conf, Round: state.round})
 }
 
+func (s *VoteService) transition(state *voteRoundState, action, from string, counts map[string]int) {
+	s.hook.emit(StateTransition{Node: s.id, Layer: Layer_Vote, Instance: roundInstance(state.round), Action: action, From: from, To: state.phase(), Counts: counts})
+}
+
 func (s *VoteService) startACast(payload VotePayload, ctx ServiceContext[VoteMessage, VoteResult]) {
 	val := payload.String()
-	msg := NewACastMessage(val, s.id)
+	msg := newACastMessage(val, s.id, s.nonce())
 
 	// Send MSG to all (via Broadcast)
 	ctx.Broadcast(VoteMessage{
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VoteModel is the reference model of one Vote round at one node, following
+// the three phases of the paper:
+//
+//	INIT --SEND_INPUT--> INPUT_SENT --SEND_VOTE1--> VOTE1_SENT
+//	     --SEND_REVOTE--> REVOTE_SENT --FINISH--> FINISHED
+//
+// Each phase is entered once n-t messages of the previous one were accepted,
+// with the majority bit of those messages. FINISH outputs conf 2 if the
+// VOTE1 bits in B are unanimous, conf 1 if the REVOTE bits in C are, and
+// (-1, 0) otherwise. Deliveries may arrive in any phase before FINISHED.
+func VoteModel() *TransitionModel {
+	m := &TransitionModel{
+		Layer:   Layer_Vote,
+		Initial: "INIT",
+		Rules: []TransitionRule{
+			{Action: "SEND_INPUT", From: "INIT", To: "INPUT_SENT", Guard: voteBitGuard},
+			{Action: "SEND_VOTE1", From: "INPUT_SENT", To: "VOTE1_SENT", Guard: voteMajorityGuard("inputs")},
+			{Action: "SEND_REVOTE", From: "VOTE1_SENT", To: "REVOTE_SENT", Guard: voteMajorityGuard("vote1")},
+			{Action: "FINISH", From: "REVOTE_SENT", To: "FINISHED", Guard: voteFinishGuard},
+		},
+	}
+	for _, phase := range []string{"INIT", "INPUT_SENT", "VOTE1_SENT", "REVOTE_SENT"} {
+		for _, recv := range []struct{ action, count string }{
+			{"RECV_INPUT", "inputs"},
+			{"RECV_VOTE1", "vote1"},
+			{"RECV_REVOTE", "revote"},
+		} {
+			m.Rules = append(m.Rules, TransitionRule{Action: recv.action, From: phase, To: phase, Guard: voteCountGuard(recv.count)})
+		}
+	}
+	return m
+}
+
+func voteBitGuard(n, t int, counts map[string]int) error {
+	if bit := counts["bit"]; bit != 0 && bit != 1 {
+		return fmt.Errorf("input %d is not a bit", bit)
+	}
+	return nil
+}
+
+// voteCountGuard checks that a received-message count names at most n senders.
+func voteCountGuard(name string) func(n, t int, counts map[string]int) error {
+	return func(n, t int, counts map[string]int) error {
+		if c := counts[name]; c < 1 || c > n {
+			return fmt.Errorf("%d %s messages in a cluster of %d", c, name, n)
+		}
+		return nil
+	}
+}
+
+// voteMajorityGuard checks a phase was entered on a quorum of the previous
+// phase's messages, counted in name, with their majority bit (ties give 0).
+func voteMajorityGuard(name string) func(n, t int, counts map[string]int) error {
+	return func(n, t int, counts map[string]int) error {
+		quorum, zeros, ones := counts[name], counts["zeros"], counts["ones"]
+		if quorum < n-t || quorum > n {
+			return fmt.Errorf("sent on %d %s messages, quorum is %d", quorum, name, n-t)
+		}
+		if zeros+ones != quorum {
+			return fmt.Errorf("%d zeros and %d ones do not add up to %d %s messages", zeros, ones, quorum, name)
+		}
+		majority := 0
+		if ones > zeros {
+			majority = 1
+		}
+		if counts["bit"] != majority {
+			return fmt.Errorf("sent bit %d, majority of %d zeros and %d ones is %d", counts["bit"], zeros, ones, majority)
+		}
+		return nil
+	}
+}
+
+// unanimousBit returns the only bit among the counts named prefix_<bit>, or
+// false if there are several or none.
+func unanimousBit(counts map[string]int, prefix string) (int, bool) {
+	bit, found := 0, 0
+	for name, c := range counts {
+		var b int
+		if !strings.HasPrefix(name, prefix) || c == 0 {
+			continue
+		}
+		if _, err := fmt.Sscanf(name, prefix+"%d", &b); err != nil {
+			continue
+		}
+		bit = b
+		found++
+	}
+	return bit, found == 1
+}
+
+func voteFinishGuard(n, t int, counts map[string]int) error {
+	if r := counts["revote"]; r < n-t || r > n {
+		return fmt.Errorf("finished on %d REVOTE messages, quorum is %d", r, n-t)
+	}
+	value, conf := counts["value"], counts["conf"]
+	wantValue, wantConf := -1, 0
+	if bit, ok := unanimousBit(counts, "b_"); ok {
+		wantValue, wantConf = bit, 2
+	} else if bit, ok := unanimousBit(counts, "c_"); ok {
+		wantValue, wantConf = bit, 1
+	}
+	if value != wantValue || conf != wantConf {
+		return fmt.Errorf("output (%d, conf %d), expected (%d, conf %d)", value, conf, wantValue, wantConf)
+	}
+	return nil
+}
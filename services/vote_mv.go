@@ -0,0 +1,369 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Layer_VoteMV is the layer of the state transitions of VoteServiceMV. Its
+// messages are Vote messages, but VoteModel only checks binary rounds.
+const Layer_VoteMV = "VOTE_MV"
+
+// VotePayloadMV is the payload of VoteServiceMV, VotePayload with a value
+// in place of the bit.
+type VotePayloadMV[V comparable] struct {
+	Type   VotePayloadType
+	Sender int
+	Value  V
+	Set    utils.NodeSet // A_i or B_i
+	Round  int
+}
+
+func (p VotePayloadMV[V]) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+func ParseVotePayloadMV[V comparable](s string) (*VotePayloadMV[V], error) {
+	var p VotePayloadMV[V]
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks that the payload is well-formed for a cluster of n nodes.
+func (p *VotePayloadMV[V]) Validate(n int) error {
+	if p.Type < Vote_Input || p.Type > Vote_Revote {
+		return fmt.Errorf("unknown Vote payload type %d", p.Type)
+	}
+	if !validNodeID(p.Sender, n) {
+		return fmt.Errorf("sender %d out of range", p.Sender)
+	}
+	if p.Round < 0 {
+		return fmt.Errorf("negative round %d", p.Round)
+	}
+	if err := validateNodeSet(p.Set, n); err != nil {
+		return fmt.Errorf("invalid set: %w", err)
+	}
+	return nil
+}
+
+// VoteResultMV is the output of VoteServiceMV. Value is the zero V when
+// Conf is 0.
+type VoteResultMV[V comparable] struct {
+	Value V
+	Conf  int // 0, 1, 2
+	Round int
+}
+
+type voteMVRoundState[V comparable] struct {
+	round int
+
+	sentInput      bool
+	receivedInputs map[int]V // sender -> input
+	myA            []int
+	sentVote1      bool
+
+	receivedVote1 map[int]voteMVSet[V]
+	myB           []int
+	sentRevote    bool
+
+	receivedRevote map[int]voteMVSet[V]
+	myC            []int
+
+	finished bool
+}
+
+type voteMVSet[V comparable] struct {
+	Set   []int
+	Value V
+}
+
+func (state *voteMVRoundState[V]) phase() string {
+	switch {
+	case state.finished:
+		return "FINISHED"
+	case state.sentRevote:
+		return "REVOTE_SENT"
+	case state.sentVote1:
+		return "VOTE1_SENT"
+	case state.sentInput:
+		return "INPUT_SENT"
+	default:
+		return "INIT"
+	}
+}
+
+// VoteServiceMV runs the Vote protocol over values of any comparable type
+// that encodes as JSON, e.g. to build multi-valued agreement on proposals
+// without encoding them bit by bit. The phases are those of VoteService,
+// with the plurality value of the n-t messages of a phase in place of the
+// majority bit; ties go to the value whose JSON encoding sorts first, so a
+// binary round votes like VoteService. A value held by more than half of
+// the n-t messages is their plurality, which is all the grades need: if a
+// correct node outputs (v, 2), every B set shares more than (n-t)/2 nodes
+// with its B, so all correct nodes revote v and output v with conf 1 or 2.
+type VoteServiceMV[V comparable] struct {
+	id      int
+	n       int
+	t       int
+	logger  zerolog.Logger
+	cp      *CertificationProtocol
+	metrics *Metrics
+	hook    TransitionHook
+	nonce   func() int64
+
+	acast *AcastService[string]
+
+	mu sync.Mutex
+
+	rounds map[int]*voteMVRoundState[V]
+}
+
+// NewVoteServiceMV creates a VoteServiceMV using the shared state of a node.
+func NewVoteServiceMV[V comparable](nc *NodeContext) *VoteServiceMV[V] {
+	logger := log.With().
+		Str("layer", "VoteMV").
+		Int("node_id", nc.ID).
+		Logger().
+		Level(nc.LogLevel)
+
+	return &VoteServiceMV[V]{
+		id:      nc.ID,
+		n:       nc.N,
+		t:       nc.T,
+		logger:  logger,
+		cp:      nc.CP,
+		metrics: nc.Metrics,
+		hook:    nc.Transitions,
+		nonce:   nc.nonce,
+		rounds:  make(map[int]*voteMVRoundState[V]),
+		acast:   newValidatingAcast(nc, ParseVotePayloadMV[V]),
+	}
+}
+
+func (s *VoteServiceMV[V]) StartRound(round int, input V, ctx ServiceContext[VoteMessage, VoteResultMV[V]]) {
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger.Info().Int("round", round).Interface("input", input).Msg("Starting Vote Protocol Round")
+
+	state := s.getRoundState(round)
+	if state.finished || state.sentInput {
+		return
+	}
+
+	from := state.phase()
+	state.sentInput = true
+	s.transition(state, "SEND_INPUT", from, nil)
+	s.startACast(VotePayloadMV[V]{Type: Vote_Input, Sender: s.id, Value: input, Round: round}, ctx)
+
+	s.checkProgress(state, ctx)
+}
+
+func (s *VoteServiceMV[V]) getRoundState(round int) *voteMVRoundState[V] {
+	if _, ok := s.rounds[round]; !ok {
+		s.rounds[round] = &voteMVRoundState[V]{
+			round:          round,
+			receivedInputs: make(map[int]V),
+			receivedVote1:  make(map[int]voteMVSet[V]),
+			receivedRevote: make(map[int]voteMVSet[V]),
+		}
+	}
+	return s.rounds[round]
+}
+
+func (s *VoteServiceMV[V]) OnMessage(msg VoteMessage, ctx ServiceContext[VoteMessage, VoteResultMV[V]]) {
+	results := newDeferredResults(ctx)
+	defer results.flush()
+	ctx = results
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg.Type == Vote_ACast && msg.ACastMsg != nil {
+		if err := checkVoteOrigin(msg.ACastMsg); err != nil {
+			s.logger.Warn().Int("from", msg.ACastMsg.From).Err(err).Msg("Invalid Vote payload, ignoring")
+			s.metrics.Inc("vote.foreign_payloads")
+			return
+		}
+		s.acast.OnMessage(*msg.ACastMsg, &voteMVAcastAdapter[V]{vote: s, ctx: ctx})
+	}
+}
+
+// voteMVAcastAdapter adapts ServiceContext[VoteMessage, VoteResultMV[V]] to ServiceContext[ACastMessage[string], string]
+type voteMVAcastAdapter[V comparable] struct {
+	vote *VoteServiceMV[V]
+	ctx  ServiceContext[VoteMessage, VoteResultMV[V]]
+}
+
+func (a *voteMVAcastAdapter[V]) Broadcast(msg ACastMessage[string]) {
+	a.ctx.Broadcast(VoteMessage{Type: Vote_ACast, ACastMsg: &msg})
+}
+
+func (a *voteMVAcastAdapter[V]) SendTo(to int, msg ACastMessage[string]) {
+	a.ctx.SendTo(to, VoteMessage{Type: Vote_ACast, ACastMsg: &msg})
+}
+
+func (a *voteMVAcastAdapter[V]) SendResult(res string) {
+	payload, err := ParseVotePayloadMV[V](res)
+	if err != nil {
+		a.vote.logger.Error().Err(err).Msg("Failed to parse Vote payload")
+		return
+	}
+	a.vote.processDeliveredPayload(payload, a.ctx)
+}
+
+func (s *VoteServiceMV[V]) processDeliveredPayload(p *VotePayloadMV[V], ctx ServiceContext[VoteMessage, VoteResultMV[V]]) {
+	// Assumes s.mu is locked
+	state := s.getRoundState(p.Round)
+	if state.finished {
+		return
+	}
+
+	sender := p.Sender
+	// Payloads of certified-faulty senders are recorded too, see
+	// VoteService.processDeliveredPayload
+
+	if s.delivered(state, p) {
+		s.logger.Warn().Int("from", sender).Int("round", p.Round).Int("type", int(p.Type)).Msg("Duplicate Vote payload, ignoring")
+		s.metrics.Inc("vote.duplicate_payloads")
+		return
+	}
+
+	switch p.Type {
+	case Vote_Input:
+		state.receivedInputs[sender] = p.Value
+		s.transition(state, "RECV_INPUT", state.phase(), map[string]int{"inputs": len(state.receivedInputs)})
+	case Vote_Vote1:
+		state.receivedVote1[sender] = voteMVSet[V]{Set: p.Set, Value: p.Value}
+		s.transition(state, "RECV_VOTE1", state.phase(), map[string]int{"vote1": len(state.receivedVote1)})
+	case Vote_Revote:
+		state.receivedRevote[sender] = voteMVSet[V]{Set: p.Set, Value: p.Value}
+		s.transition(state, "RECV_REVOTE", state.phase(), map[string]int{"revote": len(state.receivedRevote)})
+	}
+
+	s.checkProgress(state, ctx)
+}
+
+// delivered reports whether a payload of the type of p was delivered from
+// its sender in its round before, see VoteService.delivered.
+func (s *VoteServiceMV[V]) delivered(state *voteMVRoundState[V], p *VotePayloadMV[V]) bool {
+	var ok bool
+	switch p.Type {
+	case Vote_Input:
+		_, ok = state.receivedInputs[p.Sender]
+	case Vote_Vote1:
+		_, ok = state.receivedVote1[p.Sender]
+	case Vote_Revote:
+		_, ok = state.receivedRevote[p.Sender]
+	}
+	return ok
+}
+
+func (s *VoteServiceMV[V]) checkProgress(state *voteMVRoundState[V], ctx ServiceContext[VoteMessage, VoteResultMV[V]]) {
+	allInputs := make([]int, 0, len(state.receivedInputs))
+	for sender := range state.receivedInputs {
+		allInputs = append(allInputs, sender)
+	}
+	sort.Ints(allInputs)
+
+	// Phase 1: A_i is the senders of n-t inputs, VOTE1 their plurality
+	if inputs := countable(s.cp, s.id, allInputs); state.sentInput && !state.sentVote1 && len(inputs) >= s.n-s.t {
+		state.myA = inputs
+		vote, count := plurality(inputs, func(j int) V { return state.receivedInputs[j] })
+
+		from := state.phase()
+		state.sentVote1 = true
+		s.transition(state, "SEND_VOTE1", from, map[string]int{"inputs": len(inputs), "plurality": count})
+		s.startACast(VotePayloadMV[V]{Type: Vote_Vote1, Sender: s.id, Value: vote, Set: state.myA, Round: state.round}, ctx)
+	}
+
+	// Phase 2: B_i is the senders of n-t VOTE1s whose A_j we saw
+	var validVote1s []int
+	for sender, data := range state.receivedVote1 {
+		if isSubset(data.Set, allInputs) {
+			validVote1s = append(validVote1s, sender)
+		}
+	}
+	sort.Ints(validVote1s)
+
+	if vote1s := countable(s.cp, s.id, validVote1s); state.sentVote1 && !state.sentRevote && len(vote1s) >= s.n-s.t {
+		state.myB = vote1s
+		revote, count := plurality(vote1s, func(j int) V { return state.receivedVote1[j].Value })
+
+		from := state.phase()
+		state.sentRevote = true
+		s.transition(state, "SEND_REVOTE", from, map[string]int{"vote1": len(vote1s), "plurality": count})
+		s.startACast(VotePayloadMV[V]{Type: Vote_Revote, Sender: s.id, Value: revote, Set: state.myB, Round: state.round}, ctx)
+	}
+
+	// Phase 3: C_i is the senders of n-t REVOTEs whose B_j we saw
+	var validRevotes []int
+	for sender, data := range state.receivedRevote {
+		if isSubset(data.Set, validVote1s) {
+			validRevotes = append(validRevotes, sender)
+		}
+	}
+	sort.Ints(validRevotes)
+
+	revotes := countable(s.cp, s.id, validRevotes)
+	if !state.sentRevote || len(revotes) < s.n-s.t {
+		return
+	}
+	state.myC = revotes
+	if v, count := plurality(state.myB, func(j int) V { return state.receivedVote1[j].Value }); count == len(state.myB) {
+		s.finish(state, v, 2, ctx)
+	} else if v, count := plurality(state.myC, func(j int) V { return state.receivedRevote[j].Value }); count == len(state.myC) {
+		s.finish(state, v, 1, ctx)
+	} else {
+		var null V
+		s.finish(state, null, 0, ctx)
+	}
+}
+
+// plurality returns the most frequent value of the nodes, and how many of
+// them hold it. Ties go to the value whose JSON encoding sorts first.
+func plurality[V comparable](nodes []int, value func(j int) V) (V, int) {
+	counts := make(map[V]int)
+	for _, j := range nodes {
+		counts[value(j)]++
+	}
+	var best V
+	var bestKey string
+	bestCount := 0
+	for v, count := range counts {
+		key, _ := json.Marshal(v)
+		if count > bestCount || count == bestCount && string(key) < bestKey {
+			best, bestKey, bestCount = v, string(key), count
+		}
+	}
+	return best, bestCount
+}
+
+func (s *VoteServiceMV[V]) finish(state *voteMVRoundState[V], val V, conf int, ctx ServiceContext[VoteMessage, VoteResultMV[V]]) {
+	from := state.phase()
+	state.finished = true
+	s.transition(state, "FINISH", from, map[string]int{"revote": len(state.myC), "conf": conf})
+	s.logger.Info().Int("round", state.round).Interface("value", val).Int("conf", conf).Msg("Vote Finished")
+	ctx.SendResult(VoteResultMV[V]{Value: val, Conf: conf, Round: state.round})
+}
+
+func (s *VoteServiceMV[V]) transition(state *voteMVRoundState[V], action, from string, counts map[string]int) {
+	s.hook.emit(StateTransition{Node: s.id, Layer: Layer_VoteMV, Instance: roundInstance(state.round), Action: action, From: from, To: state.phase(), Counts: counts})
+}
+
+func (s *VoteServiceMV[V]) startACast(payload VotePayloadMV[V], ctx ServiceContext[VoteMessage, VoteResultMV[V]]) {
+	msg := newACastMessage(payload.String(), s.id, s.nonce())
+	ctx.Broadcast(VoteMessage{Type: Vote_ACast, ACastMsg: &msg})
+	s.acast.OnMessage(msg, &voteMVAcastAdapter[V]{vote: s, ctx: ctx})
+}
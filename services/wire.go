@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// WireFormat selects how ABA messages are serialized by a transport.
+type WireFormat int
+
+const (
+	Wire_JSON  WireFormat = iota // encoding/json, payloads as nested JSON strings
+	Wire_Proto                   // protobuf schema in wire/messages.proto
+	Wire_CBOR                    // CBOR with integer keys and bignums
+)
+
+func (f WireFormat) String() string {
+	switch f {
+	case Wire_JSON:
+		return "json"
+	case Wire_Proto:
+		return "proto"
+	case Wire_CBOR:
+		return "cbor"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseWireFormat returns the format with the given name.
+func ParseWireFormat(name string) (WireFormat, error) {
+	for _, f := range []WireFormat{Wire_JSON, Wire_Proto, Wire_CBOR} {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown wire format %q", name)
+}
+
+// EncodeABAMessage serializes msg in the given format.
+func EncodeABAMessage(format WireFormat, msg ABAMessage) ([]byte, error) {
+	switch format {
+	case Wire_JSON:
+		return json.Marshal(msg)
+	case Wire_Proto:
+		return MarshalABAMessageProto(msg)
+	case Wire_CBOR:
+		return MarshalABAMessageCBOR(msg)
+	default:
+		return nil, fmt.Errorf("unknown wire format %d", format)
+	}
+}
+
+// DecodeABAMessage parses data produced by EncodeABAMessage with the same format.
+func DecodeABAMessage(format WireFormat, data []byte) (ABAMessage, error) {
+	switch format {
+	case Wire_JSON:
+		var msg ABAMessage
+		err := json.Unmarshal(data, &msg)
+		return msg, err
+	case Wire_Proto:
+		return UnmarshalABAMessageProto(data)
+	case Wire_CBOR:
+		return UnmarshalABAMessageCBOR(data)
+	default:
+		return ABAMessage{}, fmt.Errorf("unknown wire format %d", format)
+	}
+}
+
+// payloadLayer tells the wire converters which payload type an A-Cast value
+// carries. It is implied by where the A-Cast message sits in the ABA tree.
+type payloadLayer int
+
+const (
+	layer_Raw payloadLayer = iota
+	layer_Vote
+	layer_ICC
+	layer_IVSS
+	layer_Complete
+)
+
+// parseLayerValue returns the payload encoded in an A-Cast value, or nil if
+// the value is not exactly what the payload's String() would produce. Only
+// such values can be sent structured: the receiver re-renders them with
+// String(), and A-Cast instances are matched on the value.
+// Binary encodings do not tell empty slices from nil ones, so empty slices
+// are normalized to nil before the comparison.
+func parseLayerValue(val string, layer payloadLayer) any {
+	switch layer {
+	case layer_Vote:
+		if p, err := ParseVotePayload(val); err == nil {
+			p.Set = nilIfEmpty(p.Set)
+			if p.String() == val {
+				return p
+			}
+		}
+	case layer_ICC:
+		if p, err := ParseICCPayload(val); err == nil && p.String() == val {
+			return p
+		}
+	case layer_IVSS:
+		if p, err := ParseIVSSPayload(val); err == nil {
+			if p.RevealPoly != nil && len(p.RevealPoly.Coeffs) == 0 {
+				p.RevealPoly.Coeffs = nil
+			}
+			if p.String() == val {
+				return p
+			}
+		}
+	case layer_Complete:
+		if p, err := ParseCompletePayload(val); err == nil && p.String() == val {
+			return p
+		}
+	}
+	return nil
+}
+
+func nilIfEmpty(s []int) []int {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
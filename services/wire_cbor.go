@@ -0,0 +1,368 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBOR mirrors of the message tree. Keys are small integers and layer
+// payloads are embedded as CBOR structures (big.Ints as bignums) instead of
+// JSON strings, which is where most of the size win over JSON comes from.
+
+type cborACast struct {
+	Type     MessageType      `cbor:"1,keyasint"`
+	UUID     string           `cbor:"2,keyasint"`
+	From     int              `cbor:"3,keyasint"`
+	Raw      *string          `cbor:"4,keyasint,omitempty"`
+	Vote     *cborVotePayload `cbor:"5,keyasint,omitempty"`
+	ICC      *cborICCPayload  `cbor:"6,keyasint,omitempty"`
+	IVSS     *cborIVSSPayload `cbor:"7,keyasint,omitempty"`
+	Complete *CompletePayload `cbor:"8,keyasint,omitempty"`
+	Digest   string           `cbor:"9,keyasint,omitempty"`
+	Tag      string           `cbor:"10,keyasint,omitempty"`
+	Sig      []byte           `cbor:"11,keyasint,omitempty"`
+	Cert     ACastCertificate `cbor:"12,keyasint,omitempty"`
+}
+
+type cborVotePayload struct {
+	Type   VotePayloadType `cbor:"1,keyasint"`
+	Sender int             `cbor:"2,keyasint"`
+	Bit    int             `cbor:"3,keyasint"`
+	Set    []int           `cbor:"4,keyasint,omitempty"`
+	Round  int             `cbor:"5,keyasint"`
+}
+
+type cborICCPayload struct {
+	Type   ICCPayloadType `cbor:"1,keyasint"`
+	SetT   []int          `cbor:"2,keyasint,omitempty"`
+	SetA   []int          `cbor:"3,keyasint,omitempty"`
+	SetH   []int          `cbor:"4,keyasint,omitempty"`
+	SetS   []int          `cbor:"5,keyasint,omitempty"`
+	Sender int            `cbor:"6,keyasint,omitempty"`
+}
+
+type cborIVSSPayload struct {
+	InstanceID   string          `cbor:"1,keyasint"`
+	Type         IVSSPayloadType `cbor:"2,keyasint"`
+	EqualPair    [2]int          `cbor:"3,keyasint"`
+	MSet         []int           `cbor:"4,keyasint,omitempty"`
+	RevealPoly   []*big.Int      `cbor:"5,keyasint,omitempty"` // Array form, still decoded
+	HasPoly      bool            `cbor:"6,keyasint,omitempty"`
+	RevealSender int             `cbor:"7,keyasint,omitempty"`
+	PackedPoly   []byte          `cbor:"8,keyasint,omitempty"` // utils.Polynomial.MarshalBinary
+	Commitment   []*big.Int      `cbor:"9,keyasint,omitempty"`
+	Secrets      int             `cbor:"10,keyasint,omitempty"`
+	Blame        *cborIVSSBlame  `cbor:"11,keyasint,omitempty"`
+}
+
+type cborIVSSBlame struct {
+	Kind           IVSSBlameKind `cbor:"1,keyasint"`
+	InstanceID     string        `cbor:"2,keyasint,omitempty"`
+	Dealer         int           `cbor:"3,keyasint,omitempty"`
+	Accuser        int           `cbor:"4,keyasint,omitempty"`
+	Share          []*big.Int    `cbor:"5,keyasint,omitempty"`
+	PackedShare    []byte        `cbor:"6,keyasint,omitempty"` // utils.Polynomial.MarshalBinary
+	HasShare       bool          `cbor:"7,keyasint,omitempty"`
+	ShareSignature []byte        `cbor:"8,keyasint,omitempty"`
+	Point          *big.Int      `cbor:"9,keyasint,omitempty"`
+	PointFrom      int           `cbor:"10,keyasint,omitempty"`
+	PointSignature []byte        `cbor:"11,keyasint,omitempty"`
+	MSet           []int         `cbor:"12,keyasint,omitempty"`
+}
+
+type cborIVSSMessage struct {
+	Type       IVSSMsgType   `cbor:"1,keyasint"`
+	DirectType DirectMsgType `cbor:"2,keyasint,omitempty"`
+	To         int           `cbor:"3,keyasint,omitempty"`
+	From       int           `cbor:"4,keyasint,omitempty"`
+	InstanceID string        `cbor:"5,keyasint,omitempty"`
+	Poly       []*big.Int    `cbor:"6,keyasint,omitempty"`
+	HasPoly    bool          `cbor:"7,keyasint,omitempty"`
+	Point      *big.Int      `cbor:"8,keyasint,omitempty"`
+	PointIdx   int           `cbor:"9,keyasint,omitempty"`
+	ACast      *cborACast    `cbor:"10,keyasint,omitempty"`
+	PackedPoly []byte        `cbor:"11,keyasint,omitempty"` // utils.Polynomial.MarshalBinary
+	Sealed     []byte        `cbor:"12,keyasint,omitempty"`
+	Polys      [][]byte      `cbor:"13,keyasint,omitempty"` // utils.Polynomial.MarshalBinary of each
+	Points     []*big.Int    `cbor:"14,keyasint,omitempty"`
+	Signature  []byte        `cbor:"15,keyasint,omitempty"`
+}
+
+type cborICCMessage struct {
+	Type  ICCMsgType       `cbor:"1,keyasint"`
+	IVSS  *cborIVSSMessage `cbor:"2,keyasint,omitempty"`
+	ACast *cborACast       `cbor:"3,keyasint,omitempty"`
+}
+
+type cborVoteMessage struct {
+	Type  VoteMsgType `cbor:"1,keyasint"`
+	ACast *cborACast  `cbor:"2,keyasint,omitempty"`
+}
+
+type cborABAMessage struct {
+	Type     ABAMsgType       `cbor:"1,keyasint"`
+	Round    int              `cbor:"2,keyasint"`
+	Vote     *cborVoteMessage `cbor:"3,keyasint,omitempty"`
+	ICC      *cborICCMessage  `cbor:"4,keyasint,omitempty"`
+	Complete *cborACast       `cbor:"5,keyasint,omitempty"`
+}
+
+// MarshalABAMessageCBOR encodes msg as CBOR (RFC 8949).
+func MarshalABAMessageCBOR(msg ABAMessage) ([]byte, error) {
+	m := cborABAMessage{
+		Type:     msg.Type,
+		Round:    msg.Round,
+		Complete: acastToCBOR(msg.CompleteMsg, layer_Complete),
+	}
+	if msg.VoteMsg != nil {
+		m.Vote = &cborVoteMessage{
+			Type:  msg.VoteMsg.Type,
+			ACast: acastToCBOR(msg.VoteMsg.ACastMsg, layer_Vote),
+		}
+	}
+	if msg.ICCMsg != nil {
+		m.ICC = &cborICCMessage{
+			Type:  msg.ICCMsg.Type,
+			IVSS:  ivssMessageToCBOR(msg.ICCMsg.IVSSMsg),
+			ACast: acastToCBOR(msg.ICCMsg.ACastMsg, layer_ICC),
+		}
+	}
+	return cbor.Marshal(m)
+}
+
+// UnmarshalABAMessageCBOR decodes a message produced by MarshalABAMessageCBOR.
+func UnmarshalABAMessageCBOR(data []byte) (ABAMessage, error) {
+	var m cborABAMessage
+	if err := cbor.Unmarshal(data, &m); err != nil {
+		return ABAMessage{}, err
+	}
+	msg := ABAMessage{
+		Type:        m.Type,
+		Round:       m.Round,
+		CompleteMsg: acastFromCBOR(m.Complete),
+	}
+	if m.Vote != nil {
+		msg.VoteMsg = &VoteMessage{
+			Type:     m.Vote.Type,
+			ACastMsg: acastFromCBOR(m.Vote.ACast),
+		}
+	}
+	if m.ICC != nil {
+		msg.ICCMsg = &ICCMessage{
+			Type:     m.ICC.Type,
+			IVSSMsg:  ivssMessageFromCBOR(m.ICC.IVSS),
+			ACastMsg: acastFromCBOR(m.ICC.ACast),
+		}
+	}
+	return msg, nil
+}
+
+func ivssMessageToCBOR(msg *IVSSMessage) *cborIVSSMessage {
+	if msg == nil {
+		return nil
+	}
+	m := &cborIVSSMessage{
+		Type:       msg.Type,
+		DirectType: msg.DirectType,
+		To:         msg.To,
+		From:       msg.From,
+		InstanceID: msg.InstanceID,
+		Point:      msg.Point,
+		PointIdx:   msg.PointIdx,
+		ACast:      acastToCBOR(msg.ACastMsg, layer_IVSS),
+		Sealed:     msg.Sealed,
+		Points:     msg.Points,
+		Signature:  msg.Signature,
+	}
+	if msg.Poly != nil {
+		m.Poly, m.PackedPoly = polynomialToCBOR(msg.Poly)
+		m.HasPoly = true
+	}
+	// Coefficients that are not field elements are left out, which
+	// validation rejects anyway
+	for _, p := range msg.Polys {
+		var packed []byte
+		if p != nil {
+			packed, _ = p.MarshalBinary()
+		}
+		m.Polys = append(m.Polys, packed)
+	}
+	return m
+}
+
+func ivssMessageFromCBOR(m *cborIVSSMessage) *IVSSMessage {
+	if m == nil {
+		return nil
+	}
+	msg := &IVSSMessage{
+		Type:       m.Type,
+		DirectType: m.DirectType,
+		To:         m.To,
+		From:       m.From,
+		InstanceID: m.InstanceID,
+		Point:      m.Point,
+		PointIdx:   m.PointIdx,
+		ACastMsg:   acastFromCBOR(m.ACast),
+		Sealed:     m.Sealed,
+		Points:     m.Points,
+		Signature:  m.Signature,
+	}
+	if m.HasPoly {
+		msg.Poly = polynomialFromCBOR(m.Poly, m.PackedPoly)
+	}
+	for _, packed := range m.Polys {
+		msg.Polys = append(msg.Polys, polynomialFromCBOR(nil, packed))
+	}
+	return msg
+}
+
+func acastToCBOR(msg *ACastMessage[string], layer payloadLayer) *cborACast {
+	if msg == nil {
+		return nil
+	}
+	m := &cborACast{
+		Type:   msg.Type,
+		UUID:   msg.UUID,
+		From:   msg.From,
+		Digest: msg.Digest,
+		Tag:    msg.Tag,
+		Sig:    msg.Sig,
+		Cert:   msg.Cert,
+	}
+	switch p := parseLayerValue(msg.Val, layer).(type) {
+	case *VotePayload:
+		m.Vote = &cborVotePayload{Type: p.Type, Sender: p.Sender, Bit: p.Bit, Set: p.Set, Round: p.Round}
+	case *ICCPayload:
+		m.ICC = &cborICCPayload{Type: p.Type, SetT: p.SetT, SetA: p.SetA, SetH: p.SetH, SetS: p.SetS, Sender: p.Sender}
+	case *IVSSPayload:
+		m.IVSS = &cborIVSSPayload{
+			InstanceID:   p.InstanceID,
+			Type:         p.Type,
+			EqualPair:    p.EqualPair,
+			MSet:         p.MSet,
+			RevealSender: p.RevealSender,
+			Commitment:   p.Commitment,
+			Secrets:      p.Secrets,
+			Blame:        blameToCBOR(p.Blame),
+		}
+		if p.RevealPoly != nil {
+			m.IVSS.RevealPoly, m.IVSS.PackedPoly = polynomialToCBOR(p.RevealPoly)
+			m.IVSS.HasPoly = true
+		}
+	case *CompletePayload:
+		m.Complete = p
+	default:
+		m.Raw = &msg.Val
+	}
+	return m
+}
+
+func acastFromCBOR(m *cborACast) *ACastMessage[string] {
+	if m == nil {
+		return nil
+	}
+	msg := &ACastMessage[string]{
+		Type:   m.Type,
+		UUID:   m.UUID,
+		From:   m.From,
+		Digest: m.Digest,
+		Tag:    m.Tag,
+		Sig:    m.Sig,
+		Cert:   m.Cert,
+	}
+	switch {
+	case m.Raw != nil:
+		msg.Val = *m.Raw
+	case m.Vote != nil:
+		msg.Val = VotePayload{Type: m.Vote.Type, Sender: m.Vote.Sender, Bit: m.Vote.Bit, Set: m.Vote.Set, Round: m.Vote.Round}.String()
+	case m.ICC != nil:
+		msg.Val = ICCPayload{Type: m.ICC.Type, SetT: m.ICC.SetT, SetA: m.ICC.SetA, SetH: m.ICC.SetH, SetS: m.ICC.SetS, Sender: m.ICC.Sender}.String()
+	case m.IVSS != nil:
+		p := IVSSPayload{
+			InstanceID:   m.IVSS.InstanceID,
+			Type:         m.IVSS.Type,
+			EqualPair:    m.IVSS.EqualPair,
+			MSet:         m.IVSS.MSet,
+			RevealSender: m.IVSS.RevealSender,
+			Commitment:   m.IVSS.Commitment,
+			Secrets:      m.IVSS.Secrets,
+			Blame:        blameFromCBOR(m.IVSS.Blame),
+		}
+		if m.IVSS.HasPoly {
+			p.RevealPoly = polynomialFromCBOR(m.IVSS.RevealPoly, m.IVSS.PackedPoly)
+		}
+		msg.Val = p.String()
+	case m.Complete != nil:
+		msg.Val = m.Complete.String()
+	}
+	return msg
+}
+
+func blameToCBOR(b *IVSSBlame) *cborIVSSBlame {
+	if b == nil {
+		return nil
+	}
+	m := &cborIVSSBlame{
+		Kind:           b.Kind,
+		InstanceID:     b.InstanceID,
+		Dealer:         b.Dealer,
+		Accuser:        b.Accuser,
+		ShareSignature: b.ShareSignature,
+		Point:          b.Point,
+		PointFrom:      b.PointFrom,
+		PointSignature: b.PointSignature,
+		MSet:           b.MSet,
+	}
+	if b.Share != nil {
+		m.Share, m.PackedShare = polynomialToCBOR(b.Share)
+		m.HasShare = true
+	}
+	return m
+}
+
+func blameFromCBOR(m *cborIVSSBlame) *IVSSBlame {
+	if m == nil {
+		return nil
+	}
+	b := &IVSSBlame{
+		Kind:           m.Kind,
+		InstanceID:     m.InstanceID,
+		Dealer:         m.Dealer,
+		Accuser:        m.Accuser,
+		ShareSignature: m.ShareSignature,
+		Point:          m.Point,
+		PointFrom:      m.PointFrom,
+		PointSignature: m.PointSignature,
+		MSet:           m.MSet,
+	}
+	if m.HasShare {
+		b.Share = polynomialFromCBOR(m.Share, m.PackedShare)
+	}
+	return b
+}
+
+// polynomialToCBOR packs the coefficients of p with MarshalBinary, or
+// returns them as they are if they are not field elements.
+func polynomialToCBOR(p *utils.Polynomial) ([]*big.Int, []byte) {
+	packed, err := p.MarshalBinary()
+	if err != nil {
+		return p.Coeffs, nil
+	}
+	return nil, packed
+}
+
+// polynomialFromCBOR decodes a polynomial in the packed or the array form.
+// Packed coefficients that do not divide into field elements decode to a
+// polynomial without coefficients, which validation rejects.
+func polynomialFromCBOR(coeffs []*big.Int, packed []byte) *utils.Polynomial {
+	if packed == nil {
+		return &utils.Polynomial{Coeffs: coeffs}
+	}
+	p := &utils.Polynomial{}
+	if err := p.UnmarshalBinary(packed); err != nil {
+		p.Coeffs = nil
+	}
+	return p
+}
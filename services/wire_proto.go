@@ -0,0 +1,480 @@
+package services
+
+import (
+	"async-agreement-protocol-3/utils"
+	"async-agreement-protocol-3/wire"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// MarshalABAMessageProto encodes msg using the protobuf wire schema.
+// Layer payloads are sent as structured messages instead of JSON strings.
+func MarshalABAMessageProto(msg ABAMessage) ([]byte, error) {
+	pb, err := abaMessageToProto(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(pb)
+}
+
+// UnmarshalABAMessageProto decodes a message produced by MarshalABAMessageProto.
+func UnmarshalABAMessageProto(data []byte) (ABAMessage, error) {
+	var pb wire.ABAMessage
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return ABAMessage{}, err
+	}
+	return abaMessageFromProto(&pb)
+}
+
+func abaMessageToProto(msg ABAMessage) (*wire.ABAMessage, error) {
+	pb := &wire.ABAMessage{
+		Type:  int32(msg.Type),
+		Round: int64(msg.Round),
+	}
+	if msg.VoteMsg != nil {
+		pb.Vote = voteMessageToProto(msg.VoteMsg)
+	}
+	if msg.ICCMsg != nil {
+		icc, err := iccMessageToProto(msg.ICCMsg)
+		if err != nil {
+			return nil, err
+		}
+		pb.Icc = icc
+	}
+	pb.Complete = acastToProto(msg.CompleteMsg, layer_Complete)
+	return pb, nil
+}
+
+func abaMessageFromProto(pb *wire.ABAMessage) (ABAMessage, error) {
+	msg := ABAMessage{
+		Type:        ABAMsgType(pb.GetType()),
+		Round:       int(pb.GetRound()),
+		CompleteMsg: acastFromProto(pb.GetComplete()),
+	}
+	if pb.GetVote() != nil {
+		msg.VoteMsg = voteMessageFromProto(pb.GetVote())
+	}
+	if pb.GetIcc() != nil {
+		icc, err := iccMessageFromProto(pb.GetIcc())
+		if err != nil {
+			return ABAMessage{}, err
+		}
+		msg.ICCMsg = icc
+	}
+	return msg, nil
+}
+
+// marshalProto encodes msg with to and the protobuf wire schema, for the
+// codecs of the single layers.
+func marshalProto[TMsg any, TPb proto.Message](msg TMsg, to func(*TMsg) (TPb, error)) ([]byte, error) {
+	pb, err := to(&msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(pb)
+}
+
+// unmarshalProto decodes data into pb and converts it with from.
+func unmarshalProto[TMsg any, TPb proto.Message](data []byte, pb TPb, from func(TPb) (*TMsg, error)) (TMsg, error) {
+	var zero TMsg
+	if err := proto.Unmarshal(data, pb); err != nil {
+		return zero, err
+	}
+	msg, err := from(pb)
+	if err != nil {
+		return zero, err
+	}
+	return *msg, nil
+}
+
+func voteMessageToProto(msg *VoteMessage) *wire.VoteMessage {
+	return &wire.VoteMessage{
+		Type:  int32(msg.Type),
+		Acast: acastToProto(msg.ACastMsg, layer_Vote),
+	}
+}
+
+func voteMessageFromProto(pb *wire.VoteMessage) *VoteMessage {
+	return &VoteMessage{
+		Type:     VoteMsgType(pb.GetType()),
+		ACastMsg: acastFromProto(pb.GetAcast()),
+	}
+}
+
+func iccMessageToProto(msg *ICCMessage) (*wire.ICCMessage, error) {
+	pb := &wire.ICCMessage{
+		Type:  int32(msg.Type),
+		Acast: acastToProto(msg.ACastMsg, layer_ICC),
+	}
+	if msg.IVSSMsg != nil {
+		ivss, err := ivssMessageToProto(msg.IVSSMsg)
+		if err != nil {
+			return nil, err
+		}
+		pb.Ivss = ivss
+	}
+	return pb, nil
+}
+
+func iccMessageFromProto(pb *wire.ICCMessage) (*ICCMessage, error) {
+	msg := &ICCMessage{
+		Type:     ICCMsgType(pb.GetType()),
+		ACastMsg: acastFromProto(pb.GetAcast()),
+	}
+	if pb.GetIvss() != nil {
+		ivss, err := ivssMessageFromProto(pb.GetIvss())
+		if err != nil {
+			return nil, err
+		}
+		msg.IVSSMsg = ivss
+	}
+	return msg, nil
+}
+
+func ivssMessageToProto(msg *IVSSMessage) (*wire.IVSSMessage, error) {
+	poly, err := polynomialToProto(msg.Poly)
+	if err != nil {
+		return nil, err
+	}
+	pb := &wire.IVSSMessage{
+		Type:       int32(msg.Type),
+		DirectType: int32(msg.DirectType),
+		To:         int64(msg.To),
+		From:       int64(msg.From),
+		InstanceId: msg.InstanceID,
+		Poly:       poly,
+		PointIdx:   int64(msg.PointIdx),
+		Acast:      acastToProto(msg.ACastMsg, layer_IVSS),
+		Sealed:     msg.Sealed,
+		Signature:  msg.Signature,
+	}
+	if msg.Point != nil {
+		if msg.Point.Sign() < 0 {
+			return nil, fmt.Errorf("wire: negative point in instance %s", msg.InstanceID)
+		}
+		pb.Point = msg.Point.Bytes()
+		pb.HasPoint = true
+	}
+	for _, p := range msg.Polys {
+		poly, err := polynomialToProto(p)
+		if err != nil {
+			return nil, err
+		}
+		pb.Polys = append(pb.Polys, poly)
+	}
+	for _, p := range msg.Points {
+		if p == nil || p.Sign() < 0 {
+			return nil, fmt.Errorf("wire: negative point in instance %s", msg.InstanceID)
+		}
+		pb.Points = append(pb.Points, p.Bytes())
+	}
+	return pb, nil
+}
+
+func ivssMessageFromProto(pb *wire.IVSSMessage) (*IVSSMessage, error) {
+	msg := &IVSSMessage{
+		Type:       IVSSMsgType(pb.GetType()),
+		DirectType: DirectMsgType(pb.GetDirectType()),
+		To:         int(pb.GetTo()),
+		From:       int(pb.GetFrom()),
+		InstanceID: pb.GetInstanceId(),
+		Poly:       polynomialFromProto(pb.GetPoly()),
+		PointIdx:   int(pb.GetPointIdx()),
+		ACastMsg:   acastFromProto(pb.GetAcast()),
+		Sealed:     pb.GetSealed(),
+		Signature:  pb.GetSignature(),
+	}
+	if pb.GetHasPoint() {
+		msg.Point = new(big.Int).SetBytes(pb.GetPoint())
+	}
+	for _, p := range pb.GetPolys() {
+		msg.Polys = append(msg.Polys, polynomialFromProto(p))
+	}
+	for _, p := range pb.GetPoints() {
+		msg.Points = append(msg.Points, new(big.Int).SetBytes(p))
+	}
+	return msg, nil
+}
+
+// acastToProto converts an A-Cast message whose value is a payload of the
+// given layer. Values that are not canonical payloads are sent raw.
+func acastToProto(msg *ACastMessage[string], layer payloadLayer) *wire.ACastMessage {
+	if msg == nil {
+		return nil
+	}
+	pb := &wire.ACastMessage{
+		Type:   int32(msg.Type),
+		Uuid:   msg.UUID,
+		From:   int64(msg.From),
+		Digest: msg.Digest,
+		Tag:    msg.Tag,
+		Sig:    msg.Sig,
+		Cert:   acastCertToProto(msg.Cert),
+	}
+	switch p := parseLayerValue(msg.Val, layer).(type) {
+	case *VotePayload:
+		pb.Val = &wire.ACastMessage_Vote{Vote: votePayloadToProto(p)}
+	case *ICCPayload:
+		pb.Val = &wire.ACastMessage_Icc{Icc: iccPayloadToProto(p)}
+	case *IVSSPayload:
+		if ivss, err := ivssPayloadToProto(p); err == nil {
+			pb.Val = &wire.ACastMessage_Ivss{Ivss: ivss}
+		}
+	case *CompletePayload:
+		pb.Val = &wire.ACastMessage_Complete{Complete: &wire.CompletePayload{
+			Sender: int64(p.Sender),
+			Value:  int64(p.Value),
+		}}
+	}
+	if pb.Val == nil {
+		pb.Val = &wire.ACastMessage_Raw{Raw: msg.Val}
+	}
+	return pb
+}
+
+func acastFromProto(pb *wire.ACastMessage) *ACastMessage[string] {
+	if pb == nil {
+		return nil
+	}
+	msg := &ACastMessage[string]{
+		Type:   MessageType(pb.GetType()),
+		UUID:   pb.GetUuid(),
+		From:   int(pb.GetFrom()),
+		Digest: pb.GetDigest(),
+		Tag:    pb.GetTag(),
+		Sig:    pb.GetSig(),
+		Cert:   acastCertFromProto(pb.GetCert()),
+	}
+	switch v := pb.GetVal().(type) {
+	case *wire.ACastMessage_Raw:
+		msg.Val = v.Raw
+	case *wire.ACastMessage_Vote:
+		msg.Val = votePayloadFromProto(v.Vote).String()
+	case *wire.ACastMessage_Icc:
+		msg.Val = iccPayloadFromProto(v.Icc).String()
+	case *wire.ACastMessage_Ivss:
+		msg.Val = ivssPayloadFromProto(v.Ivss).String()
+	case *wire.ACastMessage_Complete:
+		msg.Val = CompletePayload{
+			Sender: int(v.Complete.GetSender()),
+			Value:  int(v.Complete.GetValue()),
+		}.String()
+	}
+	return msg
+}
+
+func votePayloadToProto(p *VotePayload) *wire.VotePayload {
+	return &wire.VotePayload{
+		Type:   int32(p.Type),
+		Sender: int64(p.Sender),
+		Bit:    int64(p.Bit),
+		Set:    intsToProto(p.Set),
+		Round:  int64(p.Round),
+	}
+}
+
+func votePayloadFromProto(pb *wire.VotePayload) VotePayload {
+	return VotePayload{
+		Type:   VotePayloadType(pb.GetType()),
+		Sender: int(pb.GetSender()),
+		Bit:    int(pb.GetBit()),
+		Set:    intsFromProto(pb.GetSet()),
+		Round:  int(pb.GetRound()),
+	}
+}
+
+func iccPayloadToProto(p *ICCPayload) *wire.ICCPayload {
+	return &wire.ICCPayload{
+		Type:   int32(p.Type),
+		SetT:   intsToProto(p.SetT),
+		SetA:   intsToProto(p.SetA),
+		SetH:   intsToProto(p.SetH),
+		SetS:   intsToProto(p.SetS),
+		Sender: int64(p.Sender),
+	}
+}
+
+func iccPayloadFromProto(pb *wire.ICCPayload) ICCPayload {
+	return ICCPayload{
+		Type:   ICCPayloadType(pb.GetType()),
+		SetT:   intsFromProto(pb.GetSetT()),
+		SetA:   intsFromProto(pb.GetSetA()),
+		SetH:   intsFromProto(pb.GetSetH()),
+		SetS:   intsFromProto(pb.GetSetS()),
+		Sender: int(pb.GetSender()),
+	}
+}
+
+func ivssPayloadToProto(p *IVSSPayload) (*wire.IVSSPayload, error) {
+	poly, err := polynomialToProto(p.RevealPoly)
+	if err != nil {
+		return nil, err
+	}
+	var commitment [][]byte
+	for k, c := range p.Commitment {
+		if c == nil || c.Sign() < 0 {
+			return nil, fmt.Errorf("wire: commitment value %d is not a group element", k)
+		}
+		commitment = append(commitment, c.Bytes())
+	}
+	blame, err := blameToProto(p.Blame)
+	if err != nil {
+		return nil, err
+	}
+	return &wire.IVSSPayload{
+		InstanceId:   p.InstanceID,
+		Type:         int32(p.Type),
+		EqualI:       int64(p.EqualPair[0]),
+		EqualJ:       int64(p.EqualPair[1]),
+		MSet:         intsToProto(p.MSet),
+		RevealPoly:   poly,
+		RevealSender: int64(p.RevealSender),
+		Commitment:   commitment,
+		Secrets:      int64(p.Secrets),
+		Blame:        blame,
+	}, nil
+}
+
+func ivssPayloadFromProto(pb *wire.IVSSPayload) IVSSPayload {
+	var commitment []*big.Int
+	for _, c := range pb.GetCommitment() {
+		commitment = append(commitment, new(big.Int).SetBytes(c))
+	}
+	return IVSSPayload{
+		InstanceID:   pb.GetInstanceId(),
+		Type:         IVSSPayloadType(pb.GetType()),
+		EqualPair:    [2]int{int(pb.GetEqualI()), int(pb.GetEqualJ())},
+		MSet:         intsFromProto(pb.GetMSet()),
+		RevealPoly:   polynomialFromProto(pb.GetRevealPoly()),
+		RevealSender: int(pb.GetRevealSender()),
+		Commitment:   commitment,
+		Secrets:      int(pb.GetSecrets()),
+		Blame:        blameFromProto(pb.GetBlame()),
+	}
+}
+
+func blameToProto(b *IVSSBlame) (*wire.IVSSBlame, error) {
+	if b == nil {
+		return nil, nil
+	}
+	share, err := polynomialToProto(b.Share)
+	if err != nil {
+		return nil, err
+	}
+	pb := &wire.IVSSBlame{
+		Kind:           int32(b.Kind),
+		InstanceId:     b.InstanceID,
+		Dealer:         int64(b.Dealer),
+		Accuser:        int64(b.Accuser),
+		Share:          share,
+		ShareSignature: b.ShareSignature,
+		PointFrom:      int64(b.PointFrom),
+		PointSignature: b.PointSignature,
+		MSet:           intsToProto(b.MSet),
+	}
+	if b.Point != nil {
+		if b.Point.Sign() < 0 {
+			return nil, fmt.Errorf("wire: negative point in blame of %s", b.InstanceID)
+		}
+		pb.Point = b.Point.Bytes()
+		pb.HasPoint = true
+	}
+	return pb, nil
+}
+
+func blameFromProto(pb *wire.IVSSBlame) *IVSSBlame {
+	if pb == nil {
+		return nil
+	}
+	b := &IVSSBlame{
+		Kind:           IVSSBlameKind(pb.GetKind()),
+		InstanceID:     pb.GetInstanceId(),
+		Dealer:         int(pb.GetDealer()),
+		Accuser:        int(pb.GetAccuser()),
+		Share:          polynomialFromProto(pb.GetShare()),
+		ShareSignature: pb.GetShareSignature(),
+		PointFrom:      int(pb.GetPointFrom()),
+		PointSignature: pb.GetPointSignature(),
+		MSet:           intsFromProto(pb.GetMSet()),
+	}
+	if pb.GetHasPoint() {
+		b.Point = new(big.Int).SetBytes(pb.GetPoint())
+	}
+	return b
+}
+
+func polynomialToProto(p *utils.Polynomial) (*wire.Polynomial, error) {
+	if p == nil {
+		return nil, nil
+	}
+	pb := &wire.Polynomial{Coeffs: make([][]byte, len(p.Coeffs))}
+	for k, c := range p.Coeffs {
+		if c == nil || c.Sign() < 0 {
+			return nil, fmt.Errorf("wire: coefficient %d is not a field element", k)
+		}
+		pb.Coeffs[k] = c.Bytes()
+	}
+	return pb, nil
+}
+
+func polynomialFromProto(pb *wire.Polynomial) *utils.Polynomial {
+	if pb == nil {
+		return nil
+	}
+	p := &utils.Polynomial{}
+	if len(pb.GetCoeffs()) > 0 {
+		p.Coeffs = make([]*big.Int, len(pb.GetCoeffs()))
+		for k, c := range pb.GetCoeffs() {
+			p.Coeffs[k] = new(big.Int).SetBytes(c)
+		}
+	}
+	return p
+}
+
+func intsToProto(s []int) []int64 {
+	if s == nil {
+		return nil
+	}
+	out := make([]int64, len(s))
+	for k, v := range s {
+		out[k] = int64(v)
+	}
+	return out
+}
+
+func intsFromProto(s []int64) []int {
+	if len(s) == 0 {
+		return nil
+	}
+	out := make([]int, len(s))
+	for k, v := range s {
+		out[k] = int(v)
+	}
+	return out
+}
+
+// acastCertToProto encodes a certificate canonically. The proto schema
+// carries it as bytes rather than a map, so it has a single encoding.
+func acastCertToProto(cert ACastCertificate) []byte {
+	if cert == nil {
+		return nil
+	}
+	b, _ := CanonicalBytes(cert)
+	return b
+}
+
+// acastCertFromProto decodes a certificate. A malformed one decodes to nil
+// and fails verification like a missing one.
+func acastCertFromProto(b []byte) ACastCertificate {
+	if len(b) == 0 {
+		return nil
+	}
+	var cert ACastCertificate
+	if err := cbor.Unmarshal(b, &cert); err != nil {
+		return nil
+	}
+	return cert
+}
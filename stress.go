@@ -0,0 +1,462 @@
+package main
+
+import (
+	"async-agreement-protocol-3/services"
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// The stress harness runs clusters over the goroutine network, wave after
+// wave, until a deadline or an interrupt. Unlike the tests it has no time
+// limit of its own, so it can run for hours, and it checks what only shows
+// after many runs: data races (when built with -race), goroutines that
+// outlive their cluster, heap growth and safety violations.
+
+type stressConfig struct {
+	n         int
+	instances int
+	timeout   time.Duration
+}
+
+// runStress implements `aba stress`.
+func runStress(args []string) error {
+	fs := flag.NewFlagSet("stress", flag.ExitOnError)
+	duration := fs.Duration("duration", time.Minute, "Stop starting waves after this long (0 runs until -waves or an interrupt)")
+	waves := fs.Int("waves", 0, "Stop after this many waves (0 means no limit)")
+	concurrency := fs.Int("concurrency", 8, "Clusters running at the same time in each wave")
+	instances := fs.Int("instances", 50, "A-Casts and IVSS sharings run at once in each cluster, an ABA cluster runs one agreement")
+	layers := fs.String("layers", "acast,ivss,aba", "Protocol layers, assigned to the clusters of a wave in turn")
+	n := fs.Int("n", 4, "Nodes per cluster")
+	timeout := fs.Duration("timeout", 2*time.Minute, "Fail if a cluster has not finished after this long")
+	maxHeap := fs.Int("max-heap", 2048, "Fail once the live heap exceeds this many MiB")
+	leakGrace := fs.Duration("leak-grace", 5*time.Second, "Time goroutines get to exit after a wave before they count as leaked")
+	fs.Parse(args)
+
+	var layerNames []string
+	for _, name := range strings.Split(*layers, ",") {
+		layer, ok := benchLayers[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown layer %q", name)
+		}
+		layerNames = append(layerNames, layer)
+	}
+	if *n < 4 || *concurrency < 1 || *instances < 1 {
+		return fmt.Errorf("need -n >= 4, -concurrency >= 1 and -instances >= 1")
+	}
+	if !raceEnabled {
+		fmt.Fprintln(os.Stderr, "Warning: built without -race, data races go undetected (go run -race . stress)")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if *duration > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, *duration)
+		defer stop()
+	}
+
+	heap := newHeapMonitor(uint64(*maxHeap) << 20)
+	defer heap.stop()
+
+	cfg := stressConfig{n: *n, instances: *instances, timeout: *timeout}
+	baseline := runtime.NumGoroutine()
+	start := time.Now()
+	total := 0
+	for wave := 1; *waves == 0 || wave <= *waves; wave++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		errs := make([]error, *concurrency)
+		var wg sync.WaitGroup
+		for k := 0; k < *concurrency; k++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				layer := layerNames[k%len(layerNames)]
+				prefix := fmt.Sprintf("stress-%d-%d", wave, k)
+				if err := runStressCluster(layer, prefix, cfg); err != nil {
+					errs[k] = fmt.Errorf("%s cluster %d: %w", layer, k, err)
+				}
+			}(k)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return fmt.Errorf("wave %d: %w", wave, err)
+			}
+		}
+		if err := heap.err(); err != nil {
+			return fmt.Errorf("wave %d: %w", wave, err)
+		}
+		if err := checkGoroutines(baseline, *leakGrace); err != nil {
+			return fmt.Errorf("wave %d: %w", wave, err)
+		}
+
+		total += *concurrency
+		fmt.Printf("wave %d: %d clusters done in %v, peak heap %d MiB, %d goroutines\n",
+			wave, total, time.Since(start).Round(time.Second), heap.peak()>>20, runtime.NumGoroutine())
+	}
+	fmt.Printf("Stress run passed: %d clusters in %v\n", total, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// checkGoroutines waits up to grace for the goroutine count to drop back to
+// baseline and dumps the remaining goroutines if it does not.
+func checkGoroutines(baseline int, grace time.Duration) error {
+	deadline := time.Now().Add(grace)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			pprof.Lookup("goroutine").WriteTo(os.Stderr, 1)
+			return fmt.Errorf("%d goroutines leaked", runtime.NumGoroutine()-baseline)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+// heapMonitor samples the live heap in the background and records when it
+// exceeds a ceiling.
+type heapMonitor struct {
+	limit    uint64
+	max      uint64
+	exceeded error
+	done     chan struct{}
+	mu       sync.Mutex
+}
+
+func newHeapMonitor(limit uint64) *heapMonitor {
+	m := &heapMonitor{limit: limit, done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sample()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	return m
+}
+
+func (m *heapMonitor) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.max = max(m.max, stats.HeapAlloc)
+	if stats.HeapAlloc > m.limit && m.exceeded == nil {
+		m.exceeded = fmt.Errorf("heap reached %d MiB, limit is %d MiB", stats.HeapAlloc>>20, m.limit>>20)
+	}
+}
+
+func (m *heapMonitor) peak() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.max
+}
+
+func (m *heapMonitor) err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exceeded
+}
+
+func (m *heapMonitor) stop() {
+	close(m.done)
+}
+
+// stressCluster runs n services behind service managers on one network and
+// collects their results.
+type stressCluster[TMsg any, TRes any] struct {
+	network  *services.Network[TMsg]
+	managers []*services.ServiceManager[TMsg, TRes]
+	buses    []*services.EventBus
+	results  [][]TRes // Indexed by node ID
+	done     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// newStressCluster starts the given services, one per node ID from 1.
+func newStressCluster[TMsg any, TRes any](svcs []services.Service[TMsg, TRes], buses []*services.EventBus) *stressCluster[TMsg, TRes] {
+	c := &stressCluster[TMsg, TRes]{
+		network: services.NewNetwork[TMsg](),
+		buses:   buses,
+		results: make([][]TRes, len(svcs)+1),
+		done:    make(chan struct{}),
+	}
+	for i, svc := range svcs {
+		id := i + 1
+		mgr := services.NewServiceManager[TMsg, TRes](svc, c.network)
+		c.network.Register(id, mgr.Inbox())
+		c.managers = append(c.managers, mgr)
+		mgr.Start()
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for {
+				select {
+				case res := <-mgr.Result():
+					c.add(id, res)
+				case <-c.done:
+					return
+				}
+			}
+		}()
+	}
+	return c
+}
+
+func (c *stressCluster[TMsg, TRes]) add(id int, res TRes) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[id] = append(c.results[id], res)
+}
+
+// resultsOf returns a copy of the results of node id so far.
+func (c *stressCluster[TMsg, TRes]) resultsOf(id int) []TRes {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]TRes(nil), c.results[id]...)
+}
+
+// context returns the context the harness uses to call into node id from
+// outside its manager. Results produced there are collected directly, as
+// ServiceManager.SendResult may only run on the manager's goroutine.
+func (c *stressCluster[TMsg, TRes]) context(id int) services.ServiceContext[TMsg, TRes] {
+	return &stressContext[TMsg, TRes]{cluster: c, id: id}
+}
+
+// wait polls until ok holds for the results of every node.
+func (c *stressCluster[TMsg, TRes]) wait(timeout time.Duration, ok func(id int, results []TRes) bool) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := 0
+		c.mu.Lock()
+		for id := 1; id < len(c.results); id++ {
+			if !ok(id, c.results[id]) {
+				pending++
+			}
+		}
+		c.mu.Unlock()
+		if pending == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d nodes not finished after %v", pending, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stop stops the managers and drains their inboxes until the network has
+// nothing left in flight, as closing the connections of a real node would.
+func (c *stressCluster[TMsg, TRes]) stop() {
+	close(c.done)
+	for _, mgr := range c.managers {
+		mgr.Stop()
+	}
+	c.wg.Wait()
+
+	var drained sync.WaitGroup
+	for _, mgr := range c.managers {
+		drained.Add(1)
+		go func(inbox chan TMsg) {
+			defer drained.Done()
+			for {
+				select {
+				case <-inbox:
+				case <-time.After(200 * time.Millisecond):
+					return
+				}
+			}
+		}(mgr.Inbox())
+	}
+	drained.Wait()
+}
+
+type stressContext[TMsg any, TRes any] struct {
+	cluster *stressCluster[TMsg, TRes]
+	id      int
+}
+
+func (s *stressContext[TMsg, TRes]) Broadcast(msg TMsg) {
+	s.cluster.network.Broadcast(msg)
+}
+
+func (s *stressContext[TMsg, TRes]) SendTo(to int, msg TMsg) {
+	s.cluster.network.Send(to, msg)
+}
+
+func (s *stressContext[TMsg, TRes]) SendResult(res TRes) {
+	s.cluster.add(s.id, res)
+}
+
+func stressContexts(n, t int) []*services.NodeContext {
+	ncs := make([]*services.NodeContext, n)
+	for i := range ncs {
+		ncs[i] = services.NewNodeContext(i+1, n, t, zerolog.Disabled)
+	}
+	return ncs
+}
+
+func stressBuses(ncs []*services.NodeContext) []*services.EventBus {
+	buses := make([]*services.EventBus, len(ncs))
+	for i, nc := range ncs {
+		buses[i] = nc.Events
+	}
+	return buses
+}
+
+// runStressCluster runs one cluster of layer and checks the safety
+// invariants of its honest nodes on top of the results.
+func runStressCluster(layer, prefix string, cfg stressConfig) error {
+	honest := make([]int, cfg.n)
+	for i := range honest {
+		honest[i] = i + 1
+	}
+	checker := services.NewInvariantChecker(services.SafetyInvariants(honest)...)
+
+	var err error
+	switch layer {
+	case services.Layer_ACast:
+		err = stressACast(prefix, cfg, checker)
+	case services.Layer_IVSS:
+		err = stressIVSS(prefix, cfg, checker)
+	case services.Layer_ABA:
+		err = stressABA(cfg, checker)
+	default:
+		err = fmt.Errorf("no stress scenario for layer %q", layer)
+	}
+	if err != nil {
+		return err
+	}
+	return checker.Finish()
+}
+
+func stressACast(prefix string, cfg stressConfig, checker *services.InvariantChecker) error {
+	t := (cfg.n - 1) / 3
+	ncs := stressContexts(cfg.n, t)
+	svcs := make([]services.Service[services.ACastMessage[string], string], cfg.n)
+	for i, nc := range ncs {
+		svcs[i] = services.NewAcastServiceWithContext[string](nc)
+	}
+	c := newStressCluster(svcs, stressBuses(ncs))
+	cancel := checker.Subscribe(c.buses...)
+	defer cancel()
+	defer c.stop()
+
+	want := make(map[string]bool, cfg.instances)
+	for i := 0; i < cfg.instances; i++ {
+		val := fmt.Sprintf("%s-%d", prefix, i)
+		want[val] = true
+		c.network.Broadcast(services.NewACastMessage(val, 1+i%cfg.n))
+	}
+	if err := c.wait(cfg.timeout, func(id int, results []string) bool { return len(results) >= cfg.instances }); err != nil {
+		return err
+	}
+	for id := 1; id <= cfg.n; id++ {
+		for _, val := range c.resultsOf(id) {
+			if !want[val] {
+				return fmt.Errorf("node %d delivered %q, which was never broadcast", id, val)
+			}
+		}
+	}
+	return nil
+}
+
+func stressIVSS(prefix string, cfg stressConfig, checker *services.InvariantChecker) error {
+	t := (cfg.n - 1) / 3
+	ncs := stressContexts(cfg.n, t)
+	ivss := make([]*services.IVSSService, cfg.n)
+	svcs := make([]services.Service[services.IVSSMessage, services.IVSSResult], cfg.n)
+	for i, nc := range ncs {
+		ivss[i] = services.NewIVSSServiceWithContext(nc)
+		svcs[i] = ivss[i]
+	}
+	c := newStressCluster(svcs, stressBuses(ncs))
+	cancel := checker.Subscribe(c.buses...)
+	defer cancel()
+	defer c.stop()
+
+	count := func(results []services.IVSSResult, typ string) int {
+		k := 0
+		for _, res := range results {
+			if res.Type == typ {
+				k++
+			}
+		}
+		return k
+	}
+	secrets := make(map[string]int64, cfg.instances)
+	for i := 0; i < cfg.instances; i++ {
+		dealer := i % cfg.n
+		id := services.IVSSInstanceID(fmt.Sprintf("%s-%d", prefix, i), dealer+1)
+		secrets[id] = int64(i)
+		if err := ivss[dealer].StartSharing(id, big.NewInt(int64(i)), c.context(dealer+1)); err != nil {
+			return err
+		}
+	}
+	if err := c.wait(cfg.timeout, func(id int, results []services.IVSSResult) bool {
+		return count(results, "SHARING_COMPLETE") >= cfg.instances
+	}); err != nil {
+		return fmt.Errorf("sharing: %w", err)
+	}
+
+	for i, node := range ivss {
+		for id := range secrets {
+			if err := node.StartReconstruction(id, c.context(i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.wait(cfg.timeout, func(id int, results []services.IVSSResult) bool {
+		return count(results, "RECONSTRUCTED") >= cfg.instances
+	}); err != nil {
+		return fmt.Errorf("reconstruction: %w", err)
+	}
+	for id := 1; id <= cfg.n; id++ {
+		for _, res := range c.resultsOf(id) {
+			if res.Type == "RECONSTRUCTED" && (res.Secret == nil || res.Secret.Int64() != secrets[res.InstanceID]) {
+				return fmt.Errorf("node %d reconstructed %v for %s, expected %d", id, res.Secret, res.InstanceID, secrets[res.InstanceID])
+			}
+		}
+	}
+	return nil
+}
+
+func stressABA(cfg stressConfig, checker *services.InvariantChecker) error {
+	t := (cfg.n - 1) / 3
+	ncs := stressContexts(cfg.n, t)
+	abas := make([]*services.ABAService, cfg.n)
+	svcs := make([]services.Service[services.ABAMessage, int], cfg.n)
+	for i, nc := range ncs {
+		abas[i] = services.NewABAServiceWithContext(nc, (i+1)%2)
+		svcs[i] = abas[i]
+	}
+	c := newStressCluster(svcs, stressBuses(ncs))
+	cancel := checker.Subscribe(c.buses...)
+	defer cancel()
+	defer c.stop()
+
+	for i, aba := range abas {
+		aba.Start(c.context(i + 1))
+	}
+	return c.wait(cfg.timeout, func(id int, results []int) bool { return len(results) > 0 })
+}
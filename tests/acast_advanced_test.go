@@ -1,7 +1,12 @@
 package tests
 
 import (
+	"async-agreement-protocol-3/abatest"
 	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"crypto/ed25519"
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -9,31 +14,9 @@ import (
 	"github.com/rs/zerolog"
 )
 
-func setupACastAdvanced(n, f int) (*services.Network[services.ACastMessage[string]], []*services.ServiceManager[services.ACastMessage[string], string], func()) {
-	network := services.NewNetwork[services.ACastMessage[string]]()
-	managers := make([]*services.ServiceManager[services.ACastMessage[string], string], n)
-
-	for i := 0; i < n; i++ {
-		id := i + 1
-		svc := services.NewAcastService[string](id, n, f, zerolog.Disabled)
-		managers[i] = services.NewServiceManager[services.ACastMessage[string], string](svc, network)
-		network.Register(id, managers[i].Inbox())
-		managers[i].Start()
-	}
-
-	cleanup := func() {
-		for _, sm := range managers {
-			sm.Stop()
-		}
-	}
-
-	return network, managers, cleanup
-}
-
 func TestACast_LargePayload(t *testing.T) {
 	n, f := 4, 1
-	_, managers, cleanup := setupACastAdvanced(n, f)
-	defer cleanup()
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
 
 	// Create a large payload (e.g., 1MB)
 	val := strings.Repeat("A", 1024*1024)
@@ -41,30 +24,29 @@ func TestACast_LargePayload(t *testing.T) {
 	msg := services.NewACastMessage(val, senderID)
 
 	// Broadcast
-	for _, sm := range managers {
-		sm.Inbox() <- msg
+	for id := 1; id <= n; id++ {
+		c.Manager(id).Inbox() <- msg
 	}
 
 	// Verify
-	for i, sm := range managers {
+	for id := 1; id <= n; id++ {
 		select {
-		case res := <-sm.Result():
+		case res := <-c.Results(id):
 			if len(res) != len(val) {
-				t.Errorf("Node %d delivered wrong length: got %d, want %d", i+1, len(res), len(val))
+				t.Errorf("Node %d delivered wrong length: got %d, want %d", id, len(res), len(val))
 			}
 			if res != val {
-				t.Errorf("Node %d delivered wrong content", i+1)
+				t.Errorf("Node %d delivered wrong content", id)
 			}
 		case <-time.After(5 * time.Second):
-			t.Errorf("Node %d timed out waiting for result", i+1)
+			t.Errorf("Node %d timed out waiting for result", id)
 		}
 	}
 }
 
 func TestACast_MultipleBroadcasts(t *testing.T) {
 	n, f := 4, 1
-	_, managers, cleanup := setupACastAdvanced(n, f)
-	defer cleanup()
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
 
 	count := 5
 	senderID := 1
@@ -74,20 +56,712 @@ func TestACast_MultipleBroadcasts(t *testing.T) {
 		msg := services.NewACastMessage(val, senderID)
 
 		// Broadcast
-		for _, sm := range managers {
-			sm.Inbox() <- msg
+		for id := 1; id <= n; id++ {
+			c.Manager(id).Inbox() <- msg
 		}
 
 		// Verify
-		for i, sm := range managers {
+		for id := 1; id <= n; id++ {
 			select {
-			case res := <-sm.Result():
+			case res := <-c.Results(id):
 				if res != val {
-					t.Errorf("Node %d delivered wrong value in iter %d: got %v, want %v", i+1, k, res, val)
+					t.Errorf("Node %d delivered wrong value in iter %d: got %v, want %v", id, k, res, val)
 				}
 			case <-time.After(2 * time.Second):
-				t.Errorf("Node %d timed out waiting for result in iter %d", i+1, k)
+				t.Errorf("Node %d timed out waiting for result in iter %d", id, k)
+			}
+		}
+	}
+}
+
+func withACastDigests() abatest.Option {
+	return abatest.WithNodeContext(func(nc *services.NodeContext) { nc.ACastDigests = true })
+}
+
+func TestACast_DigestModeSendsValueOnce(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f), withACastDigests())
+	meter := services.NewTrafficMeter(services.JSONCodec[services.ACastMessage[string]]{}, services.ClassifyACastMessage[string])
+	c.Network.SetTrafficMeter(meter)
+
+	val := strings.Repeat("D", 64*1024)
+	c.Network.Broadcast(services.NewACastMessage(val, 1))
+	for id := 1; id <= n; id++ {
+		select {
+		case res := <-c.Results(id):
+			if res != val {
+				t.Errorf("Node %d delivered a value of length %d, want %d", id, len(res), len(val))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Node %d did not deliver", id)
+		}
+	}
+
+	// All ECHOs and READYs together are smaller than one copy of the value
+	report := meter.Report()
+	echo, ready := report.ByType["ACAST/ECHO"], report.ByType["ACAST/READY"]
+	if echo.Messages == 0 || ready.Messages == 0 || echo.Bytes+ready.Bytes >= uint64(len(val)) {
+		t.Errorf("Counted ECHO %+v and READY %+v, want only digests", echo, ready)
+	}
+}
+
+func TestACast_DigestModeFetchesMissingValue(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f), abatest.WithoutLoopback(), withACastDigests())
+	chaos := services.NewChaos(services.ClassifyACastMessage[string])
+	drop := chaos.Drop(services.MessageFilter{Type: "MSG"}).To(4)
+	c.Network.SetChaos(chaos)
+
+	val := "DigestValue"
+	c.Network.Broadcast(services.NewACastMessage(val, 1))
+	for id := 1; id <= n; id++ {
+		select {
+		case res := <-c.Results(id):
+			if res != val {
+				t.Errorf("Node %d delivered %q, want %q", id, res, val)
 			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Node %d did not deliver", id)
+		}
+	}
+	if drop.Hits() != 1 {
+		t.Errorf("Dropped %d MSGs, want 1", drop.Hits())
+	}
+}
+
+func TestACast_DigestModeRejectsWrongValue(t *testing.T) {
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+	nc.ACastDigests = true
+	svc := services.NewAcastServiceWithContext[string](nc)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	digest := services.ACastDigest("right")
+	for from := 2; from <= 4; from++ {
+		svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Digest: digest, From: from}, ctx)
+	}
+	if len(ctx.results) != 0 {
+		t.Fatalf("Delivered %v without the value", ctx.results)
+	}
+	if last := ctx.broadcasts[len(ctx.broadcasts)-1]; last.Type != services.FETCH || last.Digest != digest {
+		t.Fatalf("Sent %+v, want a FETCH of the digest", last)
+	}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.VALUE, UUID: "u", Val: "wrong", Digest: digest, From: 2}, ctx)
+	if len(ctx.results) != 0 {
+		t.Fatalf("Delivered %v, which does not match the digest", ctx.results)
+	}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.VALUE, UUID: "u", Val: "right", Digest: digest, From: 3}, ctx)
+	if len(ctx.results) != 1 || ctx.results[0] != "right" {
+		t.Fatalf("Delivered %v, want [right]", ctx.results)
+	}
+}
+
+func TestACast_DigestModeABA(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(4, 1), withACastDigests())
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+}
+
+// deliverACast makes svc deliver instance uuid with READYs from nodes 2..4.
+func deliverACast(svc *services.AcastService[string], ctx *recordingContext[services.ACastMessage[string], string], uuid string) {
+	for from := 2; from <= 4; from++ {
+		svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: uuid, Val: "v", From: from}, ctx)
+	}
+}
+
+func TestACast_PruneIgnoresLateMessages(t *testing.T) {
+	svc := services.NewAcastService[string](1, 4, 1, zerolog.Disabled)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	deliverACast(svc, ctx, "u")
+	if len(ctx.results) != 1 || svc.Instances() != 1 {
+		t.Fatalf("Delivered %v with %d instances", ctx.results, svc.Instances())
+	}
+	svc.Prune("u")
+	deliverACast(svc, ctx, "u")
+	if len(ctx.results) != 1 || svc.Instances() != 0 {
+		t.Errorf("Delivered %v with %d instances after pruning", ctx.results, svc.Instances())
+	}
+}
+
+func TestACast_RetentionDropsOldInstances(t *testing.T) {
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+	nc.ACastRetention = services.ACastRetention{TTL: 20 * time.Millisecond, MaxInstances: 3}
+	svc := services.NewAcastServiceWithContext[string](nc)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	// Delivered instances expire after the TTL
+	deliverACast(svc, ctx, "a")
+	time.Sleep(30 * time.Millisecond)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "b", Val: "v", From: 2}, ctx)
+	if svc.Instances() != 1 {
+		t.Fatalf("Kept %d instances, want only b", svc.Instances())
+	}
+
+	// Beyond the limit the oldest delivered instance goes, undelivered ones
+	// stay
+	deliverACast(svc, ctx, "c")
+	for _, uuid := range []string{"d", "e"} {
+		svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: uuid, Val: "v", From: 2}, ctx)
+	}
+	if svc.Instances() != 3 {
+		t.Fatalf("Kept %d instances, want b, d and e", svc.Instances())
+	}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "f", Val: "v", From: 2}, ctx)
+	if svc.Instances() != 4 {
+		t.Fatalf("Kept %d instances, want the 4 undelivered ones", svc.Instances())
+	}
+	deliverACast(svc, ctx, "c")
+	deliverACast(svc, ctx, "b")
+	deliverACast(svc, ctx, "f")
+	if len(ctx.results) != 4 {
+		t.Errorf("Delivered %d times, want a, c, b and f once each", len(ctx.results))
+	}
+}
+
+func TestACast_RetentionCapsPendingPerSender(t *testing.T) {
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+	nc.ACastRetention = services.ACastRetention{MaxInstances: 2, MaxPendingPerSender: 3}
+	svc := services.NewAcastServiceWithContext[string](nc)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	// Node 4 floods ECHOs for instances nobody broadcast. It starts only 3
+	// of them, and evicts no undelivered instance
+	svc.OnMessage(services.ACastMessage[string]{Type: services.MSG, UUID: "honest", Val: "v", From: 2}, ctx)
+	for i := 0; i < 10; i++ {
+		svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: fmt.Sprintf("junk-%d", i), Val: "v", From: 4}, ctx)
+	}
+	if svc.Instances() != 4 {
+		t.Fatalf("Kept %d instances, want honest and 3 of node 4", svc.Instances())
+	}
+	deliverACast(svc, ctx, "honest")
+	if len(ctx.results) != 1 {
+		t.Fatalf("Delivered %v, want the broadcast of node 2", ctx.results)
+	}
+
+	// An instance another node sent messages for no longer counts against
+	// node 4
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "junk-0", Val: "v", From: 3}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "junk-10", Val: "v", From: 4}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "junk-11", Val: "v", From: 4}, ctx)
+	if svc.Instances() != 4 {
+		t.Errorf("Kept %d instances, want junk-0 to junk-2 and junk-10 after dropping the delivered one", svc.Instances())
+	}
+}
+
+func TestACast_RetentionForgetsOldestPruned(t *testing.T) {
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+	nc.ACastRetention = services.ACastRetention{MaxPruned: 1}
+	svc := services.NewAcastServiceWithContext[string](nc)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	deliverACast(svc, ctx, "a")
+	svc.Prune("a")
+	deliverACast(svc, ctx, "b")
+	svc.Prune("b")
+
+	// Only b is remembered, so a starts over
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "b", Val: "v", From: 2}, ctx)
+	if svc.Instances() != 0 {
+		t.Fatalf("Kept %d instances, want none for the pruned b", svc.Instances())
+	}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "a", Val: "v", From: 2}, ctx)
+	if svc.Instances() != 1 {
+		t.Errorf("Kept %d instances, want a started over", svc.Instances())
+	}
+}
+
+func TestACast_RetentionInABA(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(4, 1),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ACastRetention = services.ACastRetention{TTL: time.Second, MaxInstances: 10_000}
+		}))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+}
+
+func TestACast_TaggedBroadcastIsIdempotent(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
+
+	msg := services.NewTaggedACastMessage("Tagged", 1, "round-1")
+	if again := services.NewTaggedACastMessage("Tagged", 1, "round-1"); again.UUID != msg.UUID {
+		t.Fatalf("Same (sender, tag) got UUIDs %s and %s", msg.UUID, again.UUID)
+	}
+	if other := services.NewTaggedACastMessage("Tagged", 2, "round-1"); other.UUID == msg.UUID {
+		t.Fatalf("Different senders share UUID %s", msg.UUID)
+	}
+
+	c.Network.Broadcast(msg)
+	c.Network.Broadcast(msg)
+	for id := 1; id <= n; id++ {
+		select {
+		case res := <-c.Results(id):
+			if res != "Tagged" {
+				t.Errorf("Node %d delivered %q", id, res)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Node %d did not deliver", id)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	for id := 1; id <= n; id++ {
+		select {
+		case res := <-c.Results(id):
+			t.Errorf("Node %d delivered %q twice", id, res)
+		default:
+		}
+	}
+}
+
+func TestACast_TaggedRejectsEquivocation(t *testing.T) {
+	cp := services.NewCertificationProtocol()
+	svc := services.NewAcastServiceWithCertification[string](1, 4, 1, cp, zerolog.Disabled)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	// Node 3 cannot start a broadcast under node 2's identity
+	spoofed := services.NewTaggedACastMessage("a", 2, "tag")
+	spoofed.From = 3
+	svc.OnMessage(spoofed, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Echoed %+v for a spoofed MSG", ctx.broadcasts)
+	}
+
+	svc.OnMessage(services.NewTaggedACastMessage("a", 2, "tag"), ctx)
+	svc.OnMessage(services.NewTaggedACastMessage("b", 2, "tag"), ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Val != "a" {
+		t.Fatalf("Sent %+v, want one ECHO of a", ctx.broadcasts)
+	}
+	if !cp.IsSuspect(2) {
+		t.Error("Node 2 sent two values for one tag but is not a suspect")
+	}
+	if cp.IsSuspect(3) {
+		t.Error("Node 3 is a suspect, its MSG only failed the identity check")
+	}
+}
+
+func TestACast_TaggedRejectsUntaggedMSG(t *testing.T) {
+	svc := services.NewAcastService[string](1, 4, 1, zerolog.Disabled)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	// Node 3 names node 2's tagged instance in a MSG without a tag
+	uuid := services.ACastTagUUID(2, "tag")
+	svc.OnMessage(services.ACastMessage[string]{Type: services.MSG, UUID: uuid, Val: "x", From: 3}, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Echoed %+v for an untagged MSG of a tagged instance", ctx.broadcasts)
+	}
+
+	svc.OnMessage(services.NewTaggedACastMessage("a", 2, "tag"), ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Val != "a" {
+		t.Fatalf("Sent %+v, want one ECHO of a", ctx.broadcasts)
+	}
+	if untagged := services.NewACastMessage("a", 2); strings.HasPrefix(untagged.UUID, "tag-") {
+		t.Errorf("Untagged UUID %s is in the tagged namespace", untagged.UUID)
+	}
+}
+
+func TestACast_EquivocationIsReported(t *testing.T) {
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+	var reported []services.ACastEquivocation
+	nc.Equivocations = func(e services.ACastEquivocation) { reported = append(reported, e) }
+	svc := services.NewAcastServiceWithContext[string](nc)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	svc.OnMessage(services.ACastMessage[string]{Type: services.MSG, UUID: "u", Val: "a", From: 2}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.MSG, UUID: "u", Val: "b", From: 2}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "u", Val: "a", From: 3}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "u", Val: "a", From: 3}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "u", Val: "b", From: 3}, ctx)
+
+	want := []services.ACastEquivocation{
+		{Node: 1, Instance: "u", Sender: 2, Step: services.MSG, First: "a", Second: "b"},
+		{Node: 1, Instance: "u", Sender: 3, Step: services.ECHO, First: "a", Second: "b"},
+	}
+	if len(reported) != len(want) {
+		t.Fatalf("Reported %v, want %v", reported, want)
+	}
+	for i := range want {
+		if reported[i] != want[i] {
+			t.Errorf("Report %d is %v, want %v", i, reported[i], want[i])
+		}
+	}
+	if !nc.CP.IsSuspect(2) || !nc.CP.IsSuspect(3) || nc.CP.IsSuspect(4) {
+		t.Errorf("Suspects %v, want 2 and 3", nc.CP.Suspects())
+	}
+	if got := nc.Metrics.Get("acast.equivocations"); got != 2 {
+		t.Errorf("Counted %d equivocations, want 2", got)
+	}
+}
+
+func TestACast_ValidatorRefusesEcho(t *testing.T) {
+	svc := services.NewAcastService[string](1, 4, 1, zerolog.Disabled)
+	svc.SetValidator(func(val string) bool { return val != "bad" })
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	svc.OnMessage(services.NewACastMessage("bad", 2), ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Echoed %+v for an invalid value", ctx.broadcasts)
+	}
+	svc.OnMessage(services.NewACastMessage("good", 2), ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Type != services.ECHO {
+		t.Fatalf("Sent %+v, want one ECHO of the valid value", ctx.broadcasts)
+	}
+}
+
+func TestACast_LayersRefuseMalformedPayloads(t *testing.T) {
+	vote := services.NewVoteService(1, 4, 1, zerolog.Disabled)
+	ctx := &recordingContext[services.VoteMessage, services.VoteResult]{}
+	for _, val := range []string{
+		"not json",
+		services.VotePayload{Type: services.Vote_Input, Sender: 2, Bit: 2}.String(),
+		services.VotePayload{Type: services.Vote_Vote1, Sender: 9, Bit: 1}.String(),
+		services.VotePayload{Type: services.Vote_Vote1, Sender: 2, Bit: 1, Set: []int{1, 2, 3, 4, 5}}.String(),
+	} {
+		msg := services.NewACastMessage(val, 2)
+		vote.OnMessage(services.VoteMessage{Type: services.Vote_ACast, ACastMsg: &msg}, ctx)
+	}
+	if len(ctx.broadcasts) != 0 {
+		t.Errorf("Vote echoed %d malformed payloads", len(ctx.broadcasts))
+	}
+
+	msg := services.NewACastMessage(services.VotePayload{Type: services.Vote_Input, Sender: 2, Bit: 1}.String(), 2)
+	vote.OnMessage(services.VoteMessage{Type: services.Vote_ACast, ACastMsg: &msg}, ctx)
+	if len(ctx.broadcasts) != 1 {
+		t.Errorf("Vote sent %d messages for a valid payload, want one ECHO", len(ctx.broadcasts))
+	}
+}
+
+// withACastKeys gives every node a signing key and the keyring of all of them.
+func withACastKeys(t *testing.T, n int) abatest.Option {
+	keys, keyring, err := services.GenerateKeys(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.SigningKey = keys[nc.ID]
+		nc.Keyring = keyring
+	})
+}
+
+func signedEcho(keys map[int]ed25519.PrivateKey, uuid, val string, from int) services.ACastMessage[string] {
+	digest := services.ACastDigest(val)
+	return services.ACastMessage[string]{Type: services.SIGNED_ECHO, UUID: uuid, Digest: digest, From: from, Sig: services.SignACastEcho(keys[from], uuid, digest)}
+}
+
+func TestACast_SignedDeliversOnEchoCertificate(t *testing.T) {
+	keys, keyring, err := services.GenerateKeys(4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+	nc.SigningKey, nc.Keyring = keys[1], keyring
+	svc := services.NewAcastServiceWithContext[string](nc)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	msg := services.NewSignedACastMessage("signed", 2)
+	svc.OnMessage(msg, ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Type != services.SIGNED_ECHO {
+		t.Fatalf("Sent %+v, want a SIGNED_ECHO", ctx.broadcasts)
+	}
+
+	// A signature by another key does not count
+	forged := signedEcho(keys, msg.UUID, "signed", 3)
+	forged.From = 4
+	svc.OnMessage(forged, ctx)
+	svc.OnMessage(ctx.broadcasts[0], ctx)
+	svc.OnMessage(signedEcho(keys, msg.UUID, "signed", 2), ctx)
+	if len(ctx.results) != 0 {
+		t.Fatalf("Delivered %v with two valid signatures", ctx.results)
+	}
+	svc.OnMessage(signedEcho(keys, msg.UUID, "signed", 3), ctx)
+	if len(ctx.results) != 1 || ctx.results[0] != "signed" {
+		t.Fatalf("Delivered %v, want [signed]", ctx.results)
+	}
+	cert := ctx.broadcasts[len(ctx.broadcasts)-1]
+	for _, sent := range ctx.broadcasts {
+		if sent.Type == services.READY {
+			t.Errorf("Sent a READY in a signed instance")
 		}
 	}
+	if cert.Type != services.CERT || len(cert.Cert) != 3 {
+		t.Fatalf("Sent %+v last, want a CERT of 3 signatures", cert)
+	}
+
+	// The certificate alone makes a node that missed everything deliver
+	other := services.NewNodeContext(4, 4, 1, zerolog.Disabled)
+	other.SigningKey, other.Keyring = keys[4], keyring
+	late := services.NewAcastServiceWithContext[string](other)
+	lateCtx := &recordingContext[services.ACastMessage[string], string]{}
+	tampered := cert
+	tampered.Val = "other"
+	tampered.Digest = services.ACastDigest("other")
+	late.OnMessage(tampered, lateCtx)
+	if len(lateCtx.results) != 0 {
+		t.Fatalf("Delivered %v from a certificate on another digest", lateCtx.results)
+	}
+	late.OnMessage(cert, lateCtx)
+	if len(lateCtx.results) != 1 || lateCtx.results[0] != "signed" {
+		t.Errorf("Delivered %v from the certificate, want [signed]", lateCtx.results)
+	}
+}
+
+func TestACast_SignedCertificateKeepsValidSignatures(t *testing.T) {
+	keys, keyring, err := services.GenerateKeys(4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc := services.NewNodeContext(4, 4, 1, zerolog.Disabled)
+	nc.SigningKey, nc.Keyring = keys[4], keyring
+	svc := services.NewAcastServiceWithContext[string](nc)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	// Three valid signatures and a forged one, without the value
+	uuid, digest := "u", services.ACastDigest("signed")
+	cert := services.ACastCertificate{}
+	for signer := 1; signer <= 3; signer++ {
+		cert[signer] = services.SignACastEcho(keys[signer], uuid, digest)
+	}
+	cert[4] = services.SignACastEcho(keys[1], uuid, digest)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.CERT, UUID: uuid, Digest: digest, From: 2, Cert: cert}, ctx)
+
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Type != services.CERT {
+		t.Fatalf("Sent %+v, want the certificate relayed", ctx.broadcasts)
+	}
+	relayed := ctx.broadcasts[0].Cert
+	if len(relayed) != 3 {
+		t.Errorf("Relayed %d signatures, want the 3 valid ones", len(relayed))
+	}
+	for signer, sig := range relayed {
+		if !ed25519.Verify(keyring.PublicKey(signer), services.ACastEchoBytes(uuid, digest), sig) {
+			t.Errorf("Relayed an invalid signature of node %d", signer)
+		}
+	}
+}
+
+func TestACast_SignedCluster(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f), withACastKeys(t, n))
+
+	c.Network.Broadcast(services.NewSignedACastMessage("SignedValue", 1))
+	results, err := c.Await(c.Honest(), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res != "SignedValue" {
+			t.Errorf("Node %d delivered %q", id, res)
+		}
+	}
+}
+
+func TestACast_InstanceState(t *testing.T) {
+	svc := services.NewAcastService[string](1, 4, 1, zerolog.Disabled)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	if _, ok := svc.InstanceState("u"); ok {
+		t.Fatal("Reported an instance that does not exist")
+	}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.MSG, UUID: "u", Val: "a", From: 2}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "u", Val: "a", From: 2}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "u", Val: "b", From: 3}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "a", From: 4}, ctx)
+
+	st, ok := svc.InstanceState("u")
+	if !ok {
+		t.Fatal("Instance u not found")
+	}
+	if st.Phase != "ECHOED" || !st.SentEcho || st.SentReady || st.Delivered {
+		t.Errorf("State %+v, want ECHOED", st)
+	}
+	if st.Echoes["a"] != 1 || st.Echoes["b"] != 1 || st.Readies["a"] != 1 {
+		t.Errorf("Counted ECHOs %v and READYs %v", st.Echoes, st.Readies)
+	}
+
+	deliverACast(svc, ctx, "v")
+	time.Sleep(10 * time.Millisecond)
+	stuck := svc.Stuck(5 * time.Millisecond)
+	if len(stuck) != 1 || stuck[0].UUID != "u" {
+		t.Errorf("Stuck instances %+v, want only u", stuck)
+	}
+	if states := svc.InstanceStates(); len(states) != 2 || states[0].UUID != "u" || !states[1].Delivered {
+		t.Errorf("States %+v, want u and delivered v", states)
+	}
+}
+
+func TestACast_RetransmitsOverLossyLinks(t *testing.T) {
+	n, f := 4, 1
+	retransmit := abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.ACastRetransmit = services.ACastRetransmit{Initial: 20 * time.Millisecond, Max: 100 * time.Millisecond}
+	})
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f), retransmit)
+	chaos := services.NewChaos(services.ClassifyACastMessage[string])
+	// Node 4 loses everything the first time round
+	chaos.Drop(services.MessageFilter{Type: "MSG"}).To(4).Times(1)
+	chaos.Drop(services.MessageFilter{Type: "ECHO"}).To(4).Times(n)
+	chaos.Drop(services.MessageFilter{Type: "READY"}).To(4).Times(n)
+	// And the others lose some ECHOs
+	chaos.Drop(services.MessageFilter{Type: "ECHO"}).To(1, 2).Times(2)
+	c.Network.SetChaos(chaos)
+
+	c.Network.Broadcast(services.NewACastMessage("LossyValue", 1))
+	results, err := c.Await(c.Honest(), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res != "LossyValue" {
+			t.Errorf("Node %d delivered %q", id, res)
+		}
+	}
+	if c.NodeContext(1).Metrics.Get("acast.retransmissions") == 0 {
+		t.Error("Node 1 did not retransmit")
+	}
+}
+
+func TestACast_DigestKeyedPayloads(t *testing.T) {
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+	svc := services.NewAcastServiceWithDigest(nc, services.IVSSPayload.Digest)
+	ctx := &recordingContext[services.ACastMessage[services.IVSSPayload], services.IVSSPayload]{}
+
+	val := services.IVSSPayload{InstanceID: "ivss", Type: services.Payload_MSet, MSet: utils.NodeSet{1, 2, 3}}
+	other := services.IVSSPayload{InstanceID: "ivss", Type: services.Payload_MSet, MSet: utils.NodeSet{2, 3, 4}}
+	msg := services.NewACastMessage(val, 2)
+	svc.OnMessage(msg, ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Type != services.ECHO {
+		t.Fatalf("Sent %+v, want an ECHO", ctx.broadcasts)
+	}
+
+	// Equal payloads in separate copies are counted together, others apart
+	svc.OnMessage(services.ACastMessage[services.IVSSPayload]{Type: services.ECHO, UUID: msg.UUID, Val: other, From: 2}, ctx)
+	for from := 3; from <= 4; from++ {
+		copied := val
+		copied.MSet = slices.Clone(val.MSet)
+		svc.OnMessage(services.ACastMessage[services.IVSSPayload]{Type: services.ECHO, UUID: msg.UUID, Val: copied, From: from}, ctx)
+	}
+	if len(ctx.broadcasts) != 1 {
+		t.Fatal("Sent a READY on 2 matching ECHOs")
+	}
+	svc.OnMessage(services.ACastMessage[services.IVSSPayload]{Type: services.ECHO, UUID: msg.UUID, Val: val, From: 1}, ctx)
+	if last := ctx.broadcasts[len(ctx.broadcasts)-1]; last.Type != services.READY {
+		t.Fatalf("Sent %+v, want a READY", last)
+	}
+
+	for from := 2; from <= 4; from++ {
+		svc.OnMessage(services.ACastMessage[services.IVSSPayload]{Type: services.READY, UUID: msg.UUID, Val: val, From: from}, ctx)
+	}
+	if len(ctx.results) != 1 || ctx.results[0].Digest() != val.Digest() {
+		t.Fatalf("Delivered %+v, want %+v", ctx.results, val)
+	}
+}
+
+func TestACast_Metrics(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
+
+	c.Network.Broadcast(services.NewACastMessage("Measured", 1))
+	if _, err := c.Await(c.Honest(), 5*time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= n; id++ {
+		m := c.Service(id).Metrics()
+		if m.Sent[services.ECHO] != 1 || m.Sent[services.READY] != 1 {
+			t.Errorf("Node %d sent %v, want one ECHO and one READY", id, m.Sent)
+		}
+		if m.Received[services.MSG] != 1 || m.Received[services.ECHO] < int64(n-f) || m.Received[services.READY] < int64(2*f+1) {
+			t.Errorf("Node %d received %v", id, m.Received)
+		}
+		if m.Started != 1 || m.Delivered != 1 || m.Latency.Count != 1 || m.Latency.Max <= 0 {
+			t.Errorf("Node %d started %d, delivered %d with latency %+v", id, m.Started, m.Delivered, m.Latency)
+		}
+		if got := c.NodeContext(id).Metrics.Get("acast.sent.ECHO"); got != 1 {
+			t.Errorf("Node %d counted %d ECHOs sent in its node metrics", id, got)
+		}
+	}
+}
+
+func TestMetrics_Histogram(t *testing.T) {
+	m := services.NewMetrics()
+	for _, d := range []time.Duration{time.Millisecond, 3 * time.Millisecond, 30 * time.Millisecond, time.Minute} {
+		m.Observe("latency", d)
+	}
+	h := m.Histogram("latency")
+	if h.Count != 4 || h.Min != time.Millisecond || h.Max != time.Minute {
+		t.Fatalf("Histogram %+v", h)
+	}
+	if h.Quantile(0.5) != 5*time.Millisecond || h.Quantile(1) != time.Minute {
+		t.Errorf("Median %v and maximum %v", h.Quantile(0.5), h.Quantile(1))
+	}
+	if mean := h.Mean(); mean != h.Sum/4 {
+		t.Errorf("Mean %v", mean)
+	}
+}
+
+func TestACast_ThresholdValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		thresholds services.ACastThresholds
+		n, f       int
+		safe       bool
+	}{
+		{"byzantine n=3t+1", services.ByzantineThresholds{}, 4, 1, true},
+		{"byzantine n=3t", services.ByzantineThresholds{}, 3, 1, false},
+		{"crash n=2t+1", services.CrashThresholds{}, 3, 1, true},
+		{"crash n=2t", services.CrashThresholds{}, 2, 1, false},
+		{"stricter byzantine", services.FixedThresholds{EchoAt: 5, ReadyAt: 3, DeliverAt: 5}, 7, 2, true},
+		{"echo beyond correct nodes", services.FixedThresholds{EchoAt: 4, ReadyAt: 2, DeliverAt: 3}, 4, 1, false},
+		{"crash thresholds against byzantine", services.FixedThresholds{EchoAt: 2, ReadyAt: 1, DeliverAt: 2}, 4, 1, false},
+		{"crash thresholds against crashes", services.FixedThresholds{EchoAt: 2, ReadyAt: 1, DeliverAt: 2, CrashOnly: true}, 4, 1, true},
+		{"deliver below ready plus t", services.FixedThresholds{EchoAt: 3, ReadyAt: 2, DeliverAt: 2}, 4, 1, false},
+	} {
+		if err := tc.thresholds.Validate(tc.n, tc.f); (err == nil) != tc.safe {
+			t.Errorf("%s: Validate(%d, %d) = %v, want safe %v", tc.name, tc.n, tc.f, err, tc.safe)
+		}
+	}
+}
+
+func TestACast_CrashThresholds(t *testing.T) {
+	n, f := 3, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) { nc.ACastThresholds = services.CrashThresholds{} }))
+
+	c.Network.Broadcast(services.NewACastMessage("CrashOnly", 1))
+	results, err := c.Await(c.Honest(), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res != "CrashOnly" {
+			t.Errorf("Node %d delivered %q", id, res)
+		}
+	}
+
+	// One ECHO makes a node join, t+1 READYs make it deliver
+	svc := services.NewAcastServiceWithContext[string](c.NodeContext(1))
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: "u", Val: "v", From: 2}, ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Type != services.READY {
+		t.Fatalf("Sent %+v on one ECHO, want a READY", ctx.broadcasts)
+	}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "v", From: 2}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "v", From: 3}, ctx)
+	if len(ctx.results) != 1 {
+		t.Errorf("Delivered %v on %d READYs", ctx.results, f+1)
+	}
 }
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"async-agreement-protocol-3/abatest"
 	"async-agreement-protocol-3/services"
 	"fmt"
 	"math/rand"
@@ -11,33 +12,9 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// setupACastCluster creates a cluster of n nodes with tolerance f.
-// It returns the network, the service managers, and a cleanup function.
-func setupACastCluster(n, f int) (*services.Network[services.ACastMessage[string]], []*services.ServiceManager[services.ACastMessage[string], string], func()) {
-	network := services.NewNetwork[services.ACastMessage[string]]()
-	managers := make([]*services.ServiceManager[services.ACastMessage[string], string], n)
-
-	for i := 0; i < n; i++ {
-		id := i + 1
-		svc := services.NewAcastService[string](id, n, f, zerolog.Disabled)
-		managers[i] = services.NewServiceManager[services.ACastMessage[string], string](svc, network)
-		network.Register(id, managers[i].Inbox())
-		managers[i].Start()
-	}
-
-	cleanup := func() {
-		for _, sm := range managers {
-			sm.Stop()
-		}
-	}
-
-	return network, managers, cleanup
-}
-
 func TestACast_HappyPath(t *testing.T) {
 	n, f := 4, 1
-	_, managers, cleanup := setupACastCluster(n, f)
-	defer cleanup()
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
 
 	// Test Data
 	val := "TestValue"
@@ -45,27 +22,26 @@ func TestACast_HappyPath(t *testing.T) {
 	msg := services.NewACastMessage(val, senderID)
 
 	// Simulate Sender broadcasting MSG to all nodes
-	for _, sm := range managers {
-		sm.Inbox() <- msg
+	for id := 1; id <= n; id++ {
+		c.Manager(id).Inbox() <- msg
 	}
 
 	// Verify Delivery
-	for i, sm := range managers {
+	for id := 1; id <= n; id++ {
 		select {
-		case res := <-sm.Result():
+		case res := <-c.Results(id):
 			if res != val {
-				t.Errorf("Node %d delivered wrong value: got %v, want %v", i+1, res, val)
+				t.Errorf("Node %d delivered wrong value: got %v, want %v", id, res, val)
 			}
 		case <-time.After(1 * time.Second):
-			t.Errorf("Node %d timed out waiting for result", i+1)
+			t.Errorf("Node %d timed out waiting for result", id)
 		}
 	}
 }
 
 func TestACast_PartialBroadcast(t *testing.T) {
 	n, f := 4, 1
-	_, managers, cleanup := setupACastCluster(n, f)
-	defer cleanup()
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
 
 	val := "PartialValue"
 	senderID := 1
@@ -73,43 +49,42 @@ func TestACast_PartialBroadcast(t *testing.T) {
 
 	// Simulate Sender broadcasting MSG to only 3 nodes (Node 1, 2, 3)
 	// Node 4 does not receive MSG directly.
-	for i := 0; i < 3; i++ {
-		managers[i].Inbox() <- msg
+	for id := 1; id <= 3; id++ {
+		c.Manager(id).Inbox() <- msg
 	}
 
 	// Verify Delivery on ALL nodes (including Node 4)
-	for i, sm := range managers {
+	for id := 1; id <= n; id++ {
 		select {
-		case res := <-sm.Result():
+		case res := <-c.Results(id):
 			if res != val {
-				t.Errorf("Node %d delivered wrong value: got %v, want %v", i+1, res, val)
+				t.Errorf("Node %d delivered wrong value: got %v, want %v", id, res, val)
 			}
 		case <-time.After(1 * time.Second):
-			t.Errorf("Node %d timed out waiting for result", i+1)
+			t.Errorf("Node %d timed out waiting for result", id)
 		}
 	}
 }
 
 func TestACast_InsufficientBroadcast(t *testing.T) {
 	n, f := 4, 1
-	_, managers, cleanup := setupACastCluster(n, f)
-	defer cleanup()
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
 
 	val := "InsufficientValue"
 	senderID := 1
 	msg := services.NewACastMessage(val, senderID)
 
 	// Simulate Sender broadcasting MSG to only 2 nodes
-	for i := 0; i < 2; i++ {
-		managers[i].Inbox() <- msg
+	for id := 1; id <= 2; id++ {
+		c.Manager(id).Inbox() <- msg
 	}
 
 	// Verify NO Delivery
 	time.Sleep(500 * time.Millisecond)
-	for i, sm := range managers {
+	for id := 1; id <= n; id++ {
 		select {
-		case res := <-sm.Result():
-			t.Errorf("Node %d delivered value unexpectedly: %v", i+1, res)
+		case res := <-c.Results(id):
+			t.Errorf("Node %d delivered value unexpectedly: %v", id, res)
 		default:
 			// Expected behavior
 		}
@@ -118,8 +93,7 @@ func TestACast_InsufficientBroadcast(t *testing.T) {
 
 func TestACast_ManyMessages(t *testing.T) {
 	n, f := 4, 1
-	_, managers, cleanup := setupACastCluster(n, f)
-	defer cleanup()
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
 
 	numMessages := 50
 	senderID := 1
@@ -128,20 +102,20 @@ func TestACast_ManyMessages(t *testing.T) {
 	wg.Add(n * numMessages)
 
 	// Start a goroutine for each node to collect results
-	for i := 0; i < n; i++ {
-		go func(nodeIdx int, sm *services.ServiceManager[services.ACastMessage[string], string]) {
+	for id := 1; id <= n; id++ {
+		go func(id int) {
 			receivedCount := 0
 			for receivedCount < numMessages {
 				select {
-				case <-sm.Result():
+				case <-c.Results(id):
 					receivedCount++
 					wg.Done()
 				case <-time.After(5 * time.Second):
-					t.Errorf("Node %d timed out waiting for messages. Received %d/%d", nodeIdx+1, receivedCount, numMessages)
+					t.Errorf("Node %d timed out waiting for messages. Received %d/%d", id, receivedCount, numMessages)
 					return
 				}
 			}
-		}(i, managers[i])
+		}(id)
 	}
 
 	// Send messages
@@ -149,8 +123,8 @@ func TestACast_ManyMessages(t *testing.T) {
 		val := fmt.Sprintf("Msg-%d", i)
 		msg := services.NewACastMessage(val, senderID)
 		// Broadcast to all
-		for _, sm := range managers {
-			sm.Inbox() <- msg
+		for id := 1; id <= n; id++ {
+			c.Manager(id).Inbox() <- msg
 		}
 		// Small delay to not overwhelm channel buffer immediately if it was small (it's 1000 so it's fine)
 	}
@@ -160,8 +134,7 @@ func TestACast_ManyMessages(t *testing.T) {
 
 func TestACast_ConcurrentBroadcasts(t *testing.T) {
 	n, f := 4, 1
-	_, managers, cleanup := setupACastCluster(n, f)
-	defer cleanup()
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
 
 	numSenders := 4 // All nodes broadcast
 	msgsPerSender := 10
@@ -171,20 +144,20 @@ func TestACast_ConcurrentBroadcasts(t *testing.T) {
 	wg.Add(n * totalMessages)
 
 	// Start collectors
-	for i := 0; i < n; i++ {
-		go func(nodeIdx int, sm *services.ServiceManager[services.ACastMessage[string], string]) {
+	for id := 1; id <= n; id++ {
+		go func(id int) {
 			receivedCount := 0
 			for receivedCount < totalMessages {
 				select {
-				case <-sm.Result():
+				case <-c.Results(id):
 					receivedCount++
 					wg.Done()
 				case <-time.After(5 * time.Second):
-					t.Errorf("Node %d timed out. Received %d/%d", nodeIdx+1, receivedCount, totalMessages)
+					t.Errorf("Node %d timed out. Received %d/%d", id, receivedCount, totalMessages)
 					return
 				}
 			}
-		}(i, managers[i])
+		}(id)
 	}
 
 	// Start senders
@@ -200,8 +173,8 @@ func TestACast_ConcurrentBroadcasts(t *testing.T) {
 				// So we can reuse message IDs 0..9 for each sender.
 				msg := services.NewACastMessage(val, senderId)
 				// Broadcast to all
-				for _, sm := range managers {
-					sm.Inbox() <- msg
+				for id := 1; id <= n; id++ {
+					c.Manager(id).Inbox() <- msg
 				}
 				time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
 			}
@@ -215,8 +188,9 @@ func TestACast_ConcurrentBroadcasts(t *testing.T) {
 // MockServiceContext for testing OnMessage directly
 type MockServiceContext[TMsg any, TRes any] struct{}
 
-func (m *MockServiceContext[TMsg, TRes]) Broadcast(msg TMsg)  {}
-func (m *MockServiceContext[TMsg, TRes]) SendResult(res TRes) {}
+func (m *MockServiceContext[TMsg, TRes]) Broadcast(msg TMsg)      {}
+func (m *MockServiceContext[TMsg, TRes]) SendTo(to int, msg TMsg) {}
+func (m *MockServiceContext[TMsg, TRes]) SendResult(res TRes)     {}
 
 func TestACast_RaceCondition_NilMapAccess(t *testing.T) {
 	// This test attempts to reproduce a race condition where maps are set to nil
@@ -279,3 +253,48 @@ func TestACast_RaceCondition_NilMapAccess(t *testing.T) {
 		wg.Wait()
 	}
 }
+
+// countingContext counts results from several goroutines
+type countingContext[TMsg any, TRes any] struct {
+	mu      sync.Mutex
+	results map[any]int
+}
+
+func (c *countingContext[TMsg, TRes]) Broadcast(msg TMsg)      {}
+func (c *countingContext[TMsg, TRes]) SendTo(to int, msg TMsg) {}
+func (c *countingContext[TMsg, TRes]) SendResult(res TRes) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[res]++
+}
+
+func TestACast_ConcurrentOnMessage(t *testing.T) {
+	n, f := 4, 1
+	svc := services.NewAcastService[string](1, n, f, zerolog.Disabled)
+	ctx := &countingContext[services.ACastMessage[string], string]{results: make(map[any]int)}
+
+	// Every instance gets its READYs from different goroutines at once
+	const instances = 200
+	var wg sync.WaitGroup
+	for from := 2; from <= n; from++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < instances; i++ {
+				val := fmt.Sprintf("Concurrent-%d", i)
+				svc.OnMessage(services.ACastMessage[string]{Type: services.ECHO, UUID: val, Val: val, From: from}, ctx)
+				svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: val, Val: val, From: from}, ctx)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(ctx.results) != instances {
+		t.Errorf("Delivered %d instances, want %d", len(ctx.results), instances)
+	}
+	for val, count := range ctx.results {
+		if count != 1 {
+			t.Errorf("Delivered %v %d times", val, count)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/abatest"
+	"async-agreement-protocol-3/services"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestAdversary_ACastEquivocatingSender(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f), abatest.WithByzantine(n, services.NewACastEquivocator("evil")))
+
+	// The faulty sender starts a broadcast with two values under one UUID
+	c.Context(n).Broadcast(services.NewACastMessage("good", n))
+
+	delivered := make(map[string]int)
+	for _, id := range c.Honest() {
+		select {
+		case v := <-c.Results(id):
+			delivered[v]++
+		case <-time.After(2 * time.Second):
+			// A-Cast does not guarantee delivery for a faulty sender
+		}
+	}
+	if len(delivered) > 1 {
+		t.Fatalf("Honest nodes delivered different values: %v", delivered)
+	}
+}
+
+func TestAdversary_ABAWithByzantineNode(t *testing.T) {
+	behaviors := map[string]func() services.ByzantineBehavior[services.ABAMessage, int]{
+		"silent": func() services.ByzantineBehavior[services.ABAMessage, int] {
+			return services.NewSilentAfter[services.ABAMessage, int](10)
+		},
+		"delay": func() services.ByzantineBehavior[services.ABAMessage, int] {
+			return services.NewDelayer[services.ABAMessage, int](20)
+		},
+		"equivocate": func() services.ByzantineBehavior[services.ABAMessage, int] { return services.NewABAEquivocator() },
+		"bad-dealer": func() services.ByzantineBehavior[services.ABAMessage, int] { return services.NewABABadDealer(1, 2) },
+		"withhold-ready": func() services.ByzantineBehavior[services.ABAMessage, int] {
+			return services.NewABAReadyWithholder()
+		},
+		"equivocate+withhold-ready": func() services.ByzantineBehavior[services.ABAMessage, int] {
+			return services.Combine[services.ABAMessage, int](services.NewABAEquivocator(), services.NewABAReadyWithholder())
+		},
+	}
+
+	for name, newBehavior := range behaviors {
+		t.Run(name, func(t *testing.T) {
+			n, f := 4, 1
+			// Node n is Byzantine and starts with the opposite input
+			input := func(id int) int {
+				if id == n {
+					return 0
+				}
+				return 1
+			}
+			c := abatest.NewABACluster(t, input, abatest.WithNodes(n, f), abatest.WithByzantine(n, newBehavior()))
+			abatest.StartABA(c)
+
+			decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for id, d := range decisions {
+				if d != 1 {
+					t.Errorf("Node %d decided %d, want 1 (validity)", id, d)
+				}
+			}
+		})
+	}
+}
+
+func TestAdversary_ABAForgedCompletes(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewABACluster(t, func(int) int { return 1 }, abatest.WithNodes(n, f))
+
+	// No node starts ABA. Node n A-Casts t+1 COMPLETEs for 0 in the names
+	// of other nodes, and its own twice
+	for _, sender := range []int{1, 2, n, n} {
+		msg := services.NewACastMessage(services.CompletePayload{Sender: sender, Value: 0}.String(), n)
+		c.Context(n).Broadcast(services.ABAMessage{Type: services.ABA_Complete, CompleteMsg: &msg})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 1; id < n; id++ {
+		for c.NodeContext(id).Metrics.Get("aba.foreign_completes") == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %d did not reject the forged COMPLETEs", id)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	for id := 1; id < n; id++ {
+		select {
+		case d := <-c.Results(id):
+			t.Errorf("Node %d decided %d on the COMPLETEs of one node", id, d)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func TestAdversary_ACastReadyWithholder(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f), abatest.WithByzantine(n, services.NewACastReadyWithholder()))
+
+	// The honest nodes reach n-t READYs without node 4
+	c.Context(1).Broadcast(services.NewACastMessage("value", 1))
+	delivered, err := c.Await(c.Honest(), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, v := range delivered {
+		if v != "value" {
+			t.Errorf("Node %d delivered %q", id, v)
+		}
+	}
+}
+
+func TestAdversary_IVSSBadRevealer(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f), abatest.WithByzantine(n, services.NewIVSSBadRevealer()))
+	instances := abatest.IVSSInstances(c)
+	instanceID := services.IVSSInstanceID("ivss-bad-reveal", 1)
+	secret := big.NewInt(42)
+
+	abatest.StartSharing(c, 1, instanceID, secret)
+	if !waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second) {
+		return
+	}
+	abatest.StartReconstruction(c, allNodes(n), instanceID)
+	waitForReconstruction(t, instances, c.Honest(), instanceID, secret, 5*time.Second)
+}
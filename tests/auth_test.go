@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"crypto/ed25519"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newAuthTransports wraps one shared network into an authenticated
+// transport per node, checking ABA sender claims.
+func newAuthTransports(t *testing.T, n int) ([]*services.AuthenticatedTransport[services.ABAMessage], map[int]ed25519.PrivateKey, *services.Network[services.SignedEnvelope]) {
+	t.Helper()
+	keys, keyring, err := services.GenerateKeys(n, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := services.NewNetwork[services.SignedEnvelope]()
+	transports := make([]*services.AuthenticatedTransport[services.ABAMessage], n)
+	for i := range transports {
+		transports[i] = services.NewAuthenticatedTransport(network, i+1, keys[i+1], keyring, services.ABACodec(services.Wire_Proto))
+		transports[i].SetSenderCheck(services.ABASender)
+		t.Cleanup(transports[i].Close)
+	}
+	return transports, keys, network
+}
+
+func TestAuth_ABAClusterDecides(t *testing.T) {
+	n, f := 4, 1
+	transports, _, _ := newAuthTransports(t, n)
+
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i, transport := range transports {
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(i+1, n, f, zerolog.Disabled), (i+1)%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], transport)
+		transport.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	for i := range managers {
+		abas[i].Start(managers[i])
+	}
+
+	timeout := time.After(30 * time.Second)
+	for i, m := range managers {
+		select {
+		case <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide with authentication", i+1)
+		}
+	}
+}
+
+func TestAuth_RejectsForgedMessages(t *testing.T) {
+	transports, keys, _ := newAuthTransports(t, 4)
+	receiver, byzantine := transports[0], transports[3]
+
+	complete := func(from int) services.ABAMessage {
+		return services.ABAMessage{
+			Type:        services.ABA_Complete,
+			CompleteMsg: &services.ACastMessage[string]{Type: services.MSG, UUID: "u", Val: "1", From: from},
+		}
+	}
+	valid, err := byzantine.Seal(complete(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.Open(valid); err != nil {
+		t.Fatalf("Rejected a valid envelope: %v", err)
+	}
+
+	impersonated := valid
+	impersonated.Sender = 2
+	lying, err := byzantine.Seal(complete(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := lying
+	unsigned.Sender, unsigned.Sig = 2, nil
+	resigned := lying
+	resigned.Sig = ed25519.Sign(keys[4], []byte("something else"))
+	unknown := valid
+	unknown.Sender = 9
+	// Routed on Type to the ICC message of node 2, checked on the COMPLETE
+	// of node 4
+	confused, err := byzantine.Seal(services.ABAMessage{
+		Type:        services.ABA_ICC,
+		CompleteMsg: &services.ACastMessage[string]{Type: services.MSG, UUID: "c", From: 4},
+		ICCMsg: &services.ICCMessage{
+			Type:     services.ICC_ACast,
+			ACastMsg: &services.ACastMessage[string]{Type: services.ECHO, UUID: "c", From: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		env  services.SignedEnvelope
+		want error
+	}{
+		{"replayed", valid, services.ErrReplayed},
+		{"impersonated", impersonated, services.ErrBadSignature},
+		{"lying about From", lying, services.ErrSenderMismatch},
+		{"unsigned", unsigned, services.ErrBadSignature},
+		{"wrong signature", resigned, services.ErrBadSignature},
+		{"unknown sender", unknown, services.ErrUnknownSender},
+		{"sub-message of another type", confused, services.ErrSenderMismatch},
+	} {
+		if _, err := receiver.Open(tc.env); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestAuth_ReplayWindow(t *testing.T) {
+	transports, _, _ := newAuthTransports(t, 4)
+	receiver, sender := transports[0], transports[1]
+
+	envs := make([]services.SignedEnvelope, services.ReplayWindowSize+2)
+	for i := range envs {
+		env, err := sender.Seal(services.ABAMessage{
+			Type:        services.ABA_Complete,
+			CompleteMsg: &services.ACastMessage[string]{Type: services.MSG, UUID: "u", From: 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		envs[i] = env
+	}
+	latest := envs[len(envs)-1]
+	if _, err := receiver.Open(latest); err != nil {
+		t.Fatalf("Rejected envelope %d: %v", latest.Seq, err)
+	}
+
+	// Envelopes may arrive out of order within the window, each once
+	for _, tc := range []struct {
+		env  services.SignedEnvelope
+		want error
+	}{
+		{envs[2], nil},
+		{envs[2], services.ErrReplayed},
+		{envs[len(envs)-2], nil},
+		{latest, services.ErrReplayed},
+		{envs[1], services.ErrStale},
+		{envs[0], services.ErrStale},
+	} {
+		if _, err := receiver.Open(tc.env); !errors.Is(err, tc.want) {
+			t.Errorf("Envelope %d: got %v, want %v", tc.env.Seq, err, tc.want)
+		}
+	}
+}
+
+func TestAuth_ForgedMessagesNeverReachTheInbox(t *testing.T) {
+	transports, _, network := newAuthTransports(t, 4)
+	inbox := make(chan services.ABAMessage, 10)
+	transports[0].Register(1, inbox)
+
+	forged, err := transports[3].Seal(services.ABAMessage{
+		Type:        services.ABA_Complete,
+		CompleteMsg: &services.ACastMessage[string]{Type: services.MSG, UUID: "forged", From: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Sender = 2
+	network.Send(1, forged)
+	transports[2].Send(1, services.ABAMessage{
+		Type:        services.ABA_Complete,
+		CompleteMsg: &services.ACastMessage[string]{Type: services.MSG, UUID: "honest", From: 3},
+	})
+
+	select {
+	case msg := <-inbox:
+		if msg.CompleteMsg.UUID != "honest" {
+			t.Fatalf("Received %q, want only the honest message", msg.CompleteMsg.UUID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Honest message did not arrive")
+	}
+	select {
+	case msg := <-inbox:
+		t.Fatalf("Unexpected message %q", msg.CompleteMsg.UUID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/abatest"
+	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestErasure_AnyKFragmentsRecoverData(t *testing.T) {
+	for _, size := range []int{0, 1, 100, 10_000} {
+		data := bytes.Repeat([]byte{0xA5, 0x00, 0xFF}, size/3+1)[:size]
+		k, n := 3, 7
+		fragments, err := utils.EncodeFragments(data, k, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (size+8)/(k*31) + 1; len(fragments[0]) > want*utils.FieldElementSize {
+			t.Errorf("%d bytes: fragment of %d bytes, want at most %d stripes", size, len(fragments[0]), want)
+		}
+		for _, subset := range [][]int{{0, 1, 2}, {4, 5, 6}, {0, 3, 6}} {
+			have := make(map[int][]byte)
+			for _, i := range subset {
+				have[i] = fragments[i]
+			}
+			got, err := utils.DecodeFragments(have, k, n)
+			if err != nil {
+				t.Fatalf("%d bytes from %v: %v", size, subset, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%d bytes from %v: decoded %d other bytes", size, subset, len(got))
+			}
+		}
+	}
+
+	fragments, _ := utils.EncodeFragments([]byte("short"), 3, 7)
+	if _, err := utils.DecodeFragments(map[int][]byte{0: fragments[0], 1: fragments[1]}, 3, 7); err == nil {
+		t.Error("Decoded from fewer than k fragments")
+	}
+}
+
+func disperse(t *testing.T, c *abatest.AvidCluster, dealer int, val []byte) {
+	t.Helper()
+	err := c.Call(dealer, "disperse", func(s *services.AvidService, ctx services.ServiceContext[services.AvidMessage, services.AvidResult]) {
+		if _, err := s.Disperse(val, ctx); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAvid_RelaysOnlyFragments(t *testing.T) {
+	n, f := 7, 2
+	c := abatest.NewAvidCluster(t, abatest.WithNodes(n, f))
+	meter := services.NewTrafficMeter(services.JSONCodec[services.AvidMessage]{}, services.ClassifyAvidMessage)
+	c.Network.SetTrafficMeter(meter)
+
+	val := bytes.Repeat([]byte("erasure"), 10_000)
+	disperse(t, c, 1, val)
+	results, err := c.Await(c.Honest(), 10*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res.Corrupt || !bytes.Equal(res.Value, val) {
+			t.Errorf("Node %d delivered %d bytes (corrupt: %v), want %d", id, len(res.Value), res.Corrupt, len(val))
+		}
+	}
+
+	// Each ECHO carries a third of the value, base64 encoded in JSON
+	echo := meter.Report().ByType["AVID/ECHO"]
+	if echo.Messages == 0 || echo.Bytes/echo.Messages > uint64(len(val)/2) {
+		t.Errorf("Counted ECHO %+v, want fragments of about %d bytes", echo, len(val)/3)
+	}
+}
+
+func TestAvid_NodeWithoutFragmentDelivers(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewAvidCluster(t, abatest.WithNodes(n, f))
+	chaos := services.NewChaos(services.ClassifyAvidMessage)
+	drop := chaos.Drop(services.MessageFilter{Type: "SEND"}).To(4)
+	c.Network.SetChaos(chaos)
+
+	val := []byte("dispersed")
+	disperse(t, c, 1, val)
+	results, err := c.Await(c.Honest(), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if !bytes.Equal(res.Value, val) {
+			t.Errorf("Node %d delivered %q, want %q", id, res.Value, val)
+		}
+	}
+	if drop.Hits() != 1 {
+		t.Errorf("Dropped %d SENDs, want 1", drop.Hits())
+	}
+}
+
+func TestAvid_InconsistentDealerDeliversCorrupt(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewAvidCluster(t, abatest.WithNodes(n, f))
+
+	// Fragment 3 belongs to another value, but the cross-checksum matches it
+	fragments, _ := utils.EncodeFragments([]byte("first value"), n-2*f, n)
+	other, _ := utils.EncodeFragments([]byte("other value"), n-2*f, n)
+	fragments[2] = other[2]
+	checksum := make([]string, n)
+	for i, fragment := range fragments {
+		hash := sha256.Sum256(fragment)
+		checksum[i] = hex.EncodeToString(hash[:])
+	}
+	ctx := c.Context(1)
+	for i, fragment := range fragments {
+		ctx.SendTo(i+1, services.AvidMessage{Type: services.Avid_Send, UUID: "bad-dealer", From: 1, Fragment: fragment, Checksum: checksum})
+	}
+
+	results, err := c.Await(c.Honest(), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if !res.Corrupt || res.Value != nil {
+			t.Errorf("Node %d delivered %q (corrupt: %v), want a corrupt result", id, res.Value, res.Corrupt)
+		}
+	}
+}
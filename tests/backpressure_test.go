@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// drain reads from ch until it stays empty for 100ms.
+func drain(ch chan int) []int {
+	var got []int
+	for {
+		select {
+		case msg := <-ch:
+			got = append(got, msg)
+		case <-time.After(100 * time.Millisecond):
+			return got
+		}
+	}
+}
+
+// sendToStalledPeer sends 1..10 to a node whose inbox nobody reads yet,
+// through a send queue of 2, and returns the errors of TrySend.
+func sendToStalledPeer(t *testing.T, policy services.BackpressurePolicy) (*services.Network[int], chan int, []error) {
+	t.Helper()
+	network := services.NewNetwork[int]()
+	network.SetBackpressure(2, policy)
+	inbox := make(chan int)
+	network.Register(1, inbox)
+	var errs []error
+	for i := 1; i <= 10; i++ {
+		if err := network.TrySend(1, i); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return network, inbox, errs
+}
+
+func TestBackpressure_DropNewest(t *testing.T) {
+	network, inbox, errs := sendToStalledPeer(t, services.Backpressure_DropNewest)
+	got := drain(inbox)
+	if len(errs) != 0 {
+		t.Errorf("DropNewest reported %v", errs)
+	}
+	if len(got) == 0 || len(got) > 3 || got[0] != 1 || got[len(got)-1] != len(got) {
+		t.Errorf("Received %v, want the first messages in order", got)
+	}
+	if drops := network.QueueDrops(); int(drops) != 10-len(got) {
+		t.Errorf("Counted %d drops, %d messages were not received", drops, 10-len(got))
+	}
+}
+
+func TestBackpressure_DropOldest(t *testing.T) {
+	network, inbox, _ := sendToStalledPeer(t, services.Backpressure_DropOldest)
+	got := drain(inbox)
+	if len(got) < 2 || got[len(got)-1] != 10 || got[len(got)-2] != 9 {
+		t.Errorf("Received %v, want the last messages", got)
+	}
+	if drops := network.QueueDrops(); int(drops) != 10-len(got) {
+		t.Errorf("Counted %d drops, %d messages were not received", drops, 10-len(got))
+	}
+}
+
+func TestBackpressure_Error(t *testing.T) {
+	_, inbox, errs := sendToStalledPeer(t, services.Backpressure_Error)
+	got := drain(inbox)
+	if len(errs) == 0 || len(errs)+len(got) != 10 {
+		t.Fatalf("Got %d errors and %d messages, want them to add up to 10", len(errs), len(got))
+	}
+	for _, err := range errs {
+		if !errors.Is(err, services.ErrQueueFull) {
+			t.Errorf("Got %v, want ErrQueueFull", err)
+		}
+	}
+}
+
+func TestBackpressure_BlockWaitsForRoom(t *testing.T) {
+	network := services.NewNetwork[int]()
+	network.SetBackpressure(2, services.Backpressure_Block)
+	inbox := make(chan int)
+	network.Register(1, inbox)
+
+	sent := make(chan struct{})
+	go func() {
+		for i := 1; i <= 10; i++ {
+			network.Send(1, i)
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("Sending to a stalled peer did not block")
+	case <-time.After(100 * time.Millisecond):
+	}
+	got := drain(inbox)
+	<-sent
+	for i, msg := range got {
+		if msg != i+1 {
+			t.Fatalf("Received %v, want 1 to 10 in order", got)
+		}
+	}
+	if len(got) != 10 || network.QueueDrops() != 0 {
+		t.Errorf("Received %v with %d drops, want every message", got, network.QueueDrops())
+	}
+}
+
+func TestBackpressure_ParsePolicy(t *testing.T) {
+	for _, p := range []services.BackpressurePolicy{services.Backpressure_Block, services.Backpressure_DropOldest, services.Backpressure_DropNewest, services.Backpressure_Error} {
+		parsed, err := services.ParseBackpressurePolicy(p.String())
+		if err != nil || parsed != p {
+			t.Errorf("%v parsed as %v, %v", p, parsed, err)
+		}
+	}
+	if _, err := services.ParseBackpressurePolicy("spill"); err == nil {
+		t.Error("Unknown policy was accepted")
+	}
+}
+
+func TestBackpressure_ACastOverBoundedQueues(t *testing.T) {
+	n, f := 4, 1
+	network := services.NewNetworkWithCodec[services.ACastMessage[string]](services.JSONCodec[services.ACastMessage[string]]{})
+	network.SetBackpressure(16, services.Backpressure_Block)
+
+	managers := make([]*services.ServiceManager[services.ACastMessage[string], string], n)
+	for i := range managers {
+		acast := services.NewAcastServiceWithContext[string](services.NewNodeContext(i+1, n, f, zerolog.Disabled))
+		managers[i] = services.NewServiceManagerWithInbox[services.ACastMessage[string], string](acast, network, 16)
+		network.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	network.Broadcast(services.NewACastMessage("bounded", 1))
+
+	timeout := time.After(10 * time.Second)
+	for i, m := range managers {
+		select {
+		case got := <-m.Result():
+			if got != "bounded" {
+				t.Errorf("Node %d delivered %q", i+1, got)
+			}
+		case <-timeout:
+			t.Fatalf("Node %d did not deliver with bounded queues", i+1)
+		}
+	}
+	if drops := network.QueueDrops(); drops != 0 {
+		t.Errorf("Blocking queues dropped %d messages", drops)
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestBandwidth_CountsACastTraffic(t *testing.T) {
+	n, f := 4, 1
+	network := services.NewNetwork[services.ACastMessage[string]]()
+	meter := services.NewTrafficMeter(services.JSONCodec[services.ACastMessage[string]]{}, services.ClassifyACastMessage[string])
+	network.SetTrafficMeter(meter)
+
+	managers := make([]*services.ServiceManager[services.ACastMessage[string], string], n)
+	for i := range managers {
+		acast := services.NewAcastServiceWithContext[string](services.NewNodeContext(i+1, n, f, zerolog.Disabled))
+		managers[i] = services.NewServiceManager[services.ACastMessage[string], string](acast, network)
+		network.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	msg := services.NewACastMessage("metered", 1)
+	network.Broadcast(msg)
+	for i, m := range managers {
+		select {
+		case <-m.Result():
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Node %d did not deliver", i+1)
+		}
+	}
+
+	// Nodes may still be sending READY after delivering. Their own ECHOs
+	// and READYs loop back without crossing the meter.
+	want := map[string]uint64{"ACAST/MSG": 4, "ACAST/ECHO": 12, "ACAST/READY": 12}
+	var report services.TrafficReport
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if report = meter.Report(); report.Total.Messages == 28 {
+			break
+		}
+	}
+	var total services.TrafficCount
+	for key, c := range report.ByType {
+		if c.Messages != want[key] {
+			t.Errorf("Counted %d %s messages, want %d", c.Messages, key, want[key])
+		}
+		total.Messages += c.Messages
+		total.Bytes += c.Bytes
+	}
+	if total != report.Total {
+		t.Errorf("Types add up to %+v, total is %+v", total, report.Total)
+	}
+	data, _ := json.Marshal(msg)
+	if got := report.ByType["ACAST/MSG"].Bytes; got != 4*uint64(len(data)) {
+		t.Errorf("Counted %d bytes of MSG, want 4 copies of %d", got, len(data))
+	}
+	for id := 1; id <= n; id++ {
+		if report.Sent[id].Messages == 0 || report.Received[id].Messages != 7 {
+			t.Errorf("Node %d sent %+v and received %+v, want 7 messages received", id, report.Sent[id], report.Received[id])
+		}
+	}
+	if report.Total.Bits() != 8*report.Total.Bytes {
+		t.Errorf("Total is %d bits for %d bytes", report.Total.Bits(), report.Total.Bytes)
+	}
+}
+
+func TestBandwidth_UplinkCapDelaysSender(t *testing.T) {
+	network := services.NewNetwork[services.ACastMessage[string]]()
+	meter := services.NewTrafficMeter(services.JSONCodec[services.ACastMessage[string]]{}, services.ClassifyACastMessage[string])
+	meter.SetUplinkCap(100_000)
+	network.SetTrafficMeter(meter)
+	inbox := make(chan services.ACastMessage[string], 20)
+	network.Register(1, inbox)
+
+	// Ten messages of about 1 KB take about 100ms at 100 KB/s
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		network.Send(1, services.NewACastMessage(strings.Repeat("x", 1000), 2))
+	}
+	var first, last time.Duration
+	for i := 0; i < 10; i++ {
+		select {
+		case <-inbox:
+			last = time.Since(start)
+			if i == 0 {
+				first = last
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received only %d messages", i)
+		}
+	}
+	if first > 50*time.Millisecond || last < 90*time.Millisecond {
+		t.Errorf("First message after %v and last after %v, want about 10ms and 100ms", first, last)
+	}
+	if sent := meter.Report().Sent[2]; sent.Messages != 10 || sent.Bytes < 10_000 {
+		t.Errorf("Counted %+v for node 2", sent)
+	}
+}
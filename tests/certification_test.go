@@ -0,0 +1,374 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestCertification_SaveLoad_Memory(t *testing.T) {
+	cp := services.NewCertificationProtocol()
+	cp.AddFaultyPair(3, 1)
+	cp.AddFaultyPairWithEvidence(2, 4, "ICC-1-2-3", "inconsistent reveal polynomials")
+	cp.AddCoreInvocation("ICC-1-1-1")
+
+	store := services.NewMemoryCertificationStore()
+	if err := cp.Save(store); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Simulate a restart with a fresh instance
+	restored := services.NewCertificationProtocol()
+	if err := restored.Load(store); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if !restored.IsFaultyPair(1, 3) || !restored.IsFaultyPair(4, 2) {
+		t.Errorf("Faulty pairs not restored: %v", restored.State().FaultyPairs)
+	}
+	if restored.IsFaultyPair(1, 2) {
+		t.Errorf("Unexpected faulty pair {1, 2}")
+	}
+	if inv := restored.GetCoreInvocations(); len(inv) != 1 || inv[0] != "ICC-1-1-1" {
+		t.Errorf("Core invocations not restored: %v", inv)
+	}
+	ev := restored.GetEvidence()
+	if len(ev) != 1 || ev[0].Pair != [2]int{2, 4} || ev[0].InstanceID != "ICC-1-2-3" {
+		t.Errorf("Evidence not restored: %v", ev)
+	}
+}
+
+func TestCertification_SaveLoad_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cp.json")
+	store := services.NewFileCertificationStore(path)
+
+	// Loading before anything was saved yields an empty state
+	empty := services.NewCertificationProtocol()
+	if err := empty.Load(store); err != nil {
+		t.Fatalf("Load of missing file failed: %v", err)
+	}
+	if len(empty.State().FaultyPairs) != 0 {
+		t.Errorf("Expected empty state")
+	}
+
+	cp := services.NewCertificationProtocol()
+	cp.AddFaultyPair(5, 2)
+	cp.AddCoreInvocation("A")
+	cp.AddCoreInvocation("B")
+	if err := cp.Save(store); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Loading twice must not duplicate core invocations
+	restored := services.NewCertificationProtocol()
+	restored.Load(store)
+	restored.Load(store)
+
+	if !restored.IsFaultyPair(2, 5) {
+		t.Errorf("Faulty pair {2, 5} not restored")
+	}
+	if inv := restored.GetCoreInvocations(); len(inv) != 2 {
+		t.Errorf("Expected 2 core invocations, got %v", inv)
+	}
+}
+
+// recordingContext captures broadcasts and results produced by OnMessage
+type recordingContext[TMsg any, TRes any] struct {
+	broadcasts []TMsg
+	results    []TRes
+}
+
+func (r *recordingContext[TMsg, TRes]) Broadcast(msg TMsg) { r.broadcasts = append(r.broadcasts, msg) }
+func (r *recordingContext[TMsg, TRes]) SendTo(to int, msg TMsg) {
+	r.broadcasts = append(r.broadcasts, msg)
+}
+func (r *recordingContext[TMsg, TRes]) SendResult(res TRes) { r.results = append(r.results, res) }
+
+func TestCertification_ACastIgnoresCertifiedFaulty(t *testing.T) {
+	n, f := 4, 1
+	cp := services.NewCertificationProtocol()
+	// Node 1 was part of a faulty pair with node 4, so node 4 is certified faulty
+	cp.AddFaultyPair(1, 4)
+	if got := cp.CertifiedFaulty(1); len(got) != 1 || got[0] != 4 {
+		t.Fatalf("Expected node 4 certified faulty, got %v", got)
+	}
+
+	svc := services.NewAcastServiceWithCertification[string](1, n, f, cp, zerolog.Disabled)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	// A READY from the faulty node alone must not trigger amplification
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 4}, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("READY from certified-faulty node was counted")
+	}
+
+	// With one faulty node excluded, a single READY from a live node is enough to amplify
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 2}, ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Type != services.READY {
+		t.Fatalf("Expected READY amplification, got %v", ctx.broadcasts)
+	}
+
+	// Delivery still needs 2t+1 READYs from non-faulty senders
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 3}, ctx)
+	if len(ctx.results) != 0 {
+		t.Fatalf("Delivered with too few READYs")
+	}
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 1}, ctx)
+	if len(ctx.results) != 1 || ctx.results[0] != "x" {
+		t.Fatalf("Expected delivery of x, got %v", ctx.results)
+	}
+}
+
+func TestCertification_ACastIgnoresReadiesBeforeCertification(t *testing.T) {
+	n, f := 7, 2
+	cp := services.NewCertificationProtocol()
+	svc := services.NewAcastServiceWithCertification[string](1, n, f, cp, zerolog.Disabled)
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+
+	// Faulty nodes 6 and 7 send READYs for a value no correct node sent,
+	// one short of t+1
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 7}, ctx)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 6}, ctx)
+
+	// Node 7 is certified afterwards, which lowers the threshold to t, but
+	// its READY no longer counts towards it
+	cp.AddFaultyPair(1, 7)
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 6}, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Amplified the READYs of a faulty and a certified-faulty node: %v", ctx.broadcasts)
+	}
+
+	svc.OnMessage(services.ACastMessage[string]{Type: services.READY, UUID: "u", Val: "x", From: 2}, ctx)
+	if len(ctx.broadcasts) != 1 || ctx.broadcasts[0].Type != services.READY {
+		t.Fatalf("Expected READY amplification, got %v", ctx.broadcasts)
+	}
+}
+
+func TestCertification_NextReusableInvocation(t *testing.T) {
+	cp := services.NewCertificationProtocol()
+	if _, ok := cp.NextReusableInvocation(1, 0); ok {
+		t.Fatalf("Expected no reusable invocation on empty history")
+	}
+
+	secret := func(dealer, round, j int) string {
+		return services.IVSSID{Dealer: dealer, Round: round, Tag: fmt.Sprintf("ICC-%d", j)}.String()
+	}
+	s1, s2, s3, s4 := secret(1, 1, 1), secret(1, 1, 2), secret(1, 2, 1), secret(1, 2, 2)
+	other := secret(2, 2, 1)
+	for _, id := range []string{s1, s2, s3, s4, other} {
+		cp.AddCoreInvocation(id)
+	}
+
+	// Only spare invocations are handed out
+	if id, ok := cp.NextReusableInvocation(1, 0); ok {
+		t.Fatalf("Handed out %q, which is not spare", id)
+	}
+	for _, id := range []string{s1, s2, s3, other} {
+		cp.MarkInvocationSpare(id)
+	}
+	// s1 was reconstructed all the same, so its secret is public
+	cp.MarkInvocationConsumed(s1)
+
+	// Of dealer 1 only, from round 2 on
+	id, ok := cp.NextReusableInvocation(1, 2)
+	if !ok || id != s3 {
+		t.Fatalf("Expected %s, got %q (%v)", s3, id, ok)
+	}
+	if id, ok := cp.NextReusableInvocation(1, 2); ok {
+		t.Fatalf("Handed out %q of an earlier round or not spare", id)
+	}
+	id, ok = cp.NextReusableInvocation(1, 0)
+	if !ok || id != s2 {
+		t.Fatalf("Expected %s, got %q (%v)", s2, id, ok)
+	}
+	if id, ok := cp.NextReusableInvocation(1, 0); ok {
+		t.Fatalf("Expected history of dealer 1 to be exhausted, got %q", id)
+	}
+
+	// Consumption survives a save/load cycle, as do spare marks
+	store := services.NewMemoryCertificationStore()
+	cp.Save(store)
+	restored := services.NewCertificationProtocol()
+	restored.Load(store)
+	if id, ok := restored.NextReusableInvocation(1, 0); ok {
+		t.Fatalf("Restored protocol handed out consumed invocation %q", id)
+	}
+	id, ok = restored.NextReusableInvocation(2, 0)
+	if !ok || id != other {
+		t.Fatalf("Expected restored %s, got %q (%v)", other, id, ok)
+	}
+}
+
+func TestCertification_CoreInvocationsBounded(t *testing.T) {
+	cp := services.NewCertificationProtocol()
+	secret := func(round int) string {
+		return services.IVSSID{Dealer: 1, Round: round, Tag: "ICC-1"}.String()
+	}
+	cp.AddCoreInvocation(secret(0))
+	cp.MarkInvocationSpare(secret(0))
+	for round := 1; round <= services.MaxCoreInvocations; round++ {
+		cp.AddCoreInvocation(secret(round))
+	}
+	cp.AddCoreInvocation(secret(1)) // Already known
+
+	history := cp.GetCoreInvocations()
+	if len(history) != services.MaxCoreInvocations {
+		t.Fatalf("Expected %d core invocations, got %d", services.MaxCoreInvocations, len(history))
+	}
+	if history[0] != secret(1) {
+		t.Errorf("Expected the oldest to be forgotten, history starts at %s", history[0])
+	}
+	if id, ok := cp.NextReusableInvocation(1, 0); ok {
+		t.Errorf("Handed out %q, which was forgotten", id)
+	}
+}
+
+func TestCertification_Subscribe(t *testing.T) {
+	cp := services.NewCertificationProtocol()
+	events, cancel := cp.Subscribe()
+
+	cp.AddFaultyPairWithEvidence(4, 2, "IVSS-1", "inconsistent reveal polynomials")
+	cp.AddFaultyPair(2, 4) // Already known, no new event
+	cp.AddSuspect(3, "invalid payload")
+	cp.AddSuspect(3, "another reason") // Already suspect, no new event
+
+	select {
+	case ev := <-events:
+		if ev.Type != services.CertEvent_FaultyPair || ev.Pair != [2]int{2, 4} || ev.Evidence == nil {
+			t.Errorf("Unexpected first event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for faulty pair event")
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Type != services.CertEvent_Suspect || ev.Node != 3 || ev.Reason != "invalid payload" {
+			t.Errorf("Unexpected second event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for suspect event")
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("Expected channel to be closed after cancel")
+	}
+
+	// Recording after cancel must not panic
+	cp.AddFaultyPair(1, 5)
+	if !cp.IsSuspect(3) || cp.IsSuspect(1) {
+		t.Errorf("Suspect set mismatch")
+	}
+}
+
+func TestCertification_SharedNodeContext(t *testing.T) {
+	nc := services.NewNodeContext(1, 4, 1, zerolog.Disabled)
+
+	// Knowledge recorded by one service is visible to every service of the node
+	acast := services.NewAcastServiceWithContext[string](nc)
+	_ = services.NewIVSSServiceWithContext(nc)
+	nc.CP.AddFaultyPair(1, 4)
+
+	ctx := &recordingContext[services.ACastMessage[string], string]{}
+	acast.OnMessage(services.ACastMessage[string]{Type: services.MSG, UUID: "u", Val: "x", From: 4}, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("A-Cast built from shared context echoed a certified-faulty sender")
+	}
+
+	nc.Metrics.Inc("test.counter")
+	nc.Metrics.Add("test.counter", 2)
+	if got := nc.Metrics.Get("test.counter"); got != 3 {
+		t.Errorf("Expected counter 3, got %d", got)
+	}
+}
+
+func TestCertification_ExportImport(t *testing.T) {
+	cp1 := services.NewCertificationProtocol()
+	cp1.AddFaultyPair(1, 4)
+	cp2 := services.NewCertificationProtocol()
+	cp2.AddCoreInvocation("ICC-1-2-2")
+
+	var buf bytes.Buffer
+	err := services.ExportCertification(&buf, map[int]services.CertificationState{
+		1: cp1.State(),
+		2: cp2.State(),
+	})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	states, err := services.ImportCertification(&buf)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("Expected 2 node states, got %d", len(states))
+	}
+
+	restored := services.NewCertificationProtocol()
+	restored.Restore(states[1])
+	if !restored.IsFaultyPair(4, 1) {
+		t.Errorf("Faulty pair not imported")
+	}
+	if inv := states[2].CoreInvocations; len(inv) != 1 || inv[0] != "ICC-1-2-2" {
+		t.Errorf("Core invocations not imported: %v", inv)
+	}
+
+	// Unknown versions are rejected
+	if _, err := services.ImportCertification(strings.NewReader(`{"Version": 99}`)); err == nil {
+		t.Errorf("Expected error for unsupported version")
+	}
+}
+
+func TestCertification_QueryAndMetrics(t *testing.T) {
+	nc := services.NewNodeContext(1, 7, 2, zerolog.Disabled)
+	cp := nc.CP
+
+	cp.AddFaultyPair(1, 5)
+	time.Sleep(5 * time.Millisecond)
+	since := time.Now()
+	cp.AddFaultyPair(5, 3)
+	cp.AddFaultyPair(2, 6)
+	cp.AddSuspect(7, "invalid payload")
+	cp.AddCoreInvocation("A")
+
+	pairs := cp.PairsInvolving(5)
+	if len(pairs) != 2 || pairs[0] != [2]int{1, 5} || pairs[1] != [2]int{3, 5} {
+		t.Errorf("Unexpected pairs involving 5: %v", pairs)
+	}
+
+	recent := cp.PairsSince(since)
+	if len(recent) != 2 {
+		t.Fatalf("Expected 2 pairs since T, got %v", recent)
+	}
+	for _, rec := range recent {
+		if rec.Pair == [2]int{1, 5} {
+			t.Errorf("Pair recorded before T returned: %v", rec)
+		}
+	}
+
+	counts := cp.Counts()
+	if counts.FaultyPairs != 3 || counts.Suspects != 1 || counts.CoreInvocations != 1 {
+		t.Errorf("Unexpected counts: %+v", counts)
+	}
+	if got := nc.Metrics.Get(services.MetricCertFaultyPairs); got != 3 {
+		t.Errorf("Expected faulty pair gauge 3, got %d", got)
+	}
+	if got := nc.Metrics.Get(services.MetricCertSuspects); got != 1 {
+		t.Errorf("Expected suspect gauge 1, got %d", got)
+	}
+
+	// Recording times survive a save/load cycle
+	restored := services.NewCertificationProtocol()
+	restored.Restore(cp.State())
+	if got := restored.PairsSince(since); len(got) != 2 {
+		t.Errorf("Expected 2 restored pairs since T, got %v", got)
+	}
+}
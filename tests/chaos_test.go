@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/abatest"
+	"async-agreement-protocol-3/services"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// runChaosACast broadcasts one value from node 1 in a cluster whose network
+// applies the rules added by inject, and checks every node delivers it. The
+// rules apply to the messages of nodes to themselves too.
+func runChaosACast(t *testing.T, inject func(*services.Chaos[services.ACastMessage[string]])) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f), abatest.WithoutLoopback())
+
+	chaos := services.NewChaos(services.ClassifyACastMessage[string])
+	inject(chaos)
+	c.Network.SetChaos(chaos)
+
+	val := "ChaosValue"
+	c.Network.Broadcast(services.NewACastMessage(val, 1))
+
+	for id := 1; id <= n; id++ {
+		select {
+		case res := <-c.Results(id):
+			if res != val {
+				t.Errorf("Node %d delivered wrong value: got %v, want %v", id, res, val)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("Node %d timed out waiting for result", id)
+		}
+	}
+	// Held messages must not block anything once released
+	c.Network.FlushChaos()
+}
+
+func TestChaos_DropFromOneSender(t *testing.T) {
+	var rule *services.ChaosRule[services.ACastMessage[string]]
+	runChaosACast(t, func(c *services.Chaos[services.ACastMessage[string]]) {
+		rule = c.Drop(services.MessageFilter{Sender: 4, Type: "ECHO"})
+	})
+	if rule.Hits() == 0 {
+		t.Error("No ECHO from node 4 was dropped")
+	}
+}
+
+func TestChaos_DropOnlyToSomeReceivers(t *testing.T) {
+	var rule *services.ChaosRule[services.ACastMessage[string]]
+	runChaosACast(t, func(c *services.Chaos[services.ACastMessage[string]]) {
+		rule = c.Drop(services.MessageFilter{Type: "MSG"}).To(4)
+	})
+	if rule.Hits() != 1 {
+		t.Errorf("MSG dropped %d times, expected once", rule.Hits())
+	}
+}
+
+func TestChaos_DuplicateDelayReorder(t *testing.T) {
+	var dup, delay, reorder *services.ChaosRule[services.ACastMessage[string]]
+	runChaosACast(t, func(c *services.Chaos[services.ACastMessage[string]]) {
+		dup = c.Duplicate(services.MessageFilter{Type: "ECHO"}, 2)
+		delay = c.Delay(services.MessageFilter{Type: "MSG"}, 50*time.Millisecond)
+		reorder = c.Reorder(services.MessageFilter{Type: "READY", Sender: 2}, 3)
+	})
+	if dup.Hits() == 0 || delay.Hits() != 4 || reorder.Hits() == 0 {
+		t.Errorf("Rules applied %d/%d/%d times", dup.Hits(), delay.Hits(), reorder.Hits())
+	}
+}
+
+func TestChaos_TimesLimitsRule(t *testing.T) {
+	var rule *services.ChaosRule[services.ACastMessage[string]]
+	runChaosACast(t, func(c *services.Chaos[services.ACastMessage[string]]) {
+		rule = c.Drop(services.MessageFilter{Layer: services.Layer_ACast, Type: "ECHO"}).Times(3)
+	})
+	if rule.Hits() != 3 {
+		t.Errorf("Rule applied %d times, expected 3", rule.Hits())
+	}
+}
+
+func TestChaos_LatencyProfile(t *testing.T) {
+	var rule *services.ChaosRule[services.ACastMessage[string]]
+	runChaosACast(t, func(c *services.Chaos[services.ACastMessage[string]]) {
+		rule = c.Latency(services.MessageFilter{}, services.LatencyLAN, 1)
+	})
+	if rule.Hits() == 0 {
+		t.Error("No delivery was delayed")
+	}
+}
+
+func TestChaos_LatencyProfileSamples(t *testing.T) {
+	for _, name := range []string{"lan", "wan", "intercontinental", "mobile"} {
+		profile, err := services.ParseLatencyProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng1, rng2 := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7))
+		for i := 0; i < 1000; i++ {
+			d := profile.Sample(rng1)
+			if d != profile.Sample(rng2) {
+				t.Fatalf("%s: samples with the same seed differ", name)
+			}
+			if d < profile.Base {
+				t.Fatalf("%s: sampled %v, below the base delay %v", name, d, profile.Base)
+			}
+			if profile.Loss == 0 && d >= profile.Base+profile.Jitter {
+				t.Fatalf("%s: sampled %v without loss, above %v", name, d, profile.Base+profile.Jitter)
+			}
+		}
+	}
+	if _, err := services.ParseLatencyProfile("satellite"); err == nil {
+		t.Error("Unknown profile was accepted")
+	}
+}
+
+func TestChaos_ClassifyABAMessage(t *testing.T) {
+	acast := &services.ACastMessage[string]{Type: services.READY, From: 3}
+	cases := []struct {
+		msg  services.ABAMessage
+		want services.MessageInfo
+	}{
+		{
+			services.ABAMessage{Type: services.ABA_Vote, Round: 2, VoteMsg: &services.VoteMessage{ACastMsg: acast}},
+			services.MessageInfo{Layer: services.Layer_Vote, Type: "READY", Sender: 3, Round: 2},
+		},
+		{
+			services.ABAMessage{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{Type: services.ICC_ACast, ACastMsg: acast}},
+			services.MessageInfo{Layer: services.Layer_ICC, Type: "READY", Sender: 3, Round: 1},
+		},
+		{
+			services.ABAMessage{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+				Type: services.IVSS_Direct, DirectType: services.Direct_Point, From: 2,
+			}}},
+			services.MessageInfo{Layer: services.Layer_IVSS, Type: "POINT", Sender: 2, Round: 1},
+		},
+		{
+			services.ABAMessage{Type: services.ABA_Complete, Round: 3, CompleteMsg: acast},
+			services.MessageInfo{Layer: services.Layer_ABA, Type: "READY", Sender: 3, Round: 3},
+		},
+	}
+	for _, tc := range cases {
+		if got := services.ClassifyABAMessage(tc.msg); got != tc.want {
+			t.Errorf("Classified %+v as %+v, expected %+v", tc.msg, got, tc.want)
+		}
+	}
+}
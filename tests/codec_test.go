@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// runABACluster runs the n-t honest nodes of an ABA instance on network
+// and returns their decisions.
+func runABACluster(t *testing.T, network *services.Network[services.ABAMessage], n, f int, inputs []int) []int {
+	t.Helper()
+	honest := n - f
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], honest)
+	abas := make([]*services.ABAService, honest)
+	for i := 0; i < honest; i++ {
+		id := i + 1
+		nc := services.NewNodeContext(id, n, f, zerolog.Disabled)
+		abas[i] = services.NewABAServiceWithContext(nc, inputs[i])
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+		network.Register(id, managers[i].Inbox())
+	}
+	defer func() {
+		for _, sm := range managers {
+			sm.Stop()
+		}
+	}()
+	for i := range managers {
+		managers[i].Start()
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, honest)
+	for i, sm := range managers {
+		select {
+		case decisions[i] = <-sm.Result():
+		case <-time.After(30 * time.Second):
+			t.Fatalf("Node %d did not decide", i+1)
+		}
+	}
+	return decisions
+}
+
+func TestCodec_ABAOverEncodedNetwork(t *testing.T) {
+	for _, format := range []services.WireFormat{services.Wire_JSON, services.Wire_Proto, services.Wire_CBOR} {
+		codec := services.ABACodec(format)
+		t.Run(codec.Name(), func(t *testing.T) {
+			network := services.NewNetworkWithCodec(codec)
+			decisions := runABACluster(t, network, 4, 1, []int{1, 1, 1})
+			for i, d := range decisions {
+				if d != 1 {
+					t.Errorf("Node %d decided %d, want 1 (validity)", i+1, d)
+				}
+			}
+		})
+	}
+}
+
+func TestCodec_GenericCodecs(t *testing.T) {
+	msg := services.NewACastMessage("value", 3)
+	for _, codec := range []services.Codec[services.ACastMessage[string]]{
+		services.JSONCodec[services.ACastMessage[string]]{},
+		services.CBORCodec[services.ACastMessage[string]]{},
+	} {
+		data, err := codec.Marshal(msg)
+		if err != nil {
+			t.Fatalf("[%s] Marshal failed: %v", codec.Name(), err)
+		}
+		got, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("[%s] Unmarshal failed: %v", codec.Name(), err)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Errorf("[%s] Round trip mismatch: %+v", codec.Name(), got)
+		}
+	}
+}
+
+// roundTrip encodes and decodes msg with codec and checks nothing changed.
+func roundTrip[TMsg any](t *testing.T, codec services.Codec[TMsg], msg TMsg) {
+	t.Helper()
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		t.Fatalf("[%s] Marshal %T failed: %v", codec.Name(), msg, err)
+	}
+	got, err := codec.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("[%s] Unmarshal %T failed: %v", codec.Name(), msg, err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("[%s] Round trip mismatch:\n got  %+v\n want %+v", codec.Name(), got, msg)
+	}
+}
+
+func TestCodec_LayerCodecs(t *testing.T) {
+	acast := services.NewACastMessage("value", 3)
+	voteACast := services.NewACastMessage(services.VotePayload{Type: services.Vote_Vote1, Sender: 2, Bit: 1, Round: 1}.String(), 2)
+	share := services.IVSSMessage{
+		Type:       services.IVSS_Direct,
+		DirectType: services.Direct_Share,
+		To:         2,
+		From:       1,
+		InstanceID: "ICC-1-0-1",
+		Poly:       &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(7), big.NewInt(11)}},
+	}
+	point := services.IVSSMessage{
+		Type:       services.IVSS_Direct,
+		DirectType: services.Direct_Point,
+		To:         3,
+		From:       2,
+		InstanceID: "ICC-1-0-1",
+		Point:      big.NewInt(42),
+		PointIdx:   3,
+	}
+	wrapped := services.IVSSMessage{Type: services.IVSS_ACast, InstanceID: "ICC-1-0-1", ACastMsg: &acast}
+
+	for _, format := range []services.WireFormat{services.Wire_JSON, services.Wire_Proto, services.Wire_CBOR} {
+		t.Run(format.String(), func(t *testing.T) {
+			roundTrip(t, services.ACastCodec(format), acast)
+			roundTrip(t, services.VoteCodec(format), services.VoteMessage{Type: services.Vote_ACast, ACastMsg: &voteACast})
+			for _, msg := range []services.IVSSMessage{share, point, wrapped} {
+				roundTrip(t, services.IVSSCodec(format), msg)
+			}
+			roundTrip(t, services.ICCCodec(format), services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &point})
+			roundTrip(t, services.ICCCodec(format), services.ICCMessage{Type: services.ICC_ACast, ACastMsg: &acast})
+		})
+	}
+}
+
+func benchmarkABACodec(b *testing.B, codec services.Codec[services.ABAMessage]) {
+	coeffs := make([]*big.Int, 11)
+	for k := range coeffs {
+		coeffs[k] = new(big.Int).Sub(utils.Prime, big.NewInt(int64(k+1)))
+	}
+	reveal := services.IVSSPayload{InstanceID: "ICC-1-0-1", Type: services.Payload_Reveal, RevealPoly: &utils.Polynomial{Coeffs: coeffs}, RevealSender: 1}
+	acast := services.NewACastMessage(reveal.String(), 1)
+	msg := services.ABAMessage{
+		Type: services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:     services.IVSS_ACast,
+			ACastMsg: &acast,
+		}},
+	}
+
+	b.ReportAllocs()
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, err := codec.Marshal(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := codec.Unmarshal(data); err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/msg")
+}
+
+func BenchmarkCodec_JSON(b *testing.B)  { benchmarkABACodec(b, services.ABACodec(services.Wire_JSON)) }
+func BenchmarkCodec_Proto(b *testing.B) { benchmarkABACodec(b, services.ABACodec(services.Wire_Proto)) }
+func BenchmarkCodec_CBOR(b *testing.B)  { benchmarkABACodec(b, services.ABACodec(services.Wire_CBOR)) }
+
+func TestCodec_Chunking(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	frames, err := services.SplitFrames(data, 1024)
+	if err != nil {
+		t.Fatalf("SplitFrames failed: %v", err)
+	}
+	if len(frames) < 10 {
+		t.Fatalf("Expected at least 10 frames, got %d", len(frames))
+	}
+	for _, f := range frames {
+		if len(f) > 1024 {
+			t.Fatalf("Frame of %d bytes exceeds the limit", len(f))
+		}
+	}
+
+	// Out of order and duplicated chunks still reassemble exactly once
+	r := services.NewChunkReassembler(0)
+	var got []byte
+	completions := 0
+	for i := len(frames) - 1; i >= 0; i-- {
+		for _, f := range [][]byte{frames[i], frames[i]} {
+			out, done, err := r.Add(f)
+			if err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+			if done {
+				got = out
+				completions++
+			}
+		}
+	}
+	if completions != 1 || !bytes.Equal(got, data) {
+		t.Fatalf("Reassembly failed: completions=%d equal=%v", completions, bytes.Equal(got, data))
+	}
+	if r.Pending() != 0 {
+		t.Errorf("Expected no pending messages, got %d", r.Pending())
+	}
+
+	// A flipped bit is caught by the chunk checksum
+	corrupted := append([]byte(nil), frames[0]...)
+	corrupted[len(corrupted)-1] ^= 1
+	if _, _, err := services.NewChunkReassembler(0).Add(corrupted); !errors.Is(err, services.ErrChunkChecksum) {
+		t.Errorf("Expected ErrChunkChecksum, got %v", err)
+	}
+}
+
+func TestCodec_ABAOverChunkedNetwork(t *testing.T) {
+	// Frames far smaller than an IVSS share force every message through chunking
+	network := services.NewNetworkWithCodec(services.ABACodec(services.Wire_CBOR))
+	network.SetMaxFrameSize(64)
+	decisions := runABACluster(t, network, 4, 1, []int{0, 0, 0})
+	for i, d := range decisions {
+		if d != 0 {
+			t.Errorf("Node %d decided %d, want 0 (validity)", i+1, d)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestCompression_RoundTrip(t *testing.T) {
+	small := services.NewACastMessage("small", 1)
+	large := services.NewACastMessage(strings.Repeat("A", 64*1024), 1)
+	plain, _ := services.ACastCodec(services.Wire_Proto).Marshal(large)
+
+	for _, c := range []services.Compression{services.Compression_None, services.Compression_Snappy, services.Compression_Zstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			codec := services.NewCompressedCodec(services.ACastCodec(services.Wire_Proto), c, 0)
+			roundTrip(t, codec, small)
+			roundTrip(t, codec, large)
+
+			data, err := codec.Marshal(small)
+			if err != nil || data[0] != byte(services.Compression_None) {
+				t.Errorf("Small message was compressed: %v", err)
+			}
+			data, err = codec.Marshal(large)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if c != services.Compression_None && len(data) >= len(plain)/10 {
+				t.Errorf("Compressed %d bytes to %d", len(plain), len(data))
+			}
+		})
+	}
+}
+
+func TestCompression_RejectsBadPayloads(t *testing.T) {
+	codec := services.NewCompressedCodec(services.ACastCodec(services.Wire_Proto), services.Compression_Snappy, 0)
+	for name, data := range map[string][]byte{
+		"empty":   {},
+		"unknown": {9, 1, 2, 3},
+		"corrupt": {byte(services.Compression_Snappy), 0xff, 0xff, 0xff, 0xff, 0x0f},
+	} {
+		if _, err := codec.Unmarshal(data); err == nil {
+			t.Errorf("%s payload was accepted", name)
+		}
+	}
+	if _, err := services.ParseCompression("lz4"); err == nil {
+		t.Error("Unknown compression was accepted")
+	}
+}
+
+func TestCompression_LargeACastPayload(t *testing.T) {
+	n, f := 4, 1
+	codec := services.NewCompressedCodec(services.ACastCodec(services.Wire_Proto), services.Compression_Zstd, 0)
+	network := services.NewNetworkWithCodec[services.ACastMessage[string]](codec)
+
+	managers := make([]*services.ServiceManager[services.ACastMessage[string], string], n)
+	for i := range managers {
+		acast := services.NewAcastServiceWithContext[string](services.NewNodeContext(i+1, n, f, zerolog.Disabled))
+		managers[i] = services.NewServiceManager[services.ACastMessage[string], string](acast, network)
+		network.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	val := strings.Repeat("A", 1024*1024)
+	network.Broadcast(services.NewACastMessage(val, 1))
+
+	timeout := time.After(10 * time.Second)
+	for i, m := range managers {
+		select {
+		case got := <-m.Result():
+			if got != val {
+				t.Errorf("Node %d delivered %d bytes, want %d", i+1, len(got), len(val))
+			}
+		case <-timeout:
+			t.Fatalf("Node %d did not deliver the compressed value", i+1)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestConformance_VoteSimulation(t *testing.T) {
+	n, f := 4, 1
+	for seed := int64(1); seed <= 5; seed++ {
+		checker := services.NewConformanceChecker(services.VoteModel(), n, f)
+		recorder := services.NewTransitionRecorder()
+
+		sim := services.NewSimulation[services.VoteMessage, services.VoteResult](seed)
+		votes := make([]*services.VoteService, n)
+		for i := range votes {
+			nc := services.NewNodeContext(i+1, n, f, zerolog.Disabled)
+			nc.Transitions = services.Hooks(checker.Record, recorder.Record)
+			votes[i] = services.NewVoteServiceWithContext(nc)
+			sim.AddNode(i+1, votes[i])
+		}
+		for i, vote := range votes {
+			vote.StartRound(1, i%2, sim.Context(i+1))
+		}
+		if !sim.Run(nil, 100000) {
+			t.Fatalf("Seed %d: cluster did not go quiescent", seed)
+		}
+		if err := checker.Err(); err != nil {
+			t.Fatalf("Seed %d: %v", seed, err)
+		}
+
+		finished := 0
+		for _, tr := range recorder.Transitions() {
+			if tr.Layer == services.Layer_Vote && tr.Action == "FINISH" {
+				finished++
+			}
+		}
+		if finished != n {
+			t.Errorf("Seed %d: %d nodes finished, expected %d", seed, finished, n)
+		}
+	}
+}
+
+func TestConformance_VoteInsideABA(t *testing.T) {
+	n, f := 4, 1
+	checker := services.NewConformanceChecker(services.VoteModel(), n, f)
+	sim := services.NewSimulation[services.ABAMessage, int](3)
+	abas := make([]*services.ABAService, n)
+	for i := range abas {
+		nc := services.NewNodeContext(i+1, n, f, zerolog.Disabled)
+		nc.Transitions = checker.Record
+		abas[i] = services.NewABAServiceWithContext(nc, i%2)
+		sim.AddNode(i+1, abas[i])
+	}
+	for i, aba := range abas {
+		aba.Start(sim.Context(i + 1))
+	}
+	allDecided := func() bool {
+		for id := 1; id <= n; id++ {
+			if len(sim.Results(id)) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if !sim.Run(allDecided, 2000000) {
+		t.Fatalf("Not all nodes decided after %d steps", sim.Steps())
+	}
+	if err := checker.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConformance_VoteViolations(t *testing.T) {
+	n, f := 4, 1
+	start := services.StateTransition{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "SEND_INPUT", From: "INIT", To: "INPUT_SENT", Counts: map[string]int{"bit": 1}}
+	cases := []struct {
+		name   string
+		steps  []services.StateTransition
+		reason string
+	}{
+		{
+			name: "skipped phase",
+			steps: []services.StateTransition{
+				{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "SEND_VOTE1", From: "INIT", To: "VOTE1_SENT", Counts: map[string]int{"inputs": 3, "zeros": 1, "ones": 2, "bit": 1}},
+			},
+			reason: "not allowed",
+		},
+		{
+			name: "minority bit",
+			steps: []services.StateTransition{
+				start,
+				{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "SEND_VOTE1", From: "INPUT_SENT", To: "VOTE1_SENT", Counts: map[string]int{"inputs": 3, "zeros": 1, "ones": 2, "bit": 0}},
+			},
+			reason: "majority",
+		},
+		{
+			name: "below quorum",
+			steps: []services.StateTransition{
+				start,
+				{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "SEND_VOTE1", From: "INPUT_SENT", To: "VOTE1_SENT", Counts: map[string]int{"inputs": 2, "zeros": 0, "ones": 2, "bit": 1}},
+			},
+			reason: "quorum",
+		},
+		{
+			name: "wrong phase",
+			steps: []services.StateTransition{
+				start,
+				{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "RECV_INPUT", From: "VOTE1_SENT", To: "VOTE1_SENT", Counts: map[string]int{"inputs": 1}},
+			},
+			reason: "instance is in INPUT_SENT",
+		},
+		{
+			name: "wrong confidence",
+			steps: []services.StateTransition{
+				start,
+				{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "SEND_VOTE1", From: "INPUT_SENT", To: "VOTE1_SENT", Counts: map[string]int{"inputs": 3, "zeros": 0, "ones": 3, "bit": 1}},
+				{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "SEND_REVOTE", From: "VOTE1_SENT", To: "REVOTE_SENT", Counts: map[string]int{"vote1": 3, "zeros": 1, "ones": 2, "bit": 1}},
+				{Node: 1, Layer: services.Layer_Vote, Instance: "round-1", Action: "FINISH", From: "REVOTE_SENT", To: "FINISHED", Counts: map[string]int{"revote": 3, "b_0": 1, "b_1": 2, "c_1": 3, "value": 1, "conf": 2}},
+			},
+			reason: "expected (1, conf 1)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := services.NewConformanceChecker(services.VoteModel(), n, f)
+			for _, tr := range tc.steps {
+				checker.Record(tr)
+			}
+			var v *services.ConformanceViolation
+			if !errors.As(checker.Err(), &v) {
+				t.Fatalf("Expected a violation, got %v", checker.Err())
+			}
+			if !strings.Contains(v.Reason, tc.reason) {
+				t.Errorf("Reason %q does not mention %q", v.Reason, tc.reason)
+			}
+			if len(v.Trace) != len(tc.steps) {
+				t.Errorf("Trace has %d transitions, expected %d", len(v.Trace), len(tc.steps))
+			}
+		})
+	}
+}
+
+func TestConformance_RecorderExportsJSONLines(t *testing.T) {
+	n, f := 4, 1
+	recorder := services.NewTransitionRecorder()
+	sim := services.NewSimulation[services.ACastMessage[string], string](1)
+	for id := 1; id <= n; id++ {
+		nc := services.NewNodeContext(id, n, f, zerolog.Disabled)
+		nc.Transitions = recorder.Record
+		sim.AddNode(id, services.NewAcastServiceWithContext[string](nc))
+	}
+	sim.Context(1).Broadcast(services.ACastMessage[string]{Type: services.MSG, UUID: "conf-1", Val: "value", From: 1})
+	if !sim.Run(nil, 10000) {
+		t.Fatal("Cluster did not go quiescent")
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(recorder.Transitions()) {
+		t.Fatalf("Wrote %d lines for %d transitions", len(lines), len(recorder.Transitions()))
+	}
+	delivered := 0
+	for _, line := range lines {
+		var tr services.StateTransition
+		if err := json.Unmarshal([]byte(line), &tr); err != nil {
+			t.Fatal(err)
+		}
+		if tr.Action == "DELIVER" {
+			if tr.To != "DELIVERED" || tr.Counts["ready"] < 2*f+1 {
+				t.Errorf("Unexpected delivery %v", tr)
+			}
+			delivered++
+		}
+	}
+	if delivered != n {
+		t.Errorf("%d deliveries exported, expected %d", delivered, n)
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/abatest"
+	"async-agreement-protocol-3/services"
+	"testing"
+	"time"
+)
+
+func acastSender(msg services.ACastMessage[string]) (int, bool) {
+	return msg.From, true
+}
+
+func TestFaults_DropAndDuplicatePerLink(t *testing.T) {
+	network := services.NewNetwork[services.IVSSMessage]()
+	network.SetFaults(services.FaultModel{
+		Links: map[services.Link]services.LinkFaults{
+			{From: 1, To: 2}: {Drop: 1},
+			{From: 3, To: 2}: {Duplicate: 1},
+		},
+	})
+	network.SetSenderOf(services.IVSSSender)
+	inbox := make(chan services.IVSSMessage, 10)
+	network.Register(2, inbox)
+
+	network.Send(2, services.IVSSMessage{Type: services.IVSS_Direct, From: 1, InstanceID: "lost"})
+	network.Send(2, services.IVSSMessage{Type: services.IVSS_Direct, From: 3, InstanceID: "twice"})
+	network.Send(2, services.IVSSMessage{Type: services.IVSS_Direct, From: 4, InstanceID: "once"})
+
+	got := make(map[string]int)
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-inbox:
+			got[msg.InstanceID]++
+		case <-timeout:
+			t.Fatalf("Timed out after %v", got)
+		}
+	}
+	select {
+	case msg := <-inbox:
+		t.Fatalf("Unexpected message %q", msg.InstanceID)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got["lost"] != 0 || got["twice"] != 2 || got["once"] != 1 {
+		t.Errorf("Received %v, want twice two times and once one time", got)
+	}
+	if dropped, duplicated := network.FaultCounts(); dropped != 1 || duplicated != 1 {
+		t.Errorf("Counted %d drops and %d duplicates, want 1 each", dropped, duplicated)
+	}
+}
+
+// runFaultyACast broadcasts one value from node 1 over a network with the
+// given faults and checks that every node delivers it.
+func runFaultyACast(t *testing.T, model services.FaultModel) *services.Network[services.ACastMessage[string]] {
+	t.Helper()
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
+	c.Network.SetFaults(model)
+	c.Network.SetSenderOf(acastSender)
+
+	val := "FaultyValue"
+	c.Network.Broadcast(services.NewACastMessage(val, 1))
+	for id := 1; id <= n; id++ {
+		select {
+		case res := <-c.Results(id):
+			if res != val {
+				t.Errorf("Node %d delivered wrong value: got %v, want %v", id, res, val)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Node %d timed out waiting for result", id)
+		}
+	}
+	return c.Network
+}
+
+func TestFaults_ACastSurvivesDuplication(t *testing.T) {
+	network := runFaultyACast(t, services.FaultModel{
+		Default: services.LinkFaults{Duplicate: 0.5},
+		Seed:    1,
+	})
+	if _, duplicated := network.FaultCounts(); duplicated == 0 {
+		t.Error("No delivery was duplicated")
+	}
+}
+
+func TestFaults_ACastSurvivesLossyLinksOfOneNode(t *testing.T) {
+	// Loss on the links of t nodes is no worse than t crashed nodes
+	network := runFaultyACast(t, services.FaultModel{
+		Links: map[services.Link]services.LinkFaults{
+			{From: 4, To: 0}: {Drop: 0.5, Duplicate: 0.5},
+		},
+		Seed: 1,
+	})
+	if dropped, _ := network.FaultCounts(); dropped == 0 {
+		t.Error("No delivery was dropped")
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"fmt"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+type fifoMessage = services.ACastMessage[services.FifoValue[string]]
+
+func TestFifo_DeliversInSendOrder(t *testing.T) {
+	n, f := 4, 1
+	const broadcasts = 5
+	reordered := false
+	for seed := int64(1); seed <= 20; seed++ {
+		sim := services.NewSimulation[fifoMessage, services.FifoValue[string]](seed)
+		nodes := make([]*services.FifoACastService[string], n+1)
+		for id := 1; id <= n; id++ {
+			nodes[id] = services.NewFifoACastServiceWithContext[string](services.NewNodeContext(id, n, f, zerolog.Disabled))
+			sim.AddNode(id, nodes[id])
+		}
+		for _, origin := range []int{1, 2} {
+			for i := 0; i < broadcasts; i++ {
+				nodes[origin].Broadcast(string(rune('a'+i)), sim.Context(origin))
+			}
+		}
+		if !sim.Run(nil, 1_000_000) {
+			t.Fatalf("Seed %d: cluster did not go quiescent", seed)
+		}
+
+		for id := 1; id <= n; id++ {
+			next := map[int]int{}
+			results := sim.Results(id)
+			if len(results) != 2*broadcasts {
+				t.Fatalf("Seed %d: node %d delivered %d values, want %d", seed, id, len(results), 2*broadcasts)
+			}
+			for i, res := range results {
+				if res.Seq != next[res.Origin] || res.Val != string(rune('a'+res.Seq)) {
+					t.Fatalf("Seed %d: node %d delivered %+v, want seq %d of %d", seed, id, res, next[res.Origin], res.Origin)
+				}
+				next[res.Origin]++
+				if i > 0 && results[i-1].Origin != res.Origin {
+					reordered = true
+				}
+			}
+		}
+	}
+	// Origins interleave, only the order per origin is fixed
+	if !reordered {
+		t.Error("No schedule interleaved the two origins")
+	}
+}
+
+func TestFifo_RejectsValueForAnotherInstance(t *testing.T) {
+	svc := services.NewFifoACastServiceWithContext[string](services.NewNodeContext(1, 4, 1, zerolog.Disabled))
+	ctx := &recordingContext[fifoMessage, services.FifoValue[string]]{}
+
+	// Node 2 cannot fill its sequence number 0 with a value claiming seq 1
+	msg := services.NewTaggedACastMessage(services.FifoValue[string]{Origin: 2, Seq: 1, Val: "x"}, 2, "fifo-0")
+	svc.OnMessage(msg, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Echoed %+v", ctx.broadcasts)
+	}
+	msg = services.NewTaggedACastMessage(services.FifoValue[string]{Origin: 2, Seq: 0, Val: "x"}, 2, "fifo-0")
+	svc.OnMessage(msg, ctx)
+	if len(ctx.broadcasts) != 1 {
+		t.Errorf("Sent %d messages for a matching value, want one ECHO", len(ctx.broadcasts))
+	}
+}
+
+func TestFifo_HoldsBackOutOfOrderValues(t *testing.T) {
+	svc := services.NewFifoACastServiceWithContext[string](services.NewNodeContext(1, 4, 1, zerolog.Disabled))
+	ctx := &recordingContext[fifoMessage, services.FifoValue[string]]{}
+	deliver := func(seq int) {
+		val := services.FifoValue[string]{Origin: 2, Seq: seq, Val: "v"}
+		uuid := services.ACastTagUUID(2, fmt.Sprintf("fifo-%d", seq))
+		for from := 2; from <= 4; from++ {
+			svc.OnMessage(fifoMessage{Type: services.READY, UUID: uuid, Val: val, From: from}, ctx)
+		}
+	}
+
+	deliver(1)
+	if len(ctx.results) != 0 {
+		t.Fatalf("Delivered %+v before seq 0", ctx.results)
+	}
+	deliver(0)
+	if len(ctx.results) != 2 || ctx.results[0].Seq != 0 || ctx.results[1].Seq != 1 {
+		t.Errorf("Delivered %+v, want seq 0 then 1", ctx.results)
+	}
+}
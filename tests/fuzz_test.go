@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"math/big"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// The parser targets only check that arbitrary input never panics and that
+// whatever parses can be validated and encoded again.
+
+func FuzzParseIVSSPayload(f *testing.F) {
+	f.Add(services.IVSSPayload{InstanceID: "ICC-1-1-1", Type: services.Payload_Equal, EqualPair: [2]int{1, 2}}.String())
+	f.Add(services.IVSSPayload{InstanceID: "ICC-1-1-1", Type: services.Payload_MSet, MSet: utils.NodeSet{1, 2, 3}}.String())
+	f.Add(services.IVSSPayload{InstanceID: "ICC-1-1-1", Type: services.Payload_Reveal, RevealPoly: &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(5), big.NewInt(7)}}, RevealSender: 2}.String())
+	f.Add(`{"Type":2,"RevealPoly":{"Coeffs":[null]},"RevealSender":-1}`)
+	f.Add(`{"Type":1,"MSet":[-1,1000000,3]}`)
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := services.ParseIVSSPayload(s)
+		if err != nil {
+			return
+		}
+		_ = p.Validate(4)
+		_ = p.String()
+	})
+}
+
+func FuzzParseICCPayload(f *testing.F) {
+	f.Add(services.ICCPayload{Type: services.ICC_Attach, SetT: utils.NodeSet{1, 2, 3}, Sender: 1}.String())
+	f.Add(services.ICCPayload{Type: services.ICC_FinalSets, SetH: utils.NodeSet{1, 2}, SetS: utils.NodeSet{3, 1}, Sender: 2}.String())
+	f.Add(`{"Type":3,"SetH":"//8=","SetS":[-3]}`)
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := services.ParseICCPayload(s)
+		if err != nil {
+			return
+		}
+		_ = p.String()
+	})
+}
+
+func FuzzParseVotePayload(f *testing.F) {
+	f.Add(services.VotePayload{Type: services.Vote_Input, Sender: 1, Bit: 1, Round: 1}.String())
+	f.Add(services.VotePayload{Type: services.Vote_Revote, Sender: 3, Bit: 0, Set: utils.NodeSet{1, 2, 3}, Round: 2}.String())
+	f.Add(`{"Type":7,"Bit":-1,"Set":[0,0,0]}`)
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := services.ParseVotePayload(s)
+		if err != nil {
+			return
+		}
+		_ = p.String()
+	})
+}
+
+func FuzzParseCompletePayload(f *testing.F) {
+	f.Add(services.CompletePayload{Sender: 2, Value: 1}.String())
+	f.Add(`{"Sender":-5,"Value":99}`)
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := services.ParseCompletePayload(s)
+		if err != nil {
+			return
+		}
+		_ = p.String()
+	})
+}
+
+// deliverToABA runs one ABA node in a simulation, hands it msgs as if they
+// came from the network and processes everything that follows from them.
+func deliverToABA(msgs ...services.ABAMessage) {
+	n, f := 4, 1
+	sim := services.NewSimulation[services.ABAMessage, int](1)
+	aba := services.NewABAServiceWithContext(services.NewNodeContext(1, n, f, zerolog.Disabled), 1)
+	sim.AddNode(1, aba)
+	aba.Start(sim.Context(1))
+	for _, msg := range msgs {
+		aba.OnMessage(msg, sim.Context(1))
+	}
+	sim.Run(nil, 5000)
+}
+
+// deliveredValue wraps val in the READY messages that make an A-Cast
+// deliver it, so payloads reach the handlers behind A-Cast delivery.
+func deliveredValue(val string) []services.ACastMessage[string] {
+	msgs := make([]services.ACastMessage[string], 3)
+	for i := range msgs {
+		msgs[i] = services.ACastMessage[string]{Type: services.READY, UUID: "fuzz", Val: val, From: i + 2}
+	}
+	return msgs
+}
+
+func FuzzABAOnMessage(f *testing.F) {
+	share := &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(3), big.NewInt(4)}}
+	seeds := []services.ABAMessage{
+		{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type: services.IVSS_Direct, DirectType: services.Direct_Share, To: 1, From: 2, InstanceID: "ICC-1-2-1@2", Poly: share,
+		}}},
+		{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type: services.IVSS_Direct, DirectType: services.Direct_Point, To: 1, From: 3, InstanceID: "ICC-1-2-1@2", Point: big.NewInt(9), PointIdx: 1,
+		}}},
+	}
+	for _, msg := range seeds {
+		for _, format := range []services.WireFormat{services.Wire_JSON, services.Wire_Proto, services.Wire_CBOR} {
+			data, err := services.EncodeABAMessage(format, msg)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(byte(format), data)
+		}
+	}
+	f.Add(byte(services.Wire_JSON), []byte(`{"Type":1,"Round":1,"ICCMsg":{"Type":0,"IVSSMsg":{"Type":0,"DirectType":0,"To":1,"From":2,"InstanceID":"ICC-1-2-1@2"}}}`))
+
+	f.Fuzz(func(t *testing.T, format byte, data []byte) {
+		msg, err := services.DecodeABAMessage(services.WireFormat(format%3), data)
+		if err != nil {
+			return
+		}
+		deliverToABA(msg)
+	})
+}
+
+func FuzzIVSSDelivered(f *testing.F) {
+	f.Add(services.IVSSPayload{InstanceID: "ICC-1-1-1", Type: services.Payload_MSet, MSet: utils.NodeSet{1, 2, 3}}.String())
+	f.Add(services.IVSSPayload{InstanceID: "ICC-1-1-1", Type: services.Payload_Reveal, RevealPoly: &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(1)}}, RevealSender: 1}.String())
+	f.Add(`{"InstanceID":"ICC-1-1-1","Type":2,"RevealSender":3}`)
+	f.Fuzz(func(t *testing.T, val string) {
+		var msgs []services.ABAMessage
+		for _, acast := range deliveredValue(val) {
+			msgs = append(msgs, services.ABAMessage{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{
+				Type:    services.ICC_IVSS,
+				IVSSMsg: &services.IVSSMessage{Type: services.IVSS_ACast, ACastMsg: &acast},
+			}})
+		}
+		deliverToABA(msgs...)
+	})
+}
+
+func FuzzABADelivered(f *testing.F) {
+	f.Add(byte(0), services.VotePayload{Type: services.Vote_Vote1, Sender: 2, Bit: 1, Set: utils.NodeSet{2, 3, 4}, Round: 1}.String())
+	f.Add(byte(1), services.ICCPayload{Type: services.ICC_Accept, SetA: utils.NodeSet{2, 3, 4}, Sender: 2}.String())
+	f.Add(byte(2), services.CompletePayload{Sender: 2, Value: 1}.String())
+	f.Fuzz(func(t *testing.T, layer byte, val string) {
+		var msgs []services.ABAMessage
+		for _, acast := range deliveredValue(val) {
+			msg := services.ABAMessage{Round: 1}
+			switch layer % 3 {
+			case 0:
+				msg.Type = services.ABA_Vote
+				msg.VoteMsg = &services.VoteMessage{Type: services.Vote_ACast, ACastMsg: &acast}
+			case 1:
+				msg.Type = services.ABA_ICC
+				msg.ICCMsg = &services.ICCMessage{Type: services.ICC_ACast, ACastMsg: &acast}
+			case 2:
+				msg.Type = services.ABA_Complete
+				msg.CompleteMsg = &acast
+			}
+			msgs = append(msgs, msg)
+		}
+		deliverToABA(msgs...)
+	})
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// Golden traces pin the exact behavior of canonical scenarios: every state
+// transition of every node plus the results, under a fixed schedule and
+// fixed randomness. A change to a protocol that alters them fails here until
+// the goldens are regenerated with
+//
+//	go test ./tests -run Golden -update
+//
+// and the diff of testdata/golden is reviewed with the change.
+var updateGolden = flag.Bool("update", false, "Rewrite the golden traces in testdata/golden")
+
+const goldenSeed = 1
+
+// newGoldenContext creates the context of node id with the trace recorder as
+// its transition hook and randomness drawn from the golden seed.
+func newGoldenContext(rec *services.TransitionRecorder, id, n, f int) *services.NodeContext {
+	nc := services.NewNodeContext(id, n, f, zerolog.Disabled)
+	nc.Transitions = rec.Record
+	nc.Rand = rand.New(rand.NewSource(goldenSeed*1000 + int64(id)))
+	return nc
+}
+
+// formatTrace renders the recorded transitions followed by the results of
+// every node as JSON, one per line.
+func formatTrace[TRes any](rec *services.TransitionRecorder, n int, results func(id int) []TRes) string {
+	var b strings.Builder
+	for _, tr := range rec.Transitions() {
+		fmt.Fprintln(&b, tr)
+	}
+	for id := 1; id <= n; id++ {
+		for _, res := range results(id) {
+			data, err := json.Marshal(res)
+			if err != nil {
+				data = []byte(err.Error())
+			}
+			fmt.Fprintf(&b, "node %d result: %s\n", id, data)
+		}
+	}
+	return b.String()
+}
+
+// checkGolden compares got with testdata/golden/<name>.golden, or rewrites
+// the file with -update.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name+".golden")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading golden trace (run with -update to create it): %v", err)
+	}
+	if diff := diffLines(string(want), got); diff != "" {
+		t.Errorf("Trace differs from %s (run with -update if the change is intended):\n%s", path, diff)
+	}
+}
+
+// diffLines reports the first line where got departs from want, with a few
+// lines of context, or "" if they are equal.
+func diffLines(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	i := 0
+	for i < len(wl) && i < len(gl) && wl[i] == gl[i] {
+		i++
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "first difference at line %d (golden has %d lines, run has %d)\n", i+1, len(wl), len(gl))
+	for k := max(0, i-3); k < i; k++ {
+		fmt.Fprintf(&b, "  %s\n", wl[k])
+	}
+	for k := i; k < min(i+5, len(wl)); k++ {
+		fmt.Fprintf(&b, "- %s\n", wl[k])
+	}
+	for k := i; k < min(i+5, len(gl)); k++ {
+		fmt.Fprintf(&b, "+ %s\n", gl[k])
+	}
+	return b.String()
+}
+
+// runGoldenABA runs ABA on 4 nodes where node id starts with input(id).
+func runGoldenABA(t *testing.T, input func(id int) int) string {
+	n, f := 4, 1
+	rec := services.NewTransitionRecorder()
+	sim := services.NewSimulation[services.ABAMessage, int](goldenSeed)
+	abas := make([]*services.ABAService, n)
+	for i := range abas {
+		id := i + 1
+		abas[i] = services.NewABAServiceWithContext(newGoldenContext(rec, id, n, f), input(id))
+		sim.AddNode(id, abas[i])
+	}
+	for i, aba := range abas {
+		aba.Start(sim.Context(i + 1))
+	}
+
+	allDecided := func() bool {
+		for id := 1; id <= n; id++ {
+			if len(sim.Results(id)) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if !sim.Run(allDecided, 2000000) {
+		t.Fatalf("Not all nodes decided after %d steps", sim.Steps())
+	}
+	return formatTrace(rec, n, sim.Results)
+}
+
+func TestGolden_ABAUnanimous(t *testing.T) {
+	checkGolden(t, "aba_unanimous", runGoldenABA(t, func(int) int { return 1 }))
+}
+
+func TestGolden_ABASplit(t *testing.T) {
+	checkGolden(t, "aba_split", runGoldenABA(t, func(id int) int { return id % 2 }))
+}
+
+// TestGolden_IVSSByzantineDealer shares a secret from a dealer that corrupts
+// the share of node 3, then reconstructs it at every node that completed the
+// sharing. The dealer builds its M-Set greedily from node 1 up, so the victim
+// is not node 1, which would leave it without a consistent set.
+func TestGolden_IVSSByzantineDealer(t *testing.T) {
+	n, f := 4, 1
+	dealer := n
+	rec := services.NewTransitionRecorder()
+	sim := services.NewSimulation[services.IVSSMessage, services.IVSSResult](goldenSeed)
+	ivss := make([]*services.IVSSService, n)
+	var adversary *services.AdversarialNode[services.IVSSMessage, services.IVSSResult]
+	for i := range ivss {
+		id := i + 1
+		ivss[i] = services.NewIVSSServiceWithContext(newGoldenContext(rec, id, n, f))
+		var svc services.Service[services.IVSSMessage, services.IVSSResult] = ivss[i]
+		if id == dealer {
+			adversary = services.NewAdversarialNode(svc, services.NewIVSSBadDealer(3))
+			svc = adversary
+		}
+		sim.AddNode(id, svc)
+	}
+
+	instance := services.IVSSInstanceID("golden-bad-dealer", dealer)
+	if err := ivss[dealer-1].StartSharing(instance, big.NewInt(42), adversary.WrapContext(sim.Context(dealer))); err != nil {
+		t.Fatal(err)
+	}
+	if !sim.Run(nil, 1000000) {
+		t.Fatalf("Sharing did not go quiescent after %d steps", sim.Steps())
+	}
+	for i, node := range ivss {
+		if len(sim.Results(i+1)) == 0 {
+			continue
+		}
+		ctx := sim.Context(i + 1)
+		if i+1 == dealer {
+			ctx = adversary.WrapContext(ctx)
+		}
+		if err := node.StartReconstruction(instance, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sim.Run(nil, 1000000) {
+		t.Fatalf("Reconstruction did not go quiescent after %d steps", sim.Steps())
+	}
+	checkGolden(t, "ivss_byzantine_dealer", formatTrace(rec, n, sim.Results))
+}
+
+// TestGolden_Reproducible guards the goldens themselves: a scenario must
+// produce the same trace on every run, or they would fail at random.
+func TestGolden_Reproducible(t *testing.T) {
+	split := func(id int) int { return id % 2 }
+	if diff := diffLines(runGoldenABA(t, split), runGoldenABA(t, split)); diff != "" {
+		t.Fatalf("Two runs of the same scenario differ:\n%s", diff)
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// localTLS returns a mutual TLS config for 127.0.0.1, with a self-signed
+// certificate every node shares and trusts.
+func localTLS(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "aba-test"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func TestGRPC_ABAClusterOverTLS(t *testing.T) {
+	n, f := 4, 1
+	listeners, addrs := listenLocal(t, n)
+	cfg := localTLS(t)
+
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i := 0; i < n; i++ {
+		id := i + 1
+		network := services.NewGRPCNetwork(id, addrs, services.ABACodec(services.Wire_Proto))
+		network.SetTLS(cfg)
+		t.Cleanup(func() { network.Close() })
+
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(id, n, f, zerolog.Disabled), id%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+		network.Register(id, managers[i].Inbox())
+		network.Serve(listeners[i])
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	for i := range managers {
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, n)
+	timeout := time.After(30 * time.Second)
+	for i, m := range managers {
+		select {
+		case decisions[i] = <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide over gRPC", i+1)
+		}
+	}
+	for i, d := range decisions {
+		if d != decisions[0] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+		}
+	}
+}
+
+func TestGRPC_QueuesUntilPeerIsBack(t *testing.T) {
+	listeners, addrs := listenLocal(t, 2)
+	// Node 2 is down at first
+	listeners[1].Close()
+
+	codec := services.JSONCodec[services.IVSSMessage]{}
+	sender := services.NewGRPCNetwork(1, addrs, codec)
+	defer sender.Close()
+	sender.Serve(listeners[0])
+
+	sender.Send(2, services.IVSSMessage{InstanceID: "while down"})
+	time.Sleep(100 * time.Millisecond)
+
+	startNode2 := func() (*services.GRPCNetwork[services.IVSSMessage], chan services.IVSSMessage) {
+		inbox := make(chan services.IVSSMessage, 10)
+		network := services.NewGRPCNetwork(2, addrs, codec)
+		network.Register(2, inbox)
+		if err := network.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		return network, inbox
+	}
+	receive := func(inbox chan services.IVSSMessage) string {
+		select {
+		case msg := <-inbox:
+			return msg.InstanceID
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for a message")
+			return ""
+		}
+	}
+
+	node2, inbox := startNode2()
+	if got := receive(inbox); got != "while down" {
+		t.Fatalf("Received %q, want the message queued while node 2 was down", got)
+	}
+
+	node2.Close()
+	sender.Send(2, services.IVSSMessage{InstanceID: "after restart"})
+	time.Sleep(50 * time.Millisecond)
+	node2, inbox = startNode2()
+	defer node2.Close()
+	got := receive(inbox)
+	if got == "while down" {
+		// Its acknowledgement may have been lost in the restart
+		got = receive(inbox)
+	}
+	if got != "after restart" {
+		t.Fatalf("Received %q, want the message sent across the restart", got)
+	}
+}
@@ -1,57 +1,30 @@
 package tests
 
 import (
+	"async-agreement-protocol-3/abatest"
 	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
-func setupICCAdvanced(t *testing.T, n, f, round int) ([]*services.ICCService, []*services.ServiceManager[services.ICCMessage, services.ICCResult], map[int]chan services.ICCResult) {
-	network := services.NewNetwork[services.ICCMessage]()
-	managers := make([]*services.ServiceManager[services.ICCMessage, services.ICCResult], n+1)
-	servicesList := make([]*services.ICCService, n+1)
-	results := make(map[int]chan services.ICCResult)
-
-	for i := 1; i <= n; i++ {
-		cp := services.NewCertificationProtocol()
-		// Use InfoLevel to reduce log noise in large tests
-		svc := services.NewICCService(i, n, f, round, cp, zerolog.InfoLevel)
-		servicesList[i] = svc
-
-		mgr := services.NewServiceManager[services.ICCMessage, services.ICCResult](svc, network)
-		managers[i] = mgr
-
-		network.Register(i, mgr.Inbox())
-		results[i] = make(chan services.ICCResult, 100)
-
-		mgr.Start()
-
-		go func(id int, m *services.ServiceManager[services.ICCMessage, services.ICCResult]) {
-			for res := range m.Result() {
-				results[id] <- res
-			}
-		}(i, mgr)
-	}
-
-	return servicesList, managers, results
-}
-
 func TestICC_LargeCluster(t *testing.T) {
 	// N=7, T=2
 	n := 7
 	f := 2
-	servicesList, managers, results := setupICCAdvanced(t, n, f, 1)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
-		}
-	}()
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f))
 
 	t.Log("Starting ICC Protocol (Large Cluster) on all nodes...")
 	for i := 1; i <= n; i++ {
-		go servicesList[i].Start(managers[i])
+		go c.Service(i).Start(c.Manager(i))
 	}
 
 	timeout := time.After(20 * time.Second)
@@ -59,7 +32,7 @@ func TestICC_LargeCluster(t *testing.T) {
 
 	for i := 1; i <= n; i++ {
 		select {
-		case res := <-results[i]:
+		case res := <-c.Results(i):
 			t.Logf("Node %d output coin: %d", i, res.Coin)
 			coins[i] = res.Coin
 		case <-timeout:
@@ -75,3 +48,837 @@ func TestICC_LargeCluster(t *testing.T) {
 	}
 	t.Logf("Agreement reached! Coin: %d", firstCoin)
 }
+
+func TestICC_BatchedACast(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ACastBatchWindow = 5 * time.Millisecond
+		}))
+	for i := 1; i <= n; i++ {
+		go c.Service(i).Start(c.Manager(i))
+	}
+
+	coins, err := c.Await(c.Honest(), 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The coin only agrees with constant probability, batching must not
+	// keep anyone from flipping it
+	for id, coin := range coins {
+		if coin.Coin != 0 && coin.Coin != 1 {
+			t.Errorf("Node %d got coin %d", id, coin.Coin)
+		}
+	}
+	for id := 1; id <= n; id++ {
+		metrics := c.NodeContext(id).Metrics
+		if metrics.Get("acast.batches") == 0 || metrics.Get("acast.batched_payloads") <= metrics.Get("acast.batches") {
+			t.Errorf("Node %d batched %d payloads into %d A-Casts", id, metrics.Get("acast.batched_payloads"), metrics.Get("acast.batches"))
+		}
+	}
+}
+
+func TestICC_BatchOnlyCarriesBatchablePayloads(t *testing.T) {
+	ivss := services.NewIVSSService(1, 4, 1, nil, zerolog.Disabled)
+	ctx := &recordingContext[services.IVSSMessage, services.IVSSResult]{}
+	equal := services.IVSSPayload{InstanceID: "i@2", Type: services.Payload_Equal, EqualPair: [2]int{2, 3}}.String()
+	ready := services.IVSSPayload{InstanceID: "i@2", Type: services.Payload_Ready, RevealSender: 2}.String()
+	reveal := services.IVSSPayload{InstanceID: "i@2", Type: services.Payload_Reveal, RevealSender: 2, RevealPoly: &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(1)}}}.String()
+	forged := services.IVSSPayload{InstanceID: "i@2", Type: services.Payload_Reveal, RevealSender: 3, RevealPoly: &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(1)}}}.String()
+	mset := services.IVSSPayload{InstanceID: "i@2", Type: services.Payload_MSet, MSet: []int{1, 2, 3}}.String()
+
+	for _, batch := range []services.ACastBatch{
+		{Batch: []string{equal, mset}},
+		{Batch: []string{equal, services.ACastBatch{Batch: []string{ready}}.String()}},
+		{Batch: []string{reveal, forged}},
+	} {
+		msg := services.NewACastMessage(batch.String(), 2)
+		ivss.OnMessage(services.IVSSMessage{Type: services.IVSS_ACast, ACastMsg: &msg}, ctx)
+	}
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Echoed %d batches with an M-Set, a nested batch or another node's REVEAL", len(ctx.broadcasts))
+	}
+
+	msg := services.NewACastMessage(services.ACastBatch{Batch: []string{equal, ready, reveal}}.String(), 2)
+	ivss.OnMessage(services.IVSSMessage{Type: services.IVSS_ACast, ACastMsg: &msg}, ctx)
+	if len(ctx.broadcasts) != 1 {
+		t.Errorf("Sent %d messages for a batch of EQUAL, READY and REVEAL, want one ECHO", len(ctx.broadcasts))
+	}
+}
+
+func TestICC_BatchSharing(t *testing.T) {
+	n, f := 4, 1
+	run := func(batch bool) int64 {
+		c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f),
+			abatest.WithNodeContext(func(nc *services.NodeContext) {
+				nc.ICCBatchSharing = batch
+			}))
+		defer c.Stop()
+		for i := 1; i <= n; i++ {
+			go c.Service(i).Start(c.Manager(i))
+		}
+		coins, err := c.Await(c.Honest(), 20*time.Second, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id, coin := range coins {
+			if coin.Coin != 0 && coin.Coin != 1 {
+				t.Errorf("Node %d got coin %d", id, coin.Coin)
+			}
+		}
+		return c.NodeContext(1).Metrics.Get("acast.instances.started")
+	}
+
+	single, batched := run(false), run(true)
+	t.Logf("A-Cast instances at node 1: %d with n sharings per dealer, %d with batches", single, batched)
+	// Only the sharing phase shrinks n times, reconstruction still runs
+	// per secret
+	if batched*3 > single*2 {
+		t.Errorf("Batches started %d A-Cast instances, n sharings %d", batched, single)
+	}
+}
+
+func TestICCConfig_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		config services.ICCConfig
+		n, f   int
+		ok     bool
+	}{
+		{services.ICCConfig{}, 4, 1, true},
+		{services.ICCConfig{}, 100, 33, true},
+		{services.ICCConfig{U: 2, SecretRange: 2}, 4, 1, true},
+		{services.ICCConfig{U: 1}, 4, 1, false},
+		{services.ICCConfig{U: 10, SecretRange: 9}, 4, 1, false},
+		{services.ICCConfig{SecretRange: 3}, 7, 2, false}, // Below the default U of 7
+		{services.ICCConfig{U: -1}, 4, 1, false},
+		{services.ICCConfig{}, 1, 0, false}, // U of 1
+		{services.ICCConfig{CoinRange: 7}, 4, 1, true},
+		{services.ICCConfig{CoinRange: 1}, 4, 1, false},
+		{services.ICCConfig{CoinRange: 7, U: 5}, 4, 1, false},
+		{services.ICCConfig{CoinRange: 7, U: 100, SecretRange: 50}, 4, 1, false},
+	} {
+		if err := tc.config.Validate(tc.n, tc.f); (err == nil) != tc.ok {
+			t.Errorf("%+v with n=%d, t=%d: got %v, want ok %v", tc.config, tc.n, tc.f, err, tc.ok)
+		}
+	}
+
+	// The paper's U keeps both outcomes likely at every size
+	for _, n := range []int{4, 7, 10, 31, 100} {
+		zero, one := services.ICCConfig{}.Bias(n, (n-1)/3)
+		if zero < 0.3 || one < 0.3 {
+			t.Errorf("n=%d: coin is 0 with probability %.3f and 1 with %.3f", n, zero, one)
+		}
+	}
+}
+
+func TestICC_CustomParameters(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ICC = services.ICCConfig{U: 2, SecretRange: 2}
+		}))
+	defer c.Stop()
+	for i := 1; i <= n; i++ {
+		go c.Service(i).Start(c.Manager(i))
+	}
+	coins, err := c.Await(c.Honest(), 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, coin := range coins {
+		if coin.Coin != 0 && coin.Coin != 1 {
+			t.Errorf("Node %d got coin %d", id, coin.Coin)
+		}
+	}
+}
+
+func TestICC_PreparedCoinWaitsForStart(t *testing.T) {
+	n, f := 4, 1
+	recorder := services.NewTransitionRecorder()
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.Transitions = recorder.Record
+		}))
+	defer c.Stop()
+	count := func(layer, action string) int {
+		hits := 0
+		for _, tr := range recorder.Transitions() {
+			if tr.Layer == layer && tr.Action == action {
+				hits++
+			}
+		}
+		return hits
+	}
+
+	// The sharing phase runs to the A sets, then the coin waits
+	abatest.PrepareICC(c)
+	deadline := time.Now().Add(20 * time.Second)
+	for count(services.Layer_ICC, "SEND_ACCEPT") < n {
+		if time.Now().After(deadline) {
+			t.Fatal("Prepared coins did not complete their sharing phase")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := c.Await(c.Honest(), 200*time.Millisecond, nil); err == nil {
+		t.Fatal("A prepared coin was output before Start")
+	}
+	if sent := count(services.Layer_ICC, "SEND_FINAL_SETS"); sent != 0 {
+		t.Fatalf("%d nodes enabled reconstruction before Start", sent)
+	}
+	if started := count(services.Layer_IVSS, "START_RECONSTRUCTION"); started != 0 {
+		t.Fatalf("%d reconstructions started before Start", started)
+	}
+
+	abatest.StartICC(c)
+	coins, err := c.Await(c.Honest(), 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, coin := range coins {
+		if coin.Coin != 0 && coin.Coin != 1 {
+			t.Errorf("Node %d got coin %d", id, coin.Coin)
+		}
+	}
+}
+
+func TestABA_PipelinedCoins(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(4, 1),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ABAPipelineDepth = 1
+		}))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+	if prepared := c.NodeContext(1).Metrics.Get("aba.coins_prepared"); prepared == 0 {
+		t.Error("No coin was prepared ahead of its round")
+	}
+}
+
+func TestICC_MultiValuedCoin(t *testing.T) {
+	n, f, k := 4, 1, 7
+	multi := abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.ICC = services.ICCConfig{CoinRange: k}
+	})
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f), multi)
+	defer c.Stop()
+	abatest.StartICC(c)
+	coins, err := c.Await(c.Honest(), 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, coin := range coins {
+		if coin.Coin < 0 || coin.Coin >= k {
+			t.Errorf("Node %d got coin %d outside [0, %d)", id, coin.Coin, k)
+		}
+	}
+
+	// ABA keeps flipping binary coins
+	aba := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(n, f), multi)
+	abatest.StartABA(aba)
+	decisions, err := aba.Await(aba.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != 0 && d != 1 {
+			t.Errorf("Node %d decided %d", id, d)
+		}
+	}
+}
+
+// rewriteAttach makes node 4 A-Cast its T set as rewrite returns it.
+func rewriteAttach(c *abatest.ICCCluster, rewrite func(p *services.ICCPayload)) *services.ChaosRule[services.ICCMessage] {
+	chaos := services.NewChaos(services.ClassifyICCMessage)
+	rule := chaos.Rewrite(services.MessageFilter{Layer: services.Layer_ICC, Type: "MSG", Sender: 4}, func(msg services.ICCMessage) services.ICCMessage {
+		p, err := services.ParseICCPayload(msg.ACastMsg.Val)
+		if err != nil || p.Type != services.ICC_Attach {
+			return msg
+		}
+		rewrite(p)
+		acast := *msg.ACastMsg
+		acast.Val = p.String()
+		msg.ACastMsg = &acast
+		return msg
+	})
+	c.Network.SetChaos(chaos)
+	return rule
+}
+
+func TestICC_InfersFaultyNodes(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f))
+	defer c.Stop()
+	bad := rewriteAttach(c, func(p *services.ICCPayload) { p.SetT = p.SetT[:1] })
+	abatest.StartICC(c)
+
+	honest := []int{1, 2, 3}
+	coins, err := c.Await(honest, 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Node 4 may attach only after the others output their coins
+	deadline := time.Now().Add(5 * time.Second)
+	for bad.Hits() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The T set of node 4 was never rewritten")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, id := range honest {
+		// The coin may come before the inference
+		for !c.NodeContext(id).CP.IsCertifiedFaulty(id, 4) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %d did not infer node 4 faulty, its coin reported %v", id, coins[id].Faulty)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, j := range coins[id].Faulty {
+			if j != 4 {
+				t.Errorf("Node %d inferred correct node %d faulty", id, j)
+			}
+		}
+	}
+}
+
+func TestICC_IgnoresPayloadsOfOtherNodes(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f))
+	defer c.Stop()
+	// Node 4 tries to frame node 1 with a T set no correct node sends
+	bad := rewriteAttach(c, func(p *services.ICCPayload) { p.Sender, p.SetT = 1, p.SetT[:1] })
+	abatest.StartICC(c)
+
+	honest := []int{1, 2, 3}
+	coins, err := c.Await(honest, 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Node 4 may attach only after the others output their coins
+	deadline := time.Now().Add(5 * time.Second)
+	for bad.Hits() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The T set of node 4 was never rewritten")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, id := range honest {
+		if faulty := coins[id].Faulty; len(faulty) != 0 {
+			t.Errorf("Node %d inferred %v faulty", id, faulty)
+		}
+		if c.NodeContext(id).CP.IsCertifiedFaulty(id, 1) {
+			t.Errorf("Node %d certified node 1 faulty", id)
+		}
+	}
+}
+
+func TestICC_SuspectsMalformedPayloads(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		rewrite func(p *services.ICCPayload)
+	}{
+		{"unsorted", func(p *services.ICCPayload) { slices.Reverse(p.SetT) }},
+		{"duplicate", func(p *services.ICCPayload) { p.SetT = append(p.SetT, p.SetT[0]) }},
+		{"out of range", func(p *services.ICCPayload) { p.SetT[len(p.SetT)-1] = 5 }},
+		{"foreign set", func(p *services.ICCPayload) { p.SetA = p.SetT }},
+		{"other sender", func(p *services.ICCPayload) { p.Sender = 1 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n, f := 4, 1
+			c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f))
+			defer c.Stop()
+			bad := rewriteAttach(c, tc.rewrite)
+			abatest.StartICC(c)
+
+			honest := []int{1, 2, 3}
+			coins, err := c.Await(honest, 20*time.Second, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for _, id := range honest {
+				// Node 4 may attach only after the others output their coins
+				for !slices.Equal(c.Service(id).State().Suspects, []int{4}) {
+					if time.Now().After(deadline) {
+						t.Fatalf("Node %d suspects %v after %d rewrites", id, c.Service(id).State().Suspects, bad.Hits())
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				if faulty := coins[id].Faulty; len(faulty) != 0 {
+					t.Errorf("Node %d inferred %v faulty", id, faulty)
+				}
+				if got := c.NodeContext(id).Metrics.Get("icc.suspicious_payloads"); got == 0 {
+					t.Errorf("Node %d did not count the suspicious payload", id)
+				}
+			}
+		})
+	}
+}
+
+func TestICCPayload_Validate(t *testing.T) {
+	// The instances of secrets 1 to 4 of dealer, of the given rounds
+	dealt := func(dealer int, rounds ...int) []string {
+		ids := make([]string, len(rounds))
+		for j, round := range rounds {
+			ids[j] = services.IVSSID{Dealer: dealer, Round: round, Tag: fmt.Sprintf("ICC-%d", j+1)}.String()
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		payload services.ICCPayload
+		ok      bool
+	}{
+		{services.ICCPayload{Type: services.ICC_Attach, SetT: utils.NodeSet{1, 2, 3}, Sender: 1}, true},
+		{services.ICCPayload{Type: services.ICC_FinalSets, SetH: utils.NodeSet{1, 2, 4}, SetS: utils.NodeSet{2, 3, 4}, Sender: 4}, true},
+		{services.ICCPayload{Type: services.ICC_Attach, SetT: utils.NodeSet{2, 1, 3}, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Accept, SetA: utils.NodeSet{1, 1, 2}, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Accept, SetA: utils.NodeSet{0, 1, 2}, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Accept, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Accept, SetA: utils.NodeSet{1, 2, 3}, SetT: utils.NodeSet{1, 2, 3}, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_FinalSets, SetH: utils.NodeSet{1, 2, 3}, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_ReconstructEnabled, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Attach, SetT: utils.NodeSet{1, 2, 3}, Sender: 5}, false},
+		{services.ICCPayload{Type: services.ICC_Deal, Dealt: dealt(1, 1, 1, 1, 1), Sender: 1}, true},
+		{services.ICCPayload{Type: services.ICC_Deal, Dealt: dealt(1, 1, 1, 1), Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Deal, Dealt: dealt(2, 1, 1, 1, 1), Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Deal, Dealt: []string{"x", "y", "z", "w"}, Sender: 1}, false},
+		{services.ICCPayload{Type: services.ICC_Attach, SetT: utils.NodeSet{1, 2, 3}, Dealt: dealt(1, 1, 1, 1, 1), Sender: 1}, false},
+	} {
+		if err := tc.payload.Validate(4); (err == nil) != tc.ok {
+			t.Errorf("Validate(%s) = %v", tc.payload, err)
+		}
+	}
+}
+
+func TestABA_ClosesOldCoins(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(4, 1),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ABACoinRetention = 1
+		}))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+
+	// Rounds go on after the decision, so the coins of old ones are closed
+	metrics := c.NodeContext(1).Metrics
+	deadline := time.Now().Add(20 * time.Second)
+	for metrics.Get("aba.coins_closed") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("No coin closed after %d rounds", metrics.Get("aba.rounds_started"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if started, closed := metrics.Get("aba.rounds_started"), metrics.Get("aba.coins_closed"); started-closed > 2 {
+		t.Errorf("Node 1 keeps %d coins of %d rounds", started-closed, started)
+	}
+}
+
+func TestABA_SharedCoinPool(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(4, 1),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ABAPipelineDepth = 2
+			nc.ABACoinRetention = 1
+			// Batches may carry IVSS payloads of several rounds
+			nc.ACastBatchWindow = 2 * time.Millisecond
+		}))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+
+	// Nodes keep running rounds after they decide, so whatever round node
+	// 1 decided in, it reaches round 3, which closes the coin of round 1
+	metrics := c.NodeContext(1).Metrics
+	deadline := time.Now().Add(20 * time.Second)
+	for metrics.Get("aba.coins_closed") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("No coin closed by round %d", metrics.Get("aba.rounds_started"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// One IVSS service holds the sharings of every round the node keeps
+	ivss := c.Service(1).IVSS()
+	first := services.IVSSID{Dealer: 1, Round: 1, Tag: "ICC-1"}.String()
+	if _, _, _, err := ivss.GetInstanceStatus(first); !errors.Is(err, services.ErrUnknownIVSSInstance) {
+		t.Errorf("Sharing %s of a closed round is still kept: %v", first, err)
+	}
+	// The share of the current round may still be on its way, and the
+	// rounds move on meanwhile
+	for {
+		current := services.IVSSID{Dealer: 2, Round: int(metrics.Get("aba.rounds_started")), Tag: "ICC-1"}.String()
+		if _, ok := ivss.InstanceState(current); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Sharing %s of the current round is missing", current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestABA_ReusesDealings(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(4, 1),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ICCReuseDealings = true
+			nc.ABAPipelineDepth = 1
+			nc.ABACoinRetention = 2
+		}))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+
+	// Rounds go on after the decision, and T_j leaves out the sharings of
+	// some dealer now and then, which it deals again later
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		reused := int64(0)
+		for _, id := range c.Honest() {
+			reused += c.NodeContext(id).Metrics.Get("icc.dealings_reused")
+		}
+		if reused > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("No dealing reused by round %d", c.NodeContext(1).Metrics.Get("aba.rounds_started"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestICC_State(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f))
+	defer c.Stop()
+
+	// A prepared coin shows it is held after the A sets
+	abatest.PrepareICC(c)
+	deadline := time.Now().Add(20 * time.Second)
+	for c.Service(1).State().Phase != "ACCEPT_SENT" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Prepared coin stuck in %+v", c.Service(1).State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := c.Service(1).State()
+	if !st.Held || len(st.T) < n-f || len(st.A) < n-f || st.S != nil || st.Reconstructing != 0 {
+		t.Errorf("Held coin reports %+v", st)
+	}
+
+	abatest.StartICC(c)
+	if _, err := c.Await(c.Honest(), 20*time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	st = c.Service(1).State()
+	if st.Phase != "FINISHED" || st.Held || len(st.S) < n-f || st.Reconstructed == 0 {
+		t.Errorf("Finished coin reports %+v", st)
+	}
+	metrics := c.NodeContext(1).Metrics
+	for _, step := range []string{"icc.t_formed", "icc.a_formed", "icc.s_formed"} {
+		if got := metrics.Get(step); got != 1 {
+			t.Errorf("%s = %d, want 1", step, got)
+		}
+	}
+	if metrics.Get("icc.reconstructions_complete") == 0 {
+		t.Error("No reconstruction counted")
+	}
+}
+
+// delayedCoin lands the coin of its source after a delay.
+type delayedCoin struct {
+	services.CommonCoin
+	delay time.Duration
+}
+
+func (c delayedCoin) Flip(round int) <-chan int {
+	ch := make(chan int, 1)
+	go func() {
+		time.Sleep(c.delay)
+		ch <- <-c.CommonCoin.Flip(round)
+	}()
+	return ch
+}
+
+func TestICC_CoinAudit(t *testing.T) {
+	n, f := 4, 1
+	log := services.NewCoinAuditLog()
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) { nc.CoinAudits = log.Record }))
+	defer c.Stop()
+	abatest.StartICC(c)
+	coins, err := c.Await(c.Honest(), 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audits := log.Audits()
+	if len(audits) != n {
+		t.Fatalf("Recorded %d audits, want %d", len(audits), n)
+	}
+	for _, a := range audits {
+		secrets := make(map[[2]int]*big.Int)
+		for _, y := range a.Secrets {
+			secrets[[2]int{y.Dealer, y.Index}] = y.Value
+		}
+		// Recompute the coin from the secrets alone
+		coin := 1
+		for _, v := range a.Values {
+			sum := new(big.Int)
+			for _, k := range v.T {
+				sum.Add(sum, secrets[[2]int{k, v.Node}])
+			}
+			if value := new(big.Int).Mod(sum, big.NewInt(int64(a.U))); sum.Cmp(v.Sum) != 0 || value.Cmp(v.Value) != 0 {
+				t.Errorf("Node %d: v_%d is %v (sum %v), recomputed %v (sum %v)", a.Node, v.Node, v.Value, v.Sum, value, sum)
+			}
+			if v.Value.Sign() == 0 {
+				coin = 0
+			}
+		}
+		if len(a.Values) != len(a.H) || a.Coin != coin || a.Coin != coins[a.Node].Coin {
+			t.Errorf("Node %d audited coin %d of %d values, recomputed %d, output %d", a.Node, a.Coin, len(a.Values), coin, coins[a.Node].Coin)
+		}
+		if p := a.ExpectedZero(); p <= 0 || p >= 1 {
+			t.Errorf("Node %d: expected bias %v", a.Node, p)
+		}
+	}
+	if freq := log.Frequencies(); freq[0]+freq[1] != n {
+		t.Errorf("Frequencies %v", freq)
+	}
+
+	var buf bytes.Buffer
+	if err := log.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(&buf)
+	for i := range audits {
+		var a services.CoinAudit
+		if err := dec.Decode(&a); err != nil {
+			t.Fatal(err)
+		}
+		if a.Node != audits[i].Node || a.Coin != audits[i].Coin || len(a.Secrets) != len(audits[i].Secrets) {
+			t.Errorf("Audit %d did not survive JSON: %+v", i, a)
+		}
+	}
+}
+
+func TestABA_CommonCoins(t *testing.T) {
+	coins := map[string]func() services.CommonCoin{
+		"dealer": func() services.CommonCoin { return services.NewDealerCoin([]byte("seed")) },
+		"local":  func() services.CommonCoin { return services.NewLocalCoin(nil) },
+		"delayed": func() services.CommonCoin {
+			return delayedCoin{services.NewDealerCoin([]byte("seed")), 5 * time.Millisecond}
+		},
+	}
+	for name, coin := range coins {
+		t.Run(name, func(t *testing.T) {
+			c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(4, 1),
+				abatest.WithNodeContext(func(nc *services.NodeContext) {
+					nc.Coin = coin()
+				}))
+			abatest.StartABA(c)
+
+			decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for id, d := range decisions {
+				if d != decisions[1] {
+					t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+				}
+			}
+			if sharings := c.Service(1).IVSS().Instances(); sharings != 0 {
+				t.Errorf("%d IVSS instances without ICC", sharings)
+			}
+		})
+	}
+}
+
+func TestDealerCoin_Agrees(t *testing.T) {
+	a, b := services.NewDealerCoin([]byte("seed")), services.NewDealerCoin([]byte("seed"))
+	ones := 0
+	for r := 1; r <= 100; r++ {
+		x, y := <-a.Flip(r), <-b.Flip(r)
+		if x != y {
+			t.Fatalf("Round %d: coins %d and %d", r, x, y)
+		}
+		ones += x
+	}
+	if ones == 0 || ones == 100 {
+		t.Errorf("%d of 100 coins are 1", ones)
+	}
+}
+
+// thresholdCoins wires the threshold coins of a cluster to each other.
+func thresholdCoins(t *testing.T, n, f int) []*services.ThresholdCoin {
+	keys, err := services.DealThresholdCoinKeys(n, f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coins := make([]*services.ThresholdCoin, n)
+	for i, key := range keys {
+		coins[i] = services.NewThresholdCoin(key, func(share services.ThresholdCoinShare) {
+			for _, peer := range coins {
+				go peer.Deliver(share)
+			}
+		})
+	}
+	return coins
+}
+
+func TestThresholdCoin_Agrees(t *testing.T) {
+	n, f := 4, 1
+	coins := thresholdCoins(t, n, f)
+	for r := 1; r <= 5; r++ {
+		flips := make([]<-chan int, n)
+		for i, coin := range coins {
+			flips[i] = coin.Flip(r)
+		}
+		var first int
+		for i, flip := range flips {
+			select {
+			case got, ok := <-flip:
+				if !ok {
+					t.Fatalf("Round %d: coin of node %d failed", r, i+1)
+				}
+				if i == 0 {
+					first = got
+				} else if got != first {
+					t.Errorf("Round %d: node %d got %d, node 1 got %d", r, i+1, got, first)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Round %d: no coin at node %d", r, i+1)
+			}
+		}
+	}
+}
+
+func TestThresholdCoin_RejectsForgedShares(t *testing.T) {
+	n, f := 4, 1
+	keys, err := services.DealThresholdCoinKeys(n, f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shares []services.ThresholdCoinShare
+	signer := services.NewThresholdCoin(keys[1], func(share services.ThresholdCoinShare) {
+		shares = append(shares, share)
+	})
+	signer.Flip(1)
+	if len(shares) != 1 {
+		t.Fatalf("%d shares sent", len(shares))
+	}
+
+	receiver := services.NewThresholdCoin(keys[0], func(services.ThresholdCoinShare) {})
+	if err := receiver.Deliver(shares[0]); err != nil {
+		t.Fatalf("Valid share rejected: %v", err)
+	}
+	forged := shares[0]
+	forged.Value = new(big.Int).Exp(forged.Value, big.NewInt(4), nil)
+	forged.Round = 2
+	if err := receiver.Deliver(forged); err == nil {
+		t.Error("Forged share accepted")
+	}
+	forged = shares[0]
+	forged.Sender = 3
+	if err := receiver.Deliver(forged); err == nil {
+		t.Error("Share of another node accepted")
+	}
+
+	// One share of t+1 is not enough
+	select {
+	case coin := <-receiver.Flip(3):
+		t.Errorf("Coin %d from the receiver's share alone", coin)
+	default:
+	}
+}
+
+func TestThresholdCoin_BoundsRounds(t *testing.T) {
+	n, f := 4, 1
+	keys, err := services.DealThresholdCoinKeys(n, f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares := make(map[int]services.ThresholdCoinShare) // Of node 2, by round
+	signer := services.NewThresholdCoin(keys[1], func(share services.ThresholdCoinShare) {
+		shares[share.Round] = share
+	})
+	receiver := services.NewThresholdCoin(keys[0], func(services.ThresholdCoinShare) {})
+	w := services.ThresholdCoinWindow
+
+	for _, r := range []int{1, w + 1, 2*w + 2} {
+		signer.Flip(r)
+	}
+	if err := receiver.Deliver(shares[2*w+2]); err == nil {
+		t.Errorf("Share of round %d accepted before flipping any round", 2*w+2)
+	}
+	if err := receiver.Deliver(shares[1]); err != nil {
+		t.Fatalf("Share of round 1 rejected: %v", err)
+	}
+	select {
+	case <-receiver.Flip(1):
+	case <-time.After(5 * time.Second):
+		t.Fatal("No coin for round 1")
+	}
+
+	// Round 1 is decided and dropped once round w+1 is flipped
+	receiver.Flip(w + 1)
+	if err := receiver.Deliver(shares[1]); err == nil {
+		t.Error("Share of a dropped round accepted")
+	}
+	if err := receiver.Deliver(shares[2*w+2]); err == nil {
+		t.Errorf("Share of round %d accepted at round %d", 2*w+2, w+1)
+	}
+	if err := receiver.Deliver(shares[w+1]); err != nil {
+		t.Errorf("Share of round %d rejected: %v", w+1, err)
+	}
+}
+
+func TestABA_ThresholdCoin(t *testing.T) {
+	n, f := 4, 1
+	coins := thresholdCoins(t, n, f)
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 }, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.Coin = coins[nc.ID-1]
+		}))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// --- Helper Setup ---
+
+// liveNet delivers ICC messages one at a time in an order picked by a
+// seeded source, so a test can build a schedule and replay it
+type liveNet struct {
+	n       int
+	rng     *rand.Rand
+	nodes   map[int]services.Service[services.ICCMessage, services.ICCResult]
+	queue   []liveEnvelope
+	results map[int][]services.ICCResult
+
+	attached map[int][]int  // node -> T it A-Cast
+	msets    map[string]int // instance -> M-Set MSGs its dealer sent
+}
+
+type liveEnvelope struct {
+	to  int
+	msg services.ICCMessage
+}
+
+// liveCtx is the ServiceContext of one node of a liveNet
+type liveCtx struct {
+	net *liveNet
+	id  int
+}
+
+func (c liveCtx) Broadcast(msg services.ICCMessage) {
+	c.net.record(c.id, msg)
+	for to := 1; to <= c.net.n; to++ {
+		c.net.queue = append(c.net.queue, liveEnvelope{to: to, msg: msg})
+	}
+}
+
+func (c liveCtx) SendTo(to int, msg services.ICCMessage) {
+	c.net.queue = append(c.net.queue, liveEnvelope{to: to, msg: msg})
+}
+
+func (c liveCtx) SendResult(res services.ICCResult) {
+	c.net.results[c.id] = append(c.net.results[c.id], res)
+}
+
+// liveNode holds back the messages hold picks until release holds, then
+// delivers them in arrival order. Those drop picks are never delivered.
+type liveNode struct {
+	*services.ICCService
+	hold    func(services.ICCMessage) bool
+	release func() bool
+	drop    func(services.ICCMessage) bool
+	held    []services.ICCMessage
+}
+
+func (h *liveNode) OnMessage(msg services.ICCMessage, ctx services.ServiceContext[services.ICCMessage, services.ICCResult]) {
+	if h.drop != nil && h.drop(msg) {
+		return
+	}
+	if !h.release() && h.hold(msg) {
+		h.held = append(h.held, msg)
+		return
+	}
+	h.ICCService.OnMessage(msg, ctx)
+	if h.release() {
+		h.flush(ctx)
+	}
+}
+
+func (h *liveNode) flush(ctx services.ServiceContext[services.ICCMessage, services.ICCResult]) {
+	held := h.held
+	h.held = nil
+	for _, msg := range held {
+		h.ICCService.OnMessage(msg, ctx)
+	}
+}
+
+// newLiveNet starts an ICC coin on n nodes. wrap may return a liveNode
+// standing in for node id, or nil to run it unchanged.
+func newLiveNet(seed int64, n, f int, wrap func(id int, icc *services.ICCService) *liveNode) *liveNet {
+	net := &liveNet{
+		n:        n,
+		rng:      rand.New(rand.NewSource(seed)),
+		nodes:    make(map[int]services.Service[services.ICCMessage, services.ICCResult]),
+		results:  make(map[int][]services.ICCResult),
+		attached: make(map[int][]int),
+		msets:    make(map[string]int),
+	}
+	iccs := make([]*services.ICCService, n+1)
+	for id := 1; id <= n; id++ {
+		iccs[id] = services.NewICCService(id, n, f, 1, services.NewCertificationProtocol(), zerolog.Disabled)
+		if h := wrap(id, iccs[id]); h != nil {
+			net.nodes[id] = h
+		} else {
+			net.nodes[id] = iccs[id]
+		}
+	}
+	for id := 1; id <= n; id++ {
+		iccs[id].Start(liveCtx{net: net, id: id})
+	}
+	return net
+}
+
+// record notes the T sets and M-Sets a node A-Casts itself
+func (net *liveNet) record(from int, msg services.ICCMessage) {
+	if msg.ACastMsg != nil && msg.ACastMsg.Type == services.MSG && msg.ACastMsg.From == from {
+		if payload, err := services.ParseICCPayload(msg.ACastMsg.Val); err == nil && payload.Type == services.ICC_Attach {
+			net.attached[from] = payload.SetT
+		}
+	}
+	if msg.IVSSMsg != nil && msg.IVSSMsg.ACastMsg != nil && msg.IVSSMsg.ACastMsg.Type == services.MSG && msg.IVSSMsg.ACastMsg.From == from {
+		if payload, err := services.ParseIVSSPayload(msg.IVSSMsg.ACastMsg.Val); err == nil && payload.Type == services.Payload_MSet {
+			net.msets[payload.InstanceID]++
+		}
+	}
+}
+
+// run delivers queued messages until done holds, the queue drains or
+// maxSteps messages were delivered. It reports whether done holds.
+func (net *liveNet) run(done func() bool, maxSteps int) bool {
+	for step := 0; step < maxSteps; step++ {
+		if done() {
+			return true
+		}
+		if len(net.queue) == 0 {
+			return false
+		}
+		i := net.rng.Intn(len(net.queue))
+		env := net.queue[i]
+		net.queue[i] = net.queue[len(net.queue)-1]
+		net.queue = net.queue[:len(net.queue)-1]
+		net.nodes[env.to].OnMessage(env.msg, liveCtx{net: net, id: env.to})
+	}
+	return done()
+}
+
+// decided reports whether every node in ids output a coin
+func (net *liveNet) decided(ids ...int) bool {
+	for _, id := range ids {
+		if len(net.results[id]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// secretDealer returns the dealer of the ICC secret msg belongs to, or 0
+func secretDealer(msg services.ICCMessage) int {
+	if msg.Type != services.ICC_IVSS || msg.IVSSMsg == nil {
+		return 0
+	}
+	instanceID := msg.IVSSMsg.InstanceID
+	if msg.IVSSMsg.ACastMsg != nil {
+		payload, err := services.ParseIVSSPayload(msg.IVSSMsg.ACastMsg.Val)
+		if err != nil {
+			return 0
+		}
+		instanceID = payload.InstanceID
+	}
+	id, err := services.ParseIVSSID(instanceID)
+	if err != nil {
+		return 0
+	}
+	return id.Dealer
+}
+
+// immediateSender returns the node msg was sent by
+func immediateSender(msg services.ICCMessage) int {
+	switch {
+	case msg.ACastMsg != nil:
+		return msg.ACastMsg.From
+	case msg.IVSSMsg != nil && msg.IVSSMsg.ACastMsg != nil:
+		return msg.IVSSMsg.ACastMsg.From
+	case msg.IVSSMsg != nil:
+		return msg.IVSSMsg.From
+	}
+	return 0
+}
+
+func allIDs(n int) []int {
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	return ids
+}
+
+// --- Tests ---
+
+func TestICCLiveness_AcceptsSetsAttachedInAnotherOrder(t *testing.T) {
+	n, f := 4, 1
+	// Every node holds back one sharing until it attached T: node 1 that
+	// of 4, node j > 1 that of j-1. So T_1 = {1, 2, 3} and every other T_j
+	// contains 4, and node 1 can only accept them once the sharing of 4
+	// completes after it attached T_1
+	for seed := int64(1); seed <= 3; seed++ {
+		var net *liveNet
+		net = newLiveNet(seed, n, f, func(id int, icc *services.ICCService) *liveNode {
+			late := id - 1
+			if id == 1 {
+				late = n
+			}
+			return &liveNode{
+				ICCService: icc,
+				hold:       func(msg services.ICCMessage) bool { return secretDealer(msg) == late },
+				release:    func() bool { return net.attached[id] != nil },
+			}
+		})
+		if !net.run(func() bool { return net.decided(allIDs(n)...) }, 2000000) {
+			t.Fatalf("Seed %d: coin stuck with T sets %v", seed, net.attached)
+		}
+		if !slices.Equal(net.attached[1], []int{1, 2, 3}) {
+			t.Errorf("Seed %d: node 1 attached %v", seed, net.attached[1])
+		}
+		for id := 2; id <= n; id++ {
+			if !slices.Contains(net.attached[id], n) {
+				t.Errorf("Seed %d: node %d attached %v without %d", seed, id, net.attached[id], n)
+			}
+		}
+	}
+}
+
+func TestICCLiveness_RelaysAfterFinishing(t *testing.T) {
+	n, f := 4, 1
+	// Node 4 completes the sharings, but delivers no T, A or (H, S) until
+	// the others output the coin, and gets no ECHO or READY from node 3,
+	// which is faulty towards it. Its REVEALs then need the ECHOs of nodes
+	// 1 and 2, which already finished
+	for seed := int64(1); seed <= 3; seed++ {
+		var net *liveNet
+		var late *liveNode
+		othersDone := func() bool { return net.decided(1, 2, 3) }
+		net = newLiveNet(seed, n, f, func(id int, icc *services.ICCService) *liveNode {
+			if id != n {
+				return nil
+			}
+			late = &liveNode{
+				ICCService: icc,
+				hold:       func(msg services.ICCMessage) bool { return msg.Type == services.ICC_ACast },
+				release:    othersDone,
+				drop: func(msg services.ICCMessage) bool {
+					isACast := msg.ACastMsg != nil || msg.IVSSMsg != nil && msg.IVSSMsg.ACastMsg != nil
+					return isACast && immediateSender(msg) == 3
+				},
+			}
+			return late
+		})
+		if !net.run(othersDone, 2000000) {
+			t.Fatalf("Seed %d: coin stuck", seed)
+		}
+		late.flush(liveCtx{net: net, id: n})
+		if !net.run(func() bool { return net.decided(n) }, 2000000) {
+			t.Fatalf("Seed %d: late node stuck", seed)
+		}
+	}
+}
+
+func TestICCLiveness_DealerSendsOneMSet(t *testing.T) {
+	n, f := 4, 1
+	// EQUALs keep arriving after the dealer found n-t consistent nodes, and
+	// each would otherwise make it A-Cast a larger M-Set. Peers take the
+	// first one they deliver, so two could complete the sharing on
+	// different sets
+	for seed := int64(1); seed <= 3; seed++ {
+		net := newLiveNet(seed, n, f, func(int, *services.ICCService) *liveNode { return nil })
+		if !net.run(func() bool { return net.decided(allIDs(n)...) }, 2000000) {
+			t.Fatalf("Seed %d: coin stuck", seed)
+		}
+		// Deliver the remaining EQUALs
+		net.run(func() bool { return false }, 2000000)
+
+		if len(net.msets) != n*n {
+			t.Errorf("Seed %d: %d of %d sharings sent an M-Set", seed, len(net.msets), n*n)
+		}
+		for instanceID, count := range net.msets {
+			if count != 1 {
+				t.Errorf("Seed %d: dealer of %s sent %d M-Sets", seed, instanceID, count)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestInvariants_ABASimulation(t *testing.T) {
+	n, f := 4, 1
+	honest := []int{1, 2, 3, 4}
+	for seed := int64(1); seed <= 2; seed++ {
+		checker := services.NewInvariantChecker(services.SafetyInvariants(honest)...)
+		checker.OnViolation(func(err error) { t.Error(err) })
+
+		sim := services.NewSimulation[services.ABAMessage, int](seed)
+		abas := make([]*services.ABAService, n)
+		buses := make([]*services.EventBus, n)
+		for i := range abas {
+			id := i + 1
+			nc := services.NewNodeContext(id, n, f, zerolog.Disabled)
+			buses[i] = nc.Events
+			abas[i] = services.NewABAServiceWithContext(nc, id%2)
+			sim.AddNode(id, abas[i])
+		}
+		cancel := checker.Subscribe(buses...)
+		for i, aba := range abas {
+			aba.Start(sim.Context(i + 1))
+		}
+
+		allDecided := func() bool {
+			for id := 1; id <= n; id++ {
+				if len(sim.Results(id)) == 0 {
+					return false
+				}
+			}
+			return true
+		}
+		if !sim.Run(allDecided, 2000000) {
+			t.Fatalf("Seed %d: not all nodes decided after %d steps", seed, sim.Steps())
+		}
+		cancel()
+		if err := checker.Finish(); err != nil {
+			t.Fatalf("Seed %d: %v", seed, err)
+		}
+
+		decided := 0
+		for _, ev := range checker.Trace() {
+			if ev.Type == services.Event_ABADecided {
+				decided++
+			}
+		}
+		if decided != n {
+			t.Errorf("Seed %d: observed %d decisions, expected %d", seed, decided, n)
+		}
+	}
+}
+
+func TestInvariants_ACastTotalityAfterQuiescence(t *testing.T) {
+	n, f := 4, 1
+	honest := []int{1, 2, 3, 4}
+	checker := services.NewInvariantChecker(services.NewACastAgreement(honest), services.NewACastTotality(honest))
+
+	sim := services.NewSimulation[services.ACastMessage[string], string](7)
+	var buses []*services.EventBus
+	for id := 1; id <= n; id++ {
+		nc := services.NewNodeContext(id, n, f, zerolog.Disabled)
+		buses = append(buses, nc.Events)
+		sim.AddNode(id, services.NewAcastServiceWithContext[string](nc))
+	}
+	cancel := checker.Subscribe(buses...)
+	sim.Context(1).Broadcast(services.ACastMessage[string]{Type: services.MSG, UUID: "inv-1", Val: "value", From: 1})
+	if !sim.Run(nil, 10000) {
+		t.Fatal("Cluster did not go quiescent")
+	}
+	cancel()
+	if err := checker.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(checker.Trace()); got != n {
+		t.Errorf("Observed %d deliveries, expected %d", got, n)
+	}
+}
+
+func TestInvariants_ReportViolationWithTrace(t *testing.T) {
+	honest := []int{1, 2, 3, 4}
+	cases := []struct {
+		name      string
+		invariant services.Invariant
+		events    []services.ProtocolEvent
+		trace     int
+	}{
+		{
+			name:      "acast agreement",
+			invariant: services.NewACastAgreement(honest),
+			events: []services.ProtocolEvent{
+				{Node: 1, Type: services.Event_ACastDelivered, Instance: "a", Value: "x"},
+				{Node: 2, Type: services.Event_ACastDelivered, Instance: "b", Value: "y"},
+				{Node: 3, Type: services.Event_ACastDelivered, Instance: "a", Value: "z"},
+			},
+			trace: 2,
+		},
+		{
+			name:      "ivss correctness",
+			invariant: services.NewIVSSCorrectness(honest),
+			events: []services.ProtocolEvent{
+				{Node: 1, Type: services.Event_IVSSReconstructed, Instance: "ICC-1-2-1", Value: "6"},
+				{Node: 2, Type: services.Event_IVSSDealt, Instance: "ICC-1-2-1", Value: "5"},
+			},
+			trace: 2,
+		},
+		{
+			name:      "aba agreement",
+			invariant: services.NewABAAgreement(honest),
+			events: []services.ProtocolEvent{
+				{Node: 1, Type: services.Event_ABADecided, Value: "0"},
+				{Node: 2, Type: services.Event_ACastDelivered, Instance: "a", Value: "x"},
+				{Node: 2, Type: services.Event_ABADecided, Value: "1"},
+			},
+			trace: 2,
+		},
+		{
+			name:      "aba validity",
+			invariant: services.NewABAValidity(honest),
+			events: []services.ProtocolEvent{
+				{Node: 1, Type: services.Event_ABAStarted, Value: "1"},
+				{Node: 2, Type: services.Event_ABAStarted, Value: "1"},
+				{Node: 3, Type: services.Event_ABAStarted, Value: "1"},
+				{Node: 1, Type: services.Event_ABADecided, Value: "0"},
+				{Node: 4, Type: services.Event_ABAStarted, Value: "1"},
+			},
+			trace: 5,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := services.NewInvariantChecker(tc.invariant)
+			callbacks := 0
+			checker.OnViolation(func(error) { callbacks++ })
+			var err error
+			for _, ev := range tc.events {
+				err = checker.Observe(ev)
+			}
+			var v *services.InvariantViolation
+			if !errors.As(err, &v) {
+				t.Fatalf("Expected a violation, got %v", err)
+			}
+			if v.Invariant != tc.invariant.Name() {
+				t.Errorf("Violation names %q", v.Invariant)
+			}
+			if len(v.Trace) != tc.trace {
+				t.Errorf("Trace has %d events, expected %d: %v", len(v.Trace), tc.trace, v)
+			}
+			if callbacks != 1 || checker.Err() != err || checker.Finish() != err {
+				t.Errorf("Violation not kept: %d callbacks, Err %v", callbacks, checker.Err())
+			}
+		})
+	}
+}
+
+func TestInvariants_IgnoreFaultyNodes(t *testing.T) {
+	checker := services.NewInvariantChecker(services.SafetyInvariants([]int{1, 2, 3})...)
+	events := []services.ProtocolEvent{
+		{Node: 1, Type: services.Event_ACastDelivered, Instance: "a", Value: "x"},
+		{Node: 4, Type: services.Event_ACastDelivered, Instance: "a", Value: "y"},
+		{Node: 4, Type: services.Event_IVSSDealt, Instance: "ICC-1-4-1", Value: "5"},
+		{Node: 2, Type: services.Event_IVSSReconstructed, Instance: "ICC-1-4-1", Value: "6"},
+		{Node: 4, Type: services.Event_ABADecided, Value: "0"},
+		{Node: 3, Type: services.Event_ABADecided, Value: "1"},
+	}
+	for _, ev := range events {
+		if err := checker.Observe(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checker.Finish(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,65 +1,31 @@
 package tests
 
 import (
+	"async-agreement-protocol-3/abatest"
 	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"crypto/rand"
+	"errors"
 	"math/big"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
-
-	"github.com/rs/zerolog"
 )
 
-func setupIVSSAdvanced(t *testing.T, n, f int) ([]*services.IVSSService, []*services.ServiceManager[services.IVSSMessage, services.IVSSResult], map[int]chan services.IVSSResult) {
-	network := services.NewNetwork[services.IVSSMessage]()
-
-	servicesList := make([]*services.IVSSService, n+1)
-	managers := make([]*services.ServiceManager[services.IVSSMessage, services.IVSSResult], n+1)
-	results := make(map[int]chan services.IVSSResult)
-
-	for i := 1; i <= n; i++ {
-		cp := services.NewCertificationProtocol()
-		// Use DebugLevel to see what's happening, or InfoLevel to reduce noise
-		svc := services.NewIVSSService(i, n, f, cp, zerolog.InfoLevel)
-		servicesList[i] = svc
-
-		mgr := services.NewServiceManager[services.IVSSMessage, services.IVSSResult](svc, network)
-		managers[i] = mgr
-
-		network.Register(i, mgr.Inbox())
-		results[i] = make(chan services.IVSSResult, 100)
-
-		mgr.Start()
-
-		go func(id int, m *services.ServiceManager[services.IVSSMessage, services.IVSSResult]) {
-			for res := range m.Result() {
-				results[id] <- res
-			}
-		}(i, mgr)
-	}
-
-	return servicesList, managers, results
-}
-
 func TestIVSS_Basic(t *testing.T) {
 	n := 4
 	f := 1
-	servicesList, managers, results := setupIVSSAdvanced(t, n, f)
-	defer func() {
-		for _, m := range managers {
-			if m != nil {
-				m.Stop()
-			}
-		}
-	}()
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
 
 	dealerID := 1
 	secret := big.NewInt(42)
-	instanceID := "IVSS-TEST-1"
+	instanceID := services.IVSSInstanceID("IVSS-TEST-1", dealerID)
 
 	// Start Sharing
 	t.Logf("Node %d starting sharing secret %v", dealerID, secret)
-	err := servicesList[dealerID].StartSharing(instanceID, secret, managers[dealerID])
+	err := c.Service(dealerID).StartSharing(instanceID, secret, c.Manager(dealerID))
 	if err != nil {
 		t.Fatalf("Failed to start sharing: %v", err)
 	}
@@ -79,14 +45,14 @@ func TestIVSS_Basic(t *testing.T) {
 					continue
 				}
 				select {
-				case res := <-results[i]:
+				case res := <-c.Results(i):
 					if res.InstanceID == instanceID && res.Type == "SHARING_COMPLETE" {
 						t.Logf("Node %d completed sharing", i)
 						sharingCompleted[i] = true
 
 						// Start Reconstruction immediately after sharing complete
 						go func(id int) {
-							err := servicesList[id].StartReconstruction(instanceID, managers[id])
+							err := c.Service(id).StartReconstruction(instanceID, c.Manager(id))
 							if err != nil {
 								t.Errorf("Node %d failed to start reconstruction: %v", id, err)
 							}
@@ -114,7 +80,7 @@ func TestIVSS_Basic(t *testing.T) {
 					continue
 				}
 				select {
-				case res := <-results[i]:
+				case res := <-c.Results(i):
 					if res.InstanceID == instanceID && res.Type == "RECONSTRUCTED" {
 						if res.Secret.Cmp(secret) != 0 {
 							t.Errorf("Node %d reconstructed wrong secret: %v (expected %v)", i, res.Secret, secret)
@@ -134,14 +100,7 @@ func TestIVSS_Basic(t *testing.T) {
 func TestIVSS_Concurrent(t *testing.T) {
 	n := 4
 	f := 1
-	servicesList, managers, results := setupIVSSAdvanced(t, n, f)
-	defer func() {
-		for _, m := range managers {
-			if m != nil {
-				m.Stop()
-			}
-		}
-	}()
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
 
 	// Run multiple instances concurrently
 	numInstances := 5
@@ -153,11 +112,11 @@ func TestIVSS_Concurrent(t *testing.T) {
 			defer wg.Done()
 			dealerID := (idx % n) + 1
 			secret := big.NewInt(int64(100 + idx))
-			instanceID := "IVSS-CONC-" + string(rune('A'+idx))
+			instanceID := services.IVSSInstanceID("IVSS-CONC-"+string(rune('A'+idx)), dealerID)
 
 			t.Logf("Starting instance %s (Dealer: %d, Secret: %v)", instanceID, dealerID, secret)
 
-			err := servicesList[dealerID].StartSharing(instanceID, secret, managers[dealerID])
+			err := c.Service(dealerID).StartSharing(instanceID, secret, c.Manager(dealerID))
 			if err != nil {
 				t.Errorf("Failed to start sharing %s: %v", instanceID, err)
 				return
@@ -169,7 +128,7 @@ func TestIVSS_Concurrent(t *testing.T) {
 
 	expectedSecrets := make(map[string]*big.Int)
 	for k := 0; k < numInstances; k++ {
-		instanceID := "IVSS-CONC-" + string(rune('A'+k))
+		instanceID := services.IVSSInstanceID("IVSS-CONC-"+string(rune('A'+k)), (k%n)+1)
 		expectedSecrets[instanceID] = big.NewInt(int64(100 + k))
 	}
 
@@ -178,7 +137,7 @@ func TestIVSS_Concurrent(t *testing.T) {
 	reconState := make(map[string]map[int]bool)   // instance -> node -> bool
 
 	for k := 0; k < numInstances; k++ {
-		id := "IVSS-CONC-" + string(rune('A'+k))
+		id := services.IVSSInstanceID("IVSS-CONC-"+string(rune('A'+k)), (k%n)+1)
 		sharingState[id] = make(map[int]bool)
 		reconState[id] = make(map[int]bool)
 	}
@@ -200,11 +159,11 @@ func TestIVSS_Concurrent(t *testing.T) {
 			Loop:
 				for {
 					select {
-					case res := <-results[i]:
+					case res := <-c.Results(i):
 						if res.Type == "SHARING_COMPLETE" {
 							sharingState[res.InstanceID][i] = true
 							// Trigger reconstruction
-							go servicesList[i].StartReconstruction(res.InstanceID, managers[i])
+							go c.Service(i).StartReconstruction(res.InstanceID, c.Manager(i))
 						} else if res.Type == "RECONSTRUCTED" {
 							reconState[res.InstanceID][i] = true
 							expected := expectedSecrets[res.InstanceID]
@@ -220,7 +179,7 @@ func TestIVSS_Concurrent(t *testing.T) {
 
 			// Check if everything is done
 			for k := 0; k < numInstances; k++ {
-				id := "IVSS-CONC-" + string(rune('A'+k))
+				id := services.IVSSInstanceID("IVSS-CONC-"+string(rune('A'+k)), (k%n)+1)
 				if len(reconState[id]) < n {
 					allDone = false
 					break
@@ -234,3 +193,731 @@ func TestIVSS_Concurrent(t *testing.T) {
 		}
 	}
 }
+
+func TestIVSS_RetentionArchivesCompletedInstances(t *testing.T) {
+	n, f := 4, 1
+	archives := make(map[int]*services.MemoryIVSSArchive)
+	for i := 1; i <= n; i++ {
+		archives[i] = services.NewMemoryIVSSArchive()
+	}
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.IVSSRetention = services.IVSSRetention{MaxInstances: 1}
+			nc.IVSSArchive = archives[nc.ID]
+		}))
+	instances := abatest.IVSSInstances(c)
+
+	secrets := map[string]*big.Int{}
+	for dealer := 1; dealer <= 3; dealer++ {
+		id := services.IVSSInstanceID("archived", dealer)
+		secrets[id] = big.NewInt(int64(100 + dealer))
+		if err := c.Service(dealer).StartSharing(id, secrets[id], c.Manager(dealer)); err != nil {
+			t.Fatal(err)
+		}
+		waitForSharing(t, instances, allNodes(n), id, 5*time.Second)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for i := 1; i <= n; i++ {
+		for c.Service(i).Instances() > 1 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := c.Service(i).Instances(); got > 1 {
+			t.Errorf("Node %d keeps %d instances, want at most 1", i, got)
+		}
+		if archives[i].Len() < 2 {
+			t.Errorf("Node %d archived %d instances, want at least 2", i, archives[i].Len())
+		}
+	}
+
+	// Reconstruction brings the instances back from the archive
+	for id, secret := range secrets {
+		for i := 1; i <= n; i++ {
+			if err := c.Service(i).StartReconstruction(id, c.Manager(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		waitForReconstruction(t, instances, allNodes(n), id, secret, 5*time.Second)
+	}
+	if c.NodeContext(1).Metrics.Get("ivss.instances.restored") == 0 {
+		t.Error("No instance was restored")
+	}
+}
+
+func TestIVSS_FileArchive(t *testing.T) {
+	archive := services.NewFileIVSSArchive(t.TempDir())
+	rec := services.IVSSRecord{
+		InstanceID: "ICC-1-2/3@2",
+		Dealer:     2,
+		Share:      &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(5), big.NewInt(0)}},
+		MSet:       []int{1, 2, 3},
+		Secret:     big.NewInt(9),
+	}
+	if err := archive.Archive(rec); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := archive.Restore(rec.InstanceID)
+	if err != nil || !ok {
+		t.Fatalf("Restore = %v, %v", ok, err)
+	}
+	if got.Dealer != 2 || got.Secret.Cmp(rec.Secret) != 0 || len(got.MSet) != 3 || got.Share.Coeffs[0].Cmp(big.NewInt(5)) != 0 {
+		t.Errorf("Restored %+v, want %+v", got, rec)
+	}
+	if _, ok, err := archive.Restore("unknown@1"); ok || err != nil {
+		t.Errorf("Restore of an unknown instance = %v, %v", ok, err)
+	}
+}
+
+func TestIVSS_BatchSharing(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
+	instances := abatest.IVSSInstances(c)
+
+	batch := services.IVSSInstanceID("batch", 2)
+	secrets := []*big.Int{big.NewInt(11), big.NewInt(22), big.NewInt(33)}
+	if err := c.Service(2).StartBatchSharing(batch, secrets, c.Manager(2)); err != nil {
+		t.Fatal(err)
+	}
+	for i := range secrets {
+		waitForSharing(t, instances, allNodes(n), services.IVSSBatchSecretID(batch, i+1), 5*time.Second)
+	}
+	if err := c.Service(1).StartReconstruction(batch, c.Manager(1)); err == nil {
+		t.Error("Reconstructed a whole batch")
+	}
+
+	// Each secret is reconstructed on its own
+	second := services.IVSSBatchSecretID(batch, 2)
+	if second != "batch-2@2" {
+		t.Fatalf("IVSSBatchSecretID = %q", second)
+	}
+	for i := 1; i <= n; i++ {
+		if err := c.Service(i).StartReconstruction(second, c.Manager(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForReconstruction(t, instances, allNodes(n), second, secrets[1], 5*time.Second)
+	if _, err := instances.Await(services.IVSSBatchSecretID(batch, 1), allNodes(n), 100*time.Millisecond, abatest.Reconstructed); err == nil {
+		t.Error("Reconstructed a secret nobody asked for")
+	}
+}
+
+func TestIVSS_BatchSharingEncrypted(t *testing.T) {
+	n, f := 4, 1
+	keys, keyring, err := services.GenerateShareKeys(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ShareKey, nc.ShareKeys = keys[nc.ID], keyring
+		}))
+	instances := abatest.IVSSInstances(c)
+
+	batch := services.IVSSInstanceID("sealed-batch", 1)
+	secrets := []*big.Int{big.NewInt(5), big.NewInt(6)}
+	if err := c.Service(1).StartBatchSharing(batch, secrets, c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	for i, secret := range secrets {
+		id := services.IVSSBatchSecretID(batch, i+1)
+		waitForSharing(t, instances, allNodes(n), id, 5*time.Second)
+		for j := 1; j <= n; j++ {
+			c.Service(j).StartReconstruction(id, c.Manager(j))
+		}
+		waitForReconstruction(t, instances, allNodes(n), id, secret, 5*time.Second)
+	}
+}
+
+func TestIVSS_ShareRecovery(t *testing.T) {
+	for _, committed := range []bool{false, true} {
+		n, f := 4, 1
+		c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+			abatest.WithNodeContext(func(nc *services.NodeContext) {
+				nc.IVSSCommitments = committed
+			}))
+		instances := abatest.IVSSInstances(c)
+
+		// The share of node 4 gets lost
+		chaos := services.NewChaos(func(msg services.IVSSMessage) services.MessageInfo {
+			info := services.ClassifyIVSSMessage(msg)
+			if msg.Type == services.IVSS_Direct && msg.DirectType == services.Direct_Share && msg.To == 4 {
+				info.Type = "LOST"
+			}
+			return info
+		})
+		lost := chaos.Drop(services.MessageFilter{Type: "LOST"})
+		c.Network.SetChaos(chaos)
+
+		secret := big.NewInt(77)
+		instanceID := services.IVSSInstanceID("recover", 1)
+		if err := c.Service(1).StartSharing(instanceID, secret, c.Manager(1)); err != nil {
+			t.Fatal(err)
+		}
+		shared, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.SharingComplete)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lost.Hits() == 0 || shared[4].Poly != nil {
+			t.Fatalf("Node 4 got its share (commitments %v)", committed)
+		}
+
+		if err := c.Service(4).RecoverShare(instanceID, c.Manager(4)); err != nil {
+			t.Fatal(err)
+		}
+		recovered, err := instances.Await(instanceID, []int{4}, 5*time.Second, abatest.ShareRecovered)
+		if err != nil {
+			t.Fatalf("Commitments %v: %v", committed, err)
+		}
+		// f_4(j) = F(4, j) = f_j(4)
+		share := recovered[4].Poly
+		for j := 1; j <= 3; j++ {
+			if share.Evaluate(big.NewInt(int64(j))).Cmp(shared[j].Poly.Evaluate(big.NewInt(4))) != 0 {
+				t.Errorf("Commitments %v: recovered share disagrees with node %d", committed, j)
+			}
+		}
+		if err := c.Service(4).RecoverShare(instanceID, c.Manager(4)); err == nil {
+			t.Error("Recovered a share twice")
+		}
+		if got := c.NodeContext(4).Metrics.Get("ivss.shares.recovered"); got != 1 {
+			t.Errorf("ivss.shares.recovered = %d", got)
+		}
+
+		for i := 1; i <= n; i++ {
+			c.Service(i).StartReconstruction(instanceID, c.Manager(i))
+		}
+		waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
+	}
+}
+
+func TestIVSS_Resharing(t *testing.T) {
+	for _, committed := range []bool{false, true} {
+		n, f := 4, 1
+		c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+			abatest.WithNodeContext(func(nc *services.NodeContext) {
+				nc.IVSSCommitments = committed
+			}))
+		instances := abatest.IVSSInstances(c)
+
+		secret := big.NewInt(1234)
+		instanceID := services.IVSSInstanceID("long-lived", 2)
+		if err := c.Service(1).StartResharing(instanceID, c.Manager(1)); err == nil {
+			t.Error("Node 1 reshared an instance of node 2")
+		}
+		if err := c.Service(2).StartSharing(instanceID, secret, c.Manager(2)); err != nil {
+			t.Fatal(err)
+		}
+		shared, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.SharingComplete)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Two refreshes, each changing every share
+		for epoch := 1; epoch <= 2; epoch++ {
+			if err := c.Service(2).StartResharing(instanceID, c.Manager(2)); err != nil {
+				t.Fatal(err)
+			}
+			reshared, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.Reshared)
+			if err != nil {
+				t.Fatalf("Commitments %v, epoch %d: %v", committed, epoch, err)
+			}
+			for id, res := range reshared {
+				if res.Poly == nil || res.Poly.Coeffs[0].Cmp(shared[id].Poly.Coeffs[0]) == 0 {
+					t.Errorf("Commitments %v, epoch %d: share of node %d unchanged", committed, epoch, id)
+				}
+				shared[id] = res
+			}
+		}
+		if got := c.NodeContext(3).Metrics.Get("ivss.reshares"); got != 2 {
+			t.Errorf("ivss.reshares = %d, want 2", got)
+		}
+
+		for i := 1; i <= n; i++ {
+			c.Service(i).StartReconstruction(instanceID, c.Manager(i))
+		}
+		waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
+	}
+}
+
+func TestIVSS_ResharingMustShareZero(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.IVSSCommitments = true
+		}))
+	instances := abatest.IVSSInstances(c)
+
+	instanceID := services.IVSSInstanceID("tampered", 1)
+	if err := c.Service(1).StartSharing(instanceID, big.NewInt(5), c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second)
+
+	// The dealer "refreshes" with a sharing of 1, which would change the secret
+	refresh := services.IVSSInstanceID("tampered/refresh-1", 1)
+	if refresh != services.IVSSRefreshID(instanceID, 1) {
+		t.Fatalf("IVSSRefreshID = %q", services.IVSSRefreshID(instanceID, 1))
+	}
+	if err := c.Service(1).StartSharing(refresh, big.NewInt(1), c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instances.Await(instanceID, []int{2, 3, 4}, 300*time.Millisecond, abatest.Reshared); err == nil {
+		t.Error("Applied a refresh that does not share zero")
+	}
+	if !c.NodeContext(2).CP.IsSuspect(1) {
+		t.Error("Dealer of a non-zero refresh is not a suspect")
+	}
+}
+
+func TestIVSS_PrivateReconstruction(t *testing.T) {
+	n, f := 4, 1
+	keys, keyring, err := services.GenerateShareKeys(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ShareKey, nc.ShareKeys = keys[nc.ID], keyring
+		}))
+	instances := abatest.IVSSInstances(c)
+
+	// Only the receiver may see the shares
+	chaos := services.NewChaos(func(msg services.IVSSMessage) services.MessageInfo {
+		info := services.ClassifyIVSSMessage(msg)
+		if msg.Type == services.IVSS_Direct && msg.DirectType == services.Direct_PrivateReveal && msg.To != 3 {
+			info.Type = "LEAKED"
+		}
+		return info
+	})
+	leaked := chaos.Drop(services.MessageFilter{Type: "LEAKED"})
+	c.Network.SetChaos(chaos)
+
+	secret := big.NewInt(4242)
+	instanceID := services.IVSSInstanceID("private", 1)
+	if err := c.Service(1).StartSharing(instanceID, secret, c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second)
+
+	if err := c.Service(1).StartPrivateReconstruction(instanceID, n+1, c.Manager(1)); err == nil {
+		t.Error("Reconstructed toward a node outside the cluster")
+	}
+	for i := 1; i <= n; i++ {
+		if err := c.Service(i).StartPrivateReconstruction(instanceID, 3, c.Manager(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := instances.Await(instanceID, []int{3}, 5*time.Second, abatest.PrivatelyReconstructed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[3].Secret.Cmp(secret) != 0 {
+		t.Errorf("Receiver reconstructed %v, want %v", results[3].Secret, secret)
+	}
+	if _, err := instances.Await(instanceID, []int{1, 2, 4}, 200*time.Millisecond, func(res services.IVSSResult) bool {
+		return abatest.PrivatelyReconstructed(res) || abatest.Reconstructed(res)
+	}); err == nil {
+		t.Error("Nodes other than the receiver learned the secret")
+	}
+	if leaked.Hits() != 0 {
+		t.Errorf("%d shares were sent to nodes other than the receiver", leaked.Hits())
+	}
+}
+
+func TestIVSS_ReconstructionStartsOnce(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
+	instances := abatest.IVSSInstances(c)
+
+	secrets := make(map[string]*big.Int)
+	var ids []string
+	for dealer := 1; dealer <= 3; dealer++ {
+		id := services.IVSSInstanceID("once", dealer)
+		secrets[id] = big.NewInt(int64(700 + dealer))
+		ids = append(ids, id)
+		if err := c.Service(dealer).StartSharing(id, secrets[id], c.Manager(dealer)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range ids {
+		waitForSharing(t, instances, allNodes(n), id, 5*time.Second)
+	}
+
+	// Starting again, alone or in a batch, must not A-Cast a second REVEAL
+	for i := 1; i <= n; i++ {
+		if err := c.Service(i).StartReconstruction(ids[0], c.Manager(i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Service(i).StartReconstruction(ids[0], c.Manager(i)); err != nil {
+			t.Fatal(err)
+		}
+		if started := c.Service(i).StartReconstructions(ids, c.Manager(i)); len(started) != len(ids) {
+			t.Fatalf("Node %d started %v, want %v", i, started, ids)
+		}
+	}
+	for _, id := range ids {
+		waitForReconstruction(t, instances, allNodes(n), id, secrets[id], 5*time.Second)
+	}
+
+	for i := 1; i <= n; i++ {
+		metrics := c.NodeContext(i).Metrics
+		if got := metrics.Get("ivss.reconstructions.repeated"); got != 2 {
+			t.Errorf("Node %d repeated %d reconstructions, want 2", i, got)
+		}
+		if got := metrics.Get("ivss.reveal_batches"); got != 1 {
+			t.Errorf("Node %d sent %d REVEAL batches, want 1", i, got)
+		}
+		if got := metrics.Get("ivss.batched_reveals"); got != 2 {
+			t.Errorf("Node %d batched %d REVEALs, want 2", i, got)
+		}
+	}
+}
+
+func TestIVSS_WatchdogReportsStalledSharing(t *testing.T) {
+	n := 4
+	c := abatest.NewIVSSCluster(t, abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.IVSSWatchdog = 100 * time.Millisecond
+	}))
+	instances := abatest.IVSSInstances(c)
+
+	// The dealer's M-Set never arrives, so nobody completes the sharing
+	instanceID := services.IVSSInstanceID("stalled", 1)
+	chaos := services.NewChaos(func(msg services.IVSSMessage) services.MessageInfo {
+		info := services.ClassifyIVSSMessage(msg)
+		if msg.Type == services.IVSS_ACast && msg.ACastMsg.Type == services.MSG {
+			if p, err := services.ParseIVSSPayload(msg.ACastMsg.Val); err == nil && p.Type == services.Payload_MSet && p.InstanceID == instanceID {
+				info.Type = "MSET"
+			}
+		}
+		return info
+	})
+	mset := chaos.Drop(services.MessageFilter{Type: "MSET"})
+	c.Network.SetChaos(chaos)
+
+	if err := c.Service(1).StartSharing(instanceID, big.NewInt(5), c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.Stalled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mset.Hits() == 0 {
+		t.Fatal("The M-Set was never dropped")
+	}
+	for id, res := range results {
+		st := res.State
+		if st == nil || !st.HasShare || st.Equals != n*n || st.MSet != nil || st.Phase != "INIT" {
+			t.Errorf("Node %d reported state %+v", id, st)
+		}
+	}
+	if got := c.NodeContext(2).Metrics.Get("ivss.stalled"); got != 1 {
+		t.Errorf("ivss.stalled = %d, want 1", got)
+	}
+
+	// A completed sharing is not reported
+	done := services.IVSSInstanceID("done", 2)
+	if err := c.Service(2).StartSharing(done, big.NewInt(6), c.Manager(2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instances.Await(done, allNodes(n), 300*time.Millisecond, abatest.Stalled); err == nil {
+		t.Error("Reported a stall of a completed sharing")
+	}
+}
+
+func TestIVSS_InstanceStatus(t *testing.T) {
+	n := 4
+	c := abatest.NewIVSSCluster(t)
+	instances := abatest.IVSSInstances(c)
+	instanceID := services.IVSSInstanceID("status", 1)
+
+	if _, _, _, err := c.Service(2).GetInstanceStatus(instanceID); !errors.Is(err, services.ErrUnknownIVSSInstance) {
+		t.Errorf("Status of an unknown instance: %v", err)
+	}
+	secret := big.NewInt(11)
+	if err := c.Service(1).StartSharing(instanceID, secret, c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.SharingComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= n; id++ {
+		phase, mSet, _, err := c.Service(id).GetInstanceStatus(instanceID)
+		if err != nil || phase != "SHARED" || !slices.Equal(mSet, results[id].MSet) {
+			t.Errorf("Node %d status: %s %v, %v; want SHARED %v", id, phase, mSet, err, results[id].MSet)
+		}
+	}
+	// Every point is honest, so every node ends up consistent with all
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 1; id <= n; id++ {
+		for {
+			_, _, peers, _ := c.Service(id).GetInstanceStatus(instanceID)
+			if slices.Equal(peers, allNodes(n)) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %d is consistent with %v", id, peers)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	abatest.StartReconstruction(c, allNodes(n), instanceID)
+	waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
+	if phase, _, _, _ := c.Service(3).GetInstanceStatus(instanceID); phase != "RECONSTRUCTED" {
+		t.Errorf("Phase after reconstruction = %s", phase)
+	}
+}
+
+func TestIVSS_DualThresholdSharing(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewIVSSCluster(t, abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.IVSSDualThreshold = true
+	}))
+	instances := abatest.IVSSInstances(c)
+	instanceID := services.IVSSInstanceID("dual", 1)
+
+	secret := big.NewInt(31)
+	if err := c.Service(1).StartSharing(instanceID, secret, c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.SharingComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// F(0, k) lies on a polynomial of degree 2t through the secret
+	var xs, ys []*big.Int
+	for id := 1; id <= n; id++ {
+		r := results[id]
+		if r.Column == nil || len(r.Poly.Coeffs) != 2*f+1 || len(r.Column.Coeffs) != f+1 {
+			t.Fatalf("Node %d got row %v and column %v", id, r.Poly, r.Column)
+		}
+		xs = append(xs, big.NewInt(int64(id)))
+		ys = append(ys, r.Column.Evaluate(big.NewInt(0)))
+	}
+	if got := utils.InterpolateAtZero(xs[:2*f+1], ys[:2*f+1]); got.Cmp(secret) != 0 {
+		t.Errorf("2t+1 high-threshold shares interpolate to %v, want %v", got, secret)
+	}
+	if got := utils.InterpolateAtZero(xs[1:], ys[1:]); got.Cmp(secret) != 0 {
+		t.Errorf("Other 2t+1 high-threshold shares interpolate to %v, want %v", got, secret)
+	}
+
+	abatest.StartReconstruction(c, allNodes(n), instanceID)
+	waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
+}
+
+func TestBivariatePolynomial_RowsAndColumns(t *testing.T) {
+	poly, err := utils.NewRandomBivariatePolynomialFrom(rand.Reader, 1, 2, big.NewInt(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := int64(1); k <= 4; k++ {
+		for j := int64(1); j <= 4; j++ {
+			kBig, jBig := big.NewInt(k), big.NewInt(j)
+			if poly.Row(kBig).Evaluate(jBig).Cmp(poly.Column(jBig).Evaluate(kBig)) != 0 {
+				t.Fatalf("F(%d, %d) differs between row and column", k, j)
+			}
+		}
+	}
+	if got := poly.Row(big.NewInt(0)).Evaluate(big.NewInt(0)); got.Int64() != 9 {
+		t.Errorf("F(0, 0) = %v", got)
+	}
+}
+
+func TestSymmetricPolynomial_RowsInParallel(t *testing.T) {
+	poly, err := utils.NewRandomSymmetricPolynomial(5, big.NewInt(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sequential := poly.Rows(16, 1)
+	for _, workers := range []int{2, 4, 32} {
+		for k, row := range poly.Rows(16, workers) {
+			if !slices.EqualFunc(row.Coeffs, sequential[k].Coeffs, func(a, b *big.Int) bool { return a.Cmp(b) == 0 }) {
+				t.Fatalf("Row %d differs with %d workers", k+1, workers)
+			}
+		}
+	}
+}
+
+func TestIVSS_FieldPerInstance(t *testing.T) {
+	n := 4
+	c := abatest.NewIVSSCluster(t, abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.IVSSField = func(instanceID string) *utils.Field {
+			if strings.HasPrefix(instanceID, "bls") {
+				return utils.BLS12381Scalar
+			}
+			return nil
+		}
+	}))
+	instances := abatest.IVSSInstances(c)
+	blsID := services.IVSSInstanceID("bls-key", 1)
+	defaultID := services.IVSSInstanceID("plain", 2)
+
+	r := utils.BLS12381Scalar.Modulus
+	if err := c.Service(1).StartSharing(blsID, r, c.Manager(1)); err == nil {
+		t.Error("Shared a secret outside the field of the instance")
+	}
+	// Both are elements of the default field, only one of the BLS one
+	blsSecret := new(big.Int).Sub(r, big.NewInt(1))
+	defaultSecret := new(big.Int).Add(r, big.NewInt(1))
+	if err := c.Service(1).StartSharing(blsID, blsSecret, c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Service(2).StartSharing(defaultID, defaultSecret, c.Manager(2)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := instances.Await(blsID, allNodes(n), 5*time.Second, abatest.SharingComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= n; id++ {
+		if !utils.BLS12381Scalar.ContainsPolynomial(results[id].Poly) {
+			t.Errorf("Node %d got a share outside the BLS12-381 scalar field", id)
+		}
+	}
+	if _, err := instances.Await(defaultID, allNodes(n), 5*time.Second, abatest.SharingComplete); err != nil {
+		t.Fatal(err)
+	}
+
+	abatest.StartReconstruction(c, allNodes(n), blsID)
+	abatest.StartReconstruction(c, allNodes(n), defaultID)
+	waitForReconstruction(t, instances, allNodes(n), blsID, blsSecret, 5*time.Second)
+	waitForReconstruction(t, instances, allNodes(n), defaultID, defaultSecret, 5*time.Second)
+}
+
+func TestField_Arithmetic(t *testing.T) {
+	if _, err := utils.NewField("composite", big.NewInt(91)); err == nil {
+		t.Error("Accepted a composite modulus")
+	}
+	if _, err := utils.NewField("wide", new(big.Int).Lsh(big.NewInt(1), 8*uint(utils.FieldElementSize)+1)); err == nil {
+		t.Error("Accepted a modulus wider than a field element")
+	}
+	small, err := utils.NewField("f101", big.NewInt(101))
+	if err != nil {
+		t.Fatal(err)
+	}
+	poly, err := small.NewRandomSymmetricPolynomial(rand.Reader, 2, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var xs, ys []*big.Int
+	for k := int64(1); k <= 7; k++ {
+		row := poly.GetUnivariatePolynomial(big.NewInt(k))
+		if !small.ContainsPolynomial(row) {
+			t.Fatalf("Row %d outside the field", k)
+		}
+		xs = append(xs, big.NewInt(k))
+		ys = append(ys, small.Evaluate(row, big.NewInt(0)))
+	}
+	if got := small.InterpolateAtZero(xs[:3], ys[:3]); got.Int64() != 100 {
+		t.Errorf("Interpolated %v, want 100", got)
+	}
+	ys[4] = new(big.Int).Mod(new(big.Int).Add(ys[4], big.NewInt(1)), small.Modulus)
+	g, wrong, err := small.CorrectErrors(xs, ys, 2, 2)
+	if err != nil || small.Evaluate(g, big.NewInt(0)).Int64() != 100 || !slices.Equal(wrong, []int{4}) {
+		t.Errorf("CorrectErrors = %v, %v, %v", g, wrong, err)
+	}
+}
+
+func TestIVSS_AssistedMSetCompletesWithoutDealer(t *testing.T) {
+	n := 4
+	c := abatest.NewIVSSCluster(t, abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.IVSSAssistMSet = true
+	}))
+	instances := abatest.IVSSInstances(c)
+
+	// The dealer's M-Set never arrives, as if it crashed after dealing
+	instanceID := services.IVSSInstanceID("assisted", 1)
+	chaos := services.NewChaos(func(msg services.IVSSMessage) services.MessageInfo {
+		info := services.ClassifyIVSSMessage(msg)
+		if msg.Type == services.IVSS_ACast && msg.ACastMsg.Type == services.MSG {
+			if p, err := services.ParseIVSSPayload(msg.ACastMsg.Val); err == nil && p.Type == services.Payload_MSet && p.RevealSender == 0 {
+				info.Type = "DEALER_MSET"
+			}
+		}
+		return info
+	})
+	mset := chaos.Drop(services.MessageFilter{Type: "DEALER_MSET"})
+	c.Network.SetChaos(chaos)
+
+	secret := big.NewInt(17)
+	if err := c.Service(1).StartSharing(instanceID, secret, c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.SharingComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mset.Hits() == 0 {
+		t.Fatal("The dealer's M-Set was never dropped")
+	}
+	assisted := 0
+	for id := 1; id <= n; id++ {
+		if len(results[id].MSet) < n-1 {
+			t.Errorf("Node %d completed with M-Set %v", id, results[id].MSet)
+		}
+		assisted += int(c.NodeContext(id).Metrics.Get("ivss.assisted_msets"))
+	}
+	if assisted != n {
+		t.Errorf("%d nodes completed with an assisted M-Set, want %d", assisted, n)
+	}
+
+	abatest.StartReconstruction(c, allNodes(n), instanceID)
+	waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
+}
+
+func TestIVSS_SharingCertificate(t *testing.T) {
+	n, f := 4, 1
+	keys, keyring, err := services.GenerateKeys(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := abatest.NewIVSSCluster(t, abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.SigningKey, nc.Keyring = keys[nc.ID], keyring
+	}))
+	instances := abatest.IVSSInstances(c)
+	instanceID := services.IVSSInstanceID("certified", 1)
+	if err := c.Service(1).StartSharing(instanceID, big.NewInt(11), c.Manager(1)); err != nil {
+		t.Fatal(err)
+	}
+	results, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.SharingComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certs []*services.IVSSCertificate
+	for id := 1; id <= n; id++ {
+		cert := results[id].Certificate
+		if cert == nil {
+			t.Fatalf("Node %d reported no certificate", id)
+		}
+		if err := cert.Verify(n, f, keyring); err != nil {
+			t.Errorf("Certificate of node %d rejected: %v", id, err)
+		}
+		if m := len(cert.MSet); len(cert.Deliveries) != 1+m*(m-1) {
+			t.Errorf("Certificate of node %d names %d deliveries for an M-Set of %d", id, len(cert.Deliveries), m)
+		}
+		certs = append(certs, cert)
+	}
+	if err := services.VerifyIVSSCertificates(instanceID, certs, n, f, keyring); err != nil {
+		t.Errorf("Certificates of every node rejected: %v", err)
+	}
+
+	// One signer is not enough, however often it signs
+	if err := services.VerifyIVSSCertificates(instanceID, []*services.IVSSCertificate{certs[0], certs[0]}, n, f, keyring); err == nil {
+		t.Error("Accepted the certificate of a single node")
+	}
+	forged := *certs[1]
+	forged.MSet = forged.MSet[:n-f-1]
+	if err := forged.Verify(n, f, keyring); err == nil {
+		t.Error("Accepted a certificate with a small M-Set")
+	}
+	relabeled := *certs[1]
+	relabeled.Signer = certs[0].Signer
+	if err := relabeled.Verify(n, f, keyring); err == nil {
+		t.Error("Accepted a certificate signed by another node")
+	}
+	if err := services.VerifyIVSSCertificates(instanceID, []*services.IVSSCertificate{certs[0], &relabeled}, n, f, keyring); err == nil {
+		t.Error("Accepted a relabeled certificate")
+	}
+}
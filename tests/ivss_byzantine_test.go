@@ -1,90 +1,402 @@
 package tests
 
 import (
+	"async-agreement-protocol-3/abatest"
 	"async-agreement-protocol-3/services"
 	"async-agreement-protocol-3/utils"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"math/big"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/rs/zerolog"
 )
 
 func TestIVSS_Byzantine_Reconstruction_BadShare(t *testing.T) {
 	n := 4
 	f := 1
-	network, servicesList, managers := setupIVSSWithDemux(t, n, f)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
-		}
-	}()
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
+	instances := abatest.IVSSInstances(c)
 
 	secretVal := int64(42)
 	secret := big.NewInt(secretVal)
-	instanceID := "test-ivss-byzantine-1"
-	registerInstanceListener(instanceID, n)
+	instanceID := services.IVSSInstanceID("test-ivss-byzantine-1", 1)
+
+	// Node 4 (the Byzantine node) reveals a random polynomial instead of its
+	// share, which is inconsistent with the points the others hold.
+	coeffs := make([]*big.Int, f+1)
+	coeffs[0] = big.NewInt(999) // Secret
+	for i := 1; i <= f; i++ {
+		coeffs[i] = big.NewInt(int64(i + 100)) // Random coeffs
+	}
+	badPoly := &utils.Polynomial{Coeffs: coeffs}
 
 	// 1. Start Sharing (Normal)
-	servicesList[1].StartSharing(instanceID, secret, managers[1])
+	c.Service(1).StartSharing(instanceID, secret, c.Manager(1))
 
 	// Wait for Sharing Complete
-	results := instanceResults[instanceID]
-	waitForSharing(t, n, results, instanceID)
-	t.Log("Sharing complete. Preparing for Byzantine Reconstruction...")
+	waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second)
+	t.Log("Sharing complete. Starting reconstruction with a Byzantine Node 4...")
 
-	// 2. Stop Node 4 (The Byzantine Node)
-	managers[4].Stop()
-	t.Log("Node 4 stopped.")
+	chaos := services.NewChaos(services.ClassifyIVSSMessage)
+	reveal := chaos.Rewrite(services.MessageFilter{Layer: services.Layer_IVSS, Type: "MSG", Sender: 4}, func(msg services.IVSSMessage) services.IVSSMessage {
+		payload, err := services.ParseIVSSPayload(msg.ACastMsg.Val)
+		if err != nil || payload.Type != services.Payload_Reveal {
+			return msg
+		}
+		payload.RevealPoly = badPoly
+		acastMsg := *msg.ACastMsg
+		acastMsg.Val = payload.String()
+		msg.ACastMsg = &acastMsg
+		return msg
+	})
+	c.Network.SetChaos(chaos)
 
-	// 3. Start Reconstruction on Honest Nodes (1, 2, 3)
-	for i := 1; i <= 3; i++ {
-		servicesList[i].StartReconstruction(instanceID, managers[i])
+	// 2. Start Reconstruction on all nodes, Node 4's reveal gets corrupted
+	for i := 1; i <= n; i++ {
+		c.Service(i).StartReconstruction(instanceID, c.Manager(i))
 	}
 
-	// 4. Inject Malicious Payload from Node 4
-	// Create a random/bad polynomial
-	// Honest poly for node 4 would be consistent with others.
-	// We create a random one which will be inconsistent.
-	coeffs := make([]*big.Int, f+1)
-	coeffs[0] = big.NewInt(999) // Secret
-	for i := 1; i <= f; i++ {
-		coeffs[i] = big.NewInt(int64(i + 100)) // Random coeffs
+	// 3. Wait for Reconstruction Complete on Honest Nodes
+	// They decode around Node 4's reveal whenever it arrives and reconstruct the correct secret.
+	waitForReconstruction(t, instances, []int{1, 2, 3}, instanceID, secret, 5*time.Second)
+	if reveal.Hits() == 0 {
+		t.Fatal("Node 4's reveal was never corrupted")
 	}
-	badPoly := &utils.Polynomial{Coeffs: coeffs}
+	t.Log("IVSS Protocol tolerated Byzantine node and reconstructed correct secret!")
+}
 
-	payload := services.IVSSPayload{
-		InstanceID:   instanceID,
-		Type:         services.Payload_Reveal,
-		RevealPoly:   badPoly,
-		RevealSender: 4,
+func TestIVSS_RejectsForgedReveal(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
+	instances := abatest.IVSSInstances(c)
+
+	secret := big.NewInt(77)
+	instanceID := services.IVSSInstanceID("forged-reveal", 1)
+	c.Service(1).StartSharing(instanceID, secret, c.Manager(1))
+	waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second)
+
+	// Node 4 reveals a polynomial of its own choosing in the name of node 1
+	chaos := services.NewChaos(services.ClassifyIVSSMessage)
+	forged := chaos.Rewrite(services.MessageFilter{Layer: services.Layer_IVSS, Type: "MSG", Sender: 4}, func(msg services.IVSSMessage) services.IVSSMessage {
+		payload, err := services.ParseIVSSPayload(msg.ACastMsg.Val)
+		if err != nil || payload.Type != services.Payload_Reveal {
+			return msg
+		}
+		payload.RevealSender = 1
+		payload.RevealPoly = &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(999), big.NewInt(1)}}
+		acastMsg := *msg.ACastMsg
+		acastMsg.Val = payload.String()
+		msg.ACastMsg = &acastMsg
+		return msg
+	})
+	c.Network.SetChaos(chaos)
+
+	// Node 4 reveals first, so a forged REVEAL that counted would take the
+	// slot of node 1
+	c.Service(4).StartReconstruction(instanceID, c.Manager(4))
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 1; id <= 3; id++ {
+		for c.NodeContext(id).Metrics.Get("ivss.foreign_reveals") == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %d did not reject the forged REVEAL (%d rewritten)", id, forged.Hits())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	for id := 1; id <= 3; id++ {
+		c.Service(id).StartReconstruction(instanceID, c.Manager(id))
 	}
-	payloadBytes, _ := json.Marshal(payload)
-	payloadStr := string(payloadBytes)
+	waitForReconstruction(t, instances, []int{1, 2, 3}, instanceID, secret, 5*time.Second)
+}
 
-	// Create ACast VAL message
-	uuid := fmt.Sprintf("%s-REVEAL-%d", instanceID, 4)
+func TestCorrectErrors_DecodesAroundCorruptedPoints(t *testing.T) {
+	degree, n := 2, 10
+	poly := &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(42), big.NewInt(7), big.NewInt(-3)}}
+	xs := make([]*big.Int, n)
+	ys := make([]*big.Int, n)
+	for i := range xs {
+		xs[i] = big.NewInt(int64(i + 1))
+		ys[i] = poly.Evaluate(xs[i])
+	}
+	// (n-degree-1)/2 = 3 errors are correctable
+	for _, i := range []int{0, 4, 9} {
+		ys[i] = big.NewInt(999)
+	}
+	got, wrong, err := utils.CorrectErrors(xs, ys, degree, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Evaluate(big.NewInt(0)).Int64() != 42 {
+		t.Errorf("Decoded %v", got.Coeffs)
+	}
+	if len(wrong) != 3 || wrong[0] != 0 || wrong[1] != 4 || wrong[2] != 9 {
+		t.Errorf("Reported errors at %v, want [0 4 9]", wrong)
+	}
 
-	acastMsg := services.ACastMessage[string]{
-		From: 4,
-		Type: services.MSG,
-		Val:  payloadStr,
-		UUID: uuid,
+	// A fourth error is beyond the bound
+	ys[6] = big.NewInt(1000)
+	if _, _, err := utils.CorrectErrors(xs, ys, degree, 3); !errors.Is(err, utils.ErrUndecodable) {
+		t.Errorf("Decoded with too many errors: %v", err)
+	}
+	if _, _, err := utils.CorrectErrors(xs, ys, degree, 4); err == nil {
+		t.Error("Decoded 4 errors from 10 points of degree 2")
 	}
+}
+
+func TestIVSS_RejectsShareFromNonDealer(t *testing.T) {
+	svc := services.NewIVSSService(3, 4, 1, nil, zerolog.Disabled)
+	ctx := &recordingContext[services.IVSSMessage, services.IVSSResult]{}
+	id := services.IVSSInstanceID("hijack", 1)
+	share := &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(1), big.NewInt(2)}}
 
-	wrapper := services.IVSSMessage{
-		Type:     services.IVSS_ACast,
-		ACastMsg: &acastMsg,
+	// Node 2 races the dealer with a share of its own
+	svc.OnMessage(services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Share, To: 3, From: 2, InstanceID: id, Poly: share}, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Sent %d points for a share from a non-dealer", len(ctx.broadcasts))
+	}
+	svc.OnMessage(services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Share, To: 3, From: 1, InstanceID: id, Poly: share}, ctx)
+	if len(ctx.broadcasts) != 4 {
+		t.Errorf("Sent %d points for the dealer's share, want 4", len(ctx.broadcasts))
 	}
 
-	// Broadcast to all nodes
-	// We need to wait a bit to ensure honest nodes have started reconstruction and are listening
-	time.Sleep(100 * time.Millisecond)
-	network.Broadcast(wrapper)
-	t.Log("Malicious payload broadcasted from Node 4")
+	if err := svc.StartSharing(id, big.NewInt(7), ctx); err == nil {
+		t.Error("Dealt an instance of node 1")
+	}
+	for id, dealer := range map[string]int{"a@1": 1, "ICC-1-2-3@2": 2, "ICC-3#2@2": 2, "a@b@4": 0, "a": 0, "a@": 0, "a@02": 0, "a@0": 0, "a@-1": 0} {
+		if got, ok := services.IVSSDealer(id); got != dealer || ok != (dealer != 0) {
+			t.Errorf("IVSSDealer(%q) = %d, %v, want %d", id, got, ok, dealer)
+		}
+	}
+}
 
-	// 5. Wait for Reconstruction Complete on Honest Nodes
-	// They should detect inconsistency and exclude Node 4, reconstructing the correct secret.
-	waitForReconstructionSubset(t, []int{1, 2, 3}, results, instanceID, secret)
-	t.Log("IVSS Protocol tolerated Byzantine node and reconstructed correct secret!")
+func TestIVSS_InstanceIDs(t *testing.T) {
+	for _, id := range []services.IVSSID{
+		{Dealer: 1, Tag: "a"},
+		{Dealer: 4, Round: 7, Tag: "ICC-2"},
+		{Dealer: 2, Round: 1, Tag: "sync/refresh-3"},
+	} {
+		parsed, err := services.ParseIVSSID(id.String())
+		if err != nil || parsed != id {
+			t.Errorf("ParseIVSSID(%q) = %+v, %v", id.String(), parsed, err)
+		}
+	}
+	for _, id := range []string{"", "@1", "#2@1", "a#0@1", "a#02@1", "a#-1@1", "a#b#1@1", "a\x00@1", strings.Repeat("a", services.MaxIVSSTag+1) + "@1"} {
+		if _, err := services.ParseIVSSID(id); err == nil {
+			t.Errorf("Parsed malformed ID %q", id)
+		}
+	}
+	if got := services.IVSSBatchSecretID("b#3@2", 5); got != "b-5#3@2" {
+		t.Errorf("IVSSBatchSecretID = %q", got)
+	}
+
+	// Direct messages of malformed or foreign instances are dropped
+	svc := services.NewIVSSService(3, 4, 1, nil, zerolog.Disabled)
+	ctx := &recordingContext[services.IVSSMessage, services.IVSSResult]{}
+	share := &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(1), big.NewInt(2)}}
+	for _, id := range []string{"a#x@1", "a@b@1", "a@9"} {
+		svc.OnMessage(services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Point, To: 3, From: 1, InstanceID: id, Point: big.NewInt(1)}, ctx)
+	}
+	svc.OnMessage(services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Share, To: 3, From: 9, InstanceID: "a@9", Poly: share}, ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Errorf("Sent %d messages for malformed instances", len(ctx.broadcasts))
+	}
+	if _, ok := svc.InstanceState("a@9"); ok {
+		t.Error("Opened an instance of a dealer outside the cluster")
+	}
+}
+
+func TestIVSS_EarlyPointsKeepFirstPerSender(t *testing.T) {
+	nc := services.NewNodeContext(3, 4, 1, zerolog.Disabled)
+	svc := services.NewIVSSServiceWithContext(nc)
+	ctx := &recordingContext[services.IVSSMessage, services.IVSSResult]{}
+	id := services.IVSSInstanceID("early", 1)
+
+	poly, err := utils.NewRandomSymmetricPolynomial(1, big.NewInt(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := func(from int, value *big.Int) services.IVSSMessage {
+		return services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Point, To: 3, From: from, InstanceID: id, Point: value}
+	}
+	// Node 2 floods the buffer before the share arrives; only its first
+	// point counts
+	svc.OnMessage(point(2, poly.GetUnivariatePolynomial(big.NewInt(2)).Evaluate(big.NewInt(3))), ctx)
+	for i := int64(0); i < 100; i++ {
+		svc.OnMessage(point(2, big.NewInt(i)), ctx)
+	}
+	svc.OnMessage(point(4, big.NewInt(1)), ctx)
+	if st, _ := svc.InstanceState(id); st.EarlyPoints != 2 {
+		t.Errorf("Buffered points of %d nodes, want 2", st.EarlyPoints)
+	}
+	if got := nc.Metrics.Get("ivss.early_points_dropped"); got != 100 {
+		t.Errorf("ivss.early_points_dropped = %d, want 100", got)
+	}
+
+	share := poly.GetUnivariatePolynomial(big.NewInt(3))
+	svc.OnMessage(services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Share, To: 3, From: 1, InstanceID: id, Poly: share}, ctx)
+	if _, _, consistent, _ := svc.GetInstanceStatus(id); !slices.Equal(consistent, []int{2}) {
+		t.Errorf("Consistent with %v, want [2]", consistent)
+	}
+}
+
+func TestIVSS_CommitmentRejectsBadShare(t *testing.T) {
+	nc := services.NewNodeContext(3, 4, 1, zerolog.Disabled)
+	nc.IVSSCommitments = true
+	svc := services.NewIVSSServiceWithContext(nc)
+	ctx := &recordingContext[services.IVSSMessage, services.IVSSResult]{}
+	id := services.IVSSInstanceID("committed", 1)
+
+	poly, err := utils.NewRandomSymmetricPolynomial(1, big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := poly.GetUnivariatePolynomial(big.NewInt(3))
+	bad := &utils.Polynomial{Coeffs: []*big.Int{new(big.Int).Add(share.Coeffs[0], big.NewInt(1)), share.Coeffs[1]}}
+
+	// The share waits for the commitment, which then exposes it
+	svc.OnMessage(services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Share, To: 3, From: 1, InstanceID: id, Poly: bad}, ctx)
+	commit := services.IVSSPayload{InstanceID: id, Type: services.Payload_Commit, Commitment: utils.Commit(poly).Values}
+	svc.OnACastDelivered(commit.String(), ctx)
+	if len(ctx.broadcasts) != 0 {
+		t.Fatalf("Sent %d points for a share that does not match the commitment", len(ctx.broadcasts))
+	}
+	if !nc.CP.IsSuspect(1) {
+		t.Error("Dealer of a bad share is not suspected")
+	}
+	if got := nc.Metrics.Get("ivss.bad_shares"); got != 1 {
+		t.Errorf("ivss.bad_shares = %d, want 1", got)
+	}
+
+	svc.OnMessage(services.IVSSMessage{Type: services.IVSS_Direct, DirectType: services.Direct_Share, To: 3, From: 1, InstanceID: id, Poly: share}, ctx)
+	if len(ctx.broadcasts) != 4 {
+		t.Errorf("Sent %d points for the committed share, want 4", len(ctx.broadcasts))
+	}
+}
+
+func TestIVSS_CommitmentVerifiesShares(t *testing.T) {
+	q, p := utils.CommitmentModulus, utils.Prime
+	if !q.ProbablyPrime(32) || new(big.Int).Mod(new(big.Int).Sub(q, big.NewInt(1)), p).Sign() != 0 {
+		t.Fatal("Commitment modulus is not a prime q with Prime | q-1")
+	}
+	g := utils.CommitmentGenerator
+	if g.Cmp(big.NewInt(1)) == 0 || new(big.Int).Exp(g, p, q).Cmp(big.NewInt(1)) != 0 {
+		t.Fatal("Commitment generator does not have order Prime")
+	}
+
+	poly, err := utils.NewRandomSymmetricPolynomial(2, big.NewInt(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := utils.NewCommitment(utils.Commit(poly).Values)
+	if err != nil || c.Degree != 2 {
+		t.Fatalf("NewCommitment = %v, %v", c, err)
+	}
+	for k := 1; k <= 7; k++ {
+		if !c.VerifyShare(k, poly.GetUnivariatePolynomial(big.NewInt(int64(k)))) {
+			t.Errorf("Share of node %d rejected", k)
+		}
+	}
+	if c.VerifyShare(2, poly.GetUnivariatePolynomial(big.NewInt(3))) {
+		t.Error("Share of node 3 accepted for node 2")
+	}
+
+	if _, err := utils.NewCommitment(c.Values[:5]); err == nil {
+		t.Error("Accepted 5 values")
+	}
+	outside := append([]*big.Int{new(big.Int).Sub(q, big.NewInt(1))}, c.Values[1:]...)
+	if _, err := utils.NewCommitment(outside); err == nil {
+		t.Error("Accepted a value outside the subgroup")
+	}
+}
+
+func TestIVSS_BlameInconsistentDealer(t *testing.T) {
+	n := 4
+	keys, keyring, err := services.GenerateKeys(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := abatest.NewIVSSCluster(t, abatest.WithNodeContext(func(nc *services.NodeContext) {
+		nc.SigningKey, nc.Keyring = keys[nc.ID], keyring
+	}))
+	instanceID := services.IVSSInstanceID("blamed", 1)
+
+	// Dealer 1 signs a share for node 4 that is off its polynomial
+	chaos := services.NewChaos(services.ClassifyIVSSMessage)
+	bad := chaos.Rewrite(services.MessageFilter{Layer: services.Layer_IVSS, Type: "SHARE", Sender: 1}, func(msg services.IVSSMessage) services.IVSSMessage {
+		coeffs := append([]*big.Int{new(big.Int).Add(msg.Poly.Coeffs[0], big.NewInt(1))}, msg.Poly.Coeffs[1:]...)
+		msg.Poly = &utils.Polynomial{Coeffs: coeffs}
+		msg.Signature = services.SignIVSSDirect(keys[1], msg)
+		return msg
+	}).To(4)
+	c.Network.SetChaos(chaos)
+	c.Service(1).StartSharing(instanceID, big.NewInt(42), c.Manager(1))
+
+	// Every node verifies the blames and certifies the dealer
+	instances := abatest.IVSSInstances(c)
+	if _, err := instances.Await(instanceID, allNodes(n), 5*time.Second, abatest.Blamed); err != nil {
+		t.Fatal(err)
+	}
+	if bad.Hits() == 0 {
+		t.Fatal("The share of node 4 was never corrupted")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, id := range []int{2, 3, 4} {
+		for !c.NodeContext(id).CP.IsCertifiedFaulty(id, 1) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %d did not certify the dealer", id)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestIVSSBlame_Verify(t *testing.T) {
+	keys, keyring, err := services.GenerateKeys(4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := services.IVSSInstanceID("proof", 1)
+	share := &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(5), big.NewInt(1)}}
+	shareMsg := services.IVSSMessage{DirectType: services.Direct_Share, From: 1, To: 3, InstanceID: id, Poly: share}
+	pointMsg := services.IVSSMessage{DirectType: services.Direct_Point, From: 2, To: 3, InstanceID: id, Point: big.NewInt(9)}
+	blame := services.IVSSBlame{
+		Kind:           services.Blame_InconsistentPoint,
+		InstanceID:     id,
+		Dealer:         1,
+		Accuser:        3,
+		Share:          share,
+		ShareSignature: services.SignIVSSDirect(keys[1], shareMsg),
+		Point:          pointMsg.Point,
+		PointFrom:      2,
+		PointSignature: services.SignIVSSDirect(keys[2], pointMsg),
+	}
+	if err := blame.Verify(4, 1, keyring, nil); err != nil {
+		t.Fatalf("Valid blame rejected: %v", err)
+	}
+
+	// The share gives 7 at node 2, so a point of 7 is no evidence
+	agreeing := blame
+	pointMsg.Point = big.NewInt(7)
+	agreeing.Point, agreeing.PointSignature = pointMsg.Point, services.SignIVSSDirect(keys[2], pointMsg)
+	if err := agreeing.Verify(4, 1, keyring, nil); err == nil {
+		t.Error("Accepted a blame whose share and point agree")
+	}
+	// Node 3 cannot sign the point of node 2 itself
+	forged := blame
+	forged.PointSignature = services.SignIVSSDirect(keys[3], pointMsg)
+	if err := forged.Verify(4, 1, keyring, nil); err == nil {
+		t.Error("Accepted a point signed by the accuser")
+	}
+
+	mset := services.IVSSBlame{Kind: services.Blame_BadMSet, InstanceID: id, Dealer: 1, Accuser: 3, MSet: []int{1, 2}}
+	if err := mset.Verify(4, 1, keyring, nil); err != nil {
+		t.Errorf("Small M-Set blame rejected: %v", err)
+	}
+	mset.MSet = []int{1, 2, 3}
+	if err := mset.Verify(4, 1, keyring, nil); err == nil {
+		t.Error("Accepted a blame of an M-Set of n-t nodes")
+	}
 }
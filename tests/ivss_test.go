@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"async-agreement-protocol-3/abatest"
 	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
 	"fmt"
 	"math/big"
 	"sync"
@@ -11,126 +13,79 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// --- Stress Test Infrastructure ---
-
-var (
-	instanceResultsMu sync.Mutex
-	instanceResults   = make(map[string]map[int]chan services.IVSSResult)
-)
-
-func registerInstanceListener(instanceID string, n int) {
-	instanceResultsMu.Lock()
-	defer instanceResultsMu.Unlock()
-	instanceResults[instanceID] = make(map[int]chan services.IVSSResult)
-	for i := 1; i <= n; i++ {
-		instanceResults[instanceID][i] = make(chan services.IVSSResult, 100)
-	}
-}
-
-func dispatchResult(nodeID int, res services.IVSSResult) {
-	instanceResultsMu.Lock()
-	defer instanceResultsMu.Unlock()
-	if chans, ok := instanceResults[res.InstanceID]; ok {
-		if ch, ok := chans[nodeID]; ok {
-			ch <- res
-		}
-	}
-}
-
-func setupIVSSWithDemux(t *testing.T, n, f int) (*services.Network[services.IVSSMessage], []*services.IVSSService, []*services.ServiceManager[services.IVSSMessage, services.IVSSResult]) {
-	network := services.NewNetwork[services.IVSSMessage]()
-	managers := make([]*services.ServiceManager[services.IVSSMessage, services.IVSSResult], n+1)
-	servicesList := make([]*services.IVSSService, n+1)
-
-	for i := 1; i <= n; i++ {
-		cp := services.NewCertificationProtocol()
-		svc := services.NewIVSSService(i, n, f, cp, zerolog.Disabled)
-		servicesList[i] = svc
-		mgr := services.NewServiceManager[services.IVSSMessage, services.IVSSResult](svc, network)
-		managers[i] = mgr
-		network.Register(i, mgr.Inbox())
-		mgr.Start()
-
-		go func(id int, m *services.ServiceManager[services.IVSSMessage, services.IVSSResult]) {
-			for res := range m.Result() {
-				dispatchResult(id, res)
-			}
-		}(i, mgr)
-	}
-	return network, servicesList, managers
-}
-
 // --- Tests ---
 
 func TestIVSS_NormalExecution(t *testing.T) {
 	n := 4
 	f := 1
-	_, servicesList, managers := setupIVSSWithDemux(t, n, f)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
-		}
-	}()
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
+	instances := abatest.IVSSInstances(c)
 
 	secretVal := int64(42)
 	secret := big.NewInt(secretVal)
-	instanceID := "test-ivss-1"
-	registerInstanceListener(instanceID, n)
+	instanceID := services.IVSSInstanceID("test-ivss-1", 1)
 
 	// Start Sharing
-	servicesList[1].StartSharing(instanceID, secret, managers[1])
+	c.Service(1).StartSharing(instanceID, secret, c.Manager(1))
 
 	// Wait for Sharing Complete
-	results := instanceResults[instanceID]
-	waitForSharing(t, n, results, instanceID)
+	waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second)
 
 	t.Log("All nodes completed sharing. Starting Reconstruction...")
 
 	// Start Reconstruction
 	for i := 1; i <= n; i++ {
-		servicesList[i].StartReconstruction(instanceID, managers[i])
+		c.Service(i).StartReconstruction(instanceID, c.Manager(i))
 	}
 
 	// Wait for Reconstruction Complete
-	waitForReconstruction(t, n, results, instanceID, secret)
+	waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
 	t.Log("IVSS Protocol Test Passed Successfully")
 }
 
+func TestIVSS_Commitments(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.IVSSCommitments = true
+		}))
+	instances := abatest.IVSSInstances(c)
+
+	secret := big.NewInt(42)
+	instanceID := services.IVSSInstanceID("committed", 2)
+	if err := c.Service(2).StartSharing(instanceID, secret, c.Manager(2)); err != nil {
+		t.Fatal(err)
+	}
+	waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second)
+
+	for i := 1; i <= n; i++ {
+		c.Service(i).StartReconstruction(instanceID, c.Manager(i))
+	}
+	waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
+	if got := c.NodeContext(1).Metrics.Get("ivss.bad_shares"); got != 0 {
+		t.Errorf("ivss.bad_shares = %d for an honest dealer", got)
+	}
+}
+
 func TestIVSS_SilentNode(t *testing.T) {
 	n := 4
 	f := 1
-	_, servicesList, managers := setupIVSSWithDemux(t, n, f)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
-		}
-	}()
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
+	instances := abatest.IVSSInstances(c)
 
 	// Stop node 4 to simulate silence
-	managers[4].Stop()
+	c.Manager(4).Stop()
 
 	secretVal := int64(99)
 	secret := big.NewInt(secretVal)
-	instanceID := "test-ivss-silent-1"
-	registerInstanceListener(instanceID, n)
+	instanceID := services.IVSSInstanceID("test-ivss-silent-1", 1)
 
 	// Start Sharing
-	servicesList[1].StartSharing(instanceID, secret, managers[1])
+	c.Service(1).StartSharing(instanceID, secret, c.Manager(1))
 
 	// Wait for Sharing Complete (expecting n-1 nodes)
-	time.Sleep(2 * time.Second)
-
-	results := instanceResults[instanceID]
-	count := 0
-	for _, ch := range results {
-		select {
-		case res := <-ch:
-			if res.Type == "SHARING_COMPLETE" {
-				count++
-			}
-		default:
-		}
-	}
+	results, _ := instances.Await(instanceID, allNodes(n), 2*time.Second, abatest.SharingComplete)
+	count := len(results)
 
 	if count < n-f {
 		t.Errorf("Expected at least %d nodes to complete sharing, got %d", n-f, count)
@@ -141,12 +96,8 @@ func TestIVSS_SilentNode(t *testing.T) {
 func TestIVSS_Stress_Concurrent(t *testing.T) {
 	n := 4
 	f := 1
-	_, servicesList, managers := setupIVSSWithDemux(t, n, f)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
-		}
-	}()
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f))
+	instances := abatest.IVSSInstances(c)
 
 	numInstances := 20 // Run 20 concurrent instances
 	var wg sync.WaitGroup
@@ -155,28 +106,25 @@ func TestIVSS_Stress_Concurrent(t *testing.T) {
 		wg.Add(1)
 		go func(idx int) {
 			defer wg.Done()
-			instanceID := fmt.Sprintf("stress-ivss-%d", idx)
+			dealerID := (idx % n) + 1
+			instanceID := services.IVSSInstanceID(fmt.Sprintf("stress-ivss-%d", idx), dealerID)
 			t.Logf("Starting instance %s", instanceID)
-			registerInstanceListener(instanceID, n)
 
 			secret := big.NewInt(int64(1000 + idx))
-			dealerID := (idx % n) + 1
 
 			// Start Sharing
-			servicesList[dealerID].StartSharing(instanceID, secret, managers[dealerID])
+			c.Service(dealerID).StartSharing(instanceID, secret, c.Manager(dealerID))
 
-			if !waitForSharingWithDemuxTimeout(t, n, instanceID, 30*time.Second) {
-				t.Errorf("Sharing timed out for %s", instanceID)
+			if !waitForSharing(t, instances, allNodes(n), instanceID, 30*time.Second) {
 				return
 			}
 
 			// Start Reconstruction
 			for i := 1; i <= n; i++ {
-				servicesList[i].StartReconstruction(instanceID, managers[i])
+				c.Service(i).StartReconstruction(instanceID, c.Manager(i))
 			}
 
-			if !waitForReconstructionWithDemuxTimeout(t, n, instanceID, secret, 30*time.Second) {
-				t.Errorf("Reconstruction timed out for %s", instanceID)
+			if !waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 30*time.Second) {
 				return
 			}
 			t.Logf("Finished instance %s", instanceID)
@@ -195,124 +143,151 @@ func allNodes(n int) []int {
 	return res
 }
 
-func waitForSharing(t *testing.T, n int, results map[int]chan services.IVSSResult, instanceID string) {
-	waitForSharingSubset(t, allNodes(n), results, instanceID)
+// waitForSharing waits until nodes completed the sharing of instanceID.
+func waitForSharing(t *testing.T, instances *abatest.Demux[string, services.IVSSResult], nodes []int, instanceID string, timeout time.Duration) bool {
+	t.Helper()
+	if _, err := instances.Await(instanceID, nodes, timeout, abatest.SharingComplete); err != nil {
+		t.Errorf("Sharing of %s: %v", instanceID, err)
+		return false
+	}
+	return true
 }
 
-func waitForSharingSubset(t *testing.T, nodes []int, results map[int]chan services.IVSSResult, instanceID string) {
-	var wg sync.WaitGroup
-	wg.Add(len(nodes))
-
-	for _, id := range nodes {
-		go func(nodeID int) {
-			defer wg.Done()
-			timeout := time.After(5 * time.Second)
-			for {
-				select {
-				case res := <-results[nodeID]:
-					if res.InstanceID == instanceID && res.Type == "SHARING_COMPLETE" {
-						return
-					}
-				case <-timeout:
-					t.Errorf("Node %d timed out waiting for SHARING_COMPLETE for %s", nodeID, instanceID)
-					return
-				}
-			}
-		}(id)
+// waitForReconstruction waits until nodes reconstructed instanceID and
+// checks they all got secret.
+func waitForReconstruction(t *testing.T, instances *abatest.Demux[string, services.IVSSResult], nodes []int, instanceID string, secret *big.Int, timeout time.Duration) bool {
+	t.Helper()
+	results, err := instances.Await(instanceID, nodes, timeout, abatest.Reconstructed)
+	for id, res := range results {
+		if res.Secret.Cmp(secret) != 0 {
+			t.Errorf("Node %d reconstructed wrong secret for %s: %v", id, instanceID, res.Secret)
+		}
 	}
-	wg.Wait()
+	if err != nil {
+		t.Errorf("Reconstruction of %s: %v", instanceID, err)
+		return false
+	}
+	return true
 }
 
-func waitForReconstruction(t *testing.T, n int, results map[int]chan services.IVSSResult, instanceID string, secret *big.Int) {
-	waitForReconstructionSubset(t, allNodes(n), results, instanceID, secret)
-}
+func TestIVSS_DirectMessagesArePrivate(t *testing.T) {
+	n, f := 4, 1
+	network := services.NewNetwork[services.IVSSMessage]()
 
-func waitForReconstructionSubset(t *testing.T, nodes []int, results map[int]chan services.IVSSResult, instanceID string, secret *big.Int) {
-	var wg sync.WaitGroup
-	wg.Add(len(nodes))
+	// Node 1 deals, nodes 2 to 4 only record what reaches them
+	svc := services.NewIVSSServiceWithContext(services.NewNodeContext(1, n, f, zerolog.Disabled))
+	dealer := services.NewServiceManager[services.IVSSMessage, services.IVSSResult](svc, network)
+	network.Register(1, dealer.Inbox())
+	dealer.Start()
+	defer dealer.Stop()
+	peers := make(map[int]chan services.IVSSMessage)
+	for id := 2; id <= n; id++ {
+		peers[id] = make(chan services.IVSSMessage, 100)
+		network.Register(id, peers[id])
+	}
 
-	for _, id := range nodes {
-		go func(nodeID int) {
-			defer wg.Done()
-			timeout := time.After(5 * time.Second)
-			for {
-				select {
-				case res := <-results[nodeID]:
-					if res.InstanceID == instanceID && res.Type == "RECONSTRUCTED" {
-						if res.Secret.Cmp(secret) != 0 {
-							t.Errorf("Node %d reconstructed wrong secret", nodeID)
-						}
-						return
-					}
-				case <-timeout:
-					t.Errorf("Node %d timed out waiting for RECONSTRUCTED for %s", nodeID, instanceID)
-					return
-				}
+	if err := svc.StartSharing(services.IVSSInstanceID("private-1", 1), big.NewInt(7), dealer); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for id, ch := range peers {
+		shares := 0
+		for len(ch) > 0 {
+			msg := <-ch
+			if msg.Type != services.IVSS_Direct {
+				continue
+			}
+			if msg.To != id {
+				t.Errorf("Node %d received a %v meant for node %d", id, msg.DirectType, msg.To)
 			}
-		}(id)
+			if msg.DirectType == services.Direct_Share {
+				shares++
+			}
+		}
+		if shares != 1 {
+			t.Errorf("Node %d received %d shares, want its own only", id, shares)
+		}
 	}
-	wg.Wait()
 }
 
-func waitForSharingWithDemuxTimeout(t *testing.T, n int, instanceID string, timeoutDur time.Duration) bool {
-	instanceResultsMu.Lock()
-	chans := instanceResults[instanceID]
-	instanceResultsMu.Unlock()
-
-	var wg sync.WaitGroup
-	wg.Add(n)
-	success := true
-	var successMu sync.Mutex
-
+func TestIVSS_EncryptedShares(t *testing.T) {
+	n, f := 4, 1
+	keys, keyring, err := services.GenerateShareKeys(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, f),
+		abatest.WithNodeContext(func(nc *services.NodeContext) {
+			nc.ShareKey, nc.ShareKeys = keys[nc.ID], keyring
+		}))
+	instances := abatest.IVSSInstances(c)
+
+	secret := big.NewInt(42)
+	instanceID := services.IVSSInstanceID("sealed", 3)
+	if err := c.Service(3).StartSharing(instanceID, secret, c.Manager(3)); err != nil {
+		t.Fatal(err)
+	}
+	waitForSharing(t, instances, allNodes(n), instanceID, 5*time.Second)
 	for i := 1; i <= n; i++ {
-		go func(id int) {
-			defer wg.Done()
-			select {
-			case res := <-chans[id]:
-				if res.Type != "SHARING_COMPLETE" {
-					// Ignore other types if any
-				}
-			case <-time.After(timeoutDur):
-				successMu.Lock()
-				success = false
-				successMu.Unlock()
-			}
-		}(i)
+		c.Service(i).StartReconstruction(instanceID, c.Manager(i))
 	}
-	wg.Wait()
-	return success
+	waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 5*time.Second)
 }
 
-func waitForReconstructionWithDemuxTimeout(t *testing.T, n int, instanceID string, expectedSecret *big.Int, timeoutDur time.Duration) bool {
-	instanceResultsMu.Lock()
-	chans := instanceResults[instanceID]
-	instanceResultsMu.Unlock()
+func TestIVSS_EncryptedSharesRejectTampering(t *testing.T) {
+	n, f := 4, 1
+	keys, keyring, err := services.GenerateShareKeys(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newService := func(id int) (*services.IVSSService, *services.NodeContext) {
+		nc := services.NewNodeContext(id, n, f, zerolog.Disabled)
+		nc.ShareKey, nc.ShareKeys = keys[id], keyring
+		return services.NewIVSSServiceWithContext(nc), nc
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(n)
-	success := true
-	var successMu sync.Mutex
+	dealer, _ := newService(1)
+	sent := &recordingContext[services.IVSSMessage, services.IVSSResult]{}
+	id := services.IVSSInstanceID("sealed", 1)
+	if err := dealer.StartSharing(id, big.NewInt(7), sent); err != nil {
+		t.Fatal(err)
+	}
+	shares := make(map[int]services.IVSSMessage)
+	for _, msg := range sent.broadcasts {
+		if msg.Poly != nil || msg.Sealed == nil {
+			t.Fatalf("Share for node %d sent in the clear", msg.To)
+		}
+		shares[msg.To] = msg
+	}
 
-	for i := 1; i <= n; i++ {
-		go func(id int) {
-			defer wg.Done()
-			select {
-			case res := <-chans[id]:
-				if res.Type == "RECONSTRUCTED" {
-					if res.Secret.Cmp(expectedSecret) != 0 {
-						t.Errorf("Node %d reconstructed wrong secret", id)
-						successMu.Lock()
-						success = false
-						successMu.Unlock()
-					}
-				}
-			case <-time.After(timeoutDur):
-				successMu.Lock()
-				success = false
-				successMu.Unlock()
-			}
-		}(i)
+	deliver := func(msg services.IVSSMessage) (int, *services.NodeContext) {
+		svc, nc := newService(2)
+		ctx := &recordingContext[services.IVSSMessage, services.IVSSResult]{}
+		svc.OnMessage(msg, ctx)
+		return len(ctx.broadcasts), nc
+	}
+	if got, _ := deliver(shares[2]); got != n {
+		t.Errorf("Sent %d points for a sealed share, want %d", got, n)
+	}
+
+	tampered := shares[2]
+	tampered.Sealed = append([]byte(nil), tampered.Sealed...)
+	tampered.Sealed[len(tampered.Sealed)-1] ^= 1
+	redirected := shares[3]
+	redirected.To = 2
+	plain := shares[2]
+	plain.Sealed = nil
+	plain.Poly = &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(1), big.NewInt(2)}}
+	// Node 2 opens what reaches it as addressed to itself, whatever To says
+	misrouted := shares[3]
+	for name, msg := range map[string]services.IVSSMessage{"tampered": tampered, "redirected": redirected, "plaintext": plain, "misrouted": misrouted} {
+		got, nc := deliver(msg)
+		if got != 0 {
+			t.Errorf("Sent %d points for a %s share", got, name)
+		}
+		if nc.Metrics.Get("ivss.unsealable") != 1 {
+			t.Errorf("%s share not counted as unsealable", name)
+		}
 	}
-	wg.Wait()
-	return success
 }
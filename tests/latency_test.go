@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLatency_Distributions(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	if d := services.FixedLatency(5 * time.Millisecond).Sample(rng); d != 5*time.Millisecond {
+		t.Errorf("Fixed latency sampled %v, want 5ms", d)
+	}
+
+	uniform := services.UniformLatency{Min: 2 * time.Millisecond, Max: 4 * time.Millisecond}
+	for i := 0; i < 1000; i++ {
+		if d := uniform.Sample(rng); d < uniform.Min || d >= uniform.Max {
+			t.Fatalf("Uniform latency sampled %v, outside [%v, %v)", d, uniform.Min, uniform.Max)
+		}
+	}
+
+	logNormal := services.LogNormalLatency{Median: 10 * time.Millisecond, Sigma: 0.5}
+	samples := make([]time.Duration, 1001)
+	for i := range samples {
+		samples[i] = logNormal.Sample(rng)
+		if samples[i] <= 0 {
+			t.Fatalf("Log-normal latency sampled %v", samples[i])
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	if median := samples[len(samples)/2]; median < 9*time.Millisecond || median > 11*time.Millisecond {
+		t.Errorf("Log-normal latency has median %v, want about %v", median, logNormal.Median)
+	}
+}
+
+func TestLatency_PerLink(t *testing.T) {
+	slow := 200 * time.Millisecond
+	network := services.NewNetworkWithLatency[services.IVSSMessage](services.LatencyModel{
+		Default: services.FixedLatency(0),
+		Links:   map[services.Link]services.LatencyDistribution{{From: 1, To: 2}: services.FixedLatency(slow)},
+	})
+	network.SetSenderOf(services.IVSSSender)
+	inbox := make(chan services.IVSSMessage, 10)
+	network.Register(2, inbox)
+
+	start := time.Now()
+	network.Send(2, services.IVSSMessage{Type: services.IVSS_Direct, From: 1, InstanceID: "slow link"})
+	network.Send(2, services.IVSSMessage{Type: services.IVSS_Direct, From: 3, InstanceID: "fast link"})
+
+	for _, want := range []string{"fast link", "slow link"} {
+		select {
+		case msg := <-inbox:
+			if msg.InstanceID != want {
+				t.Fatalf("Received %q, want %q", msg.InstanceID, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %q", want)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < slow {
+		t.Errorf("Slow link delivered after %v, want at least %v", elapsed, slow)
+	}
+}
+
+func TestLatency_ABAClusterDecides(t *testing.T) {
+	n, f := 4, 1
+	network := services.NewNetworkWithLatency[services.ABAMessage](services.LatencyModel{
+		Default: services.LogNormalLatency{Median: time.Millisecond, Sigma: 1},
+		Links: map[services.Link]services.LatencyDistribution{
+			{From: 4, To: 0}: services.UniformLatency{Min: 5 * time.Millisecond, Max: 20 * time.Millisecond},
+		},
+		Seed: 1,
+	})
+	network.SetSenderOf(services.ABASender)
+
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i := range managers {
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(i+1, n, f, zerolog.Disabled), (i+1)%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+		network.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	for i := range managers {
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, n)
+	timeout := time.After(60 * time.Second)
+	for i, m := range managers {
+		select {
+		case decisions[i] = <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide under latency", i+1)
+		}
+	}
+	for i, d := range decisions {
+		if d != decisions[0] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+		}
+	}
+}
+
+func TestLatency_LoopbackSkipsDelay(t *testing.T) {
+	delay := 100 * time.Millisecond
+	network := services.NewNetworkWithLatency[string](services.LatencyModel{Default: services.FixedLatency(delay)})
+	network.SetSenderOf(stringSender)
+	own, peer := make(chan string, 10), make(chan string, 10)
+	network.Register(1, own)
+	network.Register(2, peer)
+
+	// The own copy is in the inbox before BroadcastFrom returns
+	start := time.Now()
+	network.BroadcastFrom(own, "1:fast")
+	if len(own) != 1 {
+		t.Fatal("Node 1 did not receive its own broadcast right away")
+	}
+	<-own
+	receiveWithin(t, peer, time.Second)
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Node 2 received the broadcast after %v, want at least %v", elapsed, delay)
+	}
+
+	// Loopback follows the inbox, not the sender a message claims
+	network.BroadcastFrom(own, "2:forged")
+	if len(own) != 1 || len(peer) != 0 {
+		t.Fatalf("Forged broadcast looped back to node 1 %d times, node 2 %d times, want 1 and 0", len(own), len(peer))
+	}
+	<-own
+	receiveWithin(t, peer, time.Second)
+
+	network.SetLoopback(false)
+	start = time.Now()
+	network.BroadcastFrom(own, "1:slow")
+	receiveWithin(t, own, time.Second)
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Without loopback node 1 received its broadcast after %v, want at least %v", elapsed, delay)
+	}
+}
+
+func TestLatency_LoopbackWithoutSenderOf(t *testing.T) {
+	delay := 100 * time.Millisecond
+	network := services.NewNetworkWithLatency[string](services.LatencyModel{Default: services.FixedLatency(delay)})
+	own := make(chan string, 10)
+	network.Register(1, own)
+
+	network.BroadcastFrom(own, "1:fast")
+	if len(own) != 1 {
+		t.Fatal("Node 1 did not receive its own broadcast right away")
+	}
+}
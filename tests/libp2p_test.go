@@ -0,0 +1,101 @@
+//go:build libp2p
+
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newLibP2P creates n nodes on loopback that join through node 1. The
+// caller registers their inboxes and then calls listen.
+func newLibP2P[TMsg any](t *testing.T, n int, codec services.Codec[TMsg]) []*services.LibP2PNetwork[TMsg] {
+	t.Helper()
+	networks := make([]*services.LibP2PNetwork[TMsg], n)
+	var bootstrap []string
+	for i := range networks {
+		cfg := services.LibP2PConfig{
+			ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"},
+			Bootstrap:   bootstrap,
+			Cluster:     t.Name(),
+		}
+		network, err := services.NewLibP2PNetwork(i+1, n, codec, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { network.Close() })
+		networks[i] = network
+		if i == 0 {
+			bootstrap = network.Addrs()
+		}
+	}
+	return networks
+}
+
+func listen[TMsg any](t *testing.T, networks []*services.LibP2PNetwork[TMsg]) {
+	t.Helper()
+	for _, network := range networks {
+		if err := network.Listen(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLibP2P_ABACluster(t *testing.T) {
+	n, f := 4, 1
+	networks := newLibP2P(t, n, services.ABACodec(services.Wire_Proto))
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i, network := range networks {
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(i+1, n, f, zerolog.Disabled), (i+1)%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+		network.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	listen(t, networks)
+	for i := range managers {
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, n)
+	timeout := time.After(60 * time.Second)
+	for i, m := range managers {
+		select {
+		case decisions[i] = <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide over libp2p", i+1)
+		}
+	}
+	for i, d := range decisions {
+		if d != decisions[0] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+		}
+	}
+}
+
+func TestLibP2P_SendIsPrivate(t *testing.T) {
+	n := 3
+	networks := newLibP2P(t, n, services.JSONCodec[string]{})
+	inboxes := make([]chan string, n)
+	for i, network := range networks {
+		inboxes[i] = make(chan string, 10)
+		network.Register(i+1, inboxes[i])
+	}
+	listen(t, networks)
+
+	// Nodes 2 and 3 only know node 1, node 3 is found through the DHT
+	networks[1].Send(3, "secret")
+	if got := receiveWithin(t, inboxes[2], 30*time.Second); got != "secret" {
+		t.Fatalf("Node 3 received %q, want secret", got)
+	}
+	networks[0].Broadcast("hello")
+	for i, inbox := range inboxes {
+		if got := receiveWithin(t, inbox, 30*time.Second); got != "hello" {
+			t.Errorf("Node %d received %q, want hello", i+1, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestMembership_UnregisterDropsWithoutCatchUp(t *testing.T) {
+	network := services.NewNetwork[string]()
+	inbox := make(chan string, 10)
+	network.Register(1, inbox)
+	network.Unregister(1)
+	network.Broadcast("while away")
+
+	network.Register(1, inbox)
+	network.Broadcast("back")
+	if got := receiveWithin(t, inbox, 5*time.Second); got != "back" {
+		t.Fatalf("Received %q, want only the message sent after registering", got)
+	}
+}
+
+func TestMembership_CatchUpAfterLeaving(t *testing.T) {
+	network := services.NewNetwork[string]()
+	network.SetCatchUp(100)
+	inboxes := []chan string{make(chan string, 10), make(chan string, 10)}
+	network.Register(1, inboxes[0])
+	network.Register(2, inboxes[1])
+
+	network.Broadcast("before")
+	receiveWithin(t, inboxes[0], 5*time.Second)
+	network.Unregister(1)
+	network.Broadcast("while away")
+	network.Send(1, "private")
+	network.Send(2, "for node 2")
+
+	rejoined := make(chan string, 10)
+	network.Register(1, rejoined)
+	for _, want := range []string{"while away", "private"} {
+		if got := receiveWithin(t, rejoined, 5*time.Second); got != want {
+			t.Fatalf("Received %q on rejoining, want %q", got, want)
+		}
+	}
+	select {
+	case got := <-rejoined:
+		t.Fatalf("Unexpected catch-up message %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMembership_LateJoinerDecides(t *testing.T) {
+	n, f := 4, 1
+	network := services.NewNetwork[services.ABAMessage]()
+	network.SetCatchUp(1 << 20)
+
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i := range managers {
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(i+1, n, f, zerolog.Disabled), (i+1)%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+		t.Cleanup(managers[i].Stop)
+	}
+	// Nodes 1 to 3 can decide on their own, node 4 joins once they did
+	for i := 0; i < n-1; i++ {
+		network.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, n)
+	timeout := time.After(60 * time.Second)
+	for i := 0; i < n-1; i++ {
+		select {
+		case decisions[i] = <-managers[i].Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide", i+1)
+		}
+	}
+	network.Register(n, managers[n-1].Inbox())
+	managers[n-1].Start()
+	abas[n-1].Start(managers[n-1])
+	select {
+	case decisions[n-1] = <-managers[n-1].Result():
+	case <-timeout:
+		t.Fatal("Late node did not decide after catching up")
+	}
+	for i, d := range decisions {
+		if d != decisions[0] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRateLimit_DropsFlooder(t *testing.T) {
+	network := services.NewNetwork[services.ACastMessage[string]]()
+	network.SetSenderOf(acastSender)
+	network.SetRateLimit(services.RateLimit{Rate: 1, Burst: 5})
+	inbox := make(chan services.ACastMessage[string], 200)
+	network.Register(1, inbox)
+	honest := make(chan services.ACastMessage[string], 1)
+	network.Register(2, honest)
+	flooder := make(chan services.ACastMessage[string], 1)
+	network.Register(4, flooder)
+
+	limited := 0
+	for i := 0; i < 100; i++ {
+		if err := network.TrySendFrom(flooder, 1, services.NewACastMessage("flood", 4)); errors.Is(err, services.ErrRateLimited) {
+			limited++
+		} else if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if err := network.TrySendFrom(honest, 1, services.NewACastMessage("honest", 2)); err != nil {
+			t.Errorf("Honest message %d rejected: %v", i, err)
+		}
+	}
+	if limited != 95 || network.RateLimited() != 95 {
+		t.Errorf("Limited %d messages, counted %d, want 95", limited, network.RateLimited())
+	}
+
+	got := make(map[string]int)
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < 10; i++ {
+		select {
+		case msg := <-inbox:
+			got[msg.Val]++
+		case <-timeout:
+			t.Fatalf("Timed out after %v", got)
+		}
+	}
+	if got["flood"] != 5 || got["honest"] != 5 {
+		t.Errorf("Received %v, want 5 of each", got)
+	}
+}
+
+func TestRateLimit_Refills(t *testing.T) {
+	network := services.NewNetwork[services.ACastMessage[string]]()
+	network.SetSenderOf(acastSender)
+	network.SetRateLimit(services.RateLimit{Rate: 100, Burst: 1})
+	network.Register(1, make(chan services.ACastMessage[string], 10))
+	sender := make(chan services.ACastMessage[string], 1)
+	network.Register(2, sender)
+
+	if err := network.TrySendFrom(sender, 1, services.NewACastMessage("first", 2)); err != nil {
+		t.Fatalf("First message rejected: %v", err)
+	}
+	if err := network.TrySendFrom(sender, 1, services.NewACastMessage("second", 2)); !errors.Is(err, services.ErrRateLimited) {
+		t.Fatalf("Got %v for the second message, want ErrRateLimited", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := network.TrySendFrom(sender, 1, services.NewACastMessage("third", 2)); err != nil {
+		t.Errorf("Message after refill rejected: %v", err)
+	}
+
+	network.SetRateLimit(services.RateLimit{})
+	for i := 0; i < 5; i++ {
+		if err := network.TrySendFrom(sender, 1, services.NewACastMessage("unlimited", 2)); err != nil {
+			t.Fatalf("Message rejected without a limit: %v", err)
+		}
+	}
+}
+
+func TestRateLimit_ACastDeliversDespiteFlooder(t *testing.T) {
+	n, f := 4, 1
+	network := services.NewNetwork[services.ACastMessage[string]]()
+	network.SetSenderOf(acastSender)
+	network.SetRateLimit(services.RateLimit{Rate: 100, Burst: 20})
+
+	managers := make([]*services.ServiceManager[services.ACastMessage[string], string], n-f)
+	for i := range managers {
+		acast := services.NewAcastServiceWithContext[string](services.NewNodeContext(i+1, n, f, zerolog.Disabled))
+		managers[i] = services.NewServiceManager[services.ACastMessage[string], string](acast, network)
+		network.Register(i+1, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+
+	// Node 4 floods echoes of values nobody sent before the honest broadcast
+	flooder := make(chan services.ACastMessage[string], 1)
+	network.Register(4, flooder)
+	for i := 0; i < 10000; i++ {
+		junk := services.NewACastMessage(fmt.Sprint("junk-", i), 4)
+		junk.Type = services.ECHO
+		network.BroadcastFrom(flooder, junk)
+	}
+	network.BroadcastFrom(managers[0].Inbox(), services.NewACastMessage("honest", 1))
+
+	timeout := time.After(10 * time.Second)
+	for i, m := range managers {
+		select {
+		case got := <-m.Result():
+			if got != "honest" {
+				t.Errorf("Node %d delivered %q", i+1, got)
+			}
+		case <-timeout:
+			t.Fatalf("Node %d did not deliver while node 4 flooded", i+1)
+		}
+	}
+	if limited := network.RateLimited(); limited < 9000 {
+		t.Errorf("Only %d flooded messages were limited", limited)
+	}
+}
+
+func TestRateLimit_ChargesSendingNode(t *testing.T) {
+	network := services.NewNetwork[services.ACastMessage[string]]()
+	network.SetSenderOf(acastSender)
+	network.SetRateLimit(services.RateLimit{Rate: 1, Burst: 2})
+	network.Register(1, make(chan services.ACastMessage[string], 10))
+	flooder := make(chan services.ACastMessage[string], 1)
+	network.Register(4, flooder)
+	honest := make(chan services.ACastMessage[string], 1)
+	network.Register(2, honest)
+
+	// Node 4 claims to be node 2, and to be nobody, to spend another limit
+	for _, from := range []int{2, 2, 0} {
+		err := network.TrySendFrom(flooder, 1, services.NewACastMessage("forged", from))
+		if from != 0 && err != nil {
+			t.Fatalf("Message within the burst rejected: %v", err)
+		}
+		if from == 0 && !errors.Is(err, services.ErrRateLimited) {
+			t.Fatalf("Got %v for a message over the limit of node 4, want ErrRateLimited", err)
+		}
+	}
+	if err := network.TrySendFrom(honest, 1, services.NewACastMessage("honest", 2)); err != nil {
+		t.Errorf("Node 2 was charged for the messages of node 4: %v", err)
+	}
+
+	// Messages from no registered inbox share one limit
+	unregistered := make(chan services.ACastMessage[string], 1)
+	network.TrySendFrom(unregistered, 1, services.NewACastMessage("anon", 3))
+	network.TrySend(1, services.NewACastMessage("anon", 3))
+	if err := network.TrySend(1, services.NewACastMessage("anon", 3)); !errors.Is(err, services.ErrRateLimited) {
+		t.Errorf("Got %v for an unregistered sender over the limit, want ErrRateLimited", err)
+	}
+}
+
+func TestTCP_RateLimitThrottlesConnection(t *testing.T) {
+	listeners, addrs := listenLocal(t, 2)
+	receiver := services.NewTCPNetwork(1, addrs, services.JSONCodec[string]{})
+	defer receiver.Close()
+	receiver.SetRateLimit(services.RateLimit{Rate: 50, Burst: 1})
+	inbox := make(chan string, 100)
+	receiver.Register(1, inbox)
+	receiver.Serve(listeners[0])
+
+	sender := services.NewTCPNetwork(2, addrs, services.JSONCodec[string]{})
+	defer sender.Close()
+	sender.Register(2, make(chan string, 100))
+	sender.Serve(listeners[1])
+
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		sender.Send(1, fmt.Sprint(i))
+	}
+	for i := 0; i < 11; i++ {
+		if got := receiveWithin(t, inbox, 5*time.Second); got != fmt.Sprint(i) {
+			t.Fatalf("Received %q as message %d", got, i)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("11 messages at 50 per second arrived within %v", elapsed)
+	}
+}
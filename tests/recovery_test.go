@@ -0,0 +1,239 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/abatest"
+	"async-agreement-protocol-3/services"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForWAL waits until wal holds at least n entries, i.e. the node is
+// somewhere in the middle of the protocol.
+func waitForWAL[TMsg any](t *testing.T, wal services.WAL[TMsg], n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, err := wal.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("WAL did not reach %d entries", n)
+}
+
+func TestRecovery_ABACrashMidProtocol(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 },
+		abatest.WithNodes(4, 1),
+		abatest.WithRecovery())
+	abatest.StartABA(c)
+
+	waitForWAL(t, c.WAL(2), 30)
+	if err := c.Crash(2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Restart(2); err != nil {
+		t.Fatal(err)
+	}
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+}
+
+func TestRecovery_ABARestartAfterDecision(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 },
+		abatest.WithNodes(4, 1),
+		abatest.WithRecovery())
+	abatest.StartABA(c)
+
+	before, err := c.Await([]int{3}, 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Crash(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Restart(3); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replay alone must lead to the decision again
+	after, err := c.Await([]int{3}, 10*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after[3] != before[3] {
+		t.Errorf("Node 3 decided %d before the crash and %d after the restart", before[3], after[3])
+	}
+}
+
+func TestRecovery_ICCRestartAfterCoin(t *testing.T) {
+	// A standalone ICC node that falls far behind may wait forever for
+	// reconstructions its finished peers never start, so the node crashes
+	// once it has its coin; ABA covers crashes in the middle of a coin.
+	c := abatest.NewICCCluster(t, 1, abatest.WithNodes(4, 1), abatest.WithRecovery())
+	abatest.StartICC(c)
+
+	before, err := c.Await(c.Honest(), 20*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Crash(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Restart(4); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := c.Await([]int{4}, 10*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after[4].Coin != before[4].Coin {
+		t.Errorf("Node 4 output coin %d before the crash and %d after the restart", before[4].Coin, after[4].Coin)
+	}
+}
+
+func TestRecovery_IVSSDealerCrash(t *testing.T) {
+	n := 4
+	c := abatest.NewIVSSCluster(t, abatest.WithNodes(n, 1), abatest.WithRecovery())
+	instances := abatest.IVSSInstances(c)
+	instanceID := services.IVSSInstanceID("ivss-recovery", 1)
+	secret := big.NewInt(4242)
+
+	// The dealer dies right after sending its shares. Its restarted process
+	// must deal the same polynomial again, or the shares would not match.
+	abatest.StartSharing(c, 1, instanceID, secret)
+	if err := c.Crash(1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Restart(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if !waitForSharing(t, instances, allNodes(n), instanceID, 10*time.Second) {
+		return
+	}
+	abatest.StartReconstruction(c, allNodes(n), instanceID)
+	waitForReconstruction(t, instances, allNodes(n), instanceID, secret, 10*time.Second)
+}
+
+func TestRecovery_CrashNeedsRecovery(t *testing.T) {
+	c := abatest.NewABACluster(t, func(int) int { return 1 }, abatest.WithNodes(4, 1))
+	if err := c.Crash(1); err == nil {
+		t.Error("Expected Crash to fail on a cluster without recovery")
+	}
+}
+
+func TestRecovery_FileWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	wal := services.NewFileWAL[services.ABAMessage](path, services.JSONCodec[services.ABAMessage]{})
+
+	msg := services.ABAMessage{Type: services.ABA_Complete, Round: 2}
+	for _, e := range []services.WALEntry[services.ABAMessage]{
+		{Call: "start"},
+		{Rand: []byte{1, 2, 3}},
+		{Msg: &msg},
+	} {
+		if err := wal.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A crash in the middle of an append leaves a partial line behind
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Call":"tru`)
+	f.Close()
+
+	entries, err := wal.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Call != "start" || string(entries[1].Rand) != "\x01\x02\x03" {
+		t.Errorf("Unexpected entries %+v", entries[:2])
+	}
+	if entries[2].Msg == nil || entries[2].Msg.Type != services.ABA_Complete || entries[2].Msg.Round != 2 {
+		t.Errorf("Message did not survive the round trip: %+v", entries[2].Msg)
+	}
+}
+
+func TestRecovery_FaultInjectorCrashRecovery(t *testing.T) {
+	faults := abatest.NewFaultInjector()
+	crash := faults.CrashAt(2, abatest.AtTransition(services.Layer_ABA, "FINISH_ROUND")).
+		RestartAfter(20 * time.Millisecond)
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 },
+		abatest.WithNodes(4, 1),
+		abatest.WithFaults(faults))
+	abatest.StartABA(c)
+
+	select {
+	case <-crash.Restarted():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Node 2 was not crashed and restarted: %v", faults.Err())
+	}
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+	if err := faults.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecovery_FaultInjectorCrashStop(t *testing.T) {
+	faults := abatest.NewFaultInjector()
+	crash := faults.CrashAt(4, abatest.AtTransition(services.Layer_ABA, "START_ROUND"))
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 },
+		abatest.WithNodes(4, 1),
+		abatest.WithFaults(faults))
+	abatest.StartABA(c)
+
+	// The remaining n-t nodes decide without node 4
+	decisions, err := c.Await([]int{1, 2, 3}, 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+	select {
+	case <-crash.Crashed():
+	default:
+		t.Fatalf("Node 4 did not crash: %v", faults.Err())
+	}
+	select {
+	case res := <-c.Results(4):
+		t.Errorf("Crashed node 4 decided %d", res)
+	case <-crash.Restarted():
+		t.Error("Crash-stop node 4 was restarted")
+	default:
+	}
+}
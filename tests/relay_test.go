@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// startRelay serves a relay for nodes 1..n on a free local port.
+func startRelay(t *testing.T, n int) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := services.NewRelay(n)
+	relay.Serve(l)
+	t.Cleanup(func() { relay.Close() })
+	return l.Addr().String()
+}
+
+// newRelayClient connects node id of 1..n to the relay at addr.
+func newRelayClient[TMsg any](t *testing.T, id, n int, addr string, codec services.Codec[TMsg]) *services.RelayClient[TMsg] {
+	t.Helper()
+	peers := make([]int, n)
+	for i := range peers {
+		peers[i] = i + 1
+	}
+	client := services.NewRelayClient(id, peers, addr, codec)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRelay_ABAClusterDecidesThroughRelay(t *testing.T) {
+	n, f := 4, 1
+	addr := startRelay(t, n)
+	keys, keyring, err := services.GenerateKeys(n, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i := range managers {
+		id := i + 1
+		client := newRelayClient(t, id, n, addr, services.CBORCodec[services.SignedEnvelope]{})
+		transport := services.NewAuthenticatedTransport(client, id, keys[id], keyring, services.ABACodec(services.Wire_Proto))
+		transport.SetSenderCheck(services.ABASender)
+		t.Cleanup(transport.Close)
+
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(id, n, f, zerolog.Disabled), id%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], transport)
+		transport.Register(id, managers[i].Inbox())
+		client.Listen()
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	for i := range managers {
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, n)
+	timeout := time.After(60 * time.Second)
+	for i, m := range managers {
+		select {
+		case decisions[i] = <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide through the relay", i+1)
+		}
+	}
+	for i, d := range decisions {
+		if d != decisions[0] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+		}
+	}
+}
+
+func TestRelay_QueuesUntilNodeConnects(t *testing.T) {
+	addr := startRelay(t, 2)
+	sender := newRelayClient(t, 1, 2, addr, services.JSONCodec[string]{})
+	sender.Register(1, make(chan string, 10))
+	sender.Listen()
+
+	sender.Send(2, "while away")
+	time.Sleep(100 * time.Millisecond)
+
+	receiver := newRelayClient(t, 2, 2, addr, services.JSONCodec[string]{})
+	inbox := make(chan string, 10)
+	receiver.Register(2, inbox)
+	receiver.Listen()
+	if got := receiveWithin(t, inbox, 5*time.Second); got != "while away" {
+		t.Fatalf("Received %q, want the message queued at the relay", got)
+	}
+
+	// A node reconnecting with a new connection, as after a NAT rebinding
+	receiver.Close()
+	sender.Send(2, "after reconnect")
+	receiver = newRelayClient(t, 2, 2, addr, services.JSONCodec[string]{})
+	inbox = make(chan string, 10)
+	receiver.Register(2, inbox)
+	receiver.Listen()
+	got := receiveWithin(t, inbox, 5*time.Second)
+	if got == "while away" {
+		// Its acknowledgement may have been lost with the old connection
+		got = receiveWithin(t, inbox, 5*time.Second)
+	}
+	if got != "after reconnect" {
+		t.Fatalf("Received %q, want the message sent while reconnecting", got)
+	}
+}
+
+func TestRelay_ForgedEnvelopesAreRejected(t *testing.T) {
+	n := 3
+	addr := startRelay(t, n)
+	keys, keyring, err := services.GenerateKeys(n, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := services.CBORCodec[services.SignedEnvelope]{}
+
+	client := newRelayClient(t, 1, n, addr, codec)
+	receiver := services.NewAuthenticatedTransport(client, 1, keys[1], keyring, services.JSONCodec[string]{})
+	t.Cleanup(receiver.Close)
+	inbox := make(chan string, 10)
+	receiver.Register(1, inbox)
+	client.Listen()
+
+	// Node 3 signs with its own key but claims to be node 2, and replays
+	// a genuine envelope of node 2 with an altered body
+	rogue := newRelayClient(t, 3, n, addr, codec)
+	rogue.Register(3, make(chan services.SignedEnvelope, 10))
+	rogue.Listen()
+	impostor := services.NewAuthenticatedTransport[string](nil, 2, keys[3], keyring, services.JSONCodec[string]{})
+	forged, _ := impostor.Seal("forged")
+	rogue.Send(1, forged)
+	node2 := services.NewAuthenticatedTransport[string](nil, 2, keys[2], keyring, services.JSONCodec[string]{})
+	genuine, _ := node2.Seal("genuine")
+	altered := genuine
+	altered.Body = []byte(`"altered"`)
+	rogue.Send(1, altered)
+	rogue.Send(1, genuine)
+
+	if got := receiveWithin(t, inbox, 5*time.Second); got != "genuine" {
+		t.Errorf("Received %q, want only the genuine envelope", got)
+	}
+}
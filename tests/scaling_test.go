@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+var scalingSizes = []int{4, 7, 13, 25, 50, 100}
+
+// scalingMaxSteps bounds each benchmark run; sizes above the first one that
+// exceeds it are skipped, as `aba bench` does.
+const scalingMaxSteps = 2000000
+
+func benchmarkScaling(b *testing.B, layer string) {
+	exhausted := 0
+	for _, n := range scalingSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			if exhausted != 0 {
+				b.Skipf("n=%d already exceeded %d messages", exhausted, scalingMaxSteps)
+			}
+			b.ReportAllocs()
+			messages := 0
+			for i := 0; i < b.N; i++ {
+				run, err := services.RunScaling(layer, n, int64(i+1), scalingMaxSteps)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !run.Complete {
+					exhausted = n
+					b.Skipf("Exceeded %d messages", scalingMaxSteps)
+				}
+				messages += run.Messages
+			}
+			b.ReportMetric(float64(messages)/float64(b.N), "msgs/op")
+		})
+	}
+}
+
+func BenchmarkScaling_ACast(b *testing.B) { benchmarkScaling(b, services.Layer_ACast) }
+func BenchmarkScaling_IVSS(b *testing.B)  { benchmarkScaling(b, services.Layer_IVSS) }
+func BenchmarkScaling_ABA(b *testing.B)   { benchmarkScaling(b, services.Layer_ABA) }
+
+// BenchmarkABA_Coins runs ABA for n=4 in the simulator with each coin
+// source, to tell the cost of ICC from that of the rest of ABA.
+func BenchmarkABA_Coins(b *testing.B) {
+	n, f := 4, 1
+	coins := []struct {
+		name string
+		coin func() services.CommonCoin
+	}{
+		{"icc", func() services.CommonCoin { return nil }},
+		{"dealer", func() services.CommonCoin { return services.NewDealerCoin([]byte("seed")) }},
+		{"local", func() services.CommonCoin { return services.NewLocalCoin(nil) }},
+	}
+	for _, source := range coins {
+		b.Run(source.name, func(b *testing.B) {
+			b.ReportAllocs()
+			messages := 0
+			for i := 0; i < b.N; i++ {
+				sim := services.NewSimulation[services.ABAMessage, int](int64(i + 1))
+				abas := make([]*services.ABAService, n)
+				for i := range abas {
+					nc := services.NewNodeContext(i+1, n, f, zerolog.Disabled)
+					nc.Coin = source.coin()
+					abas[i] = services.NewABAServiceWithContext(nc, (i+1)%2)
+					sim.AddNode(i+1, abas[i])
+				}
+				for i, aba := range abas {
+					aba.Start(sim.Context(i + 1))
+				}
+				decided := func() bool {
+					for id := 1; id <= n; id++ {
+						if len(sim.Results(id)) == 0 {
+							return false
+						}
+					}
+					return true
+				}
+				if !sim.Run(decided, scalingMaxSteps) {
+					b.Fatalf("Not all nodes decided after %d steps", sim.Steps())
+				}
+				messages += sim.Steps()
+			}
+			b.ReportMetric(float64(messages)/float64(b.N), "msgs/op")
+		})
+	}
+}
+
+// BenchmarkDealerShares computes the n shares a dealer sends for n=100,
+// t=33, sequentially and across worker pools. The speedup is bounded by
+// GOMAXPROCS.
+func BenchmarkDealerShares(b *testing.B) {
+	poly, err := utils.NewRandomSymmetricPolynomial(33, big.NewInt(1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				poly.Rows(100, workers)
+			}
+		})
+	}
+}
+
+func TestScaling_SmallClusters(t *testing.T) {
+	for _, layer := range []string{services.Layer_ACast, services.Layer_IVSS, services.Layer_ABA} {
+		run, err := services.RunScaling(layer, 4, 1, scalingMaxSteps)
+		if err != nil {
+			t.Fatalf("%s: %v", layer, err)
+		}
+		if !run.Complete || run.Messages == 0 || run.T != 1 {
+			t.Errorf("%s: unexpected run %+v", layer, run)
+		}
+	}
+
+	// One MSG, ECHO and READY per node at most, reaching every node
+	n := 13
+	run, err := services.RunScaling(services.Layer_ACast, n, 1, scalingMaxSteps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bound := n + 2*n*n; !run.Complete || run.Messages > bound {
+		t.Errorf("A-Cast of %d nodes took %d messages, at most %d expected", n, run.Messages, bound)
+	}
+
+	if _, err := services.RunScaling(services.Layer_Vote, 4, 1, 0); err == nil {
+		t.Error("Expected an error for a layer without scenario")
+	}
+}
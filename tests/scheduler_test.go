@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestScheduler_FIFOKeepsSendOrder(t *testing.T) {
+	network := services.NewNetwork[string]()
+	network.SetScheduler(services.NewFIFOScheduler[string]())
+	inbox := make(chan string, 500)
+	network.Register(1, inbox)
+
+	for i := 0; i < 500; i++ {
+		network.Send(1, fmt.Sprint(i))
+	}
+	for i := 0; i < 500; i++ {
+		if got := receiveWithin(t, inbox, 5*time.Second); got != fmt.Sprint(i) {
+			t.Fatalf("Received %s as message %d", got, i)
+		}
+	}
+}
+
+func TestScheduler_DelayCallback(t *testing.T) {
+	network := services.NewNetwork[string]()
+	var seen []services.Delivery[string]
+	network.SetScheduler(services.SchedulerFunc[string](func(d services.Delivery[string]) time.Duration {
+		seen = append(seen, d)
+		if d.Msg == "late" {
+			return 100 * time.Millisecond
+		}
+		return 0
+	}))
+	inboxes := []chan string{make(chan string, 10), make(chan string, 10)}
+	network.Register(1, inboxes[0])
+	network.Register(2, inboxes[1])
+
+	network.Send(1, "late")
+	network.Broadcast("early")
+	if got := receiveWithin(t, inboxes[0], 5*time.Second); got != "early" {
+		t.Errorf("Node 1 received %q first, want early", got)
+	}
+	if got := receiveWithin(t, inboxes[0], 5*time.Second); got != "late" {
+		t.Errorf("Node 1 received %q second, want late", got)
+	}
+	if got := receiveWithin(t, inboxes[1], 5*time.Second); got != "early" {
+		t.Errorf("Node 2 received %q, want early", got)
+	}
+	if len(seen) != 3 || seen[0].To != 1 || seen[0].Seq >= seen[1].Seq {
+		t.Errorf("Scheduler saw %+v, want 3 deliveries in send order", seen)
+	}
+}
+
+func TestScheduler_ABAClusterDecides(t *testing.T) {
+	n, f := 4, 1
+	for name, scheduler := range map[string]services.Scheduler[services.ABAMessage]{
+		"fifo":        services.NewFIFOScheduler[services.ABAMessage](),
+		"random":      services.NewRandomScheduler[services.ABAMessage](5*time.Millisecond, 1),
+		"adversarial": services.NewAdversarialScheduler[services.ABAMessage]([]int{4}, 20*time.Millisecond),
+	} {
+		t.Run(name, func(t *testing.T) {
+			network := services.NewNetwork[services.ABAMessage]()
+			network.SetScheduler(scheduler)
+			network.SetSenderOf(services.ABASender)
+
+			managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+			abas := make([]*services.ABAService, n)
+			for i := range managers {
+				abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(i+1, n, f, zerolog.Disabled), (i+1)%2)
+				managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+				network.Register(i+1, managers[i].Inbox())
+				managers[i].Start()
+				t.Cleanup(managers[i].Stop)
+			}
+			for i := range managers {
+				abas[i].Start(managers[i])
+			}
+
+			decisions := make([]int, n)
+			timeout := time.After(60 * time.Second)
+			for i, m := range managers {
+				select {
+				case decisions[i] = <-m.Result():
+				case <-timeout:
+					t.Fatalf("Node %d did not decide", i+1)
+				}
+			}
+			for i, d := range decisions {
+				if d != decisions[0] {
+					t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func newACastSimulation(seed int64, n, f int) *services.Simulation[services.ACastMessage[string], string] {
+	sim := services.NewSimulation[services.ACastMessage[string], string](seed)
+	setupACastSimulation(sim, n, f)
+	return sim
+}
+
+func setupACastSimulation(sim *services.Simulation[services.ACastMessage[string], string], n, f int) {
+	for id := 1; id <= n; id++ {
+		sim.AddNode(id, services.NewAcastService[string](id, n, f, zerolog.Disabled))
+	}
+	msg := services.ACastMessage[string]{Type: services.MSG, UUID: "sim-1", Val: "value", From: 1}
+	sim.Context(1).Broadcast(msg)
+}
+
+func TestSimulation_ACastDeterministic(t *testing.T) {
+	n, f := 4, 1
+	run := func(seed int64) (int, [][]string) {
+		sim := newACastSimulation(seed, n, f)
+		if !sim.Run(nil, 10000) {
+			t.Fatalf("Seed %d: cluster did not go quiescent", seed)
+		}
+		results := make([][]string, n)
+		for id := 1; id <= n; id++ {
+			results[id-1] = sim.Results(id)
+		}
+		return sim.Steps(), results
+	}
+
+	for seed := int64(1); seed <= 5; seed++ {
+		steps1, results1 := run(seed)
+		steps2, results2 := run(seed)
+		if steps1 != steps2 || !reflect.DeepEqual(results1, results2) {
+			t.Fatalf("Seed %d is not reproducible: %d/%v vs %d/%v", seed, steps1, results1, steps2, results2)
+		}
+		for id, res := range results1 {
+			if len(res) != 1 || res[0] != "value" {
+				t.Errorf("Seed %d: node %d delivered %v", seed, id+1, res)
+			}
+		}
+	}
+}
+
+func TestSimulation_ABAAgreement(t *testing.T) {
+	n, f := 4, 1
+	for seed := int64(1); seed <= 3; seed++ {
+		sim := services.NewSimulation[services.ABAMessage, int](seed)
+		abas := make([]*services.ABAService, n)
+		for i := range abas {
+			id := i + 1
+			abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(id, n, f, zerolog.Disabled), id%2)
+			sim.AddNode(id, abas[i])
+		}
+		for i, aba := range abas {
+			aba.Start(sim.Context(i + 1))
+		}
+
+		allDecided := func() bool {
+			for id := 1; id <= n; id++ {
+				if len(sim.Results(id)) == 0 {
+					return false
+				}
+			}
+			return true
+		}
+		if !sim.Run(allDecided, 2000000) {
+			t.Fatalf("Seed %d: not all nodes decided after %d steps", seed, sim.Steps())
+		}
+		decision := sim.Results(1)[0]
+		for id := 2; id <= n; id++ {
+			if d := sim.Results(id)[0]; d != decision {
+				t.Errorf("Seed %d: node %d decided %d, node 1 decided %d", seed, id, d, decision)
+			}
+		}
+	}
+}
+
+func TestSimulation_SimConfigReproducesABARun(t *testing.T) {
+	n, f := 4, 1
+	run := func(cfg services.SimConfig) (int, []services.StateTransition) {
+		rec := services.NewTransitionRecorder()
+		sim := services.NewSimulationWithConfig[services.ABAMessage, int](cfg)
+		abas := make([]*services.ABAService, n)
+		for i := range abas {
+			nc := cfg.NewNodeContext(i+1, n, f, zerolog.Disabled)
+			nc.Transitions = rec.Record
+			abas[i] = services.NewABAServiceWithContext(nc, (i+1)%2)
+			sim.AddNode(i+1, abas[i])
+		}
+		for i, aba := range abas {
+			aba.Start(sim.Context(i + 1))
+		}
+		allDecided := func() bool {
+			for id := 1; id <= n; id++ {
+				if len(sim.Results(id)) == 0 {
+					return false
+				}
+			}
+			return true
+		}
+		if !sim.Run(allDecided, 2000000) {
+			t.Fatalf("Seed %d: not all nodes decided after %d steps", cfg.Seed, sim.Steps())
+		}
+		return sim.Steps(), rec.Transitions()
+	}
+
+	cfg := services.SimConfig{Seed: 42}
+	steps1, trace1 := run(cfg)
+	steps2, trace2 := run(cfg)
+	if steps1 != steps2 || !reflect.DeepEqual(trace1, trace2) {
+		t.Fatalf("Seed %d is not reproducible: %d steps and %d transitions vs %d and %d", cfg.Seed, steps1, len(trace1), steps2, len(trace2))
+	}
+	if _, trace3 := run(services.SimConfig{Seed: 43}); reflect.DeepEqual(trace1, trace3) {
+		t.Error("Different seeds gave the same run")
+	}
+}
+
+func TestSimulation_SimConfigNodeRand(t *testing.T) {
+	draw := func(cfg services.SimConfig, id int) []byte {
+		b := make([]byte, 16)
+		if _, err := cfg.NodeRand(id).Read(b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	cfg := services.SimConfig{Seed: 1}
+	if !reflect.DeepEqual(draw(cfg, 1), draw(cfg, 1)) {
+		t.Error("Node randomness is not reproducible")
+	}
+	if reflect.DeepEqual(draw(cfg, 1), draw(cfg, 2)) {
+		t.Error("Nodes 1 and 2 draw the same randomness")
+	}
+	if reflect.DeepEqual(draw(cfg, 2), draw(services.SimConfig{Seed: 2}, 1)) {
+		t.Error("Seed and node ID are not mixed")
+	}
+}
+
+func TestSimulation_ExploreACastSchedules(t *testing.T) {
+	n, f := 4, 1
+	runs, trace, err := services.ExploreSchedules(3, 10000,
+		func(sim *services.Simulation[services.ACastMessage[string], string]) { setupACastSimulation(sim, n, f) },
+		nil,
+		func(sim *services.Simulation[services.ACastMessage[string], string]) error {
+			for id := 1; id <= n; id++ {
+				if res := sim.Results(id); len(res) != 1 || res[0] != "value" {
+					return fmt.Errorf("node %d delivered %v", id, res)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Schedule %v violated A-Cast: %v", trace, err)
+	}
+	// 4 MSG deliveries to choose from, then 3 MSGs plus 4 ECHOs, then at least 6
+	if runs < 4*7*6 {
+		t.Errorf("Explored only %d schedules", runs)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// listenLocal opens a listener on a free local port for each of nodes 1..n
+// and returns them with the peer table they make up.
+func listenLocal(t *testing.T, n int) ([]net.Listener, map[int]string) {
+	t.Helper()
+	listeners := make([]net.Listener, n)
+	addrs := make(map[int]string, n)
+	for i := range listeners {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = l
+		addrs[i+1] = l.Addr().String()
+	}
+	return listeners, addrs
+}
+
+func receiveWithin(t *testing.T, ch chan string, timeout time.Duration) string {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(timeout):
+		t.Fatal("Timed out waiting for a message")
+		return ""
+	}
+}
+
+func TestTCP_ABACluster(t *testing.T) {
+	n, f := 4, 1
+	listeners, addrs := listenLocal(t, n)
+
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i := 0; i < n; i++ {
+		id := i + 1
+		network := services.NewTCPNetwork(id, addrs, services.ABACodec(services.Wire_Proto))
+		t.Cleanup(func() { network.Close() })
+
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(id, n, f, zerolog.Disabled), id%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+		network.Register(id, managers[i].Inbox())
+		network.Serve(listeners[i])
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	for i := range managers {
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, n)
+	timeout := time.After(30 * time.Second)
+	for i, m := range managers {
+		select {
+		case decisions[i] = <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide over TCP", i+1)
+		}
+	}
+	for i, d := range decisions {
+		if d != decisions[0] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+		}
+	}
+}
+
+func TestTCP_QueuesUntilPeerIsBack(t *testing.T) {
+	listeners, addrs := listenLocal(t, 2)
+	// Node 2 is down at first
+	listeners[1].Close()
+
+	codec := services.JSONCodec[string]{}
+	sender := services.NewTCPNetwork(1, addrs, codec)
+	defer sender.Close()
+	sender.Serve(listeners[0])
+
+	sender.Send(2, "while down")
+	time.Sleep(100 * time.Millisecond)
+
+	startNode2 := func() (*services.TCPNetwork[string], chan string) {
+		inbox := make(chan string, 10)
+		network := services.NewTCPNetwork(2, addrs, codec)
+		network.Register(2, inbox)
+		if err := network.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		return network, inbox
+	}
+
+	node2, inbox := startNode2()
+	if got := receiveWithin(t, inbox, 5*time.Second); got != "while down" {
+		t.Fatalf("Received %q, want the message queued while node 2 was down", got)
+	}
+
+	// Node 2 restarts, the sender has to notice the broken connection
+	node2.Close()
+	sender.Send(2, "after restart")
+	time.Sleep(50 * time.Millisecond)
+	node2, inbox = startNode2()
+	defer node2.Close()
+	if got := receiveWithin(t, inbox, 5*time.Second); got != "after restart" {
+		t.Fatalf("Received %q, want the message sent across the restart", got)
+	}
+}
+
+func TestTCP_BroadcastReachesSelf(t *testing.T) {
+	listeners, addrs := listenLocal(t, 2)
+	networks := make([]*services.TCPNetwork[string], 2)
+	inboxes := make([]chan string, 2)
+	for i := range networks {
+		inboxes[i] = make(chan string, 10)
+		networks[i] = services.NewTCPNetwork(i+1, addrs, services.JSONCodec[string]{})
+		defer networks[i].Close()
+		networks[i].Register(i+1, inboxes[i])
+		networks[i].Serve(listeners[i])
+	}
+
+	networks[0].Broadcast("hello")
+	for i, inbox := range inboxes {
+		if got := receiveWithin(t, inbox, 5*time.Second); got != "hello" {
+			t.Errorf("Node %d received %q, want hello", i+1, got)
+		}
+	}
+}
+
+func TestTCP_RejectsOversizedFrames(t *testing.T) {
+	listeners, addrs := listenLocal(t, 1)
+	network := services.NewTCPNetwork(1, addrs, services.JSONCodec[string]{})
+	defer network.Close()
+	network.SetMaxFrameSize(64)
+	network.Register(1, make(chan string, 1))
+	network.Serve(listeners[0])
+
+	conn, err := net.Dial("tcp", addrs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], 1<<30)
+	conn.Write(header[:])
+
+	// The node hangs up instead of allocating the frame
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 4)); err == nil {
+		t.Error("Expected the connection to be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Error("Connection still open after an oversized frame")
+	}
+}
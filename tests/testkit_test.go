@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/abatest"
+	"async-agreement-protocol-3/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestkit_ABAWithLatency(t *testing.T) {
+	c := abatest.NewABACluster(t, func(id int) int { return id % 2 },
+		abatest.WithNodes(4, 1),
+		abatest.WithLatency(2*time.Millisecond))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 30*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != decisions[1] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+		}
+	}
+}
+
+func TestTestkit_ABAWithLatencyProfile(t *testing.T) {
+	c := abatest.NewABACluster(t, func(int) int { return 1 },
+		abatest.WithNodes(4, 1),
+		abatest.WithLatencyProfile(services.LatencyRegionalWAN, 1))
+	abatest.StartABA(c)
+
+	decisions, err := c.Await(c.Honest(), 60*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, d := range decisions {
+		if d != 1 {
+			t.Errorf("Node %d decided %d, want 1 (validity)", id, d)
+		}
+	}
+}
+
+func TestTestkit_AwaitReportsMissingNodes(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewACastCluster(t, abatest.WithNodes(n, f))
+
+	// Only two nodes see the MSG, which is too few for anyone to deliver
+	msg := services.NewACastMessage("value", 1)
+	for id := 1; id <= 2; id++ {
+		c.Manager(id).Inbox() <- msg
+	}
+	got, err := c.Await([]int{1, 2}, 200*time.Millisecond, nil)
+	if err == nil || !strings.Contains(err.Error(), "[1 2]") {
+		t.Fatalf("Expected nodes [1 2] to be reported missing, got %v (results %v)", err, got)
+	}
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// nodeCertificates creates a CA and a certificate for each of nodes 1..n,
+// with common name "node-<id>", and returns their providers.
+func nodeCertificates(t *testing.T, n int) []*services.StaticCertificates {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "aba-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	certs := make([]*services.StaticCertificates, n)
+	for i := range certs {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: fmt.Sprint("node-", i+1)},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs[i] = &services.StaticCertificates{
+			Cert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+			Pool: pool,
+		}
+	}
+	return certs
+}
+
+// stringSender reads the sender of "<id>:<text>" messages.
+func stringSender(msg string) (int, bool) {
+	id, _, ok := strings.Cut(msg, ":")
+	if !ok {
+		return 0, false
+	}
+	from, err := strconv.Atoi(id)
+	return from, err == nil
+}
+
+// startTLSNodes starts a string TCPNetwork with mutual TLS for each
+// certificate, node i+1 using certs[i].
+func startTLSNodes(t *testing.T, certs []*services.StaticCertificates) ([]*services.TCPNetwork[string], []chan string) {
+	t.Helper()
+	listeners, addrs := listenLocal(t, len(certs))
+	networks := make([]*services.TCPNetwork[string], len(certs))
+	inboxes := make([]chan string, len(certs))
+	for i := range networks {
+		inboxes[i] = make(chan string, 10)
+		networks[i] = services.NewTCPNetwork(i+1, addrs, services.JSONCodec[string]{})
+		t.Cleanup(func() { networks[i].Close() })
+		networks[i].SetMutualTLS(certs[i], services.IdentityFromCommonName("node-"))
+		networks[i].SetSenderOf(stringSender)
+		networks[i].Register(i+1, inboxes[i])
+		networks[i].Serve(listeners[i])
+	}
+	return networks, inboxes
+}
+
+func TestTCP_ABAClusterOverMutualTLS(t *testing.T) {
+	n, f := 4, 1
+	listeners, addrs := listenLocal(t, n)
+	certs := nodeCertificates(t, n)
+
+	managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+	abas := make([]*services.ABAService, n)
+	for i := 0; i < n; i++ {
+		id := i + 1
+		network := services.NewTCPNetwork(id, addrs, services.ABACodec(services.Wire_Proto))
+		network.SetMutualTLS(certs[i], services.IdentityFromCommonName("node-"))
+		network.SetSenderOf(services.ABASender)
+		t.Cleanup(func() { network.Close() })
+
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(id, n, f, zerolog.Disabled), id%2)
+		managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+		network.Register(id, managers[i].Inbox())
+		network.Serve(listeners[i])
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	for i := range managers {
+		abas[i].Start(managers[i])
+	}
+
+	decisions := make([]int, n)
+	timeout := time.After(30 * time.Second)
+	for i, m := range managers {
+		select {
+		case decisions[i] = <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide over mutual TLS", i+1)
+		}
+	}
+	for i, d := range decisions {
+		if d != decisions[0] {
+			t.Errorf("Node %d decided %d, node 1 decided %d", i+1, d, decisions[0])
+		}
+	}
+}
+
+func TestTCP_MutualTLSRejectsImpostor(t *testing.T) {
+	certs := nodeCertificates(t, 3)
+	// Node 2 listens with the certificate of node 3
+	networks, inboxes := startTLSNodes(t, []*services.StaticCertificates{certs[0], certs[2]})
+
+	networks[0].Send(2, "1:secret")
+	select {
+	case msg := <-inboxes[1]:
+		t.Fatalf("Impostor received %q", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// A stranger without a certificate of the CA cannot connect either
+	stranger := nodeCertificates(t, 1)[0]
+	networks, inboxes = startTLSNodes(t, []*services.StaticCertificates{certs[0], stranger})
+	networks[1].Send(1, "1:forged")
+	select {
+	case msg := <-inboxes[0]:
+		t.Fatalf("Node 1 accepted %q from a stranger", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestTCP_MutualTLSDropsSpoofedSender(t *testing.T) {
+	networks, inboxes := startTLSNodes(t, nodeCertificates(t, 3))
+
+	networks[1].Send(1, "3:spoofed")
+	networks[1].Send(1, "2:genuine")
+	if got := receiveWithin(t, inboxes[0], 5*time.Second); got != "2:genuine" {
+		t.Errorf("Received %q, want only the message of the authenticated peer", got)
+	}
+}
+
+func TestTLS_IdentityFromCommonName(t *testing.T) {
+	identity := services.IdentityFromCommonName("node-")
+	for cn, want := range map[string]int{"node-3": 3, "node-12": 12, "node-0": 0, "node-x": 0, "peer-3": 0, "3": 0} {
+		id, err := identity(&x509.Certificate{Subject: pkix.Name{CommonName: cn}})
+		if id != want || (err == nil) != (want != 0) {
+			t.Errorf("%q mapped to %d, %v; want %d", cn, id, err, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// topologyNodes registers a string inbox for each of nodes 1..n.
+func topologyNodes(network *services.Network[string], n int) []chan string {
+	network.SetSenderOf(stringSender)
+	inboxes := make([]chan string, n)
+	for i := range inboxes {
+		inboxes[i] = make(chan string, 10)
+		network.Register(i+1, inboxes[i])
+	}
+	return inboxes
+}
+
+func TestTopology_RingWithoutForwarding(t *testing.T) {
+	network := services.NewNetwork[string]()
+	network.SetTopology(services.RingTopology(6, 1))
+	inboxes := topologyNodes(network, 6)
+
+	network.Broadcast("1:hello")
+	for _, id := range []int{1, 2, 6} {
+		if got := receiveWithin(t, inboxes[id-1], time.Second); got != "1:hello" {
+			t.Errorf("Node %d received %q", id, got)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, id := range []int{3, 4, 5} {
+		select {
+		case msg := <-inboxes[id-1]:
+			t.Errorf("Node %d without a link to node 1 received %q", id, msg)
+		default:
+		}
+	}
+	if got := network.Unreachable(); got != 3 {
+		t.Errorf("Counted %d unreachable deliveries, want 3", got)
+	}
+}
+
+func TestTopology_ForwardingAddsHopLatency(t *testing.T) {
+	hop := 20 * time.Millisecond
+	network := services.NewNetworkWithLatency[string](services.LatencyModel{Default: services.FixedLatency(hop)})
+	topology := services.RingTopology(6, 1)
+	topology.Forward = true
+	network.SetTopology(topology)
+	inboxes := topologyNodes(network, 6)
+
+	start := time.Now()
+	network.Send(4, "1:far")
+	network.Send(2, "1:near")
+	if got := receiveWithin(t, inboxes[1], time.Second); got != "1:near" {
+		t.Fatalf("Node 2 received %q", got)
+	}
+	near := time.Since(start)
+	if got := receiveWithin(t, inboxes[3], time.Second); got != "1:far" {
+		t.Fatalf("Node 4 received %q", got)
+	}
+	// Node 4 is three hops away from node 1 on the ring
+	if far := time.Since(start); near >= 3*hop || far < 3*hop {
+		t.Errorf("One hop took %v and three hops %v, want about %v and %v", near, far, hop, 3*hop)
+	}
+	if got := network.Unreachable(); got != 0 {
+		t.Errorf("Counted %d unreachable deliveries with forwarding", got)
+	}
+}
+
+func TestTopology_ABA(t *testing.T) {
+	isolated := services.Topology{}
+	for a := 1; a <= 3; a++ {
+		for b := a + 1; b <= 3; b++ {
+			isolated.Connect(a, b)
+		}
+	}
+	forwardingRing := services.RingTopology(4, 1)
+	forwardingRing.Forward = true
+
+	for name, tc := range map[string]struct {
+		topology services.Topology
+		deciders []int
+	}{
+		// Every node is missing a link, but messages find a way around
+		"forwarding-ring": {forwardingRing, []int{1, 2, 3, 4}},
+		// A node cut off from everyone is no worse than a crashed one
+		"isolated-node": {isolated, []int{1, 2, 3}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			n, f := 4, 1
+			network := services.NewNetwork[services.ABAMessage]()
+			network.SetSenderOf(services.ABASender)
+			network.SetTopology(tc.topology)
+
+			managers := make([]*services.ServiceManager[services.ABAMessage, int], n)
+			abas := make([]*services.ABAService, n)
+			for i := range managers {
+				abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(i+1, n, f, zerolog.Disabled), (i+1)%2)
+				managers[i] = services.NewServiceManager[services.ABAMessage, int](abas[i], network)
+				network.Register(i+1, managers[i].Inbox())
+				managers[i].Start()
+				t.Cleanup(managers[i].Stop)
+			}
+			for i := range managers {
+				abas[i].Start(managers[i])
+			}
+
+			decisions := make(map[int]int)
+			timeout := time.After(30 * time.Second)
+			for _, id := range tc.deciders {
+				select {
+				case decisions[id] = <-managers[id-1].Result():
+				case <-timeout:
+					t.Fatalf("Node %d did not decide", id)
+				}
+			}
+			for id, d := range decisions {
+				if d != decisions[1] {
+					t.Errorf("Node %d decided %d, node 1 decided %d", id, d, decisions[1])
+				}
+			}
+		})
+	}
+}
+
+func TestTopology_Parse(t *testing.T) {
+	for spec, links := range map[string]int{"complete": 20, "ring:1": 10, "ring:2": 20, "random:0": 0, "random:1:7": 20} {
+		topology, err := services.ParseTopology(spec, 5)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+			continue
+		}
+		if len(topology.Links) != links {
+			t.Errorf("%s has %d links, want %d", spec, len(topology.Links), links)
+		}
+	}
+	for _, spec := range []string{"", "star", "ring", "ring:0", "random:2", "random:0.5:x"} {
+		if _, err := services.ParseTopology(spec, 5); err == nil {
+			t.Errorf("Parsed invalid topology %q", spec)
+		}
+	}
+	first, _ := services.ParseTopology("random:0.5:3", 8)
+	second, _ := services.ParseTopology("random:0.5:3", 8)
+	if fmt.Sprint(first.Links) != fmt.Sprint(second.Links) {
+		t.Error("The same seed gave different random topologies")
+	}
+}
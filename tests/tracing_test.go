@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestTracing_ABACausalGraph(t *testing.T) {
+	n, f := 4, 1
+	network := services.NewNetwork[services.TracedMessage[services.ABAMessage]]()
+	network.SetSenderOf(services.TracedSender(services.ABASender))
+	recorder := services.NewTraceRecorder()
+
+	managers := make([]*services.ServiceManager[services.TracedMessage[services.ABAMessage], int], n)
+	abas := make([]*services.ABAService, n)
+	nodes := make([]*services.TracingNode[services.ABAMessage, int], n)
+	for i := range managers {
+		id := i + 1
+		abas[i] = services.NewABAServiceWithContext(services.NewNodeContext(id, n, f, zerolog.Disabled), id%2)
+		nodes[i] = services.NewTracingNode[services.ABAMessage, int](id, abas[i], recorder, services.ClassifyABAMessage)
+		managers[i] = services.NewServiceManager[services.TracedMessage[services.ABAMessage], int](nodes[i], network)
+		network.Register(id, managers[i].Inbox())
+		managers[i].Start()
+		t.Cleanup(managers[i].Stop)
+	}
+	for i := range managers {
+		abas[i].Start(nodes[i].WrapContext(managers[i]))
+	}
+	timeout := time.After(30 * time.Second)
+	for i, m := range managers {
+		select {
+		case <-m.Result():
+		case <-timeout:
+			t.Fatalf("Node %d did not decide", i+1)
+		}
+	}
+
+	messages := recorder.Messages()
+	byID := make(map[string]services.TraceMessage, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+	roots := 0
+	for _, m := range messages {
+		if m.Parent == "" {
+			roots++
+			if m.Trace != m.ID {
+				t.Errorf("Root %s belongs to trace %s", m.ID, m.Trace)
+			}
+			continue
+		}
+		parent, ok := byID[m.Parent]
+		if !ok {
+			t.Fatalf("Message %s has unknown parent %s", m.ID, m.Parent)
+		}
+		if m.Trace != parent.Trace {
+			t.Errorf("Message %s is in trace %s, its parent in %s", m.ID, m.Trace, parent.Trace)
+		}
+		if !containsInt(parent.DeliveredTo, m.From) {
+			t.Errorf("Node %d sent %s before handling its parent %s", m.From, m.ID, m.Parent)
+		}
+	}
+	if roots == 0 || roots == len(messages) {
+		t.Errorf("Found %d roots among %d messages", roots, len(messages))
+	}
+	if len(recorder.Children(messages[0].ID)) == 0 {
+		t.Errorf("The first message %s caused nothing", messages[0].ID)
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var graph struct {
+		Messages []services.TraceMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &graph); err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Messages) < len(messages) {
+		t.Errorf("Exported %d of %d messages", len(graph.Messages), len(messages))
+	}
+}
+
+func containsInt(ids []int, id int) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
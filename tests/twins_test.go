@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// runTwinsACast runs an A-Cast cluster of 4 in which node 4 has a twin. Both
+// twins run honest code but start the same broadcast with different values,
+// so they echo whichever MSG reaches them first. It returns the simulation
+// and the certification state of the honest nodes 1 to 3.
+func runTwinsACast(t *testing.T, seed int64, dedup services.DedupPolicy) (*services.Simulation[services.ACastMessage[string], string], []*services.CertificationProtocol) {
+	n, f := 4, 1
+	newContext := func(id int) *services.NodeContext {
+		nc := services.NewNodeContext(id, n, f, zerolog.Disabled)
+		nc.Dedup = dedup
+		return nc
+	}
+
+	sim := services.NewSimulation[services.ACastMessage[string], string](seed)
+	cps := make([]*services.CertificationProtocol, 0, n-1)
+	for id := 1; id <= n; id++ {
+		nc := newContext(id)
+		if id < n {
+			cps = append(cps, nc.CP)
+		}
+		sim.AddNode(id, services.NewAcastServiceWithContext[string](nc))
+	}
+	sim.AddTwin(n, services.NewAcastServiceWithContext[string](newContext(n)))
+
+	uuid := "twins-1"
+	sim.Context(n).Broadcast(services.ACastMessage[string]{Type: services.MSG, UUID: uuid, Val: "left", From: n})
+	sim.TwinContext(n).Broadcast(services.ACastMessage[string]{Type: services.MSG, UUID: uuid, Val: "right", From: n})
+	if !sim.Run(nil, 100000) {
+		t.Fatalf("Seed %d: cluster did not go quiescent", seed)
+	}
+	return sim, cps
+}
+
+// checkTwinsAgreement checks the honest nodes delivered at most once and
+// never two different values.
+func checkTwinsAgreement(t *testing.T, seed int64, sim *services.Simulation[services.ACastMessage[string], string]) {
+	delivered := ""
+	for id := 1; id <= 3; id++ {
+		results := sim.Results(id)
+		if len(results) > 1 {
+			t.Errorf("Seed %d: node %d delivered %d times", seed, id, len(results))
+		}
+		for _, res := range results {
+			if delivered != "" && res != delivered {
+				t.Errorf("Seed %d: node %d delivered %q, another node delivered %q", seed, id, res, delivered)
+			}
+			delivered = res
+		}
+	}
+}
+
+func TestTwins_ACastTolerated(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		sim, cps := runTwinsACast(t, seed, services.Dedup_PerValue)
+		checkTwinsAgreement(t, seed, sim)
+		// Equivocation is reported under every policy, but only ever
+		// blames the twins
+		for i, cp := range cps {
+			for suspect := range cp.Suspects() {
+				if suspect != 4 {
+					t.Errorf("Seed %d: node %d suspects honest node %d", seed, i+1, suspect)
+				}
+			}
+		}
+	}
+}
+
+func TestTwins_ACastDetected(t *testing.T) {
+	detected := 0
+	for seed := int64(1); seed <= 20; seed++ {
+		sim, cps := runTwinsACast(t, seed, services.Dedup_FirstValue)
+		checkTwinsAgreement(t, seed, sim)
+		for i, cp := range cps {
+			for suspect := range cp.Suspects() {
+				if suspect != 4 {
+					t.Errorf("Seed %d: node %d suspects honest node %d", seed, i+1, suspect)
+				}
+			}
+			if cp.IsSuspect(4) {
+				detected++
+			}
+		}
+	}
+	// The twins only conflict when their MSGs arrive in different orders
+	if detected == 0 {
+		t.Error("No schedule exposed the twins")
+	}
+}
+
+func TestTwins_DedupOffCountsCopies(t *testing.T) {
+	n, f := 4, 1
+	for _, tc := range []struct {
+		dedup     services.DedupPolicy
+		delivered int
+	}{
+		{services.Dedup_PerValue, 0},
+		{services.Dedup_FirstValue, 0},
+		{services.Dedup_Off, 1},
+	} {
+		nc := services.NewNodeContext(1, n, f, zerolog.Disabled)
+		nc.Dedup = tc.dedup
+		sim := services.NewSimulation[services.ACastMessage[string], string](1)
+		sim.AddNode(1, services.NewAcastServiceWithContext[string](nc))
+
+		// 2t+1 copies of one READY, as a twin and a replaying network could
+		// produce them, must not count as a quorum
+		ready := services.ACastMessage[string]{Type: services.READY, UUID: "twins-2", Val: "value", From: 4}
+		for i := 0; i < 2*f+1; i++ {
+			sim.Context(4).Broadcast(ready)
+		}
+		sim.Run(nil, 1000)
+
+		if got := len(sim.Results(1)); got != tc.delivered {
+			t.Errorf("Policy %d: delivered %d times, expected %d", tc.dedup, got, tc.delivered)
+		}
+	}
+}
+
+func TestTwins_NetworkDeliversToBoth(t *testing.T) {
+	network := services.NewNetwork[int]()
+	first, twin, other := make(chan int, 1), make(chan int, 1), make(chan int, 1)
+	network.Register(1, other)
+	network.Register(2, first)
+	network.RegisterTwin(2, twin)
+
+	network.Broadcast(7)
+	for name, ch := range map[string]chan int{"node": first, "twin": twin, "other node": other} {
+		select {
+		case v := <-ch:
+			if v != 7 {
+				t.Errorf("The %s received %d", name, v)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("The %s received nothing", name)
+		}
+	}
+}
+
+func TestTwins_SendReachesBothTwins(t *testing.T) {
+	network := services.NewNetwork[string]()
+	inboxes := map[string]chan string{
+		"node 1": make(chan string, 1),
+		"node 2": make(chan string, 1),
+		"twin 2": make(chan string, 1),
+	}
+	network.Register(1, inboxes["node 1"])
+	network.Register(2, inboxes["node 2"])
+	network.RegisterTwin(2, inboxes["twin 2"])
+
+	network.Send(2, "private")
+	network.Send(3, "nobody") // Unregistered, dropped
+	time.Sleep(50 * time.Millisecond)
+
+	for name, ch := range inboxes {
+		want := 1
+		if name == "node 1" {
+			want = 0
+		}
+		if len(ch) != want {
+			t.Errorf("%s received %d messages, want %d", name, len(ch), want)
+		}
+	}
+}
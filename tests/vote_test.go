@@ -1,69 +1,35 @@
 package tests
 
 import (
+	"async-agreement-protocol-3/abatest"
 	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
 	"testing"
 	"time"
-
-	"github.com/rs/zerolog"
 )
 
-func setupVote(t *testing.T, n, f, round int) (*services.Network[services.VoteMessage], []*services.VoteService, []*services.ServiceManager[services.VoteMessage, services.VoteResult]) {
-	network := services.NewNetwork[services.VoteMessage]()
-	managers := make([]*services.ServiceManager[services.VoteMessage, services.VoteResult], n+1)
-	servicesList := make([]*services.VoteService, n+1)
-
-	// log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-
-	for i := 1; i <= n; i++ {
-		svc := services.NewVoteService(i, n, f, zerolog.Disabled)
-		servicesList[i] = svc
-		mgr := services.NewServiceManager[services.VoteMessage, services.VoteResult](svc, network)
-		managers[i] = mgr
-		network.Register(i, mgr.Inbox())
-		mgr.Start()
-	}
-	return network, servicesList, managers
-}
-
 func TestVote_Unanimous_1(t *testing.T) {
 	n := 4
 	f := 1
 	round := 1
-	_, servicesList, managers := setupVote(t, n, f, round)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
-		}
-	}()
-
-	results := make(chan services.VoteResult, n)
-
-	for i := 1; i <= n; i++ {
-		go func(m *services.ServiceManager[services.VoteMessage, services.VoteResult]) {
-			for res := range m.Result() {
-				results <- res
-			}
-		}(managers[i])
-	}
+	c := abatest.NewVoteCluster(t, abatest.WithNodes(n, f))
 
 	// Start with input 1
 	for i := 1; i <= n; i++ {
-		go servicesList[i].StartRound(round, 1, managers[i])
+		go c.Service(i).StartRound(round, 1, c.Manager(i))
 	}
 
 	// Wait for n results
-	for i := 0; i < n; i++ {
-		select {
-		case res := <-results:
-			if res.Value != 1 {
-				t.Errorf("Expected value 1, got %d", res.Value)
-			}
-			if res.Conf != 2 {
-				t.Errorf("Expected conf 2 (Strong), got %d", res.Conf)
-			}
-		case <-time.After(5 * time.Second):
-			t.Fatal("Timeout waiting for result")
+	results, err := c.Await(allNodes(n), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Value != 1 {
+			t.Errorf("Expected value 1, got %d", res.Value)
+		}
+		if res.Conf != 2 {
+			t.Errorf("Expected conf 2 (Strong), got %d", res.Conf)
 		}
 	}
 }
@@ -72,40 +38,24 @@ func TestVote_Unanimous_0(t *testing.T) {
 	n := 4
 	f := 1
 	round := 1
-	_, servicesList, managers := setupVote(t, n, f, round)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
-		}
-	}()
-
-	results := make(chan services.VoteResult, n)
-
-	for i := 1; i <= n; i++ {
-		go func(m *services.ServiceManager[services.VoteMessage, services.VoteResult]) {
-			for res := range m.Result() {
-				results <- res
-			}
-		}(managers[i])
-	}
+	c := abatest.NewVoteCluster(t, abatest.WithNodes(n, f))
 
 	// Start with input 0
 	for i := 1; i <= n; i++ {
-		go servicesList[i].StartRound(round, 0, managers[i])
+		go c.Service(i).StartRound(round, 0, c.Manager(i))
 	}
 
 	// Wait for n results
-	for i := 0; i < n; i++ {
-		select {
-		case res := <-results:
-			if res.Value != 0 {
-				t.Errorf("Expected value 0, got %d", res.Value)
-			}
-			if res.Conf != 2 {
-				t.Errorf("Expected conf 2 (Strong), got %d", res.Conf)
-			}
-		case <-time.After(5 * time.Second):
-			t.Fatal("Timeout waiting for result")
+	results, err := c.Await(allNodes(n), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Value != 0 {
+			t.Errorf("Expected value 0, got %d", res.Value)
+		}
+		if res.Conf != 2 {
+			t.Errorf("Expected conf 2 (Strong), got %d", res.Conf)
 		}
 	}
 }
@@ -114,43 +64,231 @@ func TestVote_Split_3vs1(t *testing.T) {
 	n := 4
 	f := 1
 	round := 1
-	_, servicesList, managers := setupVote(t, n, f, round)
-	defer func() {
-		for i := 1; i <= n; i++ {
-			managers[i].Stop()
+	c := abatest.NewVoteCluster(t, abatest.WithNodes(n, f))
+
+	// 3 nodes vote 1, 1 node votes 0
+	// Majority should be 1
+	for i := 1; i <= 3; i++ {
+		go c.Service(i).StartRound(round, 1, c.Manager(i))
+	}
+	go c.Service(4).StartRound(round, 0, c.Manager(4))
+
+	// Wait for n results
+	results, err := c.Await(allNodes(n), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Value != 1 {
+			t.Errorf("Expected value 1, got %d", res.Value)
 		}
-	}()
+		// Should still be strong majority because everyone will eventually see the majority
+		if res.Conf != 2 {
+			t.Errorf("Expected conf 2 (Strong), got %d", res.Conf)
+		}
+	}
+}
 
-	results := make(chan services.VoteResult, n)
+func TestVoteMV_Unanimous(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewVoteMVCluster[string](t, abatest.WithNodes(n, f))
 
 	for i := 1; i <= n; i++ {
-		go func(m *services.ServiceManager[services.VoteMessage, services.VoteResult]) {
-			for res := range m.Result() {
-				results <- res
-			}
-		}(managers[i])
+		go c.Service(i).StartRound(1, "proposal-7", c.Manager(i))
 	}
 
-	// 3 nodes vote 1, 1 node votes 0
-	// Majority should be 1
-	for i := 1; i <= 3; i++ {
-		go servicesList[i].StartRound(round, 1, managers[i])
+	results, err := c.Await(allNodes(n), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res.Value != "proposal-7" || res.Conf != 2 {
+			t.Errorf("Node %d output (%q, conf %d), want (proposal-7, conf 2)", id, res.Value, res.Conf)
+		}
 	}
-	go servicesList[4].StartRound(round, 0, managers[4])
+}
 
-	// Wait for n results
-	for i := 0; i < n; i++ {
-		select {
-		case res := <-results:
-			if res.Value != 1 {
-				t.Errorf("Expected value 1, got %d", res.Value)
+func TestVoteMV_Plurality(t *testing.T) {
+	type proposal struct {
+		Leader int
+		Digest string
+	}
+	n, f := 7, 2
+	inputs := map[int]proposal{
+		1: {1, "aa"}, 2: {1, "aa"}, 3: {1, "aa"}, 4: {1, "aa"}, 5: {1, "aa"},
+		6: {2, "bb"}, 7: {3, "cc"},
+	}
+	c := abatest.NewVoteMVCluster[proposal](t, abatest.WithNodes(n, f))
+
+	for i := 1; i <= n; i++ {
+		go c.Service(i).StartRound(1, inputs[i], c.Manager(i))
+	}
+
+	results, err := c.Await(allNodes(n), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Any n-t = 5 inputs hold at least 3 of the 5 equal proposals, a
+	// majority, so every node votes and revotes for it
+	for id, res := range results {
+		if res.Value != inputs[1] || res.Conf != 2 {
+			t.Errorf("Node %d output (%v, conf %d), want (%v, conf 2)", id, res.Value, res.Conf, inputs[1])
+		}
+	}
+}
+
+func TestVoteMV_Split(t *testing.T) {
+	n, f := 4, 1
+	inputs := []string{"", "a", "b", "c", "d"}
+	c := abatest.NewVoteMVCluster[string](t, abatest.WithNodes(n, f))
+
+	for i := 1; i <= n; i++ {
+		go c.Service(i).StartRound(1, inputs[i], c.Manager(i))
+	}
+
+	results, err := c.Await(allNodes(n), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The grades must agree: nodes with conf 2 force conf 1 or 2 on the same
+	// value at all others, and nodes with conf 1 agree on their value
+	var graded []services.VoteResultMV[string]
+	strong := false
+	for _, res := range results {
+		if res.Conf > 0 {
+			graded = append(graded, res)
+		} else if res.Value != "" {
+			t.Errorf("Null output with value %q", res.Value)
+		}
+		strong = strong || res.Conf == 2
+	}
+	for _, res := range graded {
+		if res.Value != graded[0].Value {
+			t.Errorf("Nodes output %q and %q", graded[0].Value, res.Value)
+		}
+	}
+	if strong && len(graded) != n {
+		t.Errorf("A node output conf 2 but only %d of %d output a value", len(graded), n)
+	}
+}
+
+func TestVote_BindsPayloadsToSender(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewVoteCluster(t, abatest.WithNodes(n, f))
+	// Node 4 tries to change the input of node 1
+	chaos := services.NewChaos(services.ClassifyVoteMessage)
+	forged := chaos.Rewrite(services.MessageFilter{Layer: services.Layer_Vote, Type: "MSG", Sender: 4}, func(msg services.VoteMessage) services.VoteMessage {
+		p, err := services.ParseVotePayload(msg.ACastMsg.Val)
+		if err != nil || p.Type != services.Vote_Input {
+			return msg
+		}
+		p.Sender, p.Bit = 1, 0
+		acast := *msg.ACastMsg
+		acast.Val = p.String()
+		msg.ACastMsg = &acast
+		return msg
+	})
+	c.Network.SetChaos(chaos)
+
+	for i := 1; i <= n; i++ {
+		go c.Service(i).StartRound(1, 1, c.Manager(i))
+	}
+	honest := []int{1, 2, 3}
+	results, err := c.Await(honest, 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res.Value != 1 || res.Conf != 2 {
+			t.Errorf("Node %d output (%d, conf %d), want (1, conf 2)", id, res.Value, res.Conf)
+		}
+	}
+	if forged.Hits() == 0 {
+		t.Fatal("No INPUT of node 4 was rewritten")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, id := range honest {
+		for c.NodeContext(id).Metrics.Get("vote.foreign_payloads") == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %d did not reject the forged INPUT", id)
 			}
-			// Should still be strong majority because everyone will eventually see the majority
-			if res.Conf != 2 {
-				t.Errorf("Expected conf 2 (Strong), got %d", res.Conf)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestVote_IgnoresDuplicatePayloads(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewVoteCluster(t, abatest.WithNodes(n, f))
+
+	// Node 4 A-Casts two INPUTs for the round before the others start it,
+	// so no node finishes before it delivered both
+	c.Service(4).StartRound(1, 1, c.Manager(4))
+	c.Service(4).StartRound(1, 0, c.Manager(4))
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 1; id <= n; id++ {
+		for c.NodeContext(id).Metrics.Get("vote.duplicate_payloads") == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %d did not ignore the second INPUT of node 4", id)
 			}
-		case <-time.After(5 * time.Second):
-			t.Fatal("Timeout waiting for result")
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		go c.Service(i).StartRound(1, 1, c.Manager(i))
+	}
+	results, err := c.Await(allNodes(n), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res.Value != 1 || res.Conf != 2 {
+			t.Errorf("Node %d output (%d, conf %d), want (1, conf 2)", id, res.Value, res.Conf)
+		}
+	}
+}
+
+func TestVote_RecordsPayloadsOfCertifiedFaulty(t *testing.T) {
+	n, f := 4, 1
+	c := abatest.NewVoteCluster(t, abatest.WithNodes(n, f))
+	// Only node 1 certified node 4. Nodes 2 and 3 start without node 1, so
+	// both take the INPUT of node 4 into their A sets, which node 1 must
+	// still accept.
+	c.NodeContext(1).CP.AddFaultyPair(1, 4)
+	for _, i := range []int{2, 3, 4} {
+		go c.Service(i).StartRound(1, 1, c.Manager(i))
+	}
+	time.Sleep(200 * time.Millisecond)
+	go c.Service(1).StartRound(1, 1, c.Manager(1))
+
+	results, err := c.Await([]int{1, 2, 3}, 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range results {
+		if res.Value != 1 || res.Conf != 2 {
+			t.Errorf("Node %d output (%d, conf %d), want (1, conf 2)", id, res.Value, res.Conf)
+		}
+	}
+}
+
+func TestVotePayload_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		payload services.VotePayload
+		ok      bool
+	}{
+		{services.VotePayload{Type: services.Vote_Input, Sender: 1, Bit: 1, Round: 1}, true},
+		{services.VotePayload{Type: services.Vote_Vote1, Sender: 2, Bit: 0, Set: utils.NodeSet{1, 2, 3}, Round: 1}, true},
+		{services.VotePayload{Type: services.Vote_Input, Sender: 1, Bit: 2, Round: 1}, false},
+		{services.VotePayload{Type: services.Vote_Input, Sender: 0, Bit: 1, Round: 1}, false},
+		{services.VotePayload{Type: services.Vote_Vote1, Sender: 2, Bit: 0, Set: utils.NodeSet{1, 5}, Round: 1}, false},
+		{services.VotePayload{Type: services.Vote_Revote, Sender: 2, Bit: 0, Set: utils.NodeSet{0, 1}, Round: 1}, false},
+		{services.VotePayload{Type: services.Vote_Revote, Sender: 2, Bit: 0, Set: utils.NodeSet{1, 1}, Round: 1}, false},
+		{services.VotePayload{Type: services.Vote_Input, Sender: 1, Bit: 1, Round: -1}, false},
+	} {
+		if err := tc.payload.Validate(4); (err == nil) != tc.ok {
+			t.Errorf("Validate(%s) = %v", tc.payload, err)
 		}
 	}
 }
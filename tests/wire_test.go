@@ -0,0 +1,430 @@
+package tests
+
+import (
+	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+var wireFormats = []services.WireFormat{services.Wire_JSON, services.Wire_Proto, services.Wire_CBOR}
+
+func roundTripWire(t *testing.T, msg services.ABAMessage) {
+	t.Helper()
+	for _, format := range wireFormats {
+		data, err := services.EncodeABAMessage(format, msg)
+		if err != nil {
+			t.Fatalf("[%s] Encode failed: %v", format, err)
+		}
+		got, err := services.DecodeABAMessage(format, data)
+		if err != nil {
+			t.Fatalf("[%s] Decode failed: %v", format, err)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Fatalf("[%s] Round trip mismatch:\n got  %+v\n want %+v", format, got, msg)
+		}
+	}
+}
+
+func TestWire_RoundTrip_Vote(t *testing.T) {
+	payload := services.VotePayload{Type: services.Vote_Vote1, Sender: 2, Bit: 1, Set: []int{0, 2, 3}, Round: 4}
+	acast := services.NewACastMessage(payload.String(), 2)
+	roundTripWire(t, services.ABAMessage{
+		Type:    services.ABA_Vote,
+		Round:   4,
+		VoteMsg: &services.VoteMessage{Type: services.Vote_ACast, ACastMsg: &acast},
+	})
+}
+
+func TestWire_RoundTrip_ICC(t *testing.T) {
+	payload := services.ICCPayload{Type: services.ICC_FinalSets, SetH: []int{1, 2, 3}, SetS: []int{0, 1, 2}, Sender: 1}
+	acast := services.NewACastMessage(payload.String(), 1)
+	acast.Type = services.ECHO
+	roundTripWire(t, services.ABAMessage{
+		Type:   services.ABA_ICC,
+		Round:  1,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_ACast, ACastMsg: &acast},
+	})
+}
+
+func TestWire_RoundTrip_IVSS(t *testing.T) {
+	poly := &utils.Polynomial{Coeffs: []*big.Int{big.NewInt(7), new(big.Int).Sub(utils.Prime, big.NewInt(1)), big.NewInt(0)}}
+
+	share := services.ABAMessage{
+		Type:  services.ABA_ICC,
+		Round: 2,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:       services.IVSS_Direct,
+			DirectType: services.Direct_Share,
+			To:         3,
+			From:       0,
+			InstanceID: "ICC-2-0-1",
+			Poly:       poly,
+		}},
+	}
+	roundTripWire(t, share)
+
+	point := services.ABAMessage{
+		Type: services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:       services.IVSS_Direct,
+			DirectType: services.Direct_Point,
+			To:         1,
+			From:       2,
+			InstanceID: "ICC-2-0-1",
+			Point:      big.NewInt(0),
+			PointIdx:   1,
+		}},
+	}
+	roundTripWire(t, point)
+
+	batchShare := *share.ICCMsg.IVSSMsg
+	batchShare.DirectType, batchShare.Poly, batchShare.Polys = services.Direct_BatchShare, nil, []*utils.Polynomial{poly, poly}
+	batchPoint := *point.ICCMsg.IVSSMsg
+	batchPoint.DirectType, batchPoint.Point, batchPoint.Points = services.Direct_BatchPoint, nil, []*big.Int{big.NewInt(0), big.NewInt(9)}
+	dualShare := batchShare
+	dualShare.DirectType = services.Direct_DualShare
+	dualPoint := batchPoint
+	dualPoint.DirectType = services.Direct_DualPoint
+	request := *point.ICCMsg.IVSSMsg
+	request.DirectType, request.Point, request.PointIdx = services.Direct_ShareRequest, nil, 0
+	response := *point.ICCMsg.IVSSMsg
+	response.DirectType = services.Direct_ShareResponse
+	private := *share.ICCMsg.IVSSMsg
+	private.DirectType = services.Direct_PrivateReveal
+	signed := *point.ICCMsg.IVSSMsg
+	signed.Signature = bytes.Repeat([]byte{0xab}, 64)
+	for _, msg := range []services.IVSSMessage{batchShare, batchPoint, dualShare, dualPoint, request, response, private, signed} {
+		roundTripWire(t, services.ABAMessage{
+			Type:   services.ABA_ICC,
+			ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &msg},
+		})
+	}
+	mset := services.IVSSPayload{InstanceID: "ICC-2-0@0", Type: services.Payload_MSet, MSet: []int{1, 2, 3}, Secrets: 4}
+	msetMsg := services.NewACastMessage(mset.String(), 0)
+	roundTripWire(t, services.ABAMessage{
+		Type: services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:     services.IVSS_ACast,
+			ACastMsg: &msetMsg,
+		}},
+	})
+
+	sealed := *point.ICCMsg.IVSSMsg
+	sealed.Point, sealed.Sealed = nil, []byte{1, 2, 3, 0}
+	roundTripWire(t, services.ABAMessage{
+		Type:   services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &sealed},
+	})
+
+	sp, err := utils.NewRandomSymmetricPolynomial(1, big.NewInt(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := services.IVSSPayload{InstanceID: "ICC-2-0-1", Type: services.Payload_Commit, Commitment: utils.Commit(sp).Values}
+	commitMsg := services.NewACastMessage(commit.String(), 0)
+	roundTripWire(t, services.ABAMessage{
+		Type: services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:     services.IVSS_ACast,
+			ACastMsg: &commitMsg,
+		}},
+	})
+
+	blame := services.IVSSPayload{InstanceID: "ICC-2-0@1", Type: services.Payload_Blame, Blame: &services.IVSSBlame{
+		Kind:           services.Blame_InconsistentPoint,
+		InstanceID:     "ICC-2-0@1",
+		Dealer:         1,
+		Accuser:        3,
+		Share:          poly,
+		ShareSignature: []byte{1, 2},
+		Point:          big.NewInt(0),
+		PointFrom:      2,
+		PointSignature: []byte{3, 4},
+	}}
+	blameMsg := services.NewACastMessage(blame.String(), 3)
+	roundTripWire(t, services.ABAMessage{
+		Type: services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:     services.IVSS_ACast,
+			ACastMsg: &blameMsg,
+		}},
+	})
+
+	reveal := services.IVSSPayload{InstanceID: "ICC-2-0-1", Type: services.Payload_Reveal, RevealPoly: poly, RevealSender: 2}
+	acast := services.NewACastMessage(reveal.String(), 2)
+	acast.Type = services.READY
+	roundTripWire(t, services.ABAMessage{
+		Type: services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:     services.IVSS_ACast,
+			ACastMsg: &acast,
+		}},
+	})
+}
+
+func TestWire_RoundTrip_CompleteAndRaw(t *testing.T) {
+	complete := services.NewACastMessage(services.CompletePayload{Sender: 3, Value: 1}.String(), 3)
+	roundTripWire(t, services.ABAMessage{Type: services.ABA_Complete, Round: 5, CompleteMsg: &complete})
+
+	// Values that are not canonical payloads must still arrive byte-for-byte
+	raw := services.NewACastMessage(`{"Value":1, "Sender":3}`, 3)
+	roundTripWire(t, services.ABAMessage{Type: services.ABA_Complete, CompleteMsg: &raw})
+}
+
+func TestWire_RoundTrip_ACastDigest(t *testing.T) {
+	payload := services.CompletePayload{Sender: 3, Value: 1}.String()
+	echo := services.ACastMessage[string]{Type: services.ECHO, UUID: "u", From: 2, Digest: services.ACastDigest(payload)}
+	roundTripWire(t, services.ABAMessage{Type: services.ABA_Complete, CompleteMsg: &echo})
+
+	value := services.ACastMessage[string]{Type: services.VALUE, UUID: "u", Val: payload, From: 2, Digest: echo.Digest}
+	roundTripWire(t, services.ABAMessage{Type: services.ABA_Complete, CompleteMsg: &value})
+}
+
+func TestWire_RoundTrip_ACastTag(t *testing.T) {
+	msg := services.NewTaggedACastMessage(services.CompletePayload{Sender: 3, Value: 1}.String(), 3, "tag")
+	roundTripWire(t, services.ABAMessage{Type: services.ABA_Complete, CompleteMsg: &msg})
+}
+
+func TestWire_RoundTrip_ACastCertificate(t *testing.T) {
+	payload := services.CompletePayload{Sender: 3, Value: 1}.String()
+	echo := services.ACastMessage[string]{Type: services.SIGNED_ECHO, UUID: "u", From: 2, Digest: services.ACastDigest(payload), Sig: []byte{1, 2, 3}}
+	roundTripWire(t, services.ABAMessage{Type: services.ABA_Complete, CompleteMsg: &echo})
+
+	cert := services.ACastMessage[string]{Type: services.CERT, UUID: "u", Val: payload, From: 2, Digest: echo.Digest,
+		Cert: services.ACastCertificate{1: {4}, 2: {5, 6}, 3: {7}}}
+	roundTripWire(t, services.ABAMessage{Type: services.ABA_Complete, CompleteMsg: &cert})
+}
+
+func TestWire_RoundTrip_EmptySets(t *testing.T) {
+	// Empty and nil sets render differently in JSON, binary formats must keep them apart
+	for _, set := range [][]int{nil, {}} {
+		payload := services.VotePayload{Type: services.Vote_Input, Sender: 1, Bit: 0, Set: set, Round: 1}
+		acast := services.NewACastMessage(payload.String(), 1)
+		roundTripWire(t, services.ABAMessage{
+			Type:    services.ABA_Vote,
+			Round:   1,
+			VoteMsg: &services.VoteMessage{Type: services.Vote_ACast, ACastMsg: &acast},
+		})
+	}
+}
+
+func TestWire_SmallerThanJSON(t *testing.T) {
+	coeffs := make([]*big.Int, 4)
+	for k := range coeffs {
+		coeffs[k] = new(big.Int).Sub(utils.Prime, big.NewInt(int64(k+1)))
+	}
+	reveal := services.IVSSPayload{InstanceID: "ICC-1-0-1", Type: services.Payload_Reveal, RevealPoly: &utils.Polynomial{Coeffs: coeffs}, RevealSender: 1}
+	acast := services.NewACastMessage(reveal.String(), 1)
+	msg := services.ABAMessage{
+		Type: services.ABA_ICC,
+		ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+			Type:     services.IVSS_ACast,
+			ACastMsg: &acast,
+		}},
+	}
+
+	jsonData, _ := json.Marshal(msg)
+	protoData, err := services.MarshalABAMessageProto(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if len(protoData) >= len(jsonData) {
+		t.Errorf("Expected protobuf encoding to be smaller: proto=%d json=%d", len(protoData), len(jsonData))
+	}
+	cborData, err := services.MarshalABAMessageCBOR(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if len(cborData) >= len(jsonData) {
+		t.Errorf("Expected CBOR encoding to be smaller: cbor=%d json=%d", len(cborData), len(jsonData))
+	}
+}
+
+func TestWire_Envelope(t *testing.T) {
+	complete := services.NewACastMessage(services.CompletePayload{Sender: 2, Value: 0}.String(), 2)
+	msg := services.ABAMessage{Type: services.ABA_Complete, Round: 3, CompleteMsg: &complete}
+
+	for _, format := range wireFormats {
+		data, err := services.SealABAMessage(format, msg)
+		if err != nil {
+			t.Fatalf("[%s] Seal failed: %v", format, err)
+		}
+		got, header, err := services.OpenABAMessage(data, nil)
+		if err != nil {
+			t.Fatalf("[%s] Open failed: %v", format, err)
+		}
+		if header.Version != services.WireVersion || header.Format != format || header.Layer != services.ABA_Complete {
+			t.Errorf("[%s] Unexpected header %+v", format, header)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Errorf("[%s] Envelope round trip mismatch", format)
+		}
+	}
+
+	data, _ := services.SealABAMessage(services.Wire_CBOR, msg)
+	if _, _, err := services.OpenABAMessage(data, []services.WireFormat{services.Wire_JSON}); !errors.Is(err, services.ErrWireFormat) {
+		t.Errorf("Expected ErrWireFormat, got %v", err)
+	}
+
+	future := append([]byte(nil), data...)
+	future[1] = services.WireVersion + 1
+	if _, _, err := services.OpenABAMessage(future, nil); !errors.Is(err, services.ErrWireVersion) {
+		t.Errorf("Expected ErrWireVersion, got %v", err)
+	}
+
+	relabeled := append([]byte(nil), data...)
+	relabeled[3] = byte(services.ABA_Vote)
+	if _, _, err := services.OpenABAMessage(relabeled, nil); !errors.Is(err, services.ErrWireLayer) {
+		t.Errorf("Expected ErrWireLayer, got %v", err)
+	}
+
+	if _, _, err := services.OpenABAMessage([]byte{0x01}, nil); !errors.Is(err, services.ErrEnvelopeMalformed) {
+		t.Errorf("Expected ErrEnvelopeMalformed, got %v", err)
+	}
+}
+
+func TestWire_NegotiateFormat(t *testing.T) {
+	local := []services.WireFormat{services.Wire_CBOR, services.Wire_Proto, services.Wire_JSON}
+	if f := services.NegotiateWireFormat(local, []services.WireFormat{services.Wire_JSON, services.Wire_Proto}); f != services.Wire_Proto {
+		t.Errorf("Expected proto, got %s", f)
+	}
+	// An old peer that only speaks JSON gets JSON
+	if f := services.NegotiateWireFormat(local, []services.WireFormat{services.Wire_JSON}); f != services.Wire_JSON {
+		t.Errorf("Expected json, got %s", f)
+	}
+}
+
+func TestWire_CanonicalEncoding(t *testing.T) {
+	// Map key order must not depend on insertion or iteration order
+	a := map[string]int{"b": 2, "a": 1, "ccc": 3}
+	b := map[string]int{"ccc": 3, "a": 1, "b": 2}
+	ea, _ := services.CanonicalBytes(a)
+	eb, _ := services.CanonicalBytes(b)
+	if !bytes.Equal(ea, eb) {
+		t.Errorf("Canonical encodings differ: %x vs %x", ea, eb)
+	}
+
+	// Fixed vector: ["ab", 1, 2] in core deterministic CBOR
+	got, err := services.CanonicalBytes([]any{"ab", 1, int64(2)})
+	if err != nil {
+		t.Fatalf("CanonicalBytes failed: %v", err)
+	}
+	if want := []byte{0x83, 0x62, 'a', 'b', 0x01, 0x02}; !bytes.Equal(got, want) {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+
+	hash := sha256.Sum256(got)
+	if uuid := services.ACastUUID("ab", 1, 2); uuid != hex.EncodeToString(hash[:]) {
+		t.Errorf("ACastUUID is not the hash of the canonical encoding: %s", uuid)
+	}
+}
+
+func TestWire_CompactPayloads(t *testing.T) {
+	n := 100
+	set := make([]int, 0, n)
+	for j := 0; j < n; j++ {
+		if j%3 != 0 {
+			set = append(set, j)
+		}
+	}
+	payload := services.ICCPayload{Type: services.ICC_FinalSets, SetH: set, SetS: set, Sender: 4}
+
+	legacy, _ := json.Marshal(struct {
+		Type       services.ICCPayloadType
+		SetH, SetS []int
+		Sender     int
+	}{payload.Type, set, set, payload.Sender})
+	compact := payload.String()
+	if 5*len(compact) > len(legacy) {
+		t.Errorf("Expected bitset sets to be much smaller: compact=%d legacy=%d", len(compact), len(legacy))
+	}
+
+	parsed, err := services.ParseICCPayload(compact)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !reflect.DeepEqual([]int(parsed.SetH), set) || !reflect.DeepEqual([]int(parsed.SetS), set) {
+		t.Errorf("Sets did not survive: %v", parsed.SetH)
+	}
+
+	// Legacy array payloads are still accepted
+	old, err := services.ParseICCPayload(string(legacy))
+	if err != nil || !reflect.DeepEqual([]int(old.SetH), set) {
+		t.Errorf("Legacy payload not parsed: %v %v", err, old)
+	}
+
+	// Unordered sets keep their order by falling back to the array form
+	unordered := services.VotePayload{Type: services.Vote_Vote1, Set: []int{3, 1, 2}}
+	back, _ := services.ParseVotePayload(unordered.String())
+	if !reflect.DeepEqual([]int(back.Set), []int{3, 1, 2}) {
+		t.Errorf("Unordered set changed: %v", back.Set)
+	}
+}
+
+func TestWire_FieldElementEncoding(t *testing.T) {
+	max := new(big.Int).Sub(utils.Prime, big.NewInt(1))
+	b, ok := utils.EncodeFieldElement(max)
+	if !ok || len(b) != utils.FieldElementSize {
+		t.Fatalf("Expected %d bytes, got %d", utils.FieldElementSize, len(b))
+	}
+	x, err := utils.DecodeFieldElement(b)
+	if err != nil || x.Cmp(max) != 0 {
+		t.Errorf("Field element did not survive: %v %v", x, err)
+	}
+	if _, ok := utils.EncodeFieldElement(big.NewInt(-1)); ok {
+		t.Errorf("Negative values must not be encodable")
+	}
+
+	poly := utils.Polynomial{Coeffs: []*big.Int{big.NewInt(5), max}}
+	data, _ := json.Marshal(poly)
+	var back utils.Polynomial
+	if err := json.Unmarshal(data, &back); err != nil || !reflect.DeepEqual(back, poly) {
+		t.Errorf("Polynomial did not survive: %s %v", data, err)
+	}
+	var legacy utils.Polynomial
+	if err := json.Unmarshal([]byte(`{"Coeffs":[5,7]}`), &legacy); err != nil || legacy.Coeffs[1].Int64() != 7 {
+		t.Errorf("Legacy polynomial not parsed: %v", err)
+	}
+}
+
+func TestWire_PolynomialBinary(t *testing.T) {
+	max := new(big.Int).Sub(utils.Prime, big.NewInt(1))
+	poly := utils.Polynomial{Coeffs: []*big.Int{big.NewInt(0), big.NewInt(5), max}}
+	data, err := poly.MarshalBinary()
+	if err != nil || len(data) != 3*utils.FieldElementSize {
+		t.Fatalf("Encoded %d bytes (%v), want %d", len(data), err, 3*utils.FieldElementSize)
+	}
+	var back utils.Polynomial
+	if err := back.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(back, poly) {
+		t.Errorf("Polynomial did not survive: %v %v", back.Coeffs, err)
+	}
+	if err := back.UnmarshalBinary(data[1:]); err == nil {
+		t.Error("Accepted a truncated polynomial")
+	}
+	if _, err := (utils.Polynomial{Coeffs: []*big.Int{big.NewInt(-1)}}).MarshalBinary(); err == nil {
+		t.Error("Encoded a negative coefficient")
+	}
+
+	// The CBOR wire carries the packed form
+	msg := services.ABAMessage{Type: services.ABA_ICC, ICCMsg: &services.ICCMessage{Type: services.ICC_IVSS, IVSSMsg: &services.IVSSMessage{
+		Type: services.IVSS_Direct, DirectType: services.Direct_Share, InstanceID: "i", Poly: &poly,
+	}}}
+	encoded, err := services.EncodeABAMessage(services.Wire_CBOR, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(encoded, data) {
+		t.Error("CBOR encoding does not contain the packed coefficients")
+	}
+	decoded, err := services.DecodeABAMessage(services.Wire_CBOR, encoded)
+	if err != nil || !reflect.DeepEqual(decoded.ICCMsg.IVSSMsg.Poly, &poly) {
+		t.Errorf("Decoded %+v (%v)", decoded.ICCMsg, err)
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Feldman commitments live in the subgroup of order Prime of Z_q*, for the
+// 2048-bit prime q = k*Prime + 1, so that exponents follow the arithmetic of
+// the shares. k is the first even number at or above the 1792-bit
+// big-endian concatenation of SHA-256("aba-ivss-feldman-0"),
+// SHA-256("aba-ivss-feldman-1"), ... (top bit set) that makes q prime, and
+// the generator is 2^k mod q.
+//
+// CommitmentModulus is q.
+var CommitmentModulus, _ = new(big.Int).SetString(""+
+	"98853B1BED9E6D7196331825204C3087C1637FD80D7B8E4A2DAC9FC34235A098"+
+	"98C5FBD5BC432113C48411C562FFB59D5DB63F9FBA4531ADBD9F1792F878E13E"+
+	"C9083E0BAAA9C88C0CC788F5CDBE9F49DCB7CEB935E9F1BD01C66BD6C925D90D"+
+	"C1079475EB65B6E93E626441B2C1EDF2982CD086D45DA670ADE09F8BCECB376D"+
+	"C20F76984A839817FEBF8DDBD391382B43736B36A81F5A0A4E8129F7FD2D8DF4"+
+	"F349CBFE79CD57CBAC998B3824D7C2F77AF8CB2469B43F9D524A949E7D58A23E"+
+	"FF963EFB9A7E56CDA3655A107C069D425CAB36283360C51C6CA7C42D9031B5B6"+
+	"B5DA153EC62FB68D632DDADEFB9D326C0C98D03B179B2663E148BC8122A95143", 16)
+
+// CommitmentGenerator generates the subgroup of order Prime of Z_q*.
+var CommitmentGenerator, _ = new(big.Int).SetString(""+
+	"CFAD2F1D8D1F8D3F3DF5AD632618DAA3FC226E3252361A1FF771DDE4D5C705A5"+
+	"ACEEA9E2361EDC366E39AEFAD0F437B219F1D68092D0A411168928B9BD8C9763"+
+	"A31CC65D991248E610EA49111A911A118DB1B53571B8A8841B6B6CD7EDDC1123"+
+	"9DE2279EEF6DBE9F0D6CE94A19A36A272BD2A7AD83EFD6B0293AE8BC887B3651"+
+	"D02185AD6292DE423AB2C2AD5A6EF67D917E63C86B7FE58362DD93C8AC7ECF8D"+
+	"47F7A1490E2F755A261627BEDF5BD20FA745655A2B86A9920C9D6ABFA8C92E26"+
+	"35B87B6D1F2ECA71CC03C61EC9763C288B5C469E4638A9CC2E2C71B2149FF0C3"+
+	"00C3F4B15AE697930925B6320B3C5242490FBE06475151C6913372B529CC1D1", 16)
+
+// Commitment is a Feldman commitment to a symmetric bivariate polynomial:
+// g^c_ij for its coefficients with i <= j, row by row. It reveals g^secret
+// but nothing about the shares beyond what discrete logarithms give away,
+// and lets every node check its share against the dealer's polynomial.
+type Commitment struct {
+	Degree int
+	Values []*big.Int
+}
+
+// Commit computes the commitment to sp.
+func Commit(sp *SymmetricPolynomial) *Commitment {
+	c := &Commitment{Degree: sp.Degree}
+	for i := 0; i <= sp.Degree; i++ {
+		for j := i; j <= sp.Degree; j++ {
+			c.Values = append(c.Values, new(big.Int).Exp(CommitmentGenerator, sp.Coeffs[i][j], CommitmentModulus))
+		}
+	}
+	return c
+}
+
+// NewCommitment restores a commitment from its values, checking that they
+// are as many as a polynomial has coefficients with i <= j and that each is
+// in the subgroup of order Prime, where exponents may be reduced mod Prime.
+func NewCommitment(values []*big.Int) (*Commitment, error) {
+	degree := 0
+	for (degree+1)*(degree+2)/2 < len(values) {
+		degree++
+	}
+	if len(values) == 0 || (degree+1)*(degree+2)/2 != len(values) {
+		return nil, fmt.Errorf("%d values do not commit to a symmetric polynomial", len(values))
+	}
+	for k, v := range values {
+		if v == nil || v.Sign() <= 0 || v.Cmp(CommitmentModulus) >= 0 ||
+			new(big.Int).Exp(v, Prime, CommitmentModulus).Cmp(big.NewInt(1)) != 0 {
+			return nil, fmt.Errorf("value %d is not a group element", k)
+		}
+	}
+	return &Commitment{Degree: degree, Values: values}, nil
+}
+
+// CommitsToZero reports whether the committed F has F(0, 0) = 0.
+func (c *Commitment) CommitsToZero() bool {
+	return c.Values[0].Cmp(big.NewInt(1)) == 0
+}
+
+// Add returns the commitment to the sum of the polynomials c and o commit
+// to, which must have the same degree.
+func (c *Commitment) Add(o *Commitment) *Commitment {
+	sum := &Commitment{Degree: c.Degree, Values: make([]*big.Int, len(c.Values))}
+	for k := range c.Values {
+		sum.Values[k] = new(big.Int).Mul(c.Values[k], o.Values[k])
+		sum.Values[k].Mod(sum.Values[k], CommitmentModulus)
+	}
+	return sum
+}
+
+// at returns g^c_ij.
+func (c *Commitment) at(i, j int) *big.Int {
+	if i > j {
+		i, j = j, i
+	}
+	// Rows before i hold (d+1) + d + ... + (d+2-i) values
+	return c.Values[i*(c.Degree+1)-i*(i-1)/2+(j-i)]
+}
+
+// VerifyShare checks that f is f_k(y) = F(k, y) for the committed F: the
+// coefficient b_j of f must satisfy g^b_j = prod_i (g^c_ij)^(k^i).
+func (c *Commitment) VerifyShare(k int, f *Polynomial) bool {
+	if f == nil || len(f.Coeffs) != c.Degree+1 {
+		return false
+	}
+	kBig := big.NewInt(int64(k))
+	for j, b := range f.Coeffs {
+		if b == nil || b.Sign() < 0 || b.Cmp(Prime) >= 0 {
+			return false
+		}
+		want := big.NewInt(1)
+		kPow := big.NewInt(1)
+		for i := 0; i <= c.Degree; i++ {
+			term := new(big.Int).Exp(c.at(i, j), kPow, CommitmentModulus)
+			want.Mul(want, term).Mod(want, CommitmentModulus)
+			kPow.Mul(kPow, kBig).Mod(kPow, Prime)
+		}
+		if new(big.Int).Exp(CommitmentGenerator, b, CommitmentModulus).Cmp(want) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyPoint checks that v is F(i, j) for the committed F: g^v must equal
+// prod_{a,b} (g^c_ab)^(i^a j^b).
+func (c *Commitment) VerifyPoint(i, j int, v *big.Int) bool {
+	if v == nil || v.Sign() < 0 || v.Cmp(Prime) >= 0 {
+		return false
+	}
+	iBig, jBig := big.NewInt(int64(i)), big.NewInt(int64(j))
+	want := big.NewInt(1)
+	iPow := big.NewInt(1)
+	for a := 0; a <= c.Degree; a++ {
+		exp := new(big.Int)
+		jPow := big.NewInt(1)
+		for b := 0; b <= c.Degree; b++ {
+			exp.Mul(iPow, jPow).Mod(exp, Prime)
+			term := new(big.Int).Exp(c.at(a, b), exp, CommitmentModulus)
+			want.Mul(want, term).Mod(want, CommitmentModulus)
+			jPow.Mul(jPow, jBig).Mod(jPow, Prime)
+		}
+		iPow.Mul(iPow, iBig).Mod(iPow, Prime)
+	}
+	return new(big.Int).Exp(CommitmentGenerator, v, CommitmentModulus).Cmp(want) == 0
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrUndecodable is returned by CorrectErrors when no polynomial of the
+// degree fits the points with that few errors.
+var ErrUndecodable = errors.New("points are not a codeword within the error bound")
+
+// CorrectErrors finds the polynomial P of at most the given degree with
+// P(xs[i]) == ys[i] for all but at most errs of the points, using the
+// Berlekamp–Welch decoder. The xs must be distinct and there must be at
+// least degree+1+2*errs points, which makes P unique if it exists. The
+// indices of the points P does not pass through are returned with it.
+func CorrectErrors(xs, ys []*big.Int, degree, errs int) (*Polynomial, []int, error) {
+	return DefaultField.CorrectErrors(xs, ys, degree, errs)
+}
+
+// CorrectErrors is the package-level CorrectErrors in f.
+func (f *Field) CorrectErrors(xs, ys []*big.Int, degree, errs int) (*Polynomial, []int, error) {
+	mod := f.modulus()
+	m := len(xs)
+	if len(ys) != m || degree < 0 || errs < 0 {
+		return nil, nil, fmt.Errorf("invalid decoding of %d points to degree %d with %d errors", m, degree, errs)
+	}
+	if m < degree+1+2*errs {
+		return nil, nil, fmt.Errorf("need %d points to correct %d errors, got %d", degree+1+2*errs, errs, m)
+	}
+
+	// Find an error locator E, monic of degree errs, and Q of degree at most
+	// degree+errs with Q(x_i) == y_i * E(x_i) for every point. The unknowns
+	// are the low coefficients of E followed by those of Q:
+	//   sum_j q_j x_i^j - y_i sum_{l<errs} e_l x_i^l = y_i x_i^errs
+	cols := errs + degree + errs + 1
+	rows := make([][]*big.Int, m)
+	for i := range rows {
+		row := make([]*big.Int, cols+1)
+		pow := big.NewInt(1)
+		for j := 0; j <= degree+errs; j++ {
+			if j < errs {
+				row[j] = new(big.Int).Neg(new(big.Int).Mul(ys[i], pow))
+				row[j].Mod(row[j], mod)
+			}
+			row[errs+j] = new(big.Int).Set(pow)
+			if j == errs {
+				row[cols] = new(big.Int).Mul(ys[i], pow)
+				row[cols].Mod(row[cols], mod)
+			}
+			pow = new(big.Int).Mod(new(big.Int).Mul(pow, xs[i]), mod)
+		}
+		rows[i] = row
+	}
+	sol, ok := solveLinear(rows, cols, mod)
+	if !ok {
+		return nil, nil, ErrUndecodable
+	}
+
+	locator := append(sol[:errs:errs], big.NewInt(1))
+	p, ok := divide(sol[errs:], locator, mod)
+	if !ok {
+		return nil, nil, ErrUndecodable
+	}
+	if len(p) > degree+1 {
+		p = p[:degree+1]
+	}
+	poly := &Polynomial{Coeffs: p}
+
+	var wrong []int
+	for i := range xs {
+		if f.Evaluate(poly, xs[i]).Cmp(new(big.Int).Mod(ys[i], mod)) != 0 {
+			wrong = append(wrong, i)
+		}
+	}
+	if len(wrong) > errs {
+		return nil, nil, ErrUndecodable
+	}
+	return poly, wrong, nil
+}
+
+// solveLinear returns a solution of the augmented system rows, with cols
+// unknowns, over the field of mod. Free unknowns are set to zero; false
+// means the system has no solution. The rows are reduced in place.
+func solveLinear(rows [][]*big.Int, cols int, mod *big.Int) ([]*big.Int, bool) {
+	pivots := make([]int, 0, cols)
+	r := 0
+	for c := 0; c < cols && r < len(rows); c++ {
+		pivot := -1
+		for i := r; i < len(rows); i++ {
+			if rows[i][c].Sign() != 0 {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		rows[r], rows[pivot] = rows[pivot], rows[r]
+		inv := new(big.Int).ModInverse(rows[r][c], mod)
+		for j := c; j <= cols; j++ {
+			rows[r][j].Mul(rows[r][j], inv).Mod(rows[r][j], mod)
+		}
+		term := new(big.Int)
+		for i := range rows {
+			if i == r || rows[i][c].Sign() == 0 {
+				continue
+			}
+			f := new(big.Int).Set(rows[i][c])
+			for j := c; j <= cols; j++ {
+				term.Mul(f, rows[r][j])
+				rows[i][j].Sub(rows[i][j], term).Mod(rows[i][j], mod)
+			}
+		}
+		pivots = append(pivots, c)
+		r++
+	}
+	// A remaining row reads 0 == b, which only holds for b == 0
+	for i := r; i < len(rows); i++ {
+		if rows[i][cols].Sign() != 0 {
+			return nil, false
+		}
+	}
+	sol := make([]*big.Int, cols)
+	for j := range sol {
+		sol[j] = new(big.Int)
+	}
+	for i, c := range pivots {
+		sol[c].Set(rows[i][cols])
+	}
+	return sol, true
+}
+
+// divide returns num / den for polynomials given by their coefficients,
+// with den monic, over the field of mod, and false if the division leaves a remainder.
+func divide(num, den []*big.Int, mod *big.Int) ([]*big.Int, bool) {
+	rem := make([]*big.Int, len(num))
+	for i, c := range num {
+		rem[i] = new(big.Int).Set(c)
+	}
+	d := len(den) - 1
+	if len(rem) <= d {
+		for _, c := range rem {
+			if c.Sign() != 0 {
+				return nil, false
+			}
+		}
+		return []*big.Int{new(big.Int)}, true
+	}
+	quo := make([]*big.Int, len(rem)-d)
+	term := new(big.Int)
+	for i := len(quo) - 1; i >= 0; i-- {
+		quo[i] = new(big.Int).Set(rem[i+d])
+		for j, c := range den {
+			term.Mul(quo[i], c)
+			rem[i+j].Sub(rem[i+j], term).Mod(rem[i+j], mod)
+		}
+	}
+	for _, c := range rem[:d] {
+		if c.Sign() != 0 {
+			return nil, false
+		}
+	}
+	return quo, true
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// FieldElementSize is the fixed width in bytes of an encoded field element.
+var FieldElementSize = (Prime.BitLen() + 7) / 8
+
+// EncodeFieldElement writes x as a fixed-width big-endian byte string.
+// It returns false if x is not in [0, 2^(8*FieldElementSize)).
+func EncodeFieldElement(x *big.Int) ([]byte, bool) {
+	if x == nil || x.Sign() < 0 || x.BitLen() > 8*FieldElementSize {
+		return nil, false
+	}
+	return x.FillBytes(make([]byte, FieldElementSize)), true
+}
+
+// DecodeFieldElement reads a fixed-width big-endian field element.
+func DecodeFieldElement(b []byte) (*big.Int, error) {
+	if len(b) != FieldElementSize {
+		return nil, fmt.Errorf("field element must be %d bytes, got %d", FieldElementSize, len(b))
+	}
+	x := new(big.Int).SetBytes(b)
+	if x.Sign() == 0 {
+		return new(big.Int), nil // same representation as big.NewInt(0)
+	}
+	return x, nil
+}
+
+// MarshalBinary encodes the coefficients as consecutive fixed-width field
+// elements, FieldElementSize bytes each, lowest degree first.
+func (p Polynomial) MarshalBinary() ([]byte, error) {
+	packed := make([]byte, 0, len(p.Coeffs)*FieldElementSize)
+	for k, c := range p.Coeffs {
+		b, ok := EncodeFieldElement(c)
+		if !ok {
+			return nil, fmt.Errorf("coefficient %d does not fit %d bytes", k, FieldElementSize)
+		}
+		packed = append(packed, b...)
+	}
+	return packed, nil
+}
+
+// UnmarshalBinary decodes coefficients written by MarshalBinary.
+func (p *Polynomial) UnmarshalBinary(data []byte) error {
+	if len(data)%FieldElementSize != 0 {
+		return fmt.Errorf("packed coefficients length %d is not a multiple of %d", len(data), FieldElementSize)
+	}
+	p.Coeffs = make([]*big.Int, len(data)/FieldElementSize)
+	for k := range p.Coeffs {
+		p.Coeffs[k], _ = DecodeFieldElement(data[k*FieldElementSize : (k+1)*FieldElementSize])
+	}
+	return nil
+}
+
+// MarshalJSON encodes the coefficients as one base64 string of fixed-width
+// field elements instead of an array of decimal numbers. Coefficients that do
+// not fit the fixed width fall back to the array form.
+func (p Polynomial) MarshalJSON() ([]byte, error) {
+	type plain Polynomial
+	if p.Coeffs == nil {
+		return json.Marshal(plain(p))
+	}
+	packed, err := p.MarshalBinary()
+	if err != nil {
+		return json.Marshal(plain(p))
+	}
+	return json.Marshal(struct{ Coeffs string }{base64.StdEncoding.EncodeToString(packed)})
+}
+
+// UnmarshalJSON accepts both the packed and the array form.
+func (p *Polynomial) UnmarshalJSON(data []byte) error {
+	var raw struct{ Coeffs json.RawMessage }
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Coeffs) == 0 || raw.Coeffs[0] != '"' {
+		type plain Polynomial
+		return json.Unmarshal(data, (*plain)(p))
+	}
+
+	var s string
+	if err := json.Unmarshal(raw.Coeffs, &s); err != nil {
+		return err
+	}
+	packed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return p.UnmarshalBinary(packed)
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// symbolSize is the number of data bytes per field element: one byte less
+// than FieldElementSize, so every symbol is below Prime.
+var symbolSize = FieldElementSize - 1
+
+// EncodeFragments splits data into n fragments of a Reed–Solomon code over
+// the field of Prime, any k of which recover it with DecodeFragments. The
+// data is cut into stripes of k symbols, each taken as the coefficients of a
+// polynomial of degree k-1; fragment i holds the evaluations at x = i+1, so
+// each is about len(data)/k bytes.
+func EncodeFragments(data []byte, k, n int) ([][]byte, error) {
+	if k < 1 || n < k {
+		return nil, fmt.Errorf("invalid code: %d of %d fragments", k, n)
+	}
+	// The length prefix tells the data apart from the padding
+	stripe := k * symbolSize
+	padded := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(padded, uint64(len(data)))
+	copy(padded[8:], data)
+	if rem := len(padded) % stripe; rem != 0 {
+		padded = append(padded, make([]byte, stripe-rem)...)
+	}
+
+	fragments := make([][]byte, n)
+	for i := range fragments {
+		fragments[i] = make([]byte, 0, len(padded)/stripe*FieldElementSize)
+	}
+	poly := &Polynomial{Coeffs: make([]*big.Int, k)}
+	for off := 0; off < len(padded); off += stripe {
+		for j := range poly.Coeffs {
+			poly.Coeffs[j] = new(big.Int).SetBytes(padded[off+j*symbolSize : off+(j+1)*symbolSize])
+		}
+		for i := range fragments {
+			y, _ := EncodeFieldElement(poly.Evaluate(big.NewInt(int64(i + 1))))
+			fragments[i] = append(fragments[i], y...)
+		}
+	}
+	return fragments, nil
+}
+
+// DecodeFragments recovers the data from at least k fragments of
+// EncodeFragments, keyed by their index (0..n-1). Fragments that are not
+// part of one codeword may decode to other data; compare the re-encoding
+// to detect that.
+func DecodeFragments(fragments map[int][]byte, k, n int) ([]byte, error) {
+	if k < 1 || n < k {
+		return nil, fmt.Errorf("invalid code: %d of %d fragments", k, n)
+	}
+	var indices []int
+	for i := range fragments {
+		if i >= 0 && i < n {
+			indices = append(indices, i)
+		}
+	}
+	if len(indices) < k {
+		return nil, fmt.Errorf("need %d fragments, got %d", k, len(indices))
+	}
+	slices.Sort(indices)
+	indices = indices[:k]
+
+	size := len(fragments[indices[0]])
+	if size == 0 || size%FieldElementSize != 0 {
+		return nil, fmt.Errorf("invalid fragment size %d", size)
+	}
+	xs := make([]*big.Int, k)
+	for j, i := range indices {
+		if len(fragments[i]) != size {
+			return nil, errors.New("fragments differ in size")
+		}
+		xs[j] = big.NewInt(int64(i + 1))
+	}
+	basis := lagrangeBasis(xs)
+
+	data := make([]byte, 0, size/FieldElementSize*k*symbolSize)
+	coeff, term := new(big.Int), new(big.Int)
+	for off := 0; off < size; off += FieldElementSize {
+		ys := make([]*big.Int, k)
+		for j, i := range indices {
+			y, err := DecodeFieldElement(fragments[i][off : off+FieldElementSize])
+			if err != nil {
+				return nil, err
+			}
+			ys[j] = y
+		}
+		for d := 0; d < k; d++ {
+			coeff.SetInt64(0)
+			for j := range ys {
+				term.Mul(ys[j], basis[j][d])
+				coeff.Add(coeff, term)
+			}
+			coeff.Mod(coeff, Prime)
+			if coeff.BitLen() > 8*symbolSize {
+				return nil, errors.New("fragments are not a valid encoding")
+			}
+			data = append(data, coeff.FillBytes(make([]byte, symbolSize))...)
+		}
+	}
+
+	length := binary.BigEndian.Uint64(data)
+	if length > uint64(len(data)-8) {
+		return nil, errors.New("fragments are not a valid encoding")
+	}
+	return data[8 : 8+length], nil
+}
+
+// lagrangeBasis returns the coefficients of the Lagrange basis polynomials
+// l_j(x) = product_{m!=j} (x - x_m) / (x_j - x_m) for the points xs.
+func lagrangeBasis(xs []*big.Int) [][]*big.Int {
+	k := len(xs)
+	basis := make([][]*big.Int, k)
+	for j := range xs {
+		// Multiply out the numerator one factor (x - x_m) at a time
+		num := []*big.Int{big.NewInt(1)}
+		den := big.NewInt(1)
+		for m := range xs {
+			if m == j {
+				continue
+			}
+			next := make([]*big.Int, len(num)+1)
+			for d := range next {
+				next[d] = new(big.Int)
+			}
+			for d, c := range num {
+				next[d+1].Add(next[d+1], c)
+				next[d].Sub(next[d], new(big.Int).Mul(c, xs[m]))
+			}
+			num = next
+			den.Mul(den, new(big.Int).Sub(xs[j], xs[m]))
+			den.Mod(den, Prime)
+		}
+		denInv := new(big.Int).ModInverse(den, Prime)
+		for d := range num {
+			num[d].Mul(num[d], denInv)
+			num[d].Mod(num[d], Prime)
+		}
+		basis[j] = num
+	}
+	return basis
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Field is a prime field to share secrets in. The package-level polynomial
+// functions work in DefaultField; the methods of a Field do the same in
+// it, so secrets of different downstream schemes can be shared side by
+// side. A nil *Field is DefaultField.
+type Field struct {
+	Name    string
+	Modulus *big.Int
+}
+
+// DefaultField is the field of Prime.
+var DefaultField = &Field{Name: "secp256k1", Modulus: Prime}
+
+// BLS12381Scalar is the scalar field of BLS12-381, for sharing BLS keys.
+var BLS12381Scalar = mustField("bls12-381-scalar", "73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001")
+
+// NewField returns the field of modulus, which must be a prime that fits
+// in FieldElementSize bytes so its elements encode like those of Prime.
+func NewField(name string, modulus *big.Int) (*Field, error) {
+	if modulus == nil || modulus.Cmp(big.NewInt(2)) < 0 || !modulus.ProbablyPrime(32) {
+		return nil, fmt.Errorf("field %s: modulus is not a prime", name)
+	}
+	if modulus.BitLen() > 8*FieldElementSize {
+		return nil, fmt.Errorf("field %s: modulus of %d bits does not fit in %d bytes", name, modulus.BitLen(), FieldElementSize)
+	}
+	return &Field{Name: name, Modulus: new(big.Int).Set(modulus)}, nil
+}
+
+func mustField(name, hex string) *Field {
+	modulus, _ := new(big.Int).SetString(hex, 16)
+	f, err := NewField(name, modulus)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func (f *Field) modulus() *big.Int {
+	if f == nil {
+		return Prime
+	}
+	return f.Modulus
+}
+
+// String returns the name of the field.
+func (f *Field) String() string {
+	if f == nil {
+		return DefaultField.Name
+	}
+	return f.Name
+}
+
+// Equal reports whether f and g are the same field.
+func (f *Field) Equal(g *Field) bool {
+	return f.modulus().Cmp(g.modulus()) == 0
+}
+
+// Contains reports whether v is an element of f, in [0, modulus).
+func (f *Field) Contains(v *big.Int) bool {
+	return v != nil && v.Sign() >= 0 && v.Cmp(f.modulus()) < 0
+}
+
+// ContainsPolynomial reports whether every coefficient of p is an element
+// of f.
+func (f *Field) ContainsPolynomial(p *Polynomial) bool {
+	if p == nil {
+		return false
+	}
+	for _, c := range p.Coeffs {
+		if !f.Contains(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// NodeSet is a set of process IDs. In JSON it is encoded as a base64 bitset
+// (bit i of byte i/8 set for process i) when the IDs are strictly increasing
+// and non-negative, which is how the protocols build their sets. Anything
+// else keeps the plain array form so that no information is lost.
+type NodeSet []int
+
+// maxBitsetID bounds the bitset size so a huge ID cannot force a huge allocation.
+const maxBitsetID = 1 << 16
+
+func (s NodeSet) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	if !s.bitsetEncodable() {
+		return json.Marshal([]int(s))
+	}
+	var bits []byte
+	if len(s) > 0 {
+		bits = make([]byte, s[len(s)-1]/8+1)
+	}
+	for _, id := range s {
+		bits[id/8] |= 1 << (id % 8)
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(bits))
+}
+
+// UnmarshalJSON accepts both the bitset and the array form.
+func (s *NodeSet) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '"' {
+		return json.Unmarshal(data, (*[]int)(s))
+	}
+	var enc string
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	bits, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return err
+	}
+	set := make(NodeSet, 0)
+	for i, b := range bits {
+		for k := 0; k < 8; k++ {
+			if b&(1<<k) != 0 {
+				set = append(set, i*8+k)
+			}
+		}
+	}
+	*s = set
+	return nil
+}
+
+func (s NodeSet) bitsetEncodable() bool {
+	for k, id := range s {
+		if id < 0 || id > maxBitsetID || (k > 0 && id <= s[k-1]) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,11 +2,13 @@ package utils
 
 import (
 	"crypto/rand"
+	"io"
 	"math/big"
+	"sync"
 )
 
 // Prime field modulus. Using a large prime for security (Secp256k1 order).
-// In a real system, this should be configurable.
+// It is the modulus of DefaultField; see Field for others.
 var Prime, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
 
 // Polynomial represents a univariate polynomial over a finite field.
@@ -15,41 +17,83 @@ type Polynomial struct {
 	Coeffs []*big.Int
 }
 
-// Evaluate evaluates the polynomial at x.
+// Evaluate evaluates the polynomial at x in DefaultField.
 func (p *Polynomial) Evaluate(x *big.Int) *big.Int {
+	return DefaultField.Evaluate(p, x)
+}
+
+// Evaluate evaluates p at x in f.
+func (f *Field) Evaluate(p *Polynomial, x *big.Int) *big.Int {
+	mod := f.modulus()
 	result := big.NewInt(0)
 	// Horner's method
 	for i := len(p.Coeffs) - 1; i >= 0; i-- {
 		result.Mul(result, x)
 		result.Add(result, p.Coeffs[i])
-		result.Mod(result, Prime)
+		result.Mod(result, mod)
 	}
 	return result
 }
 
+// Add returns p + q in DefaultField.
+func (p *Polynomial) Add(q *Polynomial) *Polynomial {
+	return DefaultField.Add(p, q)
+}
+
+// Add returns p + q in f.
+func (f *Field) Add(p, q *Polynomial) *Polynomial {
+	mod := f.modulus()
+	sum := &Polynomial{Coeffs: make([]*big.Int, max(len(p.Coeffs), len(q.Coeffs)))}
+	for i := range sum.Coeffs {
+		sum.Coeffs[i] = new(big.Int)
+		if i < len(p.Coeffs) {
+			sum.Coeffs[i].Add(sum.Coeffs[i], p.Coeffs[i])
+		}
+		if i < len(q.Coeffs) {
+			sum.Coeffs[i].Add(sum.Coeffs[i], q.Coeffs[i])
+		}
+		sum.Coeffs[i].Mod(sum.Coeffs[i], mod)
+	}
+	return sum
+}
+
 // SymmetricPolynomial represents a symmetric bivariate polynomial F(x, y).
 // F(x, y) = sum_{i,j} C_{ij} * x^i * y^j where C_{ij} = C_{ji}.
 type SymmetricPolynomial struct {
 	Coeffs [][]*big.Int // Matrix of coefficients
 	Degree int
+
+	field *Field // Of the coefficients, DefaultField if nil
 }
 
 // NewRandomSymmetricPolynomial creates a random symmetric polynomial of degree t with F(0,0) = secret.
 func NewRandomSymmetricPolynomial(degree int, secret *big.Int) (*SymmetricPolynomial, error) {
+	return NewRandomSymmetricPolynomialFrom(rand.Reader, degree, secret)
+}
+
+// NewRandomSymmetricPolynomialFrom is NewRandomSymmetricPolynomial drawing the coefficients from r.
+func NewRandomSymmetricPolynomialFrom(r io.Reader, degree int, secret *big.Int) (*SymmetricPolynomial, error) {
+	return DefaultField.NewRandomSymmetricPolynomial(r, degree, secret)
+}
+
+// NewRandomSymmetricPolynomial creates a random symmetric polynomial over f
+// of degree t with F(0,0) = secret, drawing the coefficients from r.
+func (f *Field) NewRandomSymmetricPolynomial(r io.Reader, degree int, secret *big.Int) (*SymmetricPolynomial, error) {
+	mod := f.modulus()
 	coeffs := make([][]*big.Int, degree+1)
 	for i := range coeffs {
 		coeffs[i] = make([]*big.Int, degree+1)
 	}
 
 	// Set F(0,0) = secret, which corresponds to C_{00}
-	coeffs[0][0] = new(big.Int).Set(secret)
+	coeffs[0][0] = new(big.Int).Mod(secret, mod)
 
 	for i := 0; i <= degree; i++ {
 		for j := 0; j <= i; j++ { // Fill lower triangle and diagonal
 			if i == 0 && j == 0 {
 				continue
 			}
-			randVal, err := rand.Int(rand.Reader, Prime)
+			randVal, err := rand.Int(r, mod)
 			if err != nil {
 				return nil, err
 			}
@@ -61,6 +105,7 @@ func NewRandomSymmetricPolynomial(degree int, secret *big.Int) (*SymmetricPolyno
 	return &SymmetricPolynomial{
 		Coeffs: coeffs,
 		Degree: degree,
+		field:  f,
 	}, nil
 }
 
@@ -70,6 +115,7 @@ func (sp *SymmetricPolynomial) GetUnivariatePolynomial(k *big.Int) *Polynomial {
 	// f_k(y) = sum_{j=0}^t ( sum_{i=0}^t C_{ij} * k^i ) * y^j
 	// The coefficient for y^j is sum_{i=0}^t C_{ij} * k^i
 
+	mod := sp.field.modulus()
 	polyCoeffs := make([]*big.Int, sp.Degree+1)
 
 	for j := 0; j <= sp.Degree; j++ {
@@ -79,13 +125,13 @@ func (sp *SymmetricPolynomial) GetUnivariatePolynomial(k *big.Int) *Polynomial {
 			term := new(big.Int).Set(sp.Coeffs[i][j])
 
 			// k^i
-			kPowI := new(big.Int).Exp(k, big.NewInt(int64(i)), Prime)
+			kPowI := new(big.Int).Exp(k, big.NewInt(int64(i)), mod)
 
 			term.Mul(term, kPowI)
-			term.Mod(term, Prime)
+			term.Mod(term, mod)
 
 			coeffJ.Add(coeffJ, term)
-			coeffJ.Mod(coeffJ, Prime)
+			coeffJ.Mod(coeffJ, mod)
 		}
 		polyCoeffs[j] = coeffJ
 	}
@@ -93,8 +139,114 @@ func (sp *SymmetricPolynomial) GetUnivariatePolynomial(k *big.Int) *Polynomial {
 	return &Polynomial{Coeffs: polyCoeffs}
 }
 
+// Rows returns f_k(y) = F(k, y) for k = 1..n, computed by up to workers
+// goroutines; workers <= 1 computes them in the calling goroutine.
+func (sp *SymmetricPolynomial) Rows(n, workers int) []*Polynomial {
+	rows := make([]*Polynomial, n)
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for k := 1; k <= n; k++ {
+			rows[k-1] = sp.GetUnivariatePolynomial(big.NewInt(int64(k)))
+		}
+		return rows
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				rows[k-1] = sp.GetUnivariatePolynomial(big.NewInt(int64(k)))
+			}
+		}()
+	}
+	for k := 1; k <= n; k++ {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+	return rows
+}
+
+// BivariatePolynomial represents a bivariate polynomial F(x, y) of degree
+// DegreeX in x and DegreeY in y, which need not be symmetric. With degrees
+// (t, 2t) it deals a dual-threshold sharing: t+1 rows F(k, y) determine F,
+// while the shares F(0, k) of the secret lie on a polynomial of degree 2t.
+// F(x, y) = sum_{i,j} C_{ij} * x^i * y^j.
+type BivariatePolynomial struct {
+	Coeffs  [][]*big.Int // C_{ij}, DegreeX+1 rows of DegreeY+1
+	DegreeX int
+	DegreeY int
+
+	field *Field // Of the coefficients, DefaultField if nil
+}
+
+// NewRandomBivariatePolynomialFrom creates a random bivariate polynomial of
+// degrees (degreeX, degreeY) with F(0,0) = secret, drawing the coefficients
+// from r.
+func NewRandomBivariatePolynomialFrom(r io.Reader, degreeX, degreeY int, secret *big.Int) (*BivariatePolynomial, error) {
+	return DefaultField.NewRandomBivariatePolynomial(r, degreeX, degreeY, secret)
+}
+
+// NewRandomBivariatePolynomial is NewRandomBivariatePolynomialFrom over f.
+func (f *Field) NewRandomBivariatePolynomial(r io.Reader, degreeX, degreeY int, secret *big.Int) (*BivariatePolynomial, error) {
+	mod := f.modulus()
+	coeffs := make([][]*big.Int, degreeX+1)
+	for i := range coeffs {
+		coeffs[i] = make([]*big.Int, degreeY+1)
+		for j := range coeffs[i] {
+			if i == 0 && j == 0 {
+				coeffs[i][j] = new(big.Int).Mod(secret, mod)
+				continue
+			}
+			randVal, err := rand.Int(r, mod)
+			if err != nil {
+				return nil, err
+			}
+			coeffs[i][j] = randVal
+		}
+	}
+	return &BivariatePolynomial{Coeffs: coeffs, DegreeX: degreeX, DegreeY: degreeY, field: f}, nil
+}
+
+// Row returns F(k, y), of degree DegreeY.
+func (bp *BivariatePolynomial) Row(k *big.Int) *Polynomial {
+	mod := bp.field.modulus()
+	row := make([]*big.Int, bp.DegreeY+1)
+	for j := range row {
+		row[j] = new(big.Int)
+	}
+	kPow := big.NewInt(1)
+	for i := 0; i <= bp.DegreeX; i++ {
+		for j := range row {
+			row[j].Add(row[j], new(big.Int).Mul(bp.Coeffs[i][j], kPow)).Mod(row[j], mod)
+		}
+		kPow = new(big.Int).Mod(new(big.Int).Mul(kPow, k), mod)
+	}
+	return &Polynomial{Coeffs: row}
+}
+
+// Column returns F(x, k), of degree DegreeX.
+func (bp *BivariatePolynomial) Column(k *big.Int) *Polynomial {
+	column := make([]*big.Int, bp.DegreeX+1)
+	for i := range column {
+		column[i] = bp.field.Evaluate(&Polynomial{Coeffs: bp.Coeffs[i]}, k)
+	}
+	return &Polynomial{Coeffs: column}
+}
+
 // InterpolateAtZero computes L(0) for the polynomial L passing through (x_i, y_i)
 func InterpolateAtZero(xs, ys []*big.Int) *big.Int {
+	return DefaultField.InterpolateAtZero(xs, ys)
+}
+
+// InterpolateAtZero is the package-level InterpolateAtZero in f.
+func (f *Field) InterpolateAtZero(xs, ys []*big.Int) *big.Int {
+	mod := f.modulus()
 	result := big.NewInt(0)
 	k := len(xs)
 
@@ -114,30 +266,30 @@ func InterpolateAtZero(xs, ys []*big.Int) *big.Int {
 			// num *= -x_m
 			negXm := new(big.Int).Neg(xs[m])
 			num.Mul(num, negXm)
-			num.Mod(num, Prime)
+			num.Mod(num, mod)
 
 			// den *= (x_j - x_m)
 			diff := new(big.Int).Sub(xs[j], xs[m])
 			den.Mul(den, diff)
-			den.Mod(den, Prime)
+			den.Mod(den, mod)
 		}
 
 		// term = y_j * num * den^-1
 		term := new(big.Int).Set(ys[j])
 		term.Mul(term, num)
-		term.Mod(term, Prime)
+		term.Mod(term, mod)
 
-		denInv := new(big.Int).ModInverse(den, Prime)
+		denInv := new(big.Int).ModInverse(den, mod)
 		term.Mul(term, denInv)
-		term.Mod(term, Prime)
+		term.Mod(term, mod)
 
 		result.Add(result, term)
-		result.Mod(result, Prime)
+		result.Mod(result, mod)
 	}
 
 	// Handle negative result
 	if result.Sign() < 0 {
-		result.Add(result, Prime)
+		result.Add(result, mod)
 	}
 
 	return result
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"async-agreement-protocol-3/services"
+	"async-agreement-protocol-3/utils"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+)
+
+// Test vectors for alternative implementations. Everything here is fixed
+// (no randomness, no clocks) so the output is identical on every run.
+
+type messageVector struct {
+	Name     string
+	Message  services.ABAMessage
+	Encoded  map[string]string // wire format -> hex
+	Envelope map[string]string // wire format -> hex of the sealed envelope
+}
+
+type polynomialVector struct {
+	Coeffs      []string
+	Evaluations map[string]string // x -> f(x)
+}
+
+type symmetricVector struct {
+	Coeffs [][]string
+	Secret string
+	Shares map[string][]string // k -> coefficients of f_k(y) = F(k, y)
+}
+
+type interpolationVector struct {
+	Xs     []string
+	Ys     []string
+	AtZero string
+}
+
+type canonicalVector struct {
+	Value     string
+	From      int
+	Nonce     int64
+	Canonical string // hex
+	UUID      string
+}
+
+type acastStep struct {
+	Input      services.ACastMessage[string]
+	Broadcasts []services.ACastMessage[string]
+	Delivered  []string
+}
+
+type acastVector struct {
+	N, T, Node int
+	Steps      []acastStep
+}
+
+// runVectors implements `aba vectors`.
+func runVectors(args []string) error {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	out := fs.String("out", "vectors", "Directory to write the fixtures to")
+	fs.Parse(args)
+
+	if err := os.MkdirAll(filepath.Join(*out, "messages"), 0o755); err != nil {
+		return err
+	}
+
+	messages, err := messageVectors()
+	if err != nil {
+		return err
+	}
+	for _, v := range messages {
+		for format, h := range v.Encoded {
+			b, _ := hex.DecodeString(h)
+			name := filepath.Join(*out, "messages", fmt.Sprintf("%s.%s.bin", v.Name, format))
+			if err := os.WriteFile(name, b, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+
+	fixtures := map[string]any{
+		"messages.json":      messages,
+		"polynomials.json":   map[string]any{"Prime": utils.Prime.String(), "FieldElementSize": utils.FieldElementSize, "Univariate": polynomialVectors(), "Symmetric": symmetricVectors()},
+		"interpolation.json": interpolationVectors(),
+		"canonical.json":     canonicalVectors(),
+		"acast.json":         acastVectors(),
+	}
+	for name, v := range fixtures {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(*out, name), append(b, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote test vectors to %s\n", *out)
+	return nil
+}
+
+func fixedPolynomial(coeffs ...int64) *utils.Polynomial {
+	p := &utils.Polynomial{Coeffs: make([]*big.Int, len(coeffs))}
+	for k, c := range coeffs {
+		p.Coeffs[k] = big.NewInt(c)
+	}
+	return p
+}
+
+func decimal(xs []*big.Int) []string {
+	out := make([]string, len(xs))
+	for k, x := range xs {
+		out[k] = x.String()
+	}
+	return out
+}
+
+func fixedACast(val string, from int, typ services.MessageType) *services.ACastMessage[string] {
+	return &services.ACastMessage[string]{
+		Type: typ,
+		UUID: services.ACastUUID(val, from, 1),
+		Val:  val,
+		From: from,
+	}
+}
+
+func messageVectors() ([]messageVector, error) {
+	poly := fixedPolynomial(42, 7, 3)
+	poly.Coeffs[1].Sub(utils.Prime, big.NewInt(1))
+
+	cases := []struct {
+		name string
+		msg  services.ABAMessage
+	}{
+		{"vote_input", services.ABAMessage{Type: services.ABA_Vote, Round: 1, VoteMsg: &services.VoteMessage{
+			Type:     services.Vote_ACast,
+			ACastMsg: fixedACast(services.VotePayload{Type: services.Vote_Input, Sender: 1, Bit: 1, Round: 1}.String(), 1, services.MSG),
+		}}},
+		{"vote_vote1", services.ABAMessage{Type: services.ABA_Vote, Round: 1, VoteMsg: &services.VoteMessage{
+			Type:     services.Vote_ACast,
+			ACastMsg: fixedACast(services.VotePayload{Type: services.Vote_Vote1, Sender: 2, Bit: 0, Set: []int{1, 2, 3}, Round: 1}.String(), 2, services.ECHO),
+		}}},
+		{"icc_final_sets", services.ABAMessage{Type: services.ABA_ICC, Round: 2, ICCMsg: &services.ICCMessage{
+			Type:     services.ICC_ACast,
+			ACastMsg: fixedACast(services.ICCPayload{Type: services.ICC_FinalSets, SetH: []int{1, 2, 3}, SetS: []int{1, 3, 4}, Sender: 3}.String(), 3, services.READY),
+		}}},
+		{"ivss_share", services.ABAMessage{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{
+			Type: services.ICC_IVSS,
+			IVSSMsg: &services.IVSSMessage{
+				Type:       services.IVSS_Direct,
+				DirectType: services.Direct_Share,
+				To:         2,
+				From:       1,
+				InstanceID: "ICC-1-1-1@1",
+				Poly:       poly,
+			},
+		}}},
+		{"ivss_point", services.ABAMessage{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{
+			Type: services.ICC_IVSS,
+			IVSSMsg: &services.IVSSMessage{
+				Type:       services.IVSS_Direct,
+				DirectType: services.Direct_Point,
+				To:         3,
+				From:       2,
+				InstanceID: "ICC-1-1-1@1",
+				Point:      big.NewInt(123456789),
+				PointIdx:   3,
+			},
+		}}},
+		{"ivss_reveal", services.ABAMessage{Type: services.ABA_ICC, Round: 1, ICCMsg: &services.ICCMessage{
+			Type: services.ICC_IVSS,
+			IVSSMsg: &services.IVSSMessage{
+				Type:     services.IVSS_ACast,
+				ACastMsg: fixedACast(services.IVSSPayload{InstanceID: "ICC-1-1-1@1", Type: services.Payload_Reveal, RevealPoly: poly, RevealSender: 2}.String(), 2, services.MSG),
+			},
+		}}},
+		{"complete", services.ABAMessage{Type: services.ABA_Complete, Round: 3,
+			CompleteMsg: fixedACast(services.CompletePayload{Sender: 4, Value: 1}.String(), 4, services.MSG),
+		}},
+	}
+
+	formats := []services.WireFormat{services.Wire_JSON, services.Wire_Proto, services.Wire_CBOR}
+	vectors := make([]messageVector, 0, len(cases))
+	for _, c := range cases {
+		v := messageVector{
+			Name:     c.name,
+			Message:  c.msg,
+			Encoded:  make(map[string]string),
+			Envelope: make(map[string]string),
+		}
+		for _, f := range formats {
+			b, err := services.EncodeABAMessage(f, c.msg)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", c.name, f, err)
+			}
+			v.Encoded[f.String()] = hex.EncodeToString(b)
+			env, err := services.SealABAMessage(f, c.msg)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", c.name, f, err)
+			}
+			v.Envelope[f.String()] = hex.EncodeToString(env)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+func polynomialVectors() []polynomialVector {
+	polys := []*utils.Polynomial{
+		fixedPolynomial(5),
+		fixedPolynomial(1, 2, 3),
+		fixedPolynomial(0, 0, 0, 1),
+	}
+	// A polynomial with coefficients close to the modulus exercises reduction
+	wide := fixedPolynomial(0, 0)
+	wide.Coeffs[0].Sub(utils.Prime, big.NewInt(1))
+	wide.Coeffs[1].Sub(utils.Prime, big.NewInt(2))
+	polys = append(polys, wide)
+
+	vectors := make([]polynomialVector, 0, len(polys))
+	for _, p := range polys {
+		v := polynomialVector{Coeffs: decimal(p.Coeffs), Evaluations: make(map[string]string)}
+		for x := int64(0); x <= 7; x++ {
+			v.Evaluations[fmt.Sprint(x)] = p.Evaluate(big.NewInt(x)).String()
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+func symmetricVectors() symmetricVector {
+	// Degree 2, C_ij = C_ji
+	raw := [][]int64{
+		{11, 2, 3},
+		{2, 5, 7},
+		{3, 7, 13},
+	}
+	sp := &utils.SymmetricPolynomial{Degree: 2, Coeffs: make([][]*big.Int, len(raw))}
+	v := symmetricVector{Coeffs: make([][]string, len(raw)), Secret: "11", Shares: make(map[string][]string)}
+	for i, row := range raw {
+		sp.Coeffs[i] = make([]*big.Int, len(row))
+		for j, c := range row {
+			sp.Coeffs[i][j] = big.NewInt(c)
+		}
+		v.Coeffs[i] = decimal(sp.Coeffs[i])
+	}
+	for k := int64(1); k <= 4; k++ {
+		v.Shares[fmt.Sprint(k)] = decimal(sp.GetUnivariatePolynomial(big.NewInt(k)).Coeffs)
+	}
+	return v
+}
+
+func interpolationVectors() []interpolationVector {
+	// Points of f(x) = 42 + 3x + 5x^2, plus a set with a wrapped-around value
+	f := fixedPolynomial(42, 3, 5)
+	g := fixedPolynomial(0, 1)
+	g.Coeffs[0].Sub(utils.Prime, big.NewInt(5))
+
+	vectors := make([]interpolationVector, 0)
+	for _, c := range []struct {
+		p  *utils.Polynomial
+		xs []int64
+	}{
+		{f, []int64{1, 2, 3}},
+		{f, []int64{2, 5, 7, 9}},
+		{g, []int64{3, 4}},
+	} {
+		xs := make([]*big.Int, len(c.xs))
+		ys := make([]*big.Int, len(c.xs))
+		for k, x := range c.xs {
+			xs[k] = big.NewInt(x)
+			ys[k] = c.p.Evaluate(xs[k])
+		}
+		vectors = append(vectors, interpolationVector{
+			Xs:     decimal(xs),
+			Ys:     decimal(ys),
+			AtZero: utils.InterpolateAtZero(xs, ys).String(),
+		})
+	}
+	return vectors
+}
+
+func canonicalVectors() []canonicalVector {
+	vectors := make([]canonicalVector, 0)
+	for _, c := range []struct {
+		val   string
+		from  int
+		nonce int64
+	}{
+		{"", 0, 0},
+		{"hello", 1, 1},
+		{services.CompletePayload{Sender: 4, Value: 1}.String(), 4, 1700000000000000000},
+	} {
+		b, _ := services.CanonicalBytes([]any{c.val, c.from, c.nonce})
+		vectors = append(vectors, canonicalVector{
+			Value:     c.val,
+			From:      c.from,
+			Nonce:     c.nonce,
+			Canonical: hex.EncodeToString(b),
+			UUID:      services.ACastUUID(c.val, c.from, c.nonce),
+		})
+	}
+	return vectors
+}
+
+// vectorContext records what a service emits for a single input message.
+type vectorContext struct {
+	broadcasts []services.ACastMessage[string]
+	delivered  []string
+}
+
+func (c *vectorContext) Broadcast(msg services.ACastMessage[string]) {
+	c.broadcasts = append(c.broadcasts, msg)
+}
+
+func (c *vectorContext) SendTo(to int, msg services.ACastMessage[string]) {
+	c.broadcasts = append(c.broadcasts, msg)
+}
+
+func (c *vectorContext) SendResult(res string) {
+	c.delivered = append(c.delivered, res)
+}
+
+func acastVectors() acastVector {
+	// Node 1 of n=4, t=1 follows one broadcast from MSG to delivery
+	n, t, node := 4, 1, 1
+	svc := services.NewAcastService[string](node, n, t, zerolog.Disabled)
+	msg := fixedACast("v", 2, services.MSG)
+
+	inputs := []services.ACastMessage[string]{*msg}
+	for _, from := range []int{2, 3, 4} {
+		inputs = append(inputs, services.ACastMessage[string]{Type: services.ECHO, UUID: msg.UUID, Val: msg.Val, From: from})
+	}
+	for _, from := range []int{2, 3, 4} {
+		inputs = append(inputs, services.ACastMessage[string]{Type: services.READY, UUID: msg.UUID, Val: msg.Val, From: from})
+	}
+
+	v := acastVector{N: n, T: t, Node: node}
+	for _, in := range inputs {
+		ctx := &vectorContext{}
+		svc.OnMessage(in, ctx)
+		v.Steps = append(v.Steps, acastStep{Input: in, Broadcasts: ctx.broadcasts, Delivered: ctx.delivered})
+	}
+	return v
+}
@@ -0,0 +1,8 @@
+// Package wire holds the protobuf schema for the messages exchanged between
+// nodes. The Go conversions live in services (see services/wire_proto.go) so
+// that this package does not depend on the protocol implementation. The Peer
+// service in transport.proto carries the encoded messages between processes.
+package wire
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative messages.proto
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative transport.proto